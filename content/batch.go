@@ -0,0 +1,52 @@
+package content
+
+import (
+	"context"
+
+	"encore.app/content/convert"
+	"encore.app/content/internal"
+	"encore.dev/types/uuid"
+)
+
+// BatchParams is the parameters for running a batch of operations on the documents of a database
+type BatchParams struct {
+	// The unique identifier of the database the documents belong to
+	DatabaseID int64
+
+	// The operations to run, in order. A batch contains at most 1000 operations
+	Operations []convert.BatchOperation
+
+	// The key of a transaction to run the operation in, changes made in a transaction are only visible
+	// in that transaction until it is committed
+	TransactionKey uuid.UUID
+}
+
+// BatchResponse is the result of running a batch of operations
+type BatchResponse struct {
+	// A message to inform the user of the result of the operation
+	Message string
+
+	// The document created, updated, patched or deleted by each operation, in the order of the operations
+	Results []convert.DocumentPayload
+}
+
+// Batch runs a list of create, update, patch and delete operations on documents across the collections of
+// a database. The operations run in order in a single SQL transaction, either all of them are applied or
+// none are. When an operation fails, the error tells the index of the failing operation.
+//encore:api auth
+func Batch(ctx context.Context, params *BatchParams) (*BatchResponse, error) {
+	ctx, err := internal.WithTransaction(ctx, params.TransactionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := internal.Batch(ctx, params.DatabaseID, params.Operations)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BatchResponse{
+		Message: "Batch ran successfully.",
+		Results: results,
+	}, nil
+}
@@ -0,0 +1,426 @@
+package content
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"encore.app/content/convert"
+	"encore.app/content/internal"
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/models/generated/content/public/table"
+	"encore.app/content/test_utils"
+	"encore.app/identity"
+	"encore.app/permissions"
+	test_utils_permissions "encore.app/permissions/test_utils"
+	test_utils2 "encore.app/test_utils"
+)
+
+func TestBatch(t *testing.T) {
+	now := time.Now()
+
+	type expected struct {
+		results   []convert.DocumentPayload
+		documents []convert.DocumentPayload
+		err       error
+	}
+
+	existingDatabases := []*model.Databases{
+		{
+			ID:        1,
+			Name:      "test",
+			UserID:    1,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		{
+			ID:        2,
+			Name:      "other",
+			UserID:    1,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+	}
+
+	// IDs are kept away from the sequences, documents created in a batch take their ID from them
+	existingCollections := []*model.Collections{
+		{
+			ID:         1000001,
+			DatabaseID: existingDatabases[0].ID,
+			Name:       "test",
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		},
+		{
+			ID:         1000002,
+			DatabaseID: existingDatabases[1].ID,
+			Name:       "test",
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		},
+	}
+
+	existingDocuments := []*model.Documents{
+		{
+			ID:           1000003,
+			CollectionID: existingCollections[0].ID,
+			Content:      `{"foo": "bar"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ID:           1000004,
+			CollectionID: existingCollections[0].ID,
+			Content:      `{"bar": "foo"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+	}
+
+	tcs := []struct {
+		scenario string
+		userData *identity.UserData
+		userCan  *string
+		params   *BatchParams
+		expected expected
+	}{
+		{
+			scenario: "Will run all the operations in order",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &BatchParams{
+				DatabaseID: existingDatabases[0].ID,
+				Operations: []convert.BatchOperation{
+					{
+						Op:           "create",
+						CollectionID: existingCollections[0].ID,
+						Content:      json.RawMessage(`{"baz": "qux"}`),
+					},
+					{
+						Op:      "update",
+						ID:      existingDocuments[0].ID,
+						Content: json.RawMessage(`{"foo": "baz"}`),
+					},
+					{
+						Op:         "patch",
+						ID:         existingDocuments[0].ID,
+						MergePatch: json.RawMessage(`{"bar": "baz"}`),
+						IfVersion:  test_utils.Int64Pointer(2),
+					},
+					{
+						Op: "delete",
+						ID: existingDocuments[1].ID,
+					},
+				},
+			},
+			expected: expected{
+				results: []convert.DocumentPayload{
+					{
+						Content: json.RawMessage(`"{\"baz\": \"qux\"}"`),
+						Version: 1,
+					},
+					{
+						Content: json.RawMessage(`"{\"foo\": \"baz\"}"`),
+						Version: 2,
+					},
+					{
+						Content: json.RawMessage(`"{\"bar\": \"baz\", \"foo\": \"baz\"}"`),
+						Version: 3,
+					},
+					{
+						Content: json.RawMessage(`"{\"bar\": \"foo\"}"`),
+						Version: 1,
+					},
+				},
+				documents: []convert.DocumentPayload{
+					{
+						Content: json.RawMessage(`"{\"baz\": \"qux\"}"`),
+					},
+					{
+						ID:      existingDocuments[0].ID,
+						Content: json.RawMessage(`"{\"bar\": \"baz\", \"foo\": \"baz\"}"`),
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will not apply any operation when one fails",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &BatchParams{
+				DatabaseID: existingDatabases[0].ID,
+				Operations: []convert.BatchOperation{
+					{
+						Op: "delete",
+						ID: existingDocuments[0].ID,
+					},
+					{
+						Op:        "update",
+						ID:        existingDocuments[1].ID,
+						Content:   json.RawMessage(`{"foo": "baz"}`),
+						IfVersion: test_utils.Int64Pointer(3),
+					},
+				},
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.FailedPrecondition,
+					Message: "Operation 1 of the batch failed: Document was modified, its current version is 1",
+					Details: &internal.BatchOperationFailure{
+						Index:   1,
+						Details: &internal.VersionMismatch{CurrentVersion: 1},
+					},
+				},
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+		{
+			scenario: "Will throw an error when two operations create documents with the same key",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &BatchParams{
+				DatabaseID: existingDatabases[0].ID,
+				Operations: []convert.BatchOperation{
+					{
+						Op:           "create",
+						CollectionID: existingCollections[0].ID,
+						Key:          "baz",
+						Content:      json.RawMessage(`{"baz": "qux"}`),
+					},
+					{
+						Op:           "create",
+						CollectionID: existingCollections[0].ID,
+						Key:          "baz",
+						Content:      json.RawMessage(`{"baz": "quux"}`),
+					},
+				},
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.AlreadyExists,
+					Message: "Operation 1 of the batch failed: A document with key `baz` already exists in this collection",
+					Details: &internal.BatchOperationFailure{
+						Index: 1,
+					},
+				},
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+		{
+			scenario: "Will throw an error when a collection belongs to another database",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &BatchParams{
+				DatabaseID: existingDatabases[0].ID,
+				Operations: []convert.BatchOperation{
+					{
+						Op:           "create",
+						CollectionID: existingCollections[1].ID,
+						Content:      json.RawMessage(`{"foo": "bar"}`),
+					},
+				},
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Operation 0 of the batch failed: Collection does not belong to the database of the batch",
+					Details: &internal.BatchOperationFailure{
+						Index: 0,
+					},
+				},
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+		{
+			scenario: "Will throw an error when an operation is not valid",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &BatchParams{
+				DatabaseID: existingDatabases[0].ID,
+				Operations: []convert.BatchOperation{
+					{
+						Op: "replace",
+						ID: existingDocuments[0].ID,
+					},
+				},
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Operation 0 of the batch failed: Received operation `replace` was not valid, must be one of create, update, patch or delete",
+					Details: &internal.BatchOperationFailure{
+						Index: 0,
+					},
+				},
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+		{
+			scenario: "Will throw an error when the batch is empty",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &BatchParams{
+				DatabaseID: existingDatabases[0].ID,
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received batch was not valid, it must contain between 1 and 1000 operations",
+				},
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+		{
+			scenario: "Will throw an error when the key cannot write to the database",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params: &BatchParams{
+				DatabaseID: existingDatabases[0].ID,
+				Operations: []convert.BatchOperation{
+					{
+						Op: "delete",
+						ID: existingDocuments[0].ID,
+					},
+				},
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.PermissionDenied,
+					Message: "API key doesn't have the ability to write to the database",
+				},
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(tc.userData.ID, 10)), tc.userData)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := insertDatabases(ctx, existingDatabases)
+			require.NoError(t, err)
+
+			err = insertCollections(ctx, existingCollections)
+			require.NoError(t, err)
+
+			err = insertDocuments(ctx, existingDocuments)
+			require.NoError(t, err)
+
+			if tc.userCan != nil {
+				_, err := permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+					KeyID:      1,
+					DatabaseID: &existingDatabases[0].ID,
+					UserID:     1,
+					Role:       *tc.userCan,
+				})
+				require.NoError(t, err)
+			}
+
+			response, err := Batch(ctx, tc.params)
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+			} else {
+				require.NoError(t, err)
+				require.Len(t, response.Results, len(tc.expected.results))
+				for i, result := range tc.expected.results {
+					assert.Equal(t, string(result.Content), string(response.Results[i].Content))
+					assert.Equal(t, result.Version, response.Results[i].Version)
+				}
+			}
+
+			documents, err := ListDocuments(ctx, &ListDocumentsParams{CollectionID: existingCollections[0].ID})
+			require.NoError(t, err)
+			compareDocumentContents(t, tc.expected.documents, documents.Documents)
+		})
+	}
+}
+
+func TestBatchConflictingWrite(t *testing.T) {
+	ctx := fixtureContext(t, articlesFixture("write"))
+	defer test_utils.Cleanup(ctx)
+	defer test_utils_permissions.Cleanup(ctx)
+
+	// Another SQL transaction writes a document with the same key, committed once the batch checked the key
+	tx, err := sqldb.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	query, args := table.Documents.INSERT(
+		table.Documents.ID,
+		table.Documents.Content,
+		table.Documents.CollectionID,
+		table.Documents.Key,
+	).VALUES(
+		1000001,
+		`{"foo": "bar"}`,
+		2,
+		"baz",
+	).Sql()
+
+	_, err = tx.Exec(ctx, query, args...)
+	require.NoError(t, err)
+
+	committed := make(chan error)
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		committed <- tx.Commit()
+	}()
+
+	_, err = Batch(ctx, &BatchParams{
+		DatabaseID: 1,
+		Operations: []convert.BatchOperation{
+			{
+				Op:           "create",
+				CollectionID: 2,
+				Content:      json.RawMessage(`{"foo": "qux"}`),
+			},
+			{
+				Op:           "create",
+				CollectionID: 2,
+				Key:          "baz",
+				Content:      json.RawMessage(`{"foo": "baz"}`),
+			},
+		},
+	})
+	require.NoError(t, <-committed)
+
+	test_utils2.CompareErrors(t, &errs.Error{
+		Code:    errs.AlreadyExists,
+		Message: "Operation 1 of the batch failed: A document with key `baz` already exists in this collection",
+		Details: &internal.BatchOperationFailure{
+			Index: 1,
+		},
+	}, err)
+}
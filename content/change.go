@@ -0,0 +1,205 @@
+package content
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"encore.dev/beta/errs"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/internal"
+)
+
+const (
+	// changePollInterval is how often a feed of changes is read for new changes.
+	changePollInterval = time.Second
+
+	// changeHeartbeatInterval is how often a `heartbeat` event is sent on an idle stream of changes, which
+	// keeps the connection open and moves the token of the client forward.
+	changeHeartbeatInterval = 15 * time.Second
+)
+
+// queryStringID parses an optional ID given in the query string of a raw endpoint, 0 when not given.
+func queryStringID(req *http.Request, name string) (int64, error) {
+	value := req.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("Received %s was not valid, it must be an integer", name),
+		}
+	}
+
+	return id, nil
+}
+
+// writeChangeEvent writes a Server-Sent Event to the stream of changes.
+func writeChangeEvent(w http.ResponseWriter, id, event string, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", id, event, encoded)
+	return err
+}
+
+// StreamChanges streams the changes made to the documents of a database or of a collection for the
+// authenticated user as Server-Sent Events, as they are committed. The database or collection is given
+// as `database_id` or `collection_id` in the query string, along with an optional `filter` in JSON to only
+// receive the changes to documents with a content matching it.
+//
+// Each change is sent as an `insert`, `update` or `delete` event, with the change as data and its token
+// as ID. A stream resumes right after the change of the token given in the `Last-Event-ID` header, or as
+// `token` in the query string, so that clients reconnecting do not miss any change. Changes are kept for
+// 7 days, older tokens are rejected and the documents must be listed again. Idle streams receive a
+// `heartbeat` event every 15 seconds, with the token to resume from as ID.
+//encore:api auth raw
+func StreamChanges(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	databaseID, err := queryStringID(req, "database_id")
+	if err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+
+	collectionID, err := queryStringID(req, "collection_id")
+	if err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+
+	token := req.Header.Get("Last-Event-ID")
+	if token == "" {
+		token = req.URL.Query().Get("token")
+	}
+
+	feed, err := internal.OpenChangeFeed(ctx, databaseID, collectionID, json.RawMessage(req.URL.Query().Get("filter")), token)
+	if err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		errs.HTTPError(w, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not stream changes, the connection does not support streaming",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(changePollInterval)
+	defer ticker.Stop()
+
+	lastEvent := time.Now()
+	for {
+		changes, more, err := feed.Next(ctx)
+		if err != nil {
+			_ = writeChangeEvent(w, feed.Token(), "error", err)
+			flusher.Flush()
+			return
+		}
+
+		for _, change := range changes {
+			err = writeChangeEvent(w, change.Token, change.Operation, change)
+			if err != nil {
+				log.WithError(err).Warning("Could not write change to the stream, closing it")
+				return
+			}
+		}
+
+		if len(changes) > 0 {
+			flusher.Flush()
+			lastEvent = time.Now()
+		}
+
+		if more {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if time.Since(lastEvent) < changeHeartbeatInterval {
+			continue
+		}
+
+		// Access is checked again, the stream ends once the database or collection is deleted or the
+		// API key can no longer read it
+		err = feed.CheckAccess(ctx)
+		if err != nil {
+			_ = writeChangeEvent(w, feed.Token(), "error", err)
+			flusher.Flush()
+			return
+		}
+
+		err = writeChangeEvent(w, feed.Token(), "heartbeat", struct{}{})
+		if err != nil {
+			log.WithError(err).Warning("Could not write heartbeat to the stream, closing it")
+			return
+		}
+
+		flusher.Flush()
+		lastEvent = time.Now()
+	}
+}
+
+// SweepExpiredChangesResponse is the result of a sweep of the expired changes
+type SweepExpiredChangesResponse struct {
+	// The number of expired changes deleted
+	Deleted int64
+}
+
+// SweepExpiredChanges deletes the changes made to the documents that are older than 7 days, which can no
+// longer be streamed. The service runs this sweep every hour.
+//encore:api private
+func SweepExpiredChanges(ctx context.Context) (*SweepExpiredChangesResponse, error) {
+	deleted, err := internal.SweepExpiredChanges(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SweepExpiredChangesResponse{
+		Deleted: deleted,
+	}, nil
+}
+
+// SweepExpiredContentEventsResponse is the result of a sweep of the expired content events
+type SweepExpiredContentEventsResponse struct {
+	// The number of expired events deleted
+	Deleted int64
+}
+
+// SweepExpiredContentEvents deletes the events of the lifecycle of the databases, collections and documents
+// recorded in the outbox once they are published, or once older than 7 days when never published. The service
+// runs this sweep every hour.
+//encore:api private
+func SweepExpiredContentEvents(ctx context.Context) (*SweepExpiredContentEventsResponse, error) {
+	deleted, err := internal.SweepExpiredContentEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SweepExpiredContentEventsResponse{
+		Deleted: deleted,
+	}, nil
+}
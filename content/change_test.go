@@ -0,0 +1,320 @@
+package content
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"encore.app/content/models"
+	"encore.app/content/test_utils"
+	test_utils_permissions "encore.app/permissions/test_utils"
+)
+
+// changeEvent is an event received on a stream of changes.
+type changeEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// streamChanges streams the changes for a few seconds, running write once the stream is open, and returns
+// the response along with the events received.
+func streamChanges(t *testing.T, ctx context.Context, query url.Values, lastEventID string, write func(ctx context.Context)) (*httptest.ResponseRecorder, []changeEvent) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodGet, "/content.StreamChanges?"+query.Encode(), nil).WithContext(ctx)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	recorder := httptest.NewRecorder()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		StreamChanges(recorder, req)
+	}()
+
+	if write != nil {
+		time.Sleep(200 * time.Millisecond)
+		write(ctx)
+	}
+
+	wg.Wait()
+
+	var events []changeEvent
+	for _, block := range strings.Split(recorder.Body.String(), "\n\n") {
+		event := changeEvent{}
+		for _, line := range strings.Split(block, "\n") {
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				event.ID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				event.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				event.Data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+
+		if event.Event != "" {
+			events = append(events, event)
+		}
+	}
+
+	return recorder, events
+}
+
+// writeArticle creates, updates and deletes a document in the collection with ID 2.
+func writeArticle(t *testing.T) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		created, err := CreateDocument(ctx, &CreateDocumentParams{
+			CollectionID: 2,
+			Content:      json.RawMessage(`{"status": "draft"}`),
+		})
+		require.NoError(t, err)
+
+		_, err = UpdateDocument(ctx, &UpdateDocumentParams{
+			ID:      created.Document.ID,
+			Content: json.RawMessage(`{"status": "published"}`),
+		})
+		require.NoError(t, err)
+
+		_, err = DeleteDocument(ctx, &DeleteDocumentParams{
+			ID: created.Document.ID,
+		})
+		require.NoError(t, err)
+	}
+}
+
+func TestStreamChanges(t *testing.T) {
+	type expected struct {
+		status int
+		events []string
+	}
+
+	tcs := []struct {
+		scenario string
+		query    url.Values
+		write    func(t *testing.T) func(ctx context.Context)
+		expected expected
+	}{
+		{
+			scenario: "Streams the changes committed on a collection",
+			query:    url.Values{"collection_id": {"2"}},
+			write:    writeArticle,
+			expected: expected{
+				status: http.StatusOK,
+				events: []string{"insert", "update", "delete"},
+			},
+		},
+		{
+			scenario: "Streams the changes to the documents with a content matching the filter",
+			query:    url.Values{"collection_id": {"2"}, "filter": {`{"status": "published"}`}},
+			write:    writeArticle,
+			expected: expected{
+				status: http.StatusOK,
+				events: []string{"update", "delete"},
+			},
+		},
+		{
+			scenario: "Streams the changes committed on all the collections of a database",
+			query:    url.Values{"database_id": {"1"}},
+			write: func(t *testing.T) func(ctx context.Context) {
+				return func(ctx context.Context) {
+					for _, collectionID := range []int64{2, 3} {
+						_, err := CreateDocument(ctx, &CreateDocumentParams{
+							CollectionID: collectionID,
+							Content:      json.RawMessage(`{"title": "Hello"}`),
+						})
+						require.NoError(t, err)
+					}
+				}
+			},
+			expected: expected{
+				status: http.StatusOK,
+				events: []string{"insert", "insert"},
+			},
+		},
+		{
+			scenario: "Throws an error when neither a database nor a collection is given",
+			query:    url.Values{},
+			expected: expected{
+				status: http.StatusBadRequest,
+			},
+		},
+		{
+			scenario: "Throws an error when the collection does not exist",
+			query:    url.Values{"collection_id": {"99"}},
+			expected: expected{
+				status: http.StatusNotFound,
+			},
+		},
+		{
+			scenario: "Throws an error when the token is malformed",
+			query:    url.Values{"collection_id": {"2"}, "token": {"invalid"}},
+			expected: expected{
+				status: http.StatusBadRequest,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := fixtureContext(t, articlesFixture("write"))
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			var write func(ctx context.Context)
+			if tc.write != nil {
+				write = tc.write(t)
+			}
+
+			recorder, events := streamChanges(t, ctx, tc.query, "", write)
+			assert.Equal(t, tc.expected.status, recorder.Code)
+
+			received := make([]string, 0, len(events))
+			for _, event := range events {
+				received = append(received, event.Event)
+			}
+
+			if tc.expected.status == http.StatusOK {
+				assert.Equal(t, tc.expected.events, received)
+			}
+		})
+	}
+}
+
+func TestStreamChangesResume(t *testing.T) {
+	ctx := fixtureContext(t, articlesFixture("write"))
+	defer test_utils.Cleanup(ctx)
+	defer test_utils_permissions.Cleanup(ctx)
+
+	_, events := streamChanges(t, ctx, url.Values{"collection_id": {"2"}}, "", writeArticle(t))
+	require.Len(t, events, 3)
+
+	_, resumed := streamChanges(t, ctx, url.Values{"collection_id": {"2"}}, events[0].ID, nil)
+	require.Len(t, resumed, 2)
+	assert.Equal(t, events[1:], resumed)
+
+	change := struct {
+		Operation string
+		Document  struct {
+			Content json.RawMessage
+			Version int64
+		}
+	}{}
+	require.NoError(t, json.Unmarshal([]byte(resumed[0].Data), &change))
+	assert.Equal(t, "update", change.Operation)
+	assert.Equal(t, int64(2), change.Document.Version)
+
+	var content string
+	require.NoError(t, json.Unmarshal(change.Document.Content, &content))
+	assert.JSONEq(t, `{"status": "published"}`, content)
+}
+
+func TestStreamChangesLargeDocument(t *testing.T) {
+	ctx := fixtureContext(t, articlesFixture("write"))
+	defer test_utils.Cleanup(ctx)
+	defer test_utils_permissions.Cleanup(ctx)
+
+	body := strings.Repeat("a", 9000)
+	_, events := streamChanges(t, ctx, url.Values{"collection_id": {"2"}, "filter": {`{"status": "draft"}`}}, "", func(ctx context.Context) {
+		_, err := CreateDocument(ctx, &CreateDocumentParams{
+			CollectionID: 2,
+			Content:      json.RawMessage(`{"status": "draft", "body": "` + body + `"}`),
+		})
+		require.NoError(t, err)
+	})
+	require.Len(t, events, 1)
+
+	change := struct {
+		Document struct {
+			ID      int64
+			Content json.RawMessage
+		}
+	}{}
+	require.NoError(t, json.Unmarshal([]byte(events[0].Data), &change))
+	assert.NotZero(t, change.Document.ID)
+	assert.Equal(t, "null", string(change.Document.Content))
+}
+
+func TestContentEvents(t *testing.T) {
+	ctx := fixtureContext(t, articlesFixture("admin"))
+	defer test_utils.Cleanup(ctx)
+	defer test_utils_permissions.Cleanup(ctx)
+
+	// The database and the collections of the fixture
+	recorded, err := models.ListUnpublishedContentEvents(ctx, models.ChangePosition{}, 100)
+	require.NoError(t, err)
+	require.Len(t, recorded, 3)
+	assert.Equal(t, "DatabaseCreated", recorded[0].Event)
+
+	created, err := CreateDocument(ctx, &CreateDocumentParams{CollectionID: 2, Content: json.RawMessage(`{"title": "A"}`)})
+	require.NoError(t, err)
+
+	_, err = UpdateDocument(ctx, &UpdateDocumentParams{ID: created.Document.ID, Content: json.RawMessage(`{"title": "B"}`)})
+	require.NoError(t, err)
+
+	_, err = DeleteDocument(ctx, &DeleteDocumentParams{ID: created.Document.ID})
+	require.NoError(t, err)
+
+	// Writes rolled back along with their transaction are not recorded
+	transaction, err := StartTransaction(ctx, &StartTransactionParams{DatabaseID: 1})
+	require.NoError(t, err)
+
+	_, err = CreateDocument(ctx, &CreateDocumentParams{
+		CollectionID:   2,
+		Content:        json.RawMessage(`{"title": "C"}`),
+		TransactionKey: transaction.TransactionKey,
+	})
+	require.NoError(t, err)
+
+	_, err = RollbackTransaction(ctx, &RollbackTransactionParams{TransactionKey: transaction.TransactionKey})
+	require.NoError(t, err)
+
+	_, err = DeleteCollection(ctx, &DeleteCollectionParams{ID: 3})
+	require.NoError(t, err)
+
+	events, err := models.ListUnpublishedContentEvents(ctx, models.ContentEventPosition(recorded[len(recorded)-1]), 100)
+	require.NoError(t, err)
+
+	kinds := make([]string, len(events))
+	for i, event := range events {
+		kinds[i] = event.Event
+	}
+	assert.Equal(t, []string{"DocumentCreated", "DocumentUpdated", "DocumentDeleted", "CollectionDeleted"}, kinds)
+
+	require.NotNil(t, events[0].DocumentID)
+	assert.Equal(t, created.Document.ID, *events[0].DocumentID)
+	assert.Equal(t, int64(1), events[0].DatabaseID)
+
+	payload := struct{ Content json.RawMessage }{}
+	require.NoError(t, json.Unmarshal([]byte(events[0].Payload), &payload))
+	assert.JSONEq(t, `{"title": "A"}`, string(payload.Content))
+
+	// Published events are no longer listed and are deleted by the sweep
+	sequences := make([]int64, len(recorded))
+	for i, event := range recorded {
+		sequences[i] = event.Sequence
+	}
+	require.NoError(t, models.MarkContentEventsPublished(ctx, sequences))
+
+	unpublished, err := models.ListUnpublishedContentEvents(ctx, models.ChangePosition{}, 100)
+	require.NoError(t, err)
+	assert.Len(t, unpublished, len(events))
+
+	swept, err := SweepExpiredContentEvents(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(recorded)), swept.Deleted)
+}
@@ -2,30 +2,63 @@ package content
 
 import (
 	"context"
+	"encoding/json"
 
 	log "github.com/sirupsen/logrus"
 
 	"encore.app/content/convert"
 	"encore.app/content/internal"
+	"encore.app/pagination"
+	"encore.dev/types/uuid"
 )
 
 // ListCollectionsParams is the parameters for listing the collections of a database
 type ListCollectionsParams struct {
 	// The unique identifier of the database
 	DatabaseID int64
+
+	// The maximum number of collections to return, defaults to 100 and cannot exceed 1000
+	Limit int
+
+	// The cursor returned as `NextCursor` by the previous call, to fetch the next page of collections
+	Cursor string
+
+	// The field to sort the collections by, one of `created_at` or `updated_at`. Defaults to `created_at`
+	SortBy string
+
+	// Whether to sort the collections in descending order
+	Descending bool
+
+	// The key of a transaction to run the operation in, changes made in a transaction are only visible
+	// in that transaction until it is committed
+	TransactionKey uuid.UUID
 }
 
 // ListCollectionsResponse is the list of collections for the given database
 type ListCollectionsResponse struct {
 	// The fetched collections
 	Collections []convert.CollectionPayload
+
+	// The cursor to give to the next call to fetch the next page of collections, empty when there are
+	// no more collections to fetch
+	NextCursor string
 }
 
-// ListCollections lists all collections created by the authenticated user in the given
-// database.
+// ListCollections lists the collections created by the authenticated user in the given
+// database, one page at a time.
 //encore:api auth
 func ListCollections(ctx context.Context, params *ListCollectionsParams) (*ListCollectionsResponse, error) {
-	collections, err := internal.ListCollections(ctx, params.DatabaseID)
+	ctx, err := internal.WithTransaction(ctx, params.TransactionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	collections, nextCursor, err := internal.ListCollections(ctx, params.DatabaseID, pagination.Params{
+		Limit:      params.Limit,
+		Cursor:     params.Cursor,
+		SortBy:     params.SortBy,
+		Descending: params.Descending,
+	})
 	if err != nil {
 		log.WithError(err).Warning("Could not fetch collections for this database")
 		return nil, err
@@ -33,6 +66,7 @@ func ListCollections(ctx context.Context, params *ListCollectionsParams) (*ListC
 
 	return &ListCollectionsResponse{
 		Collections: collections,
+		NextCursor:  nextCursor,
 	}, nil
 }
 
@@ -40,6 +74,10 @@ func ListCollections(ctx context.Context, params *ListCollectionsParams) (*ListC
 type GetCollectionParams struct {
 	// The unique identifier of the collection
 	ID int64
+
+	// The key of a transaction to run the operation in, changes made in a transaction are only visible
+	// in that transaction until it is committed
+	TransactionKey uuid.UUID
 }
 
 // GetCollectionResponse is the result of having fetched a collection
@@ -51,6 +89,11 @@ type GetCollectionResponse struct {
 // GetCollection Finds a collection by ID
 //encore:api auth
 func GetCollection(ctx context.Context, params *GetCollectionParams) (*GetCollectionResponse, error) {
+	ctx, err := internal.WithTransaction(ctx, params.TransactionKey)
+	if err != nil {
+		return nil, err
+	}
+
 	collection, err := internal.GetCollection(ctx, params.ID)
 	if err != nil {
 		return nil, err
@@ -61,6 +104,38 @@ func GetCollection(ctx context.Context, params *GetCollectionParams) (*GetCollec
 	}, nil
 }
 
+// GetCollectionByNameParams is the parameters for finding a collection by name
+type GetCollectionByNameParams struct {
+	// The name of the database of the collection
+	Database string
+
+	// The name of the collection
+	Name string
+
+	// The key of a transaction to run the operation in, changes made in a transaction are only visible
+	// in that transaction until it is committed
+	TransactionKey uuid.UUID
+}
+
+// GetCollectionByName finds a collection by its name and the name of its database, the path
+// `{database}/{collection}`
+//encore:api auth
+func GetCollectionByName(ctx context.Context, params *GetCollectionByNameParams) (*GetCollectionResponse, error) {
+	ctx, err := internal.WithTransaction(ctx, params.TransactionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	collection, err := internal.GetCollectionByName(ctx, params.Database, params.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GetCollectionResponse{
+		Collection: collection,
+	}, nil
+}
+
 // CreateCollectionParams is the parameters for creating a collection for documents
 type CreateCollectionParams struct {
 	// The unique ID of the database to add this collection to
@@ -68,6 +143,23 @@ type CreateCollectionParams struct {
 
 	// The name of the collection
 	Name string
+
+	// An optional JSON Schema the content of the documents of the collection must match, for example
+	// `{"type": "object", "required": ["email"], "properties": {"email": {"type": "string"}}}`
+	Schema json.RawMessage
+
+	// An optional full-text search configuration, making the documents of the collection searchable with
+	// SearchDocuments, for example `{"language": "english", "paths": ["title", "body"]}`. The language
+	// defaults to `simple`, which does not stem words, and matches on the first paths rank higher
+	Search json.RawMessage
+
+	// Whether to keep the history of the content of the documents of the collection, their revisions can
+	// then be listed, compared and restored
+	History bool
+
+	// The key of a transaction to run the operation in, changes made in a transaction are only visible
+	// in that transaction until it is committed
+	TransactionKey uuid.UUID
 }
 
 // CreateCollectionResponse is the result of creating a collection for documents
@@ -82,7 +174,12 @@ type CreateCollectionResponse struct {
 // CreateCollection creates a collection for the given database if owned by the authenticated user.
 //encore:api auth
 func CreateCollection(ctx context.Context, params *CreateCollectionParams) (*CreateCollectionResponse, error) {
-	collection, err := internal.CreateCollection(ctx, params.DatabaseID, params.Name)
+	ctx, err := internal.WithTransaction(ctx, params.TransactionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	collection, err := internal.CreateCollection(ctx, params.DatabaseID, params.Name, params.Schema, params.Search, params.History)
 	if err != nil {
 		return nil, err
 	}
@@ -100,6 +197,31 @@ type UpdateCollectionParams struct {
 
 	// The name of the collection
 	Name string
+
+	// A JSON Schema to attach to the collection, replacing the current one. It is only attached if all the
+	// documents of the collection match it. The current schema is kept when none is given
+	Schema json.RawMessage
+
+	// Whether to remove the schema of the collection
+	RemoveSchema bool
+
+	// A full-text search configuration to attach to the collection, replacing the current one. The current
+	// configuration is kept when none is given
+	Search json.RawMessage
+
+	// Whether to remove the search configuration of the collection
+	RemoveSearch bool
+
+	// Whether to keep the history of the content of the documents of the collection. The current setting
+	// is kept when none is given, and the revisions of the documents are deleted when the history is turned off
+	History *bool
+
+	// Whether to only report the documents that do not match the given schema, without saving anything
+	DryRun bool
+
+	// The key of a transaction to run the operation in, changes made in a transaction are only visible
+	// in that transaction until it is committed
+	TransactionKey uuid.UUID
 }
 
 // UpdateCollectionResponse is the result of updating a collection for documents
@@ -109,16 +231,33 @@ type UpdateCollectionResponse struct {
 
 	// The updated collection
 	Collection convert.CollectionPayload
+
+	// With DryRun, the documents that do not match the given schema, at most 100 of them
+	Violations []convert.DocumentViolations
 }
 
-// UpdateCollection updates a collection by ID for the authenticated user
+// UpdateCollection updates a collection by ID for the authenticated user. Attaching a schema can first be
+// tried with DryRun, to list the documents of the collection that would not match it.
 //encore:api auth
 func UpdateCollection(ctx context.Context, params *UpdateCollectionParams) (*UpdateCollectionResponse, error) {
-	collection, err := internal.UpdateCollection(ctx, params.ID, params.Name)
+	ctx, err := internal.WithTransaction(ctx, params.TransactionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	collection, violations, err := internal.UpdateCollection(ctx, params.ID, params.Name, params.Schema, params.RemoveSchema, params.Search, params.RemoveSearch, params.History, params.DryRun)
 	if err != nil {
 		return nil, err
 	}
 
+	if params.DryRun {
+		return &UpdateCollectionResponse{
+			Message:    "Collection was not updated, dry run.",
+			Collection: collection,
+			Violations: violations,
+		}, nil
+	}
+
 	return &UpdateCollectionResponse{
 		Message:    "Collection updated successfully.",
 		Collection: collection,
@@ -129,6 +268,10 @@ func UpdateCollection(ctx context.Context, params *UpdateCollectionParams) (*Upd
 type DeleteCollectionParams struct {
 	// The unique identifier for the collection
 	ID int64
+
+	// The key of a transaction to run the operation in, changes made in a transaction are only visible
+	// in that transaction until it is committed
+	TransactionKey uuid.UUID
 }
 
 // DeleteCollectionResponse is the result of deleting a collection for documents
@@ -140,9 +283,15 @@ type DeleteCollectionResponse struct {
 	Collection convert.CollectionPayload
 }
 
-// DeleteCollection deletes a collection by ID for the authenticated user
+// DeleteCollection moves a collection by ID to the trash for the authenticated user, along with its
+// documents. It can be restored with RestoreCollectionFromTrash until it is purged.
 //encore:api auth
 func DeleteCollection(ctx context.Context, params *DeleteCollectionParams) (*DeleteCollectionResponse, error) {
+	ctx, err := internal.WithTransaction(ctx, params.TransactionKey)
+	if err != nil {
+		return nil, err
+	}
+
 	collection, err := internal.DeleteCollection(ctx, params.ID)
 	if err != nil {
 		return nil, err
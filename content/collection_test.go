@@ -2,6 +2,7 @@ package content
 
 import (
 	"context"
+	"encoding/json"
 	"strconv"
 	"testing"
 	"time"
@@ -13,8 +14,10 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"encore.app/content/convert"
+	"encore.app/content/internal"
 	"encore.app/content/models/generated/content/public/model"
 	"encore.app/content/models/generated/content/public/table"
+	"encore.app/content/query"
 	"encore.app/content/test_utils"
 	"encore.app/identity"
 	"encore.app/permissions"
@@ -45,12 +48,20 @@ func insertCollections(ctx context.Context, collections []*model.Collections) er
 			table.Collections.ID,
 			table.Collections.Name,
 			table.Collections.DatabaseID,
+			table.Collections.Schema,
+			table.Collections.Search,
+			table.Collections.History,
+			table.Collections.DeletedAt,
 			table.Collections.UpdatedAt,
 			table.Collections.CreatedAt,
 		).VALUES(
 			collection.ID,
 			collection.Name,
 			collection.DatabaseID,
+			collection.Schema,
+			collection.Search,
+			collection.History,
+			collection.DeletedAt,
 			collection.UpdatedAt,
 			collection.CreatedAt,
 		).Sql()
@@ -343,6 +354,165 @@ func TestGetCollection(t *testing.T) {
 	}
 }
 
+func TestGetCollectionByName(t *testing.T) {
+	now := time.Now()
+
+	type expected struct {
+		response *GetCollectionResponse
+		err      error
+	}
+
+	existingDatabases := []*model.Databases{
+		{
+			ID:        1,
+			Name:      "test",
+			UserID:    1,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		{
+			ID:        2,
+			Name:      "other",
+			UserID:    1,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+	}
+
+	validCollections := []*model.Collections{
+		{
+			ID:         3,
+			DatabaseID: existingDatabases[0].ID,
+			Name:       "users",
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		},
+		{
+			ID:         4,
+			DatabaseID: existingDatabases[1].ID,
+			Name:       "users",
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		},
+	}
+
+	tcs := []struct {
+		scenario string
+		userData *identity.UserData
+		userCan  *string
+		params   *GetCollectionByNameParams
+		expected expected
+	}{
+		{
+			scenario: "Returns a collection by name in the named database",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params:  &GetCollectionByNameParams{Database: "test", Name: "users"},
+			expected: expected{
+				response: &GetCollectionResponse{
+					Collection: convert.CollectionModelToPayload(validCollections[0]),
+				},
+			},
+		},
+		{
+			scenario: "Returns an error when the collection is not found",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params:  &GetCollectionByNameParams{Database: "test", Name: "unknown"},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.NotFound,
+					Message: "Could not find collection",
+				},
+			},
+		},
+		{
+			scenario: "Returns an error when the database is not found",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params:  &GetCollectionByNameParams{Database: "unknown", Name: "users"},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.NotFound,
+					Message: "Could not find database",
+				},
+			},
+		},
+		{
+			scenario: "Returns an error when the user does not own the database",
+			userData: &identity.UserData{
+				ID:    2,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params:  &GetCollectionByNameParams{Database: "test", Name: "users"},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.NotFound,
+					Message: "Could not find database",
+				},
+			},
+		},
+		{
+			scenario: "Fails if the key cannot view the database",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			params: &GetCollectionByNameParams{Database: "test", Name: "users"},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.PermissionDenied,
+					Message: "API key doesn't have the ability to read the database",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(tc.userData.ID, 10)), tc.userData)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := insertDatabases(ctx, existingDatabases)
+			require.NoError(t, err)
+
+			err = insertCollections(ctx, validCollections)
+			require.NoError(t, err)
+
+			if tc.userCan != nil {
+				_, err := permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+					KeyID:      1,
+					DatabaseID: &existingDatabases[0].ID,
+					UserID:     1,
+					Role:       *tc.userCan,
+				})
+				require.NoError(t, err)
+			}
+
+			response, err := GetCollectionByName(ctx, tc.params)
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected.response.Collection.ID, response.Collection.ID)
+				assert.Equal(t, tc.expected.response.Collection.Name, response.Collection.Name)
+			}
+		})
+	}
+}
+
 func TestCreateCollection(t *testing.T) {
 	now := time.Now()
 
@@ -386,6 +556,109 @@ func TestCreateCollection(t *testing.T) {
 				},
 			},
 		},
+		{
+			scenario: "Will create a collection keeping the history of its documents",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &CreateCollectionParams{
+				DatabaseID: existingDatabase.ID,
+				Name:       "test",
+				History:    true,
+			},
+			expected: expected{
+				response: &CreateCollectionResponse{
+					Collection: convert.CollectionPayload{
+						Name:    "test",
+						History: true,
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will create a collection with a schema",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &CreateCollectionParams{
+				DatabaseID: existingDatabase.ID,
+				Name:       "test",
+				Schema:     json.RawMessage(`{"type": "object", "required": ["foo"]}`),
+			},
+			expected: expected{
+				response: &CreateCollectionResponse{
+					Collection: convert.CollectionPayload{
+						Name:   "test",
+						Schema: json.RawMessage(`{"type":"object","required":["foo"]}`),
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when the schema is not valid",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &CreateCollectionParams{
+				DatabaseID: existingDatabase.ID,
+				Name:       "test",
+				Schema:     json.RawMessage(`{"$ref": "#/$defs/foo"}`),
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received schema was not valid, invalid clause at `/$ref`: unsupported keyword `$ref`",
+					Details: &query.Error{Pointer: "/$ref", Reason: "unsupported keyword `$ref`"},
+				},
+			},
+		},
+		{
+			scenario: "Will create a searchable collection",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &CreateCollectionParams{
+				DatabaseID: existingDatabase.ID,
+				Name:       "test",
+				Search:     json.RawMessage(`{"paths": ["title", "body"]}`),
+			},
+			expected: expected{
+				response: &CreateCollectionResponse{
+					Collection: convert.CollectionPayload{
+						Name:   "test",
+						Search: json.RawMessage(`{"language":"simple","paths":["title","body"]}`),
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when the search configuration is not valid",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &CreateCollectionParams{
+				DatabaseID: existingDatabase.ID,
+				Name:       "test",
+				Search:     json.RawMessage(`{"language": "klingon", "paths": ["title"]}`),
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received search was not valid, invalid clause at `/language`: unknown language `klingon`",
+					Details: &query.Error{Pointer: "/language", Reason: "unknown language `klingon`"},
+				},
+			},
+		},
 		{
 			scenario: "Will throw an error when a the database cannot be found",
 			userData: &identity.UserData{
@@ -488,6 +761,9 @@ func TestCreateCollection(t *testing.T) {
 			} else {
 				require.NoError(t, err)
 				assert.Equal(t, tc.expected.response.Collection.Name, response.Collection.Name)
+				assert.Equal(t, string(tc.expected.response.Collection.Schema), string(response.Collection.Schema))
+				assert.Equal(t, string(tc.expected.response.Collection.Search), string(response.Collection.Search))
+				assert.Equal(t, tc.expected.response.Collection.History, response.Collection.History)
 			}
 		})
 	}
@@ -638,6 +914,196 @@ func TestUpdateCollection(t *testing.T) {
 	}
 }
 
+func TestUpdateCollectionSchema(t *testing.T) {
+	now := time.Now()
+
+	type expected struct {
+		response *UpdateCollectionResponse
+		schema   json.RawMessage
+		err      error
+	}
+
+	existingDatabase := &model.Databases{
+		ID:        1,
+		Name:      "test",
+		UserID:    1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	existingSchema := `{"type": "object"}`
+	existingCollection := &model.Collections{
+		ID:         2,
+		DatabaseID: existingDatabase.ID,
+		Name:       "test",
+		Schema:     &existingSchema,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	existingDocuments := []*model.Documents{
+		{
+			ID:           3,
+			CollectionID: existingCollection.ID,
+			Content:      `{"foo": "bar"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ID:           4,
+			CollectionID: existingCollection.ID,
+			Content:      `{"foo": 1}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+	}
+
+	tcs := []struct {
+		scenario string
+		params   *UpdateCollectionParams
+		expected expected
+	}{
+		{
+			scenario: "Will attach a schema matched by all the documents",
+			params: &UpdateCollectionParams{
+				ID:     existingCollection.ID,
+				Name:   existingCollection.Name,
+				Schema: json.RawMessage(`{"type": "object", "required": ["foo"]}`),
+			},
+			expected: expected{
+				response: &UpdateCollectionResponse{
+					Collection: convert.CollectionPayload{
+						Name:   existingCollection.Name,
+						Schema: json.RawMessage(`{"type":"object","required":["foo"]}`),
+					},
+				},
+				schema: json.RawMessage(`{"type": "object", "required": ["foo"]}`),
+			},
+		},
+		{
+			scenario: "Will remove the schema of the collection",
+			params: &UpdateCollectionParams{
+				ID:           existingCollection.ID,
+				Name:         existingCollection.Name,
+				RemoveSchema: true,
+			},
+			expected: expected{
+				response: &UpdateCollectionResponse{
+					Collection: convert.CollectionPayload{
+						Name: existingCollection.Name,
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will report the documents not matching the schema without attaching it on a dry run",
+			params: &UpdateCollectionParams{
+				ID:     existingCollection.ID,
+				Name:   existingCollection.Name,
+				Schema: json.RawMessage(`{"properties": {"foo": {"type": "string"}}}`),
+				DryRun: true,
+			},
+			expected: expected{
+				response: &UpdateCollectionResponse{
+					Collection: convert.CollectionPayload{
+						Name:   existingCollection.Name,
+						Schema: json.RawMessage(`{"properties":{"foo":{"type":"string"}}}`),
+					},
+					Violations: []convert.DocumentViolations{
+						{
+							DocumentID: existingDocuments[1].ID,
+							Violations: []query.Error{{Pointer: "/foo", Reason: "expected a value of type string"}},
+						},
+					},
+				},
+				schema: json.RawMessage(existingSchema),
+			},
+		},
+		{
+			scenario: "Will throw an error when documents do not match the schema",
+			params: &UpdateCollectionParams{
+				ID:     existingCollection.ID,
+				Name:   existingCollection.Name,
+				Schema: json.RawMessage(`{"properties": {"foo": {"type": "string"}}}`),
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.FailedPrecondition,
+					Message: "Could not attach the schema, documents of the collection do not match it",
+					Details: &internal.DocumentsSchemaViolations{
+						Documents: []convert.DocumentViolations{
+							{
+								DocumentID: existingDocuments[1].ID,
+								Violations: []query.Error{{Pointer: "/foo", Reason: "expected a value of type string"}},
+							},
+						},
+					},
+				},
+				schema: json.RawMessage(existingSchema),
+			},
+		},
+		{
+			scenario: "Will throw an error when a schema is given while removing the schema",
+			params: &UpdateCollectionParams{
+				ID:           existingCollection.ID,
+				Name:         existingCollection.Name,
+				Schema:       json.RawMessage(`{"type": "object"}`),
+				RemoveSchema: true,
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received schema was not valid, a schema cannot be given when removing the schema",
+				},
+				schema: json.RawMessage(existingSchema),
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			userData := &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			}
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(userData.ID, 10)), userData)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := insertDatabases(ctx, []*model.Databases{existingDatabase})
+			require.NoError(t, err)
+
+			err = insertCollections(ctx, []*model.Collections{existingCollection})
+			require.NoError(t, err)
+
+			err = insertDocuments(ctx, existingDocuments)
+			require.NoError(t, err)
+
+			_, err = permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+				KeyID:      1,
+				DatabaseID: &existingDatabase.ID,
+				UserID:     1,
+				Role:       "write",
+			})
+			require.NoError(t, err)
+
+			response, err := UpdateCollection(ctx, tc.params)
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, string(tc.expected.response.Collection.Schema), string(response.Collection.Schema))
+				assert.Equal(t, tc.expected.response.Violations, response.Violations)
+			}
+
+			collection, err := GetCollection(ctx, &GetCollectionParams{ID: existingCollection.ID})
+			require.NoError(t, err)
+			assert.Equal(t, string(tc.expected.schema), string(collection.Collection.Schema))
+		})
+	}
+}
+
 func TestDeleteCollection(t *testing.T) {
 	now := time.Now()
 
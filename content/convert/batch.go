@@ -0,0 +1,36 @@
+package convert
+
+import (
+	"encoding/json"
+)
+
+// BatchOperation is a single write on a document, as part of a batch.
+type BatchOperation struct {
+	// The operation to run, one of `create`, `update`, `patch` or `delete`
+	Op string
+
+	// The unique identifier of the collection to create the document in, for `create`, or of the
+	// collection of the document when identified by key
+	CollectionID int64
+
+	// The unique identifier of the document, for `update`, `patch` and `delete`
+	ID int64
+
+	// The key of the document to create, or of the document to write when no ID is given
+	Key string
+
+	// The content of the document, for `create` and `update`
+	Content json.RawMessage
+
+	// A list of RFC 6902 JSON Patch operations to apply to the content of the document, for `patch`
+	JSONPatch json.RawMessage
+
+	// An RFC 7396 JSON Merge Patch to merge into the content of the document, for `patch`
+	MergePatch json.RawMessage
+
+	// Update operators to apply to the content of the document, like `{"$inc": {"views": 1}}`, for `patch`
+	Update json.RawMessage
+
+	// The version the document must have for the operation to apply, for `update`, `patch` and `delete`
+	IfVersion *int64
+}
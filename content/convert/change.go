@@ -0,0 +1,74 @@
+package convert
+
+import (
+	"encoding/json"
+	"time"
+
+	"encore.app/content/models/generated/content/public/model"
+)
+
+// ChangePayload is an API safe version of a change made to a document.
+type ChangePayload struct {
+	// The token to give to resume the feed of changes right after this change
+	Token string
+
+	// The change made to the document, one of `insert`, `update` or `delete`. Moving a document to the
+	// trash is a `delete`, and restoring it an `insert`
+	Operation string
+
+	// The unique identifier of the collection of the document
+	CollectionID int64
+
+	// The document once changed, or as it was when deleted. The content of documents larger than 8 KB is
+	// null, the document can be fetched by ID
+	Document DocumentPayload
+
+	// The ID of the API key that made the change, zero when unknown
+	ChangedBy int64
+
+	// When the change was made
+	ChangedAt time.Time
+}
+
+// ChangeModelToPayload converts a database representation of a change made to a document to an API safe
+// version, given the token resuming the feed of changes after it.
+func ChangeModelToPayload(change *model.DocumentChanges, token string) (ChangePayload, error) {
+	document := &model.Documents{
+		ID:           change.DocumentID,
+		Key:          change.Key,
+		CollectionID: change.CollectionID,
+		Version:      change.Version,
+		UpdatedAt:    change.CreatedAt,
+		CreatedAt:    change.DocumentCreatedAt,
+	}
+	if change.Operation == "delete" {
+		document.DeletedAt = &change.CreatedAt
+	}
+
+	if change.Content != nil {
+		document.Content = *change.Content
+	}
+
+	documentPayload, err := DocumentModelToPayload(document)
+	if err != nil {
+		return ChangePayload{}, err
+	}
+
+	if change.Content == nil {
+		documentPayload.Content = json.RawMessage("null")
+	}
+
+	changedBy := int64(0)
+	if change.CreatedBy != nil {
+		changedBy = *change.CreatedBy
+	}
+
+	return ChangePayload{
+		Token:        token,
+		Operation:    change.Operation,
+		CollectionID: change.CollectionID,
+		Document:     documentPayload,
+		ChangedBy:    changedBy,
+		ChangedAt:    change.CreatedAt,
+	}, nil
+}
@@ -1,6 +1,7 @@
 package convert
 
 import (
+	"encoding/json"
 	"time"
 
 	"encore.app/content/models/generated/content/public/model"
@@ -15,17 +16,42 @@ type CollectionPayload struct {
 	Name      string
 	UpdatedAt time.Time
 	CreatedAt time.Time
+
+	// The JSON Schema the content of the documents of the collection must match, if any
+	Schema json.RawMessage
+
+	// The full-text search configuration of the collection, the language of its documents and the paths
+	// of their content to search, if any
+	Search json.RawMessage
+
+	// Whether the collection keeps the history of the content of its documents
+	History bool
+
+	// When the collection was moved to the trash, nil when it is not in the trash
+	DeletedAt *time.Time
 }
 
 // CollectionModelToPayload converts a database representation of a Collection
 // to an API safe version.
 func CollectionModelToPayload(collection *model.Collections) CollectionPayload {
-	return CollectionPayload{
+	payload := CollectionPayload{
 		ID:        collection.ID,
 		Name:      collection.Name,
 		UpdatedAt: collection.UpdatedAt,
 		CreatedAt: collection.CreatedAt,
+		History:   collection.History,
+		DeletedAt: collection.DeletedAt,
 	}
+
+	if collection.Schema != nil {
+		payload.Schema = json.RawMessage(*collection.Schema)
+	}
+
+	if collection.Search != nil {
+		payload.Search = json.RawMessage(*collection.Search)
+	}
+
+	return payload
 }
 
 // CollectionModelsToPayloads converts multiple collection models to their API save versions
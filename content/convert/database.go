@@ -15,16 +15,25 @@ type DatabasePayload struct {
 	Name      string
 	UpdatedAt time.Time
 	CreatedAt time.Time
+
+	// The number of days the databases, collections and documents deleted from the database are kept in
+	// the trash before being purged
+	TrashRetentionDays int
+
+	// When the database was moved to the trash, nil when it is not in the trash
+	DeletedAt *time.Time
 }
 
 // DatabaseModelToPayload converts a database representation of a Database
 // to an API safe version.
 func DatabaseModelToPayload(database *model.Databases) DatabasePayload {
 	return DatabasePayload{
-		ID:        database.ID,
-		Name:      database.Name,
-		UpdatedAt: database.UpdatedAt,
-		CreatedAt: database.CreatedAt,
+		ID:                 database.ID,
+		Name:               database.Name,
+		UpdatedAt:          database.UpdatedAt,
+		CreatedAt:          database.CreatedAt,
+		TrashRetentionDays: int(database.TrashRetentionDays),
+		DeletedAt:          database.DeletedAt,
 	}
 }
 
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/query"
 )
 
 // DocumentPayload is an API safe representation of a document.
@@ -12,10 +13,30 @@ type DocumentPayload struct {
 	// The document unique identifier
 	ID int64
 
+	// The key given to the document by the client when created, unique within its collection. Empty
+	// when the document has no key
+	Key string
+
 	// The document content
 	Content   json.RawMessage
 	UpdatedAt time.Time
 	CreatedAt time.Time
+
+	// The document version, incremented on every change to the document. It can be given as
+	// `IfVersion` to only change the document if no one else changed it in the meantime
+	Version int64
+
+	// When the document was moved to the trash, nil when it is not in the trash
+	DeletedAt *time.Time
+}
+
+// DocumentViolations is a document that does not match the schema of its collection.
+type DocumentViolations struct {
+	// The document unique identifier
+	DocumentID int64
+
+	// Each location of the content of the document that does not match the schema
+	Violations []query.Error
 }
 
 // DocumentModelToPayload converts a database representation of a Document
@@ -26,11 +47,19 @@ func DocumentModelToPayload(document *model.Documents) (DocumentPayload, error)
 		return DocumentPayload{}, err
 	}
 
+	key := ""
+	if document.Key != nil {
+		key = *document.Key
+	}
+
 	return DocumentPayload{
 		ID:        document.ID,
+		Key:       key,
 		Content:   contentString,
 		UpdatedAt: document.UpdatedAt,
 		CreatedAt: document.CreatedAt,
+		Version:   document.Version,
+		DeletedAt: document.DeletedAt,
 	}, nil
 }
 
@@ -0,0 +1,69 @@
+package convert
+
+import (
+	"encoding/json"
+	"time"
+
+	"encore.app/content/models/generated/content/public/model"
+)
+
+// IndexPayload is an API safe version of an index.
+type IndexPayload struct {
+	// The name of the index, unique in its collection
+	Name string
+
+	// The unique identifier of the collection the index belongs to
+	CollectionID int64
+
+	// The paths of the content the index is declared on, like `address.city`. An index on several
+	// paths is a compound index
+	Paths []string
+
+	// Whether two documents of the collection can have the same values at the paths of the index
+	Unique bool
+
+	// The method of the index, either `btree` or `gin`
+	Method string
+
+	// The build status of the index, either `building`, `ready` or `failed`. Filters only use
+	// the index once it is ready
+	Status string
+
+	// The reason the index could not be built, when the status is `failed`
+	Error string
+
+	UpdatedAt time.Time
+	CreatedAt time.Time
+}
+
+// IndexModelToPayload converts a database representation of an Index
+// to an API safe version.
+func IndexModelToPayload(index *model.CollectionIndexes) IndexPayload {
+	payload := IndexPayload{
+		Name:         index.Name,
+		CollectionID: index.CollectionID,
+		Unique:       index.IsUnique,
+		Method:       index.Method,
+		Status:       index.Status,
+		UpdatedAt:    index.UpdatedAt,
+		CreatedAt:    index.CreatedAt,
+	}
+
+	_ = json.Unmarshal([]byte(index.Paths), &payload.Paths)
+	if index.Error != nil {
+		payload.Error = *index.Error
+	}
+
+	return payload
+}
+
+// IndexModelsToPayloads converts multiple index models to their API safe versions
+// using IndexModelToPayload.
+func IndexModelsToPayloads(indexes []*model.CollectionIndexes) []IndexPayload {
+	converted := make([]IndexPayload, len(indexes))
+	for i, index := range indexes {
+		converted[i] = IndexModelToPayload(index)
+	}
+
+	return converted
+}
@@ -0,0 +1,62 @@
+package convert
+
+import (
+	"encoding/json"
+	"time"
+
+	"encore.app/content/models/generated/content/public/model"
+)
+
+// RevisionPayload is an API safe version of a version of a document kept in the history of its collection.
+type RevisionPayload struct {
+	// The unique identifier of the document
+	DocumentID int64
+
+	// The version of the document
+	Version int64
+
+	// The content of the document at this version
+	Content json.RawMessage
+
+	// The ID of the API key that wrote this version, zero when unknown
+	CreatedBy int64
+
+	// When this version was written
+	CreatedAt time.Time
+}
+
+// RevisionModelToPayload converts a database representation of a document revision to an API safe version.
+func RevisionModelToPayload(revision *model.DocumentRevisions) (RevisionPayload, error) {
+	contentString, err := json.Marshal(revision.Content)
+	if err != nil {
+		return RevisionPayload{}, err
+	}
+
+	createdBy := int64(0)
+	if revision.CreatedBy != nil {
+		createdBy = *revision.CreatedBy
+	}
+
+	return RevisionPayload{
+		DocumentID: revision.DocumentID,
+		Version:    revision.Version,
+		Content:    contentString,
+		CreatedBy:  createdBy,
+		CreatedAt:  revision.CreatedAt,
+	}, nil
+}
+
+// RevisionModelsToPayloads converts multiple document revisions to their API safe versions using
+// RevisionModelToPayload.
+func RevisionModelsToPayloads(revisions []*model.DocumentRevisions) ([]RevisionPayload, error) {
+	converted := make([]RevisionPayload, len(revisions))
+	for i, revision := range revisions {
+		var err error
+		converted[i], err = RevisionModelToPayload(revision)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return converted, nil
+}
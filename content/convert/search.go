@@ -0,0 +1,49 @@
+package convert
+
+import (
+	"encoding/json"
+
+	"encore.app/content/models"
+)
+
+// SearchResultPayload is an API safe version of a document matching a full-text search.
+type SearchResultPayload struct {
+	// The matching document
+	Document DocumentPayload
+
+	// The rank of the document for the search, the more relevant the document, the higher the rank
+	Rank float64
+
+	// The values of the searched paths matching the search, by path, with the matched words wrapped in
+	// `<b>` tags. Long strings are shortened to the fragments around the matched words
+	Highlights json.RawMessage
+}
+
+// SearchResultToPayload converts a document matching a full-text search to its API safe version.
+func SearchResultToPayload(result *models.SearchResult) (SearchResultPayload, error) {
+	document, err := DocumentModelToPayload(&result.Documents)
+	if err != nil {
+		return SearchResultPayload{}, err
+	}
+
+	return SearchResultPayload{
+		Document:   document,
+		Rank:       result.Rank,
+		Highlights: json.RawMessage(result.Highlights),
+	}, nil
+}
+
+// SearchResultsToPayloads converts multiple search results to their API safe versions using
+// SearchResultToPayload.
+func SearchResultsToPayloads(results []*models.SearchResult) ([]SearchResultPayload, error) {
+	converted := make([]SearchResultPayload, len(results))
+	for i, result := range results {
+		var err error
+		converted[i], err = SearchResultToPayload(result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return converted, nil
+}
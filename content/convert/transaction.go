@@ -0,0 +1,31 @@
+package convert
+
+import (
+	"time"
+
+	"encore.dev/types/uuid"
+
+	"encore.app/content/models/generated/content/public/model"
+)
+
+// TransactionPayload is an API safe version of a transaction.
+type TransactionPayload struct {
+	// The transaction unique key, given to requests to run them in the transaction
+	Key uuid.UUID
+
+	// The unique identifier of the database the transaction runs on
+	DatabaseID int64
+
+	// The time after which the transaction can no longer be used
+	ExpiresAt time.Time
+}
+
+// TransactionModelToPayload converts a database representation of a Transaction
+// to an API safe version.
+func TransactionModelToPayload(transaction *model.Transactions) TransactionPayload {
+	return TransactionPayload{
+		Key:        transaction.ID,
+		DatabaseID: transaction.DatabaseID,
+		ExpiresAt:  transaction.ExpiresAt,
+	}
+}
@@ -0,0 +1,84 @@
+package convert
+
+import (
+	"encoding/json"
+	"time"
+
+	"encore.app/content/models/generated/content/public/model"
+)
+
+// DocumentRecord is a document as written by an export of a collection in the NDJSON and JSON formats,
+// and as read by an import. Only the key and the content are read by an import, the other fields are
+// given by the collection the document is imported to.
+type DocumentRecord struct {
+	// The document unique identifier
+	ID int64
+
+	// The key given to the document by the client when created, unique within its collection. Empty
+	// when the document has no key
+	Key string
+
+	// The document content, as JSON
+	Content json.RawMessage
+
+	// The document version, incremented on every change to the document
+	Version int64
+
+	UpdatedAt time.Time
+	CreatedAt time.Time
+}
+
+// DocumentModelToRecord converts a database representation of a document to a record of an export.
+func DocumentModelToRecord(document *model.Documents) DocumentRecord {
+	key := ""
+	if document.Key != nil {
+		key = *document.Key
+	}
+
+	return DocumentRecord{
+		ID:        document.ID,
+		Key:       key,
+		Content:   json.RawMessage(document.Content),
+		Version:   document.Version,
+		UpdatedAt: document.UpdatedAt,
+		CreatedAt: document.CreatedAt,
+	}
+}
+
+// ImportRowError is a row of an import that could not be imported.
+type ImportRowError struct {
+	// The number of the row in the file, starting at 1: the line of an NDJSON file, the item of a JSON
+	// array, or the row following the header of a CSV file
+	Row int64
+
+	// The key of the document of the row, if it has one
+	Key string
+
+	// Why the row could not be imported
+	Message string
+}
+
+// ImportProgress is the progress of an import, reported after each batch of rows.
+type ImportProgress struct {
+	// The status of the import, `importing` until every row is read, then `done`, or `aborted` when
+	// the import stopped early
+	Status string
+
+	// The number of rows read so far
+	Read int64
+
+	// The number of documents created so far
+	Inserted int64
+
+	// The number of existing documents updated so far, when importing with upsert
+	Updated int64
+
+	// The number of rows skipped so far because they could not be imported
+	Skipped int64
+
+	// The rows of the batch that could not be imported
+	Errors []ImportRowError
+
+	// Why the import was aborted, when it was
+	Error string
+}
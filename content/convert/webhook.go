@@ -0,0 +1,142 @@
+package convert
+
+import (
+	"encoding/json"
+	"time"
+
+	"encore.app/content/models/generated/content/public/model"
+)
+
+// WebhookPayload is an API safe version of a webhook, without its secret.
+type WebhookPayload struct {
+	ID int64
+
+	// The unique identifier of the database the webhook receives the changes of
+	DatabaseID int64
+
+	// The unique identifier of the collection the webhook receives the changes of, zero when it receives the
+	// changes of all the collections of the database
+	CollectionID int64
+
+	// The URL the changes are sent to
+	URL string
+
+	// The operations on the documents the webhook receives the changes of, among `insert`, `update` and `delete`
+	Events []string
+
+	// The filter the content of the documents must match for their changes to be sent, if any
+	Filter json.RawMessage
+
+	// Whether the changes are sent to the webhook. The changes made while a webhook is inactive are sent once
+	// it is active again, as long as they are still kept
+	Active bool
+
+	UpdatedAt time.Time
+	CreatedAt time.Time
+}
+
+// WebhookModelToPayload converts a database representation of a webhook to an API safe version.
+func WebhookModelToPayload(webhook *model.Webhooks) WebhookPayload {
+	payload := WebhookPayload{
+		ID:         webhook.ID,
+		DatabaseID: webhook.DatabaseID,
+		URL:        webhook.URL,
+		Active:     webhook.Active,
+		UpdatedAt:  webhook.UpdatedAt,
+		CreatedAt:  webhook.CreatedAt,
+	}
+
+	if webhook.CollectionID != nil {
+		payload.CollectionID = *webhook.CollectionID
+	}
+
+	_ = json.Unmarshal([]byte(webhook.Events), &payload.Events)
+	if webhook.Filter != nil {
+		payload.Filter = json.RawMessage(*webhook.Filter)
+	}
+
+	return payload
+}
+
+// WebhookModelsToPayloads converts multiple webhook models to their API safe versions
+// using WebhookModelToPayload.
+func WebhookModelsToPayloads(webhooks []*model.Webhooks) []WebhookPayload {
+	converted := make([]WebhookPayload, len(webhooks))
+	for i, webhook := range webhooks {
+		converted[i] = WebhookModelToPayload(webhook)
+	}
+
+	return converted
+}
+
+// WebhookDeliveryPayload is an API safe version of a delivery of a change to a webhook.
+type WebhookDeliveryPayload struct {
+	ID int64
+
+	// The unique identifier of the webhook the change is delivered to
+	WebhookID int64
+
+	// The operation on the document that was changed, one of `insert`, `update` or `delete`
+	Event string
+
+	// The change sent to the webhook, as it is sent
+	Payload json.RawMessage
+
+	// The status of the delivery, `pending` until it is delivered, and `failed` once all its attempts failed
+	Status string
+
+	// The number of attempts made to deliver the change
+	Attempts int32
+
+	// When the change is attempted to be delivered next, while the delivery is pending
+	NextAttemptAt time.Time
+
+	// The HTTP status the webhook responded with on the last attempt, zero when it did not respond
+	ResponseStatus int32
+
+	// The reason the last attempt failed, if it did
+	Error string
+
+	// When the change was delivered, if it was
+	DeliveredAt *time.Time
+
+	UpdatedAt time.Time
+	CreatedAt time.Time
+}
+
+// WebhookDeliveryModelToPayload converts a database representation of a webhook delivery to an API safe version.
+func WebhookDeliveryModelToPayload(delivery *model.WebhookDeliveries) WebhookDeliveryPayload {
+	payload := WebhookDeliveryPayload{
+		ID:            delivery.ID,
+		WebhookID:     delivery.WebhookID,
+		Event:         delivery.Event,
+		Payload:       json.RawMessage(delivery.Payload),
+		Status:        delivery.Status,
+		Attempts:      delivery.Attempts,
+		NextAttemptAt: delivery.NextAttemptAt,
+		DeliveredAt:   delivery.DeliveredAt,
+		UpdatedAt:     delivery.UpdatedAt,
+		CreatedAt:     delivery.CreatedAt,
+	}
+
+	if delivery.ResponseStatus != nil {
+		payload.ResponseStatus = *delivery.ResponseStatus
+	}
+
+	if delivery.Error != nil {
+		payload.Error = *delivery.Error
+	}
+
+	return payload
+}
+
+// WebhookDeliveryModelsToPayloads converts multiple webhook delivery models to their API safe versions
+// using WebhookDeliveryModelToPayload.
+func WebhookDeliveryModelsToPayloads(deliveries []*model.WebhookDeliveries) []WebhookDeliveryPayload {
+	converted := make([]WebhookDeliveryPayload, len(deliveries))
+	for i, delivery := range deliveries {
+		converted[i] = WebhookDeliveryModelToPayload(delivery)
+	}
+
+	return converted
+}
@@ -5,24 +5,50 @@ import (
 
 	"encore.app/content/convert"
 	"encore.app/content/internal"
+	"encore.app/pagination"
 )
 
+// ListDatabasesParams is the parameters for listing the databases of the current user
+type ListDatabasesParams struct {
+	// The maximum number of databases to return, defaults to 100 and cannot exceed 1000
+	Limit int
+
+	// The cursor returned as `NextCursor` by the previous call, to fetch the next page of databases
+	Cursor string
+
+	// The field to sort the databases by, one of `created_at` or `updated_at`. Defaults to `created_at`
+	SortBy string
+
+	// Whether to sort the databases in descending order
+	Descending bool
+}
+
 // ListDatabasesResponse is the list of databases for the current user
 type ListDatabasesResponse struct {
 	// The fetched databases
 	Databases []convert.DatabasePayload
+
+	// The cursor to give to the next call to fetch the next page of databases, empty when there are
+	// no more databases to fetch
+	NextCursor string
 }
 
-// ListDatabases lists all Databases created by the authenticated user.
+// ListDatabases lists the Databases created by the authenticated user, one page at a time.
 //encore:api auth
-func ListDatabases(ctx context.Context) (*ListDatabasesResponse, error) {
-	databases, err := internal.ListDatabases(ctx)
+func ListDatabases(ctx context.Context, params *ListDatabasesParams) (*ListDatabasesResponse, error) {
+	databases, nextCursor, err := internal.ListDatabases(ctx, pagination.Params{
+		Limit:      params.Limit,
+		Cursor:     params.Cursor,
+		SortBy:     params.SortBy,
+		Descending: params.Descending,
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	return &ListDatabasesResponse{
-		Databases: databases,
+		Databases:  databases,
+		NextCursor: nextCursor,
 	}, nil
 }
 
@@ -51,10 +77,34 @@ func GetDatabase(ctx context.Context, params *GetDatabaseParams) (*GetDatabaseRe
 	}, nil
 }
 
+// GetDatabaseByNameParams is the parameters for finding a database by name
+type GetDatabaseByNameParams struct {
+	// The name of the database
+	Name string
+}
+
+// GetDatabaseByName finds a database by name, so that clients can address databases by a name that is
+// the same in every environment instead of by ID
+//encore:api auth
+func GetDatabaseByName(ctx context.Context, params *GetDatabaseByNameParams) (*GetDatabaseResponse, error) {
+	database, err := internal.GetDatabaseByName(ctx, params.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GetDatabaseResponse{
+		Database: database,
+	}, nil
+}
+
 // CreateDatabaseParams is the parameters for creating a database for collections
 type CreateDatabaseParams struct {
 	// The name of the database
 	Name string
+
+	// The number of days the databases, collections and documents deleted from the database are kept in
+	// the trash before being purged, between 1 and 365. Defaults to 30
+	TrashRetentionDays int
 }
 
 // CreateDatabaseResponse is the result of creating a database for collections
@@ -69,7 +119,7 @@ type CreateDatabaseResponse struct {
 // CreateDatabase creates a database for the authenticated user.
 //encore:api auth
 func CreateDatabase(ctx context.Context, params *CreateDatabaseParams) (*CreateDatabaseResponse, error) {
-	database, err := internal.CreateDatabase(ctx, params.Name)
+	database, err := internal.CreateDatabase(ctx, params.Name, params.TrashRetentionDays)
 	if err != nil {
 		return nil, err
 	}
@@ -87,6 +137,10 @@ type UpdateDatabaseParams struct {
 
 	// The name of the database
 	Name string
+
+	// The number of days the databases, collections and documents deleted from the database are kept in
+	// the trash before being purged, between 1 and 365. Left unchanged when not given
+	TrashRetentionDays *int
 }
 
 // UpdateDatabaseResponse is the result of updating a database for collections
@@ -101,7 +155,7 @@ type UpdateDatabaseResponse struct {
 // UpdateDatabase updates a database by ID for the authenticated user
 //encore:api auth
 func UpdateDatabase(ctx context.Context, params *UpdateDatabaseParams) (*UpdateDatabaseResponse, error) {
-	database, err := internal.UpdateDatabase(ctx, params.ID, params.Name)
+	database, err := internal.UpdateDatabase(ctx, params.ID, params.Name, params.TrashRetentionDays)
 	if err != nil {
 		return nil, err
 	}
@@ -127,7 +181,8 @@ type DeleteDatabaseResponse struct {
 	Database convert.DatabasePayload
 }
 
-// DeleteDatabase deletes a database by ID for the authenticated user
+// DeleteDatabase moves a database by ID to the trash for the authenticated user, along with its collections
+// and documents. It can be restored with RestoreDatabaseFromTrash until it is purged.
 //encore:api auth
 func DeleteDatabase(ctx context.Context, params *DeleteDatabaseParams) (*DeleteDatabaseResponse, error) {
 	database, err := internal.DeleteDatabase(ctx, params.ID)
@@ -45,12 +45,14 @@ func insertDatabases(ctx context.Context, databases []*model.Databases) error {
 			table.Databases.ID,
 			table.Databases.Name,
 			table.Databases.UserID,
+			table.Databases.DeletedAt,
 			table.Databases.UpdatedAt,
 			table.Databases.CreatedAt,
 		).VALUES(
 			database.ID,
 			database.Name,
 			database.UserID,
+			database.DeletedAt,
 			database.UpdatedAt,
 			database.CreatedAt,
 		).Sql()
@@ -157,7 +159,7 @@ func TestListDatabases(t *testing.T) {
 				require.NoError(t, err)
 			}
 
-			response, err := ListDatabases(ctx)
+			response, err := ListDatabases(ctx, &ListDatabasesParams{})
 			if tc.expected.err != nil {
 				test_utils2.CompareErrors(t, tc.expected.err, err)
 				assert.Nil(t, response)
@@ -289,6 +291,128 @@ func TestGetDatabase(t *testing.T) {
 	}
 }
 
+func TestGetDatabaseByName(t *testing.T) {
+	now := time.Now()
+
+	type expected struct {
+		response *GetDatabaseResponse
+		err      error
+	}
+
+	validDatabases := []*model.Databases{
+		{
+			ID:        2,
+			UserID:    1,
+			Name:      "test",
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		{
+			ID:        3,
+			UserID:    2,
+			Name:      "other",
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+	}
+
+	tcs := []struct {
+		scenario string
+		userData *identity.UserData
+		userCan  *string
+		params   *GetDatabaseByNameParams
+		expected expected
+	}{
+		{
+			scenario: "Returns a database by name, owned by a user",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params:  &GetDatabaseByNameParams{Name: "test"},
+			expected: expected{
+				response: &GetDatabaseResponse{
+					Database: convert.DatabaseModelToPayload(validDatabases[0]),
+				},
+			},
+		},
+		{
+			scenario: "Returns an error when the database is not found",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params:  &GetDatabaseByNameParams{Name: "unknown"},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.NotFound,
+					Message: "Could not find database",
+				},
+			},
+		},
+		{
+			scenario: "Returns an error when the user does not own the database",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params:  &GetDatabaseByNameParams{Name: "other"},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.NotFound,
+					Message: "Could not find database",
+				},
+			},
+		},
+		{
+			scenario: "Fails if the key cannot view the database",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			params: &GetDatabaseByNameParams{Name: "test"},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.PermissionDenied,
+					Message: "API key doesn't have the ability to read the database",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(tc.userData.ID, 10)), tc.userData)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := insertDatabases(ctx, validDatabases)
+			require.NoError(t, err)
+
+			if tc.userCan != nil {
+				_, err := permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+					KeyID: 1,
+					Role:  *tc.userCan,
+				})
+				require.NoError(t, err)
+			}
+
+			response, err := GetDatabaseByName(ctx, tc.params)
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected.response.Database.ID, response.Database.ID)
+				assert.Equal(t, tc.expected.response.Database.Name, response.Database.Name)
+			}
+		})
+	}
+}
+
 func TestCreateDatabase(t *testing.T) {
 	now := time.Now()
 
@@ -349,6 +473,24 @@ func TestCreateDatabase(t *testing.T) {
 				},
 			},
 		},
+		{
+			scenario: "Will throw an error when the trash retention is not valid",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("admin"),
+			params: &CreateDatabaseParams{
+				Name:               "test",
+				TrashRetentionDays: 366,
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received trash retention was not valid, it must be between 1 and 365 days",
+				},
+			},
+		},
 		{
 			scenario: "Fails if the key cannot act on the database",
 			userData: &identity.UserData{
@@ -6,37 +6,105 @@ import (
 
 	"encore.app/content/convert"
 	"encore.app/content/internal"
+	"encore.app/pagination"
+	"encore.dev/types/uuid"
 )
 
 // ListDocumentsParams is the parameters for listing the documents of a collection
 type ListDocumentsParams struct {
 	// The unique identifier of the collection
 	CollectionID int64
+
+	// An optional filter expression on the content of the documents, for example
+	// `{"status": "active", "age": {"$gte": 18}}`. Fields are identified by dot separated
+	// paths, like `address.city`, and can be compared using the `$eq`, `$ne`, `$gt`, `$gte`,
+	// `$lt`, `$lte`, `$in`, `$nin`, `$exists` and `$not` operators. Filters can be combined
+	// with the `$and`, `$or` and `$not` logical operators.
+	Filter json.RawMessage
+
+	// The maximum number of documents to return, defaults to 100 and cannot exceed 1000
+	Limit int
+
+	// The cursor returned as `NextCursor` by the previous call, to fetch the next page of documents
+	Cursor string
+
+	// The field to sort the documents by, one of `created_at`, `updated_at` or a path in the
+	// content of the documents prefixed by `content.`, like `content.address.city`. Defaults to `created_at`
+	SortBy string
+
+	// Whether to sort the documents in descending order
+	Descending bool
+
+	// Dot separated paths to include in the content of the documents, like `["title", "author.name"]`. Only
+	// these values are returned, nested in the objects they belong to. Cannot be given along with Exclude
+	Include []string
+
+	// Dot separated paths to exclude from the content of the documents, like `["body"]`. Cannot be given
+	// along with Include
+	Exclude []string
+
+	// The key of a transaction to run the operation in, changes made in a transaction are only visible
+	// in that transaction until it is committed
+	TransactionKey uuid.UUID
 }
 
 // ListDocumentsResponse is the list of documents for the current user and identified collection
 type ListDocumentsResponse struct {
 	// The fetched collections
 	Documents []convert.DocumentPayload
+
+	// The cursor to give to the next call to fetch the next page of documents, empty when there are
+	// no more documents to fetch
+	NextCursor string
 }
 
-// ListDocuments lists all documents created by the authenticated user for a given collection
+// ListDocuments lists the documents created by the authenticated user for a given collection,
+// one page at a time.
 //encore:api auth
 func ListDocuments(ctx context.Context, params *ListDocumentsParams) (*ListDocumentsResponse, error) {
-	documents, err := internal.ListDocuments(ctx, params.CollectionID)
+	ctx, err := internal.WithTransaction(ctx, params.TransactionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	documents, nextCursor, err := internal.ListDocuments(ctx, params.CollectionID, params.Filter, pagination.Params{
+		Limit:      params.Limit,
+		Cursor:     params.Cursor,
+		SortBy:     params.SortBy,
+		Descending: params.Descending,
+	}, params.Include, params.Exclude)
 	if err != nil {
 		return nil, err
 	}
 
 	return &ListDocumentsResponse{
-		Documents: documents,
+		Documents:  documents,
+		NextCursor: nextCursor,
 	}, nil
 }
 
-// GetDocumentParams is the parameters for finding a document by ID
+// GetDocumentParams is the parameters for finding a document by ID, or by key within its collection
 type GetDocumentParams struct {
 	// The unique identifier of the document
 	ID int64
+
+	// The unique identifier of the collection of the document, to find the document by key
+	CollectionID int64
+
+	// The key of the document in its collection, to find the document by key instead of by ID
+	Key string
+
+	// Dot separated paths to include in the content of the document, like `["title", "author.name"]`. Only
+	// these values are returned, nested in the objects they belong to. Cannot be given along with Exclude
+	Include []string
+
+	// Dot separated paths to exclude from the content of the document, like `["body"]`. Cannot be given
+	// along with Include
+	Exclude []string
+
+	// The key of a transaction to run the operation in, changes made in a transaction are only visible
+	// in that transaction until it is committed
+	TransactionKey uuid.UUID
 }
 
 // GetDocumentResponse is the result of having fetched a document
@@ -45,10 +113,58 @@ type GetDocumentResponse struct {
 	Document convert.DocumentPayload
 }
 
-// GetDocument finds a document by ID
+// GetDocument finds a document by ID, or by key within its collection
 //encore:api auth
 func GetDocument(ctx context.Context, params *GetDocumentParams) (*GetDocumentResponse, error) {
-	document, err := internal.GetDocument(ctx, params.ID)
+	ctx, err := internal.WithTransaction(ctx, params.TransactionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := internal.GetDocument(ctx, internal.NewDocumentRef(params.ID, params.CollectionID, params.Key), params.Include, params.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GetDocumentResponse{
+		Document: document,
+	}, nil
+}
+
+// GetDocumentByPathParams is the parameters for finding a document by the path
+// `{database}/{collection}/{key}`
+type GetDocumentByPathParams struct {
+	// The name of the database of the document
+	Database string
+
+	// The name of the collection of the document
+	Collection string
+
+	// The key of the document in its collection
+	Key string
+
+	// Dot separated paths to include in the content of the document, like `["title", "author.name"]`. Only
+	// these values are returned, nested in the objects they belong to. Cannot be given along with Exclude
+	Include []string
+
+	// Dot separated paths to exclude from the content of the document, like `["body"]`. Cannot be given
+	// along with Include
+	Exclude []string
+
+	// The key of a transaction to run the operation in, changes made in a transaction are only visible
+	// in that transaction until it is committed
+	TransactionKey uuid.UUID
+}
+
+// GetDocumentByPath finds a document by its key, the name of its collection and the name of its database
+//encore:api auth
+func GetDocumentByPath(ctx context.Context, params *GetDocumentByPathParams) (*GetDocumentResponse, error) {
+	ctx, err := internal.WithTransaction(ctx, params.TransactionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := internal.GetDocumentByPath(ctx, params.Database, params.Collection, params.Key, params.Include, params.Exclude)
 	if err != nil {
 		return nil, err
 	}
@@ -63,8 +179,16 @@ type CreateDocumentParams struct {
 	// The unique identifier for the collection this document should be added to
 	CollectionID int64
 
+	// An optional key to address the document by instead of its ID, unique within the collection, like
+	// `settings/user-42`. It cannot be changed once the document is created
+	Key string
+
 	// The content of the document
 	Content json.RawMessage
+
+	// The key of a transaction to run the operation in, changes made in a transaction are only visible
+	// in that transaction until it is committed
+	TransactionKey uuid.UUID
 }
 
 // CreateDocumentResponse is the result of creating a document
@@ -79,7 +203,12 @@ type CreateDocumentResponse struct {
 // CreateDocument creates a document for the authenticated user
 //encore:api auth
 func CreateDocument(ctx context.Context, params *CreateDocumentParams) (*CreateDocumentResponse, error) {
-	document, err := internal.CreateDocument(ctx, params.CollectionID, params.Content)
+	ctx, err := internal.WithTransaction(ctx, params.TransactionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := internal.CreateDocument(ctx, params.CollectionID, params.Key, params.Content)
 	if err != nil {
 		return nil, err
 	}
@@ -95,8 +224,22 @@ type UpdateDocumentParams struct {
 	// The unique identifier for the document
 	ID int64
 
+	// The unique identifier of the collection of the document, to find the document by key
+	CollectionID int64
+
+	// The key of the document in its collection, to find the document by key instead of by ID
+	Key string
+
 	// The content of the document
 	Content json.RawMessage
+
+	// The version the document is expected to be at. When given, the operation fails if the document
+	// was modified since that version, with the current version in the details of the error
+	IfVersion *int64
+
+	// The key of a transaction to run the operation in, changes made in a transaction are only visible
+	// in that transaction until it is committed
+	TransactionKey uuid.UUID
 }
 
 // UpdateDocumentResponse is the result of updating a document for documents
@@ -108,10 +251,15 @@ type UpdateDocumentResponse struct {
 	Document convert.DocumentPayload
 }
 
-// UpdateDocument updates a document by ID for the authenticated user
+// UpdateDocument updates a document by ID or by key for the authenticated user
 //encore:api auth
 func UpdateDocument(ctx context.Context, params *UpdateDocumentParams) (*UpdateDocumentResponse, error) {
-	document, err := internal.UpdateDocument(ctx, params.ID, params.Content)
+	ctx, err := internal.WithTransaction(ctx, params.TransactionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := internal.UpdateDocument(ctx, internal.NewDocumentRef(params.ID, params.CollectionID, params.Key), params.Content, params.IfVersion)
 	if err != nil {
 		return nil, err
 	}
@@ -122,10 +270,89 @@ func UpdateDocument(ctx context.Context, params *UpdateDocumentParams) (*UpdateD
 	}, nil
 }
 
+// PatchDocumentParams is the parameters for partially updating a document, only one of
+// the three patch formats can be given
+type PatchDocumentParams struct {
+	// The unique identifier for the document
+	ID int64
+
+	// The unique identifier of the collection of the document, to find the document by key
+	CollectionID int64
+
+	// The key of the document in its collection, to find the document by key instead of by ID
+	Key string
+
+	// A list of RFC 6902 JSON Patch operations to apply to the content of the document, for example
+	// `[{"op": "replace", "path": "/address/city", "value": "Montreal"}]`
+	JSONPatch json.RawMessage
+
+	// An RFC 7396 JSON Merge Patch to merge into the content of the document, where null values
+	// remove fields, for example `{"address": {"city": "Montreal"}, "phone": null}`
+	MergePatch json.RawMessage
+
+	// Update operators applied atomically to the content of the document, for example
+	// `{"$inc": {"views": 1}, "$push": {"tags": "new"}, "$unset": {"draft": true}}`. The supported
+	// operators are `$set`, `$unset`, `$inc`, `$mul`, `$min`, `$max`, `$push`, `$addToSet`, `$pull`,
+	// `$rename` and `$setOnInsert`, which only applies when an upsert creates the document
+	Update json.RawMessage
+
+	// The version the document is expected to be at. When given, the operation fails if the document
+	// was modified since that version, with the current version in the details of the error
+	IfVersion *int64
+
+	// The key of a transaction to run the operation in, changes made in a transaction are only visible
+	// in that transaction until it is committed
+	TransactionKey uuid.UUID
+}
+
+// PatchDocumentResponse is the result of partially updating a document
+type PatchDocumentResponse struct {
+	// A message to inform the user of the result of the operation
+	Message string
+
+	// The patched document
+	Document convert.DocumentPayload
+}
+
+// PatchDocument applies a patch to the content of a document by ID or by key for the authenticated user.
+// The patch is applied atomically by the database, concurrent patches to different fields of
+// the same document do not overwrite each other.
+//encore:api auth
+func PatchDocument(ctx context.Context, params *PatchDocumentParams) (*PatchDocumentResponse, error) {
+	ctx, err := internal.WithTransaction(ctx, params.TransactionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := internal.PatchDocument(ctx, internal.NewDocumentRef(params.ID, params.CollectionID, params.Key), params.JSONPatch, params.MergePatch, params.Update, params.IfVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PatchDocumentResponse{
+		Message:  "Document patched successfully.",
+		Document: document,
+	}, nil
+}
+
 // DeleteDocumentParams is the parameters for deleting a document
 type DeleteDocumentParams struct {
 	// The unique identifier for the document
 	ID int64
+
+	// The unique identifier of the collection of the document, to find the document by key
+	CollectionID int64
+
+	// The key of the document in its collection, to find the document by key instead of by ID
+	Key string
+
+	// The version the document is expected to be at. When given, the operation fails if the document
+	// was modified since that version, with the current version in the details of the error
+	IfVersion *int64
+
+	// The key of a transaction to run the operation in, changes made in a transaction are only visible
+	// in that transaction until it is committed
+	TransactionKey uuid.UUID
 }
 
 // DeleteDocumentResponse is the result of deleting a document for documents
@@ -137,10 +364,16 @@ type DeleteDocumentResponse struct {
 	Document convert.DocumentPayload
 }
 
-// DeleteDocument deletes a document by ID for the authenticated user
+// DeleteDocument moves a document by ID or by key to the trash for the authenticated user. It can be
+// restored with RestoreDocumentFromTrash until it is purged.
 //encore:api auth
 func DeleteDocument(ctx context.Context, params *DeleteDocumentParams) (*DeleteDocumentResponse, error) {
-	document, err := internal.DeleteDocument(ctx, params.ID)
+	ctx, err := internal.WithTransaction(ctx, params.TransactionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := internal.DeleteDocument(ctx, internal.NewDocumentRef(params.ID, params.CollectionID, params.Key), params.IfVersion)
 	if err != nil {
 		return nil, err
 	}
@@ -150,3 +383,309 @@ func DeleteDocument(ctx context.Context, params *DeleteDocumentParams) (*DeleteD
 		Document: document,
 	}, nil
 }
+
+// UpsertDocumentParams is the parameters for creating or updating a document matched by a natural key
+type UpsertDocumentParams struct {
+	// The unique identifier for the collection of the document
+	CollectionID int64
+
+	// A filter expression matching the document to update, like `{"email": "foo@bar.com"}`. It usually
+	// compares the paths of a unique index, to match at most one document. The operation fails when
+	// several documents match
+	Match json.RawMessage
+
+	// The content of the document. It replaces the content of the matched document, or is created when no
+	// document matches, along with the values the match expression compares for equality that it does not
+	// have. The created document must match the match expression
+	Content json.RawMessage
+
+	// Whether to apply the content as a JSON Merge Patch to the matched document instead of replacing it
+	Merge bool
+
+	// Update operators to apply to the matched document instead of replacing it, like
+	// `{"$inc": {"visits": 1}, "$setOnInsert": {"firstVisit": "2022-01-01"}}`. When no document matches,
+	// they are applied to the content, or to an empty document when no content is given, along with the
+	// `$setOnInsert` operators
+	Update json.RawMessage
+
+	// The key of a transaction to run the operation in, changes made in a transaction are only visible
+	// in that transaction until it is committed
+	TransactionKey uuid.UUID
+}
+
+// UpsertDocumentResponse is the result of upserting a document
+type UpsertDocumentResponse struct {
+	// A message to inform the user of the result of the operation
+	Message string
+
+	// Whether the document was created, false when an existing document was updated
+	Created bool
+
+	// The created or updated document
+	Document convert.DocumentPayload
+}
+
+// UpsertDocument creates a document, or updates the document matching the match expression when there is
+// one, in a single step. Upserts comparing a path to the same value on a collection run one at a time, however
+// their match expression is written, so that concurrent upserts never create the same document twice
+//encore:api auth
+func UpsertDocument(ctx context.Context, params *UpsertDocumentParams) (*UpsertDocumentResponse, error) {
+	ctx, err := internal.WithTransaction(ctx, params.TransactionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	document, created, err := internal.UpsertDocument(ctx, params.CollectionID, params.Match, params.Content, params.Update, params.Merge)
+	if err != nil {
+		return nil, err
+	}
+
+	message := "Document updated successfully."
+	if created {
+		message = "Document created successfully."
+	}
+
+	return &UpsertDocumentResponse{
+		Message:  message,
+		Created:  created,
+		Document: document,
+	}, nil
+}
+
+// UpdateDocumentsParams is the parameters for updating all the documents of a collection matching a filter
+type UpdateDocumentsParams struct {
+	// The unique identifier for the collection of the documents
+	CollectionID int64
+
+	// A filter expression matching the documents to update, like `{"status": "draft"}`. `{}` matches all
+	// the documents of the collection
+	Filter json.RawMessage
+
+	// A list of RFC 6902 JSON Patch operations to apply to the content of each document
+	JSONPatch json.RawMessage
+
+	// An RFC 7396 JSON Merge Patch to merge into the content of each document
+	MergePatch json.RawMessage
+
+	// Update operators applied to the content of each document, like `{"$set": {"status": "published"}}`
+	Update json.RawMessage
+
+	// Whether to only count the matched documents and check the patch applies to them, without updating them
+	DryRun bool
+
+	// The key of a transaction to run the operation in, changes made in a transaction are only visible
+	// in that transaction until it is committed
+	TransactionKey uuid.UUID
+}
+
+// UpdateDocumentsResponse is the result of updating the documents matching a filter
+type UpdateDocumentsResponse struct {
+	// A message to inform the user of the result of the operation
+	Message string
+
+	// The number of updated documents, or of documents that would be updated on a dry run
+	Count int64
+
+	// The unique identifiers of the first updated documents, at most 10 of them
+	DocumentIDs []int64
+}
+
+// UpdateDocuments applies a patch to all the documents of a collection matching a filter for the authenticated
+// user, in a single step. Either all the matched documents are updated or none are
+//encore:api auth
+func UpdateDocuments(ctx context.Context, params *UpdateDocumentsParams) (*UpdateDocumentsResponse, error) {
+	ctx, err := internal.WithTransaction(ctx, params.TransactionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	count, ids, err := internal.UpdateDocuments(ctx, params.CollectionID, params.Filter, params.JSONPatch, params.MergePatch, params.Update, params.DryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	message := "Documents updated successfully."
+	if params.DryRun {
+		message = "Documents would be updated successfully."
+	}
+
+	return &UpdateDocumentsResponse{
+		Message:     message,
+		Count:       count,
+		DocumentIDs: ids,
+	}, nil
+}
+
+// DeleteDocumentsParams is the parameters for deleting all the documents of a collection matching a filter
+type DeleteDocumentsParams struct {
+	// The unique identifier for the collection of the documents
+	CollectionID int64
+
+	// A filter expression matching the documents to delete, like `{"status": "draft"}`. `{}` matches all
+	// the documents of the collection
+	Filter json.RawMessage
+
+	// Whether to only count the matched documents, without deleting them
+	DryRun bool
+
+	// The key of a transaction to run the operation in, changes made in a transaction are only visible
+	// in that transaction until it is committed
+	TransactionKey uuid.UUID
+}
+
+// DeleteDocumentsResponse is the result of deleting the documents matching a filter
+type DeleteDocumentsResponse struct {
+	// A message to inform the user of the result of the operation
+	Message string
+
+	// The number of deleted documents, or of documents that would be deleted on a dry run
+	Count int64
+
+	// The unique identifiers of the first deleted documents, at most 10 of them
+	DocumentIDs []int64
+}
+
+// DeleteDocuments moves all the documents of a collection matching a filter to the trash for the
+// authenticated user, in a single step
+//encore:api auth
+func DeleteDocuments(ctx context.Context, params *DeleteDocumentsParams) (*DeleteDocumentsResponse, error) {
+	ctx, err := internal.WithTransaction(ctx, params.TransactionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	count, ids, err := internal.DeleteDocuments(ctx, params.CollectionID, params.Filter, params.DryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	message := "Documents deleted successfully."
+	if params.DryRun {
+		message = "Documents would be deleted successfully."
+	}
+
+	return &DeleteDocumentsResponse{
+		Message:     message,
+		Count:       count,
+		DocumentIDs: ids,
+	}, nil
+}
+
+// AggregateDocumentsParams is the parameters for aggregating the documents of a collection
+type AggregateDocumentsParams struct {
+	// The unique identifier for the collection of the documents
+	CollectionID int64
+
+	// An optional filter expression selecting the documents to aggregate, like `{"status": "paid"}`
+	Match json.RawMessage
+
+	// The dot separated paths to group the documents by, like `["customer.id"]`. Documents without a
+	// value at a path are grouped with documents with a null value. Without paths, all the documents
+	// are aggregated in a single group
+	GroupBy []string
+
+	// The accumulators computed on each group, by name, like `{"total": {"$sum": "amount"}, "orders":
+	// {"$count": {}}}`. The supported accumulators are `$count`, `$sum`, `$avg`, `$min`, `$max` and
+	// `$distinct`, which all expect a path except `$count`
+	Accumulators json.RawMessage
+
+	// A path the documents are grouped by or the name of an accumulator to sort the groups by. Groups
+	// are sorted by the paths they are grouped by otherwise
+	SortBy string
+
+	// Whether to sort the groups in descending order
+	Descending bool
+
+	// The maximum number of groups to return, defaults to 100 and cannot exceed 1000
+	Limit int
+
+	// The key of a transaction to run the operation in, changes made in a transaction are only visible
+	// in that transaction until it is committed
+	TransactionKey uuid.UUID
+}
+
+// AggregateDocumentsResponse is the list of groups of an aggregation
+type AggregateDocumentsResponse struct {
+	// The groups, each with the values of the paths the documents are grouped by and of the
+	// accumulators, like `{"customer.id": 1, "total": 120.5, "orders": 3}`
+	Groups []json.RawMessage
+}
+
+// AggregateDocuments groups the documents of a collection by the values at some paths and computes
+// counts, sums, averages, minimums, maximums or distinct values on each group. The aggregation is
+// computed by the database, without fetching the documents
+//encore:api auth
+func AggregateDocuments(ctx context.Context, params *AggregateDocumentsParams) (*AggregateDocumentsResponse, error) {
+	ctx, err := internal.WithTransaction(ctx, params.TransactionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := internal.AggregateDocuments(ctx, params.CollectionID, params.Match, params.GroupBy, params.Accumulators, params.SortBy, params.Descending, params.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AggregateDocumentsResponse{
+		Groups: groups,
+	}, nil
+}
+
+// SearchDocumentsParams is the parameters for searching the documents of a collection by free text
+type SearchDocumentsParams struct {
+	// The unique identifier of the collection, it must have a search configuration
+	CollectionID int64
+
+	// The text to search, using the syntax of web search engines: words are all required unless
+	// separated by `or`, quoted words are matched as a phrase and words prefixed by `-` must not appear.
+	// For example `"cold brew" coffee -decaf`
+	Text string
+
+	// An optional filter expression the content of the documents must also match, with the same syntax
+	// as the filter of ListDocuments
+	Filter json.RawMessage
+
+	// The maximum number of documents to return, defaults to 100 and cannot exceed 1000
+	Limit int
+
+	// The cursor returned as `NextCursor` by the previous call, to fetch the next page of documents
+	Cursor string
+
+	// The key of a transaction to run the operation in, changes made in a transaction are only visible
+	// in that transaction until it is committed
+	TransactionKey uuid.UUID
+}
+
+// SearchDocumentsResponse is a page of the documents matching a search
+type SearchDocumentsResponse struct {
+	// The matching documents, by decreasing rank
+	Results []convert.SearchResultPayload
+
+	// The cursor to give to the next call to fetch the next page of documents, empty when there are
+	// no more documents to fetch
+	NextCursor string
+}
+
+// SearchDocuments searches the documents of a collection by free text for the authenticated user, in
+// the paths declared by the search configuration of the collection. The documents are ranked by
+// relevance and returned one page at a time, with the matched words highlighted.
+//encore:api auth
+func SearchDocuments(ctx context.Context, params *SearchDocumentsParams) (*SearchDocumentsResponse, error) {
+	ctx, err := internal.WithTransaction(ctx, params.TransactionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	results, nextCursor, err := internal.SearchDocuments(ctx, params.CollectionID, params.Text, params.Filter, pagination.Params{
+		Limit:  params.Limit,
+		Cursor: params.Cursor,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &SearchDocumentsResponse{
+		Results:    results,
+		NextCursor: nextCursor,
+	}, nil
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -16,10 +18,13 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"encore.app/content/convert"
+	"encore.app/content/internal"
 	"encore.app/content/models/generated/content/public/model"
 	"encore.app/content/models/generated/content/public/table"
+	"encore.app/content/query"
 	"encore.app/content/test_utils"
 	"encore.app/identity"
+	"encore.app/pagination"
 	"encore.app/permissions"
 	test_utils_permissions "encore.app/permissions/test_utils"
 	test_utils2 "encore.app/test_utils"
@@ -50,12 +55,16 @@ func insertDocuments(ctx context.Context, documents []*model.Documents) error {
 			table.Documents.CollectionID,
 			table.Documents.UpdatedAt,
 			table.Documents.CreatedAt,
+			table.Documents.Key,
+			table.Documents.DeletedAt,
 		).VALUES(
 			document.ID,
 			document.Content,
 			document.CollectionID,
 			document.UpdatedAt,
 			document.CreatedAt,
+			document.Key,
+			document.DeletedAt,
 		).Sql()
 
 		_, err := sqldb.Exec(ctx, query, args...)
@@ -168,6 +177,133 @@ func TestListDocuments(t *testing.T) {
 				},
 			},
 		},
+		{
+			scenario: "Returns the documents matching the filter",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params: &ListDocumentsParams{
+				CollectionID: validCollections[0].ID,
+				Filter:       json.RawMessage(`{"foo": {"$in": ["bar2", "bar3"]}}`),
+			},
+			existingDocuments: validDocuments,
+			expected: expected{
+				response: &ListDocumentsResponse{
+					Documents: documentPayloads[1:],
+				},
+			},
+		},
+		{
+			scenario: "Returns the documents with the included paths of their content",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params: &ListDocumentsParams{
+				CollectionID: validCollections[0].ID,
+				Include:      []string{"foo"},
+			},
+			existingDocuments: validDocuments,
+			expected: expected{
+				response: &ListDocumentsResponse{
+					Documents: documentPayloads,
+				},
+			},
+		},
+		{
+			scenario: "Throws an error when the filter is not valid",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params: &ListDocumentsParams{
+				CollectionID: validCollections[0].ID,
+				Filter:       json.RawMessage(`{"foo": {"$like": "bar"}}`),
+			},
+			existingDocuments: validDocuments,
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received filter was not valid, invalid clause at `/foo/$like`: unknown operator `$like`",
+					Details: &query.Error{
+						Pointer: "/foo/$like",
+						Reason:  "unknown operator `$like`",
+					},
+				},
+			},
+		},
+		{
+			scenario: "Returns a page of documents sorted by their content",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params: &ListDocumentsParams{
+				CollectionID: validCollections[0].ID,
+				Limit:        1,
+				SortBy:       "content.foo",
+				Descending:   true,
+			},
+			existingDocuments: validDocuments,
+			expected: expected{
+				response: &ListDocumentsResponse{
+					Documents: documentPayloads[1:],
+					NextCursor: pagination.Cursor{
+						SortBy:     "content.foo",
+						Descending: true,
+						Value:      `"bar2"`,
+						ID:         validDocuments[1].ID,
+					}.Encode(),
+				},
+			},
+		},
+		{
+			scenario: "Returns the page of documents after the cursor",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params: &ListDocumentsParams{
+				CollectionID: validCollections[0].ID,
+				Limit:        1,
+				Cursor: pagination.Cursor{
+					SortBy: "created_at",
+					Value:  pagination.TimestampValue(now),
+					ID:     validDocuments[0].ID,
+				}.Encode(),
+			},
+			existingDocuments: validDocuments,
+			expected: expected{
+				response: &ListDocumentsResponse{
+					Documents: documentPayloads[1:],
+				},
+			},
+		},
+		{
+			scenario: "Throws an error when the cursor is not valid",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params: &ListDocumentsParams{
+				CollectionID: validCollections[0].ID,
+				Cursor:       "not a cursor",
+			},
+			existingDocuments: validDocuments,
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received pagination was not valid, cursor is malformed",
+				},
+			},
+		},
 		{
 			scenario: "Throws an error when the collection does not exists",
 			userData: &identity.UserData{
@@ -236,11 +372,51 @@ func TestListDocuments(t *testing.T) {
 			} else {
 				require.NoError(t, err)
 				compareDocuments(t, tc.expected.response.Documents, response.Documents)
+				assert.Equal(t, tc.expected.response.NextCursor, response.NextCursor)
 			}
 		})
 	}
 }
 
+func TestListDocumentsSortedByUpdate(t *testing.T) {
+	created := time.Now().Add(-time.Hour)
+	userData := &identity.UserData{
+		ID:    1,
+		KeyID: 1,
+	}
+
+	ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(userData.ID, 10)), userData)
+	defer test_utils.Cleanup(ctx)
+	defer test_utils_permissions.Cleanup(ctx)
+
+	existingDatabase := &model.Databases{ID: 1, Name: "test", UserID: 1, CreatedAt: created, UpdatedAt: created}
+	require.NoError(t, insertDatabases(ctx, []*model.Databases{existingDatabase}))
+	require.NoError(t, insertCollections(ctx, []*model.Collections{
+		{ID: 2, DatabaseID: existingDatabase.ID, Name: "test", CreatedAt: created, UpdatedAt: created},
+	}))
+	require.NoError(t, insertDocuments(ctx, []*model.Documents{
+		{ID: 3, CollectionID: 2, Content: `{"foo": "bar"}`, CreatedAt: created, UpdatedAt: created},
+		{ID: 4, CollectionID: 2, Content: `{"foo": "bar2"}`, CreatedAt: created.Add(time.Minute), UpdatedAt: created.Add(time.Minute)},
+	}))
+
+	_, err := permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+		KeyID:      1,
+		DatabaseID: &existingDatabase.ID,
+		UserID:     1,
+		Role:       "write",
+	})
+	require.NoError(t, err)
+
+	_, err = UpdateDocument(ctx, &UpdateDocumentParams{ID: 3, Content: json.RawMessage(`{"foo": "updated"}`)})
+	require.NoError(t, err)
+
+	response, err := ListDocuments(ctx, &ListDocumentsParams{CollectionID: 2, SortBy: "updated_at", Descending: true})
+	require.NoError(t, err)
+	require.Len(t, response.Documents, 2)
+	assert.Equal(t, int64(3), response.Documents[0].ID)
+	assert.Equal(t, int64(4), response.Documents[1].ID)
+}
+
 func TestGetDocument(t *testing.T) {
 	now := time.Now()
 
@@ -272,6 +448,14 @@ func TestGetDocument(t *testing.T) {
 			CreatedAt:    now,
 			UpdatedAt:    now,
 		},
+		{
+			ID:           4,
+			CollectionID: 2,
+			Key:          test_utils.StringPointer("settings/user-42"),
+			Content:      `{"foo": "baz"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
 	}
 	documentPayloads, err := convert.DocumentModelsToPayloads(validDocuments)
 	require.NoError(t, err)
@@ -299,6 +483,125 @@ func TestGetDocument(t *testing.T) {
 				},
 			},
 		},
+		{
+			scenario: "Returns a document by key, owned by a user",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params: &GetDocumentParams{
+				CollectionID: validCollection.ID,
+				Key:          "settings/user-42",
+			},
+			existingDocuments: validDocuments,
+			expected: expected{
+				response: &GetDocumentResponse{
+					Document: documentPayloads[1],
+				},
+			},
+		},
+		{
+			scenario: "Returns a document with the included paths of its content",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params: &GetDocumentParams{
+				ID:      validDocuments[0].ID,
+				Include: []string{"foo", "missing"},
+			},
+			existingDocuments: validDocuments,
+			expected: expected{
+				response: &GetDocumentResponse{
+					Document: documentPayloads[0],
+				},
+			},
+		},
+		{
+			scenario: "Returns a document without the excluded paths of its content",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params: &GetDocumentParams{
+				ID:      validDocuments[0].ID,
+				Exclude: []string{"foo"},
+			},
+			existingDocuments: validDocuments,
+			expected: expected{
+				response: &GetDocumentResponse{
+					Document: convert.DocumentPayload{
+						ID:      validDocuments[0].ID,
+						Content: json.RawMessage(`"{}"`),
+					},
+				},
+			},
+		},
+		{
+			scenario: "Returns an error when paths are both included and excluded",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params: &GetDocumentParams{
+				ID:      validDocuments[0].ID,
+				Include: []string{"foo"},
+				Exclude: []string{"bar"},
+			},
+			existingDocuments: validDocuments,
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received projection was not valid, invalid clause at `/`: paths can either be included or excluded, not both",
+					Details: &query.Error{
+						Reason: "paths can either be included or excluded, not both",
+					},
+				},
+			},
+		},
+		{
+			scenario: "Returns an error when no document of the collection has the key",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params: &GetDocumentParams{
+				CollectionID: -1,
+				Key:          "settings/user-42",
+			},
+			existingDocuments: validDocuments,
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.NotFound,
+					Message: "Could not find document",
+				},
+			},
+		},
+		{
+			scenario: "Returns an error when both an ID and a key are given",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params: &GetDocumentParams{
+				ID:           validDocuments[0].ID,
+				CollectionID: validCollection.ID,
+				Key:          "settings/user-42",
+			},
+			existingDocuments: validDocuments,
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received document was not valid, a document is identified either by its ID or by its key along with the ID of its collection",
+				},
+			},
+		},
 		{
 			scenario: "Returns an error when the document is not found",
 			userData: &identity.UserData{
@@ -381,16 +684,17 @@ func TestGetDocument(t *testing.T) {
 				require.NoError(t, err)
 				assert.Equal(t, tc.expected.response.Document.ID, response.Document.ID)
 				assert.Equal(t, tc.expected.response.Document.Content, response.Document.Content)
+				assert.Equal(t, tc.expected.response.Document.Key, response.Document.Key)
 			}
 		})
 	}
 }
 
-func TestCreateDocument(t *testing.T) {
+func TestGetDocumentByPath(t *testing.T) {
 	now := time.Now()
 
 	type expected struct {
-		response *CreateDocumentResponse
+		response *GetDocumentResponse
 		err      error
 	}
 
@@ -405,87 +709,87 @@ func TestCreateDocument(t *testing.T) {
 	validCollection := &model.Collections{
 		ID:         2,
 		DatabaseID: existingDatabase.ID,
-		Name:       "test",
+		Name:       "config",
 		CreatedAt:  now,
 		UpdatedAt:  now,
 	}
 
+	validDocuments := []*model.Documents{
+		{
+			ID:           3,
+			CollectionID: validCollection.ID,
+			Key:          test_utils.StringPointer("settings/user-42"),
+			Content:      `{"foo": "bar"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+	}
+
 	tcs := []struct {
 		scenario string
-		userData *identity.UserData
 		userCan  *string
-		params   *CreateDocumentParams
+		params   *GetDocumentByPathParams
 		expected expected
 	}{
 		{
-			scenario: "Will create and return a document",
-			userData: &identity.UserData{
-				ID:    1,
-				KeyID: 1,
-			},
-			userCan: test_utils.StringPointer("write"),
-			params: &CreateDocumentParams{
-				CollectionID: validCollection.ID,
-				Content:      json.RawMessage(`{"foo": "bar"}`),
+			scenario: "Returns a document by its path",
+			userCan:  test_utils.StringPointer("read"),
+			params: &GetDocumentByPathParams{
+				Database:   "test",
+				Collection: "config",
+				Key:        "settings/user-42",
 			},
 			expected: expected{
-				response: &CreateDocumentResponse{
+				response: &GetDocumentResponse{
 					Document: convert.DocumentPayload{
+						ID:      validDocuments[0].ID,
+						Key:     "settings/user-42",
 						Content: json.RawMessage(`"{\"foo\": \"bar\"}"`),
 					},
 				},
 			},
 		},
 		{
-			scenario: "Will throw an error when the collection does not exists",
-			userData: &identity.UserData{
-				ID:    1,
-				KeyID: 1,
-			},
-			userCan: test_utils.StringPointer("write"),
-			params: &CreateDocumentParams{
-				CollectionID: -1,
-				Content:      json.RawMessage(`{"foo": "bar"}`),
+			scenario: "Returns an error when no document has the key",
+			userCan:  test_utils.StringPointer("read"),
+			params: &GetDocumentByPathParams{
+				Database:   "test",
+				Collection: "config",
+				Key:        "settings/user-43",
 			},
 			expected: expected{
 				err: &errs.Error{
 					Code:    errs.NotFound,
-					Message: "Could not find collection",
+					Message: "Could not find document",
 				},
 			},
 		},
 		{
-			scenario: "Will throw an error when the content is not JSON",
-			userData: &identity.UserData{
-				ID:    1,
-				KeyID: 1,
-			},
-			userCan: test_utils.StringPointer("write"),
-			params: &CreateDocumentParams{
-				CollectionID: validCollection.ID,
-				Content:      json.RawMessage("test"),
+			scenario: "Returns an error when the collection is not found",
+			userCan:  test_utils.StringPointer("read"),
+			params: &GetDocumentByPathParams{
+				Database:   "test",
+				Collection: "unknown",
+				Key:        "settings/user-42",
 			},
 			expected: expected{
 				err: &errs.Error{
-					Code:    errs.InvalidArgument,
-					Message: "Received JSON string for content was not valid",
+					Code:    errs.NotFound,
+					Message: "Could not find collection",
 				},
 			},
 		},
 		{
-			scenario: "Will return an error when the key cannot write to the database",
-			userData: &identity.UserData{
-				ID:    1,
-				KeyID: 1,
-			},
-			params: &CreateDocumentParams{
-				CollectionID: validCollection.ID,
-				Content:      json.RawMessage(`{"foo": "bar"}`),
+			scenario: "Returns an error when the key cannot access the database",
+			params: &GetDocumentByPathParams{
+				Database:   "test",
+				Collection: "config",
+				Key:        "settings/user-42",
 			},
 			expected: expected{
 				err: &errs.Error{
 					Code:    errs.PermissionDenied,
-					Message: "API key doesn't have the ability to write to the database",
+					Message: "API key doesn't have the ability to read the database",
 				},
 			},
 		},
@@ -493,7 +797,11 @@ func TestCreateDocument(t *testing.T) {
 
 	for _, tc := range tcs {
 		t.Run(tc.scenario, func(t *testing.T) {
-			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(tc.userData.ID, 10)), tc.userData)
+			userData := &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			}
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(userData.ID, 10)), userData)
 			defer test_utils.Cleanup(ctx)
 			defer test_utils_permissions.Cleanup(ctx)
 
@@ -503,6 +811,9 @@ func TestCreateDocument(t *testing.T) {
 			err = insertCollections(ctx, []*model.Collections{validCollection})
 			require.NoError(t, err)
 
+			err = insertDocuments(ctx, validDocuments)
+			require.NoError(t, err)
+
 			if tc.userCan != nil {
 				_, err := permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
 					KeyID:      1,
@@ -513,25 +824,25 @@ func TestCreateDocument(t *testing.T) {
 				require.NoError(t, err)
 			}
 
-			response, err := CreateDocument(ctx, tc.params)
-			fmt.Printf("%s: %v", tc.scenario, string(tc.params.Content))
+			response, err := GetDocumentByPath(ctx, tc.params)
 			if tc.expected.err != nil {
 				test_utils2.CompareErrors(t, tc.expected.err, err)
 				assert.Nil(t, response)
 			} else {
-				log.Warningf("maybe nil %s: %v", tc.scenario, err)
 				require.NoError(t, err)
+				assert.Equal(t, tc.expected.response.Document.ID, response.Document.ID)
+				assert.Equal(t, tc.expected.response.Document.Key, response.Document.Key)
 				assert.Equal(t, string(tc.expected.response.Document.Content), string(response.Document.Content))
 			}
 		})
 	}
 }
 
-func TestUpdateDocument(t *testing.T) {
+func TestCreateDocument(t *testing.T) {
 	now := time.Now()
 
 	type expected struct {
-		response *UpdateDocumentResponse
+		response *CreateDocumentResponse
 		err      error
 	}
 
@@ -551,74 +862,202 @@ func TestUpdateDocument(t *testing.T) {
 		UpdatedAt:  now,
 	}
 
-	validDocument := &model.Documents{
-		ID:           2,
-		CollectionID: validCollection.ID,
-		Content:      `{"foo": "bar"}`,
-		CreatedAt:    now,
-		UpdatedAt:    now,
+	schema := `{"type": "object", "properties": {"foo": {"type": "string"}}}`
+	schemaCollection := &model.Collections{
+		ID:         3,
+		DatabaseID: existingDatabase.ID,
+		Name:       "schema",
+		Schema:     &schema,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	existingDocuments := []*model.Documents{
+		{
+			ID:           4,
+			CollectionID: validCollection.ID,
+			Key:          test_utils.StringPointer("settings/user-42"),
+			Content:      `{"foo": "bar"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
 	}
 
 	tcs := []struct {
-		scenario          string
-		userData          *identity.UserData
-		userCan           *string
-		existingDocuments []*model.Documents
-		params            *UpdateDocumentParams
-		expected          expected
+		scenario string
+		userData *identity.UserData
+		userCan  *string
+		params   *CreateDocumentParams
+		expected expected
 	}{
 		{
-			scenario: "Will update an existing document and return its data",
+			scenario: "Will create and return a document",
 			userData: &identity.UserData{
 				ID:    1,
 				KeyID: 1,
 			},
 			userCan: test_utils.StringPointer("write"),
-			params: &UpdateDocumentParams{
-				ID:      validDocument.ID,
-				Content: json.RawMessage(`{"foo": "updated"}`),
+			params: &CreateDocumentParams{
+				CollectionID: validCollection.ID,
+				Content:      json.RawMessage(`{"foo": "bar"}`),
 			},
-			existingDocuments: []*model.Documents{validDocument},
 			expected: expected{
-				response: &UpdateDocumentResponse{
+				response: &CreateDocumentResponse{
 					Document: convert.DocumentPayload{
-						ID:      validDocument.ID,
-						Content: json.RawMessage(`"{\"foo\": \"updated\"}"`),
+						Content: json.RawMessage(`"{\"foo\": \"bar\"}"`),
 					},
 				},
 			},
 		},
 		{
-			scenario: "Will throw an error when the document does not exists",
+			scenario: "Will create a document with a key",
 			userData: &identity.UserData{
 				ID:    1,
 				KeyID: 1,
 			},
 			userCan: test_utils.StringPointer("write"),
-			params: &UpdateDocumentParams{
-				ID:      -1,
-				Content: json.RawMessage(`{"foo": "updated"}`),
+			params: &CreateDocumentParams{
+				CollectionID: validCollection.ID,
+				Key:          "settings/user-43",
+				Content:      json.RawMessage(`{"foo": "bar"}`),
+			},
+			expected: expected{
+				response: &CreateDocumentResponse{
+					Document: convert.DocumentPayload{
+						Key:     "settings/user-43",
+						Content: json.RawMessage(`"{\"foo\": \"bar\"}"`),
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will create a document with the key of a document of another collection",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &CreateDocumentParams{
+				CollectionID: schemaCollection.ID,
+				Key:          "settings/user-42",
+				Content:      json.RawMessage(`{"foo": "bar"}`),
+			},
+			expected: expected{
+				response: &CreateDocumentResponse{
+					Document: convert.DocumentPayload{
+						Key:     "settings/user-42",
+						Content: json.RawMessage(`"{\"foo\": \"bar\"}"`),
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when a document of the collection has the same key",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &CreateDocumentParams{
+				CollectionID: validCollection.ID,
+				Key:          "settings/user-42",
+				Content:      json.RawMessage(`{"foo": "bar"}`),
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.AlreadyExists,
+					Message: "A document with key `settings/user-42` already exists in this collection",
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when the key is too long",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &CreateDocumentParams{
+				CollectionID: validCollection.ID,
+				Key:          strings.Repeat("a", 256),
+				Content:      json.RawMessage(`{"foo": "bar"}`),
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received key was not valid, it must contain at most 255 characters",
+				},
+			},
+		},
+		{
+			scenario: "Will create a document matching the schema of the collection",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &CreateDocumentParams{
+				CollectionID: schemaCollection.ID,
+				Content:      json.RawMessage(`{"foo": "bar"}`),
+			},
+			expected: expected{
+				response: &CreateDocumentResponse{
+					Document: convert.DocumentPayload{
+						Content: json.RawMessage(`"{\"foo\": \"bar\"}"`),
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when the content does not match the schema of the collection",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &CreateDocumentParams{
+				CollectionID: schemaCollection.ID,
+				Content:      json.RawMessage(`{"foo": 1}`),
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received content does not match the schema of the collection",
+					Details: &internal.SchemaViolations{
+						Violations: []query.Error{{Pointer: "/foo", Reason: "expected a value of type string"}},
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when the collection does not exists",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &CreateDocumentParams{
+				CollectionID: -1,
+				Content:      json.RawMessage(`{"foo": "bar"}`),
 			},
-			existingDocuments: []*model.Documents{validDocument},
 			expected: expected{
 				err: &errs.Error{
 					Code:    errs.NotFound,
-					Message: "Could not find document",
+					Message: "Could not find collection",
 				},
 			},
 		},
 		{
-			scenario: "Will throw an error when the JSON is not valid",
+			scenario: "Will throw an error when the content is not JSON",
 			userData: &identity.UserData{
 				ID:    1,
 				KeyID: 1,
 			},
 			userCan: test_utils.StringPointer("write"),
-			params: &UpdateDocumentParams{
-				ID:      validDocument.ID,
-				Content: json.RawMessage("test"),
+			params: &CreateDocumentParams{
+				CollectionID: validCollection.ID,
+				Content:      json.RawMessage("test"),
 			},
-			existingDocuments: []*model.Documents{validDocument},
 			expected: expected{
 				err: &errs.Error{
 					Code:    errs.InvalidArgument,
@@ -632,11 +1071,10 @@ func TestUpdateDocument(t *testing.T) {
 				ID:    1,
 				KeyID: 1,
 			},
-			params: &UpdateDocumentParams{
-				ID:      validDocument.ID,
-				Content: json.RawMessage(`{"foo": "updated"}`),
+			params: &CreateDocumentParams{
+				CollectionID: validCollection.ID,
+				Content:      json.RawMessage(`{"foo": "bar"}`),
 			},
-			existingDocuments: []*model.Documents{validDocument},
 			expected: expected{
 				err: &errs.Error{
 					Code:    errs.PermissionDenied,
@@ -655,10 +1093,10 @@ func TestUpdateDocument(t *testing.T) {
 			err := insertDatabases(ctx, []*model.Databases{existingDatabase})
 			require.NoError(t, err)
 
-			err = insertCollections(ctx, []*model.Collections{validCollection})
+			err = insertCollections(ctx, []*model.Collections{validCollection, schemaCollection})
 			require.NoError(t, err)
 
-			err = insertDocuments(ctx, tc.existingDocuments)
+			err = insertDocuments(ctx, existingDocuments)
 			require.NoError(t, err)
 
 			if tc.userCan != nil {
@@ -671,23 +1109,26 @@ func TestUpdateDocument(t *testing.T) {
 				require.NoError(t, err)
 			}
 
-			response, err := UpdateDocument(ctx, tc.params)
+			response, err := CreateDocument(ctx, tc.params)
+			fmt.Printf("%s: %v", tc.scenario, string(tc.params.Content))
 			if tc.expected.err != nil {
 				test_utils2.CompareErrors(t, tc.expected.err, err)
 				assert.Nil(t, response)
 			} else {
+				log.Warningf("maybe nil %s: %v", tc.scenario, err)
 				require.NoError(t, err)
 				assert.Equal(t, string(tc.expected.response.Document.Content), string(response.Document.Content))
+				assert.Equal(t, tc.expected.response.Document.Key, response.Document.Key)
 			}
 		})
 	}
 }
 
-func TestDeleteDocument(t *testing.T) {
+func TestUpdateDocument(t *testing.T) {
 	now := time.Now()
 
 	type expected struct {
-		response *DeleteDocumentResponse
+		response *UpdateDocumentResponse
 		err      error
 	}
 
@@ -715,78 +1156,158 @@ func TestDeleteDocument(t *testing.T) {
 		UpdatedAt:    now,
 	}
 
+	keyedDocument := &model.Documents{
+		ID:           3,
+		CollectionID: validCollection.ID,
+		Key:          test_utils.StringPointer("settings/user-42"),
+		Content:      `{"foo": "bar"}`,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
 	tcs := []struct {
 		scenario          string
 		userData          *identity.UserData
 		userCan           *string
 		existingDocuments []*model.Documents
-		params            *DeleteDocumentParams
+		params            *UpdateDocumentParams
 		expected          expected
 	}{
 		{
-			scenario: "Will delete an existing document and return its data",
+			scenario: "Will update an existing document and return its data",
 			userData: &identity.UserData{
 				ID:    1,
 				KeyID: 1,
 			},
 			userCan: test_utils.StringPointer("write"),
-			params: &DeleteDocumentParams{
-				ID: validDocument.ID,
+			params: &UpdateDocumentParams{
+				ID:        validDocument.ID,
+				Content:   json.RawMessage(`{"foo": "updated"}`),
+				IfVersion: test_utils.Int64Pointer(1),
 			},
 			existingDocuments: []*model.Documents{validDocument},
 			expected: expected{
-				response: &DeleteDocumentResponse{
+				response: &UpdateDocumentResponse{
 					Document: convert.DocumentPayload{
 						ID:      validDocument.ID,
-						Content: json.RawMessage(`"{\"foo\": \"bar\"}"`),
+						Content: json.RawMessage(`"{\"foo\": \"updated\"}"`),
+						Version: 2,
 					},
 				},
 			},
 		},
 		{
-			scenario: "Will throw an error when the document does not exists",
+			scenario: "Will update a document by key",
 			userData: &identity.UserData{
 				ID:    1,
 				KeyID: 1,
 			},
 			userCan: test_utils.StringPointer("write"),
-			params: &DeleteDocumentParams{
-				ID: -1,
+			params: &UpdateDocumentParams{
+				CollectionID: validCollection.ID,
+				Key:          "settings/user-42",
+				Content:      json.RawMessage(`{"foo": "updated"}`),
+			},
+			existingDocuments: []*model.Documents{validDocument, keyedDocument},
+			expected: expected{
+				response: &UpdateDocumentResponse{
+					Document: convert.DocumentPayload{
+						ID:      keyedDocument.ID,
+						Key:     "settings/user-42",
+						Content: json.RawMessage(`"{\"foo\": \"updated\"}"`),
+						Version: 2,
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when the version does not match",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &UpdateDocumentParams{
+				ID:        validDocument.ID,
+				Content:   json.RawMessage(`{"foo": "updated"}`),
+				IfVersion: test_utils.Int64Pointer(2),
 			},
 			existingDocuments: []*model.Documents{validDocument},
 			expected: expected{
 				err: &errs.Error{
-					Code:    errs.NotFound,
-					Message: "Could not find document",
+					Code:    errs.FailedPrecondition,
+					Message: "Document was modified, its current version is 1",
+					Details: &internal.VersionMismatch{
+						CurrentVersion: 1,
+					},
 				},
 			},
 		},
 		{
-			scenario: "Will fail when the key cannot write to the database",
+			scenario: "Will throw an error when the document does not exists",
 			userData: &identity.UserData{
 				ID:    1,
 				KeyID: 1,
 			},
-			params: &DeleteDocumentParams{
-				ID: validDocument.ID,
+			userCan: test_utils.StringPointer("write"),
+			params: &UpdateDocumentParams{
+				ID:      -1,
+				Content: json.RawMessage(`{"foo": "updated"}`),
 			},
 			existingDocuments: []*model.Documents{validDocument},
 			expected: expected{
 				err: &errs.Error{
-					Code:    errs.PermissionDenied,
-					Message: "API key doesn't have the ability to write to the database",
+					Code:    errs.NotFound,
+					Message: "Could not find document",
 				},
 			},
 		},
-	}
-
-	for _, tc := range tcs {
-		t.Run(tc.scenario, func(t *testing.T) {
-			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(tc.userData.ID, 10)), tc.userData)
-			defer test_utils.Cleanup(ctx)
-			defer test_utils_permissions.Cleanup(ctx)
-
-			err := insertDatabases(ctx, []*model.Databases{existingDatabase})
+		{
+			scenario: "Will throw an error when the JSON is not valid",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &UpdateDocumentParams{
+				ID:      validDocument.ID,
+				Content: json.RawMessage("test"),
+			},
+			existingDocuments: []*model.Documents{validDocument},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received JSON string for content was not valid",
+				},
+			},
+		},
+		{
+			scenario: "Will return an error when the key cannot write to the database",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			params: &UpdateDocumentParams{
+				ID:      validDocument.ID,
+				Content: json.RawMessage(`{"foo": "updated"}`),
+			},
+			existingDocuments: []*model.Documents{validDocument},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.PermissionDenied,
+					Message: "API key doesn't have the ability to write to the database",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(tc.userData.ID, 10)), tc.userData)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := insertDatabases(ctx, []*model.Databases{existingDatabase})
 			require.NoError(t, err)
 
 			err = insertCollections(ctx, []*model.Collections{validCollection})
@@ -805,14 +1326,1663 @@ func TestDeleteDocument(t *testing.T) {
 				require.NoError(t, err)
 			}
 
-			response, err := DeleteDocument(ctx, tc.params)
+			response, err := UpdateDocument(ctx, tc.params)
 			if tc.expected.err != nil {
 				test_utils2.CompareErrors(t, tc.expected.err, err)
 				assert.Nil(t, response)
 			} else {
 				require.NoError(t, err)
 				assert.Equal(t, string(tc.expected.response.Document.Content), string(response.Document.Content))
+				assert.Equal(t, tc.expected.response.Document.Version, response.Document.Version)
+				assert.Equal(t, tc.expected.response.Document.Key, response.Document.Key)
+			}
+		})
+	}
+}
+
+func TestPatchDocument(t *testing.T) {
+	now := time.Now()
+
+	type expected struct {
+		response *PatchDocumentResponse
+		err      error
+	}
+
+	existingDatabase := &model.Databases{
+		ID:        1,
+		Name:      "test",
+		UserID:    1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	validCollection := &model.Collections{
+		ID:         2,
+		DatabaseID: existingDatabase.ID,
+		Name:       "test",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	validDocument := &model.Documents{
+		ID:           2,
+		CollectionID: validCollection.ID,
+		Content:      `{"foo": "bar", "tags": ["a"]}`,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	tcs := []struct {
+		scenario          string
+		userData          *identity.UserData
+		userCan           *string
+		existingDocuments []*model.Documents
+		params            *PatchDocumentParams
+		expected          expected
+	}{
+		{
+			scenario: "Will apply a JSON patch and return the patched document",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &PatchDocumentParams{
+				ID:        validDocument.ID,
+				JSONPatch: json.RawMessage(`[{"op": "test", "path": "/foo", "value": "bar"}, {"op": "replace", "path": "/foo", "value": "patched"}, {"op": "add", "path": "/tags/-", "value": "b"}]`),
+			},
+			existingDocuments: []*model.Documents{validDocument},
+			expected: expected{
+				response: &PatchDocumentResponse{
+					Document: convert.DocumentPayload{
+						ID:      validDocument.ID,
+						Content: json.RawMessage(`"{\"foo\": \"patched\", \"tags\": [\"a\", \"b\"]}"`),
+						Version: 2,
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will apply a merge patch and return the patched document",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &PatchDocumentParams{
+				ID:         validDocument.ID,
+				MergePatch: json.RawMessage(`{"tags": null, "bar": {"baz": 1}}`),
+			},
+			existingDocuments: []*model.Documents{validDocument},
+			expected: expected{
+				response: &PatchDocumentResponse{
+					Document: convert.DocumentPayload{
+						ID:      validDocument.ID,
+						Content: json.RawMessage(`"{\"bar\": {\"baz\": 1}, \"foo\": \"bar\"}"`),
+						Version: 2,
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will apply update operators and return the updated document",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &PatchDocumentParams{
+				ID:     validDocument.ID,
+				Update: json.RawMessage(`{"$inc": {"views": 2}, "$addToSet": {"tags": {"$each": ["a", "b"]}}, "$rename": {"foo": "bar"}}`),
+			},
+			existingDocuments: []*model.Documents{validDocument},
+			expected: expected{
+				response: &PatchDocumentResponse{
+					Document: convert.DocumentPayload{
+						ID:      validDocument.ID,
+						Content: json.RawMessage(`"{\"bar\": \"bar\", \"tags\": [\"a\", \"b\"], \"views\": 2}"`),
+						Version: 2,
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when an update operator does not apply to the value at its path",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &PatchDocumentParams{
+				ID:     validDocument.ID,
+				Update: json.RawMessage(`{"$inc": {"foo": 1}}`),
+			},
+			existingDocuments: []*model.Documents{validDocument},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received update was not valid, invalid clause at `/$inc/foo`: expected a number at `foo`, found a string",
+					Details: &query.Error{
+						Pointer: "/$inc/foo",
+						Reason:  "expected a number at `foo`, found a string",
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when a test operation fails",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &PatchDocumentParams{
+				ID:        validDocument.ID,
+				JSONPatch: json.RawMessage(`[{"op": "test", "path": "/foo", "value": "baz"}, {"op": "remove", "path": "/foo"}]`),
+			},
+			existingDocuments: []*model.Documents{validDocument},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.FailedPrecondition,
+					Message: "Patch could not be applied to the document, a path does not exist or a test failed",
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when the version does not match",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &PatchDocumentParams{
+				ID:         validDocument.ID,
+				MergePatch: json.RawMessage(`{"foo": "patched"}`),
+				IfVersion:  test_utils.Int64Pointer(2),
+			},
+			existingDocuments: []*model.Documents{validDocument},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.FailedPrecondition,
+					Message: "Document was modified, its current version is 1",
+					Details: &internal.VersionMismatch{
+						CurrentVersion: 1,
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when the document does not exists",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &PatchDocumentParams{
+				ID:         -1,
+				MergePatch: json.RawMessage(`{"foo": "patched"}`),
+			},
+			existingDocuments: []*model.Documents{validDocument},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.NotFound,
+					Message: "Could not find document",
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when both patch formats are given",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &PatchDocumentParams{
+				ID:         validDocument.ID,
+				JSONPatch:  json.RawMessage(`[{"op": "remove", "path": "/foo"}]`),
+				MergePatch: json.RawMessage(`{"foo": "patched"}`),
+			},
+			existingDocuments: []*model.Documents{validDocument},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received patch was not valid, exactly one of a JSON patch, a merge patch or an update must be given",
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when the JSON patch is not valid",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &PatchDocumentParams{
+				ID:        validDocument.ID,
+				JSONPatch: json.RawMessage(`[{"op": "remove", "path": "foo"}]`),
+			},
+			existingDocuments: []*model.Documents{validDocument},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received JSON patch was not valid, invalid clause at `/0/path`: pointer `foo` must start with `/`",
+					Details: &query.Error{
+						Pointer: "/0/path",
+						Reason:  "pointer `foo` must start with `/`",
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will return an error when the key cannot write to the database",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			params: &PatchDocumentParams{
+				ID:         validDocument.ID,
+				MergePatch: json.RawMessage(`{"foo": "patched"}`),
+			},
+			existingDocuments: []*model.Documents{validDocument},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.PermissionDenied,
+					Message: "API key doesn't have the ability to write to the database",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(tc.userData.ID, 10)), tc.userData)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := insertDatabases(ctx, []*model.Databases{existingDatabase})
+			require.NoError(t, err)
+
+			err = insertCollections(ctx, []*model.Collections{validCollection})
+			require.NoError(t, err)
+
+			err = insertDocuments(ctx, tc.existingDocuments)
+			require.NoError(t, err)
+
+			if tc.userCan != nil {
+				_, err := permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+					KeyID:      1,
+					DatabaseID: &existingDatabase.ID,
+					UserID:     1,
+					Role:       *tc.userCan,
+				})
+				require.NoError(t, err)
+			}
+
+			response, err := PatchDocument(ctx, tc.params)
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, string(tc.expected.response.Document.Content), string(response.Document.Content))
+				assert.Equal(t, tc.expected.response.Document.Version, response.Document.Version)
+			}
+		})
+	}
+}
+
+func TestDeleteDocument(t *testing.T) {
+	now := time.Now()
+
+	type expected struct {
+		response *DeleteDocumentResponse
+		err      error
+	}
+
+	existingDatabase := &model.Databases{
+		ID:        1,
+		Name:      "test",
+		UserID:    1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	validCollection := &model.Collections{
+		ID:         2,
+		DatabaseID: existingDatabase.ID,
+		Name:       "test",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	validDocument := &model.Documents{
+		ID:           2,
+		CollectionID: validCollection.ID,
+		Content:      `{"foo": "bar"}`,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	keyedDocument := &model.Documents{
+		ID:           3,
+		CollectionID: validCollection.ID,
+		Key:          test_utils.StringPointer("settings/user-42"),
+		Content:      `{"foo": "bar"}`,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	tcs := []struct {
+		scenario          string
+		userData          *identity.UserData
+		userCan           *string
+		existingDocuments []*model.Documents
+		params            *DeleteDocumentParams
+		expected          expected
+	}{
+		{
+			scenario: "Will delete an existing document and return its data",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &DeleteDocumentParams{
+				ID: validDocument.ID,
+			},
+			existingDocuments: []*model.Documents{validDocument},
+			expected: expected{
+				response: &DeleteDocumentResponse{
+					Document: convert.DocumentPayload{
+						ID:      validDocument.ID,
+						Content: json.RawMessage(`"{\"foo\": \"bar\"}"`),
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will delete a document by key",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &DeleteDocumentParams{
+				CollectionID: validCollection.ID,
+				Key:          "settings/user-42",
+			},
+			existingDocuments: []*model.Documents{validDocument, keyedDocument},
+			expected: expected{
+				response: &DeleteDocumentResponse{
+					Document: convert.DocumentPayload{
+						ID:      keyedDocument.ID,
+						Key:     "settings/user-42",
+						Content: json.RawMessage(`"{\"foo\": \"bar\"}"`),
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when the version does not match",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &DeleteDocumentParams{
+				ID:        validDocument.ID,
+				IfVersion: test_utils.Int64Pointer(2),
+			},
+			existingDocuments: []*model.Documents{validDocument},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.FailedPrecondition,
+					Message: "Document was modified, its current version is 1",
+					Details: &internal.VersionMismatch{
+						CurrentVersion: 1,
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when the document does not exists",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &DeleteDocumentParams{
+				ID: -1,
+			},
+			existingDocuments: []*model.Documents{validDocument},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.NotFound,
+					Message: "Could not find document",
+				},
+			},
+		},
+		{
+			scenario: "Will fail when the key cannot write to the database",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			params: &DeleteDocumentParams{
+				ID: validDocument.ID,
+			},
+			existingDocuments: []*model.Documents{validDocument},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.PermissionDenied,
+					Message: "API key doesn't have the ability to write to the database",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(tc.userData.ID, 10)), tc.userData)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := insertDatabases(ctx, []*model.Databases{existingDatabase})
+			require.NoError(t, err)
+
+			err = insertCollections(ctx, []*model.Collections{validCollection})
+			require.NoError(t, err)
+
+			err = insertDocuments(ctx, tc.existingDocuments)
+			require.NoError(t, err)
+
+			if tc.userCan != nil {
+				_, err := permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+					KeyID:      1,
+					DatabaseID: &existingDatabase.ID,
+					UserID:     1,
+					Role:       *tc.userCan,
+				})
+				require.NoError(t, err)
+			}
+
+			response, err := DeleteDocument(ctx, tc.params)
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, string(tc.expected.response.Document.Content), string(response.Document.Content))
+				assert.Equal(t, tc.expected.response.Document.Key, response.Document.Key)
+			}
+		})
+	}
+}
+
+func TestUpsertDocument(t *testing.T) {
+	now := time.Now()
+
+	type expected struct {
+		created   bool
+		document  convert.DocumentPayload
+		documents []convert.DocumentPayload
+		err       error
+	}
+
+	existingDatabase := &model.Databases{
+		ID:        1,
+		Name:      "test",
+		UserID:    1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	// IDs are kept away from the sequences, documents created by an upsert take their ID from them
+	existingCollection := &model.Collections{
+		ID:         1000001,
+		DatabaseID: existingDatabase.ID,
+		Name:       "test",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	existingDocuments := []*model.Documents{
+		{
+			ID:           1000002,
+			CollectionID: existingCollection.ID,
+			Content:      `{"name": "foo", "email": "foo@bar.com"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ID:           1000003,
+			CollectionID: existingCollection.ID,
+			Content:      `{"name": "bar", "email": "bar@foo.com"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+	}
+
+	tcs := []struct {
+		scenario string
+		params   *UpsertDocumentParams
+		expected expected
+	}{
+		{
+			scenario: "Will create a document when none matches",
+			params: &UpsertDocumentParams{
+				CollectionID: existingCollection.ID,
+				Match:        json.RawMessage(`{"email": "baz@bar.com"}`),
+				Content:      json.RawMessage(`{"name": "baz", "email": "baz@bar.com"}`),
+			},
+			expected: expected{
+				created: true,
+				document: convert.DocumentPayload{
+					Content: json.RawMessage(`"{\"name\": \"baz\", \"email\": \"baz@bar.com\"}"`),
+					Version: 1,
+				},
+				documents: []convert.DocumentPayload{
+					{Content: json.RawMessage(`"{\"name\": \"foo\", \"email\": \"foo@bar.com\"}"`)},
+					{Content: json.RawMessage(`"{\"name\": \"bar\", \"email\": \"bar@foo.com\"}"`)},
+					{Content: json.RawMessage(`"{\"name\": \"baz\", \"email\": \"baz@bar.com\"}"`)},
+				},
+			},
+		},
+		{
+			scenario: "Will replace the matching document",
+			params: &UpsertDocumentParams{
+				CollectionID: existingCollection.ID,
+				Match:        json.RawMessage(`{"email": "foo@bar.com"}`),
+				Content:      json.RawMessage(`{"email": "foo@bar.com"}`),
+			},
+			expected: expected{
+				document: convert.DocumentPayload{
+					ID:      existingDocuments[0].ID,
+					Content: json.RawMessage(`"{\"email\": \"foo@bar.com\"}"`),
+					Version: 2,
+				},
+				documents: []convert.DocumentPayload{
+					{Content: json.RawMessage(`"{\"email\": \"foo@bar.com\"}"`)},
+					{Content: json.RawMessage(`"{\"name\": \"bar\", \"email\": \"bar@foo.com\"}"`)},
+				},
+			},
+		},
+		{
+			scenario: "Will merge the content into the matching document",
+			params: &UpsertDocumentParams{
+				CollectionID: existingCollection.ID,
+				Match:        json.RawMessage(`{"email": "foo@bar.com"}`),
+				Content:      json.RawMessage(`{"name": "baz"}`),
+				Merge:        true,
+			},
+			expected: expected{
+				document: convert.DocumentPayload{
+					ID:      existingDocuments[0].ID,
+					Content: json.RawMessage(`"{\"name\": \"baz\", \"email\": \"foo@bar.com\"}"`),
+					Version: 2,
+				},
+				documents: []convert.DocumentPayload{
+					{Content: json.RawMessage(`"{\"name\": \"baz\", \"email\": \"foo@bar.com\"}"`)},
+					{Content: json.RawMessage(`"{\"name\": \"bar\", \"email\": \"bar@foo.com\"}"`)},
+				},
+			},
+		},
+		{
+			scenario: "Will apply update operators to the content of a created document",
+			params: &UpsertDocumentParams{
+				CollectionID: existingCollection.ID,
+				Match:        json.RawMessage(`{"email": "baz@bar.com"}`),
+				Content:      json.RawMessage(`{"email": "baz@bar.com"}`),
+				Update:       json.RawMessage(`{"$inc": {"visits": 1}, "$setOnInsert": {"name": "baz"}}`),
+			},
+			expected: expected{
+				created: true,
+				document: convert.DocumentPayload{
+					Content: json.RawMessage(`"{\"name\": \"baz\", \"email\": \"baz@bar.com\", \"visits\": 1}"`),
+					Version: 1,
+				},
+				documents: []convert.DocumentPayload{
+					{Content: json.RawMessage(`"{\"name\": \"foo\", \"email\": \"foo@bar.com\"}"`)},
+					{Content: json.RawMessage(`"{\"name\": \"bar\", \"email\": \"bar@foo.com\"}"`)},
+					{Content: json.RawMessage(`"{\"name\": \"baz\", \"email\": \"baz@bar.com\", \"visits\": 1}"`)},
+				},
+			},
+		},
+		{
+			scenario: "Will apply update operators to the matching document",
+			params: &UpsertDocumentParams{
+				CollectionID: existingCollection.ID,
+				Match:        json.RawMessage(`{"email": "foo@bar.com"}`),
+				Update:       json.RawMessage(`{"$inc": {"visits": 1}, "$setOnInsert": {"name": "baz"}}`),
+			},
+			expected: expected{
+				document: convert.DocumentPayload{
+					ID:      existingDocuments[0].ID,
+					Content: json.RawMessage(`"{\"name\": \"foo\", \"email\": \"foo@bar.com\", \"visits\": 1}"`),
+					Version: 2,
+				},
+				documents: []convert.DocumentPayload{
+					{Content: json.RawMessage(`"{\"name\": \"foo\", \"email\": \"foo@bar.com\", \"visits\": 1}"`)},
+					{Content: json.RawMessage(`"{\"name\": \"bar\", \"email\": \"bar@foo.com\"}"`)},
+				},
+			},
+		},
+		{
+			scenario: "Will set the values of the match expression on a document created with update operators",
+			params: &UpsertDocumentParams{
+				CollectionID: existingCollection.ID,
+				Match:        json.RawMessage(`{"email": {"$eq": "baz@bar.com"}}`),
+				Update:       json.RawMessage(`{"$inc": {"visits": 1}}`),
+			},
+			expected: expected{
+				created: true,
+				document: convert.DocumentPayload{
+					Content: json.RawMessage(`"{\"email\": \"baz@bar.com\", \"visits\": 1}"`),
+					Version: 1,
+				},
+				documents: []convert.DocumentPayload{
+					{Content: json.RawMessage(`"{\"name\": \"foo\", \"email\": \"foo@bar.com\"}"`)},
+					{Content: json.RawMessage(`"{\"name\": \"bar\", \"email\": \"bar@foo.com\"}"`)},
+					{Content: json.RawMessage(`"{\"email\": \"baz@bar.com\", \"visits\": 1}"`)},
+				},
+			},
+		},
+		{
+			scenario: "Will set the values of the match expression on a document created by a merge",
+			params: &UpsertDocumentParams{
+				CollectionID: existingCollection.ID,
+				Match:        json.RawMessage(`{"email": "baz@bar.com"}`),
+				Content:      json.RawMessage(`{"name": "baz"}`),
+				Merge:        true,
+			},
+			expected: expected{
+				created: true,
+				document: convert.DocumentPayload{
+					Content: json.RawMessage(`"{\"name\": \"baz\", \"email\": \"baz@bar.com\"}"`),
+					Version: 1,
+				},
+				documents: []convert.DocumentPayload{
+					{Content: json.RawMessage(`"{\"name\": \"foo\", \"email\": \"foo@bar.com\"}"`)},
+					{Content: json.RawMessage(`"{\"name\": \"bar\", \"email\": \"bar@foo.com\"}"`)},
+					{Content: json.RawMessage(`"{\"name\": \"baz\", \"email\": \"baz@bar.com\"}"`)},
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when the created document would not match the match expression",
+			params: &UpsertDocumentParams{
+				CollectionID: existingCollection.ID,
+				Match:        json.RawMessage(`{"email": "baz@bar.com"}`),
+				Content:      json.RawMessage(`{"name": "baz", "email": "qux@bar.com"}`),
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received content was not valid, the created document would not match the match expression",
+				},
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+		{
+			scenario: "Will throw an error when several documents match",
+			params: &UpsertDocumentParams{
+				CollectionID: existingCollection.ID,
+				Match:        json.RawMessage(`{"email": {"$exists": true}}`),
+				Content:      json.RawMessage(`{"name": "baz"}`),
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.FailedPrecondition,
+					Message: "Could not upsert document, the match expression matched several documents",
+					Details: &internal.AmbiguousMatch{
+						DocumentIDs: []int64{existingDocuments[0].ID, existingDocuments[1].ID},
+					},
+				},
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+		{
+			scenario: "Will throw an error when no match expression is given",
+			params: &UpsertDocumentParams{
+				CollectionID: existingCollection.ID,
+				Content:      json.RawMessage(`{"name": "baz"}`),
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received match was not valid, a match expression must be given",
+				},
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+		{
+			scenario: "Will throw an error when the match expression is not valid",
+			params: &UpsertDocumentParams{
+				CollectionID: existingCollection.ID,
+				Match:        json.RawMessage(`{"email": {"$like": "foo"}}`),
+				Content:      json.RawMessage(`{"name": "baz"}`),
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received match was not valid, invalid clause at `/email/$like`: unknown operator `$like`",
+					Details: &query.Error{Pointer: "/email/$like", Reason: "unknown operator `$like`"},
+				},
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			userData := &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			}
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(userData.ID, 10)), userData)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := insertDatabases(ctx, []*model.Databases{existingDatabase})
+			require.NoError(t, err)
+
+			err = insertCollections(ctx, []*model.Collections{existingCollection})
+			require.NoError(t, err)
+
+			err = insertDocuments(ctx, existingDocuments)
+			require.NoError(t, err)
+
+			_, err = permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+				KeyID:      1,
+				DatabaseID: &existingDatabase.ID,
+				UserID:     1,
+				Role:       "write",
+			})
+			require.NoError(t, err)
+
+			response, err := UpsertDocument(ctx, tc.params)
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected.created, response.Created)
+				assert.Equal(t, string(tc.expected.document.Content), string(response.Document.Content))
+				assert.Equal(t, tc.expected.document.Version, response.Document.Version)
+				if tc.expected.document.ID != 0 {
+					assert.Equal(t, tc.expected.document.ID, response.Document.ID)
+				}
+			}
+
+			documents, err := ListDocuments(ctx, &ListDocumentsParams{CollectionID: existingCollection.ID})
+			require.NoError(t, err)
+			compareDocumentContents(t, tc.expected.documents, documents.Documents)
+		})
+	}
+}
+
+func TestUpsertDocumentConcurrently(t *testing.T) {
+	now := time.Now()
+
+	userData := &identity.UserData{
+		ID:    1,
+		KeyID: 1,
+	}
+	ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(userData.ID, 10)), userData)
+	defer test_utils.Cleanup(ctx)
+	defer test_utils_permissions.Cleanup(ctx)
+
+	existingDatabase := &model.Databases{
+		ID:        1,
+		Name:      "test",
+		UserID:    1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	existingCollection := &model.Collections{
+		ID:         1000001,
+		DatabaseID: existingDatabase.ID,
+		Name:       "test",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	err := insertDatabases(ctx, []*model.Databases{existingDatabase})
+	require.NoError(t, err)
+
+	err = insertCollections(ctx, []*model.Collections{existingCollection})
+	require.NoError(t, err)
+
+	_, err = permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+		KeyID:      1,
+		DatabaseID: &existingDatabase.ID,
+		UserID:     1,
+		Role:       "write",
+	})
+	require.NoError(t, err)
+
+	// The same match expression written with its keys in different orders or with operators takes the same lock
+	matches := []string{
+		`{"name": "foo", "email": "foo@bar.com"}`,
+		`{"email": "foo@bar.com", "name": "foo"}`,
+		`{"email": {"$eq": "foo@bar.com"}, "$and": [{"name": "foo"}]}`,
+	}
+
+	var wg sync.WaitGroup
+	results := make([]error, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, results[i] = UpsertDocument(ctx, &UpsertDocumentParams{
+				CollectionID: existingCollection.ID,
+				Match:        json.RawMessage(matches[i%len(matches)]),
+				Content:      json.RawMessage(`{"name": "foo", "email": "foo@bar.com"}`),
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range results {
+		require.NoError(t, err)
+	}
+
+	documents, err := ListDocuments(ctx, &ListDocumentsParams{CollectionID: existingCollection.ID})
+	require.NoError(t, err)
+	assert.Len(t, documents.Documents, 1)
+}
+
+func TestUpdateDocuments(t *testing.T) {
+	now := time.Now()
+
+	type expected struct {
+		count     int64
+		ids       []int64
+		documents []convert.DocumentPayload
+		err       error
+	}
+
+	existingDatabase := &model.Databases{
+		ID:        1,
+		Name:      "test",
+		UserID:    1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	existingCollection := &model.Collections{
+		ID:         2,
+		DatabaseID: existingDatabase.ID,
+		Name:       "test",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	schema := `{"type": "object", "properties": {"views": {"type": "number"}}}`
+	schemaCollection := &model.Collections{
+		ID:         3,
+		DatabaseID: existingDatabase.ID,
+		Name:       "schema",
+		Schema:     &schema,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	schemaDocument := &model.Documents{
+		ID:           6,
+		CollectionID: schemaCollection.ID,
+		Content:      `{"views": 1}`,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	existingDocuments := []*model.Documents{
+		{
+			ID:           3,
+			CollectionID: existingCollection.ID,
+			Content:      `{"views": 1, "status": "draft"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ID:           4,
+			CollectionID: existingCollection.ID,
+			Content:      `{"views": "3", "status": "draft"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ID:           5,
+			CollectionID: existingCollection.ID,
+			Content:      `{"views": 2, "status": "published"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+	}
+
+	tcs := []struct {
+		scenario string
+		params   *UpdateDocumentsParams
+		expected expected
+	}{
+		{
+			scenario: "Will update the matching documents",
+			params: &UpdateDocumentsParams{
+				CollectionID: existingCollection.ID,
+				Filter:       json.RawMessage(`{"status": "draft"}`),
+				Update:       json.RawMessage(`{"$set": {"status": "published"}}`),
+			},
+			expected: expected{
+				count: 2,
+				ids:   []int64{existingDocuments[0].ID, existingDocuments[1].ID},
+				documents: []convert.DocumentPayload{
+					{Content: json.RawMessage(`"{\"views\": 1, \"status\": \"published\"}"`)},
+					{Content: json.RawMessage(`"{\"views\": \"3\", \"status\": \"published\"}"`)},
+					{Content: json.RawMessage(`"{\"views\": 2, \"status\": \"published\"}"`)},
+				},
+			},
+		},
+		{
+			scenario: "Will only count the matching documents on a dry run",
+			params: &UpdateDocumentsParams{
+				CollectionID: existingCollection.ID,
+				Filter:       json.RawMessage(`{}`),
+				MergePatch:   json.RawMessage(`{"archived": true}`),
+				DryRun:       true,
+			},
+			expected: expected{
+				count:     3,
+				ids:       []int64{existingDocuments[0].ID, existingDocuments[1].ID, existingDocuments[2].ID},
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+		{
+			scenario: "Will not update any document when the patch does not apply to one of them",
+			params: &UpdateDocumentsParams{
+				CollectionID: existingCollection.ID,
+				Filter:       json.RawMessage(`{"status": "draft"}`),
+				Update:       json.RawMessage(`{"$inc": {"views": 1}}`),
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Document 4 could not be updated: Received update was not valid, invalid clause at `/$inc/views`: expected a number at `views`, found a string",
+					Details: &internal.BulkDocumentFailure{
+						DocumentID: existingDocuments[1].ID,
+						Details: &query.Error{
+							Pointer: "/$inc/views",
+							Reason:  "expected a number at `views`, found a string",
+						},
+					},
+				},
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+		{
+			scenario: "Will update the matching documents matching the schema of the collection once patched",
+			params: &UpdateDocumentsParams{
+				CollectionID: schemaCollection.ID,
+				Filter:       json.RawMessage(`{}`),
+				MergePatch:   json.RawMessage(`{"views": 5}`),
+			},
+			expected: expected{
+				count:     1,
+				ids:       []int64{schemaDocument.ID},
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+		{
+			scenario: "Will not update any document when a patched document does not match the schema of the collection",
+			params: &UpdateDocumentsParams{
+				CollectionID: schemaCollection.ID,
+				Filter:       json.RawMessage(`{}`),
+				MergePatch:   json.RawMessage(`{"views": "many"}`),
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Document 6 could not be updated: Received content does not match the schema of the collection",
+					Details: &internal.BulkDocumentFailure{
+						DocumentID: schemaDocument.ID,
+						Details: &internal.SchemaViolations{
+							Violations: []query.Error{{Pointer: "/views", Reason: "expected a value of type number"}},
+						},
+					},
+				},
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+		{
+			scenario: "Will throw an error when no filter is given",
+			params: &UpdateDocumentsParams{
+				CollectionID: existingCollection.ID,
+				Update:       json.RawMessage(`{"$set": {"status": "published"}}`),
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received filter was not valid, a filter expression must be given, `{}` matches all the documents",
+				},
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+		{
+			scenario: "Will throw an error when several patch formats are given",
+			params: &UpdateDocumentsParams{
+				CollectionID: existingCollection.ID,
+				Filter:       json.RawMessage(`{"status": "draft"}`),
+				MergePatch:   json.RawMessage(`{"status": "published"}`),
+				Update:       json.RawMessage(`{"$set": {"status": "published"}}`),
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received patch was not valid, exactly one of a JSON patch, a merge patch or an update must be given",
+				},
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			userData := &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			}
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(userData.ID, 10)), userData)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := insertDatabases(ctx, []*model.Databases{existingDatabase})
+			require.NoError(t, err)
+
+			err = insertCollections(ctx, []*model.Collections{existingCollection, schemaCollection})
+			require.NoError(t, err)
+
+			err = insertDocuments(ctx, append([]*model.Documents{schemaDocument}, existingDocuments...))
+			require.NoError(t, err)
+
+			_, err = permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+				KeyID:      1,
+				DatabaseID: &existingDatabase.ID,
+				UserID:     1,
+				Role:       "write",
+			})
+			require.NoError(t, err)
+
+			response, err := UpdateDocuments(ctx, tc.params)
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected.count, response.Count)
+				assert.Equal(t, tc.expected.ids, response.DocumentIDs)
+			}
+
+			documents, err := ListDocuments(ctx, &ListDocumentsParams{CollectionID: existingCollection.ID})
+			require.NoError(t, err)
+			compareDocumentContents(t, tc.expected.documents, documents.Documents)
+		})
+	}
+}
+
+func TestDeleteDocuments(t *testing.T) {
+	now := time.Now()
+
+	type expected struct {
+		count     int64
+		ids       []int64
+		documents []convert.DocumentPayload
+		err       error
+	}
+
+	existingDatabase := &model.Databases{
+		ID:        1,
+		Name:      "test",
+		UserID:    1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	existingCollection := &model.Collections{
+		ID:         2,
+		DatabaseID: existingDatabase.ID,
+		Name:       "test",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	existingDocuments := []*model.Documents{
+		{
+			ID:           3,
+			CollectionID: existingCollection.ID,
+			Content:      `{"status": "draft"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ID:           4,
+			CollectionID: existingCollection.ID,
+			Content:      `{"status": "draft"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ID:           5,
+			CollectionID: existingCollection.ID,
+			Content:      `{"status": "published"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+	}
+
+	tcs := []struct {
+		scenario string
+		userCan  *string
+		params   *DeleteDocumentsParams
+		expected expected
+	}{
+		{
+			scenario: "Will delete the matching documents",
+			userCan:  test_utils.StringPointer("write"),
+			params: &DeleteDocumentsParams{
+				CollectionID: existingCollection.ID,
+				Filter:       json.RawMessage(`{"status": "draft"}`),
+			},
+			expected: expected{
+				count:     2,
+				ids:       []int64{existingDocuments[0].ID, existingDocuments[1].ID},
+				documents: convertDocuments(t, existingDocuments[2:]),
+			},
+		},
+		{
+			scenario: "Will delete all the documents with an empty filter",
+			userCan:  test_utils.StringPointer("write"),
+			params: &DeleteDocumentsParams{
+				CollectionID: existingCollection.ID,
+				Filter:       json.RawMessage(`{}`),
+			},
+			expected: expected{
+				count:     3,
+				ids:       []int64{existingDocuments[0].ID, existingDocuments[1].ID, existingDocuments[2].ID},
+				documents: []convert.DocumentPayload{},
+			},
+		},
+		{
+			scenario: "Will only count the matching documents on a dry run",
+			userCan:  test_utils.StringPointer("write"),
+			params: &DeleteDocumentsParams{
+				CollectionID: existingCollection.ID,
+				Filter:       json.RawMessage(`{"status": "draft"}`),
+				DryRun:       true,
+			},
+			expected: expected{
+				count:     2,
+				ids:       []int64{existingDocuments[0].ID, existingDocuments[1].ID},
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+		{
+			scenario: "Will throw an error when the filter is not valid",
+			userCan:  test_utils.StringPointer("write"),
+			params: &DeleteDocumentsParams{
+				CollectionID: existingCollection.ID,
+				Filter:       json.RawMessage(`{"status": {"$like": "draft"}}`),
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received filter was not valid, invalid clause at `/status/$like`: unknown operator `$like`",
+					Details: &query.Error{Pointer: "/status/$like", Reason: "unknown operator `$like`"},
+				},
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+		{
+			scenario: "Will return an error when the key cannot write to the database",
+			userCan:  test_utils.StringPointer("read"),
+			params: &DeleteDocumentsParams{
+				CollectionID: existingCollection.ID,
+				Filter:       json.RawMessage(`{"status": "draft"}`),
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.PermissionDenied,
+					Message: "API key doesn't have the ability to write to the database",
+				},
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			userData := &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			}
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(userData.ID, 10)), userData)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := insertDatabases(ctx, []*model.Databases{existingDatabase})
+			require.NoError(t, err)
+
+			err = insertCollections(ctx, []*model.Collections{existingCollection})
+			require.NoError(t, err)
+
+			err = insertDocuments(ctx, existingDocuments)
+			require.NoError(t, err)
+
+			_, err = permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+				KeyID:      1,
+				DatabaseID: &existingDatabase.ID,
+				UserID:     1,
+				Role:       *tc.userCan,
+			})
+			require.NoError(t, err)
+
+			response, err := DeleteDocuments(ctx, tc.params)
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected.count, response.Count)
+				assert.Equal(t, tc.expected.ids, response.DocumentIDs)
+			}
+
+			documents, err := ListDocuments(ctx, &ListDocumentsParams{CollectionID: existingCollection.ID})
+			require.NoError(t, err)
+			compareDocumentContents(t, tc.expected.documents, documents.Documents)
+		})
+	}
+}
+
+func TestAggregateDocuments(t *testing.T) {
+	now := time.Now()
+
+	type expected struct {
+		groups []string
+		err    error
+	}
+
+	existingDatabase := &model.Databases{
+		ID:        1,
+		Name:      "test",
+		UserID:    1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	existingCollection := &model.Collections{
+		ID:         2,
+		DatabaseID: existingDatabase.ID,
+		Name:       "test",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	existingDocuments := []*model.Documents{
+		{
+			ID:           3,
+			CollectionID: existingCollection.ID,
+			Content:      `{"amount": 10, "status": "paid", "customer": 1}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ID:           4,
+			CollectionID: existingCollection.ID,
+			Content:      `{"amount": 20.5, "status": "paid", "customer": 2}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ID:           5,
+			CollectionID: existingCollection.ID,
+			Content:      `{"amount": 5, "status": "open", "customer": 1}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ID:           6,
+			CollectionID: existingCollection.ID,
+			Content:      `{"status": "open", "customer": 3}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+	}
+
+	tcs := []struct {
+		scenario string
+		params   *AggregateDocumentsParams
+		expected expected
+	}{
+		{
+			scenario: "Will count and sum the documents of each group",
+			params: &AggregateDocumentsParams{
+				CollectionID: existingCollection.ID,
+				GroupBy:      []string{"status"},
+				Accumulators: json.RawMessage(`{"orders": {"$count": {}}, "total": {"$sum": "amount"}}`),
+				SortBy:       "total",
+				Descending:   true,
+			},
+			expected: expected{
+				groups: []string{
+					`{"status": "paid", "orders": 2, "total": 30.5}`,
+					`{"status": "open", "orders": 2, "total": 5}`,
+				},
+			},
+		},
+		{
+			scenario: "Will aggregate the matching documents in a single group",
+			params: &AggregateDocumentsParams{
+				CollectionID: existingCollection.ID,
+				Match:        json.RawMessage(`{"status": "paid"}`),
+				Accumulators: json.RawMessage(`{"average": {"$avg": "amount"}, "lowest": {"$min": "amount"}, "highest": {"$max": "amount"}}`),
+			},
+			expected: expected{
+				groups: []string{
+					`{"average": 15.25, "lowest": 10, "highest": 20.5}`,
+				},
+			},
+		},
+		{
+			scenario: "Will list the distinct values of each group up to the limit",
+			params: &AggregateDocumentsParams{
+				CollectionID: existingCollection.ID,
+				GroupBy:      []string{"status"},
+				Accumulators: json.RawMessage(`{"customers": {"$distinct": "customer"}}`),
+				Limit:        1,
+			},
+			expected: expected{
+				groups: []string{
+					`{"status": "open", "customers": [1, 3]}`,
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when the accumulators are not valid",
+			params: &AggregateDocumentsParams{
+				CollectionID: existingCollection.ID,
+				Accumulators: json.RawMessage(`{"total": {"$product": "amount"}}`),
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received accumulators was not valid, invalid clause at `/total/$product`: unknown accumulator `$product`",
+					Details: &query.Error{Pointer: "/total/$product", Reason: "unknown accumulator `$product`"},
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when sorting by an unknown name",
+			params: &AggregateDocumentsParams{
+				CollectionID: existingCollection.ID,
+				GroupBy:      []string{"status"},
+				SortBy:       "amount",
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received sort was not valid, groups can only be sorted by a path they are grouped by or the name of an accumulator, got `amount`",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			userData := &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			}
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(userData.ID, 10)), userData)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := insertDatabases(ctx, []*model.Databases{existingDatabase})
+			require.NoError(t, err)
+
+			err = insertCollections(ctx, []*model.Collections{existingCollection})
+			require.NoError(t, err)
+
+			err = insertDocuments(ctx, existingDocuments)
+			require.NoError(t, err)
+
+			_, err = permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+				KeyID:      1,
+				DatabaseID: &existingDatabase.ID,
+				UserID:     1,
+				Role:       "read",
+			})
+			require.NoError(t, err)
+
+			response, err := AggregateDocuments(ctx, tc.params)
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, response.Groups, len(tc.expected.groups))
+			for i, group := range tc.expected.groups {
+				assert.JSONEq(t, group, string(response.Groups[i]))
+			}
+		})
+	}
+}
+
+func TestSearchDocuments(t *testing.T) {
+	now := time.Now()
+
+	type expected struct {
+		ids        []int64
+		highlights []string
+		nextCursor bool
+		err        error
+	}
+
+	existingDatabase := &model.Databases{
+		ID:        1,
+		Name:      "test",
+		UserID:    1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	existingCollections := []*model.Collections{
+		{
+			ID:         2,
+			DatabaseID: existingDatabase.ID,
+			Name:       "articles",
+			Search:     test_utils.StringPointer(`{"language": "english", "paths": ["title", "body"]}`),
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		},
+		{
+			ID:         3,
+			DatabaseID: existingDatabase.ID,
+			Name:       "notes",
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		},
+	}
+
+	existingDocuments := []*model.Documents{
+		{
+			ID:           4,
+			CollectionID: existingCollections[0].ID,
+			Content:      `{"title": "Brewing coffee", "body": "Grind the beans right before brewing.", "status": "draft"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ID:           5,
+			CollectionID: existingCollections[0].ID,
+			Content:      `{"title": "Tea time", "body": "Some prefer coffee, but tea brews faster.", "status": "published"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ID:           6,
+			CollectionID: existingCollections[0].ID,
+			Content:      `{"title": "Gardening", "body": "Water the plants in the morning.", "status": "published"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+	}
+
+	tcs := []struct {
+		scenario string
+		params   *SearchDocumentsParams
+		expected expected
+	}{
+		{
+			scenario: "Returns the matching documents by decreasing rank, with highlights",
+			params: &SearchDocumentsParams{
+				CollectionID: existingCollections[0].ID,
+				Text:         "coffee",
+			},
+			expected: expected{
+				ids: []int64{4, 5},
+				highlights: []string{
+					`{"title": "Brewing <b>coffee</b>"}`,
+					`{"body": "Some prefer <b>coffee</b>, but tea brews faster."}`,
+				},
+			},
+		},
+		{
+			scenario: "Matches the stems of the words in the language of the collection",
+			params: &SearchDocumentsParams{
+				CollectionID: existingCollections[0].ID,
+				Text:         "brew",
+			},
+			expected: expected{
+				ids: []int64{4, 5},
+				highlights: []string{
+					`{"title": "<b>Brewing</b> coffee", "body": "Grind the beans right before <b>brewing</b>."}`,
+					`{"body": "Some prefer coffee, but tea <b>brews</b> faster."}`,
+				},
+			},
+		},
+		{
+			scenario: "Leaves out the documents with excluded words",
+			params: &SearchDocumentsParams{
+				CollectionID: existingCollections[0].ID,
+				Text:         "brew -coffee",
+			},
+			expected: expected{
+				ids: []int64{},
+			},
+		},
+		{
+			scenario: "Returns the matching documents also matching the filter",
+			params: &SearchDocumentsParams{
+				CollectionID: existingCollections[0].ID,
+				Text:         "coffee",
+				Filter:       json.RawMessage(`{"status": "published"}`),
+			},
+			expected: expected{
+				ids: []int64{5},
+				highlights: []string{
+					`{"body": "Some prefer <b>coffee</b>, but tea brews faster."}`,
+				},
+			},
+		},
+		{
+			scenario: "Returns a page of the matching documents",
+			params: &SearchDocumentsParams{
+				CollectionID: existingCollections[0].ID,
+				Text:         "coffee or plants",
+				Limit:        1,
+			},
+			expected: expected{
+				ids: []int64{4},
+				highlights: []string{
+					`{"title": "Brewing <b>coffee</b>"}`,
+				},
+				nextCursor: true,
+			},
+		},
+		{
+			scenario: "Throws an error when the text is empty",
+			params: &SearchDocumentsParams{
+				CollectionID: existingCollections[0].ID,
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received text was not valid, invalid clause at `/`: search text cannot be empty",
+					Details: &query.Error{Reason: "search text cannot be empty"},
+				},
+			},
+		},
+		{
+			scenario: "Throws an error when the collection is not searchable",
+			params: &SearchDocumentsParams{
+				CollectionID: existingCollections[1].ID,
+				Text:         "coffee",
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.FailedPrecondition,
+					Message: "Collection is not searchable, it has no search configuration",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			userData := &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			}
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(userData.ID, 10)), userData)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := insertDatabases(ctx, []*model.Databases{existingDatabase})
+			require.NoError(t, err)
+
+			err = insertCollections(ctx, existingCollections)
+			require.NoError(t, err)
+
+			err = insertDocuments(ctx, existingDocuments)
+			require.NoError(t, err)
+
+			_, err = permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+				KeyID:      1,
+				DatabaseID: &existingDatabase.ID,
+				UserID:     1,
+				Role:       "read",
+			})
+			require.NoError(t, err)
+
+			response, err := SearchDocuments(ctx, tc.params)
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+				return
+			}
+
+			require.NoError(t, err)
+			ids := make([]int64, len(response.Results))
+			for i, result := range response.Results {
+				ids[i] = result.Document.ID
+			}
+
+			assert.Equal(t, tc.expected.ids, ids)
+			for i, highlights := range tc.expected.highlights {
+				assert.JSONEq(t, highlights, string(response.Results[i].Highlights))
 			}
+			assert.Equal(t, tc.expected.nextCursor, response.NextCursor != "")
 		})
 	}
 }
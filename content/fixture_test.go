@@ -0,0 +1,89 @@
+package content
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"encore.dev/beta/auth"
+	"github.com/stretchr/testify/require"
+
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/identity"
+	"encore.app/permissions"
+)
+
+// fixture is the data inserted before a test for the user with ID 1, along with the permission set of its
+// API key with ID 1.
+type fixture struct {
+	databases   []*model.Databases
+	collections []*model.Collections
+	documents   []*model.Documents
+	permission  *permissions.AddPermissionSetParams
+}
+
+// articlesFixture is a database with ID 1 holding a collection "articles" with ID 2 and a collection "notes"
+// with ID 3, that the API key can access with the given role.
+func articlesFixture(role string) *fixture {
+	now := time.Now()
+	databaseID := int64(1)
+
+	return &fixture{
+		databases: []*model.Databases{
+			{
+				ID:        databaseID,
+				Name:      "test",
+				UserID:    1,
+				CreatedAt: now,
+				UpdatedAt: now,
+			},
+		},
+		collections: []*model.Collections{
+			{
+				ID:         2,
+				DatabaseID: databaseID,
+				Name:       "articles",
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			},
+			{
+				ID:         3,
+				DatabaseID: databaseID,
+				Name:       "notes",
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			},
+		},
+		permission: &permissions.AddPermissionSetParams{
+			KeyID:      1,
+			DatabaseID: &databaseID,
+			UserID:     1,
+			Role:       role,
+		},
+	}
+}
+
+// fixtureContext inserts the data of a fixture and creates a context for the API key with ID 1 of the user
+// with ID 1.
+func fixtureContext(t *testing.T, f *fixture) context.Context {
+	userData := &identity.UserData{
+		ID:    1,
+		KeyID: 1,
+	}
+	ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(userData.ID, 10)), userData)
+
+	err := insertDatabases(ctx, f.databases)
+	require.NoError(t, err)
+
+	err = insertCollections(ctx, f.collections)
+	require.NoError(t, err)
+
+	err = insertDocuments(ctx, f.documents)
+	require.NoError(t, err)
+
+	_, err = permissions.AddPermissionSet(ctx, f.permission)
+	require.NoError(t, err)
+
+	return ctx
+}
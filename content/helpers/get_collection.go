@@ -30,5 +30,36 @@ func GetCollection(ctx context.Context, collectionID, userID int64) (*model.Coll
 		}
 	}
 
+	err = checkTransactionDatabase(ctx, collection.DatabaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	return collection, nil
+}
+
+// GetCollectionByName gets a collection from its name, the ID of its database and a user ID, and returns
+// a valid encore error if the collection could not be fetched.
+func GetCollectionByName(ctx context.Context, databaseID int64, name string, userID int64) (*model.Collections, error) {
+	collection, err := models.GetCollectionByName(ctx, databaseID, name, userID)
+	if errors.Is(err, qrm.ErrNoRows) {
+		log.WithError(err).Warning("Could not find collection by name")
+		return nil, &errs.Error{
+			Code:    errs.NotFound,
+			Message: "Could not find collection",
+		}
+	} else if err != nil {
+		log.WithError(err).Error("Could not find collection")
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not find collection, unknown error",
+		}
+	}
+
+	err = checkTransactionDatabase(ctx, collection.DatabaseID)
+	if err != nil {
+		return nil, err
+	}
+
 	return collection, nil
 }
@@ -30,5 +30,36 @@ func GetDatabase(ctx context.Context, databaseID, userID int64) (*model.Database
 		}
 	}
 
+	err = checkTransactionDatabase(ctx, database.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return database, nil
+}
+
+// GetDatabaseByName gets a database from its name and a user ID and returns a valid encore error
+// if the database could not be fetched.
+func GetDatabaseByName(ctx context.Context, name string, userID int64) (*model.Databases, error) {
+	database, err := models.GetDatabaseByName(ctx, name, userID)
+	if errors.Is(err, qrm.ErrNoRows) {
+		log.WithError(err).Warning("Could not find database by name")
+		return nil, &errs.Error{
+			Code:    errs.NotFound,
+			Message: "Could not find database",
+		}
+	} else if err != nil {
+		log.WithError(err).Error("Could not find database")
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not find database, unknown error",
+		}
+	}
+
+	err = checkTransactionDatabase(ctx, database.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	return database, nil
 }
@@ -12,12 +12,19 @@ import (
 	"encore.app/content/models/generated/content/public/model"
 )
 
-// GetDocument gets a document from a document ID and a user ID and returns a valid encore error
-// if the document could not be fetched.
-func GetDocument(ctx context.Context, documentID, userID int64) (*model.Documents, error) {
-	document, err := models.GetDocumentByUser(ctx, documentID, userID)
+// GetDocument gets a document from a reference to the document, by ID or by key, and a user ID and
+// returns a valid encore error if the document could not be fetched.
+func GetDocument(ctx context.Context, ref models.DocumentRef, userID int64) (*model.Documents, error) {
+	if ref.Key != "" && (ref.ID != 0 || ref.CollectionID == 0) {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Received document was not valid, a document is identified either by its ID or by its key along with the ID of its collection",
+		}
+	}
+
+	document, err := models.GetDocumentByUser(ctx, ref, userID)
 	if errors.Is(err, qrm.ErrNoRows) {
-		log.WithError(err).Warning("Could not find document by ID")
+		log.WithError(err).Warningf("Could not find document by %s", ref)
 		return nil, &errs.Error{
 			Code:    errs.NotFound,
 			Message: "Could not find document",
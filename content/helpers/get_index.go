@@ -0,0 +1,34 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+
+	"encore.dev/beta/errs"
+	"github.com/go-jet/jet/v2/qrm"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/model"
+)
+
+// GetIndex gets an index from a collection ID and the name of the index, and returns a valid encore
+// error if the index could not be fetched.
+func GetIndex(ctx context.Context, collectionID int64, name string) (*model.CollectionIndexes, error) {
+	index, err := models.GetIndexByName(ctx, collectionID, name)
+	if errors.Is(err, qrm.ErrNoRows) {
+		log.WithError(err).Warning("Could not find index by name")
+		return nil, &errs.Error{
+			Code:    errs.NotFound,
+			Message: "Could not find index",
+		}
+	} else if err != nil {
+		log.WithError(err).Error("Could not find index")
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not find index, unknown error",
+		}
+	}
+
+	return index, nil
+}
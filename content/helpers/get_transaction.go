@@ -0,0 +1,74 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"encore.dev/beta/errs"
+	"encore.dev/types/uuid"
+	"github.com/go-jet/jet/v2/qrm"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/model"
+)
+
+// GetTransaction gets a transaction from a transaction key and a user ID and returns a valid encore error
+// if the transaction could not be fetched or has expired.
+func GetTransaction(ctx context.Context, key uuid.UUID, userID int64) (*model.Transactions, error) {
+	transaction, err := models.GetTransactionByID(ctx, key, userID)
+	if errors.Is(err, qrm.ErrNoRows) {
+		// Expired transactions are deleted by the sweep, their keys are still reported as expired for a while
+		expired, expiredErr := models.IsExpiredTransaction(ctx, key, userID)
+		if expiredErr == nil && expired {
+			log.WithField("transaction_key", key).Warning("Tried to use a swept expired transaction")
+			return nil, expiredTransactionError()
+		}
+
+		log.WithError(err).Warning("Could not find transaction by key")
+		return nil, &errs.Error{
+			Code:    errs.NotFound,
+			Message: "Could not find transaction",
+		}
+	} else if err != nil {
+		log.WithError(err).Error("Could not find transaction")
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not find transaction, unknown error",
+		}
+	}
+
+	if !transaction.ExpiresAt.After(time.Now()) {
+		log.WithField("expires_at", transaction.ExpiresAt).Warning("Tried to use an expired transaction")
+		return nil, expiredTransactionError()
+	}
+
+	return transaction, nil
+}
+
+// expiredTransactionError creates the error returned when using the key of an expired transaction.
+func expiredTransactionError() error {
+	return &errs.Error{
+		Code:    errs.FailedPrecondition,
+		Message: "Transaction has expired, start a new transaction",
+	}
+}
+
+// checkTransactionDatabase validates that the database of the record was fetched for can be used in
+// the transaction of the context, if any. A transaction can only be used on the database it was started on.
+func checkTransactionDatabase(ctx context.Context, databaseID int64) error {
+	transaction := models.TransactionFromContext(ctx)
+	if transaction == nil || transaction.DatabaseID == databaseID {
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"database_id":             databaseID,
+		"transaction_database_id": transaction.DatabaseID,
+	}).Warning("Tried to use a transaction on another database")
+	return &errs.Error{
+		Code:    errs.InvalidArgument,
+		Message: "Transaction was started on another database",
+	}
+}
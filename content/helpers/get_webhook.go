@@ -0,0 +1,34 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+
+	"encore.dev/beta/errs"
+	"github.com/go-jet/jet/v2/qrm"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/model"
+)
+
+// GetWebhook gets a webhook from a webhook ID and a user ID, and returns a valid encore error if the
+// webhook could not be fetched.
+func GetWebhook(ctx context.Context, webhookID, userID int64) (*model.Webhooks, error) {
+	webhook, err := models.GetWebhookByID(ctx, webhookID, userID)
+	if errors.Is(err, qrm.ErrNoRows) {
+		log.WithError(err).Warning("Could not find webhook by ID")
+		return nil, &errs.Error{
+			Code:    errs.NotFound,
+			Message: "Could not find webhook",
+		}
+	} else if err != nil {
+		log.WithError(err).Error("Could not find webhook")
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not find webhook, unknown error",
+		}
+	}
+
+	return webhook, nil
+}
@@ -0,0 +1,121 @@
+package content
+
+import (
+	"context"
+
+	"encore.app/content/convert"
+	"encore.app/content/internal"
+)
+
+// ListIndexesParams is the parameters for listing the indexes of a collection
+type ListIndexesParams struct {
+	// The unique identifier of the collection
+	CollectionID int64
+}
+
+// ListIndexesResponse is the list of indexes of the given collection
+type ListIndexesResponse struct {
+	// The indexes of the collection, sorted by name
+	Indexes []convert.IndexPayload
+}
+
+// ListIndexes lists the indexes of a collection along with their build status
+//encore:api auth
+func ListIndexes(ctx context.Context, params *ListIndexesParams) (*ListIndexesResponse, error) {
+	indexes, err := internal.ListIndexes(ctx, params.CollectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListIndexesResponse{
+		Indexes: indexes,
+	}, nil
+}
+
+// CreateIndexParams is the parameters for creating an index on the documents of a collection
+type CreateIndexParams struct {
+	// The unique identifier of the collection
+	CollectionID int64
+
+	// The name of the index, unique in the collection
+	Name string
+
+	// The paths of the content to index, like `address.city`. Giving several paths creates a compound
+	// index, used by filters on the first paths of the index. An index has at most 8 paths
+	Paths []string
+
+	// Whether two documents of the collection cannot have the same values at the paths of the index.
+	// Writes giving a document the same values as another one are rejected, naming the other document.
+	// Documents missing one of the paths are not constrained. A unique index cannot be created while
+	// documents of the collection have the same values, they are reported instead
+	Unique bool
+
+	// The method of the index, either `btree` or `gin`. Defaults to `btree`, which serves filters
+	// comparing the values at the paths. A `gin` index serves containment lookups on the objects and
+	// arrays at its path, it cannot be unique or have several paths
+	Method string
+}
+
+// CreateIndexResponse is the result of creating an index
+type CreateIndexResponse struct {
+	// A message to inform the user of the result of the operation
+	Message string
+
+	// The created index
+	Index convert.IndexPayload
+}
+
+// CreateIndex creates an index on paths of the content of the documents of a collection. Indexes of
+// collections with many documents are built in the background, their status tells when they are ready.
+//encore:api auth
+func CreateIndex(ctx context.Context, params *CreateIndexParams) (*CreateIndexResponse, error) {
+	index, err := internal.CreateIndex(ctx, params.CollectionID, params.Name, params.Paths, params.Unique, params.Method)
+	if err != nil {
+		return nil, err
+	}
+
+	message := "Index created successfully."
+	switch index.Status {
+	case "building":
+		message = "Index created, it is building."
+	case "failed":
+		message = "Index created, but it could not be built."
+	}
+
+	return &CreateIndexResponse{
+		Message: message,
+		Index:   index,
+	}, nil
+}
+
+// DropIndexParams is the parameters for dropping an index of a collection
+type DropIndexParams struct {
+	// The unique identifier of the collection
+	CollectionID int64
+
+	// The name of the index to drop
+	Name string
+}
+
+// DropIndexResponse is the result of dropping an index
+type DropIndexResponse struct {
+	// A message to inform the user of the result of the operation
+	Message string
+
+	// The dropped index
+	Index convert.IndexPayload
+}
+
+// DropIndex drops an index of a collection by name. An index cannot be dropped while it is building
+//encore:api auth
+func DropIndex(ctx context.Context, params *DropIndexParams) (*DropIndexResponse, error) {
+	index, err := internal.DropIndex(ctx, params.CollectionID, params.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DropIndexResponse{
+		Message: "Index dropped successfully.",
+		Index:   index,
+	}, nil
+}
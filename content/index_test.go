@@ -0,0 +1,845 @@
+package content
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+	"encore.dev/types/uuid"
+	"github.com/go-jet/jet/v2/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"encore.app/content/convert"
+	"encore.app/content/internal"
+	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/models/generated/content/public/table"
+	"encore.app/content/test_utils"
+	"encore.app/identity"
+	"encore.app/permissions"
+	test_utils_permissions "encore.app/permissions/test_utils"
+	test_utils2 "encore.app/test_utils"
+)
+
+func TestCreateIndex(t *testing.T) {
+	now := time.Now()
+
+	type expected struct {
+		index *convert.IndexPayload
+		err   error
+	}
+
+	existingDatabase := &model.Databases{
+		ID:        1,
+		Name:      "test",
+		UserID:    1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	existingCollection := &model.Collections{
+		ID:         2,
+		DatabaseID: existingDatabase.ID,
+		Name:       "test",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	existingDocuments := []*model.Documents{
+		{
+			ID:           3,
+			CollectionID: existingCollection.ID,
+			Content:      `{"email": "foo@bar.com", "address": {"city": "Paris"}}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ID:           4,
+			CollectionID: existingCollection.ID,
+			Content:      `{"email": "foo@bar.com", "address": {"city": "Lyon"}}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+	}
+
+	tcs := []struct {
+		scenario        string
+		userCan         string
+		existingIndexes []*CreateIndexParams
+		params          *CreateIndexParams
+		expected        expected
+	}{
+		{
+			scenario: "Will create and build an index",
+			userCan:  "write",
+			params: &CreateIndexParams{
+				CollectionID: existingCollection.ID,
+				Name:         "email",
+				Paths:        []string{"email"},
+			},
+			expected: expected{
+				index: &convert.IndexPayload{
+					Name:         "email",
+					CollectionID: existingCollection.ID,
+					Paths:        []string{"email"},
+					Method:       "btree",
+					Status:       "ready",
+				},
+			},
+		},
+		{
+			scenario: "Will create a unique compound index",
+			userCan:  "write",
+			params: &CreateIndexParams{
+				CollectionID: existingCollection.ID,
+				Name:         "email_city",
+				Paths:        []string{"email", "address.city"},
+				Unique:       true,
+			},
+			expected: expected{
+				index: &convert.IndexPayload{
+					Name:         "email_city",
+					CollectionID: existingCollection.ID,
+					Paths:        []string{"email", "address.city"},
+					Unique:       true,
+					Method:       "btree",
+					Status:       "ready",
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error with a report when documents have the same values for a unique index",
+			userCan:  "write",
+			params: &CreateIndexParams{
+				CollectionID: existingCollection.ID,
+				Name:         "email",
+				Paths:        []string{"email"},
+				Unique:       true,
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.FailedPrecondition,
+					Message: "Could not create the unique index, documents of the collection have the same values at its paths",
+					Details: &internal.UniqueDuplicates{
+						Duplicates: []models.DuplicateDocuments{
+							{
+								Values:      json.RawMessage(`["foo@bar.com"]`),
+								DocumentIDs: []int64{existingDocuments[0].ID, existingDocuments[1].ID},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will create a gin index",
+			userCan:  "write",
+			params: &CreateIndexParams{
+				CollectionID: existingCollection.ID,
+				Name:         "address",
+				Paths:        []string{"address"},
+				Method:       "gin",
+			},
+			expected: expected{
+				index: &convert.IndexPayload{
+					Name:         "address",
+					CollectionID: existingCollection.ID,
+					Paths:        []string{"address"},
+					Method:       "gin",
+					Status:       "ready",
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when an index with this name already exists",
+			userCan:  "write",
+			existingIndexes: []*CreateIndexParams{
+				{
+					CollectionID: existingCollection.ID,
+					Name:         "email",
+					Paths:        []string{"email"},
+				},
+			},
+			params: &CreateIndexParams{
+				CollectionID: existingCollection.ID,
+				Name:         "email",
+				Paths:        []string{"address.city"},
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.AlreadyExists,
+					Message: "An index with name `email` already exists in this collection",
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when a path is not valid",
+			userCan:  "write",
+			params: &CreateIndexParams{
+				CollectionID: existingCollection.ID,
+				Name:         "email",
+				Paths:        []string{"address..city"},
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received paths were not valid, path `address..city` contains an empty segment",
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when no path is given",
+			userCan:  "write",
+			params: &CreateIndexParams{
+				CollectionID: existingCollection.ID,
+				Name:         "email",
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received paths were not valid, an index must have between 1 and 8 paths",
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when a gin index is unique",
+			userCan:  "write",
+			params: &CreateIndexParams{
+				CollectionID: existingCollection.ID,
+				Name:         "address",
+				Paths:        []string{"address"},
+				Unique:       true,
+				Method:       "gin",
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received method `gin` was not valid, a gin index cannot be unique or have several paths",
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when the method is not valid",
+			userCan:  "write",
+			params: &CreateIndexParams{
+				CollectionID: existingCollection.ID,
+				Name:         "email",
+				Paths:        []string{"email"},
+				Method:       "hash",
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Received method `hash` was not valid, must be one of btree or gin",
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when the key cannot write to the database",
+			userCan:  "read",
+			params: &CreateIndexParams{
+				CollectionID: existingCollection.ID,
+				Name:         "email",
+				Paths:        []string{"email"},
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.PermissionDenied,
+					Message: "API key doesn't have the ability to write to the database",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			userData := &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			}
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(userData.ID, 10)), userData)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := insertDatabases(ctx, []*model.Databases{existingDatabase})
+			require.NoError(t, err)
+
+			err = insertCollections(ctx, []*model.Collections{existingCollection})
+			require.NoError(t, err)
+
+			err = insertDocuments(ctx, existingDocuments)
+			require.NoError(t, err)
+
+			_, err = permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+				KeyID:      1,
+				DatabaseID: &existingDatabase.ID,
+				UserID:     1,
+				Role:       "write",
+			})
+			require.NoError(t, err)
+
+			for _, params := range tc.existingIndexes {
+				_, err := CreateIndex(ctx, params)
+				require.NoError(t, err)
+			}
+
+			if tc.userCan != "write" {
+				err = test_utils_permissions.Cleanup(ctx)
+				require.NoError(t, err)
+
+				_, err = permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+					KeyID:      1,
+					DatabaseID: &existingDatabase.ID,
+					UserID:     1,
+					Role:       tc.userCan,
+				})
+				require.NoError(t, err)
+			}
+
+			response, err := CreateIndex(ctx, tc.params)
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+				return
+			}
+
+			require.NoError(t, err)
+			compareIndex(t, *tc.expected.index, response.Index)
+
+			indexes, err := ListIndexes(ctx, &ListIndexesParams{CollectionID: existingCollection.ID})
+			require.NoError(t, err)
+			require.Len(t, indexes.Indexes, len(tc.existingIndexes)+1)
+		})
+	}
+}
+
+func TestDropIndex(t *testing.T) {
+	now := time.Now()
+
+	type expected struct {
+		indexes []string
+		err     error
+	}
+
+	existingDatabase := &model.Databases{
+		ID:        1,
+		Name:      "test",
+		UserID:    1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	existingCollection := &model.Collections{
+		ID:         2,
+		DatabaseID: existingDatabase.ID,
+		Name:       "test",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	existingIndexes := []*CreateIndexParams{
+		{
+			CollectionID: existingCollection.ID,
+			Name:         "email",
+			Paths:        []string{"email"},
+			Unique:       true,
+		},
+		{
+			CollectionID: existingCollection.ID,
+			Name:         "city",
+			Paths:        []string{"address.city"},
+		},
+	}
+
+	tcs := []struct {
+		scenario string
+		userCan  string
+		params   *DropIndexParams
+		expected expected
+	}{
+		{
+			scenario: "Will drop an index",
+			userCan:  "write",
+			params: &DropIndexParams{
+				CollectionID: existingCollection.ID,
+				Name:         "email",
+			},
+			expected: expected{
+				indexes: []string{"city"},
+			},
+		},
+		{
+			scenario: "Will throw an error when the index does not exist",
+			userCan:  "write",
+			params: &DropIndexParams{
+				CollectionID: existingCollection.ID,
+				Name:         "other",
+			},
+			expected: expected{
+				indexes: []string{"city", "email"},
+				err: &errs.Error{
+					Code:    errs.NotFound,
+					Message: "Could not find index",
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when the key cannot write to the database",
+			userCan:  "read",
+			params: &DropIndexParams{
+				CollectionID: existingCollection.ID,
+				Name:         "email",
+			},
+			expected: expected{
+				indexes: []string{"city", "email"},
+				err: &errs.Error{
+					Code:    errs.PermissionDenied,
+					Message: "API key doesn't have the ability to write to the database",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			userData := &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			}
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(userData.ID, 10)), userData)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := insertDatabases(ctx, []*model.Databases{existingDatabase})
+			require.NoError(t, err)
+
+			err = insertCollections(ctx, []*model.Collections{existingCollection})
+			require.NoError(t, err)
+
+			_, err = permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+				KeyID:      1,
+				DatabaseID: &existingDatabase.ID,
+				UserID:     1,
+				Role:       "write",
+			})
+			require.NoError(t, err)
+
+			for _, params := range existingIndexes {
+				_, err := CreateIndex(ctx, params)
+				require.NoError(t, err)
+			}
+
+			if tc.userCan != "write" {
+				err = test_utils_permissions.Cleanup(ctx)
+				require.NoError(t, err)
+
+				_, err = permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+					KeyID:      1,
+					DatabaseID: &existingDatabase.ID,
+					UserID:     1,
+					Role:       tc.userCan,
+				})
+				require.NoError(t, err)
+			}
+
+			response, err := DropIndex(ctx, tc.params)
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.params.Name, response.Index.Name)
+			}
+
+			indexes, err := ListIndexes(ctx, &ListIndexesParams{CollectionID: existingCollection.ID})
+			require.NoError(t, err)
+
+			names := make([]string, len(indexes.Indexes))
+			for i, index := range indexes.Indexes {
+				names[i] = index.Name
+			}
+			assert.Equal(t, tc.expected.indexes, names)
+		})
+	}
+}
+
+// stopIndexBuild moves an index back to building, as left by a build that stopped the given time ago.
+func stopIndexBuild(ctx context.Context, collectionID int64, name string, ago time.Duration) error {
+	query, args := table.CollectionIndexes.UPDATE(table.CollectionIndexes.Status, table.CollectionIndexes.UpdatedAt).
+		SET(models.IndexBuilding, time.Now().Add(-ago)).
+		WHERE(
+			table.CollectionIndexes.CollectionID.EQ(postgres.Int64(collectionID)).
+				AND(table.CollectionIndexes.Name.EQ(postgres.String(name))),
+		).
+		Sql()
+
+	_, err := sqldb.Exec(ctx, query, args...)
+	return err
+}
+
+func TestStoppedIndexBuilds(t *testing.T) {
+	now := time.Now()
+	userData := &identity.UserData{
+		ID:    1,
+		KeyID: 1,
+	}
+
+	ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(userData.ID, 10)), userData)
+	defer test_utils.Cleanup(ctx)
+	defer test_utils_permissions.Cleanup(ctx)
+
+	existingDatabase := &model.Databases{ID: 1, Name: "test", UserID: 1, CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, insertDatabases(ctx, []*model.Databases{existingDatabase}))
+	require.NoError(t, insertCollections(ctx, []*model.Collections{
+		{ID: 2, DatabaseID: existingDatabase.ID, Name: "test", CreatedAt: now, UpdatedAt: now},
+	}))
+
+	_, err := permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+		KeyID:      1,
+		DatabaseID: &existingDatabase.ID,
+		UserID:     1,
+		Role:       "write",
+	})
+	require.NoError(t, err)
+
+	for _, name := range []string{"email", "city"} {
+		_, err = CreateIndex(ctx, &CreateIndexParams{CollectionID: 2, Name: name, Paths: []string{name}})
+		require.NoError(t, err)
+	}
+
+	// A build still running cannot be dropped, nor is it resumed
+	require.NoError(t, stopIndexBuild(ctx, 2, "email", time.Minute))
+
+	_, err = DropIndex(ctx, &DropIndexParams{CollectionID: 2, Name: "email"})
+	test_utils2.CompareErrors(t, &errs.Error{
+		Code:    errs.FailedPrecondition,
+		Message: "Could not drop index, it is still building",
+	}, err)
+
+	resumed, err := internal.ResumeIndexBuilds(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), resumed)
+
+	// A build that stopped is resumed, or can be dropped
+	require.NoError(t, stopIndexBuild(ctx, 2, "email", time.Hour))
+	require.NoError(t, stopIndexBuild(ctx, 2, "city", time.Hour))
+
+	_, err = DropIndex(ctx, &DropIndexParams{CollectionID: 2, Name: "city"})
+	require.NoError(t, err)
+
+	resumed, err = internal.ResumeIndexBuilds(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), resumed)
+
+	indexes, err := ListIndexes(ctx, &ListIndexesParams{CollectionID: 2})
+	require.NoError(t, err)
+	require.Len(t, indexes.Indexes, 1)
+	assert.Equal(t, "email", indexes.Indexes[0].Name)
+	assert.Equal(t, models.IndexReady, indexes.Indexes[0].Status)
+}
+
+func compareIndex(t *testing.T, expected, actual convert.IndexPayload) {
+	assert.Equal(t, expected.Name, actual.Name)
+	assert.Equal(t, expected.CollectionID, actual.CollectionID)
+	assert.Equal(t, expected.Paths, actual.Paths)
+	assert.Equal(t, expected.Unique, actual.Unique)
+	assert.Equal(t, expected.Method, actual.Method)
+	assert.Equal(t, expected.Status, actual.Status)
+	assert.Equal(t, expected.Error, actual.Error)
+}
+
+func TestUniqueIndex(t *testing.T) {
+	now := time.Now()
+
+	existingDatabase := &model.Databases{
+		ID:        1,
+		Name:      "test",
+		UserID:    1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	existingCollection := &model.Collections{
+		ID:         2,
+		DatabaseID: existingDatabase.ID,
+		Name:       "test",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	existingDocuments := []*model.Documents{
+		{
+			ID:           3,
+			CollectionID: existingCollection.ID,
+			Content:      `{"email": "foo@bar.com", "name": "foo"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ID:           4,
+			CollectionID: existingCollection.ID,
+			Content:      `{"email": "bar@foo.com", "name": "bar"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+	}
+
+	conflictErr := &errs.Error{
+		Code:    errs.AlreadyExists,
+		Message: "Document has the same values as document 3 on the unique index `email`",
+		Details: &internal.UniqueConflict{
+			Index:      "email",
+			Paths:      []string{"email"},
+			DocumentID: existingDocuments[0].ID,
+		},
+	}
+
+	tcs := []struct {
+		scenario      string
+		inTransaction bool
+		write         func(ctx context.Context, transactionKey uuid.UUID) error
+		err           error
+	}{
+		{
+			scenario: "Will create a document with a different value",
+			write: func(ctx context.Context, transactionKey uuid.UUID) error {
+				_, err := CreateDocument(ctx, &CreateDocumentParams{
+					CollectionID:   existingCollection.ID,
+					Content:        json.RawMessage(`{"email": "baz@bar.com"}`),
+					TransactionKey: transactionKey,
+				})
+				return err
+			},
+		},
+		{
+			scenario: "Will create documents without a value at the path",
+			write: func(ctx context.Context, transactionKey uuid.UUID) error {
+				for i := 0; i < 2; i++ {
+					_, err := CreateDocument(ctx, &CreateDocumentParams{
+						CollectionID:   existingCollection.ID,
+						Content:        json.RawMessage(`{"name": "baz"}`),
+						TransactionKey: transactionKey,
+					})
+					if err != nil {
+						return err
+					}
+				}
+
+				return nil
+			},
+		},
+		{
+			scenario: "Will update a document keeping its value",
+			write: func(ctx context.Context, transactionKey uuid.UUID) error {
+				_, err := UpdateDocument(ctx, &UpdateDocumentParams{
+					ID:             existingDocuments[0].ID,
+					Content:        json.RawMessage(`{"email": "foo@bar.com", "name": "baz"}`),
+					TransactionKey: transactionKey,
+				})
+				return err
+			},
+		},
+		{
+			scenario: "Will throw an error when creating a document with an existing value",
+			write: func(ctx context.Context, transactionKey uuid.UUID) error {
+				_, err := CreateDocument(ctx, &CreateDocumentParams{
+					CollectionID:   existingCollection.ID,
+					Content:        json.RawMessage(`{"email": "foo@bar.com"}`),
+					TransactionKey: transactionKey,
+				})
+				return err
+			},
+			err: conflictErr,
+		},
+		{
+			scenario: "Will throw an error when updating a document to an existing value",
+			write: func(ctx context.Context, transactionKey uuid.UUID) error {
+				_, err := UpdateDocument(ctx, &UpdateDocumentParams{
+					ID:             existingDocuments[1].ID,
+					Content:        json.RawMessage(`{"email": "foo@bar.com"}`),
+					TransactionKey: transactionKey,
+				})
+				return err
+			},
+			err: conflictErr,
+		},
+		{
+			scenario: "Will throw an error when patching a document to an existing value",
+			write: func(ctx context.Context, transactionKey uuid.UUID) error {
+				_, err := PatchDocument(ctx, &PatchDocumentParams{
+					ID:             existingDocuments[1].ID,
+					MergePatch:     json.RawMessage(`{"email": "foo@bar.com"}`),
+					TransactionKey: transactionKey,
+				})
+				return err
+			},
+			err: conflictErr,
+		},
+		{
+			scenario:      "Will throw an error when creating a document with an existing value in a transaction",
+			inTransaction: true,
+			write: func(ctx context.Context, transactionKey uuid.UUID) error {
+				_, err := CreateDocument(ctx, &CreateDocumentParams{
+					CollectionID:   existingCollection.ID,
+					Content:        json.RawMessage(`{"email": "foo@bar.com"}`),
+					TransactionKey: transactionKey,
+				})
+				return err
+			},
+			err: conflictErr,
+		},
+		{
+			scenario:      "Will throw an error when patching a document to an existing value in a transaction",
+			inTransaction: true,
+			write: func(ctx context.Context, transactionKey uuid.UUID) error {
+				_, err := PatchDocument(ctx, &PatchDocumentParams{
+					ID:             existingDocuments[1].ID,
+					MergePatch:     json.RawMessage(`{"email": "foo@bar.com"}`),
+					TransactionKey: transactionKey,
+				})
+				return err
+			},
+			err: conflictErr,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			userData := &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			}
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(userData.ID, 10)), userData)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := insertDatabases(ctx, []*model.Databases{existingDatabase})
+			require.NoError(t, err)
+
+			err = insertCollections(ctx, []*model.Collections{existingCollection})
+			require.NoError(t, err)
+
+			err = insertDocuments(ctx, existingDocuments)
+			require.NoError(t, err)
+
+			_, err = permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+				KeyID:      1,
+				DatabaseID: &existingDatabase.ID,
+				UserID:     1,
+				Role:       "write",
+			})
+			require.NoError(t, err)
+
+			_, err = CreateIndex(ctx, &CreateIndexParams{
+				CollectionID: existingCollection.ID,
+				Name:         "email",
+				Paths:        []string{"email"},
+				Unique:       true,
+			})
+			require.NoError(t, err)
+
+			transactionKey := uuid.Nil
+			if tc.inTransaction {
+				transaction, err := StartTransaction(ctx, &StartTransactionParams{DatabaseID: existingDatabase.ID})
+				require.NoError(t, err)
+				transactionKey = transaction.TransactionKey
+			}
+
+			err = tc.write(ctx, transactionKey)
+			if tc.err != nil {
+				test_utils2.CompareErrors(t, tc.err, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestIndexedValueSize(t *testing.T) {
+	f := articlesFixture("write")
+	f.documents = []*model.Documents{
+		{
+			ID:           4,
+			CollectionID: 2,
+			Content:      `{"title": "foo"}`,
+			CreatedAt:    time.Now(),
+			UpdatedAt:    time.Now(),
+		},
+	}
+
+	large := json.RawMessage(`{"title": "` + strings.Repeat("a", internal.MaxIndexedValueSize) + `"}`)
+	tooLargeErr := &errs.Error{
+		Code:    errs.InvalidArgument,
+		Message: "Received content was not valid, its values at the paths of the index `title` are larger than 2048 bytes",
+	}
+
+	tcs := []struct {
+		scenario string
+		method   string
+		write    func(ctx context.Context) error
+		err      error
+	}{
+		{
+			scenario: "Throws an error when a created document has a value too large for a B-tree index",
+			write: func(ctx context.Context) error {
+				_, err := CreateDocument(ctx, &CreateDocumentParams{CollectionID: 2, Content: large})
+				return err
+			},
+			err: tooLargeErr,
+		},
+		{
+			scenario: "Throws an error when an updated document has a value too large for a B-tree index",
+			write: func(ctx context.Context) error {
+				_, err := UpdateDocument(ctx, &UpdateDocumentParams{ID: 4, Content: large})
+				return err
+			},
+			err: tooLargeErr,
+		},
+		{
+			scenario: "Throws an error when a patched document has a value too large for a B-tree index",
+			write: func(ctx context.Context) error {
+				_, err := PatchDocument(ctx, &PatchDocumentParams{ID: 4, MergePatch: large})
+				return err
+			},
+			err: tooLargeErr,
+		},
+		{
+			scenario: "Writes a document with a large value on a GIN index",
+			method:   models.IndexGIN,
+			write: func(ctx context.Context) error {
+				_, err := CreateDocument(ctx, &CreateDocumentParams{CollectionID: 2, Content: large})
+				return err
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := fixtureContext(t, f)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			_, err := CreateIndex(ctx, &CreateIndexParams{
+				CollectionID: 2,
+				Name:         "title",
+				Paths:        []string{"title"},
+				Method:       tc.method,
+			})
+			require.NoError(t, err)
+
+			err = tc.write(ctx)
+			if tc.err != nil {
+				test_utils2.CompareErrors(t, tc.err, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/helpers"
+	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/table"
+	"encore.app/content/query"
+	"encore.app/identity"
+	"encore.app/pagination"
+)
+
+// AggregateDocuments groups the documents of a collection matching a filter by the values at the given paths
+// for the authenticated user, and computes the accumulators on each group. It returns at most limit groups,
+// sorted by a path they are grouped by or by an accumulator.
+func AggregateDocuments(ctx context.Context, collectionID int64, rawMatch json.RawMessage, groupBy []string, rawAccumulators json.RawMessage, sortBy string, descending bool, limit int) ([]json.RawMessage, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	collection, err := helpers.GetCollection(ctx, collectionID, userData.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !helpers.CanReadDatabase(ctx, collection.DatabaseID, userData.KeyID) {
+		return nil, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to read the database",
+		}
+	}
+
+	match, err := query.ParseFilter(rawMatch)
+	if err != nil {
+		log.WithError(err).Warning("Could not parse the match on aggregate request")
+		return nil, invalidQueryError("match", err)
+	}
+
+	paths, err := query.ParseGroupBy(groupBy)
+	if err != nil {
+		log.WithError(err).Warning("Could not parse the group by on aggregate request")
+		return nil, invalidQueryError("group by", err)
+	}
+
+	aggregation, err := query.ParseAggregation(paths, rawAccumulators)
+	if err != nil {
+		log.WithError(err).Warning("Could not parse the accumulators on aggregate request")
+		return nil, invalidQueryError("accumulators", err)
+	}
+
+	orderBy, err := aggregation.OrderBy(table.Documents.Content, sortBy, descending)
+	if err != nil {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("Received sort was not valid, %s", err.Error()),
+		}
+	}
+
+	if limit == 0 {
+		limit = pagination.DefaultLimit
+	} else if limit < 0 || limit > pagination.MaxLimit {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("Received limit was not valid, it must be between 1 and %d", pagination.MaxLimit),
+		}
+	}
+
+	groups, err := models.AggregateDocuments(ctx, collection.ID, match, aggregation, orderBy, int64(limit))
+	if err != nil {
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not aggregate documents",
+		}
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,183 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"encore.app/content/helpers"
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/convert"
+	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/identity"
+)
+
+// MaxBatchOperations is the maximum number of operations in a single batch.
+const MaxBatchOperations = 1000
+
+// BatchOperationFailure is the details of the error returned when an operation of a batch failed.
+type BatchOperationFailure struct {
+	// The index of the operation that failed in the batch
+	Index int
+
+	// The details of the error of the operation, if any
+	Details errs.ErrDetails
+}
+
+// ErrDetails marks BatchOperationFailure as usable in the details of an encore error.
+func (f *BatchOperationFailure) ErrDetails() {}
+
+// batchCollections fetches the collections of a batch once and validates they belong to the database of the batch.
+type batchCollections struct {
+	database    *model.Databases
+	userID      int64
+	collections map[int64]*model.Collections
+}
+
+// get returns the collection by ID, fetching it on first use.
+func (b *batchCollections) get(ctx context.Context, id int64) (*model.Collections, error) {
+	if collection, ok := b.collections[id]; ok {
+		return collection, nil
+	}
+
+	collection, err := helpers.GetCollection(ctx, id, b.userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if collection.DatabaseID != b.database.ID {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Collection does not belong to the database of the batch",
+		}
+	}
+
+	b.collections[id] = collection
+	return collection, nil
+}
+
+// Batch runs a list of document operations on a database of the authenticated user, in order and in a
+// single SQL transaction. Either all the operations are applied or none are, the first failing operation
+// stops the batch. Permissions are checked once for the whole database.
+func Batch(ctx context.Context, databaseID int64, operations []convert.BatchOperation) ([]convert.DocumentPayload, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	if len(operations) == 0 || len(operations) > MaxBatchOperations {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("Received batch was not valid, it must contain between 1 and %d operations", MaxBatchOperations),
+		}
+	}
+
+	database, err := helpers.GetDatabase(ctx, databaseID, userData.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !helpers.CanWriteDatabase(ctx, database.ID, userData.KeyID) {
+		return nil, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to write to the database",
+		}
+	}
+
+	collections := &batchCollections{
+		database:    database,
+		userID:      userData.ID,
+		collections: map[int64]*model.Collections{},
+	}
+
+	results := make([]convert.DocumentPayload, 0, len(operations))
+	err = models.RunInSQLTransaction(ctx, func(ctx context.Context) error {
+		for i, operation := range operations {
+			result, err := runBatchOperation(ctx, collections, operation)
+			if err != nil {
+				return batchOperationError(i, err)
+			}
+
+			results = append(results, result)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		var operationErr *errs.Error
+		if errors.As(err, &operationErr) {
+			return nil, err
+		}
+
+		log.WithError(err).Error("Could not run batch")
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not run batch",
+		}
+	}
+
+	return results, nil
+}
+
+// runBatchOperation runs a single operation of a batch.
+func runBatchOperation(ctx context.Context, collections *batchCollections, operation convert.BatchOperation) (convert.DocumentPayload, error) {
+	if operation.Op == "create" {
+		collection, err := collections.get(ctx, operation.CollectionID)
+		if err != nil {
+			return convert.DocumentPayload{}, err
+		}
+
+		return createDocument(ctx, collection, operation.Key, operation.Content)
+	}
+
+	if operation.Op != "update" && operation.Op != "patch" && operation.Op != "delete" {
+		return convert.DocumentPayload{}, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("Received operation `%s` was not valid, must be one of create, update, patch or delete", operation.Op),
+		}
+	}
+
+	ref := NewDocumentRef(operation.ID, operation.CollectionID, operation.Key)
+	document, err := helpers.GetDocument(ctx, ref, collections.userID)
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
+	collection, err := collections.get(ctx, document.CollectionID)
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
+	switch operation.Op {
+	case "update":
+		return updateDocument(ctx, collection, document, operation.Content, operation.IfVersion)
+	case "patch":
+		patch, err := parsePatch(operation.JSONPatch, operation.MergePatch, operation.Update)
+		if err != nil {
+			return convert.DocumentPayload{}, err
+		}
+
+		return patchDocument(ctx, collection, document, patch, operation.IfVersion)
+	default:
+		return deleteDocument(ctx, document, operation.IfVersion)
+	}
+}
+
+// batchOperationError wraps the error of an operation of a batch with the index of the operation.
+func batchOperationError(index int, err error) error {
+	operationErr, ok := err.(*errs.Error)
+	if !ok {
+		return err
+	}
+
+	return &errs.Error{
+		Code:    operationErr.Code,
+		Message: fmt.Sprintf("Operation %d of the batch failed: %s", index, operationErr.Message),
+		Details: &BatchOperationFailure{
+			Index:   index,
+			Details: operationErr.Details,
+		},
+	}
+}
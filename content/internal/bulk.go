@@ -0,0 +1,284 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/helpers"
+	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/query"
+	"encore.app/identity"
+)
+
+// maxSampledDocuments is the maximum number of document IDs returned by bulk operations.
+const maxSampledDocuments = 10
+
+// BulkDocumentFailure is the details of the error returned when a bulk operation cannot be applied to one
+// of the matched documents.
+type BulkDocumentFailure struct {
+	// The unique identifier of the document the operation cannot be applied to
+	DocumentID int64
+
+	// The details of the error on the document, if any
+	Details errs.ErrDetails
+}
+
+// ErrDetails marks BulkDocumentFailure as usable in the details of an encore error.
+func (f *BulkDocumentFailure) ErrDetails() {}
+
+// UpdateDocuments applies a patch to all the documents of a collection matching a filter for the authenticated
+// user, in a single statement. Exactly one of a JSON Patch, a JSON Merge Patch or update operators must be given.
+// The patch is checked against every matched document first, no document is updated when it cannot be applied
+// to one of them or when a patched document would not match the schema of the collection. It returns the number
+// of updated documents along with the IDs of the first of them. When dryRun is true, the matched documents are
+// checked and counted but not updated. In a transaction, unique indexes are enforced when it is committed.
+func UpdateDocuments(ctx context.Context, collectionID int64, rawFilter, jsonPatch, mergePatch, update json.RawMessage, dryRun bool) (int64, []int64, error) {
+	collection, err := bulkCollection(ctx, collectionID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	filter, err := parseBulkFilter(rawFilter)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	patch, err := parsePatch(jsonPatch, mergePatch, update)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var count int64
+	var sample []int64
+
+	// The matched documents are locked from the checks to the update
+	err = models.RunInSQLTransaction(ctx, func(ctx context.Context) error {
+		count, sample, err = matchBulkDocuments(ctx, collection.ID, filter)
+		if err != nil {
+			return err
+		}
+
+		err = checkDocumentsPatch(ctx, collection, filter, patch)
+		if err != nil {
+			return err
+		}
+
+		if dryRun || count == 0 {
+			return nil
+		}
+
+		ids, err := transactionDocumentIDs(ctx, collection.ID, filter)
+		if err != nil {
+			return err
+		}
+
+		count, err = models.PatchDocuments(ctx, collection.ID, filter, patch, ids)
+		return err
+	})
+
+	var updateErr *errs.Error
+	if errors.As(err, &updateErr) {
+		return 0, nil, err
+	} else if models.IsUniqueViolation(err) {
+		return 0, nil, &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: "Updated documents would have the same values as other documents on a unique index",
+		}
+	} else if models.IsIndexEntryTooLarge(err) {
+		return 0, nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("Updated documents would have values at the paths of an index larger than %d bytes", MaxIndexedValueSize),
+		}
+	} else if err != nil {
+		log.WithError(err).Error("Could not update documents")
+		return 0, nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not save documents",
+		}
+	}
+
+	return count, sample, nil
+}
+
+// DeleteDocuments deletes all the documents of a collection matching a filter for the authenticated user, in
+// a single statement. It returns the number of deleted documents along with the IDs of the first of them. When
+// dryRun is true, the matched documents are counted but not deleted.
+func DeleteDocuments(ctx context.Context, collectionID int64, rawFilter json.RawMessage, dryRun bool) (int64, []int64, error) {
+	collection, err := bulkCollection(ctx, collectionID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	filter, err := parseBulkFilter(rawFilter)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var count int64
+	var sample []int64
+
+	err = models.RunInSQLTransaction(ctx, func(ctx context.Context) error {
+		count, sample, err = matchBulkDocuments(ctx, collection.ID, filter)
+		if err != nil || dryRun || count == 0 {
+			return err
+		}
+
+		ids, err := transactionDocumentIDs(ctx, collection.ID, filter)
+		if err != nil {
+			return err
+		}
+
+		count, err = models.DeleteDocuments(ctx, collection.ID, filter, ids)
+		return err
+	})
+
+	if err != nil {
+		log.WithError(err).Error("Could not delete documents")
+		return 0, nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not delete documents",
+		}
+	}
+
+	return count, sample, nil
+}
+
+// bulkCollection fetches the collection of a bulk operation, checking the authenticated user can write to it.
+func bulkCollection(ctx context.Context, collectionID int64) (*model.Collections, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	collection, err := helpers.GetCollection(ctx, collectionID, userData.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !helpers.CanWriteDatabase(ctx, collection.DatabaseID, userData.KeyID) {
+		return nil, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to write to the database",
+		}
+	}
+
+	return collection, nil
+}
+
+// parseBulkFilter parses the filter selecting the documents of a bulk operation. A filter must be given so
+// that all the documents of a collection are never changed by mistake, `{}` matches them all.
+func parseBulkFilter(rawFilter json.RawMessage) (*query.Filter, error) {
+	if isEmptyJSON(rawFilter) {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Received filter was not valid, a filter expression must be given, `{}` matches all the documents",
+		}
+	}
+
+	filter, err := query.ParseFilter(rawFilter)
+	if err != nil {
+		log.WithError(err).Warning("Could not parse the filter on bulk request")
+		return nil, invalidQueryError("filter", err)
+	}
+
+	return filter, nil
+}
+
+// matchBulkDocuments counts the documents of a collection matched by a bulk operation and lists the IDs of the
+// first of them. Outside of a transaction, the matched documents are locked until the end of the SQL transaction.
+func matchBulkDocuments(ctx context.Context, collectionID int64, filter *query.Filter) (int64, []int64, error) {
+	count, err := models.CountMatchingDocuments(ctx, collectionID, filter)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	sample, err := models.SampleMatchingDocumentIDs(ctx, collectionID, filter, maxSampledDocuments)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return count, sample, nil
+}
+
+// transactionDocumentIDs lists the IDs of the documents of a collection matched by a bulk operation when it is
+// run in a transaction, to record their version. Outside of a transaction, no IDs are needed.
+func transactionDocumentIDs(ctx context.Context, collectionID int64, filter *query.Filter) ([]int64, error) {
+	if models.TransactionFromContext(ctx) == nil {
+		return nil, nil
+	}
+
+	return models.MatchDocumentIDs(ctx, collectionID, filter)
+}
+
+// checkDocumentsPatch checks that a patch can be applied to every document matched by a bulk update, and that
+// the patched documents match the schema of the collection. The patched documents are only read, one at a time,
+// when the collection has a schema to check them against.
+func checkDocumentsPatch(ctx context.Context, collection *model.Collections, filter *query.Filter, patch *query.Patch) error {
+	document, err := models.FindUnpatchableDocument(ctx, collection.ID, filter, patch)
+	if err != nil {
+		return &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not fetch documents",
+		}
+	}
+
+	if document != nil {
+		// The database does not tell why a patch could not be applied, update operators are checked against the content
+		mismatch := patch.Mismatch(json.RawMessage(document.Content))
+		if mismatch != nil {
+			return bulkDocumentError(document.ID, invalidQueryError("update", mismatch))
+		}
+
+		return bulkDocumentError(document.ID, &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "Patch could not be applied to the document, a path does not exist or a test failed",
+		})
+	}
+
+	schema, err := collectionSchema(collection)
+	if err != nil || schema == nil {
+		return err
+	}
+
+	var invalid error
+	err = models.EachPatchedDocument(ctx, collection.ID, filter, patch, func(document models.PatchedDocument) error {
+		invalid = validateContent(collection, json.RawMessage(document.Patched.String))
+		if invalid != nil {
+			invalid = bulkDocumentError(document.ID, invalid)
+		}
+
+		return invalid
+	})
+	if invalid != nil {
+		return invalid
+	}
+	if err != nil {
+		return &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not fetch documents",
+		}
+	}
+
+	return nil
+}
+
+// bulkDocumentError wraps the error of a bulk operation on one of the matched documents with the ID of the document.
+func bulkDocumentError(documentID int64, err error) error {
+	documentErr, ok := err.(*errs.Error)
+	if !ok {
+		return err
+	}
+
+	return &errs.Error{
+		Code:    documentErr.Code,
+		Message: fmt.Sprintf("Document %d could not be updated: %s", documentID, documentErr.Message),
+		Details: &BulkDocumentFailure{
+			DocumentID: documentID,
+			Details:    documentErr.Details,
+		},
+	}
+}
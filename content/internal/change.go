@@ -0,0 +1,225 @@
+package internal
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/convert"
+	"encore.app/content/helpers"
+	"encore.app/content/models"
+	"encore.app/content/query"
+	"encore.app/identity"
+)
+
+// maxChangesPerRead is the maximum number of changes read from a feed of changes at once.
+const maxChangesPerRead = 100
+
+// changeToken points to a change in a feed of changes, the feed resumes right after this change. The time the
+// token was created is kept to know whether the changes following it may have expired.
+type changeToken struct {
+	TransactionID int64     `json:"x"`
+	Sequence      int64     `json:"s"`
+	Time          time.Time `json:"t"`
+}
+
+// newChangeToken creates the token pointing to the given position in a feed of changes.
+func newChangeToken(position models.ChangePosition, at time.Time) changeToken {
+	return changeToken{TransactionID: position.TransactionID, Sequence: position.Sequence, Time: at}
+}
+
+// position returns the position in a feed of changes the token points to.
+func (t changeToken) position() models.ChangePosition {
+	return models.ChangePosition{TransactionID: t.TransactionID, Sequence: t.Sequence}
+}
+
+// encode encodes the token into an opaque string to return to clients.
+func (t changeToken) encode() string {
+	encoded, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// decodeChangeToken decodes a token previously encoded with encode.
+func decodeChangeToken(token string) (changeToken, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		parsed := changeToken{}
+		err = json.Unmarshal(decoded, &parsed)
+		if err == nil {
+			return parsed, nil
+		}
+	}
+
+	log.WithError(err).Warning("Could not decode the token of the change feed")
+	return changeToken{}, &errs.Error{
+		Code:    errs.InvalidArgument,
+		Message: "Received token was not valid, it is malformed",
+	}
+}
+
+// ChangeFeed follows the changes made to the documents of a database, or of one of its collections, in the
+// order they were committed.
+type ChangeFeed struct {
+	databaseID   int64
+	collectionID int64
+	filter       *query.Filter
+
+	// The position of the last change read from the feed
+	position models.ChangePosition
+}
+
+// OpenChangeFeed opens a feed of the changes made to the documents of a database or of a collection for the
+// authenticated user, only with the changes to documents with a content matching the filter when given. The
+// feed starts right after the change pointed to by the token when given, and with the next change otherwise.
+func OpenChangeFeed(ctx context.Context, databaseID, collectionID int64, rawFilter json.RawMessage, token string) (*ChangeFeed, error) {
+	if (databaseID == 0) == (collectionID == 0) {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Received feed was not valid, changes are followed either on a database or on a collection",
+		}
+	}
+
+	feed := &ChangeFeed{
+		databaseID:   databaseID,
+		collectionID: collectionID,
+	}
+
+	err := feed.CheckAccess(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	feed.filter, err = query.ParseFilter(rawFilter)
+	if err != nil {
+		log.WithError(err).Warning("Could not parse the filter on change feed request")
+		return nil, invalidQueryError("filter", err)
+	}
+
+	if token != "" {
+		parsed, err := decodeChangeToken(token)
+		if err != nil {
+			return nil, err
+		}
+
+		if parsed.Time.Before(time.Now().Add(-models.ChangeRetention)) {
+			return nil, &errs.Error{
+				Code:    errs.FailedPrecondition,
+				Message: "Received token has expired, the changes following it are no longer kept",
+			}
+		}
+
+		feed.position = parsed.position()
+		return feed, nil
+	}
+
+	feed.position, err = models.CurrentChangePosition(ctx)
+	if err != nil {
+		log.WithError(err).Error("Could not find the last change of the feed")
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not open the feed of changes",
+		}
+	}
+
+	return feed, nil
+}
+
+// CheckAccess checks the database or collection the feed follows still exists and can be read by the
+// authenticated user.
+func (f *ChangeFeed) CheckAccess(ctx context.Context) error {
+	userData := auth.Data().(*identity.UserData)
+
+	if f.collectionID != 0 {
+		collection, err := helpers.GetCollection(ctx, f.collectionID, userData.ID)
+		if err != nil {
+			return err
+		}
+
+		f.databaseID = collection.DatabaseID
+	} else {
+		_, err := helpers.GetDatabase(ctx, f.databaseID, userData.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !helpers.CanReadDatabase(ctx, f.databaseID, userData.KeyID) {
+		return &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to read the database",
+		}
+	}
+
+	return nil
+}
+
+// Token returns the token resuming the feed after the last change read from it.
+func (f *ChangeFeed) Token() string {
+	return newChangeToken(f.position, time.Now()).encode()
+}
+
+// Next reads the changes committed since the last change read from the feed, returning at most
+// maxChangesPerRead changes along with whether more changes may be waiting to be read.
+func (f *ChangeFeed) Next(ctx context.Context) ([]convert.ChangePayload, bool, error) {
+	changes, err := models.ListDocumentChanges(ctx, f.databaseID, f.collectionID, f.filter, f.position, maxChangesPerRead)
+	if err != nil {
+		log.WithError(err).Error("Could not read the changes of the feed")
+		return nil, false, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not read the changes",
+		}
+	}
+
+	payload := make([]convert.ChangePayload, len(changes))
+	for i, change := range changes {
+		f.position = models.ChangeModelPosition(change)
+
+		payload[i], err = convert.ChangeModelToPayload(change, newChangeToken(f.position, change.CreatedAt).encode())
+		if err != nil {
+			log.WithError(err).Error("Could not convert change to API safe version")
+			return nil, false, &errs.Error{
+				Code:    errs.Internal,
+				Message: "Could not convert change for API",
+			}
+		}
+	}
+
+	return payload, len(changes) == maxChangesPerRead, nil
+}
+
+// SweepExpiredChanges deletes the changes made to the documents that are no longer kept for clients to resume
+// their feed of changes, and returns the number of deleted changes.
+func SweepExpiredChanges(ctx context.Context) (int64, error) {
+	deleted, err := models.DeleteExpiredDocumentChanges(ctx, time.Now().Add(-models.ChangeRetention))
+	if err != nil {
+		return 0, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not delete expired changes",
+		}
+	}
+
+	log.WithField("deleted_changes", deleted).Info("Swept expired changes")
+
+	return deleted, nil
+}
+
+// SweepExpiredContentEvents deletes the events of the lifecycle of the databases, collections and documents that
+// are published, and the unpublished ones older than the changes kept, and returns the number of deleted events.
+func SweepExpiredContentEvents(ctx context.Context) (int64, error) {
+	deleted, err := models.DeleteExpiredContentEvents(ctx, time.Now().Add(-models.ChangeRetention))
+	if err != nil {
+		return 0, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not delete expired content events",
+		}
+	}
+
+	log.WithField("deleted_events", deleted).Info("Swept expired content events")
+
+	return deleted, nil
+}
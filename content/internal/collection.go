@@ -2,6 +2,7 @@ package internal
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
 	"encore.app/content/helpers"
@@ -11,37 +12,44 @@ import (
 
 	"encore.app/content/convert"
 	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/model"
 	"encore.app/identity"
+	"encore.app/pagination"
 )
 
-// ListCollections lists all collections created by the authenticated user in the given
-// database.
-func ListCollections(ctx context.Context, databaseID int64) ([]convert.CollectionPayload, error) {
+// ListCollections lists a page of the collections created by the authenticated user in the given
+// database, along with the cursor to the next page.
+func ListCollections(ctx context.Context, databaseID int64, params pagination.Params) ([]convert.CollectionPayload, string, error) {
 	userData := auth.Data().(*identity.UserData)
 
 	database, err := helpers.GetDatabase(ctx, databaseID, userData.ID)
 	if err != nil {
 		log.WithError(err).Error("Could not find database when listing collections")
-		return nil, err
+		return nil, "", err
 	}
 
 	if !helpers.CanReadDatabase(ctx, database.ID, userData.KeyID) {
-		return nil, &errs.Error{
+		return nil, "", &errs.Error{
 			Code:    errs.PermissionDenied,
 			Message: "API key doesn't have the ability to read the database",
 		}
 	}
 
-	collections, err := models.ListCollections(ctx, database.ID)
+	page, err := newPage(params, models.CollectionSortKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	collections, nextCursor, err := models.ListCollections(ctx, database.ID, page)
 	if err != nil {
 		log.WithError(err).Warning("Could not fetch collections for this database")
-		return nil, &errs.Error{
+		return nil, "", &errs.Error{
 			Code:    errs.Internal,
 			Message: "Could not fetch collections",
 		}
 	}
 
-	return convert.CollectionModelsToPayloads(collections), nil
+	return convert.CollectionModelsToPayloads(collections), nextCursor, nil
 }
 
 // GetCollection Finds a collection by ID
@@ -63,8 +71,39 @@ func GetCollection(ctx context.Context, id int64) (convert.CollectionPayload, er
 	return convert.CollectionModelToPayload(collection), nil
 }
 
-// CreateCollection creates a collection for the given database if owned by the authenticated user.
-func CreateCollection(ctx context.Context, databaseID int64, name string) (convert.CollectionPayload, error) {
+// GetCollectionByName finds a collection by its name and the name of its database
+func GetCollectionByName(ctx context.Context, databaseName, name string) (convert.CollectionPayload, error) {
+	collection, err := getCollectionByName(ctx, databaseName, name)
+	if err != nil {
+		return convert.CollectionPayload{}, err
+	}
+
+	return convert.CollectionModelToPayload(collection), nil
+}
+
+// getCollectionByName finds a collection by its name and the name of its database, and checks the
+// authenticated user can read it.
+func getCollectionByName(ctx context.Context, databaseName, name string) (*model.Collections, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	database, err := helpers.GetDatabaseByName(ctx, databaseName, userData.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !helpers.CanReadDatabase(ctx, database.ID, userData.KeyID) {
+		return nil, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to read the database",
+		}
+	}
+
+	return helpers.GetCollectionByName(ctx, database.ID, name, userData.ID)
+}
+
+// CreateCollection creates a collection for the given database if owned by the authenticated user, with
+// an optional schema and search configuration, keeping the history of its documents if asked to.
+func CreateCollection(ctx context.Context, databaseID int64, name string, rawSchema, rawSearch json.RawMessage, history bool) (convert.CollectionPayload, error) {
 	userData := auth.Data().(*identity.UserData)
 
 	database, err := helpers.GetDatabase(ctx, databaseID, userData.ID)
@@ -80,7 +119,28 @@ func CreateCollection(ctx context.Context, databaseID int64, name string) (conve
 		}
 	}
 
+	schema, err := parseSchema(rawSchema)
+	if err != nil {
+		return convert.CollectionPayload{}, err
+	}
+
+	search, err := parseSearchConfig(rawSearch)
+	if err != nil {
+		return convert.CollectionPayload{}, err
+	}
+
 	collection := models.NewCollection(name, database.ID)
+	collection.History = history
+	if schema != nil {
+		raw := string(schema.Raw())
+		collection.Schema = &raw
+	}
+
+	if search != nil {
+		raw := string(search.Raw())
+		collection.Search = &raw
+	}
+
 	if !models.ValidateCollectionConstraint(ctx, collection) {
 		log.WithFields(map[string]interface{}{
 			"name":        name,
@@ -104,29 +164,90 @@ func CreateCollection(ctx context.Context, databaseID int64, name string) (conve
 	return convert.CollectionModelToPayload(collection), nil
 }
 
-// UpdateCollection updates a collection by ID for the authenticated user
-func UpdateCollection(ctx context.Context, id int64, name string) (convert.CollectionPayload, error) {
+// UpdateCollection updates a collection by ID for the authenticated user. A new schema is only attached
+// if all the documents of the collection match it, the schema is kept when none is given unless
+// removeSchema is set. The search configuration is replaced the same way, the search vectors of the documents
+// are rebuilt once saved. The history setting is kept when history is nil. With dryRun, nothing is saved and
+// the documents that do not match the new schema are returned.
+func UpdateCollection(ctx context.Context, id int64, name string, rawSchema json.RawMessage, removeSchema bool, rawSearch json.RawMessage, removeSearch bool, history *bool, dryRun bool) (convert.CollectionPayload, []convert.DocumentViolations, error) {
 	userData := auth.Data().(*identity.UserData)
 
 	collection, err := helpers.GetCollection(ctx, id, userData.ID)
 	if err != nil {
-		return convert.CollectionPayload{}, err
+		return convert.CollectionPayload{}, nil, err
 	}
 
 	if !helpers.CanWriteDatabase(ctx, collection.DatabaseID, userData.KeyID) {
-		return convert.CollectionPayload{}, &errs.Error{
+		return convert.CollectionPayload{}, nil, &errs.Error{
 			Code:    errs.PermissionDenied,
 			Message: "API key doesn't have the ability to write to the database",
 		}
 	}
 
+	schema, err := parseSchema(rawSchema)
+	if err != nil {
+		return convert.CollectionPayload{}, nil, err
+	}
+
+	if schema != nil && removeSchema {
+		return convert.CollectionPayload{}, nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Received schema was not valid, a schema cannot be given when removing the schema",
+		}
+	}
+
+	search, err := parseSearchConfig(rawSearch)
+	if err != nil {
+		return convert.CollectionPayload{}, nil, err
+	}
+
+	if search != nil && removeSearch {
+		return convert.CollectionPayload{}, nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Received search was not valid, a search configuration cannot be given when removing the search configuration",
+		}
+	}
+
 	collection.Name = name
+
+	if search != nil {
+		raw := string(search.Raw())
+		collection.Search = &raw
+	} else if removeSearch {
+		collection.Search = nil
+	}
+
+	if history != nil {
+		collection.History = *history
+	}
+
+	var violations []convert.DocumentViolations
+	if schema != nil {
+		violations, err = findSchemaViolations(ctx, collection, schema)
+		if err != nil {
+			return convert.CollectionPayload{}, nil, err
+		}
+
+		raw := string(schema.Raw())
+		collection.Schema = &raw
+	} else if removeSchema {
+		collection.Schema = nil
+	}
+
+	if dryRun {
+		return convert.CollectionModelToPayload(collection), violations, nil
+	}
+
+	if len(violations) > 0 {
+		return convert.CollectionPayload{}, nil, schemaViolationsError(violations)
+	}
+
 	if !models.ValidateCollectionConstraint(ctx, collection) {
 		log.WithFields(map[string]interface{}{
 			"name":        name,
 			"database_id": collection.DatabaseID,
 		}).Warning("Could not validate the constraints for collection, a collection already exists.")
-		return convert.CollectionPayload{}, &errs.Error{
+		return convert.CollectionPayload{}, nil, &errs.Error{
 			Code:    errs.AlreadyExists,
 			Message: fmt.Sprintf("A collection with name `%s` already exists in this database", collection.Name),
 		}
@@ -135,16 +256,16 @@ func UpdateCollection(ctx context.Context, id int64, name string) (convert.Colle
 	err = models.SaveCollection(ctx, collection)
 	if err != nil {
 		log.WithError(err).Error("Could not save collection")
-		return convert.CollectionPayload{}, &errs.Error{
+		return convert.CollectionPayload{}, nil, &errs.Error{
 			Code:    errs.Internal,
 			Message: "Could not save collection",
 		}
 	}
 
-	return convert.CollectionModelToPayload(collection), nil
+	return convert.CollectionModelToPayload(collection), nil, nil
 }
 
-// DeleteCollection deletes a collection by ID for the authenticated user
+// DeleteCollection moves a collection by ID to the trash for the authenticated user, along with its documents
 func DeleteCollection(ctx context.Context, id int64) (convert.CollectionPayload, error) {
 	userData := auth.Data().(*identity.UserData)
 
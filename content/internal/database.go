@@ -12,29 +12,36 @@ import (
 	"encore.app/content/convert"
 	"encore.app/content/models"
 	"encore.app/identity"
+	"encore.app/pagination"
 )
 
-// ListDatabases lists all Databases created by the authenticated user.
-func ListDatabases(ctx context.Context) ([]convert.DatabasePayload, error) {
+// ListDatabases lists a page of the Databases created by the authenticated user, along with
+// the cursor to the next page.
+func ListDatabases(ctx context.Context, params pagination.Params) ([]convert.DatabasePayload, string, error) {
 	userData := auth.Data().(*identity.UserData)
 
 	if !helpers.CanAdmin(ctx, userData.KeyID) {
-		return nil, &errs.Error{
+		return nil, "", &errs.Error{
 			Code:    errs.PermissionDenied,
 			Message: "API key cannot be used for admin operations",
 		}
 	}
 
-	databases, err := models.ListDatabase(ctx, userData.ID)
+	page, err := newPage(params, models.DatabaseSortKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	databases, nextCursor, err := models.ListDatabase(ctx, userData.ID, page)
 	if err != nil {
 		log.WithError(err).Warning("Could not fetch databases for the authenticated user")
-		return nil, &errs.Error{
+		return nil, "", &errs.Error{
 			Code:    errs.Internal,
 			Message: "Could not fetch databases",
 		}
 	}
 
-	return convert.DatabaseModelsToPayloads(databases), nil
+	return convert.DatabaseModelsToPayloads(databases), nextCursor, nil
 }
 
 // GetDatabase Finds a database by ID
@@ -56,8 +63,40 @@ func GetDatabase(ctx context.Context, id int64) (convert.DatabasePayload, error)
 	return convert.DatabaseModelToPayload(database), nil
 }
 
-// CreateDatabase creates a database for the authenticated user.
-func CreateDatabase(ctx context.Context, name string) (convert.DatabasePayload, error) {
+// GetDatabaseByName finds a database by name
+func GetDatabaseByName(ctx context.Context, name string) (convert.DatabasePayload, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	database, err := helpers.GetDatabaseByName(ctx, name, userData.ID)
+	if err != nil {
+		return convert.DatabasePayload{}, err
+	}
+
+	if !helpers.CanReadDatabase(ctx, database.ID, userData.KeyID) {
+		return convert.DatabasePayload{}, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to read the database",
+		}
+	}
+
+	return convert.DatabaseModelToPayload(database), nil
+}
+
+// validateTrashRetention validates the number of days the items of a database are kept in the trash.
+func validateTrashRetention(days int) error {
+	if days < 1 || days > models.MaxTrashRetentionDays {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("Received trash retention was not valid, it must be between 1 and %d days", models.MaxTrashRetentionDays),
+		}
+	}
+
+	return nil
+}
+
+// CreateDatabase creates a database for the authenticated user. Its deleted items are kept in the trash for
+// the given number of days, or for the default retention when 0.
+func CreateDatabase(ctx context.Context, name string, trashRetentionDays int) (convert.DatabasePayload, error) {
 	userData := auth.Data().(*identity.UserData)
 
 	if !helpers.CanAdmin(ctx, userData.KeyID) {
@@ -68,6 +107,15 @@ func CreateDatabase(ctx context.Context, name string) (convert.DatabasePayload,
 	}
 
 	database := models.NewDatabase(name, userData.ID)
+	if trashRetentionDays != 0 {
+		err := validateTrashRetention(trashRetentionDays)
+		if err != nil {
+			return convert.DatabasePayload{}, err
+		}
+
+		database.TrashRetentionDays = int32(trashRetentionDays)
+	}
+
 	if !models.ValidateDatabaseConstraint(ctx, database) {
 		log.WithFields(map[string]interface{}{
 			"name":    name,
@@ -91,8 +139,9 @@ func CreateDatabase(ctx context.Context, name string) (convert.DatabasePayload,
 	return convert.DatabaseModelToPayload(database), nil
 }
 
-// UpdateDatabase updates a database by ID for the authenticated user
-func UpdateDatabase(ctx context.Context, id int64, name string) (convert.DatabasePayload, error) {
+// UpdateDatabase updates a database by ID for the authenticated user. The trash retention is only updated
+// when given.
+func UpdateDatabase(ctx context.Context, id int64, name string, trashRetentionDays *int) (convert.DatabasePayload, error) {
 	userData := auth.Data().(*identity.UserData)
 
 	database, err := helpers.GetDatabase(ctx, id, userData.ID)
@@ -107,6 +156,15 @@ func UpdateDatabase(ctx context.Context, id int64, name string) (convert.Databas
 		}
 	}
 
+	if trashRetentionDays != nil {
+		err = validateTrashRetention(*trashRetentionDays)
+		if err != nil {
+			return convert.DatabasePayload{}, err
+		}
+
+		database.TrashRetentionDays = int32(*trashRetentionDays)
+	}
+
 	database.Name = name
 	if !models.ValidateDatabaseConstraint(ctx, database) {
 		log.WithFields(map[string]interface{}{
@@ -131,7 +189,8 @@ func UpdateDatabase(ctx context.Context, id int64, name string) (convert.Databas
 	return convert.DatabaseModelToPayload(database), nil
 }
 
-// DeleteDatabase deletes a database by ID for the authenticated user
+// DeleteDatabase moves a database by ID to the trash for the authenticated user, along with its collections
+// and documents
 func DeleteDatabase(ctx context.Context, id int64) (convert.DatabasePayload, error) {
 	userData := auth.Data().(*identity.UserData)
 
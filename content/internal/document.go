@@ -2,7 +2,10 @@ package internal
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 
 	"encore.app/content/helpers"
 	"encore.dev/beta/auth"
@@ -11,29 +14,63 @@ import (
 
 	"encore.app/content/convert"
 	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/query"
 	"encore.app/identity"
+	"encore.app/pagination"
 )
 
-// ListDocuments lists all documents created by the authenticated user for a given collection
-func ListDocuments(ctx context.Context, collectionID int64) ([]convert.DocumentPayload, error) {
+// maxDocumentKeyLength is the maximum length of the key of a document.
+const maxDocumentKeyLength = 255
+
+// NewDocumentRef returns the reference to a document given by a client, by ID, or by key along with
+// the ID of its collection when no ID is given.
+func NewDocumentRef(id, collectionID int64, key string) models.DocumentRef {
+	return models.DocumentRef{
+		ID:           id,
+		CollectionID: collectionID,
+		Key:          key,
+	}
+}
+
+// ListDocuments lists a page of the documents created by the authenticated user for a given collection,
+// optionally filtered using a filter expression on their content, along with the cursor to the next page.
+// The content of the documents is projected when paths to include or exclude are given.
+func ListDocuments(ctx context.Context, collectionID int64, rawFilter json.RawMessage, params pagination.Params, include, exclude []string) ([]convert.DocumentPayload, string, error) {
 	userData := auth.Data().(*identity.UserData)
 
 	collection, err := helpers.GetCollection(ctx, collectionID, userData.ID)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	if !helpers.CanReadDatabase(ctx, collection.DatabaseID, userData.KeyID) {
-		return nil, &errs.Error{
+		return nil, "", &errs.Error{
 			Code:    errs.PermissionDenied,
 			Message: "API key doesn't have the ability to read the database",
 		}
 	}
 
-	documents, err := models.ListDocuments(ctx, collection.ID)
+	filter, err := query.ParseFilter(rawFilter)
+	if err != nil {
+		log.WithError(err).Warning("Could not parse the filter on document request")
+		return nil, "", invalidQueryError("filter", err)
+	}
+
+	projection, err := parseProjection(include, exclude)
+	if err != nil {
+		return nil, "", err
+	}
+
+	page, err := newPage(params, models.DocumentSortKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	documents, nextCursor, err := models.ListDocuments(ctx, collection.ID, filter, page, projection)
 	if err != nil {
 		log.WithError(err).Error("Could not fetch documents for collection")
-		return nil, &errs.Error{
+		return nil, "", &errs.Error{
 			Code:    errs.Internal,
 			Message: "Could not fetch documents",
 		}
@@ -42,20 +79,26 @@ func ListDocuments(ctx context.Context, collectionID int64) ([]convert.DocumentP
 	payload, err := convert.DocumentModelsToPayloads(documents)
 	if err != nil {
 		log.WithError(err).Error("Could not convert documents to API safe version")
-		return nil, &errs.Error{
+		return nil, "", &errs.Error{
 			Code:    errs.Internal,
 			Message: "Could not convert documents for API",
 		}
 	}
 
-	return payload, nil
+	return payload, nextCursor, nil
 }
 
-// GetDocument finds a document by ID
-func GetDocument(ctx context.Context, id int64) (convert.DocumentPayload, error) {
+// GetDocument finds a document by ID or by key, with its content projected when paths to include or
+// exclude are given
+func GetDocument(ctx context.Context, ref models.DocumentRef, include, exclude []string) (convert.DocumentPayload, error) {
 	userData := auth.Data().(*identity.UserData)
 
-	document, err := helpers.GetDocument(ctx, id, userData.ID)
+	projection, err := parseProjection(include, exclude)
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
+	document, err := helpers.GetDocument(ctx, ref, userData.ID)
 	if err != nil {
 		return convert.DocumentPayload{}, err
 	}
@@ -72,6 +115,11 @@ func GetDocument(ctx context.Context, id int64) (convert.DocumentPayload, error)
 		}
 	}
 
+	err = projectDocument(ctx, document, projection)
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
 	payload, err := convert.DocumentModelToPayload(document)
 	if err != nil {
 		log.WithError(err).Error("Could not convert documents to API safe version")
@@ -84,8 +132,74 @@ func GetDocument(ctx context.Context, id int64) (convert.DocumentPayload, error)
 	return payload, nil
 }
 
-// CreateDocument creates a document for the authenticated user
-func CreateDocument(ctx context.Context, collectionID int64, content json.RawMessage) (convert.DocumentPayload, error) {
+// GetDocumentByPath finds a document by its key, the name of its collection and the name of the
+// database of the collection, with its content projected when paths to include or exclude are given
+func GetDocumentByPath(ctx context.Context, databaseName, collectionName, key string, include, exclude []string) (convert.DocumentPayload, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	projection, err := parseProjection(include, exclude)
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
+	collection, err := getCollectionByName(ctx, databaseName, collectionName)
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
+	document, err := helpers.GetDocument(ctx, NewDocumentRef(0, collection.ID, key), userData.ID)
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
+	err = projectDocument(ctx, document, projection)
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
+	payload, err := convert.DocumentModelToPayload(document)
+	if err != nil {
+		log.WithError(err).Error("Could not convert documents to API safe version")
+		return convert.DocumentPayload{}, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not convert document for API",
+		}
+	}
+
+	return payload, nil
+}
+
+// parseProjection parses the paths to include in or exclude from the content of the documents returned
+// by a read request, it returns nil when no path is given.
+func parseProjection(include, exclude []string) (*query.Projection, error) {
+	projection, err := query.ParseProjection(include, exclude)
+	if err != nil {
+		log.WithError(err).Warning("Could not parse the projection on document request")
+		return nil, invalidQueryError("projection", err)
+	}
+
+	return projection, nil
+}
+
+// projectDocument replaces the content of a document with its projection, if any.
+func projectDocument(ctx context.Context, document *model.Documents, projection *query.Projection) error {
+	if projection == nil {
+		return nil
+	}
+
+	err := models.ProjectDocument(ctx, document, projection)
+	if err != nil {
+		return &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not project document",
+		}
+	}
+
+	return nil
+}
+
+// CreateDocument creates a document for the authenticated user, addressable by the given key unless empty
+func CreateDocument(ctx context.Context, collectionID int64, key string, content json.RawMessage) (convert.DocumentPayload, error) {
 	userData := auth.Data().(*identity.UserData)
 
 	collection, err := helpers.GetCollection(ctx, collectionID, userData.ID)
@@ -100,7 +214,12 @@ func CreateDocument(ctx context.Context, collectionID int64, content json.RawMes
 		}
 	}
 
-	_, err = content.MarshalJSON()
+	return createDocument(ctx, collection, key, content)
+}
+
+// createDocument creates a document in a collection the authenticated user was checked to be able to write to.
+func createDocument(ctx context.Context, collection *model.Collections, key string, content json.RawMessage) (convert.DocumentPayload, error) {
+	_, err := content.MarshalJSON()
 	if string(content) == "null" || err != nil {
 		log.WithError(err).Warning("Could not validate JSON on document request")
 		return convert.DocumentPayload{}, &errs.Error{
@@ -109,10 +228,36 @@ func CreateDocument(ctx context.Context, collectionID int64, content json.RawMes
 		}
 	}
 
-	document := models.NewDocument(string(content), collection.ID)
+	err = validateContent(collection, content)
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
 
-	err = models.SaveDocument(ctx, document)
+	err = checkDocumentKey(ctx, collection, key)
 	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
+	err = checkIndexes(ctx, collection, 0, string(content))
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
+	document := models.NewDocument(string(content), collection.ID, key)
+
+	err = models.SaveDocument(ctx, document, nil)
+	if models.IsUniqueViolation(err) {
+		// The key or a unique index conflicts with a document written at the same time
+		err = checkDocumentKey(ctx, collection, key)
+		if err != nil {
+			return convert.DocumentPayload{}, err
+		}
+
+		return convert.DocumentPayload{}, uniqueViolationError(ctx, collection, 0, string(content))
+	} else if models.IsIndexEntryTooLarge(err) {
+		// An index was created since the values of the content were checked
+		return convert.DocumentPayload{}, indexEntryTooLargeError()
+	} else if err != nil {
 		log.WithError(err).Error("Could not save document")
 		return convert.DocumentPayload{}, &errs.Error{
 			Code:    errs.Internal,
@@ -132,11 +277,12 @@ func CreateDocument(ctx context.Context, collectionID int64, content json.RawMes
 	return payload, nil
 }
 
-// UpdateDocument updates a document by ID for the authenticated user
-func UpdateDocument(ctx context.Context, id int64, content json.RawMessage) (convert.DocumentPayload, error) {
+// UpdateDocument updates a document by ID or by key for the authenticated user. When ifVersion is given,
+// the document is only updated if its current version matches.
+func UpdateDocument(ctx context.Context, ref models.DocumentRef, content json.RawMessage, ifVersion *int64) (convert.DocumentPayload, error) {
 	userData := auth.Data().(*identity.UserData)
 
-	document, err := helpers.GetDocument(ctx, id, userData.ID)
+	document, err := helpers.GetDocument(ctx, ref, userData.ID)
 	if err != nil {
 		return convert.DocumentPayload{}, err
 	}
@@ -153,6 +299,18 @@ func UpdateDocument(ctx context.Context, id int64, content json.RawMessage) (con
 		}
 	}
 
+	return updateDocument(ctx, collection, document, content, ifVersion)
+}
+
+// updateDocument updates a document the authenticated user was checked to be able to write to.
+func updateDocument(ctx context.Context, collection *model.Collections, document *model.Documents, content json.RawMessage, ifVersion *int64) (convert.DocumentPayload, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	err := checkVersion(document.Version, ifVersion)
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
 	_, err = content.MarshalJSON()
 	if string(content) == "null" || err != nil {
 		log.WithError(err).Warning("Could not validate JSON on document request")
@@ -162,11 +320,183 @@ func UpdateDocument(ctx context.Context, id int64, content json.RawMessage) (con
 		}
 	}
 
-	document.Content = string(content)
+	err = validateContent(collection, content)
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
 
-	err = models.SaveDocument(ctx, document)
+	err = checkIndexes(ctx, collection, document.ID, string(content))
 	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
+	document.Content = string(content)
+
+	err = models.SaveDocument(ctx, document, ifVersion)
+	if models.IsUniqueViolation(err) {
+		return convert.DocumentPayload{}, uniqueViolationError(ctx, collection, document.ID, string(content))
+	} else if models.IsIndexEntryTooLarge(err) {
+		// An index was created since the values of the content were checked
+		return convert.DocumentPayload{}, indexEntryTooLargeError()
+	} else if err != nil {
 		log.WithError(err).Error("Could not save document")
+		saveErr := &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not save document",
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return convert.DocumentPayload{}, refreshVersionError(ctx, document.ID, userData.ID, ifVersion, saveErr)
+		}
+
+		return convert.DocumentPayload{}, saveErr
+	}
+
+	payload, err := convert.DocumentModelToPayload(document)
+	if err != nil {
+		log.WithError(err).Error("Could not convert document to API safe version")
+		return convert.DocumentPayload{}, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not convert document for API",
+		}
+	}
+
+	return payload, nil
+}
+
+// PatchDocument applies either a JSON Patch, a JSON Merge Patch or update operators to a document by ID
+// or by key for the authenticated user. Only one of the three can be given. When ifVersion is given, the
+// document is only patched if its current version matches.
+func PatchDocument(ctx context.Context, ref models.DocumentRef, jsonPatch, mergePatch, update json.RawMessage, ifVersion *int64) (convert.DocumentPayload, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	document, err := helpers.GetDocument(ctx, ref, userData.ID)
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
+	collection, err := helpers.GetCollection(ctx, document.CollectionID, userData.ID)
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
+	if !helpers.CanWriteDatabase(ctx, collection.DatabaseID, userData.KeyID) {
+		return convert.DocumentPayload{}, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to write to the database",
+		}
+	}
+
+	patch, err := parsePatch(jsonPatch, mergePatch, update)
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
+	return patchDocument(ctx, collection, document, patch, ifVersion)
+}
+
+// parsePatch parses the patch given to patch a document, exactly one of a JSON Patch, a JSON Merge Patch
+// or update operators.
+func parsePatch(jsonPatch, mergePatch, update json.RawMessage) (*query.Patch, error) {
+	given := 0
+	for _, raw := range []json.RawMessage{jsonPatch, mergePatch, update} {
+		if !isEmptyJSON(raw) {
+			given++
+		}
+	}
+
+	if given != 1 {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Received patch was not valid, exactly one of a JSON patch, a merge patch or an update must be given",
+		}
+	}
+
+	if !isEmptyJSON(jsonPatch) {
+		patch, err := query.ParseJSONPatch(jsonPatch)
+		if err != nil {
+			log.WithError(err).Warning("Could not parse the JSON patch on document request")
+			return nil, invalidQueryError("JSON patch", err)
+		}
+
+		return patch, nil
+	}
+
+	if !isEmptyJSON(mergePatch) {
+		patch, err := query.ParseMergePatch(mergePatch)
+		if err != nil {
+			log.WithError(err).Warning("Could not parse the merge patch on document request")
+			return nil, invalidQueryError("merge patch", err)
+		}
+
+		return patch, nil
+	}
+
+	patch, err := query.ParseUpdate(update)
+	if err != nil {
+		log.WithError(err).Warning("Could not parse the update on document request")
+		return nil, invalidQueryError("update", err)
+	}
+
+	return patch, nil
+}
+
+// patchDocument patches a document the authenticated user was checked to be able to write to.
+func patchDocument(ctx context.Context, collection *model.Collections, document *model.Documents, patch *query.Patch, ifVersion *int64) (convert.DocumentPayload, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	err := checkVersion(document.Version, ifVersion)
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
+	// The patched content is validated before the patch is applied, the document is locked meanwhile
+	err = models.RunInSQLTransaction(ctx, func(ctx context.Context) error {
+		content, err := models.PreviewPatch(ctx, document, patch)
+		if err != nil {
+			return err
+		}
+
+		err = validateContent(collection, json.RawMessage(content))
+		if err != nil {
+			return err
+		}
+
+		err = checkIndexes(ctx, collection, document.ID, content)
+		if err != nil {
+			return err
+		}
+
+		return models.PatchDocument(ctx, document, patch, ifVersion)
+	})
+
+	var validationErr *errs.Error
+	if errors.As(err, &validationErr) {
+		return convert.DocumentPayload{}, err
+	} else if models.IsUniqueViolation(err) {
+		// A conflicting document was written at the same time, the patch is applied again without saving to report it
+		content, previewErr := models.PreviewPatch(ctx, document, patch)
+		if previewErr != nil {
+			content = document.Content
+		}
+
+		return convert.DocumentPayload{}, uniqueViolationError(ctx, collection, document.ID, content)
+	} else if models.IsIndexEntryTooLarge(err) {
+		// An index was created since the values of the content were checked
+		return convert.DocumentPayload{}, indexEntryTooLargeError()
+	} else if errors.Is(err, sql.ErrNoRows) {
+		// The database does not tell why a patch could not be applied, update operators are checked against the content
+		mismatch := patch.Mismatch(json.RawMessage(document.Content))
+		if mismatch != nil {
+			return convert.DocumentPayload{}, invalidQueryError("update", mismatch)
+		}
+
+		return convert.DocumentPayload{}, refreshVersionError(ctx, document.ID, userData.ID, ifVersion, &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "Patch could not be applied to the document, a path does not exist or a test failed",
+		})
+	} else if err != nil {
+		log.WithError(err).Error("Could not patch document")
 		return convert.DocumentPayload{}, &errs.Error{
 			Code:    errs.Internal,
 			Message: "Could not save document",
@@ -185,11 +515,12 @@ func UpdateDocument(ctx context.Context, id int64, content json.RawMessage) (con
 	return payload, nil
 }
 
-// DeleteDocument deletes a document by ID for the authenticated user
-func DeleteDocument(ctx context.Context, id int64) (convert.DocumentPayload, error) {
+// DeleteDocument moves a document by ID or by key to the trash for the authenticated user. When ifVersion
+// is given, the document is only deleted if its current version matches.
+func DeleteDocument(ctx context.Context, ref models.DocumentRef, ifVersion *int64) (convert.DocumentPayload, error) {
 	userData := auth.Data().(*identity.UserData)
 
-	document, err := helpers.GetDocument(ctx, id, userData.ID)
+	document, err := helpers.GetDocument(ctx, ref, userData.ID)
 	if err != nil {
 		return convert.DocumentPayload{}, err
 	}
@@ -206,13 +537,31 @@ func DeleteDocument(ctx context.Context, id int64) (convert.DocumentPayload, err
 		}
 	}
 
-	err = models.DeleteDocument(ctx, document)
+	return deleteDocument(ctx, document, ifVersion)
+}
+
+// deleteDocument deletes a document the authenticated user was checked to be able to write to.
+func deleteDocument(ctx context.Context, document *model.Documents, ifVersion *int64) (convert.DocumentPayload, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	err := checkVersion(document.Version, ifVersion)
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
+	err = models.DeleteDocument(ctx, document, ifVersion)
 	if err != nil {
 		log.WithError(err).Error("Could not delete document")
-		return convert.DocumentPayload{}, &errs.Error{
+		deleteErr := &errs.Error{
 			Code:    errs.Internal,
 			Message: "Could not delete document",
 		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return convert.DocumentPayload{}, refreshVersionError(ctx, document.ID, userData.ID, ifVersion, deleteErr)
+		}
+
+		return convert.DocumentPayload{}, deleteErr
 	}
 
 	payload, err := convert.DocumentModelToPayload(document)
@@ -225,3 +574,35 @@ func DeleteDocument(ctx context.Context, id int64) (convert.DocumentPayload, err
 
 	return payload, nil
 }
+
+// checkDocumentKey validates the key of a document about to be created in a collection, and checks no
+// other document of the collection has the same key. Documents without a key are not checked.
+func checkDocumentKey(ctx context.Context, collection *model.Collections, key string) error {
+	if key == "" {
+		return nil
+	}
+
+	if len(key) > maxDocumentKeyLength {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("Received key was not valid, it must contain at most %d characters", maxDocumentKeyLength),
+		}
+	}
+
+	existingID, err := models.FindDocumentByKey(ctx, collection.ID, key)
+	if err != nil {
+		return &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not check the key of the document",
+		}
+	}
+
+	if existingID != 0 {
+		return &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: fmt.Sprintf("A document with key `%s` already exists in this collection", key),
+		}
+	}
+
+	return nil
+}
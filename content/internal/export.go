@@ -0,0 +1,211 @@
+package internal
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/convert"
+	"encore.app/content/helpers"
+	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/query"
+	"encore.app/identity"
+	"encore.app/pagination"
+)
+
+// exportPageSize is the number of documents read at once by an export.
+const exportPageSize = 1000
+
+// CollectionExport writes the documents of a collection, one page at a time, sorted by creation date.
+type CollectionExport struct {
+	collection *model.Collections
+	format     string
+	filter     *query.Filter
+	columns    query.Columns
+	keyColumn  string
+
+	// The cursor to the next page of documents, and whether a page was already written
+	cursor  string
+	started bool
+}
+
+// OpenCollectionExport opens an export of the documents of a collection for the authenticated user, in
+// the NDJSON, JSON or CSV format, only with the documents with a content matching the filter when given.
+// The CSV format requires the mapping of the columns to paths in the content of the documents, and writes
+// the keys of the documents in the key column when given.
+func OpenCollectionExport(ctx context.Context, collectionID int64, format string, rawFilter, rawColumns json.RawMessage, keyColumn string) (*CollectionExport, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	collection, err := helpers.GetCollection(ctx, collectionID, userData.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !helpers.CanReadDatabase(ctx, collection.DatabaseID, userData.KeyID) {
+		return nil, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to read the database",
+		}
+	}
+
+	format, err = parseTransferFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := query.ParseFilter(rawFilter)
+	if err != nil {
+		log.WithError(err).Warning("Could not parse the filter on export request")
+		return nil, invalidQueryError("filter", err)
+	}
+
+	columns, err := parseTransferColumns(format, rawColumns, keyColumn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CollectionExport{
+		collection: collection,
+		format:     format,
+		filter:     filter,
+		columns:    columns,
+		keyColumn:  keyColumn,
+	}, nil
+}
+
+// ContentType returns the content type of the format of the export.
+func (e *CollectionExport) ContentType() string {
+	return transferContentTypes[e.format]
+}
+
+// FileName returns the name of the file of the export, after the collection.
+func (e *CollectionExport) FileName() string {
+	return e.collection.Name + "." + e.format
+}
+
+// Next writes the next page of documents of the export, and returns whether there are more documents to
+// write. The first call writes the start of the file, like the header of a CSV file, and the last one
+// its end.
+func (e *CollectionExport) Next(ctx context.Context, w io.Writer) (bool, error) {
+	page, err := newPage(pagination.Params{Limit: exportPageSize, Cursor: e.cursor}, models.DocumentSortKey)
+	if err != nil {
+		return false, err
+	}
+
+	documents, nextCursor, err := models.ListDocuments(ctx, e.collection.ID, e.filter, page, nil)
+	if err != nil {
+		log.WithError(err).Error("Could not fetch documents for export")
+		return false, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not fetch documents",
+		}
+	}
+
+	switch e.format {
+	case "json":
+		err = e.writeJSON(w, documents, nextCursor == "")
+	case "csv":
+		err = e.writeCSV(w, documents)
+	default:
+		err = e.writeNDJSON(w, documents)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	e.started = true
+	e.cursor = nextCursor
+
+	return nextCursor != "", nil
+}
+
+// writeNDJSON writes the documents as records, one per line.
+func (e *CollectionExport) writeNDJSON(w io.Writer, documents []*model.Documents) error {
+	encoder := json.NewEncoder(w)
+	for _, document := range documents {
+		err := encoder.Encode(convert.DocumentModelToRecord(document))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeJSON writes the documents as records in a JSON array, opened on the first page and closed on the
+// last one.
+func (e *CollectionExport) writeJSON(w io.Writer, documents []*model.Documents, last bool) error {
+	if !e.started {
+		_, err := io.WriteString(w, "[")
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, document := range documents {
+		separator := ",\n"
+		if !e.started && i == 0 {
+			separator = "\n"
+		}
+
+		encoded, err := json.Marshal(convert.DocumentModelToRecord(document))
+		if err != nil {
+			return err
+		}
+
+		_, err = io.WriteString(w, separator+string(encoded))
+		if err != nil {
+			return err
+		}
+	}
+
+	if last {
+		_, err := io.WriteString(w, "\n]\n")
+		return err
+	}
+
+	return nil
+}
+
+// writeCSV writes the documents as rows with a cell for each column, after the header on the first page.
+func (e *CollectionExport) writeCSV(w io.Writer, documents []*model.Documents) error {
+	writer := csv.NewWriter(w)
+
+	if !e.started {
+		header := e.columns.Names()
+		if e.keyColumn != "" {
+			header = append([]string{e.keyColumn}, header...)
+		}
+
+		err := writer.Write(header)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, document := range documents {
+		row := e.columns.Format(json.RawMessage(document.Content))
+		if e.keyColumn != "" {
+			key := ""
+			if document.Key != nil {
+				key = *document.Key
+			}
+
+			row = append([]string{key}, row...)
+		}
+
+		err := writer.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,534 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/convert"
+	"encore.app/content/helpers"
+	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/query"
+	"encore.app/identity"
+)
+
+// importBatchSize is the number of rows read before the pending documents of an import are inserted and
+// its progress reported.
+const importBatchSize = 500
+
+// importErrorModes are the ways an import handles the rows that cannot be imported.
+var importErrorModes = []string{"abort", "skip"}
+
+// importRecord is a row read from the file of an import. A row that cannot be read has an error instead of
+// a content.
+type importRecord struct {
+	row     int64
+	key     string
+	content json.RawMessage
+	err     error
+}
+
+// recordReader reads the rows of the file of an import, one at a time. It returns io.EOF once every row
+// is read, and an error when the file cannot be read any further.
+type recordReader interface {
+	read() (importRecord, error)
+}
+
+// invalidRowError creates the error of a row that cannot be read.
+func invalidRowError(reason string) error {
+	return &errs.Error{
+		Code:    errs.InvalidArgument,
+		Message: fmt.Sprintf("Received row was not valid, %s", reason),
+	}
+}
+
+// parseDocumentRecord parses a row of an NDJSON or JSON file, a record with a key and a content. The other
+// fields of the records written by an export are ignored.
+func parseDocumentRecord(row int64, raw json.RawMessage) importRecord {
+	record := struct {
+		Key     string
+		Content json.RawMessage
+	}{}
+	err := json.Unmarshal(raw, &record)
+	if err != nil {
+		return importRecord{row: row, err: invalidRowError("it must be an object with a `Key` and a `Content`")}
+	}
+
+	if isEmptyJSON(record.Content) {
+		return importRecord{row: row, key: record.Key, err: &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Received JSON string for content was not valid",
+		}}
+	}
+
+	return importRecord{row: row, key: record.Key, content: record.Content}
+}
+
+// ndjsonReader reads the records of an NDJSON file, one per line. Empty lines are ignored.
+type ndjsonReader struct {
+	reader *bufio.Reader
+	row    int64
+}
+
+func (r *ndjsonReader) read() (importRecord, error) {
+	for {
+		line, err := r.reader.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return importRecord{}, err
+		}
+
+		r.row++
+		if len(bytes.TrimSpace(line)) > 0 {
+			return parseDocumentRecord(r.row, line), nil
+		}
+
+		if err == io.EOF {
+			return importRecord{}, io.EOF
+		}
+	}
+}
+
+// jsonArrayReader reads the records of a JSON array, one item at a time. The opening bracket of the
+// array is read when the import is opened.
+type jsonArrayReader struct {
+	decoder *json.Decoder
+	row     int64
+}
+
+func (r *jsonArrayReader) read() (importRecord, error) {
+	if !r.decoder.More() {
+		_, err := r.decoder.Token()
+		if err != nil {
+			return importRecord{}, err
+		}
+
+		return importRecord{}, io.EOF
+	}
+
+	var raw json.RawMessage
+	err := r.decoder.Decode(&raw)
+	if err != nil {
+		return importRecord{}, err
+	}
+
+	r.row++
+	return parseDocumentRecord(r.row, raw), nil
+}
+
+// csvReader reads the rows of a CSV file, building the content of the documents from the cells of the
+// mapped columns. The header of the file is read when the import is opened.
+type csvReader struct {
+	reader  *csv.Reader
+	columns query.Columns
+
+	// The indexes of the mapped columns and of the key column in the header, -1 when there is no key column
+	indexes  []int
+	keyIndex int
+
+	row int64
+}
+
+func (r *csvReader) read() (importRecord, error) {
+	cells, err := r.reader.Read()
+	if err == io.EOF {
+		return importRecord{}, io.EOF
+	}
+
+	parseErr := &csv.ParseError{}
+	if errors.As(err, &parseErr) {
+		r.row++
+		return importRecord{row: r.row, err: invalidRowError(parseErr.Err.Error())}, nil
+	} else if err != nil {
+		return importRecord{}, err
+	}
+
+	r.row++
+	record := importRecord{row: r.row}
+	if r.keyIndex >= 0 {
+		record.key = cells[r.keyIndex]
+	}
+
+	values := make([]string, len(r.indexes))
+	for i, index := range r.indexes {
+		values[i] = cells[index]
+	}
+
+	record.content, err = r.columns.Build(values)
+	if err != nil {
+		record.err = invalidRowError(err.Error())
+	}
+
+	return record, nil
+}
+
+// newCSVReader reads the header of a CSV file, and checks every mapped column and the key column when
+// given are in it.
+func newCSVReader(body io.Reader, columns query.Columns, keyColumn string) (*csvReader, error) {
+	reader := csv.NewReader(body)
+
+	header, err := reader.Read()
+	if err != nil {
+		log.WithError(err).Warning("Could not read the header of the CSV file to import")
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Received body was not valid, the header of the CSV file could not be read",
+		}
+	}
+
+	positions := map[string]int{}
+	for i, name := range header {
+		positions[name] = i
+	}
+
+	parsed := &csvReader{
+		reader:   reader,
+		columns:  columns,
+		indexes:  make([]int, len(columns)),
+		keyIndex: -1,
+	}
+
+	for i, column := range columns {
+		index, ok := positions[column.Name]
+		if !ok {
+			return nil, &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: fmt.Sprintf("Received columns were not valid, column `%s` is not in the header of the file", column.Name),
+			}
+		}
+
+		parsed.indexes[i] = index
+	}
+
+	if keyColumn != "" {
+		index, ok := positions[keyColumn]
+		if !ok {
+			return nil, &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: fmt.Sprintf("Received key column was not valid, column `%s` is not in the header of the file", keyColumn),
+			}
+		}
+
+		parsed.keyIndex = index
+	}
+
+	return parsed, nil
+}
+
+// importBatch is the documents of an import waiting to be inserted together, along with their keys.
+type importBatch struct {
+	documents []*model.Documents
+	keys      map[string]bool
+}
+
+// CollectionImport imports the rows of a file as documents of a collection, one batch at a time.
+type CollectionImport struct {
+	collection *model.Collections
+	format     string
+	columns    query.Columns
+	keyColumn  string
+	reader     recordReader
+	skip       bool
+	upsert     bool
+
+	// Whether the documents are inserted in batches, they are created one at a time when the collection has
+	// unique indexes so that conflicting rows are reported
+	batched bool
+
+	pending  importBatch
+	progress convert.ImportProgress
+}
+
+// OpenCollectionImport opens an import of the rows of a file in the NDJSON, JSON or CSV format as
+// documents of a collection for the authenticated user. The CSV format requires the mapping of the columns
+// to paths in the content of the documents, and reads the keys of the documents from the key column when
+// given. Rows that cannot be imported abort the import, or are skipped when onError is `skip`. When upsert
+// is true, the documents with the key of a row are replaced by its content instead of failing. Documents in
+// the trash are left as they are, a document is created for the row instead.
+//
+// The file is not read until Start is called, so that the collection and the parameters of the import are
+// checked before its body is received.
+func OpenCollectionImport(ctx context.Context, collectionID int64, format string, rawColumns json.RawMessage, keyColumn, onError string, upsert bool) (*CollectionImport, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	collection, err := helpers.GetCollection(ctx, collectionID, userData.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !helpers.CanWriteDatabase(ctx, collection.DatabaseID, userData.KeyID) {
+		return nil, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to write to the database",
+		}
+	}
+
+	format, err = parseTransferFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
+	if onError == "" {
+		onError = "abort"
+	}
+
+	if !stringIn(onError, importErrorModes) {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("Received error mode was not valid, `%s` is not one of `abort`, `skip`", onError),
+		}
+	}
+
+	columns, err := parseTransferColumns(format, rawColumns, keyColumn)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes, err := models.ListIndexes(ctx, collection.ID)
+	if err != nil {
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not fetch indexes",
+		}
+	}
+
+	batched := true
+	for _, index := range indexes {
+		if index.IsUnique && index.Status != models.IndexFailed {
+			batched = false
+		}
+	}
+
+	return &CollectionImport{
+		collection: collection,
+		format:     format,
+		columns:    columns,
+		keyColumn:  keyColumn,
+		skip:       onError == "skip",
+		upsert:     upsert,
+		batched:    batched,
+		pending:    importBatch{keys: map[string]bool{}},
+		progress:   convert.ImportProgress{Status: "importing"},
+	}, nil
+}
+
+// Start starts reading the rows of the file of the import from its body. The opening bracket of a JSON
+// array and the header of a CSV file are read right away.
+func (i *CollectionImport) Start(body io.Reader) error {
+	switch i.format {
+	case "json":
+		decoder := json.NewDecoder(body)
+		token, err := decoder.Token()
+		if err != nil || token != json.Delim('[') {
+			return &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: "Received body was not valid, it must be a JSON array",
+			}
+		}
+
+		i.reader = &jsonArrayReader{decoder: decoder}
+	case "csv":
+		reader, err := newCSVReader(body, i.columns, i.keyColumn)
+		if err != nil {
+			return err
+		}
+
+		i.reader = reader
+	default:
+		i.reader = &ndjsonReader{reader: bufio.NewReader(body)}
+	}
+
+	return nil
+}
+
+// Next imports the next batch of rows and returns the progress of the import, with the rows of the batch
+// that could not be imported. The import is over once the status of the progress is no longer
+// `importing`. When an import is aborted, the rows before the one aborting it are kept.
+func (i *CollectionImport) Next(ctx context.Context) convert.ImportProgress {
+	i.progress.Errors = nil
+	if i.progress.Status != "importing" {
+		return i.progress
+	}
+
+	for read := 0; read < importBatchSize; read++ {
+		record, err := i.reader.read()
+		if err == io.EOF {
+			i.progress.Status = "done"
+			break
+		} else if err != nil {
+			log.WithError(err).Warning("Could not read the body of the import")
+			i.abort(ctx, fmt.Sprintf("Received body was not valid after row %d, %s", i.progress.Read, err.Error()))
+			return i.progress
+		}
+
+		i.progress.Read++
+
+		err = i.importRecord(ctx, record)
+		// Internal errors and the errors inserting the pending documents are not caused by the row
+		rowErr := &errs.Error{}
+		if errors.As(err, &rowErr) && rowErr.Code != errs.Internal {
+			i.progress.Errors = append(i.progress.Errors, convert.ImportRowError{
+				Row:     record.row,
+				Key:     record.key,
+				Message: rowErr.Message,
+			})
+
+			if !i.skip {
+				i.abort(ctx, fmt.Sprintf("Row %d could not be imported", record.row))
+				return i.progress
+			}
+
+			i.progress.Skipped++
+		} else if err != nil {
+			i.abort(ctx, errorMessage(err))
+			return i.progress
+		}
+	}
+
+	err := i.flush(ctx)
+	if err != nil {
+		i.progress.Status = "aborted"
+		i.progress.Error = errorMessage(err)
+	}
+
+	return i.progress
+}
+
+// abort stops the import after inserting the pending documents.
+func (i *CollectionImport) abort(ctx context.Context, reason string) {
+	err := i.flush(ctx)
+	if err != nil {
+		reason = errorMessage(err)
+	}
+
+	i.progress.Status = "aborted"
+	i.progress.Error = reason
+}
+
+// errorMessage returns the message of an error to report to the client.
+func errorMessage(err error) string {
+	encoreErr := &errs.Error{}
+	if errors.As(err, &encoreErr) {
+		return encoreErr.Message
+	}
+
+	return err.Error()
+}
+
+// importRecord imports a row, either by adding its document to the pending batch, or by creating or
+// updating its document right away. The pending documents are inserted first when the row is written
+// right away so that the rows are written in order.
+func (i *CollectionImport) importRecord(ctx context.Context, record importRecord) error {
+	if record.err != nil {
+		return record.err
+	}
+
+	if record.key != "" && i.pending.keys[record.key] {
+		if !i.upsert {
+			return &errs.Error{
+				Code:    errs.AlreadyExists,
+				Message: fmt.Sprintf("A document with key `%s` already exists in this collection", record.key),
+			}
+		}
+
+		err := i.flush(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if i.upsert && record.key != "" && len(record.key) <= maxDocumentKeyLength {
+		existingID, err := models.FindDocumentByKey(ctx, i.collection.ID, record.key)
+		if err != nil {
+			return &errs.Error{
+				Code:    errs.Internal,
+				Message: "Could not check the key of the document",
+			}
+		}
+
+		if existingID != 0 {
+			return i.updateRecord(ctx, existingID, record)
+		}
+	}
+
+	if !i.batched {
+		_, err := createDocument(ctx, i.collection, record.key, record.content)
+		if err != nil {
+			return err
+		}
+
+		i.progress.Inserted++
+		return nil
+	}
+
+	err := validateContent(i.collection, record.content)
+	if err != nil {
+		return err
+	}
+
+	err = checkDocumentKey(ctx, i.collection, record.key)
+	if err != nil {
+		return err
+	}
+
+	i.pending.documents = append(i.pending.documents, models.NewDocument(string(record.content), i.collection.ID, record.key))
+	if record.key != "" {
+		i.pending.keys[record.key] = true
+	}
+
+	return nil
+}
+
+// updateRecord replaces the content of the existing document with the key of a row.
+func (i *CollectionImport) updateRecord(ctx context.Context, documentID int64, record importRecord) error {
+	userData := auth.Data().(*identity.UserData)
+
+	err := i.flush(ctx)
+	if err != nil {
+		return err
+	}
+
+	document, err := helpers.GetDocument(ctx, models.DocumentByID(documentID), userData.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = updateDocument(ctx, i.collection, document, record.content, nil)
+	if err != nil {
+		return err
+	}
+
+	i.progress.Updated++
+	return nil
+}
+
+// flush inserts the pending documents of the import in a single statement. Its errors are not the errors
+// of a row, they abort the import.
+func (i *CollectionImport) flush(ctx context.Context) error {
+	if len(i.pending.documents) == 0 {
+		return nil
+	}
+
+	err := models.InsertDocuments(ctx, i.pending.documents)
+	if models.IsUniqueViolation(err) {
+		return fmt.Errorf("Could not import the rows before row %d, a key conflicts with a document written at the same time", i.progress.Read)
+	} else if models.IsIndexEntryTooLarge(err) {
+		return fmt.Errorf("Could not import the rows before row %d, a row has values at the paths of an index larger than %d bytes", i.progress.Read, MaxIndexedValueSize)
+	} else if err != nil {
+		return errors.New("Could not save documents")
+	}
+
+	i.progress.Inserted += int64(len(i.pending.documents))
+	i.pending = importBatch{keys: map[string]bool{}}
+
+	return nil
+}
@@ -0,0 +1,356 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/convert"
+	"encore.app/content/helpers"
+	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/query"
+	"encore.app/identity"
+)
+
+// MaxIndexes is the maximum number of indexes of a collection.
+const MaxIndexes = 16
+
+// MaxIndexPaths is the maximum number of paths of a compound index.
+const MaxIndexPaths = 8
+
+// maxIndexNameLength is the maximum length of the name of an index.
+const maxIndexNameLength = 255
+
+// backgroundBuildThreshold is the number of documents above which an index is built in the background,
+// its status tells when it is ready. Indexes of smaller collections are built before being returned.
+const backgroundBuildThreshold = 10000
+
+// indexBuildLease is how long an index can go without being touched while building before its build is
+// considered stopped, it must be well above the heartbeat of the builds.
+const indexBuildLease = 10 * models.IndexBuildHeartbeat
+
+// maxIndexBuildsPerRun is the maximum number of stopped builds resumed by a run of ResumeIndexBuilds.
+const maxIndexBuildsPerRun = 4
+
+// MaxIndexedValueSize is the maximum size in bytes of the values of a document at the paths of a B-tree index.
+// Postgres cannot store a B-tree entry larger than about a third of a page, the limit leaves room for the
+// overhead of the entry.
+const MaxIndexedValueSize = 2048
+
+// ListIndexes lists the indexes of a collection, sorted by name.
+func ListIndexes(ctx context.Context, collectionID int64) ([]convert.IndexPayload, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	collection, err := helpers.GetCollection(ctx, collectionID, userData.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !helpers.CanReadDatabase(ctx, collection.DatabaseID, userData.KeyID) {
+		return nil, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to read the database",
+		}
+	}
+
+	indexes, err := models.ListIndexes(ctx, collection.ID)
+	if err != nil {
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not fetch indexes",
+		}
+	}
+
+	return convert.IndexModelsToPayloads(indexes), nil
+}
+
+// CreateIndex declares an index on paths of the content of the documents of a collection, and builds
+// it. Indexes of large collections are built in the background and returned while still building.
+func CreateIndex(ctx context.Context, collectionID int64, name string, rawPaths []string, unique bool, method string) (convert.IndexPayload, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	collection, err := helpers.GetCollection(ctx, collectionID, userData.ID)
+	if err != nil {
+		return convert.IndexPayload{}, err
+	}
+
+	if !helpers.CanWriteDatabase(ctx, collection.DatabaseID, userData.KeyID) {
+		return convert.IndexPayload{}, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to write to the database",
+		}
+	}
+
+	index, err := newIndex(collection, name, rawPaths, unique, method)
+	if err != nil {
+		return convert.IndexPayload{}, err
+	}
+
+	indexes, err := models.ListIndexes(ctx, collection.ID)
+	if err != nil {
+		return convert.IndexPayload{}, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not fetch indexes",
+		}
+	}
+
+	for _, existing := range indexes {
+		if existing.Name == index.Name {
+			return convert.IndexPayload{}, &errs.Error{
+				Code:    errs.AlreadyExists,
+				Message: fmt.Sprintf("An index with name `%s` already exists in this collection", index.Name),
+			}
+		}
+	}
+
+	if len(indexes) >= MaxIndexes {
+		return convert.IndexPayload{}, &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: fmt.Sprintf("Could not create index, a collection can have at most %d indexes", MaxIndexes),
+		}
+	}
+
+	if index.IsUnique {
+		err = checkDuplicates(ctx, index)
+		if err != nil {
+			return convert.IndexPayload{}, err
+		}
+	}
+
+	count, err := models.CountDocuments(ctx, collection.ID)
+	if err != nil {
+		return convert.IndexPayload{}, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not count documents",
+		}
+	}
+
+	err = models.SaveIndex(ctx, index)
+	if err != nil {
+		return convert.IndexPayload{}, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not save index",
+		}
+	}
+
+	if count > backgroundBuildThreshold {
+		// The build outlives the request, it cannot use its context
+		go buildIndex(context.Background(), index)
+		return convert.IndexModelToPayload(index), nil
+	}
+
+	err = models.BuildIndex(ctx, index)
+	if err != nil {
+		return convert.IndexPayload{}, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not build index",
+		}
+	}
+
+	return convert.IndexModelToPayload(index), nil
+}
+
+// DropIndex drops an index of a collection by name. Indexes cannot be dropped while building, unless their
+// build stopped.
+func DropIndex(ctx context.Context, collectionID int64, name string) (convert.IndexPayload, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	collection, err := helpers.GetCollection(ctx, collectionID, userData.ID)
+	if err != nil {
+		return convert.IndexPayload{}, err
+	}
+
+	if !helpers.CanWriteDatabase(ctx, collection.DatabaseID, userData.KeyID) {
+		return convert.IndexPayload{}, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to write to the database",
+		}
+	}
+
+	index, err := helpers.GetIndex(ctx, collection.ID, name)
+	if err != nil {
+		return convert.IndexPayload{}, err
+	}
+
+	if index.Status == models.IndexBuilding && !isStaleIndexBuild(index, time.Now()) {
+		return convert.IndexPayload{}, &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "Could not drop index, it is still building",
+		}
+	}
+
+	err = models.DeleteIndex(ctx, index)
+	if err != nil {
+		return convert.IndexPayload{}, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not drop index",
+		}
+	}
+
+	return convert.IndexModelToPayload(index), nil
+}
+
+// newIndex validates the declaration of an index sent by a client.
+func newIndex(collection *model.Collections, name string, rawPaths []string, unique bool, method string) (*model.CollectionIndexes, error) {
+	if name == "" || len(name) > maxIndexNameLength {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("Received name was not valid, it must contain between 1 and %d characters", maxIndexNameLength),
+		}
+	}
+
+	if method == "" {
+		method = models.IndexBTree
+	}
+	if method != models.IndexBTree && method != models.IndexGIN {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("Received method `%s` was not valid, must be one of btree or gin", method),
+		}
+	}
+
+	if len(rawPaths) == 0 || len(rawPaths) > MaxIndexPaths {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("Received paths were not valid, an index must have between 1 and %d paths", MaxIndexPaths),
+		}
+	}
+
+	paths := make([]query.Path, len(rawPaths))
+	seen := map[string]bool{}
+	for i, rawPath := range rawPaths {
+		path, err := query.ParsePath(rawPath)
+		if err != nil {
+			return nil, &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: fmt.Sprintf("Received paths were not valid, %s", err),
+			}
+		}
+
+		if seen[path.String()] {
+			return nil, &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: fmt.Sprintf("Received paths were not valid, path `%s` is given more than once", path),
+			}
+		}
+
+		seen[path.String()] = true
+		paths[i] = path
+	}
+
+	if method == models.IndexGIN && (unique || len(paths) > 1) {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Received method `gin` was not valid, a gin index cannot be unique or have several paths",
+		}
+	}
+
+	return models.NewIndex(collection.ID, name, paths, unique, method), nil
+}
+
+// buildIndex builds an index in the background, its status tells the result of the build.
+func buildIndex(ctx context.Context, index *model.CollectionIndexes) {
+	err := models.BuildIndex(ctx, index)
+	if err != nil {
+		log.WithError(err).Errorf("Could not build index %d in the background", index.ID)
+	}
+}
+
+// isStaleIndexBuild tells if an index is building but was not touched since the lease, its build stopped
+// without updating its status.
+func isStaleIndexBuild(index *model.CollectionIndexes, now time.Time) bool {
+	return index.Status == models.IndexBuilding && index.UpdatedAt.Before(now.Add(-indexBuildLease))
+}
+
+// ResumeIndexBuilds builds again the indexes whose build stopped without updating their status, when the
+// instance building them stopped or the request building them was canceled. Returns the number of builds
+// resumed.
+func ResumeIndexBuilds(ctx context.Context) (int64, error) {
+	indexes, err := models.ClaimStaleIndexBuilds(ctx, time.Now(), indexBuildLease, maxIndexBuildsPerRun)
+	if err != nil {
+		return 0, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not claim the stale index builds",
+		}
+	}
+
+	resumed := int64(0)
+	for _, index := range indexes {
+		err = models.RebuildIndex(ctx, index)
+		if err != nil {
+			return resumed, &errs.Error{
+				Code:    errs.Internal,
+				Message: "Could not build index",
+			}
+		}
+
+		resumed++
+	}
+
+	return resumed, nil
+}
+
+// checkIndexedValues checks that the values of the content at the paths of each B-tree index of a collection are
+// at most MaxIndexedValueSize bytes, as postgres rejects the writes of entries too large to be indexed. Indexes
+// that could not be built are not checked.
+func checkIndexedValues(indexes []*model.CollectionIndexes, content json.RawMessage) error {
+	for _, index := range indexes {
+		if index.Method == models.IndexGIN || index.Status == models.IndexFailed {
+			continue
+		}
+
+		paths, err := models.IndexPaths(index)
+		if err != nil {
+			log.WithError(err).Errorf("Could not read the paths of index %d", index.ID)
+			return &errs.Error{
+				Code:    errs.Internal,
+				Message: "Could not fetch indexes",
+			}
+		}
+
+		size := 0
+		for _, path := range paths {
+			value, ok := path.Find(content)
+			if !ok {
+				continue
+			}
+
+			var compacted bytes.Buffer
+			if json.Compact(&compacted, value) == nil {
+				value = compacted.Bytes()
+			}
+			size += len(value)
+		}
+
+		if size > MaxIndexedValueSize {
+			return indexedValueTooLargeError(index)
+		}
+	}
+
+	return nil
+}
+
+// indexedValueTooLargeError creates the error returned when the values of a document at the paths of an index
+// are too large to be indexed.
+func indexedValueTooLargeError(index *model.CollectionIndexes) error {
+	return &errs.Error{
+		Code:    errs.InvalidArgument,
+		Message: fmt.Sprintf("Received content was not valid, its values at the paths of the index `%s` are larger than %d bytes", index.Name, MaxIndexedValueSize),
+	}
+}
+
+// indexEntryTooLargeError creates the error returned when postgres rejected a write on an index the values of
+// the document were too large for.
+func indexEntryTooLargeError() error {
+	return &errs.Error{
+		Code:    errs.InvalidArgument,
+		Message: fmt.Sprintf("Received content was not valid, its values at the paths of an index are larger than %d bytes", MaxIndexedValueSize),
+	}
+}
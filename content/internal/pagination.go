@@ -0,0 +1,29 @@
+package internal
+
+import (
+	"fmt"
+
+	"encore.dev/beta/errs"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/pagination"
+)
+
+// newPage validates the pagination parameters of a list request against the sort keys
+// available for the listed records, and creates the page to fetch.
+func newPage(params pagination.Params, sortKey func(sortBy string) (pagination.SortKey, error)) (*pagination.Page, error) {
+	key, err := sortKey(params.SortBy)
+	if err == nil {
+		var page *pagination.Page
+		page, err = pagination.NewPage(params, key)
+		if err == nil {
+			return page, nil
+		}
+	}
+
+	log.WithError(err).Warning("Could not validate the pagination of the list request")
+	return nil, &errs.Error{
+		Code:    errs.InvalidArgument,
+		Message: fmt.Sprintf("Received pagination was not valid, %s", err.Error()),
+	}
+}
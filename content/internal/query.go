@@ -0,0 +1,36 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"encore.dev/beta/errs"
+
+	"encore.app/content/query"
+)
+
+// invalidQueryError converts an error returned when parsing a query expression into an encore
+// error, with the details of the invalid clause if available.
+func invalidQueryError(name string, err error) error {
+	queryErr := &query.Error{}
+	if errors.As(err, &queryErr) {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("Received %s was not valid, %s", name, queryErr.Error()),
+			Details: queryErr,
+		}
+	}
+
+	return &errs.Error{
+		Code:    errs.InvalidArgument,
+		Message: fmt.Sprintf("Received %s was not valid", name),
+	}
+}
+
+// isEmptyJSON returns whether a raw JSON value was omitted from a request, either missing or null.
+func isEmptyJSON(raw json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(raw)
+	return len(trimmed) == 0 || string(trimmed) == "null"
+}
@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"github.com/go-jet/jet/v2/qrm"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/convert"
+	"encore.app/content/helpers"
+	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/query"
+	"encore.app/identity"
+	"encore.app/pagination"
+)
+
+// historyDocument finds a document by ID for the authenticated user, along with its collection, and checks
+// the collection keeps the history of its documents. The API key must be able to read the database, or to
+// write to it when write is set.
+func historyDocument(ctx context.Context, documentID int64, write bool) (*model.Collections, *model.Documents, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	document, err := helpers.GetDocument(ctx, models.DocumentByID(documentID), userData.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	collection, err := helpers.GetCollection(ctx, document.CollectionID, userData.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if write && !helpers.CanWriteDatabase(ctx, collection.DatabaseID, userData.KeyID) {
+		return nil, nil, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to write to the database",
+		}
+	}
+
+	if !write && !helpers.CanReadDatabase(ctx, collection.DatabaseID, userData.KeyID) {
+		return nil, nil, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to read the database",
+		}
+	}
+
+	if !collection.History {
+		return nil, nil, &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "Collection does not keep the history of its documents",
+		}
+	}
+
+	return collection, document, nil
+}
+
+// getRevision fetches the revision of a document at the given version.
+func getRevision(ctx context.Context, documentID, version int64) (*model.DocumentRevisions, error) {
+	revision, err := models.GetDocumentRevision(ctx, documentID, version)
+	if errors.Is(err, qrm.ErrNoRows) {
+		log.WithError(err).Warningf("Could not find revision %d of document %d", version, documentID)
+		return nil, &errs.Error{
+			Code:    errs.NotFound,
+			Message: fmt.Sprintf("Could not find version %d of the document", version),
+		}
+	} else if err != nil {
+		log.WithError(err).Error("Could not find revision")
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not find revision, unknown error",
+		}
+	}
+
+	return revision, nil
+}
+
+// ListDocumentRevisions lists a page of the revisions of a document by ID for the authenticated user, from
+// the most recent one, along with the cursor to the next page. Only the committed versions are recorded.
+func ListDocumentRevisions(ctx context.Context, documentID int64, params pagination.Params) ([]convert.RevisionPayload, string, error) {
+	_, document, err := historyDocument(ctx, documentID, false)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Revisions are always sorted by decreasing version
+	params.Descending = true
+	page, err := newPage(params, func(sortBy string) (pagination.SortKey, error) {
+		return models.RevisionSortKey(), nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	revisions, nextCursor, err := models.ListDocumentRevisions(ctx, document.ID, page)
+	if err != nil {
+		log.WithError(err).Error("Could not list revisions for document")
+		return nil, "", &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not list revisions",
+		}
+	}
+
+	payload, err := convert.RevisionModelsToPayloads(revisions)
+	if err != nil {
+		log.WithError(err).Error("Could not convert revisions to API safe version")
+		return nil, "", &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not convert revisions for API",
+		}
+	}
+
+	return payload, nextCursor, nil
+}
+
+// GetDocumentRevision finds the revision of a document by ID at the given version for the authenticated user.
+func GetDocumentRevision(ctx context.Context, documentID, version int64) (convert.RevisionPayload, error) {
+	_, document, err := historyDocument(ctx, documentID, false)
+	if err != nil {
+		return convert.RevisionPayload{}, err
+	}
+
+	revision, err := getRevision(ctx, document.ID, version)
+	if err != nil {
+		return convert.RevisionPayload{}, err
+	}
+
+	payload, err := convert.RevisionModelToPayload(revision)
+	if err != nil {
+		log.WithError(err).Error("Could not convert revision to API safe version")
+		return convert.RevisionPayload{}, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not convert revision for API",
+		}
+	}
+
+	return payload, nil
+}
+
+// DiffDocumentRevisions compares two revisions of a document by ID for the authenticated user, returning the
+// JSON Patch transforming the content of the document at the from version into its content at the to version.
+func DiffDocumentRevisions(ctx context.Context, documentID, from, to int64) ([]query.DiffOperation, error) {
+	_, document, err := historyDocument(ctx, documentID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	fromRevision, err := getRevision(ctx, document.ID, from)
+	if err != nil {
+		return nil, err
+	}
+
+	toRevision, err := getRevision(ctx, document.ID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	operations, err := query.Diff(json.RawMessage(fromRevision.Content), json.RawMessage(toRevision.Content))
+	if err != nil {
+		log.WithError(err).Errorf("Could not compare revisions %d and %d of document %d", from, to, document.ID)
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not compare revisions",
+		}
+	}
+
+	return operations, nil
+}
+
+// RestoreDocumentRevision sets the content of a document by ID back to its content at the given version for
+// the authenticated user. The restored content is written as a new version of the document, it must match the
+// schema and unique indexes of the collection. When ifVersion is given, the document is only restored if its
+// current version matches.
+func RestoreDocumentRevision(ctx context.Context, documentID, version int64, ifVersion *int64) (convert.DocumentPayload, error) {
+	collection, document, err := historyDocument(ctx, documentID, true)
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
+	revision, err := getRevision(ctx, document.ID, version)
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
+	return updateDocument(ctx, collection, document, json.RawMessage(revision.Content), ifVersion)
+}
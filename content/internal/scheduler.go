@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/models"
+)
+
+// ScheduledJob is a job run periodically by a scheduler.
+type ScheduledJob struct {
+	// The name of the job, every instance running the job must use the same name
+	Name string
+
+	// The time between two runs of the job
+	Interval time.Duration
+
+	Run func(ctx context.Context) error
+}
+
+// Scheduler runs jobs periodically in the background. Every instance of the service runs a scheduler, and
+// a run is skipped while another instance is running the same job, so that a job is run by one instance at
+// a time.
+type Scheduler struct {
+	jobs []ScheduledJob
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewScheduler creates a scheduler of the jobs, which must be started to run them.
+func NewScheduler(jobs ...ScheduledJob) *Scheduler {
+	return &Scheduler{jobs: jobs}
+}
+
+// Start runs each job of the scheduler once, then again after each interval of the job, until the scheduler
+// is stopped. Starting a scheduler that is already started does nothing.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go func(job ScheduledJob) {
+			defer s.wg.Done()
+			s.schedule(ctx, job)
+		}(job)
+	}
+}
+
+// Stop stops the scheduler, and waits for the runs in progress to end.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel == nil {
+		return
+	}
+
+	s.cancel()
+	s.wg.Wait()
+	s.cancel = nil
+}
+
+// schedule runs a job after each of its intervals until the context is canceled.
+func (s *Scheduler) schedule(ctx context.Context, job ScheduledJob) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		runScheduledJob(ctx, job)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runScheduledJob runs a job unless another instance is running it.
+func runScheduledJob(ctx context.Context, job ScheduledJob) {
+	ran, err := models.RunExclusively(ctx, "scheduler:"+job.Name, job.Run)
+	if err != nil && ctx.Err() == nil {
+		log.WithError(err).Errorf("Could not run scheduled job %s", job.Name)
+	} else if !ran {
+		log.Debugf("Skipped scheduled job %s, another instance is running it", job.Name)
+	}
+}
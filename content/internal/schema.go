@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+
+	"encore.dev/beta/errs"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/convert"
+	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/query"
+	"encore.app/pagination"
+)
+
+// maxReportedViolations is the maximum number of documents listed when reporting the documents that
+// do not match a schema.
+const maxReportedViolations = 100
+
+// SchemaViolations is the details of the error returned when the content of a document does not
+// match the schema of its collection.
+type SchemaViolations struct {
+	// Each location of the content that does not match the schema
+	Violations []query.Error
+}
+
+// ErrDetails marks SchemaViolations as usable in the details of an encore error.
+func (v *SchemaViolations) ErrDetails() {}
+
+// DocumentsSchemaViolations is the details of the error returned when a schema is attached to a
+// collection containing documents that do not match it.
+type DocumentsSchemaViolations struct {
+	// The documents that do not match the schema, at most 100 of them
+	Documents []convert.DocumentViolations
+}
+
+// ErrDetails marks DocumentsSchemaViolations as usable in the details of an encore error.
+func (v *DocumentsSchemaViolations) ErrDetails() {}
+
+// parseSchema parses a schema sent by a client for a collection.
+func parseSchema(raw json.RawMessage) (*query.Schema, error) {
+	schema, err := query.ParseSchema(raw)
+	if err != nil {
+		log.WithError(err).Warning("Could not parse the schema on collection request")
+		return nil, invalidQueryError("schema", err)
+	}
+
+	return schema, nil
+}
+
+// collectionSchema returns the parsed schema of a collection, or nil if the collection has no schema.
+func collectionSchema(collection *model.Collections) (*query.Schema, error) {
+	if collection.Schema == nil {
+		return nil, nil
+	}
+
+	schema, err := query.ParseSchema(json.RawMessage(*collection.Schema))
+	if err != nil {
+		log.WithError(err).Errorf("Could not parse the stored schema of collection %d", collection.ID)
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not parse the schema of the collection",
+		}
+	}
+
+	return schema, nil
+}
+
+// validateContent validates the content of a document against the schema of its collection, if any.
+func validateContent(collection *model.Collections, content json.RawMessage) error {
+	schema, err := collectionSchema(collection)
+	if err != nil || schema == nil {
+		return err
+	}
+
+	violations := schema.Validate(content)
+	if len(violations) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Received content does not match the schema of the collection",
+			Details: &SchemaViolations{Violations: violations},
+		}
+	}
+
+	return nil
+}
+
+// findSchemaViolations lists the documents of a collection that do not match the schema, stopping
+// after maxReportedViolations documents.
+func findSchemaViolations(ctx context.Context, collection *model.Collections, schema *query.Schema) ([]convert.DocumentViolations, error) {
+	var reports []convert.DocumentViolations
+
+	cursor := ""
+	for {
+		page, err := newPage(pagination.Params{Limit: pagination.MaxLimit, Cursor: cursor}, models.DocumentSortKey)
+		if err != nil {
+			return nil, err
+		}
+
+		var documents []*model.Documents
+		documents, cursor, err = models.ListDocuments(ctx, collection.ID, nil, page, nil)
+		if err != nil {
+			log.WithError(err).Error("Could not fetch documents to validate a schema")
+			return nil, &errs.Error{
+				Code:    errs.Internal,
+				Message: "Could not fetch documents",
+			}
+		}
+
+		for _, document := range documents {
+			violations := schema.Validate(json.RawMessage(document.Content))
+			if len(violations) == 0 {
+				continue
+			}
+
+			reports = append(reports, convert.DocumentViolations{
+				DocumentID: document.ID,
+				Violations: violations,
+			})
+
+			if len(reports) == maxReportedViolations {
+				return reports, nil
+			}
+		}
+
+		if cursor == "" {
+			return reports, nil
+		}
+	}
+}
+
+// schemaViolationsError creates the error returned when a schema is attached to a collection with
+// documents that do not match it.
+func schemaViolationsError(reports []convert.DocumentViolations) error {
+	return &errs.Error{
+		Code:    errs.FailedPrecondition,
+		Message: "Could not attach the schema, documents of the collection do not match it",
+		Details: &DocumentsSchemaViolations{Documents: reports},
+	}
+}
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/convert"
+	"encore.app/content/helpers"
+	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/query"
+	"encore.app/identity"
+	"encore.app/pagination"
+)
+
+// parseSearchConfig parses a full-text search configuration sent by a client for a collection.
+func parseSearchConfig(raw json.RawMessage) (*query.SearchConfig, error) {
+	config, err := query.ParseSearchConfig(raw)
+	if err != nil {
+		log.WithError(err).Warning("Could not parse the search configuration on collection request")
+		return nil, invalidQueryError("search", err)
+	}
+
+	return config, nil
+}
+
+// collectionSearchConfig returns the parsed search configuration of a collection, or nil if the collection
+// is not searchable.
+func collectionSearchConfig(collection *model.Collections) (*query.SearchConfig, error) {
+	if collection.Search == nil {
+		return nil, nil
+	}
+
+	config, err := query.ParseSearchConfig(json.RawMessage(*collection.Search))
+	if err != nil {
+		log.WithError(err).Errorf("Could not parse the stored search configuration of collection %d", collection.ID)
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not parse the search configuration of the collection",
+		}
+	}
+
+	return config, nil
+}
+
+// SearchDocuments lists a page of the documents of a collection matching a full-text search for the authenticated
+// user, by decreasing rank, along with the cursor to the next page. The documents can be further filtered using a
+// filter expression on their content. The collection must declare the paths to search.
+func SearchDocuments(ctx context.Context, collectionID int64, text string, rawFilter json.RawMessage, params pagination.Params) ([]convert.SearchResultPayload, string, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	collection, err := helpers.GetCollection(ctx, collectionID, userData.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !helpers.CanReadDatabase(ctx, collection.DatabaseID, userData.KeyID) {
+		return nil, "", &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to read the database",
+		}
+	}
+
+	config, err := collectionSearchConfig(collection)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if config == nil {
+		return nil, "", &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "Collection is not searchable, it has no search configuration",
+		}
+	}
+
+	search, err := config.ParseSearch(text)
+	if err != nil {
+		log.WithError(err).Warning("Could not parse the text on search request")
+		return nil, "", invalidQueryError("text", err)
+	}
+
+	filter, err := query.ParseFilter(rawFilter)
+	if err != nil {
+		log.WithError(err).Warning("Could not parse the filter on search request")
+		return nil, "", invalidQueryError("filter", err)
+	}
+
+	// Documents are always sorted by decreasing rank
+	params.Descending = true
+	page, err := newPage(params, func(sortBy string) (pagination.SortKey, error) {
+		return models.SearchSortKey(ctx, search), nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	results, nextCursor, err := models.SearchDocuments(ctx, collection.ID, search, filter, page)
+	if err != nil {
+		log.WithError(err).Error("Could not search documents for collection")
+		return nil, "", &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not search documents",
+		}
+	}
+
+	payload, err := convert.SearchResultsToPayloads(results)
+	if err != nil {
+		log.WithError(err).Error("Could not convert search results to API safe version")
+		return nil, "", &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not convert documents for API",
+		}
+	}
+
+	return payload, nextCursor, nil
+}
@@ -2,7 +2,9 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"encore.app/content/helpers"
 	"encore.dev/beta/auth"
@@ -12,108 +14,257 @@ import (
 
 	"encore.app/content/convert"
 	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/model"
 	"encore.app/identity"
 )
 
-// StartTransaction creates a transaction on the provided database.
-func StartTransaction(ctx context.Context, name string) (models.DatabasePayload, error) {
+// expiredTransactionRetention is how long the keys of expired transactions are remembered once deleted.
+const expiredTransactionRetention = 7 * 24 * time.Hour
+
+// WithTransaction finds the transaction for the given key and returns a context where documents and
+// collections are read from and written to that transaction. The documents written with the context are
+// recorded as changed by the API key of the authenticated user. No transaction is used when no key is given.
+func WithTransaction(ctx context.Context, key uuid.UUID) (context.Context, error) {
 	userData := auth.Data().(*identity.UserData)
+	ctx = models.WithAuthor(ctx, userData.KeyID)
 
-	if !helpers.CanAdmin(ctx, userData.KeyID) {
-		return convert.DatabasePayload{}, &errs.Error{
-			Code:    errs.PermissionDenied,
-			Message: "API key cannot be used for admin operations",
-		}
+	if key == uuid.Nil {
+		return ctx, nil
 	}
 
-	database := models.NewDatabase(name, userData.ID)
-	if !models.ValidateDatabaseConstraint(ctx, database) {
-		log.WithFields(map[string]interface{}{
-			"name":    name,
-			"user_id": userData.ID,
-		}).Warning("Could not validate the constraints for the database, a database already exists.")
-		return convert.DatabasePayload{}, &errs.Error{
-			Code:    errs.AlreadyExists,
-			Message: fmt.Sprintf("A database with name `%s` already exists", database.Name),
+	transaction, err := helpers.GetTransaction(ctx, key, userData.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.WithTransaction(ctx, transaction), nil
+}
+
+// StartTransaction creates a transaction on the provided database for the authenticated user.
+func StartTransaction(ctx context.Context, databaseID int64) (convert.TransactionPayload, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	database, err := helpers.GetDatabase(ctx, databaseID, userData.ID)
+	if err != nil {
+		return convert.TransactionPayload{}, err
+	}
+
+	if !helpers.CanWriteDatabase(ctx, database.ID, userData.KeyID) {
+		return convert.TransactionPayload{}, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to write to the database",
 		}
 	}
 
-	err := models.SaveDatabase(ctx, database)
+	transaction := models.NewTransaction(database.ID)
+
+	err = models.SaveTransaction(ctx, transaction)
 	if err != nil {
-		log.WithError(err).Error("Could not save databases")
-		return convert.DatabasePayload{}, &errs.Error{
+		log.WithError(err).Error("Could not save transaction")
+		return convert.TransactionPayload{}, &errs.Error{
 			Code:    errs.Internal,
-			Message: "Could not save database",
+			Message: "Could not start transaction",
 		}
 	}
 
-	return convert.DatabaseModelToPayload(database), nil
+	return convert.TransactionModelToPayload(transaction), nil
 }
 
-// UpdateDatabase updates a database by ID for the authenticated user
-func UpdateDatabase(ctx context.Context, id uuid.UUID, name string) (convert.DatabasePayload, error) {
+// TransactionConflicts is the details of the error returned when a transaction is committed after
+// documents it read or wrote were changed outside of it.
+type TransactionConflicts struct {
+	// The documents changed outside of the transaction
+	Conflicts []models.DocumentConflict
+}
+
+// ErrDetails marks TransactionConflicts as usable in the details of an encore error.
+func (c *TransactionConflicts) ErrDetails() {}
+
+// TransactionUniqueConflict is the details of the error returned when a transaction is committed with a document
+// having the same key, or the same values on a unique index, as a document written outside of it.
+type TransactionUniqueConflict struct {
+	// The unique identifier of the document of the transaction
+	DocumentID int64
+
+	// The details of the conflict with the other document, if any
+	Details errs.ErrDetails
+}
+
+// ErrDetails marks TransactionUniqueConflict as usable in the details of an encore error.
+func (c *TransactionUniqueConflict) ErrDetails() {}
+
+// CommitTransaction applies all the changes of a transaction by key for the authenticated user, and
+// deletes the transaction. The transaction is only deleted once committed, it is kept when the commit fails
+// or when it conflicts with changes made outside of it, unless forced to overwrite them.
+func CommitTransaction(ctx context.Context, key uuid.UUID, force bool) (convert.DatabasePayload, error) {
 	userData := auth.Data().(*identity.UserData)
 
-	database, err := helpers.GetDatabase(ctx, id, userData.ID)
+	transaction, err := helpers.GetTransaction(ctx, key, userData.ID)
+	if err != nil {
+		return convert.DatabasePayload{}, err
+	}
+
+	database, err := helpers.GetDatabase(ctx, transaction.DatabaseID, userData.ID)
 	if err != nil {
 		return convert.DatabasePayload{}, err
 	}
 
-	if !helpers.CanAdminDatabase(ctx, database.ID, userData.KeyID) {
+	if !helpers.CanWriteDatabase(ctx, database.ID, userData.KeyID) {
 		return convert.DatabasePayload{}, &errs.Error{
 			Code:    errs.PermissionDenied,
-			Message: "API key doesn't have the ability to administrate the database",
+			Message: "API key doesn't have the ability to write to the database",
 		}
 	}
 
-	database.Name = name
-	if !models.ValidateDatabaseConstraint(ctx, database) {
-		log.WithFields(map[string]interface{}{
-			"name":    name,
-			"user_id": userData.ID,
-		}).Warning("Could not validate the constraints for the database, a database already exists.")
+	conflicts, err := models.CommitTransaction(ctx, transaction, force)
+	if models.IsUniqueViolation(err) {
+		log.WithError(err).Warning("Tried to commit a transaction conflicting on a unique constraint")
+		return convert.DatabasePayload{}, commitUniqueViolationError(ctx, transaction, userData.ID)
+	} else if err != nil {
+		log.WithError(err).Error("Could not commit transaction")
 		return convert.DatabasePayload{}, &errs.Error{
-			Code:    errs.AlreadyExists,
-			Message: fmt.Sprintf("A database with name `%s` already exists", database.Name),
+			Code:    errs.Internal,
+			Message: "Could not commit transaction",
 		}
 	}
 
-	err = models.SaveDatabase(ctx, database)
-	if err != nil {
-		log.WithError(err).Error("Could not save database")
+	if len(conflicts) > 0 {
+		log.WithField("conflicts", len(conflicts)).Warning("Tried to commit a transaction with conflicts")
 		return convert.DatabasePayload{}, &errs.Error{
-			Code:    errs.Internal,
-			Message: "Could not save Database",
+			Code:    errs.Aborted,
+			Message: fmt.Sprintf("Could not commit transaction, %d documents were modified outside of it", len(conflicts)),
+			Details: &TransactionConflicts{Conflicts: conflicts},
 		}
 	}
 
 	return convert.DatabaseModelToPayload(database), nil
 }
 
-// DeleteDatabase deletes a database by ID for the authenticated user
-func DeleteDatabase(ctx context.Context, id uuid.UUID) (convert.DatabasePayload, error) {
+// commitUniqueViolationError creates the error returned when postgres rejected the commit of a transaction on a
+// unique constraint, which happens when a document with the same key or the same values on a unique index as one
+// of the documents of the transaction was written outside of it. The first conflicting document is searched to
+// be reported.
+func commitUniqueViolationError(ctx context.Context, transaction *model.Transactions, userID int64) error {
+	violation := &errs.Error{
+		Code:    errs.AlreadyExists,
+		Message: "Could not commit transaction, it conflicts with documents or collections written outside of it",
+	}
+
+	documents, err := models.ListTransactionalDocuments(ctx, transaction)
+	if err != nil {
+		return violation
+	}
+
+	collections := map[int64]*model.Collections{}
+	for _, document := range documents {
+		collection, ok := collections[document.CollectionID]
+		if !ok {
+			// Collections created in the transaction have no document written outside of it
+			collection, err = helpers.GetCollection(ctx, document.CollectionID, userID)
+			if err != nil {
+				continue
+			}
+
+			collections[collection.ID] = collection
+		}
+
+		conflictErr := checkCommittedKey(ctx, collection, document)
+		if conflictErr == nil {
+			conflictErr = checkIndexes(ctx, collection, document.ID, document.Content)
+		}
+
+		var conflict *errs.Error
+		if errors.As(conflictErr, &conflict) && conflict.Code == errs.AlreadyExists {
+			return &errs.Error{
+				Code:    errs.AlreadyExists,
+				Message: fmt.Sprintf("Could not commit transaction, document %d conflicts with a document written outside of it: %s", document.ID, conflict.Message),
+				Details: &TransactionUniqueConflict{
+					DocumentID: document.ID,
+					Details:    conflict.Details,
+				},
+			}
+		}
+	}
+
+	return violation
+}
+
+// checkCommittedKey checks that no other document of the collection has the key of a document of a transaction.
+func checkCommittedKey(ctx context.Context, collection *model.Collections, document *model.Documents) error {
+	if document.Key == nil {
+		return nil
+	}
+
+	existingID, err := models.FindDocumentByKey(ctx, collection.ID, *document.Key)
+	if err != nil {
+		return err
+	}
+
+	if existingID != 0 && existingID != document.ID {
+		return &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: fmt.Sprintf("A document with key `%s` already exists in this collection", *document.Key),
+		}
+	}
+
+	return nil
+}
+
+// RollbackTransaction discards all the changes of a transaction by key for the authenticated user. The
+// transaction is kept and can be reused.
+func RollbackTransaction(ctx context.Context, key uuid.UUID) (convert.TransactionPayload, error) {
 	userData := auth.Data().(*identity.UserData)
 
-	database, err := helpers.GetDatabase(ctx, id, userData.ID)
+	transaction, err := helpers.GetTransaction(ctx, key, userData.ID)
 	if err != nil {
-		return convert.DatabasePayload{}, err
+		return convert.TransactionPayload{}, err
 	}
 
-	if !helpers.CanAdminDatabase(ctx, database.ID, userData.KeyID) {
-		return convert.DatabasePayload{}, &errs.Error{
+	if !helpers.CanWriteDatabase(ctx, transaction.DatabaseID, userData.KeyID) {
+		return convert.TransactionPayload{}, &errs.Error{
 			Code:    errs.PermissionDenied,
-			Message: "API key doesn't have the ability to administrate the database",
+			Message: "API key doesn't have the ability to write to the database",
 		}
 	}
 
-	err = models.DeleteDatabase(ctx, database)
+	err = models.RollbackTransaction(ctx, transaction)
 	if err != nil {
-		log.WithError(err).Error("Could not delete database")
-		return convert.DatabasePayload{}, &errs.Error{
+		log.WithError(err).Error("Could not rollback transaction")
+		return convert.TransactionPayload{}, &errs.Error{
 			Code:    errs.Internal,
-			Message: "Could not delete database",
+			Message: "Could not rollback transaction",
 		}
 	}
 
-	return convert.DatabaseModelToPayload(database), nil
+	return convert.TransactionModelToPayload(transaction), nil
+}
+
+// SweepExpiredTransactions deletes all the expired transactions along with their changes, and returns
+// the number of deleted transactions. The keys of deleted transactions are remembered for
+// expiredTransactionRetention, so that using them fails the same way as before the sweep.
+func SweepExpiredTransactions(ctx context.Context) (int64, error) {
+	now := time.Now()
+
+	deleted, err := models.DeleteExpiredTransactions(ctx, now)
+	if err != nil {
+		return 0, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not delete expired transactions",
+		}
+	}
+
+	forgotten, err := models.DeleteExpiredTransactionRecords(ctx, now.Add(-expiredTransactionRetention))
+	if err != nil {
+		return deleted, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not delete the records of expired transactions",
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"deleted_transactions":   deleted,
+		"forgotten_transactions": forgotten,
+	}).Info("Swept expired transactions")
+
+	return deleted, nil
 }
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"encore.dev/beta/errs"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/query"
+)
+
+// transferFormats are the formats the documents of a collection can be exported to and imported from.
+var transferFormats = []string{"ndjson", "json", "csv"}
+
+// transferContentTypes are the content types of the formats of exports.
+var transferContentTypes = map[string]string{
+	"ndjson": "application/x-ndjson",
+	"json":   "application/json",
+	"csv":    "text/csv; charset=utf-8",
+}
+
+// parseTransferFormat validates the format of an export or of an import, NDJSON when none is given.
+func parseTransferFormat(format string) (string, error) {
+	if format == "" {
+		return "ndjson", nil
+	}
+
+	if !stringIn(format, transferFormats) {
+		return "", &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("Received format was not valid, `%s` is not one of `%s`", format, strings.Join(transferFormats, "`, `")),
+		}
+	}
+
+	return format, nil
+}
+
+// parseTransferColumns parses the mapping of the columns of a CSV file to paths in the content of the
+// documents, along with the column holding the keys of the documents if any. The mapping must be given for
+// the CSV format, and only for it.
+func parseTransferColumns(format string, rawColumns json.RawMessage, keyColumn string) (query.Columns, error) {
+	if format != "csv" {
+		if !isEmptyJSON(rawColumns) || keyColumn != "" {
+			return nil, &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: "Received columns were not valid, columns are only given for the `csv` format",
+			}
+		}
+
+		return nil, nil
+	}
+
+	if isEmptyJSON(rawColumns) {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Received columns were not valid, columns must be given for the `csv` format",
+		}
+	}
+
+	columns, err := query.ParseColumns(rawColumns)
+	if err != nil {
+		log.WithError(err).Warning("Could not parse the columns of the transfer")
+		return nil, invalidQueryError("columns", err)
+	}
+
+	if keyColumn != "" && stringIn(keyColumn, columns.Names()) {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("Received key column was not valid, `%s` is already mapped to a path", keyColumn),
+		}
+	}
+
+	return columns, nil
+}
@@ -0,0 +1,442 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"github.com/go-jet/jet/v2/qrm"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/convert"
+	"encore.app/content/helpers"
+	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/identity"
+	"encore.app/pagination"
+)
+
+// trashPage validates the pagination of a trash listing, sorted by the date the items were deleted.
+func trashPage(params pagination.Params, sortKey pagination.SortKey) (*pagination.Page, error) {
+	return newPage(params, func(sortBy string) (pagination.SortKey, error) {
+		return sortKey, nil
+	})
+}
+
+// trashNotFound is the error returned when an item could not be found in the trash, or could not be fetched.
+func trashNotFound(err error, kind string) error {
+	if errors.Is(err, qrm.ErrNoRows) {
+		log.WithError(err).Warningf("Could not find %s in the trash", kind)
+		return &errs.Error{
+			Code:    errs.NotFound,
+			Message: "Could not find " + kind + " in the trash",
+		}
+	}
+
+	log.WithError(err).Errorf("Could not find %s in the trash", kind)
+	return &errs.Error{
+		Code:    errs.Internal,
+		Message: "Could not find " + kind + " in the trash, unknown error",
+	}
+}
+
+// ListDatabaseTrash lists a page of the databases of the authenticated user in the trash, along with the
+// cursor to the next page.
+func ListDatabaseTrash(ctx context.Context, params pagination.Params) ([]convert.DatabasePayload, string, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	if !helpers.CanAdmin(ctx, userData.KeyID) {
+		return nil, "", &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key cannot be used for admin operations",
+		}
+	}
+
+	page, err := trashPage(params, models.DatabaseTrashSortKey())
+	if err != nil {
+		return nil, "", err
+	}
+
+	databases, nextCursor, err := models.ListDatabaseTrash(ctx, userData.ID, page)
+	if err != nil {
+		log.WithError(err).Warning("Could not fetch the databases in the trash for the authenticated user")
+		return nil, "", &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not fetch the databases in the trash",
+		}
+	}
+
+	return convert.DatabaseModelsToPayloads(databases), nextCursor, nil
+}
+
+// RestoreDatabaseFromTrash takes a database by ID out of the trash for the authenticated user, along with
+// its collections and documents. No other database of the user must have its name.
+func RestoreDatabaseFromTrash(ctx context.Context, id int64) (convert.DatabasePayload, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	database, err := models.GetTrashedDatabase(ctx, id, userData.ID)
+	if err != nil {
+		return convert.DatabasePayload{}, trashNotFound(err, "database")
+	}
+
+	if !helpers.CanAdminDatabase(ctx, database.ID, userData.KeyID) {
+		return convert.DatabasePayload{}, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to administrate the database",
+		}
+	}
+
+	conflict := restoreConflictError("database", fmt.Sprintf("a database with name `%s` already exists", database.Name))
+	if !models.ValidateDatabaseConstraint(ctx, database) {
+		return convert.DatabasePayload{}, conflict
+	}
+
+	err = models.RestoreDatabase(ctx, database)
+	if models.IsUniqueViolation(err) {
+		return convert.DatabasePayload{}, conflict
+	} else if err != nil {
+		log.WithError(err).Error("Could not restore database")
+		return convert.DatabasePayload{}, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not restore database",
+		}
+	}
+
+	return convert.DatabaseModelToPayload(database), nil
+}
+
+// PurgeDatabaseTrash permanently deletes a database by ID in the trash for the authenticated user, or all
+// the databases in the trash when no ID is given, along with their collections and documents. Returns the
+// number of purged databases.
+func PurgeDatabaseTrash(ctx context.Context, id int64) (int64, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	if id == 0 && !helpers.CanAdmin(ctx, userData.KeyID) {
+		return 0, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key cannot be used for admin operations",
+		}
+	}
+
+	if id != 0 {
+		database, err := models.GetTrashedDatabase(ctx, id, userData.ID)
+		if err != nil {
+			return 0, trashNotFound(err, "database")
+		}
+
+		if !helpers.CanAdminDatabase(ctx, database.ID, userData.KeyID) {
+			return 0, &errs.Error{
+				Code:    errs.PermissionDenied,
+				Message: "API key doesn't have the ability to administrate the database",
+			}
+		}
+	}
+
+	purged, err := models.PurgeDatabaseTrash(ctx, userData.ID, id)
+	if err != nil {
+		log.WithError(err).Error("Could not purge the databases in the trash")
+		return 0, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not purge the databases in the trash",
+		}
+	}
+
+	return purged, nil
+}
+
+// ListCollectionTrash lists a page of the collections of a database in the trash for the authenticated user,
+// along with the cursor to the next page.
+func ListCollectionTrash(ctx context.Context, databaseID int64, params pagination.Params) ([]convert.CollectionPayload, string, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	database, err := helpers.GetDatabase(ctx, databaseID, userData.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !helpers.CanReadDatabase(ctx, database.ID, userData.KeyID) {
+		return nil, "", &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to read the database",
+		}
+	}
+
+	page, err := trashPage(params, models.CollectionTrashSortKey())
+	if err != nil {
+		return nil, "", err
+	}
+
+	collections, nextCursor, err := models.ListCollectionTrash(ctx, database.ID, page)
+	if err != nil {
+		log.WithError(err).Warning("Could not fetch the collections in the trash of the database")
+		return nil, "", &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not fetch the collections in the trash",
+		}
+	}
+
+	return convert.CollectionModelsToPayloads(collections), nextCursor, nil
+}
+
+// RestoreCollectionFromTrash takes a collection by ID out of the trash for the authenticated user, along
+// with its documents. Its database must not be in the trash, and no other collection of the database must
+// have its name.
+func RestoreCollectionFromTrash(ctx context.Context, id int64) (convert.CollectionPayload, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	collection, err := models.GetTrashedCollection(ctx, id, userData.ID)
+	if err != nil {
+		return convert.CollectionPayload{}, trashNotFound(err, "collection")
+	}
+
+	if !helpers.CanWriteDatabase(ctx, collection.DatabaseID, userData.KeyID) {
+		return convert.CollectionPayload{}, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to write to the database",
+		}
+	}
+
+	conflict := restoreConflictError("collection", fmt.Sprintf("a collection with name `%s` already exists in this database", collection.Name))
+	if !models.ValidateCollectionConstraint(ctx, collection) {
+		return convert.CollectionPayload{}, conflict
+	}
+
+	err = models.RestoreCollection(ctx, collection)
+	if models.IsUniqueViolation(err) {
+		return convert.CollectionPayload{}, conflict
+	} else if err != nil {
+		log.WithError(err).Error("Could not restore collection")
+		return convert.CollectionPayload{}, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not restore collection",
+		}
+	}
+
+	return convert.CollectionModelToPayload(collection), nil
+}
+
+// PurgeCollectionTrash permanently deletes a collection by ID in the trash of a database for the
+// authenticated user, or all the collections in the trash of the database when no ID is given, along with
+// their documents. Returns the number of purged collections.
+func PurgeCollectionTrash(ctx context.Context, databaseID, id int64) (int64, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	database, err := helpers.GetDatabase(ctx, databaseID, userData.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	if !helpers.CanWriteDatabase(ctx, database.ID, userData.KeyID) {
+		return 0, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to write to the database",
+		}
+	}
+
+	purged, err := models.PurgeCollectionTrash(ctx, database.ID, id)
+	if err != nil {
+		log.WithError(err).Error("Could not purge the collections in the trash")
+		return 0, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not purge the collections in the trash",
+		}
+	}
+
+	if id != 0 && purged == 0 {
+		return 0, trashNotFound(qrm.ErrNoRows, "collection")
+	}
+
+	return purged, nil
+}
+
+// ListDocumentTrash lists a page of the documents of a collection in the trash for the authenticated user,
+// along with the cursor to the next page.
+func ListDocumentTrash(ctx context.Context, collectionID int64, params pagination.Params) ([]convert.DocumentPayload, string, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	collection, err := helpers.GetCollection(ctx, collectionID, userData.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !helpers.CanReadDatabase(ctx, collection.DatabaseID, userData.KeyID) {
+		return nil, "", &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to read the database",
+		}
+	}
+
+	page, err := trashPage(params, models.DocumentTrashSortKey())
+	if err != nil {
+		return nil, "", err
+	}
+
+	documents, nextCursor, err := models.ListDocumentTrash(ctx, collection.ID, page)
+	if err != nil {
+		log.WithError(err).Warning("Could not fetch the documents in the trash of the collection")
+		return nil, "", &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not fetch the documents in the trash",
+		}
+	}
+
+	payload, err := convert.DocumentModelsToPayloads(documents)
+	if err != nil {
+		log.WithError(err).Error("Could not convert documents to API safe version")
+		return nil, "", &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not convert documents for API",
+		}
+	}
+
+	return payload, nextCursor, nil
+}
+
+// RestoreDocumentFromTrash takes a document by ID out of the trash for the authenticated user, with the
+// content and version it had when deleted. Its collection must not be in the trash, and its content must
+// still match the schema of the collection. No other document of the collection must have its key, or the
+// same values on a unique index.
+func RestoreDocumentFromTrash(ctx context.Context, id int64) (convert.DocumentPayload, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	document, err := models.GetTrashedDocument(ctx, id, userData.ID)
+	if err != nil {
+		return convert.DocumentPayload{}, trashNotFound(err, "document")
+	}
+
+	collection, err := helpers.GetCollection(ctx, document.CollectionID, userData.ID)
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
+	if !helpers.CanWriteDatabase(ctx, collection.DatabaseID, userData.KeyID) {
+		return convert.DocumentPayload{}, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to write to the database",
+		}
+	}
+
+	err = validateContent(collection, json.RawMessage(document.Content))
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
+	err = checkRestoredDocument(ctx, collection, document)
+	if err != nil {
+		return convert.DocumentPayload{}, err
+	}
+
+	err = models.RestoreDocument(ctx, document)
+	if models.IsUniqueViolation(err) {
+		// A conflicting document was written at the same time
+		return convert.DocumentPayload{}, restoreConflictError("document", "another document has the same key or the same values on a unique index")
+	} else if err != nil {
+		log.WithError(err).Error("Could not restore document")
+		return convert.DocumentPayload{}, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not restore document",
+		}
+	}
+
+	payload, err := convert.DocumentModelToPayload(document)
+	if err != nil {
+		log.WithError(err).Error("Could not convert document to API safe version")
+		return convert.DocumentPayload{}, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not convert document for API",
+		}
+	}
+
+	return payload, nil
+}
+
+// checkRestoredDocument checks that no document created since a document was moved to the trash has the same
+// key, or the same values on a unique index of its collection.
+func checkRestoredDocument(ctx context.Context, collection *model.Collections, document *model.Documents) error {
+	if document.Key != nil {
+		existingID, err := models.FindDocumentByKey(ctx, collection.ID, *document.Key)
+		if err != nil {
+			return &errs.Error{
+				Code:    errs.Internal,
+				Message: "Could not check the key of the document",
+			}
+		}
+
+		if existingID != 0 {
+			return restoreConflictError("document", fmt.Sprintf("a document with key `%s` already exists in this collection", *document.Key))
+		}
+	}
+
+	err := checkIndexes(ctx, collection, document.ID, document.Content)
+	conflictErr := &errs.Error{}
+	if errors.As(err, &conflictErr) && conflictErr.Code == errs.AlreadyExists {
+		// The conflict is reported with its details, the document cannot be restored while it remains
+		conflictErr.Code = errs.FailedPrecondition
+		return conflictErr
+	}
+
+	return err
+}
+
+// restoreConflictError creates the error returned when an item cannot be restored from the trash, as an item
+// created since it was moved to the trash has the same name, key or unique values.
+func restoreConflictError(kind, reason string) error {
+	return &errs.Error{
+		Code:    errs.FailedPrecondition,
+		Message: fmt.Sprintf("Could not restore %s, %s", kind, reason),
+	}
+}
+
+// PurgeDocumentTrash permanently deletes a document by ID in the trash of a collection for the authenticated
+// user, or all the documents in the trash of the collection when no ID is given. Returns the number of
+// purged documents.
+func PurgeDocumentTrash(ctx context.Context, collectionID, id int64) (int64, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	collection, err := helpers.GetCollection(ctx, collectionID, userData.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	if !helpers.CanWriteDatabase(ctx, collection.DatabaseID, userData.KeyID) {
+		return 0, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to write to the database",
+		}
+	}
+
+	purged, err := models.PurgeDocumentTrash(ctx, collection.ID, id)
+	if err != nil {
+		log.WithError(err).Error("Could not purge the documents in the trash")
+		return 0, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not purge the documents in the trash",
+		}
+	}
+
+	if id != 0 && purged == 0 {
+		return 0, trashNotFound(qrm.ErrNoRows, "document")
+	}
+
+	return purged, nil
+}
+
+// SweepTrash permanently deletes the databases, collections and documents kept in the trash for longer
+// than the trash retention of their database, and returns the number of purged items.
+func SweepTrash(ctx context.Context) (int64, error) {
+	purged, err := models.PurgeExpiredTrash(ctx, time.Now())
+	if err != nil {
+		return 0, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not purge expired trash",
+		}
+	}
+
+	log.WithField("purged_items", purged).Info("Swept trash")
+
+	return purged, nil
+}
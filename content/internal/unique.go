@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"encore.dev/beta/errs"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/convert"
+	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/model"
+)
+
+// maxReportedDuplicates is the maximum number of groups of duplicated documents reported when a unique
+// index cannot be created.
+const maxReportedDuplicates = 100
+
+// UniqueConflict is the details of the error returned when a document would have the same values as
+// another document at the paths of a unique index.
+type UniqueConflict struct {
+	// The name of the unique index
+	Index string
+
+	// The paths of the unique index
+	Paths []string
+
+	// The unique identifier of the document with the same values
+	DocumentID int64
+}
+
+// ErrDetails marks UniqueConflict as usable in the details of an encore error.
+func (c *UniqueConflict) ErrDetails() {}
+
+// UniqueDuplicates is the details of the error returned when a unique index is created on a collection
+// with documents sharing the same values at its paths.
+type UniqueDuplicates struct {
+	// The groups of documents with the same values, at most 100 of them
+	Duplicates []models.DuplicateDocuments
+}
+
+// ErrDetails marks UniqueDuplicates as usable in the details of an encore error.
+func (d *UniqueDuplicates) ErrDetails() {}
+
+// checkIndexes checks that the content can be indexed by the indexes of the collection, and that no other
+// document of the collection has the same values as the content at the paths of one of its unique indexes.
+// Postgres enforces unique indexes on the committed documents, but not on the documents of a transaction
+// until committed, the check gives the conflicting document either way. Indexes that could not be built are
+// not enforced.
+func checkIndexes(ctx context.Context, collection *model.Collections, documentID int64, content string) error {
+	indexes, err := models.ListIndexes(ctx, collection.ID)
+	if err != nil {
+		return &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not fetch indexes",
+		}
+	}
+
+	err = checkIndexedValues(indexes, json.RawMessage(content))
+	if err != nil {
+		return err
+	}
+
+	for _, index := range indexes {
+		if !index.IsUnique || index.Status == models.IndexFailed {
+			continue
+		}
+
+		conflictID, err := models.FindUniqueConflict(ctx, index, documentID, content)
+		if err != nil {
+			return &errs.Error{
+				Code:    errs.Internal,
+				Message: "Could not check unique indexes",
+			}
+		}
+
+		if conflictID != 0 {
+			return uniqueConflictError(index, conflictID)
+		}
+	}
+
+	return nil
+}
+
+// uniqueViolationError creates the error returned when postgres rejected a write on a unique index,
+// which happens when a conflicting document was written at the same time. The conflicting document is
+// searched again to be reported.
+func uniqueViolationError(ctx context.Context, collection *model.Collections, documentID int64, content string) error {
+	err := checkIndexes(ctx, collection, documentID, content)
+	if err != nil {
+		return err
+	}
+
+	return &errs.Error{
+		Code:    errs.AlreadyExists,
+		Message: "Document has the same values as another document on a unique index",
+	}
+}
+
+// uniqueConflictError creates the error returned when a document has the same values as another
+// document at the paths of a unique index.
+func uniqueConflictError(index *model.CollectionIndexes, conflictID int64) error {
+	return &errs.Error{
+		Code:    errs.AlreadyExists,
+		Message: fmt.Sprintf("Document has the same values as document %d on the unique index `%s`", conflictID, index.Name),
+		Details: &UniqueConflict{
+			Index:      index.Name,
+			Paths:      convert.IndexModelToPayload(index).Paths,
+			DocumentID: conflictID,
+		},
+	}
+}
+
+// checkDuplicates checks that no documents of the collection share the same values at the paths of a
+// unique index about to be created.
+func checkDuplicates(ctx context.Context, index *model.CollectionIndexes) error {
+	duplicates, err := models.FindDuplicateDocuments(ctx, index, maxReportedDuplicates)
+	if err != nil {
+		log.WithError(err).Error("Could not search duplicated documents")
+		return &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not search duplicated documents",
+		}
+	}
+
+	if len(duplicates) > 0 {
+		return &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "Could not create the unique index, documents of the collection have the same values at its paths",
+			Details: &UniqueDuplicates{Duplicates: duplicates},
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/convert"
+	"encore.app/content/helpers"
+	"encore.app/content/models"
+	"encore.app/content/query"
+	"encore.app/identity"
+)
+
+// maxReportedMatches is the maximum number of documents reported when an upsert matches several documents.
+const maxReportedMatches = 10
+
+// AmbiguousMatch is the details of the error returned when the match expression of an upsert matches
+// several documents.
+type AmbiguousMatch struct {
+	// The unique identifiers of the matched documents, at most 10 of them
+	DocumentIDs []int64
+}
+
+// ErrDetails marks AmbiguousMatch as usable in the details of an encore error.
+func (m *AmbiguousMatch) ErrDetails() {}
+
+// canonicalJSON re-encodes a JSON value with the keys of its objects sorted and without spacing, so that
+// values only differing by the order of their keys or their spacing take the same lock.
+func canonicalJSON(raw json.RawMessage) (string, error) {
+	var value interface{}
+	err := json.Unmarshal(raw, &value)
+	if err != nil {
+		return "", err
+	}
+
+	canonical, err := json.Marshal(value)
+	return string(canonical), err
+}
+
+// matchLockKeys returns the keys locked by an upsert, one for each path the match expression compares for
+// equality along with its value. Upserts that could create the same document share at least one key, however
+// their match expression is written.
+func matchLockKeys(match *query.Filter) ([]string, error) {
+	equalities := match.Equalities()
+
+	keys := make([]string, len(equalities))
+	for i, equality := range equalities {
+		value, err := canonicalJSON(equality.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		keys[i] = fmt.Sprintf("%s=%s", equality.Path, value)
+	}
+
+	return keys, nil
+}
+
+// UpsertDocument creates a document in a collection, or updates the document matching the match expression
+// when there is one. The document is replaced by the content, or the content is applied as a merge patch
+// when merge is true. When update operators are given, they are applied to the matching document, or to the
+// content of the created document along with the `$setOnInsert` operators. It returns whether the document
+// was created. The created document also gets the values the match expression compares for equality, like
+// `{"sku": "A-1"}` or `{"sku": {"$eq": "A-1"}}`, when the content does not have them, and is rejected when it
+// would not match the expression. Upserts comparing a path to the same value run one at a time, and fail when
+// several documents match.
+func UpsertDocument(ctx context.Context, collectionID int64, rawMatch, content, update json.RawMessage, merge bool) (convert.DocumentPayload, bool, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	collection, err := helpers.GetCollection(ctx, collectionID, userData.ID)
+	if err != nil {
+		return convert.DocumentPayload{}, false, err
+	}
+
+	if !helpers.CanWriteDatabase(ctx, collection.DatabaseID, userData.KeyID) {
+		return convert.DocumentPayload{}, false, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to write to the database",
+		}
+	}
+
+	if isEmptyJSON(rawMatch) {
+		return convert.DocumentPayload{}, false, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Received match was not valid, a match expression must be given",
+		}
+	}
+
+	match, err := query.ParseFilter(rawMatch)
+	if err != nil {
+		log.WithError(err).Warning("Could not parse the match on upsert request")
+		return convert.DocumentPayload{}, false, invalidQueryError("match", err)
+	}
+
+	var patch *query.Patch
+	if !isEmptyJSON(update) {
+		if merge {
+			return convert.DocumentPayload{}, false, &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: "Received update was not valid, update operators cannot be merged",
+			}
+		}
+
+		patch, err = query.ParseUpdate(update)
+		if err != nil {
+			log.WithError(err).Warning("Could not parse the update on upsert request")
+			return convert.DocumentPayload{}, false, invalidQueryError("update", err)
+		}
+	} else if merge {
+		patch, err = query.ParseMergePatch(content)
+		if err != nil {
+			log.WithError(err).Warning("Could not parse the merge patch on upsert request")
+			return convert.DocumentPayload{}, false, invalidQueryError("merge patch", err)
+		}
+	}
+
+	keys, err := matchLockKeys(match)
+	if err != nil {
+		return convert.DocumentPayload{}, false, invalidQueryError("match", err)
+	}
+
+	var payload convert.DocumentPayload
+	created := false
+
+	err = models.RunInSQLTransaction(ctx, func(ctx context.Context) error {
+		err := models.LockDocumentMatch(ctx, collection.ID, keys)
+		if err != nil {
+			return &errs.Error{
+				Code:    errs.Internal,
+				Message: "Could not lock the match",
+			}
+		}
+
+		documents, err := models.MatchDocuments(ctx, collection.ID, match, maxReportedMatches)
+		if err != nil {
+			return &errs.Error{
+				Code:    errs.Internal,
+				Message: "Could not fetch documents",
+			}
+		}
+
+		switch len(documents) {
+		case 0:
+			created = true
+
+			var insert *query.Patch
+			if !isEmptyJSON(update) {
+				insert = patch.ForInsert()
+			}
+
+			content, err = insertedContent(ctx, match, content, insert)
+			if err != nil {
+				return err
+			}
+
+			payload, err = createDocument(ctx, collection, "", content)
+		case 1:
+			if patch != nil {
+				payload, err = patchDocument(ctx, collection, documents[0], patch, nil)
+			} else {
+				payload, err = updateDocument(ctx, collection, documents[0], content, nil)
+			}
+		default:
+			ids := make([]int64, len(documents))
+			for i, document := range documents {
+				ids[i] = document.ID
+			}
+
+			err = &errs.Error{
+				Code:    errs.FailedPrecondition,
+				Message: "Could not upsert document, the match expression matched several documents",
+				Details: &AmbiguousMatch{DocumentIDs: ids},
+			}
+		}
+
+		return err
+	})
+
+	var upsertErr *errs.Error
+	if errors.As(err, &upsertErr) {
+		return convert.DocumentPayload{}, false, err
+	} else if err != nil {
+		log.WithError(err).Error("Could not upsert document")
+		return convert.DocumentPayload{}, false, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not save document",
+		}
+	}
+
+	return payload, created, nil
+}
+
+// insertedContent returns the content of a document created by an upsert: the given content, or an empty object
+// when only update operators are given, along with the values the match expression compares for equality, then
+// the update operators applied when given. The content must match the match expression once created.
+func insertedContent(ctx context.Context, match *query.Filter, content json.RawMessage, insert *query.Patch) (json.RawMessage, error) {
+	if isEmptyJSON(content) {
+		if insert == nil {
+			// The content is required without update operators, creating the document reports it
+			return content, nil
+		}
+
+		content = json.RawMessage("{}")
+	}
+
+	if !json.Valid(content) {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Received JSON string for content was not valid",
+		}
+	}
+
+	equalities := match.ForInsert(content)
+	if equalities != nil {
+		inserted, err := models.ApplyPatch(ctx, string(content), equalities)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: "Received match was not valid, its values could not be set on the content",
+			}
+		} else if err != nil {
+			return nil, err
+		}
+
+		content = json.RawMessage(inserted)
+	}
+
+	if insert != nil {
+		inserted, err := models.ApplyPatch(ctx, string(content), insert)
+		if errors.Is(err, sql.ErrNoRows) {
+			mismatch := insert.Mismatch(content)
+			if mismatch != nil {
+				return nil, invalidQueryError("update", mismatch)
+			}
+
+			return nil, &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: "Received update was not valid, it could not be applied to the content",
+			}
+		} else if err != nil {
+			return nil, err
+		}
+
+		content = json.RawMessage(inserted)
+	}
+
+	matches, err := models.ContentMatches(ctx, string(content), match)
+	if err != nil {
+		return nil, err
+	}
+
+	if !matches {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Received content was not valid, the created document would not match the match expression",
+		}
+	}
+
+	return content, nil
+}
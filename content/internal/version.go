@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"encore.dev/beta/errs"
+
+	"encore.app/content/helpers"
+	"encore.app/content/models"
+)
+
+// VersionMismatch is the details of the error returned when a write is made with a version
+// precondition that no longer matches the document.
+type VersionMismatch struct {
+	// The current version of the document
+	CurrentVersion int64
+}
+
+// ErrDetails marks VersionMismatch as usable in the details of an encore error.
+func (v *VersionMismatch) ErrDetails() {}
+
+// versionMismatchError creates the error returned to clients when the version they expected
+// does not match the current version of the document.
+func versionMismatchError(currentVersion int64) error {
+	return &errs.Error{
+		Code:    errs.FailedPrecondition,
+		Message: fmt.Sprintf("Document was modified, its current version is %d", currentVersion),
+		Details: &VersionMismatch{CurrentVersion: currentVersion},
+	}
+}
+
+// checkVersion returns a version mismatch error if the version precondition is given and does
+// not match the version of the document.
+func checkVersion(version int64, ifVersion *int64) error {
+	if ifVersion != nil && *ifVersion != version {
+		return versionMismatchError(version)
+	}
+
+	return nil
+}
+
+// refreshVersionError is used when a conditional write did not change any row. It fetches the
+// document again to return a version mismatch error if the document was modified concurrently,
+// or the fallback error if the version still matches.
+func refreshVersionError(ctx context.Context, id, userID int64, ifVersion *int64, fallback error) error {
+	if ifVersion == nil {
+		return fallback
+	}
+
+	document, err := helpers.GetDocument(ctx, models.DocumentByID(id), userID)
+	if err != nil {
+		return err
+	}
+
+	err = checkVersion(document.Version, ifVersion)
+	if err != nil {
+		return err
+	}
+
+	return fallback
+}
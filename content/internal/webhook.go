@@ -0,0 +1,380 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/convert"
+	"encore.app/content/helpers"
+	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/query"
+	"encore.app/identity"
+)
+
+// maxWebhookURLLength is the maximum length of the URL of a webhook.
+const maxWebhookURLLength = 2048
+
+// webhookSecretLength is the number of random bytes of the secret signing the deliveries of a webhook.
+const webhookSecretLength = 32
+
+// WebhookPolicy decides the addresses the webhooks can be created on and the changes are delivered to, along
+// with the HTTP client delivering them.
+type WebhookPolicy struct {
+	// The networks the webhooks are allowed on even though their addresses are blocked
+	allowed []*net.IPNet
+
+	// The HTTP client sending the deliveries to the webhooks allowed by the policy
+	client *http.Client
+}
+
+// NewWebhookPolicy creates a policy blocking the webhooks on the loopback, link-local, private and unspecified
+// addresses, except on the given networks.
+func NewWebhookPolicy(allowed ...*net.IPNet) *WebhookPolicy {
+	policy := &WebhookPolicy{allowed: allowed}
+	policy.client = newWebhookClient(policy.controlConnection)
+
+	return policy
+}
+
+// blocks checks whether changes cannot be sent to an address, which is the case of the loopback, link-local,
+// private and unspecified addresses outside the allowed networks, so that webhooks cannot reach the network of
+// the service.
+func (p *WebhookPolicy) blocks(ip net.IP) bool {
+	for _, network := range p.allowed {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsPrivate() || ip.IsUnspecified()
+}
+
+// validateWebhookURL validates the URL the changes are sent to is an absolute http or https URL, whose host
+// does not resolve to a blocked address. A host that cannot be resolved is accepted, the address is checked
+// again when connecting to the webhook.
+func validateWebhookURL(ctx context.Context, policy *WebhookPolicy, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || len(rawURL) > maxWebhookURLLength {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("Received URL was not valid, it must be an absolute http or https URL of at most %d characters", maxWebhookURLLength),
+		}
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(parsed.Hostname()); ip != nil {
+		ips = append(ips, ip)
+	} else {
+		addresses, err := net.DefaultResolver.LookupIPAddr(ctx, parsed.Hostname())
+		if err != nil {
+			log.WithError(err).Warningf("Could not resolve the host of webhook URL %s", rawURL)
+		}
+
+		for _, address := range addresses {
+			ips = append(ips, address.IP)
+		}
+	}
+
+	for _, ip := range ips {
+		if policy.blocks(ip) {
+			return &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: "Received URL was not valid, its host must not be a loopback, link-local, private or unspecified address",
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseWebhookEvents validates the operations on the documents a webhook receives the changes of, all of
+// them when none is given.
+func parseWebhookEvents(events []string) ([]string, error) {
+	if len(events) == 0 {
+		return models.WebhookOperations, nil
+	}
+
+	for _, event := range events {
+		if !stringIn(event, models.WebhookOperations) {
+			return nil, &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: fmt.Sprintf("Received events were not valid, `%s` is not one of `%s`", event, strings.Join(models.WebhookOperations, "`, `")),
+			}
+		}
+	}
+
+	// The events are kept in the order of the operations, without duplicates
+	parsed := make([]string, 0, len(events))
+	for _, operation := range models.WebhookOperations {
+		if stringIn(operation, events) {
+			parsed = append(parsed, operation)
+		}
+	}
+
+	return parsed, nil
+}
+
+// stringIn checks whether a string is one of the given values.
+func stringIn(value string, values []string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseWebhookFilter validates the filter the content of the documents must match for their changes to be
+// sent to a webhook, and returns it compacted to be saved. Returns nil when no filter is given.
+func parseWebhookFilter(rawFilter json.RawMessage) (*string, error) {
+	filter, err := query.ParseFilter(rawFilter)
+	if err != nil {
+		log.WithError(err).Warning("Could not parse the filter of the webhook")
+		return nil, invalidQueryError("filter", err)
+	}
+
+	if filter == nil {
+		return nil, nil
+	}
+
+	compacted := bytes.Buffer{}
+	_ = json.Compact(&compacted, rawFilter)
+
+	raw := compacted.String()
+	return &raw, nil
+}
+
+// generateWebhookSecret generates the secret signing the deliveries of a webhook.
+func generateWebhookSecret() (string, error) {
+	secret := make([]byte, webhookSecretLength)
+
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+// getAdministratedWebhook gets a webhook by ID for the authenticated user, checking the API key can
+// administrate its database.
+func getAdministratedWebhook(ctx context.Context, id int64) (*model.Webhooks, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	webhook, err := helpers.GetWebhook(ctx, id, userData.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !helpers.CanAdminDatabase(ctx, webhook.DatabaseID, userData.KeyID) {
+		return nil, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to administrate the database",
+		}
+	}
+
+	return webhook, nil
+}
+
+// ListWebhooks lists the webhooks of a database for the authenticated user, including the ones of its
+// collections, sorted by ID.
+func ListWebhooks(ctx context.Context, databaseID int64) ([]convert.WebhookPayload, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	database, err := helpers.GetDatabase(ctx, databaseID, userData.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !helpers.CanAdminDatabase(ctx, database.ID, userData.KeyID) {
+		return nil, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to administrate the database",
+		}
+	}
+
+	webhooks, err := models.ListWebhooks(ctx, database.ID)
+	if err != nil {
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not fetch webhooks",
+		}
+	}
+
+	return convert.WebhookModelsToPayloads(webhooks), nil
+}
+
+// CreateWebhook registers a webhook receiving the changes made to the documents of a database or of a
+// collection for the authenticated user, from the next change. Only the changes of the given operations are
+// sent, all of them when none is given, and only the changes to documents with a content matching the filter
+// when given. Returns the webhook along with the secret signing its deliveries, which is never returned again.
+func CreateWebhook(ctx context.Context, policy *WebhookPolicy, databaseID, collectionID int64, rawURL string, events []string, rawFilter json.RawMessage) (convert.WebhookPayload, string, error) {
+	userData := auth.Data().(*identity.UserData)
+
+	if (databaseID == 0) == (collectionID == 0) {
+		return convert.WebhookPayload{}, "", &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Received webhook was not valid, it receives the changes either of a database or of a collection",
+		}
+	}
+
+	var scope *int64
+	if collectionID != 0 {
+		collection, err := helpers.GetCollection(ctx, collectionID, userData.ID)
+		if err != nil {
+			return convert.WebhookPayload{}, "", err
+		}
+
+		databaseID = collection.DatabaseID
+		scope = &collection.ID
+	} else {
+		database, err := helpers.GetDatabase(ctx, databaseID, userData.ID)
+		if err != nil {
+			return convert.WebhookPayload{}, "", err
+		}
+
+		databaseID = database.ID
+	}
+
+	if !helpers.CanAdminDatabase(ctx, databaseID, userData.KeyID) {
+		return convert.WebhookPayload{}, "", &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "API key doesn't have the ability to administrate the database",
+		}
+	}
+
+	err := validateWebhookURL(ctx, policy, rawURL)
+	if err != nil {
+		return convert.WebhookPayload{}, "", err
+	}
+
+	parsedEvents, err := parseWebhookEvents(events)
+	if err != nil {
+		return convert.WebhookPayload{}, "", err
+	}
+
+	filter, err := parseWebhookFilter(rawFilter)
+	if err != nil {
+		return convert.WebhookPayload{}, "", err
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		log.WithError(err).Error("Could not generate the secret of the webhook")
+		return convert.WebhookPayload{}, "", &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not generate the secret of the webhook",
+		}
+	}
+
+	last, err := models.CurrentChangePosition(ctx)
+	if err != nil {
+		return convert.WebhookPayload{}, "", &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not find the last change of the webhook",
+		}
+	}
+
+	webhook := models.NewWebhook(databaseID, scope, rawURL, parsedEvents, filter, secret, last)
+	err = models.SaveWebhook(ctx, webhook)
+	if err != nil {
+		return convert.WebhookPayload{}, "", &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not save webhook",
+		}
+	}
+
+	return convert.WebhookModelToPayload(webhook), secret, nil
+}
+
+// UpdateWebhook updates a webhook by ID for the authenticated user. The URL, events and filter are kept when
+// none is given. An inactive webhook is paused, the changes made meanwhile are sent once it is active again as
+// long as they are still kept.
+func UpdateWebhook(ctx context.Context, policy *WebhookPolicy, id int64, rawURL string, events []string, rawFilter json.RawMessage, removeFilter bool, active *bool) (convert.WebhookPayload, error) {
+	webhook, err := getAdministratedWebhook(ctx, id)
+	if err != nil {
+		return convert.WebhookPayload{}, err
+	}
+
+	if rawURL != "" {
+		err = validateWebhookURL(ctx, policy, rawURL)
+		if err != nil {
+			return convert.WebhookPayload{}, err
+		}
+
+		webhook.URL = rawURL
+	}
+
+	if len(events) > 0 {
+		parsedEvents, err := parseWebhookEvents(events)
+		if err != nil {
+			return convert.WebhookPayload{}, err
+		}
+
+		raw, _ := json.Marshal(parsedEvents)
+		webhook.Events = string(raw)
+	}
+
+	filter, err := parseWebhookFilter(rawFilter)
+	if err != nil {
+		return convert.WebhookPayload{}, err
+	}
+
+	if filter != nil && removeFilter {
+		return convert.WebhookPayload{}, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Received filter was not valid, a filter cannot be given when removing the filter",
+		}
+	}
+
+	if filter != nil || removeFilter {
+		webhook.Filter = filter
+	}
+
+	if active != nil {
+		webhook.Active = *active
+	}
+
+	err = models.SaveWebhook(ctx, webhook)
+	if err != nil {
+		return convert.WebhookPayload{}, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not update webhook",
+		}
+	}
+
+	return convert.WebhookModelToPayload(webhook), nil
+}
+
+// DeleteWebhook deletes a webhook by ID for the authenticated user, along with its delivery log. Pending
+// deliveries are not sent.
+func DeleteWebhook(ctx context.Context, id int64) (convert.WebhookPayload, error) {
+	webhook, err := getAdministratedWebhook(ctx, id)
+	if err != nil {
+		return convert.WebhookPayload{}, err
+	}
+
+	err = models.DeleteWebhook(ctx, webhook.ID)
+	if err != nil {
+		return convert.WebhookPayload{}, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not delete webhook",
+		}
+	}
+
+	return convert.WebhookModelToPayload(webhook), nil
+}
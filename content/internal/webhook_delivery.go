@@ -0,0 +1,452 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"encore.dev/beta/errs"
+	"github.com/go-jet/jet/v2/qrm"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/convert"
+	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/query"
+	"encore.app/pagination"
+)
+
+const (
+	// maxWebhookAttempts is the number of attempts made to deliver a change before the delivery fails.
+	maxWebhookAttempts = 8
+
+	// webhookRetryDelay is the delay before the second attempt of a delivery, doubled for each following
+	// attempt up to maxWebhookRetryDelay.
+	webhookRetryDelay = 30 * time.Second
+
+	// maxWebhookRetryDelay is the maximum delay between two attempts of a delivery.
+	maxWebhookRetryDelay = 6 * time.Hour
+
+	// webhookTimeout is how long a webhook has to respond to a delivery.
+	webhookTimeout = 10 * time.Second
+
+	// webhookLease is how long a delivery is claimed for while it is attempted, it must be longer than the
+	// timeout of the webhooks.
+	webhookLease = time.Minute
+
+	// webhookDeliveryBatch is the number of deliveries attempted at once.
+	webhookDeliveryBatch = 10
+
+	// maxWebhookDeliveriesPerRun is the maximum number of deliveries attempted by a single run, the
+	// following ones are attempted by the next runs.
+	maxWebhookDeliveriesPerRun = 100
+)
+
+// newWebhookClient creates the HTTP client sending the deliveries to the webhooks. The address of a webhook is
+// checked by control when connecting to it, as its host may resolve to another address than when it was
+// created. The client does not go through a proxy, which would connect to the webhooks without the check.
+func newWebhookClient(control func(network, address string, conn syscall.RawConn) error) *http.Client {
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout:   webhookTimeout,
+				KeepAlive: 30 * time.Second,
+				Control:   control,
+			}).DialContext,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: webhookTimeout,
+		},
+	}
+}
+
+// controlConnection prevents the connections to the webhooks on an address blocked by the policy.
+func (p *WebhookPolicy) controlConnection(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || p.blocks(ip) {
+		return fmt.Errorf("could not connect to the webhook, address %s is not allowed", host)
+	}
+
+	return nil
+}
+
+// webhookRetryDelayAfter returns the delay before the next attempt of a delivery after the given number of
+// failed attempts.
+func webhookRetryDelayAfter(attempts int32) time.Duration {
+	delay := webhookRetryDelay
+	for i := int32(1); i < attempts && delay < maxWebhookRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxWebhookRetryDelay {
+		return maxWebhookRetryDelay
+	}
+
+	return delay
+}
+
+// signWebhookPayload signs the payload of a delivery sent at the given Unix timestamp with the secret of its
+// webhook. The signature is the hex encoded HMAC-SHA256 of the timestamp and the payload joined by a dot.
+func signWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// DeliverWebhooks queues the deliveries of the changes committed since the last run to the webhooks, then
+// attempts the deliveries that are due. Returns the number of queued deliveries, the number of changes
+// delivered and the number of attempts that failed. Changes are only delivered to the addresses allowed by the
+// policy.
+func DeliverWebhooks(ctx context.Context, policy *WebhookPolicy) (int64, int64, int64, error) {
+	queued, err := EnqueueWebhookDeliveries(ctx)
+	if err != nil {
+		return queued, 0, 0, err
+	}
+
+	delivered, failed, err := SendWebhookDeliveries(ctx, policy)
+	return queued, delivered, failed, err
+}
+
+// EnqueueWebhookDeliveries reads the changes committed since the last change read for each active webhook,
+// and queues the deliveries of the ones the webhook receives. Returns the number of queued deliveries.
+func EnqueueWebhookDeliveries(ctx context.Context) (int64, error) {
+	webhooks, err := models.ListActiveWebhooks(ctx)
+	if err != nil {
+		return 0, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not fetch webhooks",
+		}
+	}
+
+	queued := int64(0)
+	for _, webhook := range webhooks {
+		count, err := enqueueWebhookDeliveries(ctx, webhook)
+		if err != nil {
+			return queued, err
+		}
+
+		queued += count
+	}
+
+	return queued, nil
+}
+
+// enqueueWebhookDeliveries queues the deliveries of the changes committed since the last change read for a
+// webhook. Returns the number of queued deliveries.
+func enqueueWebhookDeliveries(ctx context.Context, webhook *model.Webhooks) (int64, error) {
+	events, err := models.WebhookEvents(webhook)
+	if err != nil {
+		log.WithError(err).Errorf("Could not read the events of webhook %d", webhook.ID)
+		return 0, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not read the events of the webhook",
+		}
+	}
+
+	var filter *query.Filter
+	if webhook.Filter != nil {
+		filter, err = query.ParseFilter(json.RawMessage(*webhook.Filter))
+		if err != nil {
+			log.WithError(err).Errorf("Could not parse the filter of webhook %d", webhook.ID)
+			return 0, &errs.Error{
+				Code:    errs.Internal,
+				Message: "Could not parse the filter of the webhook",
+			}
+		}
+	}
+
+	collectionID := int64(0)
+	if webhook.CollectionID != nil {
+		collectionID = *webhook.CollectionID
+	}
+
+	queued := int64(0)
+	for {
+		changes, err := models.ListDocumentChanges(ctx, webhook.DatabaseID, collectionID, filter, models.ChangePosition{TransactionID: webhook.LastTransactionID, Sequence: webhook.LastSequence}, maxChangesPerRead)
+		if err != nil {
+			return queued, &errs.Error{
+				Code:    errs.Internal,
+				Message: "Could not read the changes of the webhook",
+			}
+		}
+
+		if len(changes) == 0 {
+			return queued, nil
+		}
+
+		var deliveries []*model.WebhookDeliveries
+		for _, change := range changes {
+			if !stringIn(change.Operation, events) {
+				continue
+			}
+
+			payload, err := convert.ChangeModelToPayload(change, newChangeToken(models.ChangeModelPosition(change), change.CreatedAt).encode())
+			if err != nil {
+				log.WithError(err).Error("Could not convert change to API safe version")
+				return queued, &errs.Error{
+					Code:    errs.Internal,
+					Message: "Could not convert change for API",
+				}
+			}
+
+			raw, _ := json.Marshal(payload)
+			deliveries = append(deliveries, models.NewWebhookDelivery(webhook.ID, change.Sequence, change.Operation, string(raw)))
+		}
+
+		err = models.EnqueueWebhookDeliveries(ctx, webhook, deliveries, models.ChangeModelPosition(changes[len(changes)-1]))
+		if err != nil {
+			return queued, &errs.Error{
+				Code:    errs.Internal,
+				Message: "Could not queue the deliveries of the webhook",
+			}
+		}
+
+		queued += int64(len(deliveries))
+		if len(changes) < maxChangesPerRead {
+			return queued, nil
+		}
+	}
+}
+
+// SendWebhookDeliveries attempts the deliveries that are due, a batch at a time. A delivery failing its attempt
+// is attempted again later with an exponential backoff, and fails once it ran out of attempts. Returns the
+// number of changes delivered and the number of attempts that failed. Changes are only delivered to the
+// addresses allowed by the policy.
+func SendWebhookDeliveries(ctx context.Context, policy *WebhookPolicy) (int64, int64, error) {
+	delivered, failed := int64(0), int64(0)
+	webhooks := map[int64]*model.Webhooks{}
+
+	for attempted := 0; attempted < maxWebhookDeliveriesPerRun; attempted += webhookDeliveryBatch {
+		deliveries, err := models.ClaimWebhookDeliveries(ctx, time.Now(), webhookLease, webhookDeliveryBatch)
+		if err != nil {
+			return delivered, failed, &errs.Error{
+				Code:    errs.Internal,
+				Message: "Could not claim the due webhook deliveries",
+			}
+		}
+
+		if len(deliveries) == 0 {
+			break
+		}
+
+		for _, delivery := range deliveries {
+			if _, ok := webhooks[delivery.WebhookID]; ok {
+				continue
+			}
+
+			webhooks[delivery.WebhookID], err = models.GetWebhookByID(ctx, delivery.WebhookID, 0)
+			if err != nil {
+				return delivered, failed, &errs.Error{
+					Code:    errs.Internal,
+					Message: "Could not fetch the webhook of a delivery",
+				}
+			}
+		}
+
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func(delivery *model.WebhookDeliveries) {
+				defer wg.Done()
+				attemptWebhookDelivery(ctx, policy.client, webhooks[delivery.WebhookID], delivery)
+			}(delivery)
+		}
+		wg.Wait()
+
+		for _, delivery := range deliveries {
+			if delivery.Status == models.WebhookDeliveryDelivered {
+				delivered++
+			} else {
+				failed++
+			}
+		}
+
+		err = saveWebhookDeliveryAttempts(ctx, deliveries)
+		if err != nil {
+			return delivered, failed, err
+		}
+
+		if len(deliveries) < webhookDeliveryBatch {
+			break
+		}
+	}
+
+	return delivered, failed, nil
+}
+
+// saveWebhookDeliveryAttempts saves the outcome of the attempts of the deliveries.
+func saveWebhookDeliveryAttempts(ctx context.Context, deliveries []*model.WebhookDeliveries) error {
+	for _, delivery := range deliveries {
+		err := models.SaveWebhookDeliveryAttempt(ctx, delivery)
+		if err != nil {
+			return &errs.Error{
+				Code:    errs.Internal,
+				Message: "Could not save the attempt of a webhook delivery",
+			}
+		}
+	}
+
+	return nil
+}
+
+// attemptWebhookDelivery sends a delivery to its webhook, signed with the secret of the webhook, and updates
+// the delivery with the outcome of the attempt.
+func attemptWebhookDelivery(ctx context.Context, client *http.Client, webhook *model.Webhooks, delivery *model.WebhookDeliveries) {
+	now := time.Now()
+	delivery.Attempts++
+	delivery.ResponseStatus = nil
+	delivery.Error = nil
+
+	responseStatus, err := postWebhookDelivery(ctx, client, webhook, delivery, now)
+	if responseStatus != 0 {
+		delivery.ResponseStatus = &responseStatus
+	}
+
+	if err == nil {
+		delivery.Status = models.WebhookDeliveryDelivered
+		delivery.DeliveredAt = &now
+		return
+	}
+
+	log.WithError(err).Warningf("Could not deliver webhook delivery %d, attempt %d", delivery.ID, delivery.Attempts)
+
+	reason := err.Error()
+	delivery.Error = &reason
+	if delivery.Attempts >= maxWebhookAttempts {
+		delivery.Status = models.WebhookDeliveryFailed
+		return
+	}
+
+	delivery.NextAttemptAt = now.Add(webhookRetryDelayAfter(delivery.Attempts))
+}
+
+// postWebhookDelivery posts the payload of a delivery to its webhook, and returns the status the webhook
+// responded with, 0 when it did not respond. Any status other than 2xx is an error.
+func postWebhookDelivery(ctx context.Context, client *http.Client, webhook *model.Webhooks, delivery *model.WebhookDeliveries, now time.Time) (int32, error) {
+	payload := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "headb-webhooks")
+	req.Header.Set("Webhook-ID", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("Webhook-Event", delivery.Event)
+	req.Header.Set("Webhook-Timestamp", timestamp)
+	req.Header.Set("Webhook-Signature", signWebhookPayload(webhook.Secret, timestamp, payload))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// The body is drained so the connection can be reused, it is not kept
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return int32(res.StatusCode), fmt.Errorf("received status %d from the webhook", res.StatusCode)
+	}
+
+	return int32(res.StatusCode), nil
+}
+
+// webhookDeliveryNotFound is the error returned when a delivery of a webhook could not be found, or could
+// not be fetched.
+func webhookDeliveryNotFound(err error) error {
+	if errors.Is(err, qrm.ErrNoRows) {
+		log.WithError(err).Warning("Could not find webhook delivery")
+		return &errs.Error{
+			Code:    errs.NotFound,
+			Message: "Could not find webhook delivery",
+		}
+	}
+
+	log.WithError(err).Error("Could not find webhook delivery")
+	return &errs.Error{
+		Code:    errs.Internal,
+		Message: "Could not find webhook delivery, unknown error",
+	}
+}
+
+// ListWebhookDeliveries lists a page of the delivery log of a webhook for the authenticated user, only the
+// deliveries with the given status when one is given, along with the cursor to the next page.
+func ListWebhookDeliveries(ctx context.Context, webhookID int64, status string, params pagination.Params) ([]convert.WebhookDeliveryPayload, string, error) {
+	webhook, err := getAdministratedWebhook(ctx, webhookID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if status != "" && !stringIn(status, []string{models.WebhookDeliveryPending, models.WebhookDeliveryDelivered, models.WebhookDeliveryFailed}) {
+		return nil, "", &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Received status was not valid, it must be one of `pending`, `delivered` or `failed`",
+		}
+	}
+
+	page, err := newPage(params, func(sortBy string) (pagination.SortKey, error) {
+		return models.WebhookDeliverySortKey(), nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	deliveries, nextCursor, err := models.ListWebhookDeliveries(ctx, webhook.ID, status, page)
+	if err != nil {
+		return nil, "", &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not fetch webhook deliveries",
+		}
+	}
+
+	return convert.WebhookDeliveryModelsToPayloads(deliveries), nextCursor, nil
+}
+
+// ReplayWebhookDelivery queues a delivery of a webhook again by ID for the authenticated user, whatever its
+// status, with its attempts reset. It is attempted by the next run delivering the webhooks.
+func ReplayWebhookDelivery(ctx context.Context, webhookID, id int64) (convert.WebhookDeliveryPayload, error) {
+	webhook, err := getAdministratedWebhook(ctx, webhookID)
+	if err != nil {
+		return convert.WebhookDeliveryPayload{}, err
+	}
+
+	delivery, err := models.GetWebhookDelivery(ctx, id, webhook.ID)
+	if err != nil {
+		return convert.WebhookDeliveryPayload{}, webhookDeliveryNotFound(err)
+	}
+
+	err = models.ReplayWebhookDelivery(ctx, delivery)
+	if err != nil {
+		return convert.WebhookDeliveryPayload{}, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not replay webhook delivery",
+		}
+	}
+
+	return convert.WebhookDeliveryModelToPayload(delivery), nil
+}
@@ -0,0 +1,28 @@
+-- Indexes declared on the JSON content of the documents of a collection. Each declared index is backed by a postgres
+-- index on the documents of the collection named `documents_index_<id>`, built concurrently while the status is building.
+CREATE TABLE "collection_indexes" (
+    id BIGSERIAL PRIMARY KEY,
+    collection_id BIGINT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    paths jsonb NOT NULL,
+    is_unique BOOLEAN NOT NULL DEFAULT FALSE,
+    method VARCHAR(16) NOT NULL DEFAULT 'btree',
+    status VARCHAR(16) NOT NULL DEFAULT 'building',
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_collection FOREIGN KEY(collection_id) REFERENCES "collections"(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX collection_indexes_collection_id_name_unique_index ON "collection_indexes"(collection_id, name);
+
+-- Drops the postgres index backing a declared index once it is deleted, including when its collection is deleted.
+CREATE FUNCTION drop_collection_index() RETURNS trigger AS $$
+BEGIN
+    EXECUTE format('DROP INDEX IF EXISTS %I', 'documents_index_' || OLD.id);
+    RETURN OLD;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER collection_indexes_drop_index AFTER DELETE ON "collection_indexes"
+    FOR EACH ROW EXECUTE FUNCTION drop_collection_index();
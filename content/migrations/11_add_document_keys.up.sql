@@ -0,0 +1,5 @@
+-- Keys given by clients to address documents, unique within a collection. Documents without a key are only addressed by ID.
+ALTER TABLE "documents" ADD COLUMN key VARCHAR(255);
+ALTER TABLE "transactional_documents" ADD COLUMN key VARCHAR(255);
+
+CREATE UNIQUE INDEX documents_collection_id_key_unique_index ON "documents"(collection_id, key);
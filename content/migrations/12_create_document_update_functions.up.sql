@@ -0,0 +1,124 @@
+-- Sets the value at a path of a document, creating the missing objects along the path. Returns NULL when
+-- a value along the path is neither an object nor an array containing the index given by the path.
+CREATE FUNCTION jsonb_update_set(target jsonb, path text[], value jsonb) RETURNS jsonb AS $$
+DECLARE
+    parent_path text[];
+    segment text;
+    parent jsonb;
+BEGIN
+    IF cardinality(path) = 0 THEN
+        RETURN value;
+    END IF;
+
+    parent_path := path[1:cardinality(path) - 1];
+    segment := path[cardinality(path)];
+    parent := target #> parent_path;
+
+    IF parent IS NULL THEN
+        target := jsonb_update_set(target, parent_path, '{}'::jsonb);
+        parent := '{}'::jsonb;
+    END IF;
+
+    IF jsonb_typeof(parent) = 'object' THEN
+        RETURN jsonb_set(target, path, value, true);
+    ELSIF jsonb_typeof(parent) = 'array' AND segment ~ '^(0|[1-9][0-9]{0,8})$' AND segment::bigint < jsonb_array_length(parent) THEN
+        RETURN jsonb_set(target, path, value, false);
+    END IF;
+
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+-- Applies a list of update operators to a document, in the format generated by query.ParseUpdate: the paths
+-- are arrays of path segments and the values of push, add to set and pull operators are arrays of values.
+-- Set on insert operators are ignored, they are turned into set operators for documents being created.
+-- Returns NULL when an operator cannot be applied to the type of the value at its path.
+CREATE FUNCTION jsonb_update(target jsonb, operations jsonb) RETURNS jsonb AS $$
+DECLARE
+    operation jsonb;
+    path text[];
+    current jsonb;
+    value jsonb;
+    element jsonb;
+BEGIN
+    FOR operation IN SELECT * FROM jsonb_array_elements(operations) LOOP
+        path := ARRAY(SELECT jsonb_array_elements_text(operation -> 'path'));
+        value := operation -> 'value';
+        current := target #> path;
+
+        CASE operation ->> 'op'
+        WHEN 'set' THEN
+            target := jsonb_update_set(target, path, value);
+        WHEN 'unset' THEN
+            target := target #- path;
+        WHEN 'inc', 'mul' THEN
+            IF current IS NULL THEN
+                current := '0'::jsonb;
+            ELSIF jsonb_typeof(current) <> 'number' THEN
+                RETURN NULL;
+            END IF;
+
+            IF operation ->> 'op' = 'inc' THEN
+                value := to_jsonb((current #>> '{}')::numeric + (value #>> '{}')::numeric);
+            ELSE
+                value := to_jsonb((current #>> '{}')::numeric * (value #>> '{}')::numeric);
+            END IF;
+
+            target := jsonb_update_set(target, path, value);
+        WHEN 'min', 'max' THEN
+            IF current IS NULL
+                OR (jsonb_typeof(current) = jsonb_typeof(value) AND operation ->> 'op' = 'min' AND value < current)
+                OR (jsonb_typeof(current) = jsonb_typeof(value) AND operation ->> 'op' = 'max' AND value > current) THEN
+                target := jsonb_update_set(target, path, value);
+            ELSIF jsonb_typeof(current) <> jsonb_typeof(value) THEN
+                RETURN NULL;
+            END IF;
+        WHEN 'push', 'addToSet' THEN
+            IF current IS NULL THEN
+                current := '[]'::jsonb;
+            ELSIF jsonb_typeof(current) <> 'array' THEN
+                RETURN NULL;
+            END IF;
+
+            FOR element IN SELECT * FROM jsonb_array_elements(value) LOOP
+                IF operation ->> 'op' = 'push' OR NOT EXISTS (
+                    SELECT 1 FROM jsonb_array_elements(current) AS existing WHERE existing = element
+                ) THEN
+                    current := current || jsonb_build_array(element);
+                END IF;
+            END LOOP;
+
+            target := jsonb_update_set(target, path, current);
+        WHEN 'pull' THEN
+            IF current IS NULL THEN
+                CONTINUE;
+            ELSIF jsonb_typeof(current) <> 'array' THEN
+                RETURN NULL;
+            END IF;
+
+            target := jsonb_update_set(target, path, (
+                SELECT COALESCE(jsonb_agg(existing.item ORDER BY existing.position), '[]'::jsonb)
+                FROM jsonb_array_elements(current) WITH ORDINALITY AS existing(item, position)
+                WHERE NOT EXISTS (SELECT 1 FROM jsonb_array_elements(value) AS pulled WHERE pulled = existing.item)
+            ));
+        WHEN 'rename' THEN
+            current := target #> ARRAY(SELECT jsonb_array_elements_text(operation -> 'from'));
+            IF current IS NULL THEN
+                CONTINUE;
+            END IF;
+
+            target := target #- ARRAY(SELECT jsonb_array_elements_text(operation -> 'from'));
+            target := jsonb_update_set(target, path, current);
+        ELSE
+            -- Set on insert operators only apply to documents being created
+            NULL;
+        END CASE;
+
+        IF target IS NULL THEN
+            RETURN NULL;
+        END IF;
+    END LOOP;
+
+    RETURN target;
+END
+$$ LANGUAGE plpgsql IMMUTABLE;
@@ -0,0 +1,56 @@
+-- Full-text search configuration of a collection, in the format generated by query.ParseSearchConfig: the text search
+-- configuration of the language of its documents and the paths of their content to search, by decreasing importance.
+ALTER TABLE "collections" ADD COLUMN search jsonb;
+ALTER TABLE "transactional_collections" ADD COLUMN search jsonb;
+
+-- Builds the text search vector of the content of a document from the search configuration of its collection. The
+-- strings at each path are indexed, including the strings nested in arrays and objects. The first three paths are
+-- weighted A, B and C, the other ones D. Returns NULL when the collection has no search configuration.
+CREATE FUNCTION document_search_vector(content jsonb, search jsonb) RETURNS tsvector AS $$
+DECLARE
+    config regconfig;
+    path text;
+    position bigint;
+    vector tsvector := ''::tsvector;
+BEGIN
+    IF search IS NULL THEN
+        RETURN NULL;
+    END IF;
+
+    config := (search ->> 'language')::regconfig;
+    FOR path, position IN SELECT * FROM jsonb_array_elements_text(search -> 'paths') WITH ORDINALITY LOOP
+        vector := vector || setweight(
+            COALESCE(jsonb_to_tsvector(config, content #> string_to_array(path, '.'), '["string"]'), ''::tsvector),
+            (ARRAY['A', 'B', 'C', 'D'])[LEAST(position, 4)]::"char"
+        );
+    END LOOP;
+
+    RETURN vector;
+END
+$$ LANGUAGE plpgsql STABLE;
+
+-- The search vector of committed documents, maintained from their content and the search configuration of their collection.
+ALTER TABLE "documents" ADD COLUMN search_vector tsvector;
+
+CREATE INDEX documents_search_vector_index ON "documents" USING GIN (search_vector);
+
+CREATE FUNCTION update_document_search_vector() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := document_search_vector(NEW.content, (SELECT search FROM collections WHERE id = NEW.collection_id));
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER documents_search_vector BEFORE INSERT OR UPDATE OF content, collection_id ON "documents"
+    FOR EACH ROW EXECUTE FUNCTION update_document_search_vector();
+
+-- Rebuilds the search vectors of the documents of a collection when its search configuration changes.
+CREATE FUNCTION update_collection_search_vectors() RETURNS trigger AS $$
+BEGIN
+    UPDATE documents SET search_vector = document_search_vector(content, NEW.search) WHERE collection_id = NEW.id;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER collections_search_vectors AFTER UPDATE OF search ON "collections"
+    FOR EACH ROW WHEN (OLD.search IS DISTINCT FROM NEW.search) EXECUTE FUNCTION update_collection_search_vectors();
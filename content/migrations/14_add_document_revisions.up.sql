@@ -0,0 +1,54 @@
+-- Whether the collection keeps the history of the content of its documents.
+ALTER TABLE "collections" ADD COLUMN history BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE "transactional_collections" ADD COLUMN history BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- The ID of the API key that last wrote the document, NULL when unknown.
+ALTER TABLE "documents" ADD COLUMN updated_by BIGINT;
+ALTER TABLE "transactional_documents" ADD COLUMN updated_by BIGINT;
+
+-- The committed versions of the documents of the collections keeping their history.
+CREATE TABLE "document_revisions" (
+    document_id BIGINT NOT NULL,
+    version BIGINT NOT NULL,
+    content jsonb NOT NULL,
+    created_by BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY(document_id, version),
+    CONSTRAINT fk_document FOREIGN KEY(document_id) REFERENCES "documents"(id) ON DELETE CASCADE
+);
+
+-- Records the new version of a document when its collection keeps its history. A forced transaction commit can write
+-- a version that was already recorded, the revision then takes the content that was committed last.
+CREATE FUNCTION record_document_revision() RETURNS trigger AS $$
+BEGIN
+    IF (SELECT history FROM collections WHERE id = NEW.collection_id) THEN
+        INSERT INTO document_revisions (document_id, version, content, created_by)
+        VALUES (NEW.id, NEW.version, NEW.content, NEW.updated_by)
+        ON CONFLICT (document_id, version) DO UPDATE
+        SET content = EXCLUDED.content, created_by = EXCLUDED.created_by, created_at = EXCLUDED.created_at;
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER documents_revision AFTER INSERT OR UPDATE OF content, version ON "documents"
+    FOR EACH ROW EXECUTE FUNCTION record_document_revision();
+
+-- Records the current version of the documents of a collection when it starts keeping their history, and deletes
+-- their revisions when it stops.
+CREATE FUNCTION update_collection_history() RETURNS trigger AS $$
+BEGIN
+    IF NEW.history THEN
+        INSERT INTO document_revisions (document_id, version, content, created_by, created_at)
+        SELECT id, version, content, updated_by, updated_at FROM documents WHERE collection_id = NEW.id
+        ON CONFLICT (document_id, version) DO NOTHING;
+    ELSE
+        DELETE FROM document_revisions USING documents
+        WHERE document_revisions.document_id = documents.id AND documents.collection_id = NEW.id;
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER collections_history AFTER UPDATE OF history ON "collections"
+    FOR EACH ROW WHEN (OLD.history IS DISTINCT FROM NEW.history) EXECUTE FUNCTION update_collection_history();
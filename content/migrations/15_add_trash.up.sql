@@ -0,0 +1,12 @@
+-- When the database, collection or document was moved to the trash, NULL when it is not in the trash. Items in the
+-- trash keep their children, names, keys and unique values until purged.
+ALTER TABLE "databases" ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE "collections" ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE "documents" ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- The number of days items of the database are kept in the trash before being purged, including the database itself.
+ALTER TABLE "databases" ADD COLUMN trash_retention_days INTEGER NOT NULL DEFAULT 30;
+
+CREATE INDEX databases_deleted_at_index ON "databases"(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX collections_deleted_at_index ON "collections"(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX documents_deleted_at_index ON "documents"(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,59 @@
+-- The committed changes made to the documents, in the order they were committed within each database, for clients to
+-- follow and resume the feed of changes of a database or collection.
+CREATE TABLE "document_changes" (
+    sequence BIGSERIAL PRIMARY KEY,
+    database_id BIGINT NOT NULL,
+    collection_id BIGINT NOT NULL,
+    document_id BIGINT NOT NULL,
+    operation TEXT NOT NULL CHECK (operation IN ('insert', 'update', 'delete')),
+    key TEXT,
+    version BIGINT NOT NULL,
+    content jsonb NOT NULL,
+    document_created_at TIMESTAMPTZ NOT NULL,
+    created_by BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_database FOREIGN KEY(database_id) REFERENCES "databases"(id) ON DELETE CASCADE,
+    CONSTRAINT fk_collection FOREIGN KEY(collection_id) REFERENCES "collections"(id) ON DELETE CASCADE
+);
+
+CREATE INDEX document_changes_database_index ON "document_changes"(database_id, sequence);
+CREATE INDEX document_changes_collection_index ON "document_changes"(collection_id, sequence);
+CREATE INDEX document_changes_created_at_index ON "document_changes"(created_at);
+
+-- Records a change to a document. Moving a document to the trash is recorded as a delete, and restoring it as an
+-- insert. Changes to the documents of a database are serialised until the end of the SQL transaction that made them,
+-- so their sequence follows the order they are committed in and a client never misses a change committed late.
+CREATE FUNCTION record_document_change() RETURNS trigger AS $$
+DECLARE
+    change_operation TEXT;
+    change_database_id BIGINT;
+BEGIN
+    IF TG_OP = 'INSERT' AND NEW.deleted_at IS NULL THEN
+        change_operation := 'insert';
+    ELSIF TG_OP = 'INSERT' THEN
+        RETURN NULL;
+    ELSIF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+        change_operation := 'delete';
+    ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+        change_operation := 'insert';
+    ELSIF NEW.deleted_at IS NULL THEN
+        change_operation := 'update';
+    ELSE
+        RETURN NULL;
+    END IF;
+
+    SELECT database_id INTO change_database_id FROM collections WHERE id = NEW.collection_id;
+    PERFORM pg_advisory_xact_lock(hashtext('document_changes:' || change_database_id));
+
+    INSERT INTO document_changes (
+        database_id, collection_id, document_id, operation, key, version, content, document_created_at, created_by
+    ) VALUES (
+        change_database_id, NEW.collection_id, NEW.id, change_operation, NEW.key, NEW.version, NEW.content,
+        NEW.created_at, NEW.updated_by
+    );
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER documents_change AFTER INSERT OR UPDATE OF content, version, key, deleted_at ON "documents"
+    FOR EACH ROW EXECUTE FUNCTION record_document_change();
@@ -0,0 +1,43 @@
+-- The webhooks receiving the changes made to the documents of a database, or of one of its collections when a collection
+-- is given. The changes are read from the committed changes after the last sequence read for the webhook, and queued as
+-- deliveries for the operations in its events and, when it has a filter, the documents with a content matching it.
+CREATE TABLE "webhooks" (
+    id BIGSERIAL PRIMARY KEY,
+    database_id BIGINT NOT NULL,
+    collection_id BIGINT,
+    url TEXT NOT NULL,
+    events jsonb NOT NULL,
+    filter jsonb,
+    secret TEXT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    last_sequence BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_database FOREIGN KEY(database_id) REFERENCES "databases"(id) ON DELETE CASCADE,
+    CONSTRAINT fk_collection FOREIGN KEY(collection_id) REFERENCES "collections"(id) ON DELETE CASCADE
+);
+
+CREATE INDEX webhooks_database_index ON "webhooks"(database_id);
+
+-- The queue of the deliveries of the changes to the webhooks, kept as their delivery log. A delivery is pending until it
+-- is delivered or it failed all its attempts, and is attempted again once its next attempt is due.
+CREATE TABLE "webhook_deliveries" (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id BIGINT NOT NULL,
+    sequence BIGINT NOT NULL,
+    event TEXT NOT NULL CHECK (event IN ('insert', 'update', 'delete')),
+    payload jsonb NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    response_status INT,
+    error TEXT,
+    delivered_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_webhook FOREIGN KEY(webhook_id) REFERENCES "webhooks"(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX webhook_deliveries_webhook_sequence_unique_index ON "webhook_deliveries"(webhook_id, sequence);
+CREATE INDEX webhook_deliveries_webhook_index ON "webhook_deliveries"(webhook_id, created_at);
+CREATE INDEX webhook_deliveries_due_index ON "webhook_deliveries"(next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,31 @@
+-- Items in the trash no longer hold on to their names, keys and unique values, so that items created after them can
+-- use them. Restoring an item conflicting with one created since is rejected.
+ALTER TABLE "databases" DROP CONSTRAINT name_user_id_unique;
+CREATE UNIQUE INDEX databases_user_id_name_unique_index ON "databases"(name, user_id) WHERE deleted_at IS NULL;
+
+ALTER TABLE "collections" DROP CONSTRAINT name_database_id_unique;
+CREATE UNIQUE INDEX collections_database_id_name_unique_index ON "collections"(name, database_id) WHERE deleted_at IS NULL;
+
+DROP INDEX documents_collection_id_key_unique_index;
+CREATE UNIQUE INDEX documents_collection_id_key_unique_index ON "documents"(collection_id, key) WHERE deleted_at IS NULL;
+
+-- The unique indexes of the collections are built again without the documents in the trash. Indexes whose build
+-- failed are left as they are, they are not enforced.
+DO $$
+DECLARE
+    existing RECORD;
+BEGIN
+    FOR existing IN
+        SELECT class.relname AS name, pg_get_indexdef(index.indexrelid) AS definition
+        FROM pg_index AS index
+        INNER JOIN pg_class AS class ON class.oid = index.indexrelid
+        WHERE index.indrelid = 'public.documents'::regclass
+            AND index.indisunique
+            AND index.indisvalid
+            AND class.relname LIKE 'documents\_index\_%'
+    LOOP
+        EXECUTE format('DROP INDEX %I', existing.name);
+        EXECUTE existing.definition || ' AND (deleted_at IS NULL)';
+    END LOOP;
+END
+$$;
@@ -0,0 +1,10 @@
+-- Transactions deleted by the sweep after they expired, kept for a while so that using their key tells the client
+-- the transaction expired rather than that it does not exist.
+CREATE TABLE "expired_transactions" (
+    id UUID PRIMARY KEY,
+    database_id BIGINT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    CONSTRAINT fk_database FOREIGN KEY(database_id) REFERENCES "databases"(id) ON DELETE CASCADE
+);
+
+CREATE INDEX "expired_transactions_expires_at_idx" ON "expired_transactions" (expires_at);
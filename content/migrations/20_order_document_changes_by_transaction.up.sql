@@ -0,0 +1,51 @@
+-- Changes are no longer serialised per database while they are written. Each change records the ID of the SQL
+-- transaction that made it, and a change is at a position after all the changes of the transactions with a lower ID,
+-- ordered by sequence within a transaction. Feeds only read the changes of the transactions below the lowest running
+-- one, so that a change committed late is never placed before a position already read.
+ALTER TABLE "document_changes" ADD COLUMN transaction_id BIGINT NOT NULL DEFAULT (pg_current_xact_id()::text)::BIGINT;
+
+-- The content of a change is only kept when small, larger documents are read from the documents themselves.
+ALTER TABLE "document_changes" ALTER COLUMN content DROP NOT NULL;
+
+DROP INDEX document_changes_database_index;
+DROP INDEX document_changes_collection_index;
+CREATE INDEX document_changes_database_index ON "document_changes"(database_id, transaction_id, sequence);
+CREATE INDEX document_changes_collection_index ON "document_changes"(collection_id, transaction_id, sequence);
+
+-- The webhooks read the changes after the position of the last change read for them.
+ALTER TABLE "webhooks" ADD COLUMN last_transaction_id BIGINT NOT NULL DEFAULT 0;
+
+-- Records a change to a document. Moving a document to the trash is recorded as a delete, and restoring it as an
+-- insert. The content is recorded up to 8 KB.
+CREATE OR REPLACE FUNCTION record_document_change() RETURNS trigger AS $$
+DECLARE
+    change_operation TEXT;
+    change_content jsonb;
+BEGIN
+    IF TG_OP = 'INSERT' AND NEW.deleted_at IS NULL THEN
+        change_operation := 'insert';
+    ELSIF TG_OP = 'INSERT' THEN
+        RETURN NULL;
+    ELSIF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+        change_operation := 'delete';
+    ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+        change_operation := 'insert';
+    ELSIF NEW.deleted_at IS NULL THEN
+        change_operation := 'update';
+    ELSE
+        RETURN NULL;
+    END IF;
+
+    IF octet_length(NEW.content::text) <= 8192 THEN
+        change_content := NEW.content;
+    END IF;
+
+    INSERT INTO document_changes (
+        database_id, collection_id, document_id, operation, key, version, content, document_created_at, created_by
+    ) SELECT
+        collections.database_id, NEW.collection_id, NEW.id, change_operation, NEW.key, NEW.version, change_content,
+        NEW.created_at, NEW.updated_by
+    FROM collections WHERE collections.id = NEW.collection_id;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,140 @@
+-- The outbox of the events of the lifecycle of the databases, collections and documents, for other services to react
+-- to the writes. Events are recorded by triggers in the SQL transaction of the write, so no event is recorded for a
+-- write that is rolled back, and writes made in a transaction are recorded once it is committed. Events are relayed
+-- in the order of the ID of the SQL transaction that recorded them then of their sequence, like the changes, and
+-- marked as published once relayed. Published events are deleted, and unpublished ones once older than the changes
+-- kept. Moving an item to the trash is recorded as a deletion, and restoring it as a creation. Events do not reference
+-- the items they are about, so that the events of a purged item are still relayed.
+CREATE TABLE "content_events" (
+    sequence BIGSERIAL PRIMARY KEY,
+    transaction_id BIGINT NOT NULL DEFAULT (pg_current_xact_id()::text)::BIGINT,
+    event TEXT NOT NULL CHECK (event IN (
+        'DatabaseCreated', 'DatabaseUpdated', 'DatabaseDeleted',
+        'CollectionCreated', 'CollectionUpdated', 'CollectionDeleted',
+        'DocumentCreated', 'DocumentUpdated', 'DocumentDeleted'
+    )),
+    database_id BIGINT NOT NULL,
+    collection_id BIGINT,
+    document_id BIGINT,
+    payload jsonb NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMPTZ
+);
+
+CREATE INDEX content_events_unpublished_index ON "content_events"(transaction_id, sequence) WHERE published_at IS NULL;
+CREATE INDEX content_events_created_at_index ON "content_events"(created_at);
+
+-- The lifecycle event of a write to an item, NULL when the write is not part of the lifecycle of the item, like
+-- writing an item in the trash. The deletion date of the item before the write is only read for updates.
+CREATE FUNCTION content_event_kind(inserted BOOLEAN, old_deleted_at TIMESTAMPTZ, new_deleted_at TIMESTAMPTZ) RETURNS TEXT AS $$
+BEGIN
+    IF inserted AND new_deleted_at IS NULL THEN
+        RETURN 'Created';
+    ELSIF inserted THEN
+        RETURN NULL;
+    ELSIF old_deleted_at IS NULL AND new_deleted_at IS NOT NULL THEN
+        RETURN 'Deleted';
+    ELSIF old_deleted_at IS NOT NULL AND new_deleted_at IS NULL THEN
+        RETURN 'Created';
+    ELSIF new_deleted_at IS NULL THEN
+        RETURN 'Updated';
+    END IF;
+
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+CREATE FUNCTION record_database_event() RETURNS TRIGGER AS $$
+DECLARE
+    kind TEXT;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        kind := content_event_kind(TRUE, NULL, NEW.deleted_at);
+    ELSE
+        kind := content_event_kind(FALSE, OLD.deleted_at, NEW.deleted_at);
+    END IF;
+
+    IF kind IS NULL THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO content_events (event, database_id, payload) VALUES (
+        'Database' || kind, NEW.id,
+        jsonb_build_object(
+            'ID', NEW.id, 'Name', NEW.name, 'UserID', NEW.user_id, 'TrashRetentionDays', NEW.trash_retention_days,
+            'CreatedAt', NEW.created_at, 'UpdatedAt', NEW.updated_at, 'DeletedAt', NEW.deleted_at
+        )
+    );
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER databases_event AFTER INSERT OR UPDATE OF name, trash_retention_days, deleted_at ON "databases"
+    FOR EACH ROW EXECUTE FUNCTION record_database_event();
+
+CREATE FUNCTION record_collection_event() RETURNS TRIGGER AS $$
+DECLARE
+    kind TEXT;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        kind := content_event_kind(TRUE, NULL, NEW.deleted_at);
+    ELSE
+        kind := content_event_kind(FALSE, OLD.deleted_at, NEW.deleted_at);
+    END IF;
+
+    IF kind IS NULL THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO content_events (event, database_id, collection_id, payload) VALUES (
+        'Collection' || kind, NEW.database_id, NEW.id,
+        jsonb_build_object(
+            'ID', NEW.id, 'DatabaseID', NEW.database_id, 'Name', NEW.name, 'Schema', NEW.schema,
+            'Search', NEW.search, 'History', NEW.history, 'CreatedAt', NEW.created_at, 'UpdatedAt', NEW.updated_at,
+            'DeletedAt', NEW.deleted_at
+        )
+    );
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER collections_event AFTER INSERT OR UPDATE OF name, schema, search, history, deleted_at ON "collections"
+    FOR EACH ROW EXECUTE FUNCTION record_collection_event();
+
+-- The content of a document is recorded up to 8 KB, larger documents are read from the documents themselves.
+CREATE FUNCTION record_document_event() RETURNS TRIGGER AS $$
+DECLARE
+    kind TEXT;
+    event_database_id BIGINT;
+    event_content jsonb;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        kind := content_event_kind(TRUE, NULL, NEW.deleted_at);
+    ELSE
+        kind := content_event_kind(FALSE, OLD.deleted_at, NEW.deleted_at);
+    END IF;
+
+    IF kind IS NULL THEN
+        RETURN NULL;
+    END IF;
+
+    SELECT database_id INTO event_database_id FROM collections WHERE id = NEW.collection_id;
+
+    IF octet_length(NEW.content::text) <= 8192 THEN
+        event_content := NEW.content;
+    END IF;
+
+    INSERT INTO content_events (event, database_id, collection_id, document_id, payload) VALUES (
+        'Document' || kind, event_database_id, NEW.collection_id, NEW.id,
+        jsonb_build_object(
+            'ID', NEW.id, 'CollectionID', NEW.collection_id, 'Key', NEW.key, 'Version', NEW.version,
+            'Content', event_content, 'UpdatedBy', NEW.updated_by, 'CreatedAt', NEW.created_at,
+            'UpdatedAt', NEW.updated_at, 'DeletedAt', NEW.deleted_at
+        )
+    );
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER documents_event AFTER INSERT OR UPDATE OF content, version, key, deleted_at ON "documents"
+    FOR EACH ROW EXECUTE FUNCTION record_document_event();
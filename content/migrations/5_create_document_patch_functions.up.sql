@@ -0,0 +1,111 @@
+-- Applies an RFC 7396 JSON Merge Patch to a document.
+CREATE FUNCTION jsonb_merge_patch(target jsonb, patch jsonb) RETURNS jsonb AS $$
+BEGIN
+    IF jsonb_typeof(patch) IS DISTINCT FROM 'object' THEN
+        RETURN patch;
+    END IF;
+
+    IF jsonb_typeof(target) IS DISTINCT FROM 'object' THEN
+        target := '{}'::jsonb;
+    END IF;
+
+    RETURN (
+        SELECT COALESCE(jsonb_object_agg(merged.key, merged.value), '{}'::jsonb)
+        FROM (
+            SELECT existing.key, existing.value
+            FROM jsonb_each(target) AS existing
+            WHERE NOT patch ? existing.key
+            UNION ALL
+            SELECT changed.key, jsonb_merge_patch(target -> changed.key, changed.value)
+            FROM jsonb_each(patch) AS changed
+            WHERE jsonb_typeof(changed.value) <> 'null'
+        ) AS merged
+    );
+END
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+-- Sets the value at a path of a document, replacing the whole document when the path is empty.
+CREATE FUNCTION jsonb_patch_set(target jsonb, path text[], value jsonb) RETURNS jsonb AS $$
+    SELECT CASE WHEN cardinality(path) = 0 THEN value ELSE jsonb_set(target, path, value, true) END
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- Applies a list of RFC 6902 JSON Patch operations to a document. The paths of the operations are
+-- arrays of path segments rather than JSON pointers. Returns NULL when an operation cannot be applied,
+-- either because a path does not exist or because a test operation failed.
+CREATE FUNCTION jsonb_patch(target jsonb, operations jsonb) RETURNS jsonb AS $$
+DECLARE
+    operation jsonb;
+    path text[];
+    parent_path text[];
+    from_path text[];
+    segment text;
+    parent jsonb;
+    value jsonb;
+BEGIN
+    FOR operation IN SELECT * FROM jsonb_array_elements(operations) LOOP
+        path := ARRAY(SELECT jsonb_array_elements_text(operation -> 'path'));
+        value := operation -> 'value';
+
+        IF operation ->> 'op' IN ('move', 'copy') THEN
+            from_path := ARRAY(SELECT jsonb_array_elements_text(operation -> 'from'));
+            value := target #> from_path;
+            IF value IS NULL THEN
+                RETURN NULL;
+            END IF;
+
+            IF operation ->> 'op' = 'move' THEN
+                -- A value cannot be moved into one of its children
+                IF cardinality(from_path) = 0 OR path[1:cardinality(from_path)] = from_path AND path <> from_path THEN
+                    RETURN NULL;
+                END IF;
+
+                target := target #- from_path;
+            END IF;
+        END IF;
+
+        CASE operation ->> 'op'
+        WHEN 'add', 'move', 'copy' THEN
+            IF cardinality(path) = 0 THEN
+                target := value;
+                CONTINUE;
+            END IF;
+
+            parent_path := path[1:cardinality(path) - 1];
+            segment := path[cardinality(path)];
+            parent := target #> parent_path;
+
+            IF jsonb_typeof(parent) = 'object' THEN
+                target := jsonb_patch_set(target, path, value);
+            ELSIF jsonb_typeof(parent) = 'array' THEN
+                IF segment = '-' OR segment = jsonb_array_length(parent)::text THEN
+                    target := jsonb_patch_set(target, parent_path, parent || jsonb_build_array(value));
+                ELSIF segment ~ '^(0|[1-9][0-9]{0,8})$' AND segment::bigint < jsonb_array_length(parent) THEN
+                    target := jsonb_insert(target, path, value);
+                ELSE
+                    RETURN NULL;
+                END IF;
+            ELSE
+                RETURN NULL;
+            END IF;
+        WHEN 'remove' THEN
+            IF cardinality(path) = 0 OR target #> path IS NULL THEN
+                RETURN NULL;
+            END IF;
+
+            target := target #- path;
+        WHEN 'replace' THEN
+            IF target #> path IS NULL THEN
+                RETURN NULL;
+            END IF;
+
+            target := jsonb_patch_set(target, path, value);
+        WHEN 'test' THEN
+            IF target #> path IS DISTINCT FROM value THEN
+                RETURN NULL;
+            END IF;
+        END CASE;
+    END LOOP;
+
+    RETURN target;
+END
+$$ LANGUAGE plpgsql IMMUTABLE;
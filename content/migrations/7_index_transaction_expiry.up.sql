@@ -0,0 +1 @@
+CREATE INDEX "transactions_expires_at_idx" ON "transactions" (expires_at);
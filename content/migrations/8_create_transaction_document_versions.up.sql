@@ -0,0 +1,9 @@
+-- The committed version of every document read or written in a transaction, when first seen by the transaction.
+-- Used to detect documents changed outside the transaction when it is committed.
+CREATE TABLE "transaction_document_versions" (
+    transaction_id UUID NOT NULL,
+    document_id BIGINT NOT NULL,
+    version BIGINT NOT NULL,
+    PRIMARY KEY (transaction_id, document_id),
+    CONSTRAINT fk_transaction FOREIGN KEY(transaction_id) REFERENCES "transactions"(id) ON DELETE CASCADE
+);
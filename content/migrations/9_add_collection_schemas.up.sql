@@ -0,0 +1,2 @@
+ALTER TABLE "collections" ADD COLUMN schema jsonb;
+ALTER TABLE "transactional_collections" ADD COLUMN schema jsonb;
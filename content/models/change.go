@@ -0,0 +1,132 @@
+package models
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/go-jet/jet/v2/postgres"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/models/generated/content/public/table"
+	"encore.app/content/query"
+)
+
+// ChangeRetention is how long the changes made to the documents are kept for clients to resume their feed
+// of changes.
+const ChangeRetention = 7 * 24 * time.Hour
+
+// ChangePosition is the position of a change in the feeds of changes. Changes are ordered by the ID of the SQL
+// transaction that made them, then by sequence within a transaction.
+type ChangePosition struct {
+	TransactionID int64
+	Sequence      int64
+}
+
+// ChangeModelPosition returns the position of a change in the feeds of changes.
+func ChangeModelPosition(change *model.DocumentChanges) ChangePosition {
+	return ChangePosition{TransactionID: change.TransactionID, Sequence: change.Sequence}
+}
+
+// Before tells whether the position is before another one.
+func (p ChangePosition) Before(other ChangePosition) bool {
+	return p.TransactionID < other.TransactionID || (p.TransactionID == other.TransactionID && p.Sequence < other.Sequence)
+}
+
+// lowestRunningTransaction is the ID of the oldest SQL transaction still running. All the SQL transactions
+// with a lower ID are over, no change can be committed before a position below it anymore.
+var lowestRunningTransaction = postgres.IntExp(postgres.Raw("(pg_snapshot_xmin(pg_current_snapshot())::text)::BIGINT"))
+
+// changesCondition selects the changes made to the documents of a database, or of one of its collections
+// when a collection ID is given.
+func changesCondition(databaseID, collectionID int64) postgres.BoolExpression {
+	condition := table.DocumentChanges.DatabaseID.EQ(postgres.Int64(databaseID))
+	if collectionID != 0 {
+		condition = condition.AND(table.DocumentChanges.CollectionID.EQ(postgres.Int64(collectionID)))
+	}
+
+	return condition
+}
+
+// changesFilterCondition selects the changes with a content matching a filter. The content of a change is only
+// kept when small, the content of the document is matched for larger ones.
+func changesFilterCondition(filter *query.Filter) postgres.BoolExpression {
+	documentMatches := postgres.EXISTS(
+		postgres.SELECT(table.Documents.ID).FROM(table.Documents).WHERE(
+			table.Documents.ID.EQ(table.DocumentChanges.DocumentID).
+				AND(filter.Condition(table.Documents.Content)),
+		),
+	)
+
+	return filter.Condition(table.DocumentChanges.Content).
+		OR(table.DocumentChanges.Content.IS_NULL().AND(documentMatches))
+}
+
+// ListDocumentChanges lists at most limit changes made to the documents of a database, or of one of its
+// collections when a collection ID is given, after the given position and in the order of their position.
+// When a filter is given, only the changes with a content matching it are listed. Only committed changes are
+// recorded, and changes made in a transaction are recorded once it is committed. The changes of the SQL
+// transactions that could still be running are not listed yet, so that no change is ever listed before a
+// position already read.
+func ListDocumentChanges(ctx context.Context, databaseID, collectionID int64, filter *query.Filter, after ChangePosition, limit int64) ([]*model.DocumentChanges, error) {
+	condition := changesCondition(databaseID, collectionID).
+		AND(table.DocumentChanges.TransactionID.LT(lowestRunningTransaction)).
+		AND(table.DocumentChanges.TransactionID.GT(postgres.Int64(after.TransactionID)).OR(
+			table.DocumentChanges.TransactionID.EQ(postgres.Int64(after.TransactionID)).
+				AND(table.DocumentChanges.Sequence.GT(postgres.Int64(after.Sequence))),
+		))
+	if filter != nil {
+		condition = condition.AND(changesFilterCondition(filter))
+	}
+
+	statement := postgres.SELECT(
+		table.DocumentChanges.AllColumns,
+	).FROM(table.DocumentChanges).WHERE(
+		condition,
+	).ORDER_BY(
+		table.DocumentChanges.TransactionID.ASC(),
+		table.DocumentChanges.Sequence.ASC(),
+	).LIMIT(limit)
+
+	var changes []*model.DocumentChanges
+	err := statement.QueryContext(ctx, conn(ctx), &changes)
+	if err != nil {
+		log.WithError(err).Errorf("Could not query the changes of database %d", databaseID)
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// CurrentChangePosition returns the position before all the changes that are not listed yet, those of the SQL
+// transactions that could still be running and of the ones to come.
+func CurrentChangePosition(ctx context.Context) (ChangePosition, error) {
+	query, args := postgres.SELECT(lowestRunningTransaction).Sql()
+
+	var transactionID int64
+	err := conn(ctx).QueryRowContext(ctx, query, args...).Scan(&transactionID)
+	if err != nil {
+		log.WithError(err).Error("Could not query the current position of the changes")
+		return ChangePosition{}, err
+	}
+
+	return ChangePosition{TransactionID: transactionID - 1, Sequence: math.MaxInt64}, nil
+}
+
+// DeleteExpiredDocumentChanges deletes all the changes made to the documents before the given time.
+// Returns the number of deleted changes.
+func DeleteExpiredDocumentChanges(ctx context.Context, before time.Time) (int64, error) {
+	query, args := table.DocumentChanges.
+		DELETE().
+		WHERE(table.DocumentChanges.CreatedAt.LT(postgres.TimestampzT(before))).
+		Sql()
+
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		log.WithError(err).Error("Could not delete expired document changes")
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -2,12 +2,16 @@ package models
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 
 	"github.com/go-jet/jet/v2/postgres"
 	log "github.com/sirupsen/logrus"
 
 	"encore.app/content/models/generated/content/public/model"
 	"encore.app/content/models/generated/content/public/table"
+	"encore.app/content/query"
+	"encore.app/pagination"
 )
 
 // NewCollection generates a new collection structure from a name and the
@@ -19,27 +23,62 @@ func NewCollection(name string, databaseID int64) *model.Collections {
 	}
 }
 
-// ListCollections lists all collections for a given database, it returns
-// a nil collection on an error.
-func ListCollections(ctx context.Context, databaseID int64) ([]*model.Collections, error) {
+// CollectionSortKey returns the key to sort collections by given its name, either `created_at`
+// or `updated_at`. Collections are sorted by creation date when no name is given.
+func CollectionSortKey(sortBy string) (pagination.SortKey, error) {
+	switch sortBy {
+	case "", "created_at":
+		return pagination.ColumnKey("created_at", table.Collections.CreatedAt), nil
+	case "updated_at":
+		return pagination.ColumnKey("updated_at", table.Collections.UpdatedAt), nil
+	}
+
+	return pagination.SortKey{}, fmt.Errorf("collections can only be sorted by `created_at` or `updated_at`")
+}
+
+// ListCollections lists a page of collections for a given database, it returns a nil collection
+// on an error. The cursor to the next page is returned if there are more collections to fetch.
+func ListCollections(ctx context.Context, databaseID int64, page *pagination.Page) ([]*model.Collections, string, error) {
 	statement := postgres.SELECT(
 		table.Collections.ID,
 		table.Collections.Name,
 		table.Collections.DatabaseID,
+		table.Collections.Schema,
+		table.Collections.Search,
+		table.Collections.History,
 		table.Collections.UpdatedAt,
 		table.Collections.CreatedAt,
-	).FROM(table.Collections).WHERE(
-		table.Collections.DatabaseID.EQ(postgres.Int64(databaseID)),
-	)
+	).FROM(collectionsTable(ctx)).WHERE(
+		page.Where(
+			table.Collections.DatabaseID.EQ(postgres.Int64(databaseID)).
+				AND(table.Collections.DeletedAt.IS_NULL()),
+			table.Collections.ID,
+		),
+	).ORDER_BY(
+		page.OrderBy(table.Collections.ID)...,
+	).LIMIT(page.Fetch())
 
 	var collections []*model.Collections
-	err := statement.QueryContext(ctx, db, &collections)
+	err := queryOverlay(ctx, statement, &collections)
 	if err != nil {
 		log.WithError(err).Error("Could not query collections")
-		return nil, err
+		return nil, "", err
 	}
 
-	return collections, nil
+	nextCursor := ""
+	if page.HasNext(len(collections)) {
+		collections = collections[:page.Limit]
+
+		last := collections[len(collections)-1]
+		value := last.CreatedAt
+		if page.SortKey.Name == "updated_at" {
+			value = last.UpdatedAt
+		}
+
+		nextCursor = page.Next(last.ID, pagination.TimestampValue(value))
+	}
+
+	return collections, nextCursor, nil
 }
 
 // GetCollectionByID fetches a single collection record given an ID and the associated
@@ -49,20 +88,25 @@ func GetCollectionByID(ctx context.Context, id, userID int64) (*model.Collection
 		table.Collections.ID,
 		table.Collections.Name,
 		table.Collections.DatabaseID,
+		table.Collections.Schema,
+		table.Collections.Search,
+		table.Collections.History,
 		table.Collections.UpdatedAt,
 		table.Collections.CreatedAt,
 	).FROM(
-		table.Collections.LEFT_JOIN(
+		collectionsTable(ctx).LEFT_JOIN(
 			table.Databases,
 			table.Collections.DatabaseID.EQ(table.Databases.ID),
 		),
 	).WHERE(
 		table.Collections.ID.EQ(postgres.Int64(id)).
-			AND(table.Databases.UserID.EQ(postgres.Int64(userID))),
+			AND(table.Databases.UserID.EQ(postgres.Int64(userID))).
+			AND(table.Collections.DeletedAt.IS_NULL()).
+			AND(table.Databases.DeletedAt.IS_NULL()),
 	).LIMIT(1)
 
 	collection := model.Collections{}
-	err := statement.QueryContext(ctx, db, &collection)
+	err := queryOverlay(ctx, statement, &collection)
 	if err != nil {
 		log.WithError(err).Errorf("Could not query collection for id %d", id)
 		return nil, err
@@ -71,20 +115,57 @@ func GetCollectionByID(ctx context.Context, id, userID int64) (*model.Collection
 	return &collection, nil
 }
 
+// GetCollectionByName fetches a single collection record given its name, the ID of its database
+// and the associated user ID. Returns nil on an error.
+func GetCollectionByName(ctx context.Context, databaseID int64, name string, userID int64) (*model.Collections, error) {
+	statement := postgres.SELECT(
+		table.Collections.ID,
+		table.Collections.Name,
+		table.Collections.DatabaseID,
+		table.Collections.Schema,
+		table.Collections.Search,
+		table.Collections.History,
+		table.Collections.UpdatedAt,
+		table.Collections.CreatedAt,
+	).FROM(
+		collectionsTable(ctx).LEFT_JOIN(
+			table.Databases,
+			table.Collections.DatabaseID.EQ(table.Databases.ID),
+		),
+	).WHERE(
+		table.Collections.DatabaseID.EQ(postgres.Int64(databaseID)).
+			AND(table.Collections.Name.EQ(postgres.String(name))).
+			AND(table.Databases.UserID.EQ(postgres.Int64(userID))).
+			AND(table.Collections.DeletedAt.IS_NULL()).
+			AND(table.Databases.DeletedAt.IS_NULL()),
+	).LIMIT(1)
+
+	collection := model.Collections{}
+	err := queryOverlay(ctx, statement, &collection)
+	if err != nil {
+		log.WithError(err).Errorf("Could not query collection for name `%s` in database %d", name, databaseID)
+		return nil, err
+	}
+
+	return &collection, nil
+}
+
 // ValidateCollectionConstraint validates that no collection with the same name exists
-// for a single database.
+// for a single database. Collections in the trash are ignored. In a transaction, the collections of the
+// transaction are validated.
 func ValidateCollectionConstraint(ctx context.Context, collection *model.Collections) bool {
-	query, args := postgres.SELECT(
+	statement := postgres.SELECT(
 		table.Collections.ID,
 	).FROM(
-		table.Collections,
+		collectionsTable(ctx),
 	).WHERE(
 		table.Collections.Name.EQ(postgres.String(collection.Name)).
-			AND(table.Collections.DatabaseID.EQ(postgres.Int64(collection.DatabaseID))),
-	).LIMIT(1).Sql()
+			AND(table.Collections.DatabaseID.EQ(postgres.Int64(collection.DatabaseID))).
+			AND(table.Collections.DeletedAt.IS_NULL()),
+	).LIMIT(1)
 
 	id := 0
-	err := db.QueryRowContext(ctx, query, args...).Scan(&id)
+	err := queryRowOverlay(ctx, statement).Scan(&id)
 	if err == nil && id != 0 {
 		log.Warning("Tried to save collection, a collection already exists for this name and database_id")
 		return false
@@ -94,23 +175,38 @@ func ValidateCollectionConstraint(ctx context.Context, collection *model.Collect
 }
 
 // SaveCollection saves the data of the collection it used on. This method only saves
-// the name and database ID from the struct and updates the timestamps. SaveCollection will
-// trigger an error if the constraints are not respected.
+// the name, database ID, schema, search configuration and history setting from the struct and updates the timestamps. SaveCollection will
+// trigger an error if the constraints are not respected. In a transaction, the collection is saved
+// in the transaction.
 func SaveCollection(ctx context.Context, collection *model.Collections) error {
+	if transaction := TransactionFromContext(ctx); transaction != nil {
+		if collection.ID == 0 {
+			return insertTransactionalCollection(ctx, transaction, collection)
+		}
+
+		return writeTransactionalCollection(ctx, transaction, collection, false)
+	}
+
 	if collection.ID == 0 {
 		query, args := table.Collections.INSERT(
 			table.Collections.Name,
 			table.Collections.DatabaseID,
+			table.Collections.Schema,
+			table.Collections.Search,
+			table.Collections.History,
 		).VALUES(
 			collection.Name,
 			collection.DatabaseID,
+			collection.Schema,
+			collection.Search,
+			collection.History,
 		).RETURNING(
 			table.Collections.ID,
 			table.Collections.UpdatedAt,
 			table.Collections.CreatedAt,
 		).Sql()
 
-		err := db.
+		err := conn(ctx).
 			QueryRowContext(ctx, query, args...).
 			Scan(&collection.ID, &collection.UpdatedAt, &collection.CreatedAt)
 
@@ -125,6 +221,10 @@ func SaveCollection(ctx context.Context, collection *model.Collections) error {
 	query, args := table.Collections.UPDATE().SET(
 		table.Collections.Name.SET(postgres.String(collection.Name)),
 		table.Collections.DatabaseID.SET(postgres.Int64(collection.DatabaseID)),
+		table.Collections.Schema.SET(jsonValue(collection.Schema)),
+		table.Collections.Search.SET(jsonValue(collection.Search)),
+		table.Collections.History.SET(postgres.Bool(collection.History)),
+		table.Collections.UpdatedAt.SET(postgres.NOW()),
 	).WHERE(
 		table.Collections.ID.EQ(postgres.Int64(collection.ID)),
 	).RETURNING(
@@ -133,7 +233,7 @@ func SaveCollection(ctx context.Context, collection *model.Collections) error {
 		table.Collections.CreatedAt,
 	).Sql()
 
-	err := db.
+	err := conn(ctx).
 		QueryRowContext(ctx, query, args...).
 		Scan(&collection.ID, &collection.UpdatedAt, &collection.CreatedAt)
 
@@ -145,16 +245,26 @@ func SaveCollection(ctx context.Context, collection *model.Collections) error {
 	return nil
 }
 
-// DeleteCollection deletes the Collection is it called on.
+// DeleteCollection moves the Collection is it called on to the trash, along with its documents which
+// are kept as they are until the collection is restored or purged. In a transaction, the collection is
+// deleted in the transaction and moved to the trash once committed.
 func DeleteCollection(ctx context.Context, collection *model.Collections) error {
-	query, args := table.Collections.
-		DELETE().
-		WHERE(table.Collections.ID.EQ(postgres.Int64(collection.ID))).
-		RETURNING(table.Collections.ID).
-		Sql()
+	if transaction := TransactionFromContext(ctx); transaction != nil {
+		return writeTransactionalCollection(ctx, transaction, collection, true)
+	}
+
+	query, args := table.Collections.UPDATE().SET(
+		table.Collections.DeletedAt.SET(postgres.NOW()),
+	).WHERE(
+		table.Collections.ID.EQ(postgres.Int64(collection.ID)).
+			AND(table.Collections.DeletedAt.IS_NULL()),
+	).RETURNING(
+		table.Collections.ID,
+		table.Collections.DeletedAt,
+	).Sql()
 
 	deletedID := 0
-	err := db.QueryRowContext(ctx, query, args...).Scan(&deletedID)
+	err := conn(ctx).QueryRowContext(ctx, query, args...).Scan(&deletedID, &collection.DeletedAt)
 	if err != nil || deletedID == 0 {
 		log.WithError(err).Error("Could not delete collection")
 		return err
@@ -162,3 +272,13 @@ func DeleteCollection(ctx context.Context, collection *model.Collections) error
 
 	return nil
 }
+
+// jsonValue returns the expression of an optional JSON value of a collection, like its schema, NULL when
+// the collection has none.
+func jsonValue(value *string) postgres.StringExpression {
+	if value == nil {
+		return postgres.StringExp(postgres.NULL)
+	}
+
+	return query.JSONB(json.RawMessage(*value))
+}
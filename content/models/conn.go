@@ -0,0 +1,127 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/go-jet/jet/v2/qrm"
+	log "github.com/sirupsen/logrus"
+)
+
+// executor runs queries, either directly on the database or in an SQL transaction.
+type executor interface {
+	qrm.DB
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type sqlTransactionContextKey struct{}
+
+// conn returns the SQL transaction started by RunInSQLTransaction for the context, or the database
+// when the context is not in an SQL transaction.
+func conn(ctx context.Context) executor {
+	if tx, ok := ctx.Value(sqlTransactionContextKey{}).(*sql.Tx); ok {
+		return tx
+	}
+
+	return db
+}
+
+// RunInSQLTransaction runs the function in a single SQL transaction. All the queries made by the models
+// with the context given to the function are part of the SQL transaction, which is committed if the
+// function succeeds and rolled back if it returns an error. When the context is already in an SQL
+// transaction, the function runs in that transaction.
+func RunInSQLTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(sqlTransactionContextKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		log.WithError(err).Error("Could not begin SQL transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(context.WithValue(ctx, sqlTransactionContextKey{}, tx))
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.WithError(err).Error("Could not commit SQL transaction")
+		return err
+	}
+
+	return nil
+}
+
+// runInSavepoint runs the function in a savepoint when the context is in an SQL transaction, so that the SQL
+// transaction can still be used once the function fails: its queries are rolled back instead of aborting the
+// whole SQL transaction. Outside of an SQL transaction, the function runs as is.
+func runInSavepoint(ctx context.Context, fn func() error) error {
+	tx, ok := ctx.Value(sqlTransactionContextKey{}).(*sql.Tx)
+	if !ok {
+		return fn()
+	}
+
+	_, err := tx.ExecContext(ctx, "SAVEPOINT write")
+	if err != nil {
+		log.WithError(err).Error("Could not create savepoint")
+		return err
+	}
+
+	err = fn()
+	if err != nil {
+		_, rollbackErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT write")
+		if rollbackErr != nil {
+			log.WithError(rollbackErr).Error("Could not roll back to savepoint")
+		}
+
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT write")
+	if err != nil {
+		log.WithError(err).Error("Could not release savepoint")
+		return err
+	}
+
+	return nil
+}
+
+// RunExclusively runs the function unless the lock with the given name is held by another caller, and returns
+// whether it ran. The lock is a session advisory lock held on a dedicated connection while the function runs,
+// so that it is released by the database if the caller goes away.
+func RunExclusively(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	lockConn, err := db.Conn(ctx)
+	if err != nil {
+		log.WithError(err).Error("Could not get a connection to lock")
+		return false, err
+	}
+	defer lockConn.Close()
+
+	locked := false
+	err = lockConn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", name).Scan(&locked)
+	if err != nil {
+		log.WithError(err).Errorf("Could not take lock %s", name)
+		return false, err
+	}
+
+	if !locked {
+		return false, nil
+	}
+
+	defer func() {
+		// The lock is released even when the context is canceled
+		_, err := lockConn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", name)
+		if err != nil {
+			// The connection is closed instead of going back to the pool while still holding the lock
+			log.WithError(err).Errorf("Could not release lock %s", name)
+			_ = lockConn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+	}()
+
+	return true, fn(ctx)
+}
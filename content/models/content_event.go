@@ -0,0 +1,96 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-jet/jet/v2/postgres"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/models/generated/content/public/table"
+)
+
+// ContentEventPosition returns the position of an event of the lifecycle of the databases, collections and
+// documents. Events are ordered like the changes made to the documents.
+func ContentEventPosition(event *model.ContentEvents) ChangePosition {
+	return ChangePosition{TransactionID: event.TransactionID, Sequence: event.Sequence}
+}
+
+// ListUnpublishedContentEvents lists at most limit events of the lifecycle of the databases, collections and
+// documents that are not published yet, after the given position and in the order of their position. Events are
+// recorded by the database along with the writes, only once the writes are committed. The events of the SQL
+// transactions that could still be running are not listed yet, so that no event is ever listed before a position
+// already read.
+func ListUnpublishedContentEvents(ctx context.Context, after ChangePosition, limit int64) ([]*model.ContentEvents, error) {
+	statement := postgres.SELECT(
+		table.ContentEvents.AllColumns,
+	).FROM(table.ContentEvents).WHERE(
+		table.ContentEvents.PublishedAt.IS_NULL().
+			AND(table.ContentEvents.TransactionID.LT(lowestRunningTransaction)).
+			AND(table.ContentEvents.TransactionID.GT(postgres.Int64(after.TransactionID)).OR(
+				table.ContentEvents.TransactionID.EQ(postgres.Int64(after.TransactionID)).
+					AND(table.ContentEvents.Sequence.GT(postgres.Int64(after.Sequence))),
+			)),
+	).ORDER_BY(
+		table.ContentEvents.TransactionID.ASC(),
+		table.ContentEvents.Sequence.ASC(),
+	).LIMIT(limit)
+
+	var events []*model.ContentEvents
+	err := statement.QueryContext(ctx, conn(ctx), &events)
+	if err != nil {
+		log.WithError(err).Error("Could not query the unpublished content events")
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// MarkContentEventsPublished marks the events with the given sequences as published, so that they are no longer
+// listed and are deleted by the next sweep.
+func MarkContentEventsPublished(ctx context.Context, sequences []int64) error {
+	if len(sequences) == 0 {
+		return nil
+	}
+
+	expressions := make([]postgres.Expression, len(sequences))
+	for i, sequence := range sequences {
+		expressions[i] = postgres.Int64(sequence)
+	}
+
+	query, args := table.ContentEvents.UPDATE().SET(
+		table.ContentEvents.PublishedAt.SET(postgres.TimestampzT(time.Now())),
+	).WHERE(
+		table.ContentEvents.Sequence.IN(expressions...).
+			AND(table.ContentEvents.PublishedAt.IS_NULL()),
+	).Sql()
+
+	_, err := conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		log.WithError(err).Error("Could not mark the content events as published")
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpiredContentEvents deletes the events that are published, and the ones recorded before the given time
+// that were never published. Returns the number of deleted events.
+func DeleteExpiredContentEvents(ctx context.Context, before time.Time) (int64, error) {
+	query, args := table.ContentEvents.
+		DELETE().
+		WHERE(
+			table.ContentEvents.PublishedAt.IS_NOT_NULL().
+				OR(table.ContentEvents.CreatedAt.LT(postgres.TimestampzT(before))),
+		).
+		Sql()
+
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		log.WithError(err).Error("Could not delete expired content events")
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
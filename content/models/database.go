@@ -2,6 +2,7 @@ package models
 
 import (
 	"context"
+	"fmt"
 
 	"encore.dev/storage/sqldb"
 	"github.com/go-jet/jet/v2/postgres"
@@ -9,40 +10,75 @@ import (
 
 	"encore.app/content/models/generated/content/public/model"
 	"encore.app/content/models/generated/content/public/table"
+	"encore.app/pagination"
 )
 
 var db = sqldb.Named("content").Stdlib()
 
 // NewDatabase generates a new database structure from a name and the
-// associated user ID.
+// associated user ID, keeping its items in the trash for DefaultTrashRetentionDays.
 func NewDatabase(name string, userID int64) *model.Databases {
 	return &model.Databases{
-		Name:   name,
-		UserID: userID,
+		Name:               name,
+		UserID:             userID,
+		TrashRetentionDays: DefaultTrashRetentionDays,
 	}
 }
 
-// ListDatabase lists all databases for a given user, it returns
-// a nil database on an error.
-func ListDatabase(ctx context.Context, userID int64) ([]*model.Databases, error) {
+// DatabaseSortKey returns the key to sort databases by given its name, either `created_at`
+// or `updated_at`. Databases are sorted by creation date when no name is given.
+func DatabaseSortKey(sortBy string) (pagination.SortKey, error) {
+	switch sortBy {
+	case "", "created_at":
+		return pagination.ColumnKey("created_at", table.Databases.CreatedAt), nil
+	case "updated_at":
+		return pagination.ColumnKey("updated_at", table.Databases.UpdatedAt), nil
+	}
+
+	return pagination.SortKey{}, fmt.Errorf("databases can only be sorted by `created_at` or `updated_at`")
+}
+
+// ListDatabase lists a page of databases for a given user, it returns a nil database
+// on an error. The cursor to the next page is returned if there are more databases to fetch.
+func ListDatabase(ctx context.Context, userID int64, page *pagination.Page) ([]*model.Databases, string, error) {
 	statement := postgres.SELECT(
 		table.Databases.ID,
 		table.Databases.Name,
 		table.Databases.UserID,
+		table.Databases.TrashRetentionDays,
 		table.Databases.UpdatedAt,
 		table.Databases.CreatedAt,
 	).FROM(table.Databases).WHERE(
-		table.Databases.UserID.EQ(postgres.Int64(userID)),
-	)
+		page.Where(
+			table.Databases.UserID.EQ(postgres.Int64(userID)).
+				AND(table.Databases.DeletedAt.IS_NULL()),
+			table.Databases.ID,
+		),
+	).ORDER_BY(
+		page.OrderBy(table.Databases.ID)...,
+	).LIMIT(page.Fetch())
 
 	var databases []*model.Databases
-	err := statement.QueryContext(ctx, db, &databases)
+	err := statement.QueryContext(ctx, conn(ctx), &databases)
 	if err != nil {
 		log.WithError(err).Error("Could not query databases")
-		return nil, err
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if page.HasNext(len(databases)) {
+		databases = databases[:page.Limit]
+
+		last := databases[len(databases)-1]
+		value := last.CreatedAt
+		if page.SortKey.Name == "updated_at" {
+			value = last.UpdatedAt
+		}
+
+		nextCursor = page.Next(last.ID, pagination.TimestampValue(value))
 	}
 
-	return databases, nil
+	return databases, nextCursor, nil
 }
 
 // GetDatabaseByID fetches a single database record given an ID and the associated
@@ -52,17 +88,19 @@ func GetDatabaseByID(ctx context.Context, id, userID int64) (*model.Databases, e
 		table.Databases.ID,
 		table.Databases.Name,
 		table.Databases.UserID,
+		table.Databases.TrashRetentionDays,
 		table.Databases.UpdatedAt,
 		table.Databases.CreatedAt,
 	).FROM(
 		table.Databases,
 	).WHERE(
 		table.Databases.ID.EQ(postgres.Int64(id)).
-			AND(table.Databases.UserID.EQ(postgres.Int64(userID))),
+			AND(table.Databases.UserID.EQ(postgres.Int64(userID))).
+			AND(table.Databases.DeletedAt.IS_NULL()),
 	).LIMIT(1)
 
 	database := model.Databases{}
-	err := statement.QueryContext(ctx, db, &database)
+	err := statement.QueryContext(ctx, conn(ctx), &database)
 	if err != nil {
 		log.WithError(err).Errorf("Could not query database for id %d", id)
 		return nil, err
@@ -71,8 +109,36 @@ func GetDatabaseByID(ctx context.Context, id, userID int64) (*model.Databases, e
 	return &database, nil
 }
 
+// GetDatabaseByName fetches a single database record given its name and the associated
+// user ID. Returns nil on an error.
+func GetDatabaseByName(ctx context.Context, name string, userID int64) (*model.Databases, error) {
+	statement := postgres.SELECT(
+		table.Databases.ID,
+		table.Databases.Name,
+		table.Databases.UserID,
+		table.Databases.TrashRetentionDays,
+		table.Databases.UpdatedAt,
+		table.Databases.CreatedAt,
+	).FROM(
+		table.Databases,
+	).WHERE(
+		table.Databases.Name.EQ(postgres.String(name)).
+			AND(table.Databases.UserID.EQ(postgres.Int64(userID))).
+			AND(table.Databases.DeletedAt.IS_NULL()),
+	).LIMIT(1)
+
+	database := model.Databases{}
+	err := statement.QueryContext(ctx, conn(ctx), &database)
+	if err != nil {
+		log.WithError(err).Errorf("Could not query database for name `%s`", name)
+		return nil, err
+	}
+
+	return &database, nil
+}
+
 // ValidateDatabaseConstraint validates that no database with the same name exists
-// for a single user.
+// for a single user. Databases in the trash are ignored.
 func ValidateDatabaseConstraint(ctx context.Context, database *model.Databases) bool {
 	query, args := postgres.SELECT(
 		table.Databases.ID,
@@ -80,11 +146,12 @@ func ValidateDatabaseConstraint(ctx context.Context, database *model.Databases)
 		table.Databases,
 	).WHERE(
 		table.Databases.Name.EQ(postgres.String(database.Name)).
-			AND(table.Databases.UserID.EQ(postgres.Int64(database.UserID))),
+			AND(table.Databases.UserID.EQ(postgres.Int64(database.UserID))).
+			AND(table.Databases.DeletedAt.IS_NULL()),
 	).LIMIT(1).Sql()
 
 	id := 0
-	err := db.QueryRowContext(ctx, query, args...).Scan(&id)
+	err := conn(ctx).QueryRowContext(ctx, query, args...).Scan(&id)
 	if err == nil && id != 0 {
 		log.Warning("Tried to save database, a database already exists for this name and user_id")
 		return false
@@ -94,23 +161,25 @@ func ValidateDatabaseConstraint(ctx context.Context, database *model.Databases)
 }
 
 // SaveDatabase saves the data of the database it used on. This method only saves
-// the name and user ID from the struct and updates the timestamps. SaveDatabase will
+// the name, user ID and trash retention from the struct and updates the timestamps. SaveDatabase will
 // trigger an error if the constraints are not respected.
 func SaveDatabase(ctx context.Context, database *model.Databases) error {
 	if database.ID == 0 {
 		query, args := table.Databases.INSERT(
 			table.Databases.Name,
 			table.Databases.UserID,
+			table.Databases.TrashRetentionDays,
 		).VALUES(
 			database.Name,
 			database.UserID,
+			database.TrashRetentionDays,
 		).RETURNING(
 			table.Databases.ID,
 			table.Databases.UpdatedAt,
 			table.Databases.CreatedAt,
 		).Sql()
 
-		err := db.
+		err := conn(ctx).
 			QueryRowContext(ctx, query, args...).
 			Scan(&database.ID, &database.UpdatedAt, &database.CreatedAt)
 
@@ -125,6 +194,8 @@ func SaveDatabase(ctx context.Context, database *model.Databases) error {
 	query, args := table.Databases.UPDATE().SET(
 		table.Databases.Name.SET(postgres.String(database.Name)),
 		table.Databases.UserID.SET(postgres.Int64(database.UserID)),
+		table.Databases.TrashRetentionDays.SET(postgres.Int32(database.TrashRetentionDays)),
+		table.Databases.UpdatedAt.SET(postgres.NOW()),
 	).WHERE(
 		table.Databases.ID.EQ(postgres.Int64(database.ID)),
 	).RETURNING(
@@ -133,7 +204,7 @@ func SaveDatabase(ctx context.Context, database *model.Databases) error {
 		table.Databases.CreatedAt,
 	).Sql()
 
-	err := db.
+	err := conn(ctx).
 		QueryRowContext(ctx, query, args...).
 		Scan(&database.ID, &database.UpdatedAt, &database.CreatedAt)
 
@@ -145,16 +216,21 @@ func SaveDatabase(ctx context.Context, database *model.Databases) error {
 	return nil
 }
 
-// DeleteDatabase deletes the database is it called on.
+// DeleteDatabase moves the database is it called on to the trash, along with its collections and
+// documents which are kept as they are until the database is restored or purged.
 func DeleteDatabase(ctx context.Context, database *model.Databases) error {
-	query, args := table.Databases.
-		DELETE().
-		WHERE(table.Databases.ID.EQ(postgres.Int64(database.ID))).
-		RETURNING(table.Databases.ID).
-		Sql()
+	query, args := table.Databases.UPDATE().SET(
+		table.Databases.DeletedAt.SET(postgres.NOW()),
+	).WHERE(
+		table.Databases.ID.EQ(postgres.Int64(database.ID)).
+			AND(table.Databases.DeletedAt.IS_NULL()),
+	).RETURNING(
+		table.Databases.ID,
+		table.Databases.DeletedAt,
+	).Sql()
 
 	deletedID := 0
-	err := db.QueryRowContext(ctx, query, args...).Scan(&deletedID)
+	err := conn(ctx).QueryRowContext(ctx, query, args...).Scan(&deletedID, &database.DeletedAt)
 	if err != nil || deletedID == 0 {
 		log.WithError(err).Error("Could not delete database")
 		return err
@@ -2,98 +2,300 @@ package models
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/go-jet/jet/v2/postgres"
 	log "github.com/sirupsen/logrus"
 
 	"encore.app/content/models/generated/content/public/model"
 	"encore.app/content/models/generated/content/public/table"
+	"encore.app/content/query"
+	"encore.app/pagination"
 )
 
 // NewDocument generates a new Document structure using the given content for
-// a specific collection.
-func NewDocument(content string, collectionID int64) *model.Documents {
-	return &model.Documents{
+// a specific collection, addressable by the given key unless empty.
+func NewDocument(content string, collectionID int64, key string) *model.Documents {
+	document := &model.Documents{
 		Content:      content,
 		CollectionID: collectionID,
 	}
+
+	if key != "" {
+		document.Key = &key
+	}
+
+	return document
 }
 
-// ListDocuments lists all documents for a given collection, returning an empty slice
-// on an error.
-func ListDocuments(ctx context.Context, CollectionID int64) ([]*model.Documents, error) {
-	statement := postgres.SELECT(
+// contentSortPrefix is the prefix of the sort keys sorting documents by a path in their content.
+const contentSortPrefix = "content."
+
+// DocumentSortKey returns the key to sort documents by given its name, either `created_at`,
+// `updated_at` or a path in the content of the documents prefixed by `content.`, like
+// `content.address.city`. Documents are sorted by creation date when no name is given.
+func DocumentSortKey(sortBy string) (pagination.SortKey, error) {
+	switch sortBy {
+	case "", "created_at":
+		return pagination.ColumnKey("created_at", table.Documents.CreatedAt), nil
+	case "updated_at":
+		return pagination.ColumnKey("updated_at", table.Documents.UpdatedAt), nil
+	}
+
+	if !strings.HasPrefix(sortBy, contentSortPrefix) {
+		return pagination.SortKey{}, fmt.Errorf(
+			"documents can only be sorted by `created_at`, `updated_at` or a path prefixed by `%s`",
+			contentSortPrefix,
+		)
+	}
+
+	path, err := query.ParsePath(strings.TrimPrefix(sortBy, contentSortPrefix))
+	if err != nil {
+		return pagination.SortKey{}, err
+	}
+
+	// Missing fields are sorted as JSON nulls, which come before any other value
+	return pagination.SortKey{
+		Name:       sortBy,
+		Expression: postgres.COALESCE(path.Extract(table.Documents.Content), postgres.Raw("'null'::jsonb")),
+		Type:       "jsonb",
+	}, nil
+}
+
+// documentSortValue returns the value of the sort key for the given document, to store in cursors.
+func documentSortValue(document *model.Documents, sortKey pagination.SortKey) string {
+	switch sortKey.Name {
+	case "created_at":
+		return pagination.TimestampValue(document.CreatedAt)
+	case "updated_at":
+		return pagination.TimestampValue(document.UpdatedAt)
+	}
+
+	path, err := query.ParsePath(strings.TrimPrefix(sortKey.Name, contentSortPrefix))
+	if err != nil {
+		return "null"
+	}
+
+	return string(path.Lookup(json.RawMessage(document.Content)))
+}
+
+// projectedDocument is a document with a projected content, along with the value of the sort key of the
+// page since the projected content may not contain it.
+type projectedDocument struct {
+	model.Documents
+
+	SortValue *string `alias:"documents.sort_value"`
+}
+
+// ListDocuments lists a page of documents for a given collection, returning an empty slice
+// on an error. When a filter is given, only the documents with a content matching the
+// filter are returned. When a projection is given, the content of the documents is projected.
+// The cursor to the next page is returned if there are more documents to fetch.
+func ListDocuments(ctx context.Context, CollectionID int64, filter *query.Filter, page *pagination.Page, projection *query.Projection) ([]*model.Documents, string, error) {
+	condition := table.Documents.CollectionID.EQ(postgres.Int64(CollectionID)).
+		AND(table.Documents.DeletedAt.IS_NULL())
+	if filter != nil {
+		condition = condition.AND(filter.Condition(table.Documents.Content))
+	}
+
+	projections := []postgres.Projection{
 		table.Documents.ID,
 		table.Documents.Content,
 		table.Documents.CollectionID,
 		table.Documents.UpdatedAt,
 		table.Documents.CreatedAt,
-	).FROM(table.Documents).WHERE(
-		table.Documents.CollectionID.EQ(postgres.Int64(CollectionID)),
-	)
+		table.Documents.Version,
+		table.Documents.Key,
+	}
 
-	var documents []*model.Documents
-	err := statement.QueryContext(ctx, db, &documents)
+	if projection != nil {
+		projections[1] = projection.Apply(table.Documents.Content).AS("documents.content")
+		if strings.HasPrefix(page.SortKey.Name, contentSortPrefix) {
+			projections = append(projections, postgres.CAST(page.SortKey.Expression).AS_TEXT().AS("documents.sort_value"))
+		}
+	}
+
+	statement := postgres.SELECT(
+		projections[0], projections[1:]...,
+	).FROM(documentsTable(ctx)).WHERE(
+		page.Where(condition, table.Documents.ID),
+	).ORDER_BY(
+		page.OrderBy(table.Documents.ID)...,
+	).LIMIT(page.Fetch())
+
+	var rows []*projectedDocument
+	err := queryOverlay(ctx, statement, &rows)
 	if err != nil {
 		log.WithError(err).Error("Could not query documents")
-		return nil, err
+		return nil, "", err
 	}
 
-	return documents, nil
+	documents := make([]*model.Documents, len(rows))
+	for i, row := range rows {
+		documents[i] = &row.Documents
+	}
+
+	nextCursor := ""
+	if page.HasNext(len(documents)) {
+		documents = documents[:page.Limit]
+
+		last := rows[page.Limit-1]
+		sortValue := documentSortValue(&last.Documents, page.SortKey)
+		if last.SortValue != nil {
+			sortValue = *last.SortValue
+		}
+
+		nextCursor = page.Next(last.ID, sortValue)
+	}
+
+	err = recordReadDocuments(ctx, documents...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return documents, nextCursor, nil
+}
+
+// DocumentRef identifies a document, either by its ID or by its key in a collection when no ID is given.
+type DocumentRef struct {
+	ID           int64
+	CollectionID int64
+	Key          string
+}
+
+// DocumentByID returns the reference to a document by ID.
+func DocumentByID(id int64) DocumentRef {
+	return DocumentRef{ID: id}
+}
+
+// String returns a readable representation of the reference, for logs.
+func (r DocumentRef) String() string {
+	if r.ID == 0 {
+		return fmt.Sprintf("key `%s` of collection %d", r.Key, r.CollectionID)
+	}
+
+	return fmt.Sprintf("id %d", r.ID)
 }
 
-// GetDocumentByUser fetches a single document record given an ID and the associated
+// condition selects the document the reference identifies.
+func (r DocumentRef) condition() postgres.BoolExpression {
+	if r.ID == 0 {
+		return table.Documents.CollectionID.EQ(postgres.Int64(r.CollectionID)).
+			AND(table.Documents.Key.EQ(postgres.String(r.Key)))
+	}
+
+	return table.Documents.ID.EQ(postgres.Int64(r.ID))
+}
+
+// GetDocumentByUser fetches a single document record given its ID or key and the associated
 // user ID of the collection this document belongs to. Returns nil on an error.
-func GetDocumentByUser(ctx context.Context, ID, UserID int64) (*model.Documents, error) {
+func GetDocumentByUser(ctx context.Context, ref DocumentRef, UserID int64) (*model.Documents, error) {
 	statement := postgres.SELECT(
 		table.Documents.ID,
 		table.Documents.Content,
 		table.Documents.CollectionID,
 		table.Documents.UpdatedAt,
 		table.Documents.CreatedAt,
+		table.Documents.Version,
+		table.Documents.Key,
 	).FROM(
-		table.Documents.LEFT_JOIN(
-			table.Collections,
+		documentsTable(ctx).LEFT_JOIN(
+			collectionsTable(ctx),
 			table.Documents.CollectionID.EQ(table.Collections.ID),
 		).LEFT_JOIN(
 			table.Databases,
 			table.Collections.DatabaseID.EQ(table.Databases.ID),
 		),
 	).WHERE(
-		table.Documents.ID.EQ(postgres.Int64(ID)).
-			AND(table.Databases.UserID.EQ(postgres.Int64(UserID))),
+		ref.condition().
+			AND(table.Databases.UserID.EQ(postgres.Int64(UserID))).
+			AND(table.Documents.DeletedAt.IS_NULL()).
+			AND(table.Collections.DeletedAt.IS_NULL()).
+			AND(table.Databases.DeletedAt.IS_NULL()),
 	).LIMIT(1)
 
 	document := model.Documents{}
-	err := statement.QueryContext(ctx, db, &document)
+	err := queryOverlay(ctx, statement, &document)
+	if err != nil {
+		log.WithError(err).Errorf("Could not query document for %s", ref)
+		return nil, err
+	}
+
+	err = recordReadDocuments(ctx, &document)
 	if err != nil {
-		log.WithError(err).Errorf("Could not query document for id %v", ID)
 		return nil, err
 	}
 
 	return &document, nil
 }
 
+// FindDocumentByKey returns the ID of the document of a collection with the given key, or 0 when there
+// is none. Documents in the trash are ignored. In a transaction, the documents of the transaction are
+// searched.
+func FindDocumentByKey(ctx context.Context, collectionID int64, key string) (int64, error) {
+	statement := postgres.SELECT(
+		table.Documents.ID,
+	).FROM(documentsTable(ctx)).WHERE(
+		DocumentRef{CollectionID: collectionID, Key: key}.condition().
+			AND(table.Documents.DeletedAt.IS_NULL()),
+	).LIMIT(1)
+
+	var id int64
+	err := queryRowOverlay(ctx, statement).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	} else if err != nil {
+		log.WithError(err).Errorf("Could not search key `%s` in collection %d", key, collectionID)
+		return 0, err
+	}
+
+	return id, nil
+}
+
 // SaveDocument saves the data of the document it used on. This method only saves
-// the content and collection ID from the struct and updates the timestamps. SaveDocument will
-// trigger an error if the constraints are not respected.
-func SaveDocument(ctx context.Context, document *model.Documents) error {
+// the content and collection ID from the struct and updates the timestamps and version. SaveDocument will
+// trigger an error if the constraints are not respected. When updating, the document is only saved if
+// its version matches ifVersion when given, returns sql.ErrNoRows otherwise. In a transaction, the document
+// is saved in the transaction. In an SQL transaction, a failed save only rolls back its own changes, so that
+// the conflicting document can still be looked up.
+func SaveDocument(ctx context.Context, document *model.Documents, ifVersion *int64) error {
+	if transaction := TransactionFromContext(ctx); transaction != nil {
+		if document.ID == 0 {
+			return insertTransactionalDocument(ctx, transaction, document)
+		}
+
+		content := query.JSONB(json.RawMessage(document.Content))
+		return writeTransactionalDocument(ctx, transaction, document, content, false, documentVersionCondition(document.ID, ifVersion))
+	}
+
 	if document.ID == 0 {
 		query, args := table.Documents.INSERT(
 			table.Documents.Content,
 			table.Documents.CollectionID,
+			table.Documents.Key,
+			table.Documents.UpdatedBy,
 		).VALUES(
 			document.Content,
 			document.CollectionID,
+			nullableString(document.Key),
+			authorExpression(ctx),
 		).RETURNING(
 			table.Documents.ID,
 			table.Documents.UpdatedAt,
 			table.Documents.CreatedAt,
+			table.Documents.Version,
 		).Sql()
 
-		err := db.
-			QueryRowContext(ctx, query, args...).
-			Scan(&document.ID, &document.UpdatedAt, &document.CreatedAt)
+		err := runInSavepoint(ctx, func() error {
+			return conn(ctx).
+				QueryRowContext(ctx, query, args...).
+				Scan(&document.ID, &document.UpdatedAt, &document.CreatedAt, &document.Version)
+		})
 
 		if err != nil {
 			log.WithError(err).Error("Could not insert document")
@@ -105,17 +307,23 @@ func SaveDocument(ctx context.Context, document *model.Documents) error {
 
 	query, args := table.Documents.UPDATE().SET(
 		table.Documents.Content.SET(postgres.String(document.Content)),
+		table.Documents.Version.SET(table.Documents.Version.ADD(postgres.Int(1))),
+		table.Documents.UpdatedBy.SET(authorExpression(ctx)),
+		table.Documents.UpdatedAt.SET(postgres.NOW()),
 	).WHERE(
-		table.Documents.ID.EQ(postgres.Int64(document.ID)),
+		documentVersionCondition(document.ID, ifVersion),
 	).RETURNING(
 		table.Documents.ID,
 		table.Documents.UpdatedAt,
 		table.Documents.CreatedAt,
+		table.Documents.Version,
 	).Sql()
 
-	err := db.
-		QueryRowContext(ctx, query, args...).
-		Scan(&document.ID, &document.UpdatedAt, &document.CreatedAt)
+	err := runInSavepoint(ctx, func() error {
+		return conn(ctx).
+			QueryRowContext(ctx, query, args...).
+			Scan(&document.ID, &document.UpdatedAt, &document.CreatedAt, &document.Version)
+	})
 
 	if err != nil {
 		log.WithError(err).Error("Could not update document")
@@ -125,16 +333,251 @@ func SaveDocument(ctx context.Context, document *model.Documents) error {
 	return nil
 }
 
-// DeleteDocument deletes the Document is it called on.
-func DeleteDocument(ctx context.Context, document *model.Documents) error {
-	query, args := table.Documents.
-		DELETE().
-		WHERE(table.Documents.ID.EQ(postgres.Int64(document.ID))).
-		RETURNING(table.Documents.ID).
-		Sql()
+// InsertDocuments inserts new documents in a single statement, which is much faster than saving them one
+// at a time when importing many documents. Unlike SaveDocument, the structs are not updated with the
+// generated IDs and timestamps. The insert fails as a whole if a constraint is not respected. Documents
+// cannot be inserted this way in a transaction.
+func InsertDocuments(ctx context.Context, documents []*model.Documents) error {
+	if len(documents) == 0 {
+		return nil
+	}
+
+	statement := table.Documents.INSERT(
+		table.Documents.Content,
+		table.Documents.CollectionID,
+		table.Documents.Key,
+		table.Documents.UpdatedBy,
+	)
+
+	for _, document := range documents {
+		statement = statement.VALUES(
+			document.Content,
+			document.CollectionID,
+			nullableString(document.Key),
+			authorExpression(ctx),
+		)
+	}
+
+	query, args := statement.Sql()
+
+	_, err := conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		log.WithError(err).Error("Could not insert documents")
+		return err
+	}
+
+	return nil
+}
+
+// PatchDocument applies a patch to the content of the document it is called on and updates the
+// struct with the patched content. The patch is applied by the update itself, returns sql.ErrNoRows
+// if the patch could not be applied to the document or if its version does not match ifVersion. In a
+// transaction, the patch is applied to the version of the document in the transaction. In an SQL transaction,
+// a failed patch only rolls back its own changes, like SaveDocument.
+func PatchDocument(ctx context.Context, document *model.Documents, patch *query.Patch, ifVersion *int64) error {
+	patched := patch.Apply(table.Documents.Content)
+	if transaction := TransactionFromContext(ctx); transaction != nil {
+		condition := documentVersionCondition(document.ID, ifVersion).AND(patched.IS_NOT_NULL())
+		return writeTransactionalDocument(ctx, transaction, document, patched, false, condition)
+	}
+
+	query, args := table.Documents.UPDATE().SET(
+		table.Documents.Content.SET(patched),
+		table.Documents.Version.SET(table.Documents.Version.ADD(postgres.Int(1))),
+		table.Documents.UpdatedBy.SET(authorExpression(ctx)),
+		table.Documents.UpdatedAt.SET(postgres.NOW()),
+	).WHERE(
+		documentVersionCondition(document.ID, ifVersion).
+			AND(patched.IS_NOT_NULL()),
+	).RETURNING(
+		table.Documents.Content,
+		table.Documents.UpdatedAt,
+		table.Documents.CreatedAt,
+		table.Documents.Version,
+	).Sql()
+
+	err := runInSavepoint(ctx, func() error {
+		return conn(ctx).
+			QueryRowContext(ctx, query, args...).
+			Scan(&document.Content, &document.UpdatedAt, &document.CreatedAt, &document.Version)
+	})
+
+	if err != nil {
+		log.WithError(err).Error("Could not patch document")
+		return err
+	}
+
+	return nil
+}
+
+// PreviewPatch returns the content of the document it is called on once patched, without saving it.
+// Returns sql.ErrNoRows if the patch cannot be applied. Outside of a transaction, the document is locked
+// until the end of the SQL transaction so it cannot change before the patch is applied. In a transaction,
+// the patch is applied to the version of the document in the transaction.
+func PreviewPatch(ctx context.Context, document *model.Documents, patch *query.Patch) (string, error) {
+	statement := postgres.SELECT(
+		patch.Apply(table.Documents.Content),
+	).FROM(documentsTable(ctx)).WHERE(
+		table.Documents.ID.EQ(postgres.Int64(document.ID)),
+	)
+
+	if TransactionFromContext(ctx) == nil {
+		statement = statement.FOR(postgres.UPDATE())
+	}
+
+	var content sql.NullString
+	err := queryRowOverlay(ctx, statement).Scan(&content)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !content.Valid) {
+		return "", sql.ErrNoRows
+	} else if err != nil {
+		log.WithError(err).Error("Could not preview patch")
+		return "", err
+	}
+
+	return content.String, nil
+}
+
+// ProjectDocument replaces the content of the document it is called on with its projection, computed
+// on the current version of the document. In a transaction, the version of the document in the transaction
+// is projected.
+func ProjectDocument(ctx context.Context, document *model.Documents, projection *query.Projection) error {
+	statement := postgres.SELECT(
+		projection.Apply(table.Documents.Content),
+		table.Documents.UpdatedAt,
+		table.Documents.Version,
+	).FROM(documentsTable(ctx)).WHERE(
+		table.Documents.ID.EQ(postgres.Int64(document.ID)),
+	)
+
+	err := queryRowOverlay(ctx, statement).Scan(&document.Content, &document.UpdatedAt, &document.Version)
+	if err != nil {
+		log.WithError(err).Errorf("Could not project document %d", document.ID)
+		return err
+	}
+
+	return nil
+}
+
+// ApplyPatch returns the given content once patched, without reading or writing any document. Returns
+// sql.ErrNoRows if the patch cannot be applied.
+func ApplyPatch(ctx context.Context, content string, patch *query.Patch) (string, error) {
+	statement, args := postgres.SELECT(
+		patch.Apply(query.JSONB(json.RawMessage(content))),
+	).Sql()
+
+	var patched sql.NullString
+	err := conn(ctx).QueryRowContext(ctx, statement, args...).Scan(&patched)
+	if err != nil {
+		log.WithError(err).Error("Could not apply patch")
+		return "", err
+	}
+
+	if !patched.Valid {
+		return "", sql.ErrNoRows
+	}
+
+	return patched.String, nil
+}
+
+// MatchDocuments lists the documents of a collection with a content matching a filter, at most limit
+// of them sorted by ID. Outside of a transaction, the documents are locked until the end of the SQL
+// transaction. In a transaction, the documents of the transaction are matched.
+func MatchDocuments(ctx context.Context, collectionID int64, filter *query.Filter, limit int64) ([]*model.Documents, error) {
+	statement := postgres.SELECT(
+		table.Documents.ID,
+		table.Documents.Content,
+		table.Documents.CollectionID,
+		table.Documents.UpdatedAt,
+		table.Documents.CreatedAt,
+		table.Documents.Version,
+		table.Documents.Key,
+	).FROM(documentsTable(ctx)).WHERE(
+		documentsMatchCondition(collectionID, filter),
+	).ORDER_BY(
+		table.Documents.ID.ASC(),
+	).LIMIT(limit)
+
+	if TransactionFromContext(ctx) == nil {
+		statement = statement.FOR(postgres.UPDATE())
+	}
+
+	var documents []*model.Documents
+	err := queryOverlay(ctx, statement, &documents)
+	if err != nil {
+		log.WithError(err).Error("Could not match documents")
+		return nil, err
+	}
+
+	err = recordReadDocuments(ctx, documents...)
+	if err != nil {
+		return nil, err
+	}
+
+	return documents, nil
+}
+
+// LockDocumentMatch takes locks on keys of a collection until the end of the SQL transaction, so that writes
+// depending on which documents match an expression are made one at a time. Documents that do not exist yet
+// cannot be locked, two concurrent upserts would otherwise both create a document. The keys are locked in
+// order, so that writes locking some of the same keys cannot deadlock, and the whole collection is locked
+// when no key is given.
+func LockDocumentMatch(ctx context.Context, collectionID int64, keys []string) error {
+	if len(keys) == 0 {
+		keys = []string{""}
+	}
+
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+
+	for _, key := range sorted {
+		_, err := conn(ctx).ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", fmt.Sprintf("documents:%d:%s", collectionID, key))
+		if err != nil {
+			log.WithError(err).Error("Could not lock match")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ContentMatches tells whether a content matches a filter, the same way the content of a document would.
+func ContentMatches(ctx context.Context, content string, filter *query.Filter) (bool, error) {
+	statement, args := postgres.SELECT(
+		filter.Condition(table.Documents.Content),
+	).FROM(
+		postgres.SELECT(query.JSONB(json.RawMessage(content)).AS("content")).AsTable(table.Documents.TableName()),
+	).Sql()
+
+	var matches sql.NullBool
+	err := conn(ctx).QueryRowContext(ctx, statement, args...).Scan(&matches)
+	if err != nil {
+		log.WithError(err).Error("Could not match content")
+		return false, err
+	}
+
+	return matches.Valid && matches.Bool, nil
+}
+
+// DeleteDocument moves the Document is it called on to the trash. The document is only deleted if its
+// version matches ifVersion when given, returns sql.ErrNoRows otherwise. In a transaction, the document
+// is deleted in the transaction and moved to the trash once committed.
+func DeleteDocument(ctx context.Context, document *model.Documents, ifVersion *int64) error {
+	if transaction := TransactionFromContext(ctx); transaction != nil {
+		return writeTransactionalDocument(ctx, transaction, document, table.Documents.Content, true, documentVersionCondition(document.ID, ifVersion))
+	}
+
+	query, args := table.Documents.UPDATE().SET(
+		table.Documents.DeletedAt.SET(postgres.NOW()),
+	).WHERE(
+		documentVersionCondition(document.ID, ifVersion).
+			AND(table.Documents.DeletedAt.IS_NULL()),
+	).RETURNING(
+		table.Documents.ID,
+		table.Documents.DeletedAt,
+	).Sql()
 
 	deletedID := 0
-	err := db.QueryRowContext(ctx, query, args...).Scan(&deletedID)
+	err := conn(ctx).QueryRowContext(ctx, query, args...).Scan(&deletedID, &document.DeletedAt)
 	if err != nil || deletedID == 0 {
 		log.WithError(err).Error("Could not delete document")
 		return err
@@ -142,3 +585,281 @@ func DeleteDocument(ctx context.Context, document *model.Documents) error {
 
 	return nil
 }
+
+// PatchedDocument is a document matched by a bulk patch, along with its content once patched.
+type PatchedDocument struct {
+	ID int64
+
+	// The content of the document before the patch
+	Content string
+
+	// The content of the document once patched, invalid when the patch cannot be applied to the document
+	Patched sql.NullString
+}
+
+// CountMatchingDocuments counts the documents of a collection with a content matching a filter. Outside of a
+// transaction, the documents are locked until the end of the SQL transaction so they cannot change before they
+// are updated or deleted. In a transaction, the documents of the transaction are counted.
+func CountMatchingDocuments(ctx context.Context, collectionID int64, filter *query.Filter) (int64, error) {
+	matched := postgres.SELECT(
+		table.Documents.ID,
+	).FROM(documentsTable(ctx)).WHERE(
+		documentsMatchCondition(collectionID, filter),
+	)
+
+	if TransactionFromContext(ctx) == nil {
+		matched = matched.FOR(postgres.UPDATE())
+	}
+
+	statement := postgres.SELECT(
+		postgres.COUNT(postgres.STAR),
+	).FROM(matched.AsTable("matched"))
+
+	var count int64
+	err := queryRowOverlay(ctx, statement).Scan(&count)
+	if err != nil {
+		log.WithError(err).Errorf("Could not count matching documents of collection %d", collectionID)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// SampleMatchingDocumentIDs lists the first limit IDs of the documents of a collection with a content matching
+// a filter, sorted. In a transaction, the documents of the transaction are matched.
+func SampleMatchingDocumentIDs(ctx context.Context, collectionID int64, filter *query.Filter, limit int64) ([]int64, error) {
+	statement := postgres.SELECT(
+		table.Documents.ID,
+	).FROM(documentsTable(ctx)).WHERE(
+		documentsMatchCondition(collectionID, filter),
+	).ORDER_BY(
+		table.Documents.ID.ASC(),
+	).LIMIT(limit)
+
+	var ids []struct {
+		ID int64 `alias:"documents.id"`
+	}
+	err := queryOverlay(ctx, statement, &ids)
+	if err != nil {
+		log.WithError(err).Errorf("Could not sample matching documents of collection %d", collectionID)
+		return nil, err
+	}
+
+	sample := make([]int64, len(ids))
+	for i, id := range ids {
+		sample[i] = id.ID
+	}
+
+	return sample, nil
+}
+
+// FindUnpatchableDocument finds the first document of a collection with a content matching a filter that a patch
+// cannot be applied to, by ID. Returns nil when the patch can be applied to every matched document. In a
+// transaction, the documents of the transaction are matched.
+func FindUnpatchableDocument(ctx context.Context, collectionID int64, filter *query.Filter, patch *query.Patch) (*PatchedDocument, error) {
+	statement := postgres.SELECT(
+		table.Documents.ID,
+		table.Documents.Content,
+	).FROM(documentsTable(ctx)).WHERE(
+		documentsMatchCondition(collectionID, filter).
+			AND(patch.Apply(table.Documents.Content).IS_NULL()),
+	).ORDER_BY(
+		table.Documents.ID.ASC(),
+	).LIMIT(1)
+
+	document := PatchedDocument{}
+	err := queryRowOverlay(ctx, statement).Scan(&document.ID, &document.Content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		log.WithError(err).Errorf("Could not check patch on collection %d", collectionID)
+		return nil, err
+	}
+
+	return &document, nil
+}
+
+// EachPatchedDocument calls fn with each document of a collection with a content matching a filter by ID, along
+// with its content once patched, without saving them. The documents are read one at a time, and the first error
+// returned by fn is returned. In a transaction, the documents of the transaction are matched.
+func EachPatchedDocument(ctx context.Context, collectionID int64, filter *query.Filter, patch *query.Patch, fn func(document PatchedDocument) error) error {
+	statement := postgres.SELECT(
+		table.Documents.ID,
+		table.Documents.Content,
+		patch.Apply(table.Documents.Content),
+	).FROM(documentsTable(ctx)).WHERE(
+		documentsMatchCondition(collectionID, filter),
+	).ORDER_BY(
+		table.Documents.ID.ASC(),
+	)
+
+	query, args := overlayQuery(ctx, statement)
+	rows, err := conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		log.WithError(err).Errorf("Could not preview patch on collection %d", collectionID)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var document PatchedDocument
+		err = rows.Scan(&document.ID, &document.Content, &document.Patched)
+		if err != nil {
+			log.WithError(err).Error("Could not scan patched document")
+			return err
+		}
+
+		err = fn(document)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// PatchDocuments applies a patch to the content of all the documents of a collection matching a filter,
+// in a single statement, and returns the number of patched documents. Documents the patch cannot be applied
+// to are left unchanged. In a transaction, the documents are patched in the transaction, and the IDs of the
+// matched documents must be given, as returned by MatchDocumentIDs, to record their version.
+func PatchDocuments(ctx context.Context, collectionID int64, filter *query.Filter, patch *query.Patch, ids []int64) (int64, error) {
+	patched := patch.Apply(table.Documents.Content)
+	condition := documentsMatchCondition(collectionID, filter).AND(patched.IS_NOT_NULL())
+	if transaction := TransactionFromContext(ctx); transaction != nil {
+		return writeTransactionalDocuments(ctx, transaction, ids, patched, false, condition)
+	}
+
+	query, args := table.Documents.UPDATE().SET(
+		table.Documents.Content.SET(patched),
+		table.Documents.Version.SET(table.Documents.Version.ADD(postgres.Int(1))),
+		table.Documents.UpdatedBy.SET(authorExpression(ctx)),
+		table.Documents.UpdatedAt.SET(postgres.NOW()),
+	).WHERE(condition).Sql()
+
+	result, err := conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		log.WithError(err).Errorf("Could not patch documents of collection %d", collectionID)
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// MatchDocumentIDs lists the IDs of the documents of a collection with a content matching a filter, sorted.
+// Outside of a transaction, the documents are locked until the end of the SQL transaction. In a transaction,
+// the documents of the transaction are matched.
+func MatchDocumentIDs(ctx context.Context, collectionID int64, filter *query.Filter) ([]int64, error) {
+	statement := postgres.SELECT(
+		table.Documents.ID,
+	).FROM(documentsTable(ctx)).WHERE(
+		documentsMatchCondition(collectionID, filter),
+	).ORDER_BY(
+		table.Documents.ID.ASC(),
+	)
+
+	if TransactionFromContext(ctx) == nil {
+		statement = statement.FOR(postgres.UPDATE())
+	}
+
+	var ids []struct {
+		ID int64 `alias:"documents.id"`
+	}
+	err := queryOverlay(ctx, statement, &ids)
+	if err != nil {
+		log.WithError(err).Errorf("Could not match documents of collection %d", collectionID)
+		return nil, err
+	}
+
+	matched := make([]int64, len(ids))
+	for i, id := range ids {
+		matched[i] = id.ID
+	}
+
+	return matched, nil
+}
+
+// DeleteDocuments moves all the documents of a collection matching a filter to the trash, in a single
+// statement, and returns the number of deleted documents. In a transaction, the documents are deleted in the
+// transaction and moved to the trash once committed, and the IDs of the matched documents must be given, as
+// returned by MatchDocumentIDs, to record their version.
+func DeleteDocuments(ctx context.Context, collectionID int64, filter *query.Filter, ids []int64) (int64, error) {
+	condition := documentsMatchCondition(collectionID, filter)
+	if transaction := TransactionFromContext(ctx); transaction != nil {
+		return writeTransactionalDocuments(ctx, transaction, ids, table.Documents.Content, true, condition)
+	}
+
+	query, args := table.Documents.UPDATE().SET(
+		table.Documents.DeletedAt.SET(postgres.NOW()),
+	).WHERE(condition).Sql()
+
+	result, err := conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		log.WithError(err).Errorf("Could not delete documents of collection %d", collectionID)
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// AggregateDocuments groups the documents of a collection with a content matching a filter and computes
+// the accumulators of the aggregation on each group, returning at most limit groups as JSON objects in the
+// given order. Everything is computed by postgres. In a transaction, the documents of the transaction are
+// aggregated.
+func AggregateDocuments(ctx context.Context, collectionID int64, filter *query.Filter, aggregation *query.Aggregation, orderBy []postgres.OrderByClause, limit int64) ([]json.RawMessage, error) {
+	condition := table.Documents.CollectionID.EQ(postgres.Int64(collectionID)).
+		AND(table.Documents.DeletedAt.IS_NULL())
+	if filter != nil {
+		condition = condition.AND(filter.Condition(table.Documents.Content))
+	}
+
+	statement := postgres.SELECT(
+		aggregation.Result(table.Documents.Content),
+	).FROM(documentsTable(ctx)).WHERE(condition)
+
+	if groupBy := aggregation.GroupBy(table.Documents.Content); groupBy != nil {
+		statement = statement.GROUP_BY(groupBy)
+	}
+
+	statement = statement.ORDER_BY(orderBy...).LIMIT(limit)
+
+	query, args := overlayQuery(ctx, statement)
+	rows, err := conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		log.WithError(err).Errorf("Could not aggregate documents of collection %d", collectionID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []json.RawMessage{}
+	for rows.Next() {
+		var group string
+		err = rows.Scan(&group)
+		if err != nil {
+			log.WithError(err).Error("Could not scan aggregated group")
+			return nil, err
+		}
+
+		groups = append(groups, json.RawMessage(group))
+	}
+
+	return groups, rows.Err()
+}
+
+// documentsMatchCondition selects the documents of a collection with a content matching a filter, leaving out
+// the documents in the trash.
+func documentsMatchCondition(collectionID int64, filter *query.Filter) postgres.BoolExpression {
+	return table.Documents.CollectionID.EQ(postgres.Int64(collectionID)).
+		AND(table.Documents.DeletedAt.IS_NULL()).
+		AND(filter.Condition(table.Documents.Content))
+}
+
+// documentVersionCondition selects a document by ID, only if its version matches ifVersion when given.
+func documentVersionCondition(id int64, ifVersion *int64) postgres.BoolExpression {
+	condition := table.Documents.ID.EQ(postgres.Int64(id))
+	if ifVersion != nil {
+		condition = condition.AND(table.Documents.Version.EQ(postgres.Int64(*ifVersion)))
+	}
+
+	return condition
+}
@@ -17,4 +17,8 @@ type Collections struct {
 	DatabaseID int64
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
+	Schema     *string
+	Search     *string
+	History    bool
+	DeletedAt  *time.Time
 }
@@ -12,9 +12,11 @@ import (
 )
 
 type Databases struct {
-	ID        int64 `sql:"primary_key"`
-	Name      string
-	UserID    int64
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID                 int64 `sql:"primary_key"`
+	Name               string
+	UserID             int64
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	DeletedAt          *time.Time
+	TrashRetentionDays int32
 }
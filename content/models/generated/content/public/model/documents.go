@@ -17,4 +17,9 @@ type Documents struct {
 	CollectionID int64
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
+	Version      int64
+	Key          *string
+	SearchVector *string
+	UpdatedBy    *int64
+	DeletedAt    *time.Time
 }
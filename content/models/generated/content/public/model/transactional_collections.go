@@ -13,10 +13,14 @@ import (
 )
 
 type TransactionalCollections struct {
-	ID            uuid.UUID `sql:"primary_key"`
+	TransactionID uuid.UUID `sql:"primary_key"`
+	ID            int64     `sql:"primary_key"`
 	Name          string
-	DatabaseID    uuid.UUID
-	TransactionID uuid.UUID
+	DatabaseID    int64
+	Deleted       bool
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
+	Schema        *string
+	Search        *string
+	History       bool
 }
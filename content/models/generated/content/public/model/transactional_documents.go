@@ -13,10 +13,14 @@ import (
 )
 
 type TransactionalDocuments struct {
-	ID            uuid.UUID `sql:"primary_key"`
+	TransactionID uuid.UUID `sql:"primary_key"`
+	ID            int64     `sql:"primary_key"`
 	Content       string
-	CollectionID  uuid.UUID
-	TransactionID uuid.UUID
+	CollectionID  int64
+	Version       int64
+	Deleted       bool
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
+	Key           *string
+	UpdatedBy     *int64
 }
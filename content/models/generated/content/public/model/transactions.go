@@ -14,8 +14,7 @@ import (
 
 type Transactions struct {
 	ID         uuid.UUID `sql:"primary_key"`
-	Script     string
-	DatabaseID uuid.UUID
+	DatabaseID int64
 	ExpiresAt  time.Time
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
@@ -22,6 +22,10 @@ type collectionsTable struct {
 	DatabaseID postgres.ColumnInteger
 	CreatedAt  postgres.ColumnTimestampz
 	UpdatedAt  postgres.ColumnTimestampz
+	Schema     postgres.ColumnString
+	Search     postgres.ColumnString
+	History    postgres.ColumnBool
+	DeletedAt  postgres.ColumnTimestampz
 
 	AllColumns     postgres.ColumnList
 	MutableColumns postgres.ColumnList
@@ -57,8 +61,12 @@ func newCollectionsTableImpl(schemaName, tableName, alias string) collectionsTab
 		DatabaseIDColumn = postgres.IntegerColumn("database_id")
 		CreatedAtColumn  = postgres.TimestampzColumn("created_at")
 		UpdatedAtColumn  = postgres.TimestampzColumn("updated_at")
-		allColumns       = postgres.ColumnList{IDColumn, NameColumn, DatabaseIDColumn, CreatedAtColumn, UpdatedAtColumn}
-		mutableColumns   = postgres.ColumnList{NameColumn, DatabaseIDColumn, CreatedAtColumn, UpdatedAtColumn}
+		SchemaColumn     = postgres.StringColumn("schema")
+		SearchColumn     = postgres.StringColumn("search")
+		HistoryColumn    = postgres.BoolColumn("history")
+		DeletedAtColumn  = postgres.TimestampzColumn("deleted_at")
+		allColumns       = postgres.ColumnList{IDColumn, NameColumn, DatabaseIDColumn, CreatedAtColumn, UpdatedAtColumn, SchemaColumn, SearchColumn, HistoryColumn, DeletedAtColumn}
+		mutableColumns   = postgres.ColumnList{NameColumn, DatabaseIDColumn, CreatedAtColumn, UpdatedAtColumn, SchemaColumn, SearchColumn, HistoryColumn, DeletedAtColumn}
 	)
 
 	return collectionsTable{
@@ -70,6 +78,10 @@ func newCollectionsTableImpl(schemaName, tableName, alias string) collectionsTab
 		DatabaseID: DatabaseIDColumn,
 		CreatedAt:  CreatedAtColumn,
 		UpdatedAt:  UpdatedAtColumn,
+		Schema:     SchemaColumn,
+		Search:     SearchColumn,
+		History:    HistoryColumn,
+		DeletedAt:  DeletedAtColumn,
 
 		AllColumns:     allColumns,
 		MutableColumns: mutableColumns,
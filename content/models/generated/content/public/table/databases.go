@@ -17,11 +17,13 @@ type databasesTable struct {
 	postgres.Table
 
 	//Columns
-	ID        postgres.ColumnInteger
-	Name      postgres.ColumnString
-	UserID    postgres.ColumnInteger
-	CreatedAt postgres.ColumnTimestampz
-	UpdatedAt postgres.ColumnTimestampz
+	ID                 postgres.ColumnInteger
+	Name               postgres.ColumnString
+	UserID             postgres.ColumnInteger
+	CreatedAt          postgres.ColumnTimestampz
+	UpdatedAt          postgres.ColumnTimestampz
+	DeletedAt          postgres.ColumnTimestampz
+	TrashRetentionDays postgres.ColumnInteger
 
 	AllColumns     postgres.ColumnList
 	MutableColumns postgres.ColumnList
@@ -52,24 +54,28 @@ func newDatabasesTable(schemaName, tableName, alias string) *DatabasesTable {
 
 func newDatabasesTableImpl(schemaName, tableName, alias string) databasesTable {
 	var (
-		IDColumn        = postgres.IntegerColumn("id")
-		NameColumn      = postgres.StringColumn("name")
-		UserIDColumn    = postgres.IntegerColumn("user_id")
-		CreatedAtColumn = postgres.TimestampzColumn("created_at")
-		UpdatedAtColumn = postgres.TimestampzColumn("updated_at")
-		allColumns      = postgres.ColumnList{IDColumn, NameColumn, UserIDColumn, CreatedAtColumn, UpdatedAtColumn}
-		mutableColumns  = postgres.ColumnList{NameColumn, UserIDColumn, CreatedAtColumn, UpdatedAtColumn}
+		IDColumn                 = postgres.IntegerColumn("id")
+		NameColumn               = postgres.StringColumn("name")
+		UserIDColumn             = postgres.IntegerColumn("user_id")
+		CreatedAtColumn          = postgres.TimestampzColumn("created_at")
+		UpdatedAtColumn          = postgres.TimestampzColumn("updated_at")
+		DeletedAtColumn          = postgres.TimestampzColumn("deleted_at")
+		TrashRetentionDaysColumn = postgres.IntegerColumn("trash_retention_days")
+		allColumns               = postgres.ColumnList{IDColumn, NameColumn, UserIDColumn, CreatedAtColumn, UpdatedAtColumn, DeletedAtColumn, TrashRetentionDaysColumn}
+		mutableColumns           = postgres.ColumnList{NameColumn, UserIDColumn, CreatedAtColumn, UpdatedAtColumn, DeletedAtColumn, TrashRetentionDaysColumn}
 	)
 
 	return databasesTable{
 		Table: postgres.NewTable(schemaName, tableName, alias, allColumns...),
 
 		//Columns
-		ID:        IDColumn,
-		Name:      NameColumn,
-		UserID:    UserIDColumn,
-		CreatedAt: CreatedAtColumn,
-		UpdatedAt: UpdatedAtColumn,
+		ID:                 IDColumn,
+		Name:               NameColumn,
+		UserID:             UserIDColumn,
+		CreatedAt:          CreatedAtColumn,
+		UpdatedAt:          UpdatedAtColumn,
+		DeletedAt:          DeletedAtColumn,
+		TrashRetentionDays: TrashRetentionDaysColumn,
 
 		AllColumns:     allColumns,
 		MutableColumns: mutableColumns,
@@ -22,6 +22,11 @@ type documentsTable struct {
 	CollectionID postgres.ColumnInteger
 	CreatedAt    postgres.ColumnTimestampz
 	UpdatedAt    postgres.ColumnTimestampz
+	Version      postgres.ColumnInteger
+	Key          postgres.ColumnString
+	SearchVector postgres.ColumnString
+	UpdatedBy    postgres.ColumnInteger
+	DeletedAt    postgres.ColumnTimestampz
 
 	AllColumns     postgres.ColumnList
 	MutableColumns postgres.ColumnList
@@ -57,8 +62,13 @@ func newDocumentsTableImpl(schemaName, tableName, alias string) documentsTable {
 		CollectionIDColumn = postgres.IntegerColumn("collection_id")
 		CreatedAtColumn    = postgres.TimestampzColumn("created_at")
 		UpdatedAtColumn    = postgres.TimestampzColumn("updated_at")
-		allColumns         = postgres.ColumnList{IDColumn, ContentColumn, CollectionIDColumn, CreatedAtColumn, UpdatedAtColumn}
-		mutableColumns     = postgres.ColumnList{ContentColumn, CollectionIDColumn, CreatedAtColumn, UpdatedAtColumn}
+		VersionColumn      = postgres.IntegerColumn("version")
+		KeyColumn          = postgres.StringColumn("key")
+		SearchVectorColumn = postgres.StringColumn("search_vector")
+		UpdatedByColumn    = postgres.IntegerColumn("updated_by")
+		DeletedAtColumn    = postgres.TimestampzColumn("deleted_at")
+		allColumns         = postgres.ColumnList{IDColumn, ContentColumn, CollectionIDColumn, CreatedAtColumn, UpdatedAtColumn, VersionColumn, KeyColumn, SearchVectorColumn, UpdatedByColumn, DeletedAtColumn}
+		mutableColumns     = postgres.ColumnList{ContentColumn, CollectionIDColumn, CreatedAtColumn, UpdatedAtColumn, VersionColumn, KeyColumn, SearchVectorColumn, UpdatedByColumn, DeletedAtColumn}
 	)
 
 	return documentsTable{
@@ -70,6 +80,11 @@ func newDocumentsTableImpl(schemaName, tableName, alias string) documentsTable {
 		CollectionID: CollectionIDColumn,
 		CreatedAt:    CreatedAtColumn,
 		UpdatedAt:    UpdatedAtColumn,
+		Version:      VersionColumn,
+		Key:          KeyColumn,
+		SearchVector: SearchVectorColumn,
+		UpdatedBy:    UpdatedByColumn,
+		DeletedAt:    DeletedAtColumn,
 
 		AllColumns:     allColumns,
 		MutableColumns: mutableColumns,
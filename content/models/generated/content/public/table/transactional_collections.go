@@ -17,12 +17,16 @@ type transactionalCollectionsTable struct {
 	postgres.Table
 
 	//Columns
-	ID            postgres.ColumnString
-	Name          postgres.ColumnString
-	DatabaseID    postgres.ColumnString
 	TransactionID postgres.ColumnString
+	ID            postgres.ColumnInteger
+	Name          postgres.ColumnString
+	DatabaseID    postgres.ColumnInteger
+	Deleted       postgres.ColumnBool
 	CreatedAt     postgres.ColumnTimestampz
 	UpdatedAt     postgres.ColumnTimestampz
+	Schema        postgres.ColumnString
+	Search        postgres.ColumnString
+	History       postgres.ColumnBool
 
 	AllColumns     postgres.ColumnList
 	MutableColumns postgres.ColumnList
@@ -53,26 +57,34 @@ func newTransactionalCollectionsTable(schemaName, tableName, alias string) *Tran
 
 func newTransactionalCollectionsTableImpl(schemaName, tableName, alias string) transactionalCollectionsTable {
 	var (
-		IDColumn            = postgres.StringColumn("id")
-		NameColumn          = postgres.StringColumn("name")
-		DatabaseIDColumn    = postgres.StringColumn("database_id")
 		TransactionIDColumn = postgres.StringColumn("transaction_id")
+		IDColumn            = postgres.IntegerColumn("id")
+		NameColumn          = postgres.StringColumn("name")
+		DatabaseIDColumn    = postgres.IntegerColumn("database_id")
+		DeletedColumn       = postgres.BoolColumn("deleted")
 		CreatedAtColumn     = postgres.TimestampzColumn("created_at")
 		UpdatedAtColumn     = postgres.TimestampzColumn("updated_at")
-		allColumns          = postgres.ColumnList{IDColumn, NameColumn, DatabaseIDColumn, TransactionIDColumn, CreatedAtColumn, UpdatedAtColumn}
-		mutableColumns      = postgres.ColumnList{NameColumn, DatabaseIDColumn, TransactionIDColumn, CreatedAtColumn, UpdatedAtColumn}
+		SchemaColumn        = postgres.StringColumn("schema")
+		SearchColumn        = postgres.StringColumn("search")
+		HistoryColumn       = postgres.BoolColumn("history")
+		allColumns          = postgres.ColumnList{TransactionIDColumn, IDColumn, NameColumn, DatabaseIDColumn, DeletedColumn, CreatedAtColumn, UpdatedAtColumn, SchemaColumn, SearchColumn, HistoryColumn}
+		mutableColumns      = postgres.ColumnList{NameColumn, DatabaseIDColumn, DeletedColumn, CreatedAtColumn, UpdatedAtColumn, SchemaColumn, SearchColumn, HistoryColumn}
 	)
 
 	return transactionalCollectionsTable{
 		Table: postgres.NewTable(schemaName, tableName, alias, allColumns...),
 
 		//Columns
+		TransactionID: TransactionIDColumn,
 		ID:            IDColumn,
 		Name:          NameColumn,
 		DatabaseID:    DatabaseIDColumn,
-		TransactionID: TransactionIDColumn,
+		Deleted:       DeletedColumn,
 		CreatedAt:     CreatedAtColumn,
 		UpdatedAt:     UpdatedAtColumn,
+		Schema:        SchemaColumn,
+		Search:        SearchColumn,
+		History:       HistoryColumn,
 
 		AllColumns:     allColumns,
 		MutableColumns: mutableColumns,
@@ -17,12 +17,16 @@ type transactionalDocumentsTable struct {
 	postgres.Table
 
 	//Columns
-	ID            postgres.ColumnString
-	Content       postgres.ColumnString
-	CollectionID  postgres.ColumnString
 	TransactionID postgres.ColumnString
+	ID            postgres.ColumnInteger
+	Content       postgres.ColumnString
+	CollectionID  postgres.ColumnInteger
+	Version       postgres.ColumnInteger
+	Deleted       postgres.ColumnBool
 	CreatedAt     postgres.ColumnTimestampz
 	UpdatedAt     postgres.ColumnTimestampz
+	Key           postgres.ColumnString
+	UpdatedBy     postgres.ColumnInteger
 
 	AllColumns     postgres.ColumnList
 	MutableColumns postgres.ColumnList
@@ -53,26 +57,34 @@ func newTransactionalDocumentsTable(schemaName, tableName, alias string) *Transa
 
 func newTransactionalDocumentsTableImpl(schemaName, tableName, alias string) transactionalDocumentsTable {
 	var (
-		IDColumn            = postgres.StringColumn("id")
-		ContentColumn       = postgres.StringColumn("content")
-		CollectionIDColumn  = postgres.StringColumn("collection_id")
 		TransactionIDColumn = postgres.StringColumn("transaction_id")
+		IDColumn            = postgres.IntegerColumn("id")
+		ContentColumn       = postgres.StringColumn("content")
+		CollectionIDColumn  = postgres.IntegerColumn("collection_id")
+		VersionColumn       = postgres.IntegerColumn("version")
+		DeletedColumn       = postgres.BoolColumn("deleted")
 		CreatedAtColumn     = postgres.TimestampzColumn("created_at")
 		UpdatedAtColumn     = postgres.TimestampzColumn("updated_at")
-		allColumns          = postgres.ColumnList{IDColumn, ContentColumn, CollectionIDColumn, TransactionIDColumn, CreatedAtColumn, UpdatedAtColumn}
-		mutableColumns      = postgres.ColumnList{ContentColumn, CollectionIDColumn, TransactionIDColumn, CreatedAtColumn, UpdatedAtColumn}
+		KeyColumn           = postgres.StringColumn("key")
+		UpdatedByColumn     = postgres.IntegerColumn("updated_by")
+		allColumns          = postgres.ColumnList{TransactionIDColumn, IDColumn, ContentColumn, CollectionIDColumn, VersionColumn, DeletedColumn, CreatedAtColumn, UpdatedAtColumn, KeyColumn, UpdatedByColumn}
+		mutableColumns      = postgres.ColumnList{ContentColumn, CollectionIDColumn, VersionColumn, DeletedColumn, CreatedAtColumn, UpdatedAtColumn, KeyColumn, UpdatedByColumn}
 	)
 
 	return transactionalDocumentsTable{
 		Table: postgres.NewTable(schemaName, tableName, alias, allColumns...),
 
 		//Columns
+		TransactionID: TransactionIDColumn,
 		ID:            IDColumn,
 		Content:       ContentColumn,
 		CollectionID:  CollectionIDColumn,
-		TransactionID: TransactionIDColumn,
+		Version:       VersionColumn,
+		Deleted:       DeletedColumn,
 		CreatedAt:     CreatedAtColumn,
 		UpdatedAt:     UpdatedAtColumn,
+		Key:           KeyColumn,
+		UpdatedBy:     UpdatedByColumn,
 
 		AllColumns:     allColumns,
 		MutableColumns: mutableColumns,
@@ -18,8 +18,7 @@ type transactionsTable struct {
 
 	//Columns
 	ID         postgres.ColumnString
-	Script     postgres.ColumnString
-	DatabaseID postgres.ColumnString
+	DatabaseID postgres.ColumnInteger
 	ExpiresAt  postgres.ColumnTimestampz
 	CreatedAt  postgres.ColumnTimestampz
 	UpdatedAt  postgres.ColumnTimestampz
@@ -54,13 +53,12 @@ func newTransactionsTable(schemaName, tableName, alias string) *TransactionsTabl
 func newTransactionsTableImpl(schemaName, tableName, alias string) transactionsTable {
 	var (
 		IDColumn         = postgres.StringColumn("id")
-		ScriptColumn     = postgres.StringColumn("script")
-		DatabaseIDColumn = postgres.StringColumn("database_id")
+		DatabaseIDColumn = postgres.IntegerColumn("database_id")
 		ExpiresAtColumn  = postgres.TimestampzColumn("expires_at")
 		CreatedAtColumn  = postgres.TimestampzColumn("created_at")
 		UpdatedAtColumn  = postgres.TimestampzColumn("updated_at")
-		allColumns       = postgres.ColumnList{IDColumn, ScriptColumn, DatabaseIDColumn, ExpiresAtColumn, CreatedAtColumn, UpdatedAtColumn}
-		mutableColumns   = postgres.ColumnList{ScriptColumn, DatabaseIDColumn, ExpiresAtColumn, CreatedAtColumn, UpdatedAtColumn}
+		allColumns       = postgres.ColumnList{IDColumn, DatabaseIDColumn, ExpiresAtColumn, CreatedAtColumn, UpdatedAtColumn}
+		mutableColumns   = postgres.ColumnList{DatabaseIDColumn, ExpiresAtColumn, CreatedAtColumn, UpdatedAtColumn}
 	)
 
 	return transactionsTable{
@@ -68,7 +66,6 @@ func newTransactionsTableImpl(schemaName, tableName, alias string) transactionsT
 
 		//Columns
 		ID:         IDColumn,
-		Script:     ScriptColumn,
 		DatabaseID: DatabaseIDColumn,
 		ExpiresAt:  ExpiresAtColumn,
 		CreatedAt:  CreatedAtColumn,
@@ -0,0 +1,392 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-jet/jet/v2/postgres"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/models/generated/content/public/table"
+	"encore.app/content/query"
+)
+
+// The build statuses of an index.
+const (
+	IndexBuilding = "building"
+	IndexReady    = "ready"
+	IndexFailed   = "failed"
+)
+
+// The methods of an index. B-tree indexes serve equality and range comparisons on the values at their
+// paths, GIN indexes serve containment and key existence lookups on the objects and arrays at their path.
+const (
+	IndexBTree = "btree"
+	IndexGIN   = "gin"
+)
+
+// programLimitExceededCode is the SQLSTATE of postgres for a value exceeding one of its limits, like an entry
+// too large to be indexed.
+const programLimitExceededCode = "54000"
+
+// IndexBuildHeartbeat is how often an index is touched while it is building, so that builds that stopped
+// along with their instance can be told apart from the ones still running.
+const IndexBuildHeartbeat = time.Minute
+
+// NewIndex generates a new index structure on the paths of the content of the documents of a collection.
+// The index starts building once saved.
+func NewIndex(collectionID int64, name string, paths []query.Path, unique bool, method string) *model.CollectionIndexes {
+	encoded := make([]string, len(paths))
+	for i, path := range paths {
+		encoded[i] = path.String()
+	}
+
+	raw, _ := json.Marshal(encoded)
+
+	return &model.CollectionIndexes{
+		CollectionID: collectionID,
+		Name:         name,
+		Paths:        string(raw),
+		IsUnique:     unique,
+		Method:       method,
+		Status:       IndexBuilding,
+	}
+}
+
+// IsIndexEntryTooLarge returns whether an error returned by a query is postgres rejecting a value exceeding one
+// of its limits, which is how a value too large to be indexed is rejected, whatever the postgres driver.
+func IsIndexEntryTooLarge(err error) bool {
+	var stateErr interface{ SQLState() string }
+	return errors.As(err, &stateErr) && stateErr.SQLState() == programLimitExceededCode
+}
+
+// IndexPaths returns the paths of the content an index is declared on.
+func IndexPaths(index *model.CollectionIndexes) ([]query.Path, error) {
+	var encoded []string
+	err := json.Unmarshal([]byte(index.Paths), &encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]query.Path, len(encoded))
+	for i, path := range encoded {
+		paths[i], err = query.ParsePath(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return paths, nil
+}
+
+// ListIndexes lists all the indexes of a collection, sorted by name.
+func ListIndexes(ctx context.Context, collectionID int64) ([]*model.CollectionIndexes, error) {
+	statement := postgres.SELECT(
+		table.CollectionIndexes.AllColumns,
+	).FROM(table.CollectionIndexes).WHERE(
+		table.CollectionIndexes.CollectionID.EQ(postgres.Int64(collectionID)),
+	).ORDER_BY(
+		table.CollectionIndexes.Name.ASC(),
+	)
+
+	var indexes []*model.CollectionIndexes
+	err := statement.QueryContext(ctx, conn(ctx), &indexes)
+	if err != nil {
+		log.WithError(err).Error("Could not query indexes")
+		return nil, err
+	}
+
+	return indexes, nil
+}
+
+// GetIndexByName fetches a single index of a collection given its name. Returns nil on an error.
+func GetIndexByName(ctx context.Context, collectionID int64, name string) (*model.CollectionIndexes, error) {
+	statement := postgres.SELECT(
+		table.CollectionIndexes.AllColumns,
+	).FROM(table.CollectionIndexes).WHERE(
+		table.CollectionIndexes.CollectionID.EQ(postgres.Int64(collectionID)).
+			AND(table.CollectionIndexes.Name.EQ(postgres.String(name))),
+	).LIMIT(1)
+
+	index := model.CollectionIndexes{}
+	err := statement.QueryContext(ctx, conn(ctx), &index)
+	if err != nil {
+		log.WithError(err).Errorf("Could not query index `%s` of collection %d", name, collectionID)
+		return nil, err
+	}
+
+	return &index, nil
+}
+
+// SaveIndex inserts the index it is called on, in the building status. SaveIndex will trigger an error
+// if an index with the same name already exists for the collection.
+func SaveIndex(ctx context.Context, index *model.CollectionIndexes) error {
+	query, args := table.CollectionIndexes.INSERT(
+		table.CollectionIndexes.CollectionID,
+		table.CollectionIndexes.Name,
+		table.CollectionIndexes.Paths,
+		table.CollectionIndexes.IsUnique,
+		table.CollectionIndexes.Method,
+		table.CollectionIndexes.Status,
+	).VALUES(
+		index.CollectionID,
+		index.Name,
+		postgres.CAST(postgres.String(index.Paths)).AS("jsonb"),
+		index.IsUnique,
+		index.Method,
+		IndexBuilding,
+	).RETURNING(
+		table.CollectionIndexes.ID,
+		table.CollectionIndexes.UpdatedAt,
+		table.CollectionIndexes.CreatedAt,
+	).Sql()
+
+	err := conn(ctx).
+		QueryRowContext(ctx, query, args...).
+		Scan(&index.ID, &index.UpdatedAt, &index.CreatedAt)
+
+	if err != nil {
+		log.WithError(err).Error("Could not insert index")
+		return err
+	}
+
+	index.Status = IndexBuilding
+	return nil
+}
+
+// CountDocuments counts the committed documents of a collection.
+func CountDocuments(ctx context.Context, collectionID int64) (int64, error) {
+	query, args := postgres.SELECT(
+		postgres.COUNT(postgres.STAR),
+	).FROM(table.Documents).WHERE(
+		table.Documents.CollectionID.EQ(postgres.Int64(collectionID)),
+	).Sql()
+
+	var count int64
+	err := conn(ctx).QueryRowContext(ctx, query, args...).Scan(&count)
+	if err != nil {
+		log.WithError(err).Errorf("Could not count documents of collection %d", collectionID)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// BuildIndex builds the postgres index backing the index it is called on, then marks the index as ready,
+// or as failed with the reason when it could not be built. The postgres index is built concurrently so
+// writes to the documents are not blocked while building, which cannot be done in an SQL transaction.
+func BuildIndex(ctx context.Context, index *model.CollectionIndexes) error {
+	statement, err := createIndexStatement(index)
+	if err != nil {
+		log.WithError(err).Errorf("Could not read the paths of index %d", index.ID)
+		return err
+	}
+
+	index.Status = IndexReady
+	index.Error = nil
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	go heartbeatIndexBuild(heartbeatCtx, index.ID)
+
+	_, err = db.ExecContext(ctx, statement)
+	stopHeartbeat()
+	if err != nil {
+		log.WithError(err).Warningf("Could not build index %d", index.ID)
+
+		reason := err.Error()
+		index.Status = IndexFailed
+		index.Error = &reason
+
+		// A failed concurrent build leaves an invalid index behind
+		err = dropIndex(ctx, index.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query, args := table.CollectionIndexes.UPDATE().SET(
+		table.CollectionIndexes.Status.SET(postgres.String(index.Status)),
+		table.CollectionIndexes.Error.SET(nullableString(index.Error)),
+		table.CollectionIndexes.UpdatedAt.SET(postgres.TimestampzExp(postgres.NOW())),
+	).WHERE(
+		table.CollectionIndexes.ID.EQ(postgres.Int64(index.ID)),
+	).RETURNING(
+		table.CollectionIndexes.UpdatedAt,
+	).Sql()
+
+	err = db.QueryRowContext(ctx, query, args...).Scan(&index.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The index or its collection was deleted while building, the built index is not needed anymore
+		return dropIndex(ctx, index.ID)
+	}
+	if err != nil {
+		log.WithError(err).Errorf("Could not update the status of index %d", index.ID)
+		return err
+	}
+
+	return nil
+}
+
+// RebuildIndex builds an index again after its build stopped. The postgres index left by the stopped build is
+// dropped first, a concurrent build that did not finish leaves an invalid index behind.
+func RebuildIndex(ctx context.Context, index *model.CollectionIndexes) error {
+	err := dropIndex(ctx, index.ID)
+	if err != nil {
+		return err
+	}
+
+	return BuildIndex(ctx, index)
+}
+
+// ClaimStaleIndexBuilds claims at most limit indexes still building that were not touched since the lease, by
+// touching them. Indexes claimed by another caller are skipped, so that a build is resumed once at a time.
+func ClaimStaleIndexBuilds(ctx context.Context, now time.Time, lease time.Duration, limit int64) ([]*model.CollectionIndexes, error) {
+	stale := postgres.SELECT(
+		table.CollectionIndexes.ID,
+	).FROM(table.CollectionIndexes).WHERE(
+		table.CollectionIndexes.Status.EQ(postgres.String(IndexBuilding)).
+			AND(table.CollectionIndexes.UpdatedAt.LT(postgres.TimestampzT(now.Add(-lease)))),
+	).ORDER_BY(
+		table.CollectionIndexes.UpdatedAt.ASC(),
+	).LIMIT(limit).FOR(
+		postgres.UPDATE().SKIP_LOCKED(),
+	)
+
+	statement := table.CollectionIndexes.UPDATE().SET(
+		table.CollectionIndexes.UpdatedAt.SET(postgres.TimestampzT(now)),
+	).WHERE(
+		table.CollectionIndexes.ID.IN(stale),
+	).RETURNING(
+		table.CollectionIndexes.AllColumns,
+	)
+
+	var indexes []*model.CollectionIndexes
+	err := statement.QueryContext(ctx, conn(ctx), &indexes)
+	if err != nil {
+		log.WithError(err).Error("Could not claim the stale index builds")
+		return nil, err
+	}
+
+	return indexes, nil
+}
+
+// heartbeatIndexBuild touches an index after each heartbeat while it is building, until the context is
+// canceled.
+func heartbeatIndexBuild(ctx context.Context, id int64) {
+	ticker := time.NewTicker(IndexBuildHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		query, args := table.CollectionIndexes.UPDATE().SET(
+			table.CollectionIndexes.UpdatedAt.SET(postgres.TimestampzExp(postgres.NOW())),
+		).WHERE(
+			table.CollectionIndexes.ID.EQ(postgres.Int64(id)).
+				AND(table.CollectionIndexes.Status.EQ(postgres.String(IndexBuilding))),
+		).Sql()
+
+		_, err := db.ExecContext(ctx, query, args...)
+		if err != nil && ctx.Err() == nil {
+			log.WithError(err).Warningf("Could not touch index %d while building", id)
+		}
+	}
+}
+
+// DeleteIndex drops the postgres index backing the index it is called on, then deletes the index.
+func DeleteIndex(ctx context.Context, index *model.CollectionIndexes) error {
+	err := dropIndex(ctx, index.ID)
+	if err != nil {
+		return err
+	}
+
+	query, args := table.CollectionIndexes.
+		DELETE().
+		WHERE(table.CollectionIndexes.ID.EQ(postgres.Int64(index.ID))).
+		RETURNING(table.CollectionIndexes.ID).
+		Sql()
+
+	deletedID := 0
+	err = db.QueryRowContext(ctx, query, args...).Scan(&deletedID)
+	if err != nil || deletedID == 0 {
+		log.WithError(err).Error("Could not delete index")
+		return err
+	}
+
+	return nil
+}
+
+// postgresIndexName returns the name of the postgres index backing an index.
+func postgresIndexName(id int64) string {
+	return fmt.Sprintf("documents_index_%d", id)
+}
+
+// createIndexStatement returns the statement creating the postgres index backing an index. The index is
+// partial, it only covers the documents of the collection of the index that are not in the trash, so that
+// documents in the trash do not hold on to their unique values. The expressions are the same as
+// the ones of filters so that filters on the paths of the index can use it.
+func createIndexStatement(index *model.CollectionIndexes) (string, error) {
+	paths, err := IndexPaths(index)
+	if err != nil {
+		return "", err
+	}
+
+	unique := ""
+	if index.IsUnique {
+		unique = "UNIQUE "
+	}
+
+	method := "btree"
+	if index.Method == IndexGIN {
+		method = "gin"
+	}
+
+	return fmt.Sprintf(
+		"CREATE %sINDEX CONCURRENTLY IF NOT EXISTS %s ON documents USING %s (%s) WHERE collection_id = %d AND deleted_at IS NULL",
+		unique,
+		postgresIndexName(index.ID),
+		method,
+		strings.Join(indexExpressions(paths), ", "),
+		index.CollectionID,
+	), nil
+}
+
+// indexExpressions returns the expressions indexed by an index on the given paths.
+func indexExpressions(paths []query.Path) []string {
+	expressions := make([]string, len(paths))
+	for i, path := range paths {
+		expressions[i] = fmt.Sprintf("(content #> %s)", path.Literal())
+	}
+
+	return expressions
+}
+
+// dropIndex drops the postgres index backing an index, if it exists.
+func dropIndex(ctx context.Context, id int64) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf("DROP INDEX CONCURRENTLY IF EXISTS %s", postgresIndexName(id)))
+	if err != nil {
+		log.WithError(err).Errorf("Could not drop index %d", id)
+		return err
+	}
+
+	return nil
+}
+
+// nullableString returns the expression of an optional string, NULL when there is none.
+func nullableString(value *string) postgres.StringExpression {
+	if value == nil {
+		return postgres.StringExp(postgres.NULL)
+	}
+
+	return postgres.String(*value)
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/go-jet/jet/v2/postgres"
+	"github.com/go-jet/jet/v2/qrm"
+
+	"encore.app/content/models/generated/content/public/table"
+)
+
+// overlaySQL shadows the collections and documents tables with the committed rows merged with the
+// rows changed in a transaction. Rows changed in the transaction replace the committed rows with the
+// same ID. Rows deleted in the transaction are kept as moved to the trash, as they are once committed.
+const overlaySQL = `WITH collections AS (
+	SELECT c.id, c.name, c.database_id, c.created_at, c.updated_at, c.schema, c.search, c.history, c.deleted_at
+	FROM public.collections AS c
+	WHERE NOT EXISTS (
+		SELECT 1 FROM public.transactional_collections AS t WHERE t.transaction_id = '%[1]s' AND t.id = c.id
+	)
+	UNION ALL
+	SELECT t.id, t.name, t.database_id, t.created_at, t.updated_at, t.schema, t.search, t.history,
+		CASE WHEN t.deleted THEN t.updated_at END AS deleted_at
+	FROM public.transactional_collections AS t
+	WHERE t.transaction_id = '%[1]s'
+), documents AS (
+	SELECT d.id, d.content, d.collection_id, d.created_at, d.updated_at, d.version, d.key, d.updated_by, d.deleted_at
+	FROM public.documents AS d
+	WHERE NOT EXISTS (
+		SELECT 1 FROM public.transactional_documents AS t WHERE t.transaction_id = '%[1]s' AND t.id = d.id
+	)
+	UNION ALL
+	SELECT t.id, t.content, t.collection_id, t.created_at, t.updated_at, t.version, t.key, t.updated_by,
+		CASE WHEN t.deleted THEN t.updated_at END AS deleted_at
+	FROM public.transactional_documents AS t
+	WHERE t.transaction_id = '%[1]s'
+)
+`
+
+// documentsTable returns the documents table to read from. In a transaction, the table is not
+// qualified by its schema so it refers to the overlay added by overlayQuery.
+func documentsTable(ctx context.Context) *table.DocumentsTable {
+	if TransactionFromContext(ctx) != nil {
+		return table.Documents.FromSchema("")
+	}
+
+	return table.Documents
+}
+
+// collectionsTable returns the collections table to read from. In a transaction, the table is not
+// qualified by its schema so it refers to the overlay added by overlayQuery.
+func collectionsTable(ctx context.Context) *table.CollectionsTable {
+	if TransactionFromContext(ctx) != nil {
+		return table.Collections.FromSchema("")
+	}
+
+	return table.Collections
+}
+
+// overlayQuery generates the SQL of a statement reading from documentsTable or collectionsTable,
+// adding the overlay of the transaction in the context if any. The transaction ID is a parsed UUID,
+// it is safe to inline in the query.
+func overlayQuery(ctx context.Context, statement postgres.Statement) (string, []interface{}) {
+	query, args := statement.Sql()
+
+	transaction := TransactionFromContext(ctx)
+	if transaction == nil {
+		return query, args
+	}
+
+	return fmt.Sprintf(overlaySQL, transaction.ID.String()) + query, args
+}
+
+// queryOverlay runs a statement reading from documentsTable or collectionsTable and maps its
+// result into the destination, the same way QueryContext does.
+func queryOverlay(ctx context.Context, statement postgres.Statement, destination interface{}) error {
+	query, args := overlayQuery(ctx, statement)
+	return qrm.Query(ctx, conn(ctx), query, args, destination)
+}
+
+// queryRowOverlay runs a statement reading from documentsTable or collectionsTable and returns
+// its first row.
+func queryRowOverlay(ctx context.Context, statement postgres.Statement) *sql.Row {
+	query, args := overlayQuery(ctx, statement)
+	return conn(ctx).QueryRowContext(ctx, query, args...)
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-jet/jet/v2/postgres"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/models/generated/content/public/table"
+	"encore.app/pagination"
+)
+
+type authorContextKey struct{}
+
+// WithAuthor returns a copy of the context where the documents written are recorded as changed by the
+// API key with the given ID, which is kept in the history of the documents.
+func WithAuthor(ctx context.Context, keyID int64) context.Context {
+	return context.WithValue(ctx, authorContextKey{}, keyID)
+}
+
+// authorExpression returns the ID of the API key added to the context with WithAuthor, or NULL if the
+// author of the changes is unknown.
+func authorExpression(ctx context.Context) postgres.IntegerExpression {
+	keyID, ok := ctx.Value(authorContextKey{}).(int64)
+	if !ok {
+		return postgres.IntExp(postgres.NULL)
+	}
+
+	return postgres.Int64(keyID)
+}
+
+// RevisionSortKey returns the key sorting the revisions of a document by version.
+func RevisionSortKey() pagination.SortKey {
+	return pagination.SortKey{
+		Name:       "version",
+		Expression: table.DocumentRevisions.Version,
+		Type:       "bigint",
+	}
+}
+
+// ListDocumentRevisions lists a page of the revisions of a document, sorted by the sort key returned by
+// RevisionSortKey. Revisions are only recorded for the committed versions of the documents of collections
+// keeping their history. The cursor to the next page is returned if there are more revisions to fetch.
+func ListDocumentRevisions(ctx context.Context, documentID int64, page *pagination.Page) ([]*model.DocumentRevisions, string, error) {
+	statement := postgres.SELECT(
+		table.DocumentRevisions.DocumentID,
+		table.DocumentRevisions.Version,
+		table.DocumentRevisions.Content,
+		table.DocumentRevisions.CreatedBy,
+		table.DocumentRevisions.CreatedAt,
+	).FROM(table.DocumentRevisions).WHERE(
+		page.Where(
+			table.DocumentRevisions.DocumentID.EQ(postgres.Int64(documentID)),
+			table.DocumentRevisions.Version,
+		),
+	).ORDER_BY(
+		page.OrderBy(table.DocumentRevisions.Version)...,
+	).LIMIT(page.Fetch())
+
+	var revisions []*model.DocumentRevisions
+	err := statement.QueryContext(ctx, conn(ctx), &revisions)
+	if err != nil {
+		log.WithError(err).Errorf("Could not query the revisions of document %d", documentID)
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if page.HasNext(len(revisions)) {
+		revisions = revisions[:page.Limit]
+
+		last := revisions[len(revisions)-1]
+		nextCursor = page.Next(last.Version, strconv.FormatInt(last.Version, 10))
+	}
+
+	return revisions, nextCursor, nil
+}
+
+// GetDocumentRevision fetches the revision of a document at the given version. Returns an error if the
+// version was not recorded.
+func GetDocumentRevision(ctx context.Context, documentID, version int64) (*model.DocumentRevisions, error) {
+	statement := postgres.SELECT(
+		table.DocumentRevisions.DocumentID,
+		table.DocumentRevisions.Version,
+		table.DocumentRevisions.Content,
+		table.DocumentRevisions.CreatedBy,
+		table.DocumentRevisions.CreatedAt,
+	).FROM(table.DocumentRevisions).WHERE(
+		table.DocumentRevisions.DocumentID.EQ(postgres.Int64(documentID)).
+			AND(table.DocumentRevisions.Version.EQ(postgres.Int64(version))),
+	).LIMIT(1)
+
+	revision := model.DocumentRevisions{}
+	err := statement.QueryContext(ctx, conn(ctx), &revision)
+	if err != nil {
+		log.WithError(err).Errorf("Could not query revision %d of document %d", version, documentID)
+		return nil, err
+	}
+
+	return &revision, nil
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-jet/jet/v2/postgres"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/models/generated/content/public/table"
+	"encore.app/content/query"
+	"encore.app/pagination"
+)
+
+// SearchResult is a document matching a full-text search, along with its rank and the highlights of its content.
+type SearchResult struct {
+	model.Documents
+
+	// The rank of the document for the search, the more relevant the document, the higher the rank
+	Rank float64 `alias:"documents.rank"`
+
+	// The highlighted values of the searched paths matching the search, as a JSON object
+	Highlights string `alias:"documents.highlights"`
+}
+
+// SearchSortKey returns the key sorting the documents matching a full-text search by rank.
+func SearchSortKey(ctx context.Context, search *query.Search) pagination.SortKey {
+	return pagination.SortKey{
+		Name:       "rank",
+		Expression: search.Rank(table.Documents.Content, searchVectorColumn(ctx)),
+		Type:       "real",
+	}
+}
+
+// SearchDocuments lists a page of the documents of a collection matching a full-text search, sorted by the sort
+// key returned by SearchSortKey. When a filter is given, only the documents with a content also matching the filter
+// are returned. The cursor to the next page is returned if there are more documents to fetch.
+func SearchDocuments(ctx context.Context, collectionID int64, search *query.Search, filter *query.Filter, page *pagination.Page) ([]*SearchResult, string, error) {
+	condition := table.Documents.CollectionID.EQ(postgres.Int64(collectionID)).
+		AND(table.Documents.DeletedAt.IS_NULL()).
+		AND(search.Match(table.Documents.Content, searchVectorColumn(ctx)))
+	if filter != nil {
+		condition = condition.AND(filter.Condition(table.Documents.Content))
+	}
+
+	statement := postgres.SELECT(
+		table.Documents.ID,
+		table.Documents.Content,
+		table.Documents.CollectionID,
+		table.Documents.UpdatedAt,
+		table.Documents.CreatedAt,
+		table.Documents.Version,
+		table.Documents.Key,
+		page.SortKey.Expression.AS("documents.rank"),
+		search.Highlights(table.Documents.Content).AS("documents.highlights"),
+	).FROM(documentsTable(ctx)).WHERE(
+		page.Where(condition, table.Documents.ID),
+	).ORDER_BY(
+		page.OrderBy(table.Documents.ID)...,
+	).LIMIT(page.Fetch())
+
+	var results []*SearchResult
+	err := queryOverlay(ctx, statement, &results)
+	if err != nil {
+		log.WithError(err).Errorf("Could not search documents of collection %d", collectionID)
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if page.HasNext(len(results)) {
+		results = results[:page.Limit]
+
+		// Ranks are real numbers, formatted with the precision of their type so the cursor compares equal
+		last := results[len(results)-1]
+		nextCursor = page.Next(last.ID, strconv.FormatFloat(last.Rank, 'g', -1, 32))
+	}
+
+	documents := make([]*model.Documents, len(results))
+	for i, result := range results {
+		documents[i] = &result.Documents
+	}
+
+	err = recordReadDocuments(ctx, documents...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return results, nextCursor, nil
+}
+
+// searchVectorColumn returns the column storing the text search vectors of the documents. The vectors are only
+// stored for committed documents, it returns nil in a transaction so they are built from the content of the documents.
+func searchVectorColumn(ctx context.Context) postgres.Column {
+	if TransactionFromContext(ctx) != nil {
+		return nil
+	}
+
+	return table.Documents.SearchVector
+}
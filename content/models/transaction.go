@@ -14,61 +14,75 @@ import (
 
 const TransactionExpirationTime = 10 * time.Minute
 
+type transactionContextKey struct{}
+
 // NewTransaction generates a new transaction structure using the provided database ID and sets its
 // expiration date to 10 minutes from now.
-func NewTransaction(databaseID uuid.UUID) *model.Transactions {
+func NewTransaction(databaseID int64) *model.Transactions {
 	return &model.Transactions{
 		DatabaseID: databaseID,
 		ExpiresAt:  time.Now().Add(TransactionExpirationTime),
-		Script: `BEGIN;
-"{{.Sql}}
-COMMIT;`,
 	}
 }
 
+// WithTransaction returns a copy of the context where documents and collections are read from and
+// written to the given transaction rather than the committed data.
+func WithTransaction(ctx context.Context, transaction *model.Transactions) context.Context {
+	return context.WithValue(ctx, transactionContextKey{}, transaction)
+}
+
+// TransactionFromContext returns the transaction added to the context with WithTransaction, or nil
+// if the context is not in a transaction.
+func TransactionFromContext(ctx context.Context) *model.Transactions {
+	transaction, _ := ctx.Value(transactionContextKey{}).(*model.Transactions)
+	return transaction
+}
+
 // GetTransactionByID fetches a single transaction record given an ID and the associated
-// database ID. Returns nil on an error.
-func GetTransactionByID(ctx context.Context, id, databaseID uuid.UUID) (*model.Transactions, error) {
+// user ID of the database it was started on. Returns nil on an error.
+func GetTransactionByID(ctx context.Context, id uuid.UUID, userID int64) (*model.Transactions, error) {
 	statement := postgres.SELECT(
 		table.Transactions.ID,
-		table.Transactions.Script,
 		table.Transactions.DatabaseID,
 		table.Transactions.ExpiresAt,
 		table.Transactions.UpdatedAt,
 		table.Transactions.CreatedAt,
 	).FROM(
-		table.Transactions,
+		table.Transactions.LEFT_JOIN(
+			table.Databases,
+			table.Transactions.DatabaseID.EQ(table.Databases.ID),
+		),
 	).WHERE(
 		table.Transactions.ID.EQ(postgres.UUID(id)).
-			AND(table.Transactions.DatabaseID.EQ(postgres.UUID(databaseID))),
+			AND(table.Databases.UserID.EQ(postgres.Int64(userID))).
+			AND(table.Databases.DeletedAt.IS_NULL()),
 	).LIMIT(1)
 
 	transaction := model.Transactions{}
 	err := statement.QueryContext(ctx, db, &transaction)
 	if err != nil {
-		log.WithError(err).Errorf("Could not query transaction for id %d", id)
+		log.WithError(err).Errorf("Could not query transaction for id %s", id)
 		return nil, err
 	}
 
 	return &transaction, nil
 }
 
-// SaveTransaction saves the data of the transaction it used on. SaveTransaction will
+// SaveTransaction saves the data of the transaction it used on. This method only saves
+// the database ID and expiration date from the struct and updates the timestamps. SaveTransaction will
 // trigger an error if the constraints are not respected.
 func SaveTransaction(ctx context.Context, transaction *model.Transactions) error {
 	if transaction.ID == uuid.Nil {
-		query, args := table.Collections.INSERT(
-			table.Transactions.Script,
+		query, args := table.Transactions.INSERT(
 			table.Transactions.DatabaseID,
 			table.Transactions.ExpiresAt,
 		).VALUES(
-			transaction.Script,
 			transaction.DatabaseID,
 			transaction.ExpiresAt,
 		).RETURNING(
-			table.Collections.ID,
-			table.Collections.UpdatedAt,
-			table.Collections.CreatedAt,
+			table.Transactions.ID,
+			table.Transactions.UpdatedAt,
+			table.Transactions.CreatedAt,
 		).Sql()
 
 		err := db.
@@ -84,9 +98,9 @@ func SaveTransaction(ctx context.Context, transaction *model.Transactions) error
 	}
 
 	query, args := table.Transactions.UPDATE().SET(
-		table.Transactions.Script.SET(postgres.String(transaction.Script)),
-		table.Transactions.DatabaseID.SET(postgres.UUID(transaction.DatabaseID)),
+		table.Transactions.DatabaseID.SET(postgres.Int64(transaction.DatabaseID)),
 		table.Transactions.ExpiresAt.SET(postgres.TimestampzT(transaction.ExpiresAt)),
+		table.Transactions.UpdatedAt.SET(postgres.NOW()),
 	).WHERE(
 		table.Transactions.ID.EQ(postgres.UUID(transaction.ID)),
 	).RETURNING(
@@ -107,7 +121,180 @@ func SaveTransaction(ctx context.Context, transaction *model.Transactions) error
 	return nil
 }
 
-// DeleteTransaction deletes the Transaction is it called on.
+// CommitTransaction applies all the changes made in the transaction it is called on to the committed
+// collections and documents, then deletes the transaction. Collections and documents deleted in the
+// transaction are moved to the trash. All changes are applied in a single SQL
+// transaction, either all of them are applied or none are. Unless forced, nothing is applied if documents
+// read or written in the transaction were changed outside of it, and those documents are returned.
+func CommitTransaction(ctx context.Context, transaction *model.Transactions, force bool) ([]DocumentConflict, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		log.WithError(err).Error("Could not begin the commit of a transaction")
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if !force {
+		conflicts, err := findDocumentConflicts(ctx, tx, transaction)
+		if err != nil {
+			log.WithError(err).Errorf("Could not check transaction %s for conflicts", transaction.ID)
+			return nil, err
+		}
+
+		if len(conflicts) > 0 {
+			return conflicts, nil
+		}
+	}
+
+	transactionID := postgres.UUID(transaction.ID)
+	statements := []postgres.Statement{
+		table.Collections.UPDATE().SET(
+			table.Collections.DeletedAt.SET(postgres.NOW()),
+		).WHERE(
+			table.Collections.DeletedAt.IS_NULL().AND(table.Collections.ID.IN(
+				postgres.SELECT(table.TransactionalCollections.ID).
+					FROM(table.TransactionalCollections).
+					WHERE(
+						table.TransactionalCollections.TransactionID.EQ(transactionID).
+							AND(table.TransactionalCollections.Deleted.IS_TRUE()),
+					),
+			)),
+		),
+		table.Collections.INSERT(
+			table.Collections.ID,
+			table.Collections.Name,
+			table.Collections.DatabaseID,
+			table.Collections.CreatedAt,
+			table.Collections.UpdatedAt,
+			table.Collections.Schema,
+			table.Collections.Search,
+			table.Collections.History,
+		).QUERY(
+			postgres.SELECT(
+				table.TransactionalCollections.ID,
+				table.TransactionalCollections.Name,
+				table.TransactionalCollections.DatabaseID,
+				table.TransactionalCollections.CreatedAt,
+				table.TransactionalCollections.UpdatedAt,
+				table.TransactionalCollections.Schema,
+				table.TransactionalCollections.Search,
+				table.TransactionalCollections.History,
+			).FROM(table.TransactionalCollections).WHERE(
+				table.TransactionalCollections.TransactionID.EQ(transactionID).
+					AND(table.TransactionalCollections.Deleted.IS_FALSE()),
+			),
+		).ON_CONFLICT(table.Collections.ID).DO_UPDATE(
+			postgres.SET(
+				table.Collections.Name.SET(table.Collections.EXCLUDED.Name),
+				table.Collections.UpdatedAt.SET(table.Collections.EXCLUDED.UpdatedAt),
+				table.Collections.Schema.SET(table.Collections.EXCLUDED.Schema),
+				table.Collections.Search.SET(table.Collections.EXCLUDED.Search),
+				table.Collections.History.SET(table.Collections.EXCLUDED.History),
+			),
+		),
+		table.Documents.UPDATE().SET(
+			table.Documents.DeletedAt.SET(postgres.NOW()),
+		).WHERE(
+			table.Documents.DeletedAt.IS_NULL().AND(table.Documents.ID.IN(
+				postgres.SELECT(table.TransactionalDocuments.ID).
+					FROM(table.TransactionalDocuments).
+					WHERE(
+						table.TransactionalDocuments.TransactionID.EQ(transactionID).
+							AND(table.TransactionalDocuments.Deleted.IS_TRUE()),
+					),
+			)),
+		),
+		// Documents created in collections that no longer exist are dropped with their collection
+		table.Documents.INSERT(
+			table.Documents.ID,
+			table.Documents.Content,
+			table.Documents.CollectionID,
+			table.Documents.CreatedAt,
+			table.Documents.UpdatedAt,
+			table.Documents.Version,
+			table.Documents.Key,
+			table.Documents.UpdatedBy,
+		).QUERY(
+			postgres.SELECT(
+				table.TransactionalDocuments.ID,
+				table.TransactionalDocuments.Content,
+				table.TransactionalDocuments.CollectionID,
+				table.TransactionalDocuments.CreatedAt,
+				table.TransactionalDocuments.UpdatedAt,
+				table.TransactionalDocuments.Version,
+				table.TransactionalDocuments.Key,
+				table.TransactionalDocuments.UpdatedBy,
+			).FROM(
+				table.TransactionalDocuments.INNER_JOIN(
+					table.Collections,
+					table.TransactionalDocuments.CollectionID.EQ(table.Collections.ID),
+				),
+			).WHERE(
+				table.TransactionalDocuments.TransactionID.EQ(transactionID).
+					AND(table.TransactionalDocuments.Deleted.IS_FALSE()),
+			),
+		).ON_CONFLICT(table.Documents.ID).DO_UPDATE(
+			postgres.SET(
+				table.Documents.Content.SET(table.Documents.EXCLUDED.Content),
+				table.Documents.UpdatedAt.SET(table.Documents.EXCLUDED.UpdatedAt),
+				table.Documents.Version.SET(table.Documents.EXCLUDED.Version),
+				table.Documents.UpdatedBy.SET(table.Documents.EXCLUDED.UpdatedBy),
+			),
+		),
+		table.Transactions.DELETE().WHERE(table.Transactions.ID.EQ(transactionID)),
+	}
+
+	for _, statement := range statements {
+		_, err = statement.ExecContext(ctx, tx)
+		if err != nil {
+			log.WithError(err).Errorf("Could not apply the changes of transaction %s", transaction.ID)
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.WithError(err).Errorf("Could not commit transaction %s", transaction.ID)
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// RollbackTransaction deletes all the changes made in the transaction it is called on, keeping the
+// transaction itself so it can be reused.
+func RollbackTransaction(ctx context.Context, transaction *model.Transactions) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		log.WithError(err).Error("Could not begin the rollback of a transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []postgres.Statement{
+		table.TransactionalDocuments.DELETE().WHERE(
+			table.TransactionalDocuments.TransactionID.EQ(postgres.UUID(transaction.ID)),
+		),
+		table.TransactionalCollections.DELETE().WHERE(
+			table.TransactionalCollections.TransactionID.EQ(postgres.UUID(transaction.ID)),
+		),
+		table.TransactionDocumentVersions.DELETE().WHERE(
+			table.TransactionDocumentVersions.TransactionID.EQ(postgres.UUID(transaction.ID)),
+		),
+	}
+
+	for _, statement := range statements {
+		_, err = statement.ExecContext(ctx, tx)
+		if err != nil {
+			log.WithError(err).Errorf("Could not rollback the changes of transaction %s", transaction.ID)
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteTransaction deletes the Transaction is it called on, along with all its changes.
 func DeleteTransaction(ctx context.Context, transaction *model.Transactions) error {
 	query, args := table.Transactions.
 		DELETE().
@@ -124,3 +311,90 @@ func DeleteTransaction(ctx context.Context, transaction *model.Transactions) err
 
 	return nil
 }
+
+// DeleteExpiredTransactions deletes all the transactions that expired before the given time, along with
+// all their changes, keeping a record of each of them in the expired transactions. Returns the number of
+// deleted transactions.
+func DeleteExpiredTransactions(ctx context.Context, before time.Time) (int64, error) {
+	expired := table.Transactions.ExpiresAt.LT_EQ(postgres.TimestampzT(before))
+
+	var deleted int64
+	err := RunInSQLTransaction(ctx, func(ctx context.Context) error {
+		query, args := table.ExpiredTransactions.INSERT(
+			table.ExpiredTransactions.ID,
+			table.ExpiredTransactions.DatabaseID,
+			table.ExpiredTransactions.ExpiresAt,
+		).QUERY(
+			postgres.SELECT(
+				table.Transactions.ID,
+				table.Transactions.DatabaseID,
+				table.Transactions.ExpiresAt,
+			).FROM(table.Transactions).WHERE(expired),
+		).ON_CONFLICT(table.ExpiredTransactions.ID).DO_NOTHING().Sql()
+
+		_, err := conn(ctx).ExecContext(ctx, query, args...)
+		if err != nil {
+			log.WithError(err).Error("Could not record expired transactions")
+			return err
+		}
+
+		query, args = table.Transactions.
+			DELETE().
+			WHERE(expired).
+			Sql()
+
+		result, err := conn(ctx).ExecContext(ctx, query, args...)
+		if err != nil {
+			log.WithError(err).Error("Could not delete expired transactions")
+			return err
+		}
+
+		deleted, err = result.RowsAffected()
+		return err
+	})
+
+	return deleted, err
+}
+
+// DeleteExpiredTransactionRecords deletes the records of the transactions that expired before the given time,
+// after which their keys are no longer known. Returns the number of deleted records.
+func DeleteExpiredTransactionRecords(ctx context.Context, before time.Time) (int64, error) {
+	query, args := table.ExpiredTransactions.
+		DELETE().
+		WHERE(table.ExpiredTransactions.ExpiresAt.LT_EQ(postgres.TimestampzT(before))).
+		Sql()
+
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		log.WithError(err).Error("Could not delete the records of expired transactions")
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// IsExpiredTransaction tells whether a transaction with the given ID, started on a database of the given user,
+// was deleted after it expired.
+func IsExpiredTransaction(ctx context.Context, id uuid.UUID, userID int64) (bool, error) {
+	query, args := postgres.SELECT(
+		postgres.COUNT(postgres.STAR),
+	).FROM(
+		table.ExpiredTransactions.INNER_JOIN(
+			table.Databases,
+			table.ExpiredTransactions.DatabaseID.EQ(table.Databases.ID),
+		),
+	).WHERE(
+		table.ExpiredTransactions.ID.EQ(postgres.UUID(id)).
+			AND(table.Databases.UserID.EQ(postgres.Int64(userID))).
+			AND(table.Databases.DeletedAt.IS_NULL()),
+	).Sql()
+
+	var count int64
+	err := db.QueryRowContext(ctx, query, args...).Scan(&count)
+	if err != nil {
+		log.WithError(err).Errorf("Could not query expired transaction for id %s", id)
+		return false, err
+	}
+
+	return count > 0, nil
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"context"
+
+	"github.com/go-jet/jet/v2/postgres"
+	"github.com/go-jet/jet/v2/qrm"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/models/generated/content/public/table"
+)
+
+// DocumentConflict is a document read or written in a transaction that was changed outside the
+// transaction since.
+type DocumentConflict struct {
+	// The unique identifier of the document
+	DocumentID int64
+
+	// The version of the document when it was first read or written in the transaction
+	ExpectedVersion int64
+
+	// The current version of the document, 0 if the document was deleted
+	ActualVersion int64
+}
+
+// recordDocumentVersions records the committed version of the given documents for the transaction,
+// unless the transaction already recorded one. Documents created in the transaction have no committed
+// version and are not recorded.
+func recordDocumentVersions(ctx context.Context, transaction *model.Transactions, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	expressions := make([]postgres.Expression, 0, len(ids))
+	for _, id := range ids {
+		expressions = append(expressions, postgres.Int64(id))
+	}
+
+	query, args := table.TransactionDocumentVersions.INSERT(
+		table.TransactionDocumentVersions.TransactionID,
+		table.TransactionDocumentVersions.DocumentID,
+		table.TransactionDocumentVersions.Version,
+	).QUERY(
+		postgres.SELECT(
+			postgres.UUID(transaction.ID),
+			table.Documents.ID,
+			table.Documents.Version,
+		).FROM(table.Documents).WHERE(
+			table.Documents.ID.IN(expressions...),
+		),
+	).ON_CONFLICT().DO_NOTHING().Sql()
+
+	_, err := conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		log.WithError(err).Errorf("Could not record document versions for transaction %s", transaction.ID)
+		return err
+	}
+
+	return nil
+}
+
+// recordReadDocuments records the committed version of documents read in the transaction of the
+// context, if any.
+func recordReadDocuments(ctx context.Context, documents ...*model.Documents) error {
+	transaction := TransactionFromContext(ctx)
+	if transaction == nil {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(documents))
+	for _, document := range documents {
+		ids = append(ids, document.ID)
+	}
+
+	return recordDocumentVersions(ctx, transaction, ids)
+}
+
+// findDocumentConflicts locks the documents recorded by the transaction and returns the ones changed
+// since they were recorded. Documents moved to the trash are reported at version 0, like deleted ones.
+func findDocumentConflicts(ctx context.Context, db qrm.DB, transaction *model.Transactions) ([]DocumentConflict, error) {
+	recorded := postgres.SELECT(table.TransactionDocumentVersions.DocumentID).
+		FROM(table.TransactionDocumentVersions).
+		WHERE(table.TransactionDocumentVersions.TransactionID.EQ(postgres.UUID(transaction.ID)))
+
+	lock := postgres.SELECT(table.Documents.ID).
+		FROM(table.Documents).
+		WHERE(table.Documents.ID.IN(recorded)).
+		FOR(postgres.UPDATE())
+
+	_, err := lock.ExecContext(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	statement := postgres.SELECT(
+		table.TransactionDocumentVersions.DocumentID.AS("document_conflict.document_id"),
+		table.TransactionDocumentVersions.Version.AS("document_conflict.expected_version"),
+		postgres.COALESCE(
+			postgres.CASE().WHEN(table.Documents.DeletedAt.IS_NULL()).THEN(table.Documents.Version),
+			postgres.Int(0),
+		).AS("document_conflict.actual_version"),
+	).FROM(
+		table.TransactionDocumentVersions.LEFT_JOIN(
+			table.Documents,
+			table.TransactionDocumentVersions.DocumentID.EQ(table.Documents.ID),
+		),
+	).WHERE(
+		table.TransactionDocumentVersions.TransactionID.EQ(postgres.UUID(transaction.ID)).
+			AND(
+				table.Documents.Version.IS_DISTINCT_FROM(table.TransactionDocumentVersions.Version).
+					OR(table.Documents.DeletedAt.IS_NOT_NULL()),
+			),
+	).ORDER_BY(table.TransactionDocumentVersions.DocumentID)
+
+	var conflicts []DocumentConflict
+	err = statement.QueryContext(ctx, db, &conflicts)
+	if err != nil {
+		return nil, err
+	}
+
+	return conflicts, nil
+}
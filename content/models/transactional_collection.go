@@ -3,7 +3,6 @@ package models
 import (
 	"context"
 
-	"encore.dev/types/uuid"
 	"github.com/go-jet/jet/v2/postgres"
 	log "github.com/sirupsen/logrus"
 
@@ -11,180 +10,92 @@ import (
 	"encore.app/content/models/generated/content/public/table"
 )
 
-// NewTransactionalCollection generates a new transaction collection structure from a name and the
-// associated database ID.
-func NewTransactionalCollection(name string, databaseID, transactionID uuid.UUID) *model.TransactionalCollections {
-	return &model.TransactionalCollections{
-		Name:          name,
-		DatabaseID:    databaseID,
-		TransactionID: transactionID,
-	}
-}
-
-// ListTransactionalCollections lists all collections for a given database in a transaction, it returns
-// a nil collection on an error.
-func ListTransactionalCollections(ctx context.Context, databaseID, transactionID uuid.UUID) ([]*model.TransactionalCollections, error) {
-	statement := postgres.SELECT(
+// insertTransactionalCollection creates a collection in a transaction. The collection takes its ID from
+// the collections sequence so it keeps the same ID once committed.
+func insertTransactionalCollection(ctx context.Context, transaction *model.Transactions, collection *model.Collections) error {
+	query, args := table.TransactionalCollections.INSERT(
+		table.TransactionalCollections.TransactionID,
 		table.TransactionalCollections.ID,
 		table.TransactionalCollections.Name,
 		table.TransactionalCollections.DatabaseID,
-		table.TransactionalCollections.TransactionID,
+		table.TransactionalCollections.Schema,
+		table.TransactionalCollections.Search,
+		table.TransactionalCollections.History,
+	).VALUES(
+		postgres.UUID(transaction.ID),
+		postgres.Raw("nextval('collections_id_seq')"),
+		collection.Name,
+		collection.DatabaseID,
+		collection.Schema,
+		collection.Search,
+		collection.History,
+	).RETURNING(
+		table.TransactionalCollections.ID,
 		table.TransactionalCollections.UpdatedAt,
 		table.TransactionalCollections.CreatedAt,
-	).FROM(table.TransactionalCollections).WHERE(
-		table.TransactionalCollections.DatabaseID.EQ(postgres.UUID(databaseID)).AND(
-			table.TransactionalCollections.TransactionID.EQ(postgres.UUID(transactionID)),
-		),
-	)
+	).Sql()
+
+	err := conn(ctx).
+		QueryRowContext(ctx, query, args...).
+		Scan(&collection.ID, &collection.UpdatedAt, &collection.CreatedAt)
 
-	var collections []*model.TransactionalCollections
-	err := statement.QueryContext(ctx, db, &collections)
 	if err != nil {
-		log.WithError(err).Error("Could not query collections")
-		return nil, err
+		log.WithError(err).Error("Could not insert collection in transaction")
+		return err
 	}
 
-	return collections, nil
+	return nil
 }
 
-// GetTransactionalCollectionByID fetches a single transactional collection record given an ID, and the associated
-// database ID and transaction ID. Returns nil on an error.
-func GetTransactionalCollectionByID(ctx context.Context, id, userID, transactionID uuid.UUID) (*model.TransactionalCollections, error) {
-	statement := postgres.SELECT(
+// writeTransactionalCollection records a change to an existing collection in a transaction, from the
+// version of the collection currently visible in the transaction. The collection takes the name, schema,
+// search configuration and history setting of the struct, or is marked as deleted.
+func writeTransactionalCollection(ctx context.Context, transaction *model.Transactions, collection *model.Collections, deleted bool) error {
+	collections := collectionsTable(ctx)
+	statement := table.TransactionalCollections.INSERT(
+		table.TransactionalCollections.TransactionID,
 		table.TransactionalCollections.ID,
 		table.TransactionalCollections.Name,
 		table.TransactionalCollections.DatabaseID,
-		table.TransactionalCollections.TransactionID,
-		table.TransactionalCollections.UpdatedAt,
+		table.TransactionalCollections.Deleted,
 		table.TransactionalCollections.CreatedAt,
-	).FROM(
-		table.TransactionalCollections.LEFT_JOIN(
-			table.Databases,
-			table.TransactionalCollections.DatabaseID.EQ(table.Databases.ID),
+		table.TransactionalCollections.Schema,
+		table.TransactionalCollections.Search,
+		table.TransactionalCollections.History,
+	).QUERY(
+		postgres.SELECT(
+			postgres.UUID(transaction.ID),
+			collections.ID,
+			postgres.String(collection.Name),
+			collections.DatabaseID,
+			postgres.Bool(deleted),
+			collections.CreatedAt,
+			jsonValue(collection.Schema),
+			jsonValue(collection.Search),
+			postgres.Bool(collection.History),
+		).FROM(collections).WHERE(
+			collections.ID.EQ(postgres.Int64(collection.ID)),
 		),
-	).WHERE(
-		table.TransactionalCollections.ID.EQ(postgres.UUID(id)).
-			AND(table.TransactionalCollections.TransactionID.EQ(postgres.UUID(transactionID))).
-			AND(table.Databases.UserID.EQ(postgres.UUID(userID))),
-	).LIMIT(1)
-
-	collection := model.TransactionalCollections{}
-	err := statement.QueryContext(ctx, db, &collection)
-	if err != nil {
-		log.WithError(err).Errorf("Could not query collection for id %d", id)
-		return nil, err
-	}
-
-	return &collection, nil
-}
-
-// ValidateTransactionalCollectionConstraint validates that no collection nor transactional with the same name exists
-// for a single database.
-func ValidateTransactionalCollectionConstraint(ctx context.Context, collection *model.TransactionalCollections) bool {
-	query, args := postgres.SELECT(
-		table.Collections.ID,
-	).FROM(
-		table.Collections,
-	).WHERE(
-		table.Collections.Name.EQ(postgres.String(collection.Name)).
-			AND(table.Collections.DatabaseID.EQ(postgres.UUID(collection.DatabaseID))),
-	).LIMIT(1).Sql()
-
-	id := uuid.Nil
-	err := db.QueryRowContext(ctx, query, args...).Scan(&id)
-	if err == nil && id != uuid.Nil {
-		log.Warning("Tried to save collection, a collection already exists for this name and database_id")
-		return false
-	}
-
-	query, args = postgres.SELECT(
+	).ON_CONFLICT(
+		table.TransactionalCollections.TransactionID,
 		table.TransactionalCollections.ID,
-	).FROM(
-		table.TransactionalCollections,
-	).WHERE(
-		table.TransactionalCollections.Name.EQ(postgres.String(collection.Name)).
-			AND(table.TransactionalCollections.DatabaseID.EQ(postgres.UUID(collection.DatabaseID))),
-	).LIMIT(1).Sql()
-
-	id = uuid.Nil
-	err = db.QueryRowContext(ctx, query, args...).Scan(&id)
-	if err == nil && id != uuid.Nil {
-		log.Warning("Tried to save collection, a collection already exists for this name and database_id")
-		return false
-	}
-
-	return true
-}
-
-// SaveTransactionalCollection saves the data of the transactional collection it used on. This method only saves
-// the name and database ID from the struct and updates the timestamps. SaveTransactionalCollection will
-// trigger an error if the constraints are not respected.
-func SaveTransactionalCollection(ctx context.Context, collection *model.TransactionalCollections) error {
-	if collection.ID == uuid.Nil {
-		query, args := table.Collections.INSERT(
-			table.TransactionalCollections.Name,
-			table.TransactionalCollections.DatabaseID,
-			table.TransactionalCollections.TransactionID,
-		).VALUES(
-			collection.Name,
-			collection.DatabaseID,
-			collection.TransactionID,
-		).RETURNING(
-			table.TransactionalCollections.ID,
-			table.TransactionalCollections.UpdatedAt,
-			table.TransactionalCollections.CreatedAt,
-		).Sql()
-
-		err := db.
-			QueryRowContext(ctx, query, args...).
-			Scan(&collection.ID, &collection.UpdatedAt, &collection.CreatedAt)
-
-		if err != nil {
-			log.WithError(err).Error("Could not insert collection")
-			return err
-		}
-
-		return nil
-	}
-
-	// TODO: Consider we might have to create the collection first if updating a collection
-	// that exists outside the transaction
-	query, args := table.TransactionalCollections.UPDATE().SET(
-		table.TransactionalCollections.Name.SET(postgres.String(collection.Name)),
-		table.TransactionalCollections.DatabaseID.SET(postgres.UUID(collection.DatabaseID)),
-		table.TransactionalCollections.TransactionID.SET(postgres.UUID(collection.TransactionID)),
-	).WHERE(
-		table.TransactionalCollections.ID.EQ(postgres.UUID(collection.ID)),
+	).DO_UPDATE(
+		postgres.SET(
+			table.TransactionalCollections.Name.SET(table.TransactionalCollections.EXCLUDED.Name),
+			table.TransactionalCollections.Schema.SET(table.TransactionalCollections.EXCLUDED.Schema),
+			table.TransactionalCollections.Search.SET(table.TransactionalCollections.EXCLUDED.Search),
+			table.TransactionalCollections.History.SET(table.TransactionalCollections.EXCLUDED.History),
+			table.TransactionalCollections.Deleted.SET(table.TransactionalCollections.EXCLUDED.Deleted),
+			table.TransactionalCollections.UpdatedAt.SET(postgres.NOW()),
+		),
 	).RETURNING(
-		table.TransactionalCollections.ID,
 		table.TransactionalCollections.UpdatedAt,
 		table.TransactionalCollections.CreatedAt,
-	).Sql()
-
-	err := db.
-		QueryRowContext(ctx, query, args...).
-		Scan(&collection.ID, &collection.UpdatedAt, &collection.CreatedAt)
+	)
 
+	err := queryRowOverlay(ctx, statement).Scan(&collection.UpdatedAt, &collection.CreatedAt)
 	if err != nil {
-		log.WithError(err).Error("Could not update collection")
-		return err
-	}
-
-	return nil
-}
-
-// DeleteTransactionalCollection deletes the transactional collection is it called on.
-func DeleteTransactionalCollection(ctx context.Context, collection *model.TransactionalCollections) error {
-	query, args := table.TransactionalCollections.
-		DELETE().
-		WHERE(table.TransactionalCollections.ID.EQ(postgres.UUID(collection.ID))).
-		RETURNING(table.TransactionalCollections.ID).
-		Sql()
-
-	deletedID := uuid.Nil
-	err := db.QueryRowContext(ctx, query, args...).Scan(&deletedID)
-	if err != nil || deletedID == uuid.Nil {
-		log.WithError(err).Error("Could not delete collection")
+		log.WithError(err).Error("Could not write collection in transaction")
 		return err
 	}
 
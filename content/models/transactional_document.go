@@ -3,7 +3,6 @@ package models
 import (
 	"context"
 
-	"encore.dev/types/uuid"
 	"github.com/go-jet/jet/v2/postgres"
 	log "github.com/sirupsen/logrus"
 
@@ -11,144 +10,161 @@ import (
 	"encore.app/content/models/generated/content/public/table"
 )
 
-// NewTransactionalDocument generates a new transactional document structure using the given content for
-// a specific collection.
-func NewTransactionalDocument(content string, collectionID, transactionID uuid.UUID) *model.TransactionalDocuments {
-	return &model.TransactionalDocuments{
-		Content:       content,
-		CollectionID:  collectionID,
-		TransactionID: transactionID,
-	}
-}
-
-// ListTransactionalDocuments lists all transactional documents for a given collection, returning an empty slice
-// on an error.
-func ListTransactionalDocuments(ctx context.Context, collectionID, transactionID uuid.UUID) ([]*model.TransactionalDocuments, error) {
-	statement := postgres.SELECT(
+// insertTransactionalDocument creates a document in a transaction. The document takes its ID from
+// the documents sequence so it keeps the same ID once committed.
+func insertTransactionalDocument(ctx context.Context, transaction *model.Transactions, document *model.Documents) error {
+	query, args := table.TransactionalDocuments.INSERT(
+		table.TransactionalDocuments.TransactionID,
 		table.TransactionalDocuments.ID,
 		table.TransactionalDocuments.Content,
 		table.TransactionalDocuments.CollectionID,
-		table.TransactionalDocuments.TransactionID,
+		table.TransactionalDocuments.Key,
+		table.TransactionalDocuments.UpdatedBy,
+	).VALUES(
+		postgres.UUID(transaction.ID),
+		postgres.Raw("nextval('documents_id_seq')"),
+		document.Content,
+		document.CollectionID,
+		nullableString(document.Key),
+		authorExpression(ctx),
+	).RETURNING(
+		table.TransactionalDocuments.ID,
 		table.TransactionalDocuments.UpdatedAt,
 		table.TransactionalDocuments.CreatedAt,
-	).FROM(table.TransactionalDocuments).WHERE(
-		table.TransactionalDocuments.CollectionID.EQ(postgres.UUID(collectionID)).
-			AND(table.TransactionalDocuments.TransactionID.EQ(postgres.UUID(transactionID))),
-	)
+		table.TransactionalDocuments.Version,
+	).Sql()
+
+	err := conn(ctx).
+		QueryRowContext(ctx, query, args...).
+		Scan(&document.ID, &document.UpdatedAt, &document.CreatedAt, &document.Version)
 
-	var documents []*model.TransactionalDocuments
-	err := statement.QueryContext(ctx, db, &documents)
 	if err != nil {
-		log.WithError(err).Error("Could not query documents")
-		return nil, err
+		log.WithError(err).Error("Could not insert document in transaction")
+		return err
 	}
 
-	return documents, nil
+	return nil
 }
 
-// GetTransactionalDocumentByUser fetches a single transactional document record given an ID and the associated
-// user ID of the collection this document belongs to. Returns nil on an error.
-func GetTransactionalDocumentByUser(ctx context.Context, id, userID, transactionID uuid.UUID) (*model.TransactionalDocuments, error) {
-	statement := postgres.SELECT(
-		table.TransactionalDocuments.ID,
+// writeTransactionalDocument records a change to an existing document in a transaction, from the version
+// of the document currently visible in the transaction. The content expression is evaluated on that version
+// and the document is only written if it matches the condition, which must select the document by ID.
+// Returns sql.ErrNoRows if the document does not match the condition.
+func writeTransactionalDocument(ctx context.Context, transaction *model.Transactions, document *model.Documents, content postgres.StringExpression, deleted bool, condition postgres.BoolExpression) error {
+	err := recordDocumentVersions(ctx, transaction, []int64{document.ID})
+	if err != nil {
+		return err
+	}
+
+	statement := transactionalDocumentsWrite(ctx, transaction, content, deleted, condition).RETURNING(
 		table.TransactionalDocuments.Content,
-		table.TransactionalDocuments.CollectionID,
-		table.TransactionalDocuments.TransactionID,
 		table.TransactionalDocuments.UpdatedAt,
 		table.TransactionalDocuments.CreatedAt,
-	).FROM(
-		table.TransactionalDocuments.LEFT_JOIN(
-			table.Collections,
-			table.TransactionalDocuments.CollectionID.EQ(table.Collections.ID),
-		).LEFT_JOIN(
-			table.Databases,
-			table.Collections.DatabaseID.EQ(table.Databases.ID),
-		),
-	).WHERE(
-		table.TransactionalDocuments.ID.EQ(postgres.UUID(id)).
-			AND(table.TransactionalDocuments.TransactionID.EQ(postgres.UUID(transactionID))).
-			AND(table.Databases.UserID.EQ(postgres.UUID(userID))),
-	).LIMIT(1)
-
-	document := model.TransactionalDocuments{}
-	err := statement.QueryContext(ctx, db, &document)
+		table.TransactionalDocuments.Version,
+	)
+
+	err = queryRowOverlay(ctx, statement).
+		Scan(&document.Content, &document.UpdatedAt, &document.CreatedAt, &document.Version)
+
 	if err != nil {
-		log.WithError(err).Errorf("Could not query document for id %v", id)
-		return nil, err
+		log.WithError(err).Error("Could not write document in transaction")
+		return err
 	}
 
-	return &document, nil
+	return nil
 }
 
-// SaveTransactionalDocument saves the data of the transactional document it used on. This method only saves
-// the content and collection ID from the struct and updates the timestamps. SaveTransactionalDocument will
-// trigger an error if the constraints are not respected.
-func SaveTransactionalDocument(ctx context.Context, document *model.TransactionalDocuments) error {
-	if document.ID == uuid.Nil {
-		query, args := table.Documents.INSERT(
-			table.TransactionalDocuments.Content,
-			table.TransactionalDocuments.CollectionID,
-			table.TransactionalDocuments.TransactionID,
-		).VALUES(
-			document.Content,
-			document.CollectionID,
-			document.TransactionID,
-		).RETURNING(
-			table.TransactionalDocuments.ID,
-			table.TransactionalDocuments.UpdatedAt,
-			table.TransactionalDocuments.CreatedAt,
-		).Sql()
-
-		err := db.
-			QueryRowContext(ctx, query, args...).
-			Scan(&document.ID, &document.UpdatedAt, &document.CreatedAt)
-
-		if err != nil {
-			log.WithError(err).Error("Could not insert document")
-			return err
-		}
+// writeTransactionalDocuments records a change to all the documents matching the condition in a transaction,
+// in a single statement, the same way writeTransactionalDocument does for a single document. The IDs of the
+// matched documents must be given to record their committed version. Returns the number of written documents.
+func writeTransactionalDocuments(ctx context.Context, transaction *model.Transactions, ids []int64, content postgres.StringExpression, deleted bool, condition postgres.BoolExpression) (int64, error) {
+	err := recordDocumentVersions(ctx, transaction, ids)
+	if err != nil {
+		return 0, err
+	}
 
-		return nil
+	query, args := overlayQuery(ctx, transactionalDocumentsWrite(ctx, transaction, content, deleted, condition))
+	result, err := conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		log.WithError(err).Error("Could not write documents in transaction")
+		return 0, err
 	}
 
-	// TODO: Consider we might have to create the document first if updating a document
-	// that exists outside the transaction
-	query, args := table.TransactionalDocuments.UPDATE().SET(
-		table.TransactionalDocuments.Content.SET(postgres.String(document.Content)),
-	).WHERE(
-		table.TransactionalDocuments.ID.EQ(postgres.UUID(document.ID)),
-	).RETURNING(
+	return result.RowsAffected()
+}
+
+// transactionalDocumentsWrite generates the statement copying the documents visible in a transaction that
+// match the condition into the transaction, with the given content and deletion flag.
+func transactionalDocumentsWrite(ctx context.Context, transaction *model.Transactions, content postgres.StringExpression, deleted bool, condition postgres.BoolExpression) postgres.InsertStatement {
+	return table.TransactionalDocuments.INSERT(
+		table.TransactionalDocuments.TransactionID,
 		table.TransactionalDocuments.ID,
-		table.TransactionalDocuments.UpdatedAt,
+		table.TransactionalDocuments.Content,
+		table.TransactionalDocuments.CollectionID,
+		table.TransactionalDocuments.Version,
+		table.TransactionalDocuments.Deleted,
 		table.TransactionalDocuments.CreatedAt,
-	).Sql()
+		table.TransactionalDocuments.Key,
+		table.TransactionalDocuments.UpdatedBy,
+	).QUERY(
+		postgres.SELECT(
+			postgres.UUID(transaction.ID),
+			table.Documents.ID,
+			content,
+			table.Documents.CollectionID,
+			table.Documents.Version.ADD(postgres.Int(1)),
+			postgres.Bool(deleted),
+			table.Documents.CreatedAt,
+			table.Documents.Key,
+			authorExpression(ctx),
+		).FROM(documentsTable(ctx)).WHERE(condition),
+	).ON_CONFLICT(
+		table.TransactionalDocuments.TransactionID,
+		table.TransactionalDocuments.ID,
+	).DO_UPDATE(
+		postgres.SET(
+			table.TransactionalDocuments.Content.SET(table.TransactionalDocuments.EXCLUDED.Content),
+			table.TransactionalDocuments.Version.SET(table.TransactionalDocuments.EXCLUDED.Version),
+			table.TransactionalDocuments.Deleted.SET(table.TransactionalDocuments.EXCLUDED.Deleted),
+			table.TransactionalDocuments.UpdatedAt.SET(postgres.NOW()),
+			table.TransactionalDocuments.UpdatedBy.SET(table.TransactionalDocuments.EXCLUDED.UpdatedBy),
+		),
+	)
+}
 
-	err := db.
-		QueryRowContext(ctx, query, args...).
-		Scan(&document.ID, &document.UpdatedAt, &document.CreatedAt)
+// ListTransactionalDocuments lists the documents created or updated in the transaction it is called on,
+// sorted by ID. Deleted documents are not listed.
+func ListTransactionalDocuments(ctx context.Context, transaction *model.Transactions) ([]*model.Documents, error) {
+	query, args := postgres.SELECT(
+		table.TransactionalDocuments.ID,
+		table.TransactionalDocuments.Content,
+		table.TransactionalDocuments.CollectionID,
+		table.TransactionalDocuments.Key,
+	).FROM(table.TransactionalDocuments).WHERE(
+		table.TransactionalDocuments.TransactionID.EQ(postgres.UUID(transaction.ID)).
+			AND(table.TransactionalDocuments.Deleted.IS_FALSE()),
+	).ORDER_BY(
+		table.TransactionalDocuments.ID.ASC(),
+	).Sql()
 
+	rows, err := conn(ctx).QueryContext(ctx, query, args...)
 	if err != nil {
-		log.WithError(err).Error("Could not update document")
-		return err
+		log.WithError(err).Error("Could not list the documents of a transaction")
+		return nil, err
 	}
+	defer rows.Close()
 
-	return nil
-}
+	var documents []*model.Documents
+	for rows.Next() {
+		document := &model.Documents{}
+		err = rows.Scan(&document.ID, &document.Content, &document.CollectionID, &document.Key)
+		if err != nil {
+			log.WithError(err).Error("Could not read the documents of a transaction")
+			return nil, err
+		}
 
-// DeleteTransactionalDocument deletes the transactional document is it called on.
-func DeleteTransactionalDocument(ctx context.Context, document *model.TransactionalDocuments) error {
-	query, args := table.TransactionalDocuments.
-		DELETE().
-		WHERE(table.TransactionalDocuments.ID.EQ(postgres.UUID(document.ID))).
-		RETURNING(table.TransactionalDocuments.ID).
-		Sql()
-
-	deletedID := uuid.Nil
-	err := db.QueryRowContext(ctx, query, args...).Scan(&deletedID)
-	if err != nil || deletedID == uuid.Nil {
-		log.WithError(err).Error("Could not delete document")
-		return err
+		documents = append(documents, document)
 	}
 
-	return nil
+	return documents, rows.Err()
 }
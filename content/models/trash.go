@@ -0,0 +1,431 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-jet/jet/v2/postgres"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/models/generated/content/public/table"
+	"encore.app/pagination"
+)
+
+const (
+	// DefaultTrashRetentionDays is the number of days the items of a database are kept in the trash when
+	// no retention is given.
+	DefaultTrashRetentionDays = 30
+
+	// MaxTrashRetentionDays is the maximum number of days the items of a database can be kept in the trash.
+	MaxTrashRetentionDays = 365
+)
+
+// DatabaseTrashSortKey returns the key sorting the databases in the trash by the date they were deleted.
+func DatabaseTrashSortKey() pagination.SortKey {
+	return pagination.ColumnKey("deleted_at", table.Databases.DeletedAt)
+}
+
+// CollectionTrashSortKey returns the key sorting the collections in the trash by the date they were deleted.
+func CollectionTrashSortKey() pagination.SortKey {
+	return pagination.ColumnKey("deleted_at", table.Collections.DeletedAt)
+}
+
+// DocumentTrashSortKey returns the key sorting the documents in the trash by the date they were deleted.
+func DocumentTrashSortKey() pagination.SortKey {
+	return pagination.ColumnKey("deleted_at", table.Documents.DeletedAt)
+}
+
+// trashCursor returns the cursor to the next page of a trash given the ID and deletion date of the last
+// item of the current page.
+func trashCursor(page *pagination.Page, id int64, deletedAt *time.Time) string {
+	return page.Next(id, pagination.TimestampValue(*deletedAt))
+}
+
+// ListDatabaseTrash lists a page of the databases of a user in the trash, sorted by the sort key returned by
+// DatabaseTrashSortKey. The cursor to the next page is returned if there are more databases to fetch.
+func ListDatabaseTrash(ctx context.Context, userID int64, page *pagination.Page) ([]*model.Databases, string, error) {
+	statement := postgres.SELECT(
+		table.Databases.AllColumns,
+	).FROM(table.Databases).WHERE(
+		page.Where(
+			table.Databases.UserID.EQ(postgres.Int64(userID)).
+				AND(table.Databases.DeletedAt.IS_NOT_NULL()),
+			table.Databases.ID,
+		),
+	).ORDER_BY(
+		page.OrderBy(table.Databases.ID)...,
+	).LIMIT(page.Fetch())
+
+	var databases []*model.Databases
+	err := statement.QueryContext(ctx, conn(ctx), &databases)
+	if err != nil {
+		log.WithError(err).Error("Could not query the databases in the trash")
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if page.HasNext(len(databases)) {
+		databases = databases[:page.Limit]
+
+		last := databases[len(databases)-1]
+		nextCursor = trashCursor(page, last.ID, last.DeletedAt)
+	}
+
+	return databases, nextCursor, nil
+}
+
+// GetTrashedDatabase fetches a single database in the trash given an ID and the associated user ID.
+// Returns nil on an error.
+func GetTrashedDatabase(ctx context.Context, id, userID int64) (*model.Databases, error) {
+	statement := postgres.SELECT(
+		table.Databases.AllColumns,
+	).FROM(table.Databases).WHERE(
+		table.Databases.ID.EQ(postgres.Int64(id)).
+			AND(table.Databases.UserID.EQ(postgres.Int64(userID))).
+			AND(table.Databases.DeletedAt.IS_NOT_NULL()),
+	).LIMIT(1)
+
+	database := model.Databases{}
+	err := statement.QueryContext(ctx, conn(ctx), &database)
+	if err != nil {
+		log.WithError(err).Errorf("Could not query database %d in the trash", id)
+		return nil, err
+	}
+
+	return &database, nil
+}
+
+// RestoreDatabase takes the database it is called on out of the trash, along with its collections and
+// documents as they were when it was deleted.
+func RestoreDatabase(ctx context.Context, database *model.Databases) error {
+	query, args := table.Databases.UPDATE().SET(
+		table.Databases.DeletedAt.SET(postgres.TimestampzExp(postgres.NULL)),
+	).WHERE(
+		table.Databases.ID.EQ(postgres.Int64(database.ID)).
+			AND(table.Databases.DeletedAt.IS_NOT_NULL()),
+	).RETURNING(
+		table.Databases.ID,
+	).Sql()
+
+	restoredID := 0
+	err := conn(ctx).QueryRowContext(ctx, query, args...).Scan(&restoredID)
+	if err != nil || restoredID == 0 {
+		log.WithError(err).Error("Could not restore database")
+		return err
+	}
+
+	database.DeletedAt = nil
+	return nil
+}
+
+// PurgeDatabaseTrash permanently deletes the databases of a user in the trash, along with all their
+// collections and documents. Only the database with the given ID is purged when an ID is given. Returns
+// the number of purged databases.
+func PurgeDatabaseTrash(ctx context.Context, userID, id int64) (int64, error) {
+	condition := table.Databases.UserID.EQ(postgres.Int64(userID)).
+		AND(table.Databases.DeletedAt.IS_NOT_NULL())
+	if id != 0 {
+		condition = condition.AND(table.Databases.ID.EQ(postgres.Int64(id)))
+	}
+
+	query, args := table.Databases.DELETE().WHERE(condition).Sql()
+
+	result, err := conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		log.WithError(err).Errorf("Could not purge the databases in the trash of user %d", userID)
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// ListCollectionTrash lists a page of the collections of a database in the trash, sorted by the sort key
+// returned by CollectionTrashSortKey. The cursor to the next page is returned if there are more collections
+// to fetch.
+func ListCollectionTrash(ctx context.Context, databaseID int64, page *pagination.Page) ([]*model.Collections, string, error) {
+	statement := postgres.SELECT(
+		table.Collections.AllColumns,
+	).FROM(table.Collections).WHERE(
+		page.Where(
+			table.Collections.DatabaseID.EQ(postgres.Int64(databaseID)).
+				AND(table.Collections.DeletedAt.IS_NOT_NULL()),
+			table.Collections.ID,
+		),
+	).ORDER_BY(
+		page.OrderBy(table.Collections.ID)...,
+	).LIMIT(page.Fetch())
+
+	var collections []*model.Collections
+	err := statement.QueryContext(ctx, conn(ctx), &collections)
+	if err != nil {
+		log.WithError(err).Errorf("Could not query the collections of database %d in the trash", databaseID)
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if page.HasNext(len(collections)) {
+		collections = collections[:page.Limit]
+
+		last := collections[len(collections)-1]
+		nextCursor = trashCursor(page, last.ID, last.DeletedAt)
+	}
+
+	return collections, nextCursor, nil
+}
+
+// GetTrashedCollection fetches a single collection in the trash given an ID and the user ID of its
+// database, which must not be in the trash. Returns nil on an error.
+func GetTrashedCollection(ctx context.Context, id, userID int64) (*model.Collections, error) {
+	statement := postgres.SELECT(
+		table.Collections.AllColumns,
+	).FROM(
+		table.Collections.INNER_JOIN(
+			table.Databases,
+			table.Collections.DatabaseID.EQ(table.Databases.ID),
+		),
+	).WHERE(
+		table.Collections.ID.EQ(postgres.Int64(id)).
+			AND(table.Databases.UserID.EQ(postgres.Int64(userID))).
+			AND(table.Collections.DeletedAt.IS_NOT_NULL()).
+			AND(table.Databases.DeletedAt.IS_NULL()),
+	).LIMIT(1)
+
+	collection := model.Collections{}
+	err := statement.QueryContext(ctx, conn(ctx), &collection)
+	if err != nil {
+		log.WithError(err).Errorf("Could not query collection %d in the trash", id)
+		return nil, err
+	}
+
+	return &collection, nil
+}
+
+// RestoreCollection takes the collection it is called on out of the trash, along with its documents as
+// they were when it was deleted.
+func RestoreCollection(ctx context.Context, collection *model.Collections) error {
+	query, args := table.Collections.UPDATE().SET(
+		table.Collections.DeletedAt.SET(postgres.TimestampzExp(postgres.NULL)),
+	).WHERE(
+		table.Collections.ID.EQ(postgres.Int64(collection.ID)).
+			AND(table.Collections.DeletedAt.IS_NOT_NULL()),
+	).RETURNING(
+		table.Collections.ID,
+	).Sql()
+
+	restoredID := 0
+	err := conn(ctx).QueryRowContext(ctx, query, args...).Scan(&restoredID)
+	if err != nil || restoredID == 0 {
+		log.WithError(err).Error("Could not restore collection")
+		return err
+	}
+
+	collection.DeletedAt = nil
+	return nil
+}
+
+// PurgeCollectionTrash permanently deletes the collections of a database in the trash, along with all
+// their documents. Only the collection with the given ID is purged when an ID is given. Returns the number
+// of purged collections.
+func PurgeCollectionTrash(ctx context.Context, databaseID, id int64) (int64, error) {
+	condition := table.Collections.DatabaseID.EQ(postgres.Int64(databaseID)).
+		AND(table.Collections.DeletedAt.IS_NOT_NULL())
+	if id != 0 {
+		condition = condition.AND(table.Collections.ID.EQ(postgres.Int64(id)))
+	}
+
+	query, args := table.Collections.DELETE().WHERE(condition).Sql()
+
+	result, err := conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		log.WithError(err).Errorf("Could not purge the collections of database %d in the trash", databaseID)
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// ListDocumentTrash lists a page of the documents of a collection in the trash, sorted by the sort key
+// returned by DocumentTrashSortKey. The cursor to the next page is returned if there are more documents
+// to fetch.
+func ListDocumentTrash(ctx context.Context, collectionID int64, page *pagination.Page) ([]*model.Documents, string, error) {
+	statement := postgres.SELECT(
+		table.Documents.ID,
+		table.Documents.Content,
+		table.Documents.CollectionID,
+		table.Documents.Version,
+		table.Documents.Key,
+		table.Documents.UpdatedBy,
+		table.Documents.DeletedAt,
+		table.Documents.UpdatedAt,
+		table.Documents.CreatedAt,
+	).FROM(table.Documents).WHERE(
+		page.Where(
+			table.Documents.CollectionID.EQ(postgres.Int64(collectionID)).
+				AND(table.Documents.DeletedAt.IS_NOT_NULL()),
+			table.Documents.ID,
+		),
+	).ORDER_BY(
+		page.OrderBy(table.Documents.ID)...,
+	).LIMIT(page.Fetch())
+
+	var documents []*model.Documents
+	err := statement.QueryContext(ctx, conn(ctx), &documents)
+	if err != nil {
+		log.WithError(err).Errorf("Could not query the documents of collection %d in the trash", collectionID)
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if page.HasNext(len(documents)) {
+		documents = documents[:page.Limit]
+
+		last := documents[len(documents)-1]
+		nextCursor = trashCursor(page, last.ID, last.DeletedAt)
+	}
+
+	return documents, nextCursor, nil
+}
+
+// GetTrashedDocument fetches a single document in the trash given an ID and the user ID of the database of
+// its collection, which must not be in the trash. Returns nil on an error.
+func GetTrashedDocument(ctx context.Context, id, userID int64) (*model.Documents, error) {
+	statement := postgres.SELECT(
+		table.Documents.ID,
+		table.Documents.Content,
+		table.Documents.CollectionID,
+		table.Documents.Version,
+		table.Documents.Key,
+		table.Documents.UpdatedBy,
+		table.Documents.DeletedAt,
+		table.Documents.UpdatedAt,
+		table.Documents.CreatedAt,
+	).FROM(
+		table.Documents.INNER_JOIN(
+			table.Collections,
+			table.Documents.CollectionID.EQ(table.Collections.ID),
+		).INNER_JOIN(
+			table.Databases,
+			table.Collections.DatabaseID.EQ(table.Databases.ID),
+		),
+	).WHERE(
+		table.Documents.ID.EQ(postgres.Int64(id)).
+			AND(table.Databases.UserID.EQ(postgres.Int64(userID))).
+			AND(table.Documents.DeletedAt.IS_NOT_NULL()).
+			AND(table.Collections.DeletedAt.IS_NULL()).
+			AND(table.Databases.DeletedAt.IS_NULL()),
+	).LIMIT(1)
+
+	document := model.Documents{}
+	err := statement.QueryContext(ctx, conn(ctx), &document)
+	if err != nil {
+		log.WithError(err).Errorf("Could not query document %d in the trash", id)
+		return nil, err
+	}
+
+	return &document, nil
+}
+
+// RestoreDocument takes the document it is called on out of the trash, with the content and version it had
+// when it was deleted.
+func RestoreDocument(ctx context.Context, document *model.Documents) error {
+	query, args := table.Documents.UPDATE().SET(
+		table.Documents.DeletedAt.SET(postgres.TimestampzExp(postgres.NULL)),
+	).WHERE(
+		table.Documents.ID.EQ(postgres.Int64(document.ID)).
+			AND(table.Documents.DeletedAt.IS_NOT_NULL()),
+	).RETURNING(
+		table.Documents.ID,
+	).Sql()
+
+	restoredID := 0
+	err := conn(ctx).QueryRowContext(ctx, query, args...).Scan(&restoredID)
+	if err != nil || restoredID == 0 {
+		log.WithError(err).Error("Could not restore document")
+		return err
+	}
+
+	document.DeletedAt = nil
+	return nil
+}
+
+// PurgeDocumentTrash permanently deletes the documents of a collection in the trash. Only the document with
+// the given ID is purged when an ID is given. Returns the number of purged documents.
+func PurgeDocumentTrash(ctx context.Context, collectionID, id int64) (int64, error) {
+	condition := table.Documents.CollectionID.EQ(postgres.Int64(collectionID)).
+		AND(table.Documents.DeletedAt.IS_NOT_NULL())
+	if id != 0 {
+		condition = condition.AND(table.Documents.ID.EQ(postgres.Int64(id)))
+	}
+
+	query, args := table.Documents.DELETE().WHERE(condition).Sql()
+
+	result, err := conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		log.WithError(err).Errorf("Could not purge the documents of collection %d in the trash", collectionID)
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// trashExpired selects the items deleted longer ago than the trash retention of their database at the
+// given time.
+func trashExpired(deletedAt postgres.ColumnTimestampz, now time.Time) postgres.BoolExpression {
+	retention := postgres.INTERVAL(1, postgres.DAY).MUL(table.Databases.TrashRetentionDays)
+	return deletedAt.LT(postgres.TimestampzT(now).SUB(retention))
+}
+
+// PurgeExpiredTrash permanently deletes the databases, collections and documents that were kept in the
+// trash for longer than the trash retention of their database at the given time, along with all their
+// children. Returns the number of purged items, not counting the children purged with their parent.
+func PurgeExpiredTrash(ctx context.Context, now time.Time) (int64, error) {
+	statements := []postgres.Statement{
+		table.Databases.DELETE().WHERE(
+			trashExpired(table.Databases.DeletedAt, now),
+		),
+		table.Collections.DELETE().WHERE(
+			table.Collections.ID.IN(
+				postgres.SELECT(table.Collections.ID).
+					FROM(table.Collections.INNER_JOIN(
+						table.Databases,
+						table.Collections.DatabaseID.EQ(table.Databases.ID),
+					)).
+					WHERE(trashExpired(table.Collections.DeletedAt, now)),
+			),
+		),
+		table.Documents.DELETE().WHERE(
+			table.Documents.ID.IN(
+				postgres.SELECT(table.Documents.ID).
+					FROM(table.Documents.INNER_JOIN(
+						table.Collections,
+						table.Documents.CollectionID.EQ(table.Collections.ID),
+					).INNER_JOIN(
+						table.Databases,
+						table.Collections.DatabaseID.EQ(table.Databases.ID),
+					)).
+					WHERE(trashExpired(table.Documents.DeletedAt, now)),
+			),
+		),
+	}
+
+	var purged int64
+	for _, statement := range statements {
+		query, args := statement.Sql()
+
+		result, err := db.ExecContext(ctx, query, args...)
+		if err != nil {
+			log.WithError(err).Error("Could not purge expired trash")
+			return purged, err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return purged, err
+		}
+
+		purged += affected
+	}
+
+	return purged, nil
+}
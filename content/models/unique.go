@@ -0,0 +1,131 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-jet/jet/v2/postgres"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/models/generated/content/public/table"
+	"encore.app/content/query"
+)
+
+// uniqueViolationCode is the SQLSTATE of postgres for a unique violation.
+const uniqueViolationCode = "23505"
+
+// DuplicateDocuments is a group of documents with the same values at the paths of a unique index.
+type DuplicateDocuments struct {
+	// The values shared by the documents, one for each path of the index
+	Values json.RawMessage
+
+	// The IDs of the documents sharing the values, sorted
+	DocumentIDs []int64
+}
+
+// IsUniqueViolation returns whether an error returned by a query is a violation of a unique index,
+// whatever the postgres driver.
+func IsUniqueViolation(err error) bool {
+	var stateErr interface{ SQLState() string }
+	return errors.As(err, &stateErr) && stateErr.SQLState() == uniqueViolationCode
+}
+
+// FindUniqueConflict finds a document of the collection of a unique index, other than the document
+// with the given ID, with the same values as the content at the paths of the index. It returns 0 when
+// there is none, like when the content has no value at one of the paths. Documents in the trash are
+// ignored. In a transaction, the documents of the transaction are searched.
+func FindUniqueConflict(ctx context.Context, index *model.CollectionIndexes, documentID int64, content string) (int64, error) {
+	paths, err := IndexPaths(index)
+	if err != nil {
+		log.WithError(err).Errorf("Could not read the paths of index %d", index.ID)
+		return 0, err
+	}
+
+	condition := table.Documents.CollectionID.EQ(postgres.Int64(index.CollectionID)).
+		AND(table.Documents.ID.NOT_EQ(postgres.Int64(documentID))).
+		AND(table.Documents.DeletedAt.IS_NULL())
+
+	for _, path := range paths {
+		// Postgres indexes ignore rows with a NULL value, like the ones missing a path
+		value, ok := path.Find(json.RawMessage(content))
+		if !ok {
+			return 0, nil
+		}
+
+		condition = condition.AND(path.Extract(table.Documents.Content).EQ(query.JSONB(value)))
+	}
+
+	statement := postgres.SELECT(
+		table.Documents.ID,
+	).FROM(documentsTable(ctx)).WHERE(
+		condition,
+	).ORDER_BY(
+		table.Documents.ID.ASC(),
+	).LIMIT(1)
+
+	var conflictID int64
+	err = queryRowOverlay(ctx, statement).Scan(&conflictID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	} else if err != nil {
+		log.WithError(err).Errorf("Could not search conflicts on index %d", index.ID)
+		return 0, err
+	}
+
+	return conflictID, nil
+}
+
+// FindDuplicateDocuments finds the groups of committed documents of the collection of an index with the
+// same values at the paths of the index, which prevent a unique index from being built. Documents in the
+// trash are ignored. At most limit groups are returned.
+func FindDuplicateDocuments(ctx context.Context, index *model.CollectionIndexes, limit int) ([]DuplicateDocuments, error) {
+	paths, err := IndexPaths(index)
+	if err != nil {
+		log.WithError(err).Errorf("Could not read the paths of index %d", index.ID)
+		return nil, err
+	}
+
+	expressions := indexExpressions(paths)
+	conditions := make([]string, len(expressions))
+	for i, expression := range expressions {
+		conditions[i] = expression + " IS NOT NULL"
+	}
+
+	statement := fmt.Sprintf(
+		"SELECT jsonb_build_array(%[1]s), jsonb_agg(id ORDER BY id) FROM documents WHERE collection_id = $1 AND deleted_at IS NULL AND %[2]s GROUP BY %[1]s HAVING COUNT(*) > 1 ORDER BY MIN(id) LIMIT $2",
+		strings.Join(expressions, ", "),
+		strings.Join(conditions, " AND "),
+	)
+
+	rows, err := conn(ctx).QueryContext(ctx, statement, index.CollectionID, limit)
+	if err != nil {
+		log.WithError(err).Errorf("Could not search duplicates for index %d", index.ID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var duplicates []DuplicateDocuments
+	for rows.Next() {
+		var values, ids string
+		err = rows.Scan(&values, &ids)
+		if err != nil {
+			log.WithError(err).Error("Could not scan duplicate documents")
+			return nil, err
+		}
+
+		duplicate := DuplicateDocuments{Values: json.RawMessage(values)}
+		err = json.Unmarshal([]byte(ids), &duplicate.DocumentIDs)
+		if err != nil {
+			return nil, err
+		}
+
+		duplicates = append(duplicates, duplicate)
+	}
+
+	return duplicates, rows.Err()
+}
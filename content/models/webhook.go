@@ -0,0 +1,208 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/go-jet/jet/v2/postgres"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/models/generated/content/public/table"
+)
+
+// WebhookOperations are the operations on the documents a webhook can receive the changes of.
+var WebhookOperations = []string{"insert", "update", "delete"}
+
+// NewWebhook generates a new webhook structure receiving the changes made to the documents of a database, or
+// of one of its collections when a collection ID is given, after the change at the given position.
+func NewWebhook(databaseID int64, collectionID *int64, url string, events []string, filter *string, secret string, last ChangePosition) *model.Webhooks {
+	raw, _ := json.Marshal(events)
+
+	return &model.Webhooks{
+		DatabaseID:        databaseID,
+		CollectionID:      collectionID,
+		URL:               url,
+		Events:            string(raw),
+		Filter:            filter,
+		Secret:            secret,
+		Active:            true,
+		LastSequence:      last.Sequence,
+		LastTransactionID: last.TransactionID,
+	}
+}
+
+// WebhookEvents returns the operations on the documents a webhook receives the changes of.
+func WebhookEvents(webhook *model.Webhooks) ([]string, error) {
+	var events []string
+	err := json.Unmarshal([]byte(webhook.Events), &events)
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// webhooksCondition selects the webhooks of the databases that are not in the trash, of a user when a user ID
+// is given.
+func webhooksCondition(userID int64) postgres.BoolExpression {
+	condition := table.Databases.DeletedAt.IS_NULL().
+		AND(table.Collections.DeletedAt.IS_NULL())
+	if userID != 0 {
+		condition = condition.AND(table.Databases.UserID.EQ(postgres.Int64(userID)))
+	}
+
+	return condition
+}
+
+// webhooksFrom joins the webhooks with their database and collection, to only select the webhooks of the
+// databases and collections that are not in the trash.
+func webhooksFrom() postgres.ReadableTable {
+	return table.Webhooks.
+		INNER_JOIN(table.Databases, table.Databases.ID.EQ(table.Webhooks.DatabaseID)).
+		LEFT_JOIN(table.Collections, table.Collections.ID.EQ(table.Webhooks.CollectionID))
+}
+
+// ListWebhooks lists all the webhooks of a database, including the ones of its collections, sorted by ID.
+func ListWebhooks(ctx context.Context, databaseID int64) ([]*model.Webhooks, error) {
+	statement := postgres.SELECT(
+		table.Webhooks.AllColumns,
+	).FROM(webhooksFrom()).WHERE(
+		webhooksCondition(0).
+			AND(table.Webhooks.DatabaseID.EQ(postgres.Int64(databaseID))),
+	).ORDER_BY(
+		table.Webhooks.ID.ASC(),
+	)
+
+	var webhooks []*model.Webhooks
+	err := statement.QueryContext(ctx, conn(ctx), &webhooks)
+	if err != nil {
+		log.WithError(err).Errorf("Could not query the webhooks of database %d", databaseID)
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// ListActiveWebhooks lists all the active webhooks of the databases and collections that are not in the trash,
+// sorted by ID.
+func ListActiveWebhooks(ctx context.Context) ([]*model.Webhooks, error) {
+	statement := postgres.SELECT(
+		table.Webhooks.AllColumns,
+	).FROM(webhooksFrom()).WHERE(
+		webhooksCondition(0).
+			AND(table.Webhooks.Active.IS_TRUE()),
+	).ORDER_BY(
+		table.Webhooks.ID.ASC(),
+	)
+
+	var webhooks []*model.Webhooks
+	err := statement.QueryContext(ctx, conn(ctx), &webhooks)
+	if err != nil {
+		log.WithError(err).Error("Could not query the active webhooks")
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// GetWebhookByID fetches a single webhook given an ID and the associated user ID, all the users when the
+// user ID is 0. Returns nil on an error.
+func GetWebhookByID(ctx context.Context, id, userID int64) (*model.Webhooks, error) {
+	statement := postgres.SELECT(
+		table.Webhooks.AllColumns,
+	).FROM(webhooksFrom()).WHERE(
+		webhooksCondition(userID).
+			AND(table.Webhooks.ID.EQ(postgres.Int64(id))),
+	).LIMIT(1)
+
+	webhook := model.Webhooks{}
+	err := statement.QueryContext(ctx, conn(ctx), &webhook)
+	if err != nil {
+		log.WithError(err).Errorf("Could not query webhook %d", id)
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+// SaveWebhook inserts the webhook it is called on when it has no ID, and updates its target, events, filter
+// and whether it is active otherwise. The scope, secret and last sequence of a webhook are never updated.
+func SaveWebhook(ctx context.Context, webhook *model.Webhooks) error {
+	if webhook.ID == 0 {
+		query, args := table.Webhooks.INSERT(
+			table.Webhooks.DatabaseID,
+			table.Webhooks.CollectionID,
+			table.Webhooks.URL,
+			table.Webhooks.Events,
+			table.Webhooks.Filter,
+			table.Webhooks.Secret,
+			table.Webhooks.Active,
+			table.Webhooks.LastSequence,
+			table.Webhooks.LastTransactionID,
+		).VALUES(
+			webhook.DatabaseID,
+			webhook.CollectionID,
+			webhook.URL,
+			webhook.Events,
+			webhook.Filter,
+			webhook.Secret,
+			webhook.Active,
+			webhook.LastSequence,
+			webhook.LastTransactionID,
+		).RETURNING(
+			table.Webhooks.ID,
+			table.Webhooks.UpdatedAt,
+			table.Webhooks.CreatedAt,
+		).Sql()
+
+		err := conn(ctx).
+			QueryRowContext(ctx, query, args...).
+			Scan(&webhook.ID, &webhook.UpdatedAt, &webhook.CreatedAt)
+
+		if err != nil {
+			log.WithError(err).Error("Could not insert webhook")
+			return err
+		}
+
+		return nil
+	}
+
+	query, args := table.Webhooks.UPDATE().SET(
+		table.Webhooks.URL.SET(postgres.String(webhook.URL)),
+		table.Webhooks.Events.SET(jsonValue(&webhook.Events)),
+		table.Webhooks.Filter.SET(jsonValue(webhook.Filter)),
+		table.Webhooks.Active.SET(postgres.Bool(webhook.Active)),
+		table.Webhooks.UpdatedAt.SET(postgres.TimestampzExp(postgres.NOW())),
+	).WHERE(
+		table.Webhooks.ID.EQ(postgres.Int64(webhook.ID)),
+	).RETURNING(
+		table.Webhooks.UpdatedAt,
+	).Sql()
+
+	err := conn(ctx).QueryRowContext(ctx, query, args...).Scan(&webhook.UpdatedAt)
+	if err != nil {
+		log.WithError(err).Errorf("Could not update webhook %d", webhook.ID)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteWebhook deletes a webhook given its ID, along with its deliveries.
+func DeleteWebhook(ctx context.Context, id int64) error {
+	query, args := table.Webhooks.
+		DELETE().
+		WHERE(table.Webhooks.ID.EQ(postgres.Int64(id))).
+		RETURNING(table.Webhooks.ID).
+		Sql()
+
+	deletedID := 0
+	err := conn(ctx).QueryRowContext(ctx, query, args...).Scan(&deletedID)
+	if err != nil || deletedID == 0 {
+		log.WithError(err).Errorf("Could not delete webhook %d", id)
+		return err
+	}
+
+	return nil
+}
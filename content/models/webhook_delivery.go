@@ -0,0 +1,254 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-jet/jet/v2/postgres"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/models/generated/content/public/table"
+	"encore.app/pagination"
+)
+
+// The statuses of a webhook delivery. A delivery is pending until it is delivered, or until all its attempts
+// failed.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// NewWebhookDelivery generates a new pending delivery of a change made to a document to a webhook, with the
+// payload to send in JSON.
+func NewWebhookDelivery(webhookID, sequence int64, event, payload string) *model.WebhookDeliveries {
+	return &model.WebhookDeliveries{
+		WebhookID: webhookID,
+		Sequence:  sequence,
+		Event:     event,
+		Payload:   payload,
+		Status:    WebhookDeliveryPending,
+	}
+}
+
+// WebhookDeliverySortKey returns the key sorting the deliveries of a webhook by the date they were queued.
+func WebhookDeliverySortKey() pagination.SortKey {
+	return pagination.ColumnKey("created_at", table.WebhookDeliveries.CreatedAt)
+}
+
+// EnqueueWebhookDeliveries queues the deliveries to a webhook and moves the position of the last change read for
+// the webhook to the given position, in a single SQL transaction. Deliveries of changes already queued for the webhook are
+// ignored.
+func EnqueueWebhookDeliveries(ctx context.Context, webhook *model.Webhooks, deliveries []*model.WebhookDeliveries, last ChangePosition) error {
+	return RunInSQLTransaction(ctx, func(ctx context.Context) error {
+		if len(deliveries) > 0 {
+			statement := table.WebhookDeliveries.INSERT(
+				table.WebhookDeliveries.WebhookID,
+				table.WebhookDeliveries.Sequence,
+				table.WebhookDeliveries.Event,
+				table.WebhookDeliveries.Payload,
+				table.WebhookDeliveries.Status,
+			)
+			for _, delivery := range deliveries {
+				statement = statement.VALUES(
+					delivery.WebhookID,
+					delivery.Sequence,
+					delivery.Event,
+					delivery.Payload,
+					delivery.Status,
+				)
+			}
+
+			query, args := statement.ON_CONFLICT(
+				table.WebhookDeliveries.WebhookID,
+				table.WebhookDeliveries.Sequence,
+			).DO_NOTHING().Sql()
+
+			_, err := conn(ctx).ExecContext(ctx, query, args...)
+			if err != nil {
+				log.WithError(err).Errorf("Could not queue the deliveries of webhook %d", webhook.ID)
+				return err
+			}
+		}
+
+		query, args := table.Webhooks.UPDATE().SET(
+			table.Webhooks.LastTransactionID.SET(postgres.Int64(last.TransactionID)),
+			table.Webhooks.LastSequence.SET(postgres.Int64(last.Sequence)),
+		).WHERE(
+			table.Webhooks.ID.EQ(postgres.Int64(webhook.ID)).
+				AND(table.Webhooks.LastTransactionID.LT(postgres.Int64(last.TransactionID)).OR(
+					table.Webhooks.LastTransactionID.EQ(postgres.Int64(last.TransactionID)).
+						AND(table.Webhooks.LastSequence.LT(postgres.Int64(last.Sequence))),
+				)),
+		).Sql()
+
+		_, err := conn(ctx).ExecContext(ctx, query, args...)
+		if err != nil {
+			log.WithError(err).Errorf("Could not move the last change read for webhook %d", webhook.ID)
+			return err
+		}
+
+		webhook.LastTransactionID = last.TransactionID
+		webhook.LastSequence = last.Sequence
+		return nil
+	})
+}
+
+// ClaimWebhookDeliveries claims at most limit pending deliveries that are due, of the active webhooks of the
+// databases and collections that are not in the trash, by moving their next attempt after the lease. Deliveries
+// claimed by another caller are skipped, so that a delivery is attempted once at a time. A delivery whose attempt
+// is never saved is attempted again once its lease is over.
+func ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int64) ([]*model.WebhookDeliveries, error) {
+	active := postgres.SELECT(
+		table.Webhooks.ID,
+	).FROM(webhooksFrom()).WHERE(
+		webhooksCondition(0).
+			AND(table.Webhooks.Active.IS_TRUE()),
+	)
+
+	due := postgres.SELECT(
+		table.WebhookDeliveries.ID,
+	).FROM(table.WebhookDeliveries).WHERE(
+		table.WebhookDeliveries.Status.EQ(postgres.String(WebhookDeliveryPending)).
+			AND(table.WebhookDeliveries.NextAttemptAt.LT_EQ(postgres.TimestampzT(now))).
+			AND(table.WebhookDeliveries.WebhookID.IN(active)),
+	).ORDER_BY(
+		table.WebhookDeliveries.NextAttemptAt.ASC(),
+	).LIMIT(limit).FOR(
+		postgres.UPDATE().SKIP_LOCKED(),
+	)
+
+	statement := table.WebhookDeliveries.UPDATE().SET(
+		table.WebhookDeliveries.NextAttemptAt.SET(postgres.TimestampzT(now.Add(lease))),
+	).WHERE(
+		table.WebhookDeliveries.ID.IN(due),
+	).RETURNING(
+		table.WebhookDeliveries.AllColumns,
+	)
+
+	var deliveries []*model.WebhookDeliveries
+	err := statement.QueryContext(ctx, conn(ctx), &deliveries)
+	if err != nil {
+		log.WithError(err).Error("Could not claim the due webhook deliveries")
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// SaveWebhookDeliveryAttempt saves the outcome of the last attempt of the delivery it is called on: its status,
+// number of attempts, next attempt, and the response or error of the attempt.
+func SaveWebhookDeliveryAttempt(ctx context.Context, delivery *model.WebhookDeliveries) error {
+	responseStatus := postgres.IntExp(postgres.NULL)
+	if delivery.ResponseStatus != nil {
+		responseStatus = postgres.Int32(*delivery.ResponseStatus)
+	}
+
+	deliveredAt := postgres.TimestampzExp(postgres.NULL)
+	if delivery.DeliveredAt != nil {
+		deliveredAt = postgres.TimestampzT(*delivery.DeliveredAt)
+	}
+
+	query, args := table.WebhookDeliveries.UPDATE().SET(
+		table.WebhookDeliveries.Status.SET(postgres.String(delivery.Status)),
+		table.WebhookDeliveries.Attempts.SET(postgres.Int32(delivery.Attempts)),
+		table.WebhookDeliveries.NextAttemptAt.SET(postgres.TimestampzT(delivery.NextAttemptAt)),
+		table.WebhookDeliveries.ResponseStatus.SET(responseStatus),
+		table.WebhookDeliveries.Error.SET(nullableString(delivery.Error)),
+		table.WebhookDeliveries.DeliveredAt.SET(deliveredAt),
+		table.WebhookDeliveries.UpdatedAt.SET(postgres.TimestampzExp(postgres.NOW())),
+	).WHERE(
+		table.WebhookDeliveries.ID.EQ(postgres.Int64(delivery.ID)),
+	).RETURNING(
+		table.WebhookDeliveries.UpdatedAt,
+	).Sql()
+
+	err := conn(ctx).QueryRowContext(ctx, query, args...).Scan(&delivery.UpdatedAt)
+	if err != nil {
+		log.WithError(err).Errorf("Could not save the attempt of webhook delivery %d", delivery.ID)
+		return err
+	}
+
+	return nil
+}
+
+// ListWebhookDeliveries lists a page of the deliveries of a webhook, only the ones with the given status when
+// one is given, sorted by the sort key returned by WebhookDeliverySortKey. The cursor to the next page is
+// returned if there are more deliveries to fetch.
+func ListWebhookDeliveries(ctx context.Context, webhookID int64, status string, page *pagination.Page) ([]*model.WebhookDeliveries, string, error) {
+	condition := table.WebhookDeliveries.WebhookID.EQ(postgres.Int64(webhookID))
+	if status != "" {
+		condition = condition.AND(table.WebhookDeliveries.Status.EQ(postgres.String(status)))
+	}
+
+	statement := postgres.SELECT(
+		table.WebhookDeliveries.AllColumns,
+	).FROM(table.WebhookDeliveries).WHERE(
+		page.Where(condition, table.WebhookDeliveries.ID),
+	).ORDER_BY(
+		page.OrderBy(table.WebhookDeliveries.ID)...,
+	).LIMIT(page.Fetch())
+
+	var deliveries []*model.WebhookDeliveries
+	err := statement.QueryContext(ctx, conn(ctx), &deliveries)
+	if err != nil {
+		log.WithError(err).Errorf("Could not query the deliveries of webhook %d", webhookID)
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if page.HasNext(len(deliveries)) {
+		deliveries = deliveries[:page.Limit]
+
+		last := deliveries[len(deliveries)-1]
+		nextCursor = page.Next(last.ID, pagination.TimestampValue(last.CreatedAt))
+	}
+
+	return deliveries, nextCursor, nil
+}
+
+// GetWebhookDelivery fetches a single delivery of a webhook given its ID. Returns nil on an error.
+func GetWebhookDelivery(ctx context.Context, id, webhookID int64) (*model.WebhookDeliveries, error) {
+	statement := postgres.SELECT(
+		table.WebhookDeliveries.AllColumns,
+	).FROM(table.WebhookDeliveries).WHERE(
+		table.WebhookDeliveries.ID.EQ(postgres.Int64(id)).
+			AND(table.WebhookDeliveries.WebhookID.EQ(postgres.Int64(webhookID))),
+	).LIMIT(1)
+
+	delivery := model.WebhookDeliveries{}
+	err := statement.QueryContext(ctx, conn(ctx), &delivery)
+	if err != nil {
+		log.WithError(err).Errorf("Could not query webhook delivery %d", id)
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+// ReplayWebhookDelivery queues the delivery it is called on again, as a pending delivery due now with no
+// attempts, whatever its status.
+func ReplayWebhookDelivery(ctx context.Context, delivery *model.WebhookDeliveries) error {
+	statement := table.WebhookDeliveries.UPDATE().SET(
+		table.WebhookDeliveries.Status.SET(postgres.String(WebhookDeliveryPending)),
+		table.WebhookDeliveries.Attempts.SET(postgres.Int32(0)),
+		table.WebhookDeliveries.NextAttemptAt.SET(postgres.TimestampzExp(postgres.NOW())),
+		table.WebhookDeliveries.ResponseStatus.SET(postgres.IntExp(postgres.NULL)),
+		table.WebhookDeliveries.Error.SET(postgres.StringExp(postgres.NULL)),
+		table.WebhookDeliveries.DeliveredAt.SET(postgres.TimestampzExp(postgres.NULL)),
+		table.WebhookDeliveries.UpdatedAt.SET(postgres.TimestampzExp(postgres.NOW())),
+	).WHERE(
+		table.WebhookDeliveries.ID.EQ(postgres.Int64(delivery.ID)),
+	).RETURNING(
+		table.WebhookDeliveries.AllColumns,
+	)
+
+	err := statement.QueryContext(ctx, conn(ctx), delivery)
+	if err != nil {
+		log.WithError(err).Errorf("Could not replay webhook delivery %d", delivery.ID)
+		return err
+	}
+
+	return nil
+}
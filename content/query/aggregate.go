@@ -0,0 +1,263 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-jet/jet/v2/postgres"
+)
+
+// accumulatorOperators maps the accumulators accepted by ParseAggregation to the SQL computing them on a
+// group, given the expression extracting the value at the path of the accumulator as jsonb.
+var accumulatorOperators = map[string]func(value string) string{
+	"$count": func(string) string {
+		return "COUNT(*)"
+	},
+	"$sum": func(value string) string {
+		return fmt.Sprintf("COALESCE(SUM(%s), 0)", numericValue(value))
+	},
+	"$avg": func(value string) string {
+		return fmt.Sprintf("AVG(%s)", numericValue(value))
+	},
+	"$min": func(value string) string {
+		return fmt.Sprintf("(array_agg(%[1]s ORDER BY %[1]s ASC) FILTER (WHERE jsonb_typeof(%[1]s) <> 'null'))[1]", value)
+	},
+	"$max": func(value string) string {
+		return fmt.Sprintf("(array_agg(%[1]s ORDER BY %[1]s DESC) FILTER (WHERE jsonb_typeof(%[1]s) <> 'null'))[1]", value)
+	},
+	"$distinct": func(value string) string {
+		return fmt.Sprintf("COALESCE(jsonb_agg(DISTINCT %[1]s ORDER BY %[1]s) FILTER (WHERE %[1]s IS NOT NULL), '[]'::jsonb)", value)
+	},
+}
+
+// Aggregation is a parsed aggregation of documents, grouping them by the values at some paths of their
+// content and computing accumulators on each group. It is compiled to a single SQL query.
+type Aggregation struct {
+	groupBy      []Path
+	accumulators []accumulator
+}
+
+// accumulator is a value computed on each group of an aggregation.
+type accumulator struct {
+	name     string
+	operator string
+	path     Path
+}
+
+// ParseGroupBy parses the dot separated paths to group documents by. It returns an *Error pointing to
+// the invalid path when not valid.
+func ParseGroupBy(paths []string) ([]Path, error) {
+	groupBy := make([]Path, len(paths))
+	for i, raw := range paths {
+		pointer := fmt.Sprintf("/%d", i)
+
+		path, err := ParsePath(raw)
+		if err != nil {
+			return nil, newError(pointer, err.Error())
+		}
+
+		for _, previous := range groupBy[:i] {
+			if previous.String() == path.String() {
+				return nil, newError(pointer, "path `%s` is already grouped by", path)
+			}
+		}
+
+		groupBy[i] = path
+	}
+
+	return groupBy, nil
+}
+
+// ParseAggregation parses the accumulators computed on each group of documents, like
+// `{"total": {"$sum": "amount"}, "orders": {"$count": {}}}`, and returns the aggregation grouping
+// documents by the given paths. Each accumulator is named by its key in the result:
+//
+//   - `$count` counts the documents of the group and expects an empty object
+//   - `$sum` and `$avg` sum and average the numbers at a path, other values are ignored
+//   - `$min` and `$max` find the lowest and greatest values at a path, in the order of jsonb values
+//   - `$distinct` lists the distinct values at a path, sorted
+//
+// Without paths to group by, the accumulators are computed on all the documents. It returns an *Error
+// pointing to the invalid accumulator when not valid.
+func ParseAggregation(groupBy []Path, raw json.RawMessage) (*Aggregation, error) {
+	aggregation := &Aggregation{groupBy: groupBy}
+	if isEmpty(raw) {
+		if len(groupBy) == 0 {
+			return nil, newError("", "expected at least one accumulator or one path to group by")
+		}
+
+		return aggregation, nil
+	}
+
+	fields, err := parseObject("", raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 0 && len(groupBy) == 0 {
+		return nil, newError("", "expected at least one accumulator or one path to group by")
+	}
+
+	for _, name := range sortedKeys(fields) {
+		pointer := appendPointer("", name)
+
+		if name == "" || strings.HasPrefix(name, "$") {
+			return nil, newError(pointer, "accumulator names cannot be empty or start with `$`")
+		}
+
+		for _, path := range groupBy {
+			if path.String() == name {
+				return nil, newError(pointer, "name `%s` is already used by a path to group by", name)
+			}
+		}
+
+		accumulator, err := parseAccumulator(pointer, name, fields[name])
+		if err != nil {
+			return nil, err
+		}
+
+		aggregation.accumulators = append(aggregation.accumulators, accumulator)
+	}
+
+	return aggregation, nil
+}
+
+func parseAccumulator(pointer, name string, raw json.RawMessage) (accumulator, error) {
+	fields, err := parseObject(pointer, raw)
+	if err != nil {
+		return accumulator{}, err
+	}
+
+	if len(fields) != 1 {
+		return accumulator{}, newError(pointer, "expected a single accumulator operator")
+	}
+
+	operator := sortedKeys(fields)[0]
+	operatorPointer := appendPointer(pointer, operator)
+	if _, ok := accumulatorOperators[operator]; !ok {
+		return accumulator{}, newError(operatorPointer, "unknown accumulator `%s`", operator)
+	}
+
+	if operator == "$count" {
+		count, err := parseObject(operatorPointer, fields[operator])
+		if err != nil || len(count) > 0 {
+			return accumulator{}, newError(operatorPointer, "`$count` expects an empty object")
+		}
+
+		return accumulator{name: name, operator: operator}, nil
+	}
+
+	var rawPath string
+	if json.Unmarshal(fields[operator], &rawPath) != nil {
+		return accumulator{}, newError(operatorPointer, "`%s` expects a path", operator)
+	}
+
+	path, err := ParsePath(rawPath)
+	if err != nil {
+		return accumulator{}, newError(operatorPointer, err.Error())
+	}
+
+	return accumulator{name: name, operator: operator, path: path}, nil
+}
+
+// Result returns the expression building the result of a group as a JSON object, with the values of
+// the paths the documents are grouped by and of each accumulator, by name.
+func (a *Aggregation) Result(column postgres.Column) postgres.StringExpression {
+	values := make([]string, 0, 2*(len(a.groupBy)+len(a.accumulators)))
+	for _, path := range a.groupBy {
+		values = append(values, quoteLiteral(path.String()), groupValue(column, path))
+	}
+
+	for _, accumulator := range a.accumulators {
+		values = append(values, quoteLiteral(accumulator.name), accumulator.expression(column))
+	}
+
+	return postgres.StringExp(postgres.Raw(fmt.Sprintf("jsonb_build_object(%s)", strings.Join(values, ", "))))
+}
+
+// GroupBy returns the expression listing the values to group the documents by, nil when the accumulators
+// are computed on all the documents. jet cannot build a list of group by clauses outside of its package, the
+// values are joined in a single expression.
+func (a *Aggregation) GroupBy(column postgres.Column) postgres.Expression {
+	if len(a.groupBy) == 0 {
+		return nil
+	}
+
+	values := make([]string, len(a.groupBy))
+	for i, path := range a.groupBy {
+		values[i] = groupValue(column, path)
+	}
+
+	return postgres.Raw(strings.Join(values, ", "))
+}
+
+// OrderBy returns the ordering of the groups by the given name, either a path the documents are grouped
+// by or the name of an accumulator. Groups are sorted by the paths they are grouped by when no name is
+// given, or when the sorted values are equal.
+func (a *Aggregation) OrderBy(column postgres.Column, sortBy string, descending bool) ([]postgres.OrderByClause, error) {
+	var clauses []postgres.OrderByClause
+	if sortBy != "" {
+		expression := a.sortExpression(column, sortBy)
+		if expression == "" {
+			return nil, fmt.Errorf("groups can only be sorted by a path they are grouped by or the name of an accumulator, got `%s`", sortBy)
+		}
+
+		clauses = append(clauses, orderBy(postgres.Raw(expression), descending))
+	}
+
+	for _, path := range a.groupBy {
+		clauses = append(clauses, orderBy(postgres.Raw(groupValue(column, path)), descending && sortBy == ""))
+	}
+
+	return clauses, nil
+}
+
+func (a *Aggregation) sortExpression(column postgres.Column, name string) string {
+	for _, path := range a.groupBy {
+		if path.String() == name {
+			return groupValue(column, path)
+		}
+	}
+
+	for _, accumulator := range a.accumulators {
+		if accumulator.name == name {
+			return accumulator.expression(column)
+		}
+	}
+
+	return ""
+}
+
+func (a accumulator) expression(column postgres.Column) string {
+	value := ""
+	if a.path != nil {
+		value = fmt.Sprintf("%s #> %s", columnName(column), a.path.Literal())
+	}
+
+	return accumulatorOperators[a.operator](value)
+}
+
+// groupValue returns the SQL of the value at a path the documents are grouped by. Missing values are
+// grouped with JSON nulls.
+func groupValue(column postgres.Column, path Path) string {
+	return fmt.Sprintf("COALESCE(%s #> %s, 'null'::jsonb)", columnName(column), path.Literal())
+}
+
+// numericValue returns the SQL converting a jsonb value to a number, NULL when not a number.
+func numericValue(value string) string {
+	return fmt.Sprintf("CASE WHEN jsonb_typeof(%[1]s) = 'number' THEN (%[1]s #>> '{}')::numeric END", value)
+}
+
+// quoteLiteral quotes a string as an SQL string literal.
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+func orderBy(expression postgres.Expression, descending bool) postgres.OrderByClause {
+	if descending {
+		return expression.DESC()
+	}
+
+	return expression.ASC()
+}
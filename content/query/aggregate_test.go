@@ -0,0 +1,144 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-jet/jet/v2/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"encore.app/content/models/generated/content/public/table"
+)
+
+func TestParseGroupBy(t *testing.T) {
+	paths, err := ParseGroupBy([]string{"status", "customer.id"})
+	require.NoError(t, err)
+	assert.Equal(t, []Path{{"status"}, {"customer", "id"}}, paths)
+
+	_, err = ParseGroupBy([]string{"status", "customer..id"})
+	assert.Equal(t, &Error{Pointer: "/1", Reason: "path `customer..id` contains an empty segment"}, err)
+
+	_, err = ParseGroupBy([]string{"status", "status"})
+	assert.Equal(t, &Error{Pointer: "/1", Reason: "path `status` is already grouped by"}, err)
+}
+
+func TestParseAggregation(t *testing.T) {
+	type expected struct {
+		query string
+		err   *Error
+	}
+
+	tcs := []struct {
+		scenario     string
+		groupBy      []Path
+		accumulators json.RawMessage
+		sortBy       string
+		descending   bool
+		expected     expected
+	}{
+		{
+			scenario:     "Groups the documents by the values at the paths",
+			groupBy:      []Path{{"status"}},
+			accumulators: json.RawMessage(`{"orders": {"$count": {}}}`),
+			expected: expected{
+				query: `
+SELECT jsonb_build_object('status', COALESCE(documents.content #> '{"status"}', 'null'::jsonb), 'orders', COUNT(*))
+FROM public.documents
+GROUP BY COALESCE(documents.content #> '{"status"}', 'null'::jsonb)
+ORDER BY COALESCE(documents.content #> '{"status"}', 'null'::jsonb) ASC;
+`,
+			},
+		},
+		{
+			scenario:     "Sorts the groups by an accumulator",
+			groupBy:      []Path{{"customer", "id"}},
+			accumulators: json.RawMessage(`{"total": {"$sum": "amount"}}`),
+			sortBy:       "total",
+			descending:   true,
+			expected: expected{
+				query: `
+SELECT jsonb_build_object('customer.id', COALESCE(documents.content #> '{"customer","id"}', 'null'::jsonb), 'total', COALESCE(SUM(CASE WHEN jsonb_typeof(documents.content #> '{"amount"}') = 'number' THEN (documents.content #> '{"amount"}' #>> '{}')::numeric END), 0))
+FROM public.documents
+GROUP BY COALESCE(documents.content #> '{"customer","id"}', 'null'::jsonb)
+ORDER BY COALESCE(SUM(CASE WHEN jsonb_typeof(documents.content #> '{"amount"}') = 'number' THEN (documents.content #> '{"amount"}' #>> '{}')::numeric END), 0) DESC, COALESCE(documents.content #> '{"customer","id"}', 'null'::jsonb) ASC;
+`,
+			},
+		},
+		{
+			scenario:     "Aggregates all the documents without paths to group by",
+			accumulators: json.RawMessage(`{"average": {"$avg": "amount"}, "highest": {"$max": "amount"}, "lowest": {"$min": "amount"}, "tags": {"$distinct": "tag"}}`),
+			expected: expected{
+				query: `
+SELECT jsonb_build_object('average', AVG(CASE WHEN jsonb_typeof(documents.content #> '{"amount"}') = 'number' THEN (documents.content #> '{"amount"}' #>> '{}')::numeric END), 'highest', (array_agg(documents.content #> '{"amount"}' ORDER BY documents.content #> '{"amount"}' DESC) FILTER (WHERE jsonb_typeof(documents.content #> '{"amount"}') <> 'null'))[1], 'lowest', (array_agg(documents.content #> '{"amount"}' ORDER BY documents.content #> '{"amount"}' ASC) FILTER (WHERE jsonb_typeof(documents.content #> '{"amount"}') <> 'null'))[1], 'tags', COALESCE(jsonb_agg(DISTINCT documents.content #> '{"tag"}' ORDER BY documents.content #> '{"tag"}') FILTER (WHERE documents.content #> '{"tag"}' IS NOT NULL), '[]'::jsonb))
+FROM public.documents;
+`,
+			},
+		},
+		{
+			scenario: "Fails without accumulators nor paths to group by",
+			expected: expected{
+				err: &Error{Pointer: "", Reason: "expected at least one accumulator or one path to group by"},
+			},
+		},
+		{
+			scenario:     "Fails with a pointer to an unknown accumulator",
+			accumulators: json.RawMessage(`{"total": {"$product": "amount"}}`),
+			expected: expected{
+				err: &Error{Pointer: "/total/$product", Reason: "unknown accumulator `$product`"},
+			},
+		},
+		{
+			scenario:     "Fails when an accumulator is missing its path",
+			accumulators: json.RawMessage(`{"total": {"$sum": 1}}`),
+			expected: expected{
+				err: &Error{Pointer: "/total/$sum", Reason: "`$sum` expects a path"},
+			},
+		},
+		{
+			scenario:     "Fails when an accumulator has several operators",
+			accumulators: json.RawMessage(`{"total": {"$sum": "amount", "$avg": "amount"}}`),
+			expected: expected{
+				err: &Error{Pointer: "/total", Reason: "expected a single accumulator operator"},
+			},
+		},
+		{
+			scenario:     "Fails when an accumulator is named like a path to group by",
+			groupBy:      []Path{{"status"}},
+			accumulators: json.RawMessage(`{"status": {"$count": {}}}`),
+			expected: expected{
+				err: &Error{Pointer: "/status", Reason: "name `status` is already used by a path to group by"},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			aggregation, err := ParseAggregation(tc.groupBy, tc.accumulators)
+			if tc.expected.err != nil {
+				assert.Equal(t, tc.expected.err, err)
+				assert.Nil(t, aggregation)
+				return
+			}
+
+			require.NoError(t, err)
+			orderBy, err := aggregation.OrderBy(table.Documents.Content, tc.sortBy, tc.descending)
+			require.NoError(t, err)
+
+			statement := postgres.SELECT(aggregation.Result(table.Documents.Content)).FROM(table.Documents)
+			if groupBy := aggregation.GroupBy(table.Documents.Content); groupBy != nil {
+				statement = statement.GROUP_BY(groupBy)
+			}
+
+			assert.Equal(t, tc.expected.query, statement.ORDER_BY(orderBy...).DebugSql())
+		})
+	}
+}
+
+func TestAggregationOrderBy(t *testing.T) {
+	aggregation, err := ParseAggregation([]Path{{"status"}}, json.RawMessage(`{"orders": {"$count": {}}}`))
+	require.NoError(t, err)
+
+	_, err = aggregation.OrderBy(table.Documents.Content, "amount", false)
+	assert.EqualError(t, err, "groups can only be sorted by a path they are grouped by or the name of an accumulator, got `amount`")
+}
@@ -0,0 +1,207 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// ColumnTypes are the types the cells of a CSV column can be read as.
+var ColumnTypes = []string{"string", "number", "boolean", "json"}
+
+// Column maps a column of a CSV file to a path in the content of documents.
+type Column struct {
+	// The name of the column in the header of the file
+	Name string
+
+	// The path of the value of the column in the content of documents
+	Path Path
+
+	// How the cells of the column are read, one of `string`, `number`, `boolean` or `json`
+	Type string
+}
+
+// Columns maps the columns of a CSV file to paths in the content of documents.
+type Columns []Column
+
+// ParseColumns parses the mapping of the columns of a CSV file to paths in the content of documents, from
+// a JSON array like `[{"Column": "city", "Path": "address.city", "Type": "string"}]`. The type of a column
+// defaults to `string`. A path cannot be inside the path of another column, since the value of a column
+// would replace the other.
+func ParseColumns(raw json.RawMessage) (Columns, error) {
+	var fields []struct {
+		Column string
+		Path   string
+		Type   string
+	}
+
+	err := json.Unmarshal(raw, &fields)
+	if err != nil {
+		return nil, newError("", "columns must be an array of objects with a `Column`, a `Path` and a `Type`")
+	}
+
+	if len(fields) == 0 {
+		return nil, newError("", "at least one column must be given")
+	}
+
+	columns := make(Columns, len(fields))
+	names := map[string]bool{}
+	for i, field := range fields {
+		pointer := appendPointer("", strconv.Itoa(i))
+
+		if field.Column == "" {
+			return nil, newError(appendPointer(pointer, "Column"), "the name of the column cannot be empty")
+		}
+
+		if names[field.Column] {
+			return nil, newError(appendPointer(pointer, "Column"), "column `%s` is given more than once", field.Column)
+		}
+		names[field.Column] = true
+
+		path, err := ParsePath(field.Path)
+		if err != nil {
+			return nil, newError(appendPointer(pointer, "Path"), "%s", err.Error())
+		}
+
+		columnType := field.Type
+		if columnType == "" {
+			columnType = "string"
+		}
+
+		if !isColumnType(columnType) {
+			return nil, newError(appendPointer(pointer, "Type"), "type `%s` is not one of `string`, `number`, `boolean`, `json`", columnType)
+		}
+
+		for _, other := range columns[:i] {
+			if pathContains(path, other.Path) || pathContains(other.Path, path) {
+				return nil, newError(appendPointer(pointer, "Path"), "path `%s` overlaps with the path of column `%s`", path, other.Name)
+			}
+		}
+
+		columns[i] = Column{
+			Name: field.Column,
+			Path: path,
+			Type: columnType,
+		}
+	}
+
+	return columns, nil
+}
+
+// isColumnType checks whether a type is one of the types the cells of a CSV column can be read as.
+func isColumnType(columnType string) bool {
+	for _, candidate := range ColumnTypes {
+		if candidate == columnType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pathContains checks whether a path is the given parent path or is inside it.
+func pathContains(path, parent Path) bool {
+	if len(path) < len(parent) {
+		return false
+	}
+
+	for i, segment := range parent {
+		if path[i] != segment {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Names returns the names of the columns, in order.
+func (c Columns) Names() []string {
+	names := make([]string, len(c))
+	for i, column := range c {
+		names[i] = column.Name
+	}
+
+	return names
+}
+
+// Format returns the cells of the columns for the content of a document. Strings are written as is, other
+// values as JSON, and missing or null values as empty cells.
+func (c Columns) Format(document json.RawMessage) []string {
+	cells := make([]string, len(c))
+	for i, column := range c {
+		value, ok := column.Path.Find(document)
+		if !ok {
+			continue
+		}
+
+		switch jsonType(value) {
+		case "null":
+		case "string":
+			_ = json.Unmarshal(value, &cells[i])
+		default:
+			cells[i] = string(value)
+		}
+	}
+
+	return cells
+}
+
+// Build builds the content of a document from the cells of the columns, given in the same order as the
+// columns. Each cell is read according to the type of its column, and set at its path, every segment of
+// the path being an object key. Empty cells are left out of the content.
+func (c Columns) Build(cells []string) (json.RawMessage, error) {
+	content := map[string]interface{}{}
+	for i, column := range c {
+		if i >= len(cells) || cells[i] == "" {
+			continue
+		}
+
+		value, err := column.read(cells[i])
+		if err != nil {
+			return nil, err
+		}
+
+		parent := content
+		for _, segment := range column.Path[:len(column.Path)-1] {
+			child, ok := parent[segment].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				parent[segment] = child
+			}
+
+			parent = child
+		}
+
+		parent[column.Path[len(column.Path)-1]] = value
+	}
+
+	return json.Marshal(content)
+}
+
+// read reads a cell according to the type of the column, as a JSON value.
+func (c Column) read(cell string) (json.RawMessage, error) {
+	switch c.Type {
+	case "number":
+		var number json.Number
+		if json.Unmarshal([]byte(cell), &number) != nil {
+			return nil, fmt.Errorf("column `%s` must contain a number", c.Name)
+		}
+
+		return json.RawMessage(number), nil
+	case "boolean":
+		if cell != "true" && cell != "false" {
+			return nil, fmt.Errorf("column `%s` must contain `true` or `false`", c.Name)
+		}
+
+		return json.RawMessage(cell), nil
+	case "json":
+		if !json.Valid([]byte(cell)) {
+			return nil, fmt.Errorf("column `%s` must contain a JSON value", c.Name)
+		}
+
+		return compact(json.RawMessage(cell)), nil
+	default:
+		encoded, err := json.Marshal(cell)
+		return encoded, err
+	}
+}
@@ -0,0 +1,131 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseColumns(t *testing.T) {
+	tcs := []struct {
+		scenario string
+		raw      string
+		expected Columns
+		err      string
+	}{
+		{
+			scenario: "Parses columns with a default type",
+			raw:      `[{"Column": "city", "Path": "address.city"}, {"column": "age", "path": "age", "type": "number"}]`,
+			expected: Columns{
+				{Name: "city", Path: Path{"address", "city"}, Type: "string"},
+				{Name: "age", Path: Path{"age"}, Type: "number"},
+			},
+		},
+		{
+			scenario: "Rejects an empty mapping",
+			raw:      `[]`,
+			err:      "invalid clause at `/`: at least one column must be given",
+		},
+		{
+			scenario: "Rejects a column given twice",
+			raw:      `[{"Column": "city", "Path": "city"}, {"Column": "city", "Path": "town"}]`,
+			err:      "invalid clause at `/1/Column`: column `city` is given more than once",
+		},
+		{
+			scenario: "Rejects an unknown type",
+			raw:      `[{"Column": "city", "Path": "city", "Type": "date"}]`,
+			err:      "invalid clause at `/0/Type`: type `date` is not one of `string`, `number`, `boolean`, `json`",
+		},
+		{
+			scenario: "Rejects a path inside the path of another column",
+			raw:      `[{"Column": "address", "Path": "address", "Type": "json"}, {"Column": "city", "Path": "address.city"}]`,
+			err:      "invalid clause at `/1/Path`: path `address.city` overlaps with the path of column `address`",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			columns, err := ParseColumns(json.RawMessage(tc.raw))
+			if tc.err != "" {
+				require.Error(t, err)
+				assert.Equal(t, tc.err, err.Error())
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, columns)
+		})
+	}
+}
+
+func TestColumnsFormat(t *testing.T) {
+	columns := Columns{
+		{Name: "city", Path: Path{"address", "city"}, Type: "string"},
+		{Name: "age", Path: Path{"age"}, Type: "number"},
+		{Name: "tags", Path: Path{"tags"}, Type: "json"},
+		{Name: "zip", Path: Path{"address", "zip"}, Type: "string"},
+		{Name: "active", Path: Path{"active"}, Type: "boolean"},
+	}
+
+	cells := columns.Format(json.RawMessage(`{"address": {"city": "Paris, \"FR\"", "zip": null}, "age": 42, "tags": ["a", "b"]}`))
+	assert.Equal(t, []string{`Paris, "FR"`, "42", `["a","b"]`, "", ""}, cells)
+}
+
+func TestColumnsBuild(t *testing.T) {
+	columns := Columns{
+		{Name: "city", Path: Path{"address", "city"}, Type: "string"},
+		{Name: "zip", Path: Path{"address", "zip"}, Type: "string"},
+		{Name: "age", Path: Path{"age"}, Type: "number"},
+		{Name: "active", Path: Path{"active"}, Type: "boolean"},
+		{Name: "tags", Path: Path{"tags"}, Type: "json"},
+	}
+
+	tcs := []struct {
+		scenario string
+		cells    []string
+		expected string
+		err      string
+	}{
+		{
+			scenario: "Builds nested content from typed cells",
+			cells:    []string{"Paris", "75001", "42.5", "true", `["a", "b"]`},
+			expected: `{"address": {"city": "Paris", "zip": "75001"}, "age": 42.5, "active": true, "tags": ["a", "b"]}`,
+		},
+		{
+			scenario: "Leaves out empty cells",
+			cells:    []string{"", "75001", "", "false", ""},
+			expected: `{"address": {"zip": "75001"}, "active": false}`,
+		},
+		{
+			scenario: "Rejects a cell that is not a number",
+			cells:    []string{"Paris", "", "forty", "", ""},
+			err:      "column `age` must contain a number",
+		},
+		{
+			scenario: "Rejects a cell that is not a boolean",
+			cells:    []string{"Paris", "", "", "yes", ""},
+			err:      "column `active` must contain `true` or `false`",
+		},
+		{
+			scenario: "Rejects a cell that is not JSON",
+			cells:    []string{"Paris", "", "", "", "[a"},
+			err:      "column `tags` must contain a JSON value",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			content, err := columns.Build(tc.cells)
+			if tc.err != "" {
+				require.Error(t, err)
+				assert.Equal(t, tc.err, err.Error())
+				return
+			}
+
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(content))
+		})
+	}
+}
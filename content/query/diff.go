@@ -0,0 +1,111 @@
+package query
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+)
+
+// DiffOperation is an RFC 6902 JSON Patch operation, as generated by Diff.
+type DiffOperation struct {
+	// The operation, either `add`, `remove` or `replace`
+	Op string `json:"op"`
+
+	// A JSON pointer to the changed value
+	Path string `json:"path"`
+
+	// The new value, for `add` and `replace` operations
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Diff returns the JSON Patch transforming one JSON document into another. Objects are compared field
+// by field and arrays of the same length item by item, other changed values are replaced as a whole.
+// The operations are sorted by pointer, with the removed fields before the added ones in an object.
+func Diff(from, to json.RawMessage) ([]DiffOperation, error) {
+	fromValue, err := decodeValue(from)
+	if err != nil {
+		return nil, err
+	}
+
+	toValue, err := decodeValue(to)
+	if err != nil {
+		return nil, err
+	}
+
+	operations := []DiffOperation{}
+	return diffValues(operations, "", fromValue, toValue)
+}
+
+func diffValues(operations []DiffOperation, pointer string, from, to interface{}) ([]DiffOperation, error) {
+	if jsonEqual(from, to) {
+		return operations, nil
+	}
+
+	var err error
+	switch typedFrom := from.(type) {
+	case map[string]interface{}:
+		typedTo, ok := to.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		for _, key := range sortedValueKeys(typedFrom) {
+			value, ok := typedTo[key]
+			if !ok {
+				operations = append(operations, DiffOperation{Op: "remove", Path: appendPointer(pointer, key)})
+				continue
+			}
+
+			operations, err = diffValues(operations, appendPointer(pointer, key), typedFrom[key], value)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, key := range sortedValueKeys(typedTo) {
+			if _, ok := typedFrom[key]; !ok {
+				operations, err = appendValueOperation(operations, "add", appendPointer(pointer, key), typedTo[key])
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		return operations, nil
+	case []interface{}:
+		typedTo, ok := to.([]interface{})
+		if !ok || len(typedFrom) != len(typedTo) {
+			break
+		}
+
+		for i := range typedFrom {
+			operations, err = diffValues(operations, appendPointer(pointer, strconv.Itoa(i)), typedFrom[i], typedTo[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return operations, nil
+	}
+
+	return appendValueOperation(operations, "replace", pointer, to)
+}
+
+func appendValueOperation(operations []DiffOperation, op, pointer string, value interface{}) ([]DiffOperation, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(operations, DiffOperation{Op: op, Path: pointer, Value: raw}), nil
+}
+
+func sortedValueKeys(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
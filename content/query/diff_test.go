@@ -0,0 +1,77 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	tcs := []struct {
+		scenario string
+		from     json.RawMessage
+		to       json.RawMessage
+		expected string
+	}{
+		{
+			scenario: "Returns no operations for equal documents",
+			from:     json.RawMessage(`{"a": 1.0, "b": [1, {"c": true}]}`),
+			to:       json.RawMessage(`{"b": [1, {"c": true}], "a": 1}`),
+			expected: `[]`,
+		},
+		{
+			scenario: "Compares objects field by field",
+			from:     json.RawMessage(`{"name": "Jane", "age": 30, "address": {"city": "Quebec", "zip": "G1A"}}`),
+			to:       json.RawMessage(`{"name": "Jane", "email": "jane@example.com", "address": {"city": "Montreal", "zip": "G1A"}}`),
+			expected: `[{"op":"replace","path":"/address/city","value":"Montreal"},{"op":"remove","path":"/age"},{"op":"add","path":"/email","value":"jane@example.com"}]`,
+		},
+		{
+			scenario: "Compares arrays of the same length item by item",
+			from:     json.RawMessage(`{"tags": ["a", "b", "c"]}`),
+			to:       json.RawMessage(`{"tags": ["a", "d", "c"]}`),
+			expected: `[{"op":"replace","path":"/tags/1","value":"d"}]`,
+		},
+		{
+			scenario: "Replaces arrays of different lengths",
+			from:     json.RawMessage(`{"tags": ["a", "b"]}`),
+			to:       json.RawMessage(`{"tags": ["a", "b", 12345678901234567890]}`),
+			expected: `[{"op":"replace","path":"/tags","value":["a","b",12345678901234567890]}]`,
+		},
+		{
+			scenario: "Replaces values changing type",
+			from:     json.RawMessage(`{"a": {"b": 1}, "c": null}`),
+			to:       json.RawMessage(`{"a": [1], "c": {"d": null}}`),
+			expected: `[{"op":"replace","path":"/a","value":[1]},{"op":"replace","path":"/c","value":{"d":null}}]`,
+		},
+		{
+			scenario: "Replaces the whole document when not an object",
+			from:     json.RawMessage(`{"a": 1}`),
+			to:       json.RawMessage(`"a"`),
+			expected: `[{"op":"replace","path":"","value":"a"}]`,
+		},
+		{
+			scenario: "Escapes the fields in pointers",
+			from:     json.RawMessage(`{"a/b": 1, "c~d": 2}`),
+			to:       json.RawMessage(`{"a/b": null}`),
+			expected: `[{"op":"replace","path":"/a~1b","value":null},{"op":"remove","path":"/c~0d"}]`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			operations, err := Diff(tc.from, tc.to)
+			require.NoError(t, err)
+
+			raw, err := json.Marshal(operations)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(raw))
+		})
+	}
+}
+
+func TestDiffInvalidDocument(t *testing.T) {
+	_, err := Diff(json.RawMessage(`{"a": 1}`), json.RawMessage(`{"a":`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,43 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error is returned when a query expression sent by a client is not valid. It can be used directly
+// as the details of an encore error.
+type Error struct {
+	// A JSON pointer to the invalid clause in the query expression
+	Pointer string
+
+	// A description of what is wrong with the clause
+	Reason string
+}
+
+// ErrDetails marks Error as usable in the details of an encore error.
+func (e *Error) ErrDetails() {}
+
+// Error returns the error message, including the pointer to the invalid clause.
+func (e *Error) Error() string {
+	pointer := e.Pointer
+	if pointer == "" {
+		pointer = "/"
+	}
+
+	return fmt.Sprintf("invalid clause at `%s`: %s", pointer, e.Reason)
+}
+
+func newError(pointer, format string, args ...interface{}) *Error {
+	return &Error{
+		Pointer: pointer,
+		Reason:  fmt.Sprintf(format, args...),
+	}
+}
+
+// appendPointer adds a segment to a JSON pointer, escaping it as defined in RFC 6901.
+func appendPointer(pointer, segment string) string {
+	segment = strings.ReplaceAll(segment, "~", "~0")
+	segment = strings.ReplaceAll(segment, "/", "~1")
+	return pointer + "/" + segment
+}
@@ -0,0 +1,406 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-jet/jet/v2/postgres"
+)
+
+// Filter is a parsed filter expression on the JSON content of documents. A filter is a JSON object
+// where each key is either a path to a field, like `address.city`, or one of the logical operators
+// `$and`, `$or`, and `$not`. A field is compared for equality with the given value, unless the value
+// is an object of comparison operators:
+//
+//	{"status": "active", "age": {"$gte": 18}, "$or": [{"tags": {"$in": ["a", "b"]}}, {"deleted": {"$exists": false}}]}
+//
+// The supported comparison operators are `$eq`, `$ne`, `$gt`, `$gte`, `$lt`, `$lte`, `$in`, `$nin`,
+// `$exists` and `$not`. All the keys of a filter object must match for a document to match.
+type Filter struct {
+	root node
+}
+
+type node interface {
+	condition(column postgres.Column) postgres.BoolExpression
+}
+
+// ParseFilter parses and validates a raw filter expression. It returns a nil filter when the raw
+// expression is empty or null, and an *Error pointing to the invalid clause when not valid.
+func ParseFilter(raw json.RawMessage) (*Filter, error) {
+	if isEmpty(raw) {
+		return nil, nil
+	}
+
+	root, err := parseDocument("", raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Filter{root: root}, nil
+}
+
+// Condition compiles the filter into a boolean expression on the given JSONB column. Values from the
+// filter are always sent as arguments of the query.
+func (f *Filter) Condition(column postgres.Column) postgres.BoolExpression {
+	return f.root.condition(column)
+}
+
+// Equality is a path a filter requires to be equal to a value.
+type Equality struct {
+	Path  Path
+	Value json.RawMessage
+}
+
+// Equalities returns the paths that all the documents matching the filter have equal to a value, from
+// fields compared to a value or with `$eq`, outside of `$or` and `$not`. They are sorted by path.
+func (f *Filter) Equalities() []Equality {
+	var equalities []Equality
+	collectEqualities(f.root, &equalities)
+
+	sort.SliceStable(equalities, func(i, j int) bool {
+		return equalities[i].Path.String() < equalities[j].Path.String()
+	})
+
+	return equalities
+}
+
+// ForInsert returns the update setting the paths the filter compares for equality to their value, so
+// that a document created by an upsert matches the filter. Paths already existing in the content are
+// not set. It returns nil when there is no path to set.
+func (f *Filter) ForInsert(content json.RawMessage) *Patch {
+	var operations []updateOperation
+	for _, equality := range f.Equalities() {
+		if _, ok := equality.Path.Find(content); ok {
+			continue
+		}
+
+		operations = append(operations, updateOperation{Op: "set", Path: equality.Path, Value: equality.Value})
+	}
+
+	if len(operations) == 0 {
+		return nil
+	}
+
+	return newUpdatePatch(operations)
+}
+
+func collectEqualities(n node, equalities *[]Equality) {
+	switch n := n.(type) {
+	case andNode:
+		for _, child := range n {
+			collectEqualities(child, equalities)
+		}
+	case comparisonNode:
+		if n.operator == "$eq" {
+			*equalities = append(*equalities, Equality{Path: n.path, Value: n.value})
+		}
+	}
+}
+
+func parseDocument(pointer string, raw json.RawMessage) (node, error) {
+	fields, err := parseObject(pointer, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes andNode
+	for _, key := range sortedKeys(fields) {
+		keyPointer := appendPointer(pointer, key)
+		value := fields[key]
+
+		switch key {
+		case "$and", "$or":
+			children, err := parseDocumentList(keyPointer, value)
+			if err != nil {
+				return nil, err
+			}
+
+			if key == "$and" {
+				nodes = append(nodes, andNode(children))
+			} else {
+				nodes = append(nodes, orNode(children))
+			}
+		case "$not":
+			child, err := parseDocument(keyPointer, value)
+			if err != nil {
+				return nil, err
+			}
+
+			nodes = append(nodes, notNode{child: child})
+		default:
+			if strings.HasPrefix(key, "$") {
+				return nil, newError(keyPointer, "unknown logical operator `%s`", key)
+			}
+
+			path, err := ParsePath(key)
+			if err != nil {
+				return nil, newError(keyPointer, err.Error())
+			}
+
+			child, err := parseField(keyPointer, path, value)
+			if err != nil {
+				return nil, err
+			}
+
+			nodes = append(nodes, child)
+		}
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+
+	return nodes, nil
+}
+
+func parseDocumentList(pointer string, raw json.RawMessage) ([]node, error) {
+	var list []json.RawMessage
+	if jsonType(raw) != "array" || json.Unmarshal(raw, &list) != nil {
+		return nil, newError(pointer, "expected an array of filters")
+	}
+
+	if len(list) == 0 {
+		return nil, newError(pointer, "expected at least one filter")
+	}
+
+	nodes := make([]node, len(list))
+	for i, item := range list {
+		child, err := parseDocument(fmt.Sprintf("%s/%d", pointer, i), item)
+		if err != nil {
+			return nil, err
+		}
+
+		nodes[i] = child
+	}
+
+	return nodes, nil
+}
+
+func parseField(pointer string, path Path, raw json.RawMessage) (node, error) {
+	if jsonType(raw) != "object" {
+		return comparisonNode{path: path, operator: "$eq", value: compact(raw)}, nil
+	}
+
+	operators, err := parseObject(pointer, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	operatorCount := 0
+	for key := range operators {
+		if strings.HasPrefix(key, "$") {
+			operatorCount++
+		}
+	}
+
+	if operatorCount == 0 {
+		// An object without operators is compared as a whole
+		return comparisonNode{path: path, operator: "$eq", value: compact(raw)}, nil
+	} else if operatorCount != len(operators) {
+		return nil, newError(pointer, "cannot mix operators and fields in the same object")
+	}
+
+	var nodes andNode
+	for _, operator := range sortedKeys(operators) {
+		child, err := parseOperator(appendPointer(pointer, operator), path, operator, operators[operator])
+		if err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, child)
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+
+	return nodes, nil
+}
+
+func parseOperator(pointer string, path Path, operator string, raw json.RawMessage) (node, error) {
+	switch operator {
+	case "$eq":
+		return comparisonNode{path: path, operator: operator, value: compact(raw)}, nil
+	case "$ne":
+		return notNode{child: comparisonNode{path: path, operator: "$eq", value: compact(raw)}}, nil
+	case "$gt", "$gte", "$lt", "$lte":
+		valueType := jsonType(raw)
+		if valueType != "number" && valueType != "string" {
+			return nil, newError(pointer, "`%s` can only compare numbers or strings", operator)
+		}
+
+		return comparisonNode{path: path, operator: operator, value: compact(raw)}, nil
+	case "$in", "$nin":
+		if jsonType(raw) != "array" {
+			return nil, newError(pointer, "`%s` expects an array of values", operator)
+		}
+
+		in := comparisonNode{path: path, operator: "$in", value: compact(raw)}
+		if operator == "$nin" {
+			return notNode{child: in}, nil
+		}
+
+		return in, nil
+	case "$exists":
+		var exists bool
+		if jsonType(raw) != "boolean" || json.Unmarshal(raw, &exists) != nil {
+			return nil, newError(pointer, "`$exists` expects a boolean")
+		}
+
+		if exists {
+			return existsNode{path: path}, nil
+		}
+
+		return notNode{child: existsNode{path: path}}, nil
+	case "$not":
+		if jsonType(raw) != "object" {
+			return nil, newError(pointer, "`$not` expects an object of operators")
+		}
+
+		child, err := parseField(pointer, path, raw)
+		if err != nil {
+			return nil, err
+		}
+
+		return notNode{child: child}, nil
+	}
+
+	return nil, newError(pointer, "unknown operator `%s`", operator)
+}
+
+type andNode []node
+
+func (n andNode) condition(column postgres.Column) postgres.BoolExpression {
+	if len(n) == 0 {
+		return postgres.BoolExp(postgres.Raw("TRUE"))
+	}
+
+	expression := n[0].condition(column)
+	for _, child := range n[1:] {
+		expression = expression.AND(child.condition(column))
+	}
+
+	return expression
+}
+
+type orNode []node
+
+func (n orNode) condition(column postgres.Column) postgres.BoolExpression {
+	expression := n[0].condition(column)
+	for _, child := range n[1:] {
+		expression = expression.OR(child.condition(column))
+	}
+
+	return expression
+}
+
+type notNode struct {
+	child node
+}
+
+func (n notNode) condition(column postgres.Column) postgres.BoolExpression {
+	// A comparison on a missing field is NULL, coalesce it so the negation matches those documents.
+	return postgres.NOT(postgres.BoolExp(postgres.COALESCE(
+		n.child.condition(column),
+		postgres.Raw("FALSE"),
+	)))
+}
+
+type existsNode struct {
+	path Path
+}
+
+func (n existsNode) condition(column postgres.Column) postgres.BoolExpression {
+	return n.path.Extract(column).IS_NOT_NULL()
+}
+
+type comparisonNode struct {
+	path     Path
+	operator string
+	value    json.RawMessage
+}
+
+func (n comparisonNode) condition(column postgres.Column) postgres.BoolExpression {
+	field := n.path.Extract(column)
+	value := JSONB(n.value)
+
+	switch n.operator {
+	case "$in":
+		return field.IN(postgres.SELECT(postgres.Func("jsonb_array_elements", value)))
+	case "$gt", "$gte", "$lt", "$lte":
+		// jsonb orders values of different types by type first, only compare values of the same type.
+		sameType := postgres.StringExp(postgres.Func("jsonb_typeof", field)).EQ(postgres.String(jsonType(n.value)))
+
+		switch n.operator {
+		case "$gt":
+			return sameType.AND(field.GT(value))
+		case "$gte":
+			return sameType.AND(field.GT_EQ(value))
+		case "$lt":
+			return sameType.AND(field.LT(value))
+		}
+
+		return sameType.AND(field.LT_EQ(value))
+	}
+
+	return field.EQ(value)
+}
+
+func parseObject(pointer string, raw json.RawMessage) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if jsonType(raw) != "object" || json.Unmarshal(raw, &fields) != nil {
+		return nil, newError(pointer, "expected an object")
+	}
+
+	return fields, nil
+}
+
+func sortedKeys(fields map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// jsonType returns the type of the raw JSON value using the names of postgres' jsonb_typeof.
+func jsonType(raw json.RawMessage) string {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 {
+		return ""
+	}
+
+	switch trimmed[0] {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	}
+
+	return "number"
+}
+
+func isEmpty(raw json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(raw)
+	return len(trimmed) == 0 || string(trimmed) == "null"
+}
+
+func compact(raw json.RawMessage) json.RawMessage {
+	buffer := bytes.Buffer{}
+	if err := json.Compact(&buffer, raw); err != nil {
+		return raw
+	}
+
+	return buffer.Bytes()
+}
@@ -0,0 +1,201 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-jet/jet/v2/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"encore.app/content/models/generated/content/public/table"
+)
+
+func TestParseFilter(t *testing.T) {
+	type expected struct {
+		condition string
+		args      []interface{}
+		err       *Error
+	}
+
+	tcs := []struct {
+		scenario string
+		filter   json.RawMessage
+		expected expected
+	}{
+		{
+			scenario: "Compiles an equality on a nested path",
+			filter:   json.RawMessage(`{"address.city": "Montreal"}`),
+			expected: expected{
+				condition: `(documents.content #> '{"address","city"}') = $1::jsonb`,
+				args:      []interface{}{`"Montreal"`},
+			},
+		},
+		{
+			scenario: "Compiles an object without operators as an equality",
+			filter:   json.RawMessage(`{"address": {"city": "Montreal"}}`),
+			expected: expected{
+				condition: `(documents.content #> '{"address"}') = $1::jsonb`,
+				args:      []interface{}{`{"city":"Montreal"}`},
+			},
+		},
+		{
+			scenario: "Compiles comparisons with a type guard",
+			filter:   json.RawMessage(`{"age": {"$gte": 18}}`),
+			expected: expected{
+				condition: `(jsonb_typeof((documents.content #> '{"age"}')) = $1) AND ((documents.content #> '{"age"}') >= $2::jsonb)`,
+				args:      []interface{}{"number", "18"},
+			},
+		},
+		{
+			scenario: "Compiles an in operator",
+			filter:   json.RawMessage(`{"tags": {"$in": ["a", "b"]}}`),
+			expected: expected{
+				condition: `SELECT jsonb_array_elements($1::jsonb)`,
+				args:      []interface{}{`["a","b"]`},
+			},
+		},
+		{
+			scenario: "Compiles negations so missing fields are matched",
+			filter:   json.RawMessage(`{"status": {"$ne": "deleted"}}`),
+			expected: expected{
+				condition: `NOT COALESCE(((documents.content #> '{"status"}') = $1::jsonb), (FALSE))`,
+				args:      []interface{}{`"deleted"`},
+			},
+		},
+		{
+			scenario: "Compiles an exists operator",
+			filter:   json.RawMessage(`{"deleted": {"$exists": true}}`),
+			expected: expected{
+				condition: `(documents.content #> '{"deleted"}') IS NOT NULL`,
+			},
+		},
+		{
+			scenario: "Compiles logical operators",
+			filter:   json.RawMessage(`{"$or": [{"a": 1}, {"b": 2}]}`),
+			expected: expected{
+				condition: `((documents.content #> '{"a"}') = $1::jsonb) OR ((documents.content #> '{"b"}') = $2::jsonb)`,
+				args:      []interface{}{"1", "2"},
+			},
+		},
+		{
+			scenario: "Escapes quotes in paths",
+			filter:   json.RawMessage(`{"it's": true}`),
+			expected: expected{
+				condition: `(documents.content #> '{"it''s"}') = $1::jsonb`,
+				args:      []interface{}{"true"},
+			},
+		},
+		{
+			scenario: "Keeps paths out of the query arguments",
+			filter:   json.RawMessage(`{":value": 1}`),
+			expected: expected{
+				condition: `(documents.content #> '{":value"}') = $1::jsonb`,
+				args:      []interface{}{"1"},
+			},
+		},
+		{
+			scenario: "Fails when the filter is not an object",
+			filter:   json.RawMessage(`[1, 2]`),
+			expected: expected{
+				err: &Error{Pointer: "", Reason: "expected an object"},
+			},
+		},
+		{
+			scenario: "Fails with a pointer to an unknown operator",
+			filter:   json.RawMessage(`{"$or": [{"a": 1}, {"b": {"$like": "c"}}]}`),
+			expected: expected{
+				err: &Error{Pointer: "/$or/1/b/$like", Reason: "unknown operator `$like`"},
+			},
+		},
+		{
+			scenario: "Fails when comparing a value that cannot be ordered",
+			filter:   json.RawMessage(`{"a": {"$gt": true}}`),
+			expected: expected{
+				err: &Error{Pointer: "/a/$gt", Reason: "`$gt` can only compare numbers or strings"},
+			},
+		},
+		{
+			scenario: "Fails when mixing operators and fields",
+			filter:   json.RawMessage(`{"a": {"$gt": 1, "b": 2}}`),
+			expected: expected{
+				err: &Error{Pointer: "/a", Reason: "cannot mix operators and fields in the same object"},
+			},
+		},
+		{
+			scenario: "Fails when a path is invalid",
+			filter:   json.RawMessage(`{"a..b": 1}`),
+			expected: expected{
+				err: &Error{Pointer: "/a..b", Reason: "path `a..b` contains an empty segment"},
+			},
+		},
+		{
+			scenario: "Fails when a logical operator is empty",
+			filter:   json.RawMessage(`{"$and": []}`),
+			expected: expected{
+				err: &Error{Pointer: "/$and", Reason: "expected at least one filter"},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			filter, err := ParseFilter(tc.filter)
+			if tc.expected.err != nil {
+				assert.Equal(t, tc.expected.err, err)
+				assert.Nil(t, filter)
+				return
+			}
+
+			require.NoError(t, err)
+			query, args := postgres.SELECT(table.Documents.ID).
+				FROM(table.Documents).
+				WHERE(filter.Condition(table.Documents.Content)).
+				Sql()
+
+			assert.Contains(t, query, tc.expected.condition)
+			if tc.expected.args == nil {
+				assert.Empty(t, args)
+			} else {
+				assert.Equal(t, tc.expected.args, args)
+			}
+		})
+	}
+}
+
+func TestParseFilterEmpty(t *testing.T) {
+	for _, raw := range []json.RawMessage{nil, json.RawMessage(""), json.RawMessage("null")} {
+		filter, err := ParseFilter(raw)
+		require.NoError(t, err)
+		assert.Nil(t, filter)
+	}
+}
+
+func TestFilterEqualities(t *testing.T) {
+	filter, err := ParseFilter(json.RawMessage(`{"sku": {"$eq": "A-1"}, "$and": [{"store.id": 4}], "$or": [{"a": 1}, {"b": 2}], "age": {"$gte": 18}}`))
+	require.NoError(t, err)
+
+	equalities := filter.Equalities()
+	require.Len(t, equalities, 2)
+	assert.Equal(t, Path{"sku"}, equalities[0].Path)
+	assert.JSONEq(t, `"A-1"`, string(equalities[0].Value))
+	assert.Equal(t, Path{"store", "id"}, equalities[1].Path)
+	assert.JSONEq(t, `4`, string(equalities[1].Value))
+
+	written, err := ParseFilter(json.RawMessage(`{"sku": "A-1", "store.id": {"$eq": 4}}`))
+	require.NoError(t, err)
+	assert.Equal(t, equalities, written.Equalities())
+}
+
+func TestFilterForInsert(t *testing.T) {
+	filter, err := ParseFilter(json.RawMessage(`{"sku": "A-1", "store.id": 4, "age": {"$gte": 18}}`))
+	require.NoError(t, err)
+
+	_, args := table.Documents.UPDATE(table.Documents.Content).
+		SET(filter.ForInsert(json.RawMessage(`{"store": {"id": 4}}`)).Apply(table.Documents.Content)).
+		WHERE(table.Documents.ID.EQ(postgres.Int64(1))).
+		Sql()
+
+	assert.Equal(t, []interface{}{`[{"op":"set","path":["sku"],"value":"A-1"}]`, int64(1)}, args)
+	assert.Nil(t, filter.ForInsert(json.RawMessage(`{"sku": "B-2", "store": {"id": 4}}`)))
+}
@@ -0,0 +1,154 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-jet/jet/v2/postgres"
+)
+
+// Patch is a parsed set of changes to the JSON content of a document, either an RFC 6902 JSON Patch,
+// an RFC 7396 JSON Merge Patch or a set of update operators. Patches are applied by postgres functions
+// so concurrent patches on different fields of the same document never overwrite each other.
+type Patch struct {
+	function string
+	value    json.RawMessage
+
+	// The update operators of the patch, nil for other patches
+	operations []updateOperation
+}
+
+// patchOperation is a JSON Patch operation with its pointers split into path segments, the format
+// expected by the `jsonb_patch` postgres function.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  Path            `json:"path"`
+	From  Path            `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// ParseJSONPatch parses and validates a list of JSON Patch operations like
+// `[{"op": "replace", "path": "/address/city", "value": "Montreal"}]`. It returns an *Error pointing
+// to the invalid operation when not valid.
+func ParseJSONPatch(raw json.RawMessage) (*Patch, error) {
+	var list []json.RawMessage
+	if jsonType(raw) != "array" || json.Unmarshal(raw, &list) != nil {
+		return nil, newError("", "expected an array of operations")
+	}
+
+	if len(list) == 0 {
+		return nil, newError("", "expected at least one operation")
+	}
+
+	operations := make([]patchOperation, len(list))
+	for i, item := range list {
+		operation, err := parseOperation(fmt.Sprintf("/%d", i), item)
+		if err != nil {
+			return nil, err
+		}
+
+		operations[i] = operation
+	}
+
+	value, err := json.Marshal(operations)
+	if err != nil {
+		return nil, newError("", "could not encode the operations")
+	}
+
+	return &Patch{function: "jsonb_patch", value: value}, nil
+}
+
+// ParseMergePatch parses and validates a JSON Merge Patch like `{"address": {"city": "Montreal"}}`,
+// where null values remove the matching fields from the document. A patch that is not an object
+// replaces the whole document.
+func ParseMergePatch(raw json.RawMessage) (*Patch, error) {
+	if isEmpty(raw) {
+		return nil, newError("", "expected a patch")
+	}
+
+	if !json.Valid(raw) {
+		return nil, newError("", "expected a valid JSON value")
+	}
+
+	return &Patch{function: "jsonb_merge_patch", value: compact(raw)}, nil
+}
+
+// Apply returns the expression applying the patch to the given JSONB column or expression. The expression
+// is NULL when the patch cannot be applied, for example when a `test` operation fails or when an update
+// operator does not match the type of the value at its path.
+func (p *Patch) Apply(target postgres.Expression) postgres.StringExpression {
+	return postgres.StringExp(postgres.Func(p.function, target, JSONB(p.value)))
+}
+
+func parseOperation(pointer string, raw json.RawMessage) (patchOperation, error) {
+	fields, err := parseObject(pointer, raw)
+	if err != nil {
+		return patchOperation{}, err
+	}
+
+	var op string
+	if json.Unmarshal(fields["op"], &op) != nil {
+		return patchOperation{}, newError(appendPointer(pointer, "op"), "expected the name of an operation")
+	}
+
+	operation := patchOperation{Op: op}
+	operation.Path, err = parsePointerField(pointer, fields, "path")
+	if err != nil {
+		return patchOperation{}, err
+	}
+
+	switch op {
+	case "add", "replace", "test":
+		value, ok := fields["value"]
+		if !ok {
+			return patchOperation{}, newError(pointer, "`%s` expects a value", op)
+		}
+
+		operation.Value = compact(value)
+	case "move", "copy":
+		operation.From, err = parsePointerField(pointer, fields, "from")
+		if err != nil {
+			return patchOperation{}, err
+		}
+	case "remove":
+	default:
+		return patchOperation{}, newError(appendPointer(pointer, "op"), "unknown operation `%s`", op)
+	}
+
+	return operation, nil
+}
+
+func parsePointerField(pointer string, fields map[string]json.RawMessage, name string) (Path, error) {
+	var value string
+	if json.Unmarshal(fields[name], &value) != nil {
+		return nil, newError(appendPointer(pointer, name), "expected a JSON pointer")
+	}
+
+	path, err := ParsePointer(value)
+	if err != nil {
+		return nil, newError(appendPointer(pointer, name), err.Error())
+	}
+
+	return path, nil
+}
+
+// ParsePointer parses an RFC 6901 JSON pointer like `/address/city` into a Path. The empty pointer
+// refers to the whole document and is parsed into an empty path.
+func ParsePointer(pointer string) (Path, error) {
+	if pointer == "" {
+		return Path{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("pointer `%s` must start with `/`", pointer)
+	}
+
+	segments := strings.Split(pointer[1:], "/")
+	for i, segment := range segments {
+		segment = strings.ReplaceAll(segment, "~1", "/")
+		segments[i] = strings.ReplaceAll(segment, "~0", "~")
+	}
+
+	return segments, nil
+}
@@ -0,0 +1,121 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-jet/jet/v2/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"encore.app/content/models/generated/content/public/table"
+)
+
+func TestParseJSONPatch(t *testing.T) {
+	type expected struct {
+		operations string
+		err        *Error
+	}
+
+	tcs := []struct {
+		scenario string
+		patch    json.RawMessage
+		expected expected
+	}{
+		{
+			scenario: "Splits the pointers of the operations into paths",
+			patch:    json.RawMessage(`[{"op": "replace", "path": "/address/city", "value": "Montreal"}, {"op": "move", "from": "/a~1b", "path": "/c~0d"}]`),
+			expected: expected{
+				operations: `[{"op":"replace","path":["address","city"],"value":"Montreal"},{"op":"move","path":["c~d"],"from":["a/b"]}]`,
+			},
+		},
+		{
+			scenario: "Keeps null values of operations",
+			patch:    json.RawMessage(`[{"op": "add", "path": "/tags/-", "value": null}, {"op": "remove", "path": "/foo"}]`),
+			expected: expected{
+				operations: `[{"op":"add","path":["tags","-"],"value":null},{"op":"remove","path":["foo"]}]`,
+			},
+		},
+		{
+			scenario: "Fails when the patch is not an array",
+			patch:    json.RawMessage(`{"op": "remove", "path": "/foo"}`),
+			expected: expected{
+				err: &Error{Pointer: "", Reason: "expected an array of operations"},
+			},
+		},
+		{
+			scenario: "Fails when the patch is empty",
+			patch:    json.RawMessage(`[]`),
+			expected: expected{
+				err: &Error{Pointer: "", Reason: "expected at least one operation"},
+			},
+		},
+		{
+			scenario: "Fails with a pointer to an unknown operation",
+			patch:    json.RawMessage(`[{"op": "remove", "path": "/foo"}, {"op": "delete", "path": "/foo"}]`),
+			expected: expected{
+				err: &Error{Pointer: "/1/op", Reason: "unknown operation `delete`"},
+			},
+		},
+		{
+			scenario: "Fails when a path is not a JSON pointer",
+			patch:    json.RawMessage(`[{"op": "remove", "path": "foo"}]`),
+			expected: expected{
+				err: &Error{Pointer: "/0/path", Reason: "pointer `foo` must start with `/`"},
+			},
+		},
+		{
+			scenario: "Fails when an operation is missing its value",
+			patch:    json.RawMessage(`[{"op": "test", "path": "/foo"}]`),
+			expected: expected{
+				err: &Error{Pointer: "/0", Reason: "`test` expects a value"},
+			},
+		},
+		{
+			scenario: "Fails when a move is missing its origin",
+			patch:    json.RawMessage(`[{"op": "move", "path": "/foo"}]`),
+			expected: expected{
+				err: &Error{Pointer: "/0/from", Reason: "expected a JSON pointer"},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			patch, err := ParseJSONPatch(tc.patch)
+			if tc.expected.err != nil {
+				assert.Equal(t, tc.expected.err, err)
+				assert.Nil(t, patch)
+				return
+			}
+
+			require.NoError(t, err)
+			query, args := table.Documents.UPDATE(table.Documents.Content).
+				SET(patch.Apply(table.Documents.Content)).
+				WHERE(table.Documents.ID.EQ(postgres.Int64(1))).
+				Sql()
+
+			assert.Contains(t, query, `jsonb_patch(documents.content, $1::jsonb)`)
+			assert.Equal(t, []interface{}{tc.expected.operations, int64(1)}, args)
+		})
+	}
+}
+
+func TestParseMergePatch(t *testing.T) {
+	patch, err := ParseMergePatch(json.RawMessage(`{"address": {"city": "Montreal"}, "foo": null}`))
+	require.NoError(t, err)
+
+	query, args := table.Documents.UPDATE(table.Documents.Content).
+		SET(patch.Apply(table.Documents.Content)).
+		WHERE(table.Documents.ID.EQ(postgres.Int64(1))).
+		Sql()
+
+	assert.Contains(t, query, `jsonb_merge_patch(documents.content, $1::jsonb)`)
+	assert.Equal(t, []interface{}{`{"address":{"city":"Montreal"},"foo":null}`, int64(1)}, args)
+
+	for _, raw := range []json.RawMessage{nil, json.RawMessage("null"), json.RawMessage(`{"foo":`)} {
+		patch, err := ParseMergePatch(raw)
+		assert.Error(t, err)
+		assert.Nil(t, patch)
+	}
+}
@@ -0,0 +1,132 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-jet/jet/v2/postgres"
+)
+
+// Path is a parsed path to a value inside a document's JSON content. Each segment is either
+// an object key or an array index.
+type Path []string
+
+// ParsePath parses a dot separated path like `address.city` or `tags.0` into a Path.
+func ParsePath(path string) (Path, error) {
+	if path == "" {
+		return nil, fmt.Errorf("path cannot be empty")
+	}
+
+	segments := strings.Split(path, ".")
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("path `%s` contains an empty segment", path)
+		}
+		if strings.HasPrefix(segment, "$") {
+			return nil, fmt.Errorf("path `%s` contains a segment starting with `$`", path)
+		}
+	}
+
+	return segments, nil
+}
+
+// String returns the dot separated version of the path.
+func (p Path) String() string {
+	return strings.Join(p, ".")
+}
+
+// Literal returns the path as an SQL text array literal, for example `'{"address","city"}'`. The
+// path is inlined rather than sent as an argument so the generated expression can match expression
+// indexes created on the same path.
+func (p Path) Literal() string {
+	segments := make([]string, len(p))
+	for i, segment := range p {
+		escaped := strings.ReplaceAll(segment, `\`, `\\`)
+		escaped = strings.ReplaceAll(escaped, `"`, `\"`)
+		segments[i] = `"` + escaped + `"`
+	}
+
+	literal := "{" + strings.Join(segments, ",") + "}"
+	return "'" + strings.ReplaceAll(literal, "'", "''") + "'"
+}
+
+// Extract returns the expression extracting the value at this path from the given JSONB column,
+// as jsonb. jet has no jsonb type, the expression is typed as a string to allow comparisons.
+func (p Path) Extract(column postgres.Column) postgres.StringExpression {
+	return postgres.StringExp(postgres.Raw(fmt.Sprintf("%s #> %s", columnName(column), p.Literal())))
+}
+
+// ExtractText returns the expression extracting the value at this path from the given JSONB
+// column, as text.
+func (p Path) ExtractText(column postgres.Column) postgres.StringExpression {
+	return postgres.StringExp(postgres.Raw(fmt.Sprintf("%s #>> %s", columnName(column), p.Literal())))
+}
+
+// Lookup finds the value at this path in a JSON document, the same way the `#>` operator of
+// postgres does. It returns a JSON null when the path does not exist in the document.
+func (p Path) Lookup(document json.RawMessage) json.RawMessage {
+	value, ok := p.Find(document)
+	if !ok {
+		return json.RawMessage("null")
+	}
+
+	return value
+}
+
+// Find finds the value at this path in a JSON document, the same way the `#>` operator of postgres
+// does. Unlike Lookup, it tells whether the path exists in the document, since a missing value is
+// NULL in postgres while a JSON null is a value.
+func (p Path) Find(document json.RawMessage) (json.RawMessage, bool) {
+	current := document
+	for _, segment := range p {
+		switch jsonType(current) {
+		case "object":
+			var fields map[string]json.RawMessage
+			if json.Unmarshal(current, &fields) != nil {
+				return nil, false
+			}
+
+			value, ok := fields[segment]
+			if !ok {
+				return nil, false
+			}
+
+			current = value
+		case "array":
+			var items []json.RawMessage
+			index, err := strconv.Atoi(segment)
+			if err != nil || json.Unmarshal(current, &items) != nil {
+				return nil, false
+			}
+
+			if index < 0 {
+				index += len(items)
+			}
+			if index < 0 || index >= len(items) {
+				return nil, false
+			}
+
+			current = items[index]
+		default:
+			return nil, false
+		}
+	}
+
+	return compact(current), true
+}
+
+// JSONB returns an expression casting the raw JSON value to jsonb. The value is sent as an
+// argument of the query.
+func JSONB(raw json.RawMessage) postgres.StringExpression {
+	return postgres.StringExp(postgres.CAST(postgres.String(string(compact(raw)))).AS("jsonb"))
+}
+
+func columnName(column postgres.Column) string {
+	if column.TableName() == "" {
+		return column.Name()
+	}
+
+	return column.TableName() + "." + column.Name()
+}
@@ -0,0 +1,54 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathFind(t *testing.T) {
+	document := json.RawMessage(`{"address": {"city": "Paris", "zip": null}, "tags": ["a", "b"]}`)
+
+	tcs := []struct {
+		scenario string
+		path     Path
+		value    json.RawMessage
+		found    bool
+	}{
+		{
+			scenario: "Finds a nested value",
+			path:     Path{"address", "city"},
+			value:    json.RawMessage(`"Paris"`),
+			found:    true,
+		},
+		{
+			scenario: "Finds a null value",
+			path:     Path{"address", "zip"},
+			value:    json.RawMessage(`null`),
+			found:    true,
+		},
+		{
+			scenario: "Finds an item of an array from the end",
+			path:     Path{"tags", "-1"},
+			value:    json.RawMessage(`"b"`),
+			found:    true,
+		},
+		{
+			scenario: "Does not find a missing field",
+			path:     Path{"address", "country"},
+		},
+		{
+			scenario: "Does not find a field of a scalar",
+			path:     Path{"address", "city", "name"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			value, found := tc.path.Find(document)
+			assert.Equal(t, tc.found, found)
+			assert.Equal(t, string(tc.value), string(value))
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-jet/jet/v2/postgres"
+)
+
+// Projection is a parsed list of paths to either include in or exclude from the content of documents
+// returned to clients.
+type Projection struct {
+	paths   []Path
+	include bool
+}
+
+// ParseProjection parses the dot separated paths to include in or exclude from the content of documents.
+// Only one of the two lists can be given, it returns nil when both are empty. It returns an *Error pointing
+// to the invalid path when not valid.
+func ParseProjection(include, exclude []string) (*Projection, error) {
+	if len(include) > 0 && len(exclude) > 0 {
+		return nil, newError("", "paths can either be included or excluded, not both")
+	}
+
+	projection := &Projection{include: len(include) > 0}
+
+	pointer, raw := "/exclude", exclude
+	if projection.include {
+		pointer, raw = "/include", include
+	}
+
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	for i, rawPath := range raw {
+		pathPointer := fmt.Sprintf("%s/%d", pointer, i)
+
+		path, err := ParsePath(rawPath)
+		if err != nil {
+			return nil, newError(pathPointer, err.Error())
+		}
+
+		for _, other := range projection.paths {
+			if path.contains(other) || other.contains(path) {
+				return nil, newError(pathPointer, "path `%s` overlaps with path `%s`", path, other)
+			}
+		}
+
+		projection.paths = append(projection.paths, path)
+	}
+
+	return projection, nil
+}
+
+// Apply returns the expression projecting the content of the given JSONB column. Included paths are
+// copied into a new object, following objects only, and missing values are left out. Excluded paths are
+// removed with the `#-` operator.
+func (p *Projection) Apply(column postgres.Column) postgres.StringExpression {
+	if !p.include {
+		removed := make([]string, len(p.paths))
+		for i, path := range p.paths {
+			removed[i] = path.Literal()
+		}
+
+		return postgres.StringExp(postgres.Raw(columnName(column) + " #- " + strings.Join(removed, " #- ")))
+	}
+
+	root := projectionNode{}
+	for _, path := range p.paths {
+		root.add(path)
+	}
+
+	return postgres.StringExp(postgres.Raw(root.build(columnName(column), nil)))
+}
+
+// projectionNode is a level of the object built by an inclusion projection, nil for included values.
+type projectionNode map[string]projectionNode
+
+func (n projectionNode) add(path Path) {
+	if len(path) == 1 {
+		n[path[0]] = nil
+		return
+	}
+
+	child, ok := n[path[0]]
+	if !ok {
+		child = projectionNode{}
+		n[path[0]] = child
+	}
+
+	child.add(path[1:])
+}
+
+// build returns the SQL building the object of the node at the given path, concatenating an object for
+// each of its keys with a value in the document.
+func (n projectionNode) build(column string, path Path) string {
+	keys := make([]string, 0, len(n))
+	for key := range n {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := []string{"'{}'::jsonb"}
+	for _, key := range keys {
+		childPath := append(append(Path{}, path...), key)
+		value := fmt.Sprintf("%s #> %s", column, childPath.Literal())
+
+		child := n[key]
+		if child == nil {
+			parts = append(parts, fmt.Sprintf("CASE WHEN %[1]s IS NULL THEN '{}'::jsonb ELSE jsonb_build_object(%[2]s, %[1]s) END", value, quoteLiteral(key)))
+			continue
+		}
+
+		parts = append(parts, fmt.Sprintf(
+			"CASE WHEN jsonb_typeof(%s) = 'object' THEN jsonb_build_object(%s, %s) ELSE '{}'::jsonb END",
+			value, quoteLiteral(key), child.build(column, childPath),
+		))
+	}
+
+	return "(" + strings.Join(parts, " || ") + ")"
+}
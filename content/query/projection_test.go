@@ -0,0 +1,81 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/go-jet/jet/v2/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"encore.app/content/models/generated/content/public/table"
+)
+
+func TestParseProjection(t *testing.T) {
+	type expected struct {
+		expression string
+		err        *Error
+	}
+
+	tcs := []struct {
+		scenario string
+		include  []string
+		exclude  []string
+		expected expected
+	}{
+		{
+			scenario: "Builds an object with the included paths",
+			include:  []string{"name", "address.city", "address.country"},
+			expected: expected{
+				expression: `('{}'::jsonb || CASE WHEN jsonb_typeof(documents.content #> '{"address"}') = 'object' THEN jsonb_build_object('address', ('{}'::jsonb || CASE WHEN documents.content #> '{"address","city"}' IS NULL THEN '{}'::jsonb ELSE jsonb_build_object('city', documents.content #> '{"address","city"}') END || CASE WHEN documents.content #> '{"address","country"}' IS NULL THEN '{}'::jsonb ELSE jsonb_build_object('country', documents.content #> '{"address","country"}') END)) ELSE '{}'::jsonb END || CASE WHEN documents.content #> '{"name"}' IS NULL THEN '{}'::jsonb ELSE jsonb_build_object('name', documents.content #> '{"name"}') END)`,
+			},
+		},
+		{
+			scenario: "Removes the excluded paths",
+			exclude:  []string{"body", "tags.0"},
+			expected: expected{
+				expression: `documents.content #- '{"body"}' #- '{"tags","0"}'`,
+			},
+		},
+		{
+			scenario: "Fails when paths are both included and excluded",
+			include:  []string{"name"},
+			exclude:  []string{"body"},
+			expected: expected{
+				err: &Error{Pointer: "", Reason: "paths can either be included or excluded, not both"},
+			},
+		},
+		{
+			scenario: "Fails with a pointer to an invalid path",
+			exclude:  []string{"body", "$tags"},
+			expected: expected{
+				err: &Error{Pointer: "/exclude/1", Reason: "path `$tags` contains a segment starting with `$`"},
+			},
+		},
+		{
+			scenario: "Fails when paths overlap",
+			include:  []string{"address.city", "address"},
+			expected: expected{
+				err: &Error{Pointer: "/include/1", Reason: "path `address` overlaps with path `address.city`"},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			projection, err := ParseProjection(tc.include, tc.exclude)
+			if tc.expected.err != nil {
+				assert.Equal(t, tc.expected.err, err)
+				assert.Nil(t, projection)
+				return
+			}
+
+			require.NoError(t, err)
+			query, _ := postgres.SELECT(projection.Apply(table.Documents.Content)).Sql()
+			assert.Equal(t, "\nSELECT "+tc.expected.expression+";\n", query)
+		})
+	}
+
+	projection, err := ParseProjection(nil, []string{})
+	assert.NoError(t, err)
+	assert.Nil(t, projection)
+}
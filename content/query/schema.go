@@ -0,0 +1,556 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a parsed JSON Schema used to validate the content of documents. The supported keywords
+// are a subset of draft 2020-12: `type`, `enum`, `const`, `properties`, `required`, `additionalProperties`,
+// `minProperties`, `maxProperties`, `items`, `prefixItems`, `minItems`, `maxItems`, `uniqueItems`,
+// `minLength`, `maxLength`, `pattern`, `minimum`, `maximum`, `exclusiveMinimum`, `exclusiveMaximum`,
+// `multipleOf`, `allOf`, `anyOf`, `oneOf` and `not`. Annotations like `title` or `format` are ignored,
+// and the keywords that are not supported, like `$ref`, are rejected. Patterns use the RE2 syntax.
+type Schema struct {
+	raw  json.RawMessage
+	root *schemaNode
+}
+
+type schemaNode struct {
+	// A boolean schema, true accepts any value and false rejects all values
+	boolean *bool
+
+	types []string
+	enum  []interface{}
+	konst *interface{}
+
+	properties           map[string]*schemaNode
+	required             []string
+	additionalProperties *schemaNode
+	minProperties        *int
+	maxProperties        *int
+
+	items       *schemaNode
+	prefixItems []*schemaNode
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	minimum          *big.Rat
+	maximum          *big.Rat
+	exclusiveMinimum *big.Rat
+	exclusiveMaximum *big.Rat
+	multipleOf       *big.Rat
+
+	allOf []*schemaNode
+	anyOf []*schemaNode
+	oneOf []*schemaNode
+	not   *schemaNode
+}
+
+var schemaTypes = map[string]bool{
+	"null": true, "boolean": true, "object": true, "array": true, "number": true, "integer": true, "string": true,
+}
+
+var schemaAnnotations = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true, "default": true,
+	"examples": true, "deprecated": true, "readOnly": true, "writeOnly": true, "format": true,
+}
+
+// ParseSchema parses and validates a raw JSON Schema. It returns a nil schema when the raw schema
+// is empty or null, and an *Error pointing to the invalid keyword when not valid.
+func ParseSchema(raw json.RawMessage) (*Schema, error) {
+	if isEmpty(raw) {
+		return nil, nil
+	}
+
+	root, err := parseSchemaNode("", raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Schema{raw: compact(raw), root: root}, nil
+}
+
+// Raw returns the schema as compact JSON, to be stored.
+func (s *Schema) Raw() json.RawMessage {
+	return s.raw
+}
+
+// Validate validates a JSON document against the schema. It returns an Error for each location of
+// the document that does not match the schema, with a pointer to the location in the document, or
+// nothing when the document is valid.
+func (s *Schema) Validate(document json.RawMessage) []Error {
+	value, err := decodeValue(document)
+	if err != nil {
+		return []Error{{Pointer: "", Reason: "expected a valid JSON value"}}
+	}
+
+	return s.root.validate("", value)
+}
+
+func parseSchemaNode(pointer string, raw json.RawMessage) (*schemaNode, error) {
+	if jsonType(raw) == "boolean" {
+		var boolean bool
+		if err := json.Unmarshal(raw, &boolean); err != nil {
+			return nil, newError(pointer, "expected a boolean")
+		}
+
+		return &schemaNode{boolean: &boolean}, nil
+	}
+
+	keywords, err := parseObject(pointer, raw)
+	if err != nil {
+		return nil, newError(pointer, "expected a schema object or a boolean")
+	}
+
+	node := &schemaNode{}
+	for _, keyword := range sortedKeys(keywords) {
+		err = node.parseKeyword(appendPointer(pointer, keyword), keyword, keywords[keyword])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return node, nil
+}
+
+func (n *schemaNode) parseKeyword(pointer, keyword string, raw json.RawMessage) error {
+	var err error
+	switch keyword {
+	case "type":
+		n.types, err = parseSchemaTypes(pointer, raw)
+	case "enum":
+		var values []json.RawMessage
+		if jsonType(raw) != "array" || json.Unmarshal(raw, &values) != nil || len(values) == 0 {
+			return newError(pointer, "expected a non empty array")
+		}
+
+		for _, value := range values {
+			decoded, _ := decodeValue(value)
+			n.enum = append(n.enum, decoded)
+		}
+	case "const":
+		var decoded interface{}
+		decoded, err = decodeValue(raw)
+		if err != nil {
+			return newError(pointer, "expected a valid JSON value")
+		}
+
+		n.konst = &decoded
+	case "properties":
+		var fields map[string]json.RawMessage
+		fields, err = parseObject(pointer, raw)
+		if err != nil {
+			return err
+		}
+
+		n.properties = map[string]*schemaNode{}
+		for _, name := range sortedKeys(fields) {
+			n.properties[name], err = parseSchemaNode(appendPointer(pointer, name), fields[name])
+			if err != nil {
+				return err
+			}
+		}
+	case "required":
+		if jsonType(raw) != "array" || json.Unmarshal(raw, &n.required) != nil {
+			return newError(pointer, "expected an array of strings")
+		}
+	case "additionalProperties":
+		n.additionalProperties, err = parseSchemaNode(pointer, raw)
+	case "minProperties":
+		n.minProperties, err = parseSchemaCount(pointer, raw)
+	case "maxProperties":
+		n.maxProperties, err = parseSchemaCount(pointer, raw)
+	case "items":
+		n.items, err = parseSchemaNode(pointer, raw)
+	case "prefixItems":
+		n.prefixItems, err = parseSchemaNodes(pointer, raw)
+	case "minItems":
+		n.minItems, err = parseSchemaCount(pointer, raw)
+	case "maxItems":
+		n.maxItems, err = parseSchemaCount(pointer, raw)
+	case "uniqueItems":
+		if jsonType(raw) != "boolean" || json.Unmarshal(raw, &n.uniqueItems) != nil {
+			return newError(pointer, "expected a boolean")
+		}
+	case "minLength":
+		n.minLength, err = parseSchemaCount(pointer, raw)
+	case "maxLength":
+		n.maxLength, err = parseSchemaCount(pointer, raw)
+	case "pattern":
+		var pattern string
+		if jsonType(raw) != "string" || json.Unmarshal(raw, &pattern) != nil {
+			return newError(pointer, "expected a string")
+		}
+
+		n.pattern, err = regexp.Compile(pattern)
+		if err != nil {
+			return newError(pointer, "expected a valid regular expression, %s", err)
+		}
+	case "minimum":
+		n.minimum, err = parseSchemaNumber(pointer, raw)
+	case "maximum":
+		n.maximum, err = parseSchemaNumber(pointer, raw)
+	case "exclusiveMinimum":
+		n.exclusiveMinimum, err = parseSchemaNumber(pointer, raw)
+	case "exclusiveMaximum":
+		n.exclusiveMaximum, err = parseSchemaNumber(pointer, raw)
+	case "multipleOf":
+		n.multipleOf, err = parseSchemaNumber(pointer, raw)
+		if err == nil && n.multipleOf.Sign() <= 0 {
+			return newError(pointer, "expected a number greater than 0")
+		}
+	case "allOf":
+		n.allOf, err = parseSchemaNodes(pointer, raw)
+	case "anyOf":
+		n.anyOf, err = parseSchemaNodes(pointer, raw)
+	case "oneOf":
+		n.oneOf, err = parseSchemaNodes(pointer, raw)
+	case "not":
+		n.not, err = parseSchemaNode(pointer, raw)
+	default:
+		if !schemaAnnotations[keyword] {
+			return newError(pointer, "unsupported keyword `%s`", keyword)
+		}
+	}
+
+	return err
+}
+
+func parseSchemaTypes(pointer string, raw json.RawMessage) ([]string, error) {
+	var types []string
+	if jsonType(raw) == "string" {
+		var single string
+		_ = json.Unmarshal(raw, &single)
+		types = []string{single}
+	} else if jsonType(raw) != "array" || json.Unmarshal(raw, &types) != nil || len(types) == 0 {
+		return nil, newError(pointer, "expected a type or a non empty array of types")
+	}
+
+	for _, name := range types {
+		if !schemaTypes[name] {
+			return nil, newError(pointer, "unknown type `%s`", name)
+		}
+	}
+
+	return types, nil
+}
+
+func parseSchemaNodes(pointer string, raw json.RawMessage) ([]*schemaNode, error) {
+	var list []json.RawMessage
+	if jsonType(raw) != "array" || json.Unmarshal(raw, &list) != nil || len(list) == 0 {
+		return nil, newError(pointer, "expected a non empty array of schemas")
+	}
+
+	nodes := make([]*schemaNode, len(list))
+	for i, item := range list {
+		node, err := parseSchemaNode(fmt.Sprintf("%s/%d", pointer, i), item)
+		if err != nil {
+			return nil, err
+		}
+
+		nodes[i] = node
+	}
+
+	return nodes, nil
+}
+
+func parseSchemaCount(pointer string, raw json.RawMessage) (*int, error) {
+	var count int
+	if jsonType(raw) != "number" || json.Unmarshal(raw, &count) != nil || count < 0 {
+		return nil, newError(pointer, "expected a positive integer")
+	}
+
+	return &count, nil
+}
+
+func parseSchemaNumber(pointer string, raw json.RawMessage) (*big.Rat, error) {
+	number, ok := new(big.Rat).SetString(string(bytes.TrimSpace(raw)))
+	if jsonType(raw) != "number" || !ok {
+		return nil, newError(pointer, "expected a number")
+	}
+
+	return number, nil
+}
+
+func (n *schemaNode) validate(pointer string, value interface{}) []Error {
+	if n.boolean != nil {
+		if *n.boolean {
+			return nil
+		}
+
+		return []Error{{Pointer: pointer, Reason: "no value is allowed"}}
+	}
+
+	var errors []Error
+	fail := func(format string, args ...interface{}) {
+		errors = append(errors, Error{Pointer: pointer, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	if len(n.types) > 0 && !matchesSchemaType(n.types, value) {
+		fail("expected a value of type %s", strings.Join(n.types, " or "))
+		return errors
+	}
+
+	if n.enum != nil {
+		found := false
+		for _, allowed := range n.enum {
+			if jsonEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			fail("expected one of the values of the enum")
+		}
+	}
+
+	if n.konst != nil && !jsonEqual(*n.konst, value) {
+		fail("expected the constant value")
+	}
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		errors = append(errors, n.validateObject(pointer, typed)...)
+	case []interface{}:
+		errors = append(errors, n.validateArray(pointer, typed)...)
+	case string:
+		length := utf8.RuneCountInString(typed)
+		if n.minLength != nil && length < *n.minLength {
+			fail("expected at least %d characters", *n.minLength)
+		}
+		if n.maxLength != nil && length > *n.maxLength {
+			fail("expected at most %d characters", *n.maxLength)
+		}
+		if n.pattern != nil && !n.pattern.MatchString(typed) {
+			fail("expected to match the pattern `%s`", n.pattern.String())
+		}
+	case json.Number:
+		number, _ := new(big.Rat).SetString(typed.String())
+		if n.minimum != nil && number.Cmp(n.minimum) < 0 {
+			fail("expected a number greater than or equal to %s", n.minimum.RatString())
+		}
+		if n.maximum != nil && number.Cmp(n.maximum) > 0 {
+			fail("expected a number less than or equal to %s", n.maximum.RatString())
+		}
+		if n.exclusiveMinimum != nil && number.Cmp(n.exclusiveMinimum) <= 0 {
+			fail("expected a number greater than %s", n.exclusiveMinimum.RatString())
+		}
+		if n.exclusiveMaximum != nil && number.Cmp(n.exclusiveMaximum) >= 0 {
+			fail("expected a number less than %s", n.exclusiveMaximum.RatString())
+		}
+		if n.multipleOf != nil && !new(big.Rat).Quo(number, n.multipleOf).IsInt() {
+			fail("expected a multiple of %s", n.multipleOf.RatString())
+		}
+	}
+
+	for _, node := range n.allOf {
+		errors = append(errors, node.validate(pointer, value)...)
+	}
+
+	if n.anyOf != nil {
+		matched := 0
+		for _, node := range n.anyOf {
+			if len(node.validate(pointer, value)) == 0 {
+				matched++
+			}
+		}
+
+		if matched == 0 {
+			fail("expected to match at least one schema of anyOf")
+		}
+	}
+
+	if n.oneOf != nil {
+		matched := 0
+		for _, node := range n.oneOf {
+			if len(node.validate(pointer, value)) == 0 {
+				matched++
+			}
+		}
+
+		if matched != 1 {
+			fail("expected to match exactly one schema of oneOf, matched %d", matched)
+		}
+	}
+
+	if n.not != nil && len(n.not.validate(pointer, value)) == 0 {
+		fail("expected not to match the schema of not")
+	}
+
+	return errors
+}
+
+func (n *schemaNode) validateObject(pointer string, object map[string]interface{}) []Error {
+	var errors []Error
+
+	for _, name := range n.required {
+		if _, ok := object[name]; !ok {
+			errors = append(errors, Error{Pointer: appendPointer(pointer, name), Reason: "expected a value, the field is required"})
+		}
+	}
+
+	if n.minProperties != nil && len(object) < *n.minProperties {
+		errors = append(errors, Error{Pointer: pointer, Reason: fmt.Sprintf("expected at least %d fields", *n.minProperties)})
+	}
+	if n.maxProperties != nil && len(object) > *n.maxProperties {
+		errors = append(errors, Error{Pointer: pointer, Reason: fmt.Sprintf("expected at most %d fields", *n.maxProperties)})
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fieldPointer := appendPointer(pointer, name)
+		if node, ok := n.properties[name]; ok {
+			errors = append(errors, node.validate(fieldPointer, object[name])...)
+		} else if n.additionalProperties != nil {
+			errors = append(errors, n.additionalProperties.validate(fieldPointer, object[name])...)
+		}
+	}
+
+	return errors
+}
+
+func (n *schemaNode) validateArray(pointer string, array []interface{}) []Error {
+	var errors []Error
+
+	if n.minItems != nil && len(array) < *n.minItems {
+		errors = append(errors, Error{Pointer: pointer, Reason: fmt.Sprintf("expected at least %d items", *n.minItems)})
+	}
+	if n.maxItems != nil && len(array) > *n.maxItems {
+		errors = append(errors, Error{Pointer: pointer, Reason: fmt.Sprintf("expected at most %d items", *n.maxItems)})
+	}
+
+	for i, item := range array {
+		itemPointer := fmt.Sprintf("%s/%d", pointer, i)
+		if i < len(n.prefixItems) {
+			errors = append(errors, n.prefixItems[i].validate(itemPointer, item)...)
+		} else if n.items != nil {
+			errors = append(errors, n.items.validate(itemPointer, item)...)
+		}
+
+		if n.uniqueItems {
+			for j := 0; j < i; j++ {
+				if jsonEqual(array[j], item) {
+					errors = append(errors, Error{Pointer: itemPointer, Reason: fmt.Sprintf("expected unique items, same as item %d", j)})
+					break
+				}
+			}
+		}
+	}
+
+	return errors
+}
+
+func matchesSchemaType(types []string, value interface{}) bool {
+	for _, name := range types {
+		switch typed := value.(type) {
+		case nil:
+			if name == "null" {
+				return true
+			}
+		case bool:
+			if name == "boolean" {
+				return true
+			}
+		case map[string]interface{}:
+			if name == "object" {
+				return true
+			}
+		case []interface{}:
+			if name == "array" {
+				return true
+			}
+		case string:
+			if name == "string" {
+				return true
+			}
+		case json.Number:
+			if name == "number" {
+				return true
+			}
+
+			number, ok := new(big.Rat).SetString(typed.String())
+			if name == "integer" && ok && number.IsInt() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// jsonEqual compares two decoded JSON values, numbers are equal when they have the same value
+// whatever their representation.
+func jsonEqual(a, b interface{}) bool {
+	switch typedA := a.(type) {
+	case json.Number:
+		typedB, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+
+		numberA, okA := new(big.Rat).SetString(typedA.String())
+		numberB, okB := new(big.Rat).SetString(typedB.String())
+		return okA && okB && numberA.Cmp(numberB) == 0
+	case map[string]interface{}:
+		typedB, ok := b.(map[string]interface{})
+		if !ok || len(typedA) != len(typedB) {
+			return false
+		}
+
+		for key, value := range typedA {
+			other, ok := typedB[key]
+			if !ok || !jsonEqual(value, other) {
+				return false
+			}
+		}
+
+		return true
+	case []interface{}:
+		typedB, ok := b.([]interface{})
+		if !ok || len(typedA) != len(typedB) {
+			return false
+		}
+
+		for i := range typedA {
+			if !jsonEqual(typedA[i], typedB[i]) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return a == b
+}
+
+// decodeValue decodes a raw JSON value, keeping numbers as json.Number so they are compared exactly.
+func decodeValue(raw json.RawMessage) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
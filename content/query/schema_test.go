@@ -0,0 +1,159 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchema(t *testing.T) {
+	tcs := []struct {
+		scenario string
+		schema   json.RawMessage
+		err      *Error
+	}{
+		{
+			scenario: "Parses a schema with nested keywords",
+			schema:   json.RawMessage(`{"type": "object", "title": "User", "properties": {"email": {"type": "string", "format": "email"}, "tags": {"items": {"enum": ["a", "b"]}}}}`),
+		},
+		{
+			scenario: "Parses boolean schemas",
+			schema:   json.RawMessage(`{"properties": {"foo": true, "bar": false}}`),
+		},
+		{
+			scenario: "Fails when the schema is not an object",
+			schema:   json.RawMessage(`"string"`),
+			err:      &Error{Pointer: "", Reason: "expected a schema object or a boolean"},
+		},
+		{
+			scenario: "Fails with a pointer to an unsupported keyword",
+			schema:   json.RawMessage(`{"properties": {"foo": {"$ref": "#/$defs/foo"}}}`),
+			err:      &Error{Pointer: "/properties/foo/$ref", Reason: "unsupported keyword `$ref`"},
+		},
+		{
+			scenario: "Fails with a pointer to an unknown type",
+			schema:   json.RawMessage(`{"type": ["string", "date"]}`),
+			err:      &Error{Pointer: "/type", Reason: "unknown type `date`"},
+		},
+		{
+			scenario: "Fails when a count is negative",
+			schema:   json.RawMessage(`{"minItems": -1}`),
+			err:      &Error{Pointer: "/minItems", Reason: "expected a positive integer"},
+		},
+		{
+			scenario: "Fails when a list of schemas is empty",
+			schema:   json.RawMessage(`{"anyOf": []}`),
+			err:      &Error{Pointer: "/anyOf", Reason: "expected a non empty array of schemas"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			schema, err := ParseSchema(tc.schema)
+			if tc.err != nil {
+				assert.Equal(t, tc.err, err)
+				assert.Nil(t, schema)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.NotNil(t, schema)
+		})
+	}
+}
+
+func TestParseSchemaEmpty(t *testing.T) {
+	for _, raw := range []json.RawMessage{nil, json.RawMessage(`null`)} {
+		schema, err := ParseSchema(raw)
+		require.NoError(t, err)
+		assert.Nil(t, schema)
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := ParseSchema(json.RawMessage(`{
+		"type": "object",
+		"required": ["email", "age"],
+		"additionalProperties": false,
+		"properties": {
+			"email": {"type": "string", "pattern": "^[^@]+@[^@]+$", "maxLength": 20},
+			"age": {"type": "integer", "minimum": 0, "exclusiveMaximum": 150},
+			"status": {"enum": ["active", "inactive"]},
+			"tags": {"type": "array", "items": {"type": "string"}, "uniqueItems": true, "maxItems": 3},
+			"price": {"type": "number", "multipleOf": 0.01},
+			"contact": {"oneOf": [{"required": ["phone"]}, {"required": ["address"]}]}
+		}
+	}`))
+	require.NoError(t, err)
+
+	tcs := []struct {
+		scenario string
+		document json.RawMessage
+		errors   []Error
+	}{
+		{
+			scenario: "Accepts a valid document",
+			document: json.RawMessage(`{"email": "foo@bar.com", "age": 30, "status": "active", "tags": ["a", "b"], "price": 10.25, "contact": {"phone": "123"}}`),
+		},
+		{
+			scenario: "Accepts integers written as decimals",
+			document: json.RawMessage(`{"email": "foo@bar.com", "age": 30.0}`),
+		},
+		{
+			scenario: "Reports every failing location",
+			document: json.RawMessage(`{"email": "foo", "age": 150, "status": "deleted", "other": 1}`),
+			errors: []Error{
+				{Pointer: "/age", Reason: "expected a number less than 150"},
+				{Pointer: "/email", Reason: "expected to match the pattern `^[^@]+@[^@]+$`"},
+				{Pointer: "/other", Reason: "no value is allowed"},
+				{Pointer: "/status", Reason: "expected one of the values of the enum"},
+			},
+		},
+		{
+			scenario: "Reports missing required fields",
+			document: json.RawMessage(`{"email": "foo@bar.com"}`),
+			errors: []Error{
+				{Pointer: "/age", Reason: "expected a value, the field is required"},
+			},
+		},
+		{
+			scenario: "Reports items of arrays",
+			document: json.RawMessage(`{"email": "foo@bar.com", "age": 1, "tags": ["a", 2, "a", "b"]}`),
+			errors: []Error{
+				{Pointer: "/tags", Reason: "expected at most 3 items"},
+				{Pointer: "/tags/1", Reason: "expected a value of type string"},
+				{Pointer: "/tags/2", Reason: "expected unique items, same as item 0"},
+			},
+		},
+		{
+			scenario: "Reports numbers that are not multiples",
+			document: json.RawMessage(`{"email": "foo@bar.com", "age": 1.5, "price": 10.255}`),
+			errors: []Error{
+				{Pointer: "/age", Reason: "expected a value of type integer"},
+				{Pointer: "/price", Reason: "expected a multiple of 1/100"},
+			},
+		},
+		{
+			scenario: "Reports combinations that do not match",
+			document: json.RawMessage(`{"email": "foo@bar.com", "age": 1, "contact": {"phone": "1", "address": "2"}}`),
+			errors: []Error{
+				{Pointer: "/contact", Reason: "expected to match exactly one schema of oneOf, matched 2"},
+			},
+		},
+		{
+			scenario: "Reports a document of the wrong type",
+			document: json.RawMessage(`["foo"]`),
+			errors: []Error{
+				{Pointer: "", Reason: "expected a value of type object"},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			assert.Equal(t, tc.errors, schema.Validate(tc.document))
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-jet/jet/v2/postgres"
+)
+
+// defaultSearchLanguage is the text search configuration used when a collection does not give a language. It
+// splits the text into words without stemming them nor removing stop words.
+const defaultSearchLanguage = "simple"
+
+// searchLanguages are the text search configurations built in postgres that collections can search with.
+var searchLanguages = map[string]bool{
+	"simple": true, "arabic": true, "danish": true, "dutch": true, "english": true, "finnish": true, "french": true,
+	"german": true, "hungarian": true, "indonesian": true, "irish": true, "italian": true, "lithuanian": true,
+	"nepali": true, "norwegian": true, "portuguese": true, "romanian": true, "russian": true, "spanish": true,
+	"swedish": true, "tamil": true, "turkish": true,
+}
+
+// highlightOptions are the options of ts_headline highlighting the matched words of a search.
+const highlightOptions = "StartSel=<b>, StopSel=</b>, MaxWords=35, MinWords=15, MaxFragments=3"
+
+// SearchConfig is the parsed full-text search configuration of a collection: the language of its documents and
+// the paths of their content to search, by decreasing importance.
+type SearchConfig struct {
+	language string
+	paths    []Path
+}
+
+// rawSearchConfig is the stored version of a search configuration, the format expected by the
+// document_search_vector SQL function.
+type rawSearchConfig struct {
+	Language string   `json:"language"`
+	Paths    []string `json:"paths"`
+}
+
+// ParseSearchConfig parses the full-text search configuration of a collection, like
+// `{"language": "english", "paths": ["title", "body"]}`. The language is the name of a text search configuration
+// built in postgres and defaults to `simple`, which does not stem words. The strings at each path are searched,
+// including the strings nested in arrays and objects, and matches on the first paths rank higher. It returns a nil
+// configuration when the raw configuration is empty or null, and an *Error pointing to the invalid field when not
+// valid.
+func ParseSearchConfig(raw json.RawMessage) (*SearchConfig, error) {
+	if isEmpty(raw) {
+		return nil, nil
+	}
+
+	fields, err := parseObject("", raw)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &SearchConfig{language: defaultSearchLanguage}
+	for _, name := range sortedKeys(fields) {
+		pointer := appendPointer("", name)
+
+		switch name {
+		case "language":
+			if json.Unmarshal(fields[name], &config.language) != nil {
+				return nil, newError(pointer, "expected a string")
+			}
+
+			if !searchLanguages[config.language] {
+				return nil, newError(pointer, "unknown language `%s`", config.language)
+			}
+		case "paths":
+			config.paths, err = parseSearchPaths(pointer, fields[name])
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, newError(pointer, "unknown field `%s`, expected `language` or `paths`", name)
+		}
+	}
+
+	if len(config.paths) == 0 {
+		return nil, newError("/paths", "expected at least one path to search")
+	}
+
+	return config, nil
+}
+
+func parseSearchPaths(pointer string, raw json.RawMessage) ([]Path, error) {
+	var rawPaths []string
+	if json.Unmarshal(raw, &rawPaths) != nil {
+		return nil, newError(pointer, "expected an array of paths")
+	}
+
+	paths := make([]Path, len(rawPaths))
+	for i, rawPath := range rawPaths {
+		pathPointer := fmt.Sprintf("%s/%d", pointer, i)
+
+		path, err := ParsePath(rawPath)
+		if err != nil {
+			return nil, newError(pathPointer, err.Error())
+		}
+
+		for _, previous := range paths[:i] {
+			if previous.String() == path.String() {
+				return nil, newError(pathPointer, "path `%s` is already searched", path)
+			}
+		}
+
+		paths[i] = path
+	}
+
+	return paths, nil
+}
+
+// Raw returns the configuration as compact JSON, to be stored.
+func (c *SearchConfig) Raw() json.RawMessage {
+	paths := make([]string, len(c.paths))
+	for i, path := range c.paths {
+		paths[i] = path.String()
+	}
+
+	raw, _ := json.Marshal(rawSearchConfig{Language: c.language, Paths: paths})
+	return raw
+}
+
+// Search is a parsed full-text search of the documents of a collection.
+type Search struct {
+	config *SearchConfig
+	text   string
+}
+
+// ParseSearch parses the text of a full-text search with the configuration of the searched collection. The text
+// uses the syntax of web search engines: words are all required unless separated by `or`, quoted words are matched
+// as a phrase and words prefixed by `-` must not appear. It returns an *Error when the text is not valid.
+func (c *SearchConfig) ParseSearch(text string) (*Search, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, newError("", "search text cannot be empty")
+	}
+
+	if strings.ContainsRune(text, 0) {
+		return nil, newError("", "search text cannot contain null characters")
+	}
+
+	return &Search{config: c, text: text}, nil
+}
+
+// searchTextArgument is the name of the argument holding the text of a search in the raw SQL of its expressions.
+const searchTextArgument = "#search_text"
+
+// Match returns the condition selecting the documents matching the search. The vector is the column storing
+// the text search vector of the documents, or nil to build it from their content in the given JSONB column.
+func (s *Search) Match(content, vector postgres.Column) postgres.BoolExpression {
+	return postgres.BoolExp(s.raw(func(query string) string {
+		return fmt.Sprintf("%s @@ %s", s.vector(content, vector), query)
+	}))
+}
+
+// Rank returns the expression ranking the documents matching the search, the more relevant the document, the
+// higher the rank. The vector is given the same way as for Match.
+func (s *Search) Rank(content, vector postgres.Column) postgres.FloatExpression {
+	return postgres.FloatExp(s.raw(func(query string) string {
+		return fmt.Sprintf("ts_rank(%s, %s)", s.vector(content, vector), query)
+	}))
+}
+
+// Highlights returns the expression building the highlights of the content in the given JSONB column, as a JSON
+// object. It has a key for each searched path with a value matching the search, with the matched words of the
+// strings of the value wrapped in `<b>` tags. Long strings are shortened to the fragments around the matched words.
+func (s *Search) Highlights(column postgres.Column) postgres.StringExpression {
+	return postgres.StringExp(s.raw(func(query string) string {
+		values := make([]string, 0, 2*len(s.config.paths))
+		for _, path := range s.config.paths {
+			value := fmt.Sprintf("%s #> %s", columnName(column), path.Literal())
+			values = append(values, quoteLiteral(path.String()), fmt.Sprintf(
+				`CASE WHEN jsonb_to_tsvector(%[1]s, %[2]s, '["string"]') @@ %[3]s THEN ts_headline(%[1]s, %[2]s, %[3]s, %[4]s) END`,
+				s.config.regconfig(), value, query, quoteLiteral(highlightOptions),
+			))
+		}
+
+		return fmt.Sprintf("jsonb_strip_nulls(jsonb_build_object(%s))", strings.Join(values, ", "))
+	}))
+}
+
+// raw returns the raw expression of the SQL built with the text search query of the search. The text is sent as
+// an argument of the query, under a name that does not appear in the rest of the SQL since the paths of the
+// searched values are inlined.
+func (s *Search) raw(build func(query string) string) postgres.Expression {
+	name := searchTextArgument
+	for strings.Contains(build(""), name) {
+		name += "_"
+	}
+
+	query := fmt.Sprintf("websearch_to_tsquery(%s, %s)", s.config.regconfig(), name)
+	return postgres.Raw(build(query), postgres.RawArgs{name: s.text})
+}
+
+// vector returns the SQL of the text search vector of the documents, built the same way as the vectors stored
+// for committed documents when no column stores it.
+func (s *Search) vector(content, vector postgres.Column) string {
+	if vector != nil {
+		return columnName(vector)
+	}
+
+	return fmt.Sprintf("document_search_vector(%s, %s::jsonb)", columnName(content), quoteLiteral(string(s.config.Raw())))
+}
+
+func (c *SearchConfig) regconfig() string {
+	return quoteLiteral(c.language) + "::regconfig"
+}
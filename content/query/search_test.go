@@ -0,0 +1,145 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-jet/jet/v2/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"encore.app/content/models/generated/content/public/table"
+)
+
+func TestParseSearchConfig(t *testing.T) {
+	type expected struct {
+		raw string
+		err *Error
+	}
+
+	tcs := []struct {
+		scenario string
+		config   json.RawMessage
+		expected expected
+	}{
+		{
+			scenario: "Parses the language and the paths to search",
+			config:   json.RawMessage(`{"paths": ["title", "author.name"], "language": "english"}`),
+			expected: expected{
+				raw: `{"language":"english","paths":["title","author.name"]}`,
+			},
+		},
+		{
+			scenario: "Uses the simple configuration when no language is given",
+			config:   json.RawMessage(`{"paths": ["title"]}`),
+			expected: expected{
+				raw: `{"language":"simple","paths":["title"]}`,
+			},
+		},
+		{
+			scenario: "Fails when the language is unknown",
+			config:   json.RawMessage(`{"paths": ["title"], "language": "klingon"}`),
+			expected: expected{
+				err: &Error{Pointer: "/language", Reason: "unknown language `klingon`"},
+			},
+		},
+		{
+			scenario: "Fails without paths",
+			config:   json.RawMessage(`{"language": "english", "paths": []}`),
+			expected: expected{
+				err: &Error{Pointer: "/paths", Reason: "expected at least one path to search"},
+			},
+		},
+		{
+			scenario: "Fails when a path is not valid",
+			config:   json.RawMessage(`{"paths": ["title", "author..name"]}`),
+			expected: expected{
+				err: &Error{Pointer: "/paths/1", Reason: "path `author..name` contains an empty segment"},
+			},
+		},
+		{
+			scenario: "Fails when a path is listed twice",
+			config:   json.RawMessage(`{"paths": ["title", "title"]}`),
+			expected: expected{
+				err: &Error{Pointer: "/paths/1", Reason: "path `title` is already searched"},
+			},
+		},
+		{
+			scenario: "Fails on unknown fields",
+			config:   json.RawMessage(`{"paths": ["title"], "weights": {}}`),
+			expected: expected{
+				err: &Error{Pointer: "/weights", Reason: "unknown field `weights`, expected `language` or `paths`"},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			config, err := ParseSearchConfig(tc.config)
+			if tc.expected.err != nil {
+				assert.Equal(t, tc.expected.err, err)
+				assert.Nil(t, config)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected.raw, string(config.Raw()))
+		})
+	}
+}
+
+func TestParseSearchConfigEmpty(t *testing.T) {
+	config, err := ParseSearchConfig(json.RawMessage(`null`))
+	require.NoError(t, err)
+	assert.Nil(t, config)
+}
+
+func TestSearch(t *testing.T) {
+	config, err := ParseSearchConfig(json.RawMessage(`{"language": "english", "paths": ["title", "tags"]}`))
+	require.NoError(t, err)
+
+	_, err = config.ParseSearch("  ")
+	assert.Equal(t, &Error{Pointer: "", Reason: "search text cannot be empty"}, err)
+
+	search, err := config.ParseSearch(`"quick fox" -dog's`)
+	require.NoError(t, err)
+
+	statement := postgres.SELECT(
+		search.Rank(table.Documents.Content, table.Documents.SearchVector),
+		search.Highlights(table.Documents.Content),
+	).FROM(table.Documents).WHERE(
+		search.Match(table.Documents.Content, nil),
+	)
+
+	assert.Equal(t, `
+SELECT ts_rank(documents.search_vector, websearch_to_tsquery('english'::regconfig, '"quick fox" -dog''s')),
+     jsonb_strip_nulls(jsonb_build_object('title', CASE WHEN jsonb_to_tsvector('english'::regconfig, documents.content #> '{"title"}', '["string"]') @@ websearch_to_tsquery('english'::regconfig, '"quick fox" -dog''s') THEN ts_headline('english'::regconfig, documents.content #> '{"title"}', websearch_to_tsquery('english'::regconfig, '"quick fox" -dog''s'), 'StartSel=<b>, StopSel=</b>, MaxWords=35, MinWords=15, MaxFragments=3') END, 'tags', CASE WHEN jsonb_to_tsvector('english'::regconfig, documents.content #> '{"tags"}', '["string"]') @@ websearch_to_tsquery('english'::regconfig, '"quick fox" -dog''s') THEN ts_headline('english'::regconfig, documents.content #> '{"tags"}', websearch_to_tsquery('english'::regconfig, '"quick fox" -dog''s'), 'StartSel=<b>, StopSel=</b>, MaxWords=35, MinWords=15, MaxFragments=3') END))
+FROM public.documents
+WHERE document_search_vector(documents.content, '{"language":"english","paths":["title","tags"]}'::jsonb) @@ websearch_to_tsquery('english'::regconfig, '"quick fox" -dog''s');
+`, statement.DebugSql())
+
+	query, args := statement.Sql()
+	assert.NotContains(t, query, "quick fox")
+	assert.Contains(t, query, "websearch_to_tsquery('english'::regconfig, $1)")
+	// The text is sent once for each raw expression of the search
+	assert.Len(t, args, 3)
+	for _, arg := range args {
+		assert.Equal(t, `"quick fox" -dog's`, arg)
+	}
+}
+
+func TestSearchArgumentName(t *testing.T) {
+	config, err := ParseSearchConfig(json.RawMessage(`{"paths": ["a#search_text"]}`))
+	require.NoError(t, err)
+
+	search, err := config.ParseSearch("fox")
+	require.NoError(t, err)
+
+	query, args := postgres.SELECT(
+		search.Highlights(table.Documents.Content),
+	).FROM(table.Documents).Sql()
+
+	assert.Contains(t, query, `'a#search_text'`)
+	assert.Contains(t, query, `documents.content #> '{"a#search_text"}'`)
+	assert.Equal(t, []interface{}{"fox"}, args)
+}
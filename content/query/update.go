@@ -0,0 +1,339 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// updateOperators maps the update operators accepted by ParseUpdate to the operations of the `jsonb_update`
+// postgres function.
+var updateOperators = map[string]string{
+	"$set":         "set",
+	"$unset":       "unset",
+	"$inc":         "inc",
+	"$mul":         "mul",
+	"$min":         "min",
+	"$max":         "max",
+	"$push":        "push",
+	"$addToSet":    "addToSet",
+	"$pull":        "pull",
+	"$rename":      "rename",
+	"$setOnInsert": "setOnInsert",
+}
+
+// updateOperation is an update operator applied to a single path, in the format expected by the
+// `jsonb_update` postgres function.
+type updateOperation struct {
+	Op    string          `json:"op"`
+	Path  Path            `json:"path"`
+	From  Path            `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+
+	// The location of the operation in the update, to report type mismatches
+	pointer string
+}
+
+// ParseUpdate parses and validates update operators like `{"$inc": {"views": 1}, "$push": {"tags": "new"}}`.
+// Each operator maps dot separated paths to the value it applies:
+//
+//   - `$set` and `$unset` set and remove values, `$rename` moves a value to the path given as value
+//   - `$inc` and `$mul` increment and multiply numbers, missing values count as 0
+//   - `$min` and `$max` only set values lower or greater than the current one, of the same type
+//   - `$push` appends to arrays and `$addToSet` appends the values not already present, both accept
+//     `{"$each": [...]}` to append several values
+//   - `$pull` removes the values equal to the given one from arrays, or to any of `{"$in": [...]}`
+//   - `$setOnInsert` sets values only when the document is created by an upsert
+//
+// A path cannot be updated by more than one operator. It returns an *Error pointing to the invalid clause
+// when not valid.
+func ParseUpdate(raw json.RawMessage) (*Patch, error) {
+	if isEmpty(raw) {
+		return nil, newError("", "expected update operators")
+	}
+
+	fields, err := parseObject("", raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 0 {
+		return nil, newError("", "expected at least one update operator")
+	}
+
+	var operations []updateOperation
+	for _, operator := range sortedKeys(fields) {
+		operatorPointer := appendPointer("", operator)
+
+		op, ok := updateOperators[operator]
+		if !ok {
+			return nil, newError(operatorPointer, "unknown update operator `%s`", operator)
+		}
+
+		paths, err := parseObject(operatorPointer, fields[operator])
+		if err != nil {
+			return nil, err
+		}
+
+		if len(paths) == 0 {
+			return nil, newError(operatorPointer, "expected at least one path")
+		}
+
+		for _, key := range sortedKeys(paths) {
+			pointer := appendPointer(operatorPointer, key)
+
+			path, err := ParsePath(key)
+			if err != nil {
+				return nil, newError(pointer, err.Error())
+			}
+
+			operation, err := parseUpdateOperation(pointer, operator, op, path, paths[key])
+			if err != nil {
+				return nil, err
+			}
+
+			err = checkUpdateConflicts(operations, operation)
+			if err != nil {
+				return nil, err
+			}
+
+			operations = append(operations, operation)
+		}
+	}
+
+	return newUpdatePatch(operations), nil
+}
+
+// ForInsert returns the patch to apply to the content of a document being created, where `$setOnInsert`
+// operators are applied like `$set` operators. Other patches are returned as is.
+func (p *Patch) ForInsert() *Patch {
+	if p.operations == nil {
+		return p
+	}
+
+	operations := make([]updateOperation, len(p.operations))
+	for i, operation := range p.operations {
+		if operation.Op == "setOnInsert" {
+			operation.Op = "set"
+		}
+
+		operations[i] = operation
+	}
+
+	return newUpdatePatch(operations)
+}
+
+// Mismatch returns an *Error pointing to the first update operator that cannot be applied to the given
+// content because of the type of a value at its path, or nil when it can be applied. It tells why the
+// database could not apply an update, other patches never mismatch.
+func (p *Patch) Mismatch(content json.RawMessage) error {
+	for _, operation := range p.operations {
+		reason := operation.mismatch(content)
+		if reason != "" {
+			return newError(operation.pointer, reason)
+		}
+	}
+
+	return nil
+}
+
+func newUpdatePatch(operations []updateOperation) *Patch {
+	// The operations only contain valid JSON values, encoding them cannot fail
+	value, _ := json.Marshal(operations)
+
+	return &Patch{function: "jsonb_update", value: value, operations: operations}
+}
+
+func parseUpdateOperation(pointer, operator, op string, path Path, raw json.RawMessage) (updateOperation, error) {
+	operation := updateOperation{Op: op, Path: path, pointer: pointer}
+
+	switch op {
+	case "set", "setOnInsert", "min", "max":
+		operation.Value = compact(raw)
+	case "unset":
+	case "inc", "mul":
+		if jsonType(raw) != "number" {
+			return updateOperation{}, newError(pointer, "`%s` expects a number", operator)
+		}
+
+		operation.Value = compact(raw)
+	case "push", "addToSet":
+		values, err := parseUpdateValues(pointer, raw, "$each")
+		if err != nil {
+			return updateOperation{}, err
+		}
+
+		operation.Value = values
+	case "pull":
+		values, err := parseUpdateValues(pointer, raw, "$in")
+		if err != nil {
+			return updateOperation{}, err
+		}
+
+		operation.Value = values
+	case "rename":
+		var name string
+		if json.Unmarshal(raw, &name) != nil {
+			return updateOperation{}, newError(pointer, "`%s` expects the path to rename the value to", operator)
+		}
+
+		target, err := ParsePath(name)
+		if err != nil {
+			return updateOperation{}, newError(pointer, err.Error())
+		}
+
+		operation.From = path
+		operation.Path = target
+	}
+
+	return operation, nil
+}
+
+// parseUpdateValues parses the values of an operator on arrays, either a single value or an object with
+// the given modifier holding an array of values, into an array of values.
+func parseUpdateValues(pointer string, raw json.RawMessage, modifier string) (json.RawMessage, error) {
+	if jsonType(raw) == "object" {
+		fields, err := parseObject(pointer, raw)
+		if err != nil {
+			return nil, err
+		}
+
+		if list, ok := fields[modifier]; ok {
+			if len(fields) > 1 || jsonType(list) != "array" {
+				return nil, newError(appendPointer(pointer, modifier), "expected an array of values")
+			}
+
+			return compact(list), nil
+		}
+	}
+
+	return json.RawMessage("[" + string(compact(raw)) + "]"), nil
+}
+
+// checkUpdateConflicts checks that the paths changed by an operation are not changed by another operation,
+// including their parents and children.
+func checkUpdateConflicts(operations []updateOperation, operation updateOperation) error {
+	for _, path := range operation.changedPaths() {
+		for _, other := range operations {
+			for _, otherPath := range other.changedPaths() {
+				if path.contains(otherPath) || otherPath.contains(path) {
+					return newError(operation.pointer, "path `%s` conflicts with path `%s` updated at `%s`", path, otherPath, other.pointer)
+				}
+			}
+		}
+	}
+
+	if operation.From != nil && (operation.From.contains(operation.Path) || operation.Path.contains(operation.From)) {
+		return newError(operation.pointer, "path `%s` cannot be renamed to `%s`", operation.From, operation.Path)
+	}
+
+	return nil
+}
+
+// changedPaths returns the paths an operation changes.
+func (o updateOperation) changedPaths() []Path {
+	if o.From != nil {
+		return []Path{o.From, o.Path}
+	}
+
+	return []Path{o.Path}
+}
+
+// mismatch returns why the operation cannot be applied to the content, or an empty string when it can.
+func (o updateOperation) mismatch(content json.RawMessage) string {
+	if o.Op == "setOnInsert" || o.Op == "unset" {
+		return ""
+	}
+
+	if o.Op == "rename" {
+		if _, ok := o.From.Find(content); !ok {
+			return ""
+		}
+	}
+
+	// The values along the path are created as objects when missing
+	for i := range o.Path {
+		parent, ok := o.Path[:i].Find(content)
+		if !ok {
+			break
+		}
+
+		switch jsonType(parent) {
+		case "object":
+			continue
+		case "array":
+			index, err := strconv.Atoi(o.Path[i])
+			if err == nil && index >= 0 && index < len(arrayItems(parent)) {
+				continue
+			}
+
+			return fmt.Sprintf("expected an object at %s or an array containing index `%s`, found an array", describePath(o.Path[:i]), o.Path[i])
+		default:
+			return fmt.Sprintf("expected an object at %s, found %s", describePath(o.Path[:i]), describeType(parent))
+		}
+	}
+
+	current, ok := o.Path.Find(content)
+	if !ok {
+		return ""
+	}
+
+	switch o.Op {
+	case "inc", "mul":
+		if jsonType(current) != "number" {
+			return fmt.Sprintf("expected a number at `%s`, found %s", o.Path, describeType(current))
+		}
+	case "push", "addToSet", "pull":
+		if jsonType(current) != "array" {
+			return fmt.Sprintf("expected an array at `%s`, found %s", o.Path, describeType(current))
+		}
+	case "min", "max":
+		if jsonType(current) != jsonType(o.Value) {
+			return fmt.Sprintf("expected %s at `%s`, found %s", describeType(o.Value), o.Path, describeType(current))
+		}
+	}
+
+	return ""
+}
+
+// contains returns whether the path is the same as the given path or one of its parents.
+func (p Path) contains(other Path) bool {
+	if len(p) > len(other) {
+		return false
+	}
+
+	for i, segment := range p {
+		if other[i] != segment {
+			return false
+		}
+	}
+
+	return true
+}
+
+func arrayItems(raw json.RawMessage) []json.RawMessage {
+	var items []json.RawMessage
+	_ = json.Unmarshal(raw, &items)
+	return items
+}
+
+// describePath returns the path for error messages, the root of the document when empty.
+func describePath(path Path) string {
+	if len(path) == 0 {
+		return "the root of the document"
+	}
+
+	return fmt.Sprintf("`%s`", path)
+}
+
+// describeType returns the type of a JSON value with its article, for error messages.
+func describeType(raw json.RawMessage) string {
+	switch jsonType(raw) {
+	case "object", "array":
+		return "an " + jsonType(raw)
+	case "null":
+		return "null"
+	}
+
+	return "a " + jsonType(raw)
+}
@@ -0,0 +1,201 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-jet/jet/v2/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"encore.app/content/models/generated/content/public/table"
+)
+
+func TestParseUpdate(t *testing.T) {
+	type expected struct {
+		operations string
+		err        *Error
+	}
+
+	tcs := []struct {
+		scenario string
+		update   json.RawMessage
+		expected expected
+	}{
+		{
+			scenario: "Splits the paths of the operators and sorts them",
+			update:   json.RawMessage(`{"$set": {"address.city": "Montreal"}, "$inc": {"views": 1}, "$unset": {"draft": ""}}`),
+			expected: expected{
+				operations: `[{"op":"inc","path":["views"],"value":1},{"op":"set","path":["address","city"],"value":"Montreal"},{"op":"unset","path":["draft"]}]`,
+			},
+		},
+		{
+			scenario: "Turns the values of array operators into arrays",
+			update:   json.RawMessage(`{"$push": {"tags": "new"}, "$addToSet": {"labels": {"$each": ["a", "b"]}}, "$pull": {"scores": {"$in": [1, 2]}}}`),
+			expected: expected{
+				operations: `[{"op":"addToSet","path":["labels"],"value":["a","b"]},{"op":"pull","path":["scores"],"value":[1,2]},{"op":"push","path":["tags"],"value":["new"]}]`,
+			},
+		},
+		{
+			scenario: "Keeps objects pushed without modifiers",
+			update:   json.RawMessage(`{"$push": {"items": {"name": "foo"}}}`),
+			expected: expected{
+				operations: `[{"op":"push","path":["items"],"value":[{"name":"foo"}]}]`,
+			},
+		},
+		{
+			scenario: "Moves renamed values from their original path",
+			update:   json.RawMessage(`{"$rename": {"name": "profile.name"}}`),
+			expected: expected{
+				operations: `[{"op":"rename","path":["profile","name"],"from":["name"]}]`,
+			},
+		},
+		{
+			scenario: "Fails when the update is not an object",
+			update:   json.RawMessage(`[{"$set": {"foo": 1}}]`),
+			expected: expected{
+				err: &Error{Pointer: "", Reason: "expected an object"},
+			},
+		},
+		{
+			scenario: "Fails when the update is empty",
+			update:   json.RawMessage(`{}`),
+			expected: expected{
+				err: &Error{Pointer: "", Reason: "expected at least one update operator"},
+			},
+		},
+		{
+			scenario: "Fails with a pointer to an unknown operator",
+			update:   json.RawMessage(`{"$set": {"foo": 1}, "$append": {"bar": 1}}`),
+			expected: expected{
+				err: &Error{Pointer: "/$append", Reason: "unknown update operator `$append`"},
+			},
+		},
+		{
+			scenario: "Fails when an increment is not a number",
+			update:   json.RawMessage(`{"$inc": {"views": "1"}}`),
+			expected: expected{
+				err: &Error{Pointer: "/$inc/views", Reason: "`$inc` expects a number"},
+			},
+		},
+		{
+			scenario: "Fails when a path is not valid",
+			update:   json.RawMessage(`{"$set": {"address..city": 1}}`),
+			expected: expected{
+				err: &Error{Pointer: "/$set/address..city", Reason: "path `address..city` contains an empty segment"},
+			},
+		},
+		{
+			scenario: "Fails when the values pushed are not an array",
+			update:   json.RawMessage(`{"$push": {"tags": {"$each": "new"}}}`),
+			expected: expected{
+				err: &Error{Pointer: "/$push/tags/$each", Reason: "expected an array of values"},
+			},
+		},
+		{
+			scenario: "Fails when a path is updated by several operators",
+			update:   json.RawMessage(`{"$set": {"address": {}}, "$unset": {"address.city": ""}}`),
+			expected: expected{
+				err: &Error{Pointer: "/$unset/address.city", Reason: "path `address.city` conflicts with path `address` updated at `/$set/address`"},
+			},
+		},
+		{
+			scenario: "Fails when a value is renamed inside itself",
+			update:   json.RawMessage(`{"$rename": {"name": "name.first"}}`),
+			expected: expected{
+				err: &Error{Pointer: "/$rename/name", Reason: "path `name` cannot be renamed to `name.first`"},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			patch, err := ParseUpdate(tc.update)
+			if tc.expected.err != nil {
+				assert.Equal(t, tc.expected.err, err)
+				assert.Nil(t, patch)
+				return
+			}
+
+			require.NoError(t, err)
+			query, args := table.Documents.UPDATE(table.Documents.Content).
+				SET(patch.Apply(table.Documents.Content)).
+				WHERE(table.Documents.ID.EQ(postgres.Int64(1))).
+				Sql()
+
+			assert.Contains(t, query, `jsonb_update(documents.content, $1::jsonb)`)
+			assert.Equal(t, []interface{}{tc.expected.operations, int64(1)}, args)
+		})
+	}
+}
+
+func TestPatchForInsert(t *testing.T) {
+	patch, err := ParseUpdate(json.RawMessage(`{"$setOnInsert": {"createdBy": "foo"}, "$inc": {"visits": 1}}`))
+	require.NoError(t, err)
+
+	_, args := table.Documents.UPDATE(table.Documents.Content).
+		SET(patch.ForInsert().Apply(table.Documents.Content)).
+		WHERE(table.Documents.ID.EQ(postgres.Int64(1))).
+		Sql()
+
+	assert.Equal(t, []interface{}{`[{"op":"inc","path":["visits"],"value":1},{"op":"set","path":["createdBy"],"value":"foo"}]`, int64(1)}, args)
+}
+
+func TestPatchMismatch(t *testing.T) {
+	tcs := []struct {
+		scenario string
+		update   json.RawMessage
+		content  json.RawMessage
+		expected error
+	}{
+		{
+			scenario: "Applies to missing values",
+			update:   json.RawMessage(`{"$inc": {"stats.views": 1}, "$push": {"tags": "new"}}`),
+			content:  json.RawMessage(`{"name": "foo"}`),
+		},
+		{
+			scenario: "Applies to values of the expected type",
+			update:   json.RawMessage(`{"$inc": {"views": 1}, "$max": {"name": "bar"}}`),
+			content:  json.RawMessage(`{"views": 3, "name": "foo"}`),
+		},
+		{
+			scenario: "Does not apply increments to strings",
+			update:   json.RawMessage(`{"$inc": {"views": 1}}`),
+			content:  json.RawMessage(`{"views": "3"}`),
+			expected: &Error{Pointer: "/$inc/views", Reason: "expected a number at `views`, found a string"},
+		},
+		{
+			scenario: "Does not push to objects",
+			update:   json.RawMessage(`{"$push": {"tags": "new"}}`),
+			content:  json.RawMessage(`{"tags": {}}`),
+			expected: &Error{Pointer: "/$push/tags", Reason: "expected an array at `tags`, found an object"},
+		},
+		{
+			scenario: "Does not compare values of different types",
+			update:   json.RawMessage(`{"$min": {"price": 10}}`),
+			content:  json.RawMessage(`{"price": "12"}`),
+			expected: &Error{Pointer: "/$min/price", Reason: "expected a number at `price`, found a string"},
+		},
+		{
+			scenario: "Does not set values inside scalars",
+			update:   json.RawMessage(`{"$set": {"address.city": "Montreal"}}`),
+			content:  json.RawMessage(`{"address": "Montreal"}`),
+			expected: &Error{Pointer: "/$set/address.city", Reason: "expected an object at `address`, found a string"},
+		},
+		{
+			scenario: "Does not set values outside of arrays",
+			update:   json.RawMessage(`{"$set": {"tags.2": "new"}}`),
+			content:  json.RawMessage(`{"tags": ["a"]}`),
+			expected: &Error{Pointer: "/$set/tags.2", Reason: "expected an object at `tags` or an array containing index `2`, found an array"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			patch, err := ParseUpdate(tc.update)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expected, patch.Mismatch(tc.content))
+		})
+	}
+}
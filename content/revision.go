@@ -0,0 +1,159 @@
+package content
+
+import (
+	"context"
+
+	"encore.app/content/convert"
+	"encore.app/content/internal"
+	"encore.app/content/query"
+	"encore.app/pagination"
+	"encore.dev/types/uuid"
+)
+
+// ListDocumentRevisionsParams is the parameters for listing the revisions of a document
+type ListDocumentRevisionsParams struct {
+	// The unique identifier of the document, its collection must keep the history of its documents
+	DocumentID int64
+
+	// The maximum number of revisions to return, defaults to 100 and cannot exceed 1000
+	Limit int
+
+	// The cursor returned as `NextCursor` by the previous call, to fetch the next page of revisions
+	Cursor string
+}
+
+// ListDocumentRevisionsResponse is a page of the revisions of a document
+type ListDocumentRevisionsResponse struct {
+	// The revisions of the document, from the most recent one
+	Revisions []convert.RevisionPayload
+
+	// The cursor to give to the next call to fetch the next page of revisions, empty when there are
+	// no more revisions to fetch
+	NextCursor string
+}
+
+// ListDocumentRevisions lists the revisions of a document for the authenticated user, one page at a time.
+// Every committed version of the documents of a collection is kept once its history is turned on, along
+// with the API key that wrote it.
+//encore:api auth
+func ListDocumentRevisions(ctx context.Context, params *ListDocumentRevisionsParams) (*ListDocumentRevisionsResponse, error) {
+	revisions, nextCursor, err := internal.ListDocumentRevisions(ctx, params.DocumentID, pagination.Params{
+		Limit:  params.Limit,
+		Cursor: params.Cursor,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListDocumentRevisionsResponse{
+		Revisions:  revisions,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// GetDocumentRevisionParams is the parameters for fetching a revision of a document
+type GetDocumentRevisionParams struct {
+	// The unique identifier of the document
+	DocumentID int64
+
+	// The version of the document to fetch
+	Version int64
+}
+
+// GetDocumentRevisionResponse is the result of fetching a revision of a document
+type GetDocumentRevisionResponse struct {
+	// The revision of the document
+	Revision convert.RevisionPayload
+}
+
+// GetDocumentRevision fetches the content of a document at a given version for the authenticated user.
+//encore:api auth
+func GetDocumentRevision(ctx context.Context, params *GetDocumentRevisionParams) (*GetDocumentRevisionResponse, error) {
+	revision, err := internal.GetDocumentRevision(ctx, params.DocumentID, params.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GetDocumentRevisionResponse{
+		Revision: revision,
+	}, nil
+}
+
+// DiffDocumentRevisionsParams is the parameters for comparing two revisions of a document
+type DiffDocumentRevisionsParams struct {
+	// The unique identifier of the document
+	DocumentID int64
+
+	// The version of the document to compare from
+	From int64
+
+	// The version of the document to compare to
+	To int64
+}
+
+// DiffDocumentRevisionsResponse is the difference between two revisions of a document
+type DiffDocumentRevisionsResponse struct {
+	// The JSON Patch operations transforming the content of the document at the From version into its
+	// content at the To version, empty when the contents are equal
+	Operations []query.DiffOperation
+}
+
+// DiffDocumentRevisions compares the content of a document at two versions for the authenticated user. The
+// difference is returned as a JSON Patch, which can be given to PatchDocument.
+//encore:api auth
+func DiffDocumentRevisions(ctx context.Context, params *DiffDocumentRevisionsParams) (*DiffDocumentRevisionsResponse, error) {
+	operations, err := internal.DiffDocumentRevisions(ctx, params.DocumentID, params.From, params.To)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DiffDocumentRevisionsResponse{
+		Operations: operations,
+	}, nil
+}
+
+// RestoreDocumentRevisionParams is the parameters for restoring a revision of a document
+type RestoreDocumentRevisionParams struct {
+	// The unique identifier of the document
+	DocumentID int64
+
+	// The version of the document to restore
+	Version int64
+
+	// The version the document is expected to be at. When given, the operation fails if the document
+	// was modified since that version, with the current version in the details of the error
+	IfVersion *int64
+
+	// The key of a transaction to run the operation in, changes made in a transaction are only visible
+	// in that transaction until it is committed
+	TransactionKey uuid.UUID
+}
+
+// RestoreDocumentRevisionResponse is the result of restoring a revision of a document
+type RestoreDocumentRevisionResponse struct {
+	// A message to inform the user of the result of the operation
+	Message string
+
+	// The restored document
+	Document convert.DocumentPayload
+}
+
+// RestoreDocumentRevision sets the content of a document back to its content at a given version for the
+// authenticated user. The restored content is saved as a new version, the history is never rewritten.
+//encore:api auth
+func RestoreDocumentRevision(ctx context.Context, params *RestoreDocumentRevisionParams) (*RestoreDocumentRevisionResponse, error) {
+	ctx, err := internal.WithTransaction(ctx, params.TransactionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := internal.RestoreDocumentRevision(ctx, params.DocumentID, params.Version, params.IfVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RestoreDocumentRevisionResponse{
+		Message:  "Document restored successfully.",
+		Document: document,
+	}, nil
+}
@@ -0,0 +1,357 @@
+package content
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"encore.dev/beta/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"encore.app/content/internal"
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/test_utils"
+	test_utils_permissions "encore.app/permissions/test_utils"
+	test_utils2 "encore.app/test_utils"
+)
+
+// revisionsContext creates a context for an API key that can write to a database with a collection keeping the
+// history of its documents, and a collection that does not. The document with ID 4 is written three times in the
+// first collection: inserted as `{"title": "Draft", "tags": ["a"]}`, then updated twice by the API key.
+func revisionsContext(t *testing.T) context.Context {
+	now := time.Now()
+
+	f := articlesFixture("write")
+	f.collections[0].History = true
+	f.documents = []*model.Documents{
+		{
+			ID:           4,
+			CollectionID: 2,
+			Content:      `{"title": "Draft", "tags": ["a"]}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ID:           5,
+			CollectionID: 3,
+			Content:      `{"title": "Note"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+	}
+
+	ctx := fixtureContext(t, f)
+
+	for _, content := range []string{`{"title": "Review", "tags": ["a"]}`, `{"title": "Published", "tags": ["a", "b"]}`} {
+		_, err := UpdateDocument(ctx, &UpdateDocumentParams{
+			ID:      4,
+			Content: json.RawMessage(content),
+		})
+		require.NoError(t, err)
+	}
+
+	return ctx
+}
+
+func TestListDocumentRevisions(t *testing.T) {
+	type expected struct {
+		versions   []int64
+		createdBy  []int64
+		nextCursor bool
+		err        error
+	}
+
+	tcs := []struct {
+		scenario string
+		params   *ListDocumentRevisionsParams
+		expected expected
+	}{
+		{
+			scenario: "Lists the revisions of a document from the most recent one, with the API key that wrote them",
+			params: &ListDocumentRevisionsParams{
+				DocumentID: 4,
+			},
+			expected: expected{
+				versions:  []int64{3, 2, 1},
+				createdBy: []int64{1, 1, 0},
+			},
+		},
+		{
+			scenario: "Lists a page of the revisions of a document",
+			params: &ListDocumentRevisionsParams{
+				DocumentID: 4,
+				Limit:      2,
+			},
+			expected: expected{
+				versions:   []int64{3, 2},
+				createdBy:  []int64{1, 1},
+				nextCursor: true,
+			},
+		},
+		{
+			scenario: "Throws an error when the collection does not keep the history of its documents",
+			params: &ListDocumentRevisionsParams{
+				DocumentID: 5,
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.FailedPrecondition,
+					Message: "Collection does not keep the history of its documents",
+				},
+			},
+		},
+		{
+			scenario: "Throws an error when the document does not exist",
+			params: &ListDocumentRevisionsParams{
+				DocumentID: 99,
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.NotFound,
+					Message: "Could not find document",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := revisionsContext(t)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			response, err := ListDocumentRevisions(ctx, tc.params)
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+				return
+			}
+
+			require.NoError(t, err)
+			versions := make([]int64, len(response.Revisions))
+			createdBy := make([]int64, len(response.Revisions))
+			for i, revision := range response.Revisions {
+				versions[i] = revision.Version
+				createdBy[i] = revision.CreatedBy
+			}
+
+			assert.Equal(t, tc.expected.versions, versions)
+			assert.Equal(t, tc.expected.createdBy, createdBy)
+			assert.Equal(t, tc.expected.nextCursor, response.NextCursor != "")
+		})
+	}
+}
+
+func TestGetDocumentRevision(t *testing.T) {
+	type expected struct {
+		content string
+		err     error
+	}
+
+	tcs := []struct {
+		scenario string
+		params   *GetDocumentRevisionParams
+		expected expected
+	}{
+		{
+			scenario: "Returns the content of a document at a version",
+			params: &GetDocumentRevisionParams{
+				DocumentID: 4,
+				Version:    2,
+			},
+			expected: expected{
+				content: `{"title": "Review", "tags": ["a"]}`,
+			},
+		},
+		{
+			scenario: "Throws an error when the version was not recorded",
+			params: &GetDocumentRevisionParams{
+				DocumentID: 4,
+				Version:    9,
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.NotFound,
+					Message: "Could not find version 9 of the document",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := revisionsContext(t)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			response, err := GetDocumentRevision(ctx, tc.params)
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+				return
+			}
+
+			require.NoError(t, err)
+			var content string
+			require.NoError(t, json.Unmarshal(response.Revision.Content, &content))
+			assert.JSONEq(t, tc.expected.content, content)
+			assert.Equal(t, tc.params.Version, response.Revision.Version)
+		})
+	}
+}
+
+func TestDiffDocumentRevisions(t *testing.T) {
+	type expected struct {
+		operations string
+		err        error
+	}
+
+	tcs := []struct {
+		scenario string
+		params   *DiffDocumentRevisionsParams
+		expected expected
+	}{
+		{
+			scenario: "Returns the JSON Patch between two versions of a document",
+			params: &DiffDocumentRevisionsParams{
+				DocumentID: 4,
+				From:       1,
+				To:         3,
+			},
+			expected: expected{
+				operations: `[{"op":"replace","path":"/tags","value":["a","b"]},{"op":"replace","path":"/title","value":"Published"}]`,
+			},
+		},
+		{
+			scenario: "Returns no operations when comparing a version to itself",
+			params: &DiffDocumentRevisionsParams{
+				DocumentID: 4,
+				From:       2,
+				To:         2,
+			},
+			expected: expected{
+				operations: `[]`,
+			},
+		},
+		{
+			scenario: "Throws an error when a version was not recorded",
+			params: &DiffDocumentRevisionsParams{
+				DocumentID: 4,
+				From:       1,
+				To:         9,
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.NotFound,
+					Message: "Could not find version 9 of the document",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := revisionsContext(t)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			response, err := DiffDocumentRevisions(ctx, tc.params)
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+				return
+			}
+
+			require.NoError(t, err)
+			operations, err := json.Marshal(response.Operations)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected.operations, string(operations))
+		})
+	}
+}
+
+func TestRestoreDocumentRevision(t *testing.T) {
+	type expected struct {
+		content string
+		version int64
+		err     error
+	}
+
+	tcs := []struct {
+		scenario string
+		params   *RestoreDocumentRevisionParams
+		expected expected
+	}{
+		{
+			scenario: "Restores the content of a document at a version as a new version",
+			params: &RestoreDocumentRevisionParams{
+				DocumentID: 4,
+				Version:    1,
+			},
+			expected: expected{
+				content: `{"title": "Draft", "tags": ["a"]}`,
+				version: 4,
+			},
+		},
+		{
+			scenario: "Restores a version when the document is at the expected version",
+			params: &RestoreDocumentRevisionParams{
+				DocumentID: 4,
+				Version:    2,
+				IfVersion:  test_utils.Int64Pointer(3),
+			},
+			expected: expected{
+				content: `{"title": "Review", "tags": ["a"]}`,
+				version: 4,
+			},
+		},
+		{
+			scenario: "Throws an error when the document is not at the expected version",
+			params: &RestoreDocumentRevisionParams{
+				DocumentID: 4,
+				Version:    1,
+				IfVersion:  test_utils.Int64Pointer(2),
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.FailedPrecondition,
+					Message: "Document was modified, its current version is 3",
+					Details: &internal.VersionMismatch{
+						CurrentVersion: 3,
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := revisionsContext(t)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			response, err := RestoreDocumentRevision(ctx, tc.params)
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected.version, response.Document.Version)
+
+			revision, err := GetDocumentRevision(ctx, &GetDocumentRevisionParams{
+				DocumentID: tc.params.DocumentID,
+				Version:    tc.expected.version,
+			})
+			require.NoError(t, err)
+
+			var content string
+			require.NoError(t, json.Unmarshal(revision.Revision.Content, &content))
+			assert.JSONEq(t, tc.expected.content, content)
+			assert.Equal(t, int64(1), revision.Revision.CreatedBy)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package content
+
+import (
+	"context"
+	"time"
+
+	"encore.app/content/internal"
+)
+
+// scheduler runs the periodic jobs of the content service in the background of every instance.
+var scheduler = internal.NewScheduler(
+	internal.ScheduledJob{
+		Name:     "sweep-expired-transactions",
+		Interval: 5 * time.Minute,
+		Run: func(ctx context.Context) error {
+			_, err := internal.SweepExpiredTransactions(ctx)
+			return err
+		},
+	},
+	internal.ScheduledJob{
+		Name:     "sweep-trash",
+		Interval: 24 * time.Hour,
+		Run: func(ctx context.Context) error {
+			_, err := internal.SweepTrash(ctx)
+			return err
+		},
+	},
+	internal.ScheduledJob{
+		Name:     "sweep-expired-changes",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			_, err := internal.SweepExpiredChanges(ctx)
+			return err
+		},
+	},
+	internal.ScheduledJob{
+		Name:     "sweep-expired-content-events",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			_, err := internal.SweepExpiredContentEvents(ctx)
+			return err
+		},
+	},
+	internal.ScheduledJob{
+		Name:     "resume-index-builds",
+		Interval: time.Minute,
+		Run: func(ctx context.Context) error {
+			_, err := internal.ResumeIndexBuilds(ctx)
+			return err
+		},
+	},
+	internal.ScheduledJob{
+		Name:     "deliver-webhooks",
+		Interval: 5 * time.Second,
+		Run: func(ctx context.Context) error {
+			_, _, _, err := internal.DeliverWebhooks(ctx, webhookPolicy)
+			return err
+		},
+	},
+)
+
+func init() {
+	scheduler.Start()
+}
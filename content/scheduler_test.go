@@ -0,0 +1,13 @@
+package content
+
+import (
+	"os"
+	"testing"
+)
+
+// TestMain stops the scheduler started with the service, so that the jobs only run when a test calls them or
+// starts the scheduler.
+func TestMain(m *testing.M) {
+	scheduler.Stop()
+	os.Exit(m.Run())
+}
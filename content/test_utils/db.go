@@ -11,7 +11,8 @@ var db = sqldb.Named("content").Stdlib()
 
 func Cleanup(ctx context.Context) error {
 	query := `
-		TRUNCATE documents, collections, databases;
+		DELETE FROM collection_indexes;
+		TRUNCATE content_events, expired_transactions, webhook_deliveries, webhooks, document_changes, document_revisions, transaction_document_versions, transactional_documents, transactional_collections, transactions, documents, collections, databases;
 	`
 
 	_, err := db.ExecContext(ctx, query)
@@ -1,5 +1,19 @@
 package test_utils
 
+import "time"
+
 func StringPointer(val string) *string {
 	return &val
 }
+
+func IntPointer(val int) *int {
+	return &val
+}
+
+func Int64Pointer(val int64) *int64 {
+	return &val
+}
+
+func TimePointer(val time.Time) *time.Time {
+	return &val
+}
@@ -0,0 +1,58 @@
+package test_utils
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// WebhookTestRequest is a request received by a WebhookTestReceiver.
+type WebhookTestRequest struct {
+	Header http.Header
+	Body   []byte
+}
+
+// WebhookTestReceiver is a webhook receiving the deliveries of changes in tests. It records the requests it
+// receives, and responds with the status given to RespondWith.
+type WebhookTestReceiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []WebhookTestRequest
+}
+
+func CreateTestWebhookReceiver() (*httptest.Server, *WebhookTestReceiver) {
+	handler := &WebhookTestReceiver{
+		status: http.StatusOK,
+	}
+	server := httptest.NewServer(handler)
+
+	return server, handler
+}
+
+func (r *WebhookTestReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests = append(r.requests, WebhookTestRequest{
+		Header: req.Header.Clone(),
+		Body:   body,
+	})
+	w.WriteHeader(r.status)
+}
+
+func (r *WebhookTestReceiver) RespondWith(statusCode int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.status = statusCode
+}
+
+func (r *WebhookTestReceiver) Requests() []WebhookTestRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]WebhookTestRequest(nil), r.requests...)
+}
@@ -2,6 +2,7 @@ package content
 
 import (
 	"context"
+	"time"
 
 	"encore.app/content/convert"
 	"encore.app/content/internal"
@@ -11,7 +12,7 @@ import (
 // StartTransactionParams is the info needed to start a transaction on a user
 type StartTransactionParams struct {
 	// The unique identifier for the database to open a transaction for
-	DatabaseID uuid.UUID
+	DatabaseID int64
 }
 
 // StartTransactionResponse is the transaction to be used when creating content in this database
@@ -19,12 +20,15 @@ type StartTransactionResponse struct {
 	// The unique identifier of the transaction, all requests to the database identified with this
 	// key will run on the transaction.
 	TransactionKey uuid.UUID
+
+	// The time after which the transaction can no longer be used, its changes are then discarded
+	ExpiresAt time.Time
 }
 
 // StartTransaction starts a transaction on a database. A transaction is an isolated version of the database
 // where all actions run on the data from that database and the transaction. All actions taken outside that
 // transaction do not see the changes from that transaction until it is committed. A transaction can also be rolled back,
-// which deletes it without applying it. Transactions are automatically rolled back after 10 minutes.
+// which deletes it without applying it. Transactions expire after 10 minutes, their changes are then discarded.
 //encore:api auth
 func StartTransaction(ctx context.Context, params *StartTransactionParams) (*StartTransactionResponse, error) {
 	transaction, err := internal.StartTransaction(ctx, params.DatabaseID)
@@ -33,7 +37,8 @@ func StartTransaction(ctx context.Context, params *StartTransactionParams) (*Sta
 	}
 
 	return &StartTransactionResponse{
-		TransactionKey: transaction.ID,
+		TransactionKey: transaction.Key,
+		ExpiresAt:      transaction.ExpiresAt,
 	}, nil
 }
 
@@ -41,6 +46,10 @@ func StartTransaction(ctx context.Context, params *StartTransactionParams) (*Sta
 type CommitTransactionParams struct {
 	// The unique identifier of the database
 	TransactionKey uuid.UUID
+
+	// Whether to commit even if documents read or written in the transaction were modified outside of it,
+	// overwriting those modifications
+	Force bool
 }
 
 // CommitTransactionResponse is the result of a transaction commit
@@ -50,10 +59,14 @@ type CommitTransactionResponse struct {
 }
 
 // CommitTransaction Finds a transaction by key and commits all its changes, deleting it in the process.
-// A commit may fail, which will still trigger the transaction delete, but will not apply the changes.
+// A commit may fail without applying any change, the transaction is then kept and can be committed again.
+// A commit is refused when a document of the transaction has the same key or the same values on a unique
+// index as a document written outside of it, the conflicting document is reported. A commit is also refused
+// when documents read or written in the transaction were modified outside of it since, it can then be
+// committed again with Force to overwrite those modifications.
 //encore:api auth
 func CommitTransaction(ctx context.Context, params *CommitTransactionParams) (*CommitTransactionResponse, error) {
-	database, err := internal.CommitTransaction(ctx, params.TransactionKey)
+	database, err := internal.CommitTransaction(ctx, params.TransactionKey, params.Force)
 	if err != nil {
 		return nil, err
 	}
@@ -86,6 +99,27 @@ func RollbackTransaction(ctx context.Context, params *RollbackTransactionParams)
 	}
 
 	return &RollbackTransactionResponse{
-		TransactionKey: transaction.ID,
+		TransactionKey: transaction.Key,
+	}, nil
+}
+
+// SweepExpiredTransactionsResponse is the result of a sweep of the expired transactions
+type SweepExpiredTransactionsResponse struct {
+	// The number of expired transactions deleted
+	Deleted int64
+}
+
+// SweepExpiredTransactions deletes all the transactions that have expired, along with their changes.
+// Expired transactions can no longer be used, but are only deleted by this sweep, which the service runs
+// every 5 minutes. Using the key of a deleted transaction still fails as expired for 7 days.
+//encore:api private
+func SweepExpiredTransactions(ctx context.Context) (*SweepExpiredTransactionsResponse, error) {
+	deleted, err := internal.SweepExpiredTransactions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SweepExpiredTransactionsResponse{
+		Deleted: deleted,
 	}, nil
 }
@@ -0,0 +1,881 @@
+package content
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+	"encore.dev/types/uuid"
+	"github.com/go-jet/jet/v2/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"encore.app/content/convert"
+	"encore.app/content/internal"
+	"encore.app/content/models"
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/models/generated/content/public/table"
+	"encore.app/content/test_utils"
+	"encore.app/identity"
+	"encore.app/permissions"
+	test_utils_permissions "encore.app/permissions/test_utils"
+	test_utils2 "encore.app/test_utils"
+)
+
+func TestStartTransaction(t *testing.T) {
+	now := time.Now()
+
+	type expected struct {
+		err error
+	}
+
+	existingDatabase := &model.Databases{
+		ID:        1,
+		Name:      "test",
+		UserID:    1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	tcs := []struct {
+		scenario string
+		userData *identity.UserData
+		userCan  *string
+		params   *StartTransactionParams
+		expected expected
+	}{
+		{
+			scenario: "Will start a transaction on the database",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &StartTransactionParams{
+				DatabaseID: existingDatabase.ID,
+			},
+		},
+		{
+			scenario: "Will throw an error when the database does not exist",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			params: &StartTransactionParams{
+				DatabaseID: -1,
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.NotFound,
+					Message: "Could not find database",
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when the key cannot write to the database",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			params: &StartTransactionParams{
+				DatabaseID: existingDatabase.ID,
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.PermissionDenied,
+					Message: "API key doesn't have the ability to write to the database",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(tc.userData.ID, 10)), tc.userData)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := insertDatabases(ctx, []*model.Databases{existingDatabase})
+			require.NoError(t, err)
+
+			if tc.userCan != nil {
+				_, err := permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+					KeyID:      1,
+					DatabaseID: &existingDatabase.ID,
+					UserID:     1,
+					Role:       *tc.userCan,
+				})
+				require.NoError(t, err)
+			}
+
+			response, err := StartTransaction(ctx, tc.params)
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+			} else {
+				require.NoError(t, err)
+				assert.NotEqual(t, uuid.Nil, response.TransactionKey)
+				assert.True(t, response.ExpiresAt.After(now))
+			}
+		})
+	}
+}
+
+func TestTransactionKey(t *testing.T) {
+	now := time.Now()
+
+	type expected struct {
+		err error
+	}
+
+	existingDatabases := []*model.Databases{
+		{
+			ID:        1,
+			Name:      "test",
+			UserID:    1,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		{
+			ID:        2,
+			Name:      "other",
+			UserID:    1,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+	}
+
+	// IDs are kept away from the sequences, documents created in a transaction take their ID from them
+	validCollection := &model.Collections{
+		ID:         1000001,
+		DatabaseID: existingDatabases[0].ID,
+		Name:       "test",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	tcs := []struct {
+		scenario          string
+		userData          *identity.UserData
+		transactionOn     int64
+		useTransactionKey bool
+		expired           bool
+		expected          expected
+	}{
+		{
+			scenario: "Will create the document in the transaction only",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			transactionOn:     existingDatabases[0].ID,
+			useTransactionKey: true,
+		},
+		{
+			scenario: "Will throw an error when the transaction does not exist",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			transactionOn: existingDatabases[0].ID,
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.NotFound,
+					Message: "Could not find transaction",
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when the transaction has expired",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			transactionOn:     existingDatabases[0].ID,
+			useTransactionKey: true,
+			expired:           true,
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.FailedPrecondition,
+					Message: "Transaction has expired, start a new transaction",
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when the transaction was started on another database",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			transactionOn:     existingDatabases[1].ID,
+			useTransactionKey: true,
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: "Transaction was started on another database",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(tc.userData.ID, 10)), tc.userData)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := insertDatabases(ctx, existingDatabases)
+			require.NoError(t, err)
+
+			err = insertCollections(ctx, []*model.Collections{validCollection})
+			require.NoError(t, err)
+
+			for _, database := range existingDatabases {
+				_, err := permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+					KeyID:      1,
+					DatabaseID: &database.ID,
+					UserID:     1,
+					Role:       "write",
+				})
+				require.NoError(t, err)
+			}
+
+			transaction, err := StartTransaction(ctx, &StartTransactionParams{DatabaseID: tc.transactionOn})
+			require.NoError(t, err)
+
+			if tc.expired {
+				err = expireTransaction(ctx, transaction.TransactionKey)
+				require.NoError(t, err)
+			}
+
+			key := uuid.Must(uuid.NewV4())
+			if tc.useTransactionKey {
+				key = transaction.TransactionKey
+			}
+
+			response, err := CreateDocument(ctx, &CreateDocumentParams{
+				CollectionID:   validCollection.ID,
+				Content:        json.RawMessage(`{"foo": "bar"}`),
+				TransactionKey: key,
+			})
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+				return
+			}
+			require.NoError(t, err)
+
+			_, err = GetDocument(ctx, &GetDocumentParams{ID: response.Document.ID})
+			test_utils2.CompareErrors(t, &errs.Error{
+				Code:    errs.NotFound,
+				Message: "Could not find document",
+			}, err)
+
+			found, err := GetDocument(ctx, &GetDocumentParams{ID: response.Document.ID, TransactionKey: key})
+			require.NoError(t, err)
+			assert.Equal(t, string(response.Document.Content), string(found.Document.Content))
+		})
+	}
+}
+
+func TestCommitTransaction(t *testing.T) {
+	now := time.Now()
+
+	type expected struct {
+		documents []convert.DocumentPayload
+		err       error
+	}
+
+	existingDatabase := &model.Databases{
+		ID:        1,
+		Name:      "test",
+		UserID:    1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	// IDs are kept away from the sequences, documents created in a transaction take their ID from them
+	validCollection := &model.Collections{
+		ID:         1000001,
+		DatabaseID: existingDatabase.ID,
+		Name:       "test",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	existingDocuments := []*model.Documents{
+		{
+			ID:           1000002,
+			CollectionID: validCollection.ID,
+			Content:      `{"foo": "bar"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ID:           1000003,
+			CollectionID: validCollection.ID,
+			Content:      `{"bar": "foo"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+	}
+
+	tcs := []struct {
+		scenario string
+		userData *identity.UserData
+		userCan  *string
+		changes  func(ctx context.Context, key uuid.UUID) error
+		outside  func(ctx context.Context) error
+		commit   bool
+		force    bool
+		expected expected
+	}{
+		{
+			scenario: "Will apply the changes of the transaction on commit",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			changes: func(ctx context.Context, key uuid.UUID) error {
+				_, err := CreateDocument(ctx, &CreateDocumentParams{
+					CollectionID:   validCollection.ID,
+					Content:        json.RawMessage(`{"baz": "qux"}`),
+					TransactionKey: key,
+				})
+				if err != nil {
+					return err
+				}
+
+				_, err = UpdateDocument(ctx, &UpdateDocumentParams{
+					ID:             existingDocuments[0].ID,
+					Content:        json.RawMessage(`{"foo": "baz"}`),
+					TransactionKey: key,
+				})
+				if err != nil {
+					return err
+				}
+
+				_, err = DeleteDocument(ctx, &DeleteDocumentParams{
+					ID:             existingDocuments[1].ID,
+					TransactionKey: key,
+				})
+				return err
+			},
+			commit: true,
+			expected: expected{
+				documents: []convert.DocumentPayload{
+					{
+						ID:      existingDocuments[0].ID,
+						Content: json.RawMessage(`"{\"foo\": \"baz\"}"`),
+					},
+					{
+						Content: json.RawMessage(`"{\"baz\": \"qux\"}"`),
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will not apply the changes of the transaction before commit",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			changes: func(ctx context.Context, key uuid.UUID) error {
+				_, err := DeleteDocument(ctx, &DeleteDocumentParams{
+					ID:             existingDocuments[1].ID,
+					TransactionKey: key,
+				})
+				return err
+			},
+			expected: expected{
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+		{
+			scenario: "Will refuse to commit when a document written in the transaction was modified outside of it",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			changes: func(ctx context.Context, key uuid.UUID) error {
+				_, err := UpdateDocument(ctx, &UpdateDocumentParams{
+					ID:             existingDocuments[0].ID,
+					Content:        json.RawMessage(`{"foo": "baz"}`),
+					TransactionKey: key,
+				})
+				return err
+			},
+			outside: func(ctx context.Context) error {
+				_, err := UpdateDocument(ctx, &UpdateDocumentParams{
+					ID:      existingDocuments[0].ID,
+					Content: json.RawMessage(`{"foo": "qux"}`),
+				})
+				return err
+			},
+			commit: true,
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.Aborted,
+					Message: "Could not commit transaction, 1 documents were modified outside of it",
+					Details: &internal.TransactionConflicts{
+						Conflicts: []models.DocumentConflict{
+							{
+								DocumentID:      existingDocuments[0].ID,
+								ExpectedVersion: 1,
+								ActualVersion:   2,
+							},
+						},
+					},
+				},
+				documents: []convert.DocumentPayload{
+					{
+						ID:      existingDocuments[0].ID,
+						Content: json.RawMessage(`"{\"foo\": \"qux\"}"`),
+					},
+					{
+						ID:      existingDocuments[1].ID,
+						Content: json.RawMessage(`"{\"bar\": \"foo\"}"`),
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will refuse to commit when a document read in the transaction was deleted outside of it",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			changes: func(ctx context.Context, key uuid.UUID) error {
+				_, err := GetDocument(ctx, &GetDocumentParams{
+					ID:             existingDocuments[1].ID,
+					TransactionKey: key,
+				})
+				return err
+			},
+			outside: func(ctx context.Context) error {
+				_, err := DeleteDocument(ctx, &DeleteDocumentParams{
+					ID: existingDocuments[1].ID,
+				})
+				return err
+			},
+			commit: true,
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.Aborted,
+					Message: "Could not commit transaction, 1 documents were modified outside of it",
+					Details: &internal.TransactionConflicts{
+						Conflicts: []models.DocumentConflict{
+							{
+								DocumentID:      existingDocuments[1].ID,
+								ExpectedVersion: 1,
+								ActualVersion:   0,
+							},
+						},
+					},
+				},
+				documents: convertDocuments(t, existingDocuments[:1]),
+			},
+		},
+		{
+			scenario: "Will overwrite the modifications made outside of the transaction when forced",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("write"),
+			changes: func(ctx context.Context, key uuid.UUID) error {
+				_, err := UpdateDocument(ctx, &UpdateDocumentParams{
+					ID:             existingDocuments[0].ID,
+					Content:        json.RawMessage(`{"foo": "baz"}`),
+					TransactionKey: key,
+				})
+				return err
+			},
+			outside: func(ctx context.Context) error {
+				_, err := UpdateDocument(ctx, &UpdateDocumentParams{
+					ID:      existingDocuments[0].ID,
+					Content: json.RawMessage(`{"foo": "qux"}`),
+				})
+				return err
+			},
+			commit: true,
+			force:  true,
+			expected: expected{
+				documents: []convert.DocumentPayload{
+					{
+						ID:      existingDocuments[0].ID,
+						Content: json.RawMessage(`"{\"foo\": \"baz\"}"`),
+					},
+					{
+						ID:      existingDocuments[1].ID,
+						Content: json.RawMessage(`"{\"bar\": \"foo\"}"`),
+					},
+				},
+			},
+		},
+		{
+			scenario: "Will throw an error when the key cannot write to the database",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			userCan: test_utils.StringPointer("read"),
+			commit:  true,
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.PermissionDenied,
+					Message: "API key doesn't have the ability to write to the database",
+				},
+				documents: convertDocuments(t, existingDocuments),
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(tc.userData.ID, 10)), tc.userData)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := insertDatabases(ctx, []*model.Databases{existingDatabase})
+			require.NoError(t, err)
+
+			err = insertCollections(ctx, []*model.Collections{validCollection})
+			require.NoError(t, err)
+
+			err = insertDocuments(ctx, existingDocuments)
+			require.NoError(t, err)
+
+			permissionSet, err := permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+				KeyID:      1,
+				DatabaseID: &existingDatabase.ID,
+				UserID:     1,
+				Role:       "write",
+			})
+			require.NoError(t, err)
+
+			transaction, err := StartTransaction(ctx, &StartTransactionParams{DatabaseID: existingDatabase.ID})
+			require.NoError(t, err)
+
+			if tc.changes != nil {
+				err = tc.changes(ctx, transaction.TransactionKey)
+				require.NoError(t, err)
+			}
+
+			if tc.outside != nil {
+				err = tc.outside(ctx)
+				require.NoError(t, err)
+			}
+
+			if *tc.userCan != "write" {
+				_, err = permissions.RemovePermissionSet(ctx, &permissions.RemovePermissionSetParams{
+					ID: permissionSet.PermissionSet.ID,
+				})
+				require.NoError(t, err)
+
+				_, err = permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+					KeyID:      1,
+					DatabaseID: &existingDatabase.ID,
+					UserID:     1,
+					Role:       *tc.userCan,
+				})
+				require.NoError(t, err)
+			}
+
+			if tc.commit {
+				response, err := CommitTransaction(ctx, &CommitTransactionParams{
+					TransactionKey: transaction.TransactionKey,
+					Force:          tc.force,
+				})
+				if tc.expected.err != nil {
+					test_utils2.CompareErrors(t, tc.expected.err, err)
+					assert.Nil(t, response)
+				} else {
+					require.NoError(t, err)
+					assert.Equal(t, existingDatabase.ID, response.Database.ID)
+				}
+			}
+
+			documents, err := ListDocuments(ctx, &ListDocumentsParams{CollectionID: validCollection.ID})
+			require.NoError(t, err)
+			compareDocumentContents(t, tc.expected.documents, documents.Documents)
+		})
+	}
+}
+
+func TestCommitTransactionUniqueConflict(t *testing.T) {
+	ctx := fixtureContext(t, articlesFixture("write"))
+	defer test_utils.Cleanup(ctx)
+	defer test_utils_permissions.Cleanup(ctx)
+
+	transaction, err := StartTransaction(ctx, &StartTransactionParams{DatabaseID: 1})
+	require.NoError(t, err)
+
+	created, err := CreateDocument(ctx, &CreateDocumentParams{
+		CollectionID:   2,
+		Key:            "baz",
+		Content:        json.RawMessage(`{"baz": "qux"}`),
+		TransactionKey: transaction.TransactionKey,
+	})
+	require.NoError(t, err)
+
+	outside, err := CreateDocument(ctx, &CreateDocumentParams{
+		CollectionID: 2,
+		Key:          "baz",
+		Content:      json.RawMessage(`{"baz": "quux"}`),
+	})
+	require.NoError(t, err)
+
+	_, err = CommitTransaction(ctx, &CommitTransactionParams{TransactionKey: transaction.TransactionKey})
+	test_utils2.CompareErrors(t, &errs.Error{
+		Code:    errs.AlreadyExists,
+		Message: fmt.Sprintf("Could not commit transaction, document %d conflicts with a document written outside of it: A document with key `baz` already exists in this collection", created.Document.ID),
+		Details: &internal.TransactionUniqueConflict{DocumentID: created.Document.ID},
+	}, err)
+
+	// The transaction is kept, it can be committed once the conflict is resolved
+	_, err = DeleteDocument(ctx, &DeleteDocumentParams{ID: outside.Document.ID})
+	require.NoError(t, err)
+
+	_, err = CommitTransaction(ctx, &CommitTransactionParams{TransactionKey: transaction.TransactionKey})
+	require.NoError(t, err)
+
+	document, err := GetDocument(ctx, &GetDocumentParams{ID: created.Document.ID})
+	require.NoError(t, err)
+	assert.Equal(t, `"{\"baz\": \"qux\"}"`, string(document.Document.Content))
+}
+
+func TestRollbackTransaction(t *testing.T) {
+	now := time.Now()
+
+	existingDatabase := &model.Databases{
+		ID:        1,
+		Name:      "test",
+		UserID:    1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	validCollection := &model.Collections{
+		ID:         1000001,
+		DatabaseID: existingDatabase.ID,
+		Name:       "test",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	tcs := []struct {
+		scenario string
+		userData *identity.UserData
+		key      *uuid.UUID
+		err      error
+	}{
+		{
+			scenario: "Will discard the changes and keep the transaction",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+		},
+		{
+			scenario: "Will throw an error when the transaction does not exist",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			key: &uuid.Nil,
+			err: &errs.Error{
+				Code:    errs.NotFound,
+				Message: "Could not find transaction",
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(tc.userData.ID, 10)), tc.userData)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := insertDatabases(ctx, []*model.Databases{existingDatabase})
+			require.NoError(t, err)
+
+			err = insertCollections(ctx, []*model.Collections{validCollection})
+			require.NoError(t, err)
+
+			_, err = permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+				KeyID:      1,
+				DatabaseID: &existingDatabase.ID,
+				UserID:     1,
+				Role:       "write",
+			})
+			require.NoError(t, err)
+
+			transaction, err := StartTransaction(ctx, &StartTransactionParams{DatabaseID: existingDatabase.ID})
+			require.NoError(t, err)
+
+			_, err = CreateDocument(ctx, &CreateDocumentParams{
+				CollectionID:   validCollection.ID,
+				Content:        json.RawMessage(`{"foo": "bar"}`),
+				TransactionKey: transaction.TransactionKey,
+			})
+			require.NoError(t, err)
+
+			key := transaction.TransactionKey
+			if tc.key != nil {
+				key = *tc.key
+			}
+
+			response, err := RollbackTransaction(ctx, &RollbackTransactionParams{TransactionKey: key})
+			if tc.err != nil {
+				test_utils2.CompareErrors(t, tc.err, err)
+				assert.Nil(t, response)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, transaction.TransactionKey, response.TransactionKey)
+
+			documents, err := ListDocuments(ctx, &ListDocumentsParams{
+				CollectionID:   validCollection.ID,
+				TransactionKey: transaction.TransactionKey,
+			})
+			require.NoError(t, err)
+			assert.Empty(t, documents.Documents)
+		})
+	}
+}
+
+func TestSweepExpiredTransactions(t *testing.T) {
+	now := time.Now()
+
+	existingDatabase := &model.Databases{
+		ID:        1,
+		Name:      "test",
+		UserID:    1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	tcs := []struct {
+		scenario string
+		userData *identity.UserData
+		expired  bool
+		deleted  int64
+	}{
+		{
+			scenario: "Will delete the expired transactions",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			expired: true,
+			deleted: 1,
+		},
+		{
+			scenario: "Will keep the transactions that have not expired",
+			userData: &identity.UserData{
+				ID:    1,
+				KeyID: 1,
+			},
+			deleted: 0,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := auth.WithContext(context.Background(), auth.UID(strconv.FormatInt(tc.userData.ID, 10)), tc.userData)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := insertDatabases(ctx, []*model.Databases{existingDatabase})
+			require.NoError(t, err)
+
+			_, err = permissions.AddPermissionSet(ctx, &permissions.AddPermissionSetParams{
+				KeyID:      1,
+				DatabaseID: &existingDatabase.ID,
+				UserID:     1,
+				Role:       "write",
+			})
+			require.NoError(t, err)
+
+			transaction, err := StartTransaction(ctx, &StartTransactionParams{DatabaseID: existingDatabase.ID})
+			require.NoError(t, err)
+
+			if tc.expired {
+				err = expireTransaction(ctx, transaction.TransactionKey)
+				require.NoError(t, err)
+			}
+
+			response, err := SweepExpiredTransactions(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tc.deleted, response.Deleted)
+
+			// The key of a swept transaction is still reported as expired
+			_, err = RollbackTransaction(ctx, &RollbackTransactionParams{TransactionKey: transaction.TransactionKey})
+			if tc.expired {
+				test_utils2.CompareErrors(t, &errs.Error{
+					Code:    errs.FailedPrecondition,
+					Message: "Transaction has expired, start a new transaction",
+				}, err)
+
+				_, err = CreateDocument(ctx, &CreateDocumentParams{
+					CollectionID:   1,
+					Content:        json.RawMessage(`{}`),
+					TransactionKey: transaction.TransactionKey,
+				})
+				test_utils2.CompareErrors(t, &errs.Error{
+					Code:    errs.FailedPrecondition,
+					Message: "Transaction has expired, start a new transaction",
+				}, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+// expireTransaction moves the expiration date of a transaction in the past.
+func expireTransaction(ctx context.Context, key uuid.UUID) error {
+	query, args := table.Transactions.UPDATE(table.Transactions.ExpiresAt).
+		SET(time.Now().Add(-time.Minute)).
+		WHERE(table.Transactions.ID.EQ(postgres.UUID(key))).
+		Sql()
+
+	_, err := sqldb.Exec(ctx, query, args...)
+	return err
+}
+
+// compareDocumentContents compares documents by content, for documents created without a known ID.
+func compareDocumentContents(t *testing.T, expected, actual []convert.DocumentPayload) {
+	assert.Len(t, actual, len(expected))
+	for _, document := range expected {
+		found := false
+		for _, lookup := range actual {
+			if string(lookup.Content) == string(document.Content) && (document.ID == 0 || lookup.ID == document.ID) {
+				found = true
+				break
+			}
+		}
+
+		assert.Truef(t, found, "Could not find document with content %s in actual", document.Content)
+	}
+}
+
+func convertDocuments(t *testing.T, documents []*model.Documents) []convert.DocumentPayload {
+	payloads, err := convert.DocumentModelsToPayloads(documents)
+	require.NoError(t, err)
+
+	return payloads
+}
@@ -0,0 +1,208 @@
+package content
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+
+	"encore.dev/beta/errs"
+	log "github.com/sirupsen/logrus"
+
+	"encore.app/content/internal"
+)
+
+// ExportCollection streams the documents of a collection for the authenticated user as a file, sorted by
+// creation date. The collection is given as `collection_id` in the query string, along with an optional
+// `filter` in JSON to only export the documents with a content matching it.
+//
+// The `format` of the file is `ndjson` by default, with a record per line, `json` with the records in an
+// array, or `csv` with a row per document. Records have the `ID`, `Key`, `Content`, `Version`, `UpdatedAt`
+// and `CreatedAt` of the documents, with the content as JSON. The CSV format requires `columns`, a JSON
+// array mapping the columns of the file to paths in the content like
+// `[{"Column": "city", "Path": "address.city"}]`. Strings are written as is, other values as JSON, and
+// missing values as empty cells. The keys of the documents are written in the column named by `key_column`
+// when given.
+//encore:api auth raw
+func ExportCollection(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	params := req.URL.Query()
+
+	collectionID, err := queryStringID(req, "collection_id")
+	if err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+
+	export, err := internal.OpenCollectionExport(
+		ctx,
+		collectionID,
+		params.Get("format"),
+		json.RawMessage(params.Get("filter")),
+		json.RawMessage(params.Get("columns")),
+		params.Get("key_column"),
+	)
+	if err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", export.ContentType())
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": export.FileName()}))
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	for {
+		more, err := export.Next(ctx, w)
+		if err != nil {
+			// The response has started, the file is cut short for the client to notice
+			log.WithError(err).Error("Could not write the documents of the export, closing it")
+			return
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		if !more {
+			return
+		}
+	}
+}
+
+// maxImportBodySize is the maximum size in bytes of the file of an import, 256 MiB. The file is copied to the
+// disk before being imported, larger files are split into several imports.
+const maxImportBodySize = 256 << 20
+
+// spoolRequestBody copies the body of a request to a temporary file. Go servers cannot read the body of an
+// HTTP/1 request once the response has started, so the body of an import is read in full before its
+// progress is streamed. Bodies larger than maxImportBodySize are rejected.
+func spoolRequestBody(w http.ResponseWriter, req *http.Request) (*os.File, error) {
+	file, err := os.CreateTemp("", "import-*")
+	if err != nil {
+		log.WithError(err).Error("Could not create the file of the import")
+		return nil, &errs.Error{
+			Code:    errs.Internal,
+			Message: "Could not read the body of the request",
+		}
+	}
+
+	written, err := io.Copy(file, http.MaxBytesReader(w, req.Body, maxImportBodySize))
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+
+	if err != nil {
+		log.WithError(err).Warning("Could not read the body of the import")
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+
+		// The reader fails once the body is read up to the limit and goes on
+		if written == maxImportBodySize {
+			return nil, &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: fmt.Sprintf("Received body was not valid, it must be at most %d MiB", maxImportBodySize>>20),
+			}
+		}
+
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Could not read the body of the request",
+		}
+	}
+
+	return file, nil
+}
+
+// ImportCollection imports the rows of a file sent as body of the request as documents of a collection for
+// the authenticated user. The collection is given as `collection_id` in the query string, and the `format`
+// of the file is `ndjson`, `json` or `csv` as written by ExportCollection. Only the `Key` and the `Content`
+// of the records are read, and the CSV format requires `columns` to build the content of the documents
+// from the cells, with an optional `Type` for each column among `string`, `number`, `boolean` and `json`.
+// Empty cells are left out of the content. The keys of the documents are read from `key_column` when given.
+//
+// The file must be at most 256 MiB. The documents are inserted in batches of 500 rows, or one at a time when
+// the collection has unique indexes. Rows that cannot be imported abort the import, or are skipped when
+// `on_error` is `skip`. When `upsert` is true, the documents with the key of a row are replaced by its content
+// instead of failing.
+//
+// The progress of the import is streamed as NDJSON after each batch, with the rows of the batch that could
+// not be imported. The import is over once the `Status` of the progress is no longer `importing`: either
+// `done`, or `aborted` with the `Error` that stopped it. The rows imported before an import is aborted are
+// kept.
+//encore:api auth raw
+func ImportCollection(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	params := req.URL.Query()
+
+	collectionID, err := queryStringID(req, "collection_id")
+	if err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+
+	upsert := false
+	if value := params.Get("upsert"); value != "" {
+		upsert, err = strconv.ParseBool(value)
+		if err != nil {
+			errs.HTTPError(w, &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: "Received upsert was not valid, it must be a boolean",
+			})
+			return
+		}
+	}
+
+	collectionImport, err := internal.OpenCollectionImport(
+		ctx,
+		collectionID,
+		params.Get("format"),
+		json.RawMessage(params.Get("columns")),
+		params.Get("key_column"),
+		params.Get("on_error"),
+		upsert,
+	)
+	if err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+
+	body, err := spoolRequestBody(w, req)
+	if err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+	defer os.Remove(body.Name())
+	defer body.Close()
+
+	err = collectionImport.Start(body)
+	if err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	for {
+		progress := collectionImport.Next(ctx)
+
+		err = encoder.Encode(progress)
+		if err != nil {
+			log.WithError(err).Warning("Could not write the progress of the import")
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		if progress.Status != "importing" {
+			return
+		}
+	}
+}
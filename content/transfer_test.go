@@ -0,0 +1,393 @@
+package content
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"encore.app/content/convert"
+	"encore.app/content/test_utils"
+	test_utils_permissions "encore.app/permissions/test_utils"
+)
+
+// importCollection imports a file with ImportCollection, and returns the response along with the progress
+// reported by the import.
+func importCollection(t *testing.T, ctx context.Context, query url.Values, body string) (*httptest.ResponseRecorder, []convert.ImportProgress) {
+	req := httptest.NewRequest(http.MethodPost, "/content.ImportCollection?"+query.Encode(), strings.NewReader(body)).WithContext(ctx)
+	recorder := httptest.NewRecorder()
+
+	ImportCollection(recorder, req)
+
+	var progress []convert.ImportProgress
+	if recorder.Code != http.StatusOK {
+		return recorder, progress
+	}
+
+	scanner := bufio.NewScanner(recorder.Body)
+	for scanner.Scan() {
+		line := convert.ImportProgress{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		progress = append(progress, line)
+	}
+
+	return recorder, progress
+}
+
+// exportCollection exports a collection with ExportCollection.
+func exportCollection(ctx context.Context, query url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/content.ExportCollection?"+query.Encode(), nil).WithContext(ctx)
+	recorder := httptest.NewRecorder()
+
+	ExportCollection(recorder, req)
+
+	return recorder
+}
+
+// collectionContents lists the contents of the documents of a collection by key.
+func collectionContents(t *testing.T, ctx context.Context, collectionID int64) map[string]string {
+	response, err := ListDocuments(ctx, &ListDocumentsParams{CollectionID: collectionID})
+	require.NoError(t, err)
+
+	contents := map[string]string{}
+	for _, document := range response.Documents {
+		var content string
+		require.NoError(t, json.Unmarshal(document.Content, &content))
+		contents[document.Key] = content
+	}
+
+	return contents
+}
+
+func TestImportCollection(t *testing.T) {
+	type expected struct {
+		status   int
+		progress convert.ImportProgress
+		contents map[string]string
+	}
+
+	tcs := []struct {
+		scenario string
+		role     string
+		query    url.Values
+		body     string
+
+		// Runs before the import, when given
+		before   func(t *testing.T, ctx context.Context)
+		expected expected
+	}{
+		{
+			scenario: "Imports the records of an NDJSON file",
+			role:     "write",
+			query:    url.Values{"collection_id": {"2"}},
+			body:     "{\"Key\": \"a\", \"Content\": {\"title\": \"A\"}}\n\n{\"Key\": \"b\", \"Content\": {\"title\": \"B\"}}\n",
+			expected: expected{
+				status:   http.StatusOK,
+				progress: convert.ImportProgress{Status: "done", Read: 2, Inserted: 2},
+				contents: map[string]string{"a": `{"title": "A"}`, "b": `{"title": "B"}`},
+			},
+		},
+		{
+			scenario: "Imports the records of a JSON array",
+			role:     "write",
+			query:    url.Values{"collection_id": {"2"}, "format": {"json"}},
+			body:     `[{"Key": "a", "Content": {"title": "A"}}, {"Content": {"title": "B"}}]`,
+			expected: expected{
+				status:   http.StatusOK,
+				progress: convert.ImportProgress{Status: "done", Read: 2, Inserted: 2},
+				contents: map[string]string{"a": `{"title": "A"}`, "": `{"title": "B"}`},
+			},
+		},
+		{
+			scenario: "Imports the rows of a CSV file with a mapping of the columns",
+			role:     "write",
+			query: url.Values{
+				"collection_id": {"2"},
+				"format":        {"csv"},
+				"columns":       {`[{"Column": "title", "Path": "meta.title"}, {"Column": "views", "Path": "views", "Type": "number"}]`},
+				"key_column":    {"id"},
+			},
+			body: "id,title,views\na,\"Hello, world\",12\nb,,3\n",
+			expected: expected{
+				status:   http.StatusOK,
+				progress: convert.ImportProgress{Status: "done", Read: 2, Inserted: 2},
+				contents: map[string]string{"a": `{"meta": {"title": "Hello, world"}, "views": 12}`, "b": `{"views": 3}`},
+			},
+		},
+		{
+			scenario: "Aborts on the first invalid row, keeping the rows before it",
+			role:     "write",
+			query:    url.Values{"collection_id": {"2"}},
+			body:     "{\"Key\": \"a\", \"Content\": {\"title\": \"A\"}}\n{\"Key\": \"a\", \"Content\": {\"title\": \"B\"}}\n{\"Key\": \"c\", \"Content\": {\"title\": \"C\"}}\n",
+			expected: expected{
+				status: http.StatusOK,
+				progress: convert.ImportProgress{
+					Status:   "aborted",
+					Read:     2,
+					Inserted: 1,
+					Errors: []convert.ImportRowError{
+						{Row: 2, Key: "a", Message: "A document with key `a` already exists in this collection"},
+					},
+					Error: "Row 2 could not be imported",
+				},
+				contents: map[string]string{"a": `{"title": "A"}`},
+			},
+		},
+		{
+			scenario: "Skips the invalid rows",
+			role:     "write",
+			query:    url.Values{"collection_id": {"2"}, "on_error": {"skip"}},
+			body:     "{\"Key\": \"a\", \"Content\": {\"title\": \"A\"}}\nnot json\n{\"Key\": \"c\"}\n{\"Key\": \"d\", \"Content\": {\"title\": \"D\"}}\n",
+			expected: expected{
+				status: http.StatusOK,
+				progress: convert.ImportProgress{
+					Status:   "done",
+					Read:     4,
+					Inserted: 2,
+					Skipped:  2,
+					Errors: []convert.ImportRowError{
+						{Row: 2, Message: "Received row was not valid, it must be an object with a `Key` and a `Content`"},
+						{Row: 3, Key: "c", Message: "Received JSON string for content was not valid"},
+					},
+				},
+				contents: map[string]string{"a": `{"title": "A"}`, "d": `{"title": "D"}`},
+			},
+		},
+		{
+			scenario: "Replaces the documents with the key of a row when upserting",
+			role:     "write",
+			query:    url.Values{"collection_id": {"2"}, "upsert": {"true"}},
+			body:     "{\"Key\": \"a\", \"Content\": {\"title\": \"A\"}}\n{\"Key\": \"a\", \"Content\": {\"title\": \"B\"}}\n",
+			expected: expected{
+				status:   http.StatusOK,
+				progress: convert.ImportProgress{Status: "done", Read: 2, Inserted: 1, Updated: 1},
+				contents: map[string]string{"a": `{"title": "B"}`},
+			},
+		},
+		{
+			scenario: "Creates the documents with the key of a document in the trash when upserting",
+			role:     "write",
+			query:    url.Values{"collection_id": {"2"}, "upsert": {"true"}},
+			body:     "{\"Key\": \"a\", \"Content\": {\"title\": \"A\"}}\n",
+			before: func(t *testing.T, ctx context.Context) {
+				created, err := CreateDocument(ctx, &CreateDocumentParams{
+					CollectionID: 2,
+					Key:          "a",
+					Content:      json.RawMessage(`{"title": "Trashed"}`),
+				})
+				require.NoError(t, err)
+
+				_, err = DeleteDocument(ctx, &DeleteDocumentParams{ID: created.Document.ID})
+				require.NoError(t, err)
+			},
+			expected: expected{
+				status:   http.StatusOK,
+				progress: convert.ImportProgress{Status: "done", Read: 1, Inserted: 1},
+				contents: map[string]string{"a": `{"title": "A"}`},
+			},
+		},
+		{
+			scenario: "Throws an error when the body is not a JSON array",
+			role:     "write",
+			query:    url.Values{"collection_id": {"2"}, "format": {"json"}},
+			body:     `{"Key": "a"}`,
+			expected: expected{
+				status: http.StatusBadRequest,
+			},
+		},
+		{
+			scenario: "Throws an error when a mapped column is not in the header of the CSV file",
+			role:     "write",
+			query:    url.Values{"collection_id": {"2"}, "format": {"csv"}, "columns": {`[{"Column": "title", "Path": "title"}]`}},
+			body:     "name\nHello\n",
+			expected: expected{
+				status: http.StatusBadRequest,
+			},
+		},
+		{
+			scenario: "Throws an error when the format is unknown",
+			role:     "write",
+			query:    url.Values{"collection_id": {"2"}, "format": {"xml"}},
+			expected: expected{
+				status: http.StatusBadRequest,
+			},
+		},
+		{
+			scenario: "Throws an error when the key cannot write to the database",
+			role:     "read",
+			query:    url.Values{"collection_id": {"2"}},
+			expected: expected{
+				status: http.StatusForbidden,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := fixtureContext(t, articlesFixture(tc.role))
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			if tc.before != nil {
+				tc.before(t, ctx)
+			}
+
+			recorder, progress := importCollection(t, ctx, tc.query, tc.body)
+			assert.Equal(t, tc.expected.status, recorder.Code)
+			if tc.expected.status != http.StatusOK {
+				return
+			}
+
+			require.NotEmpty(t, progress)
+			assert.Equal(t, tc.expected.progress, progress[len(progress)-1])
+
+			contents := collectionContents(t, ctx, 2)
+			require.Len(t, contents, len(tc.expected.contents))
+			for key, content := range tc.expected.contents {
+				assert.JSONEq(t, content, contents[key])
+			}
+		})
+	}
+}
+
+func TestImportCollectionRejectedBeforeReadingBody(t *testing.T) {
+	tcs := []struct {
+		scenario string
+		role     string
+		query    url.Values
+		status   int
+	}{
+		{
+			scenario: "Throws an error when the collection does not exist",
+			role:     "write",
+			query:    url.Values{"collection_id": {"-1"}},
+			status:   http.StatusNotFound,
+		},
+		{
+			scenario: "Throws an error when the key cannot write to the database",
+			role:     "read",
+			query:    url.Values{"collection_id": {"2"}},
+			status:   http.StatusForbidden,
+		},
+		{
+			scenario: "Throws an error when the error mode is unknown",
+			role:     "write",
+			query:    url.Values{"collection_id": {"2"}, "on_error": {"retry"}},
+			status:   http.StatusBadRequest,
+		},
+		{
+			scenario: "Throws an error when columns are given for the NDJSON format",
+			role:     "write",
+			query:    url.Values{"collection_id": {"2"}, "columns": {`[{"Column": "title", "Path": "title"}]`}},
+			status:   http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := fixtureContext(t, articlesFixture(tc.role))
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			body := strings.NewReader("{\"Key\": \"a\", \"Content\": {\"title\": \"A\"}}\n")
+			req := httptest.NewRequest(http.MethodPost, "/content.ImportCollection?"+tc.query.Encode(), body).WithContext(ctx)
+			recorder := httptest.NewRecorder()
+
+			ImportCollection(recorder, req)
+
+			assert.Equal(t, tc.status, recorder.Code)
+			assert.Equal(t, body.Size(), int64(body.Len()), "The body of the import should not be read")
+		})
+	}
+}
+
+// exportedDocuments are the documents of the collection exported by TestExportCollection, as NDJSON.
+const exportedDocuments = `{"Key": "a", "Content": {"meta": {"title": "Hello, world"}, "views": 12}}
+{"Key": "b", "Content": {"views": 3}}
+`
+
+func TestExportCollection(t *testing.T) {
+	tcs := []struct {
+		scenario    string
+		query       url.Values
+		status      int
+		contentType string
+		body        string
+	}{
+		{
+			scenario:    "Exports the documents as NDJSON",
+			query:       url.Values{"collection_id": {"2"}},
+			status:      http.StatusOK,
+			contentType: "application/x-ndjson",
+		},
+		{
+			scenario:    "Exports the documents as a JSON array",
+			query:       url.Values{"collection_id": {"2"}, "format": {"json"}},
+			status:      http.StatusOK,
+			contentType: "application/json",
+		},
+		{
+			scenario: "Exports the documents matching the filter as CSV",
+			query: url.Values{
+				"collection_id": {"2"},
+				"format":        {"csv"},
+				"filter":        {`{"views": {"$gt": 5}}`},
+				"columns":       {`[{"Column": "title", "Path": "meta.title"}, {"Column": "views", "Path": "views"}]`},
+				"key_column":    {"id"},
+			},
+			status:      http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			body:        "id,title,views\na,\"Hello, world\",12\n",
+		},
+		{
+			scenario: "Throws an error when exporting to CSV without columns",
+			query:    url.Values{"collection_id": {"2"}, "format": {"csv"}},
+			status:   http.StatusBadRequest,
+		},
+		{
+			scenario: "Throws an error when the collection does not exist",
+			query:    url.Values{"collection_id": {"99"}},
+			status:   http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := fixtureContext(t, articlesFixture("write"))
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			_, progress := importCollection(t, ctx, url.Values{"collection_id": {"2"}}, exportedDocuments)
+			require.NotEmpty(t, progress)
+			require.Equal(t, int64(2), progress[len(progress)-1].Inserted)
+
+			recorder := exportCollection(ctx, tc.query)
+			assert.Equal(t, tc.status, recorder.Code)
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			assert.Equal(t, tc.contentType, recorder.Header().Get("Content-Type"))
+			if tc.body != "" {
+				assert.Equal(t, tc.body, recorder.Body.String())
+				return
+			}
+
+			// Records exported as NDJSON or JSON are imported back as they were
+			query := url.Values{"collection_id": {"3"}, "format": {tc.query.Get("format")}}
+			imported, reimported := importCollection(t, ctx, query, recorder.Body.String())
+			require.Equal(t, http.StatusOK, imported.Code)
+			require.NotEmpty(t, reimported)
+			assert.Equal(t, convert.ImportProgress{Status: "done", Read: 2, Inserted: 2}, reimported[len(reimported)-1])
+
+			assert.Equal(t, collectionContents(t, ctx, 2), collectionContents(t, ctx, 3))
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package content
+
+import (
+	"context"
+
+	"encore.app/content/convert"
+	"encore.app/content/internal"
+	"encore.app/pagination"
+)
+
+// ListDatabaseTrashParams is the parameters for listing the databases of the current user in the trash
+type ListDatabaseTrashParams struct {
+	// The maximum number of databases to return, defaults to 100 and cannot exceed 1000
+	Limit int
+
+	// The cursor returned as `NextCursor` by the previous call, to fetch the next page of databases
+	Cursor string
+
+	// Whether to sort the databases from the most recently deleted one
+	Descending bool
+}
+
+// ListDatabaseTrashResponse is a page of the databases of the current user in the trash
+type ListDatabaseTrashResponse struct {
+	// The databases in the trash, sorted by the date they were deleted
+	Databases []convert.DatabasePayload
+
+	// The cursor to give to the next call to fetch the next page of databases, empty when there are
+	// no more databases to fetch
+	NextCursor string
+}
+
+// ListDatabaseTrash lists the databases of the authenticated user in the trash, one page at a time.
+//encore:api auth
+func ListDatabaseTrash(ctx context.Context, params *ListDatabaseTrashParams) (*ListDatabaseTrashResponse, error) {
+	databases, nextCursor, err := internal.ListDatabaseTrash(ctx, pagination.Params{
+		Limit:      params.Limit,
+		Cursor:     params.Cursor,
+		Descending: params.Descending,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListDatabaseTrashResponse{
+		Databases:  databases,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// RestoreDatabaseFromTrashParams is the parameters for restoring a database from the trash
+type RestoreDatabaseFromTrashParams struct {
+	// The unique identifier of the database in the trash
+	ID int64
+}
+
+// RestoreDatabaseFromTrashResponse is the result of restoring a database from the trash
+type RestoreDatabaseFromTrashResponse struct {
+	// A message to inform the user of the result of the operation
+	Message string
+
+	// The restored database
+	Database convert.DatabasePayload
+}
+
+// RestoreDatabaseFromTrash takes a database by ID out of the trash for the authenticated user, along with
+// the collections and documents it had when it was deleted. It cannot be restored while another database
+// has its name.
+//encore:api auth
+func RestoreDatabaseFromTrash(ctx context.Context, params *RestoreDatabaseFromTrashParams) (*RestoreDatabaseFromTrashResponse, error) {
+	database, err := internal.RestoreDatabaseFromTrash(ctx, params.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RestoreDatabaseFromTrashResponse{
+		Message:  "Database restored successfully.",
+		Database: database,
+	}, nil
+}
+
+// PurgeDatabaseTrashParams is the parameters for permanently deleting databases in the trash
+type PurgeDatabaseTrashParams struct {
+	// The unique identifier of the database to purge, every database in the trash is purged when not given
+	ID int64
+}
+
+// PurgeTrashResponse is the result of permanently deleting items in the trash
+type PurgeTrashResponse struct {
+	// A message to inform the user of the result of the operation
+	Message string
+
+	// The number of items purged
+	Purged int64
+}
+
+// PurgeDatabaseTrash permanently deletes a database in the trash for the authenticated user, or all the
+// databases in the trash, along with their collections and documents.
+//encore:api auth
+func PurgeDatabaseTrash(ctx context.Context, params *PurgeDatabaseTrashParams) (*PurgeTrashResponse, error) {
+	purged, err := internal.PurgeDatabaseTrash(ctx, params.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PurgeTrashResponse{
+		Message: "Databases purged successfully.",
+		Purged:  purged,
+	}, nil
+}
+
+// ListCollectionTrashParams is the parameters for listing the collections of a database in the trash
+type ListCollectionTrashParams struct {
+	// The unique identifier of the database
+	DatabaseID int64
+
+	// The maximum number of collections to return, defaults to 100 and cannot exceed 1000
+	Limit int
+
+	// The cursor returned as `NextCursor` by the previous call, to fetch the next page of collections
+	Cursor string
+
+	// Whether to sort the collections from the most recently deleted one
+	Descending bool
+}
+
+// ListCollectionTrashResponse is a page of the collections of a database in the trash
+type ListCollectionTrashResponse struct {
+	// The collections in the trash, sorted by the date they were deleted
+	Collections []convert.CollectionPayload
+
+	// The cursor to give to the next call to fetch the next page of collections, empty when there are
+	// no more collections to fetch
+	NextCursor string
+}
+
+// ListCollectionTrash lists the collections of a database in the trash for the authenticated user, one page
+// at a time.
+//encore:api auth
+func ListCollectionTrash(ctx context.Context, params *ListCollectionTrashParams) (*ListCollectionTrashResponse, error) {
+	collections, nextCursor, err := internal.ListCollectionTrash(ctx, params.DatabaseID, pagination.Params{
+		Limit:      params.Limit,
+		Cursor:     params.Cursor,
+		Descending: params.Descending,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListCollectionTrashResponse{
+		Collections: collections,
+		NextCursor:  nextCursor,
+	}, nil
+}
+
+// RestoreCollectionFromTrashParams is the parameters for restoring a collection from the trash
+type RestoreCollectionFromTrashParams struct {
+	// The unique identifier of the collection in the trash
+	ID int64
+}
+
+// RestoreCollectionFromTrashResponse is the result of restoring a collection from the trash
+type RestoreCollectionFromTrashResponse struct {
+	// A message to inform the user of the result of the operation
+	Message string
+
+	// The restored collection
+	Collection convert.CollectionPayload
+}
+
+// RestoreCollectionFromTrash takes a collection by ID out of the trash for the authenticated user, along with
+// the documents it had when it was deleted. The database of the collection must be restored first when it
+// is in the trash too. It cannot be restored while another collection of the database has its name.
+//encore:api auth
+func RestoreCollectionFromTrash(ctx context.Context, params *RestoreCollectionFromTrashParams) (*RestoreCollectionFromTrashResponse, error) {
+	collection, err := internal.RestoreCollectionFromTrash(ctx, params.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RestoreCollectionFromTrashResponse{
+		Message:    "Collection restored successfully.",
+		Collection: collection,
+	}, nil
+}
+
+// PurgeCollectionTrashParams is the parameters for permanently deleting collections in the trash
+type PurgeCollectionTrashParams struct {
+	// The unique identifier of the database of the collections
+	DatabaseID int64
+
+	// The unique identifier of the collection to purge, every collection in the trash of the database is
+	// purged when not given
+	ID int64
+}
+
+// PurgeCollectionTrash permanently deletes a collection in the trash of a database for the authenticated
+// user, or all the collections in the trash of the database, along with their documents.
+//encore:api auth
+func PurgeCollectionTrash(ctx context.Context, params *PurgeCollectionTrashParams) (*PurgeTrashResponse, error) {
+	purged, err := internal.PurgeCollectionTrash(ctx, params.DatabaseID, params.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PurgeTrashResponse{
+		Message: "Collections purged successfully.",
+		Purged:  purged,
+	}, nil
+}
+
+// ListDocumentTrashParams is the parameters for listing the documents of a collection in the trash
+type ListDocumentTrashParams struct {
+	// The unique identifier of the collection
+	CollectionID int64
+
+	// The maximum number of documents to return, defaults to 100 and cannot exceed 1000
+	Limit int
+
+	// The cursor returned as `NextCursor` by the previous call, to fetch the next page of documents
+	Cursor string
+
+	// Whether to sort the documents from the most recently deleted one
+	Descending bool
+}
+
+// ListDocumentTrashResponse is a page of the documents of a collection in the trash
+type ListDocumentTrashResponse struct {
+	// The documents in the trash, sorted by the date they were deleted
+	Documents []convert.DocumentPayload
+
+	// The cursor to give to the next call to fetch the next page of documents, empty when there are
+	// no more documents to fetch
+	NextCursor string
+}
+
+// ListDocumentTrash lists the documents of a collection in the trash for the authenticated user, one page
+// at a time.
+//encore:api auth
+func ListDocumentTrash(ctx context.Context, params *ListDocumentTrashParams) (*ListDocumentTrashResponse, error) {
+	documents, nextCursor, err := internal.ListDocumentTrash(ctx, params.CollectionID, pagination.Params{
+		Limit:      params.Limit,
+		Cursor:     params.Cursor,
+		Descending: params.Descending,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListDocumentTrashResponse{
+		Documents:  documents,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// RestoreDocumentFromTrashParams is the parameters for restoring a document from the trash
+type RestoreDocumentFromTrashParams struct {
+	// The unique identifier of the document in the trash
+	ID int64
+}
+
+// RestoreDocumentFromTrashResponse is the result of restoring a document from the trash
+type RestoreDocumentFromTrashResponse struct {
+	// A message to inform the user of the result of the operation
+	Message string
+
+	// The restored document
+	Document convert.DocumentPayload
+}
+
+// RestoreDocumentFromTrash takes a document by ID out of the trash for the authenticated user, with the
+// content and version it had when it was deleted. The content must still match the schema of the collection,
+// which must be restored first when it is in the trash too. It cannot be restored while another document of
+// the collection has its key, or the same values on a unique index.
+//encore:api auth
+func RestoreDocumentFromTrash(ctx context.Context, params *RestoreDocumentFromTrashParams) (*RestoreDocumentFromTrashResponse, error) {
+	document, err := internal.RestoreDocumentFromTrash(ctx, params.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RestoreDocumentFromTrashResponse{
+		Message:  "Document restored successfully.",
+		Document: document,
+	}, nil
+}
+
+// PurgeDocumentTrashParams is the parameters for permanently deleting documents in the trash
+type PurgeDocumentTrashParams struct {
+	// The unique identifier of the collection of the documents
+	CollectionID int64
+
+	// The unique identifier of the document to purge, every document in the trash of the collection is
+	// purged when not given
+	ID int64
+}
+
+// PurgeDocumentTrash permanently deletes a document in the trash of a collection for the authenticated
+// user, or all the documents in the trash of the collection.
+//encore:api auth
+func PurgeDocumentTrash(ctx context.Context, params *PurgeDocumentTrashParams) (*PurgeTrashResponse, error) {
+	purged, err := internal.PurgeDocumentTrash(ctx, params.CollectionID, params.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PurgeTrashResponse{
+		Message: "Documents purged successfully.",
+		Purged:  purged,
+	}, nil
+}
+
+// SweepTrashResponse is the result of a sweep of the trash
+type SweepTrashResponse struct {
+	// The number of databases, collections and documents purged, not counting the ones purged along with
+	// their database or collection
+	Purged int64
+}
+
+// SweepTrash permanently deletes the databases, collections and documents kept in the trash for longer than
+// the trash retention of their database. The service runs this sweep every day.
+//encore:api private
+func SweepTrash(ctx context.Context) (*SweepTrashResponse, error) {
+	purged, err := internal.SweepTrash(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SweepTrashResponse{
+		Purged: purged,
+	}, nil
+}
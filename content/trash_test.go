@@ -0,0 +1,560 @@
+package content
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"encore.dev/beta/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"encore.app/content/internal"
+	"encore.app/content/models/generated/content/public/model"
+	"encore.app/content/test_utils"
+	test_utils_permissions "encore.app/permissions/test_utils"
+	test_utils2 "encore.app/test_utils"
+)
+
+// trashContext creates a context for an admin API key, with items in the trash at every level:
+//   - the database with ID 1 has a collection with ID 2, and a collection with ID 3 deleted 12 hours ago
+//   - the collection with ID 2 has a document with ID 4, and a document with ID 5 deleted 2 days ago
+//   - the collection with ID 3 has a document with ID 6, deleted along with its collection
+//   - the database with ID 7, deleted 40 days ago, has a collection with ID 8 holding a document with ID 9
+func trashContext(t *testing.T) context.Context {
+	now := time.Now()
+
+	f := articlesFixture("admin")
+	f.permission.DatabaseID = nil
+
+	f.databases = append(f.databases, &model.Databases{
+		ID:        7,
+		Name:      "archive",
+		UserID:    1,
+		DeletedAt: test_utils.TimePointer(now.Add(-40 * 24 * time.Hour)),
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+
+	f.collections[1].Name = "drafts"
+	f.collections[1].DeletedAt = test_utils.TimePointer(now.Add(-12 * time.Hour))
+	f.collections = append(f.collections, &model.Collections{
+		ID:         8,
+		DatabaseID: 7,
+		Name:       "notes",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	})
+
+	f.documents = []*model.Documents{
+		{
+			ID:           4,
+			CollectionID: 2,
+			Content:      `{"title": "Published"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ID:           5,
+			CollectionID: 2,
+			Content:      `{"title": "Deleted"}`,
+			DeletedAt:    test_utils.TimePointer(now.Add(-48 * time.Hour)),
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ID:           6,
+			CollectionID: 3,
+			Content:      `{"title": "Draft"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		{
+			ID:           9,
+			CollectionID: 8,
+			Content:      `{"title": "Note"}`,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+	}
+
+	return fixtureContext(t, f)
+}
+
+func TestDeleteMovesToTrash(t *testing.T) {
+	ctx := trashContext(t)
+	defer test_utils.Cleanup(ctx)
+	defer test_utils_permissions.Cleanup(ctx)
+
+	_, err := DeleteDocument(ctx, &DeleteDocumentParams{ID: 4})
+	require.NoError(t, err)
+
+	_, err = GetDocument(ctx, &GetDocumentParams{ID: 4})
+	test_utils2.CompareErrors(t, &errs.Error{Code: errs.NotFound, Message: "Could not find document"}, err)
+
+	documents, err := ListDocumentTrash(ctx, &ListDocumentTrashParams{CollectionID: 2, Descending: true})
+	require.NoError(t, err)
+	require.Len(t, documents.Documents, 2)
+	assert.Equal(t, int64(4), documents.Documents[0].ID)
+	assert.Equal(t, int64(5), documents.Documents[1].ID)
+	assert.NotNil(t, documents.Documents[0].DeletedAt)
+
+	_, err = DeleteDatabase(ctx, &DeleteDatabaseParams{ID: 1})
+	require.NoError(t, err)
+
+	databases, err := ListDatabaseTrash(ctx, &ListDatabaseTrashParams{})
+	require.NoError(t, err)
+	require.Len(t, databases.Databases, 2)
+	assert.Equal(t, int64(7), databases.Databases[0].ID)
+	assert.Equal(t, int64(1), databases.Databases[1].ID)
+
+	listed, err := ListDatabases(ctx, &ListDatabasesParams{})
+	require.NoError(t, err)
+	assert.Empty(t, listed.Databases)
+}
+
+func TestListCollectionTrash(t *testing.T) {
+	type expected struct {
+		ids []int64
+		err error
+	}
+
+	tcs := []struct {
+		scenario string
+		params   *ListCollectionTrashParams
+		expected expected
+	}{
+		{
+			scenario: "Lists the collections of a database in the trash",
+			params: &ListCollectionTrashParams{
+				DatabaseID: 1,
+			},
+			expected: expected{
+				ids: []int64{3},
+			},
+		},
+		{
+			scenario: "Throws an error when the database is in the trash",
+			params: &ListCollectionTrashParams{
+				DatabaseID: 7,
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.NotFound,
+					Message: "Could not find database",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := trashContext(t)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			response, err := ListCollectionTrash(ctx, tc.params)
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+				return
+			}
+
+			require.NoError(t, err)
+			ids := make([]int64, len(response.Collections))
+			for i, collection := range response.Collections {
+				ids[i] = collection.ID
+			}
+
+			assert.Equal(t, tc.expected.ids, ids)
+		})
+	}
+}
+
+func TestRestoreFromTrash(t *testing.T) {
+	tcs := []struct {
+		scenario string
+		restore  func(ctx context.Context) error
+
+		// The document that can be fetched once restored
+		documentID int64
+		err        error
+	}{
+		{
+			scenario: "Restores a document",
+			restore: func(ctx context.Context) error {
+				_, err := RestoreDocumentFromTrash(ctx, &RestoreDocumentFromTrashParams{ID: 5})
+				return err
+			},
+			documentID: 5,
+		},
+		{
+			scenario: "Restores a collection along with its documents",
+			restore: func(ctx context.Context) error {
+				_, err := RestoreCollectionFromTrash(ctx, &RestoreCollectionFromTrashParams{ID: 3})
+				return err
+			},
+			documentID: 6,
+		},
+		{
+			scenario: "Restores a database along with its collections and documents",
+			restore: func(ctx context.Context) error {
+				_, err := RestoreDatabaseFromTrash(ctx, &RestoreDatabaseFromTrashParams{ID: 7})
+				return err
+			},
+			documentID: 9,
+		},
+		{
+			scenario: "Throws an error when restoring a document of a collection in the trash",
+			restore: func(ctx context.Context) error {
+				_, err := RestoreDocumentFromTrash(ctx, &RestoreDocumentFromTrashParams{ID: 6})
+				return err
+			},
+			err: &errs.Error{
+				Code:    errs.NotFound,
+				Message: "Could not find document in the trash",
+			},
+		},
+		{
+			scenario: "Throws an error when restoring a database that is not in the trash",
+			restore: func(ctx context.Context) error {
+				_, err := RestoreDatabaseFromTrash(ctx, &RestoreDatabaseFromTrashParams{ID: 1})
+				return err
+			},
+			err: &errs.Error{
+				Code:    errs.NotFound,
+				Message: "Could not find database in the trash",
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := trashContext(t)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			err := tc.restore(ctx)
+			if tc.err != nil {
+				test_utils2.CompareErrors(t, tc.err, err)
+				return
+			}
+
+			require.NoError(t, err)
+			response, err := GetDocument(ctx, &GetDocumentParams{ID: tc.documentID})
+			require.NoError(t, err)
+			assert.Nil(t, response.Document.DeletedAt)
+		})
+	}
+}
+
+// createTitleIndex creates a unique index on the title of the documents of the collection with ID 2.
+func createTitleIndex(ctx context.Context) error {
+	_, err := CreateIndex(ctx, &CreateIndexParams{
+		CollectionID: 2,
+		Name:         "title",
+		Paths:        []string{"title"},
+		Unique:       true,
+	})
+	return err
+}
+
+// createTrashedDocument creates a document with a key in the collection with ID 2 and moves it to the trash,
+// returning its ID.
+func createTrashedDocument(ctx context.Context, key string) (int64, error) {
+	created, err := CreateDocument(ctx, &CreateDocumentParams{
+		CollectionID: 2,
+		Key:          key,
+		Content:      json.RawMessage(`{"title": "Trashed"}`),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = DeleteDocument(ctx, &DeleteDocumentParams{ID: created.Document.ID})
+	return created.Document.ID, err
+}
+
+func TestCreateOverTrash(t *testing.T) {
+	tcs := []struct {
+		scenario string
+		create   func(ctx context.Context) error
+	}{
+		{
+			scenario: "Creates a database with the name of a database in the trash",
+			create: func(ctx context.Context) error {
+				_, err := CreateDatabase(ctx, &CreateDatabaseParams{Name: "archive"})
+				return err
+			},
+		},
+		{
+			scenario: "Creates a collection with the name of a collection in the trash",
+			create: func(ctx context.Context) error {
+				_, err := CreateCollection(ctx, &CreateCollectionParams{DatabaseID: 1, Name: "drafts"})
+				return err
+			},
+		},
+		{
+			scenario: "Creates a document with the key of a document in the trash",
+			create: func(ctx context.Context) error {
+				_, err := createTrashedDocument(ctx, "settings")
+				if err != nil {
+					return err
+				}
+
+				_, err = CreateDocument(ctx, &CreateDocumentParams{
+					CollectionID: 2,
+					Key:          "settings",
+					Content:      json.RawMessage(`{"title": "Settings"}`),
+				})
+				return err
+			},
+		},
+		{
+			scenario: "Creates a document with the values of a document in the trash on a unique index",
+			create: func(ctx context.Context) error {
+				err := createTitleIndex(ctx)
+				if err != nil {
+					return err
+				}
+
+				_, err = CreateDocument(ctx, &CreateDocumentParams{
+					CollectionID: 2,
+					Content:      json.RawMessage(`{"title": "Deleted"}`),
+				})
+				return err
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := trashContext(t)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			require.NoError(t, tc.create(ctx))
+		})
+	}
+}
+
+func TestRestoreConflicts(t *testing.T) {
+	tcs := []struct {
+		scenario string
+		restore  func(ctx context.Context) error
+		err      error
+	}{
+		{
+			scenario: "Throws an error when restoring a database whose name is used",
+			restore: func(ctx context.Context) error {
+				_, err := CreateDatabase(ctx, &CreateDatabaseParams{Name: "archive"})
+				if err != nil {
+					return err
+				}
+
+				_, err = RestoreDatabaseFromTrash(ctx, &RestoreDatabaseFromTrashParams{ID: 7})
+				return err
+			},
+			err: &errs.Error{
+				Code:    errs.FailedPrecondition,
+				Message: "Could not restore database, a database with name `archive` already exists",
+			},
+		},
+		{
+			scenario: "Throws an error when restoring a collection whose name is used",
+			restore: func(ctx context.Context) error {
+				_, err := CreateCollection(ctx, &CreateCollectionParams{DatabaseID: 1, Name: "drafts"})
+				if err != nil {
+					return err
+				}
+
+				_, err = RestoreCollectionFromTrash(ctx, &RestoreCollectionFromTrashParams{ID: 3})
+				return err
+			},
+			err: &errs.Error{
+				Code:    errs.FailedPrecondition,
+				Message: "Could not restore collection, a collection with name `drafts` already exists in this database",
+			},
+		},
+		{
+			scenario: "Throws an error when restoring a document whose key is used",
+			restore: func(ctx context.Context) error {
+				trashedID, err := createTrashedDocument(ctx, "settings")
+				if err != nil {
+					return err
+				}
+
+				_, err = CreateDocument(ctx, &CreateDocumentParams{
+					CollectionID: 2,
+					Key:          "settings",
+					Content:      json.RawMessage(`{"title": "Settings"}`),
+				})
+				if err != nil {
+					return err
+				}
+
+				_, err = RestoreDocumentFromTrash(ctx, &RestoreDocumentFromTrashParams{ID: trashedID})
+				return err
+			},
+			err: &errs.Error{
+				Code:    errs.FailedPrecondition,
+				Message: "Could not restore document, a document with key `settings` already exists in this collection",
+			},
+		},
+		{
+			scenario: "Throws an error when restoring a document whose values are used on a unique index",
+			restore: func(ctx context.Context) error {
+				err := createTitleIndex(ctx)
+				if err != nil {
+					return err
+				}
+
+				_, err = UpdateDocument(ctx, &UpdateDocumentParams{ID: 4, Content: json.RawMessage(`{"title": "Deleted"}`)})
+				if err != nil {
+					return err
+				}
+
+				_, err = RestoreDocumentFromTrash(ctx, &RestoreDocumentFromTrashParams{ID: 5})
+				return err
+			},
+			err: &errs.Error{
+				Code:    errs.FailedPrecondition,
+				Message: "Document has the same values as document 4 on the unique index `title`",
+				Details: &internal.UniqueConflict{
+					Index:      "title",
+					Paths:      []string{"title"},
+					DocumentID: 4,
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := trashContext(t)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			test_utils2.CompareErrors(t, tc.err, tc.restore(ctx))
+		})
+	}
+}
+
+func TestPurgeDocumentTrash(t *testing.T) {
+	type expected struct {
+		purged int64
+		err    error
+	}
+
+	tcs := []struct {
+		scenario string
+		params   *PurgeDocumentTrashParams
+		expected expected
+	}{
+		{
+			scenario: "Purges a document in the trash",
+			params: &PurgeDocumentTrashParams{
+				CollectionID: 2,
+				ID:           5,
+			},
+			expected: expected{
+				purged: 1,
+			},
+		},
+		{
+			scenario: "Purges all the documents in the trash of a collection",
+			params: &PurgeDocumentTrashParams{
+				CollectionID: 2,
+			},
+			expected: expected{
+				purged: 1,
+			},
+		},
+		{
+			scenario: "Throws an error when the document is not in the trash",
+			params: &PurgeDocumentTrashParams{
+				CollectionID: 2,
+				ID:           4,
+			},
+			expected: expected{
+				err: &errs.Error{
+					Code:    errs.NotFound,
+					Message: "Could not find document in the trash",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := trashContext(t)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			response, err := PurgeDocumentTrash(ctx, tc.params)
+			if tc.expected.err != nil {
+				test_utils2.CompareErrors(t, tc.expected.err, err)
+				assert.Nil(t, response)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected.purged, response.Purged)
+
+			documents, err := ListDocumentTrash(ctx, &ListDocumentTrashParams{CollectionID: tc.params.CollectionID})
+			require.NoError(t, err)
+			assert.Empty(t, documents.Documents)
+
+			_, err = RestoreDocumentFromTrash(ctx, &RestoreDocumentFromTrashParams{ID: 5})
+			test_utils2.CompareErrors(t, &errs.Error{Code: errs.NotFound, Message: "Could not find document in the trash"}, err)
+		})
+	}
+}
+
+func TestSweepTrash(t *testing.T) {
+	tcs := []struct {
+		scenario           string
+		trashRetentionDays *int
+		purged             int64
+	}{
+		{
+			scenario: "Purges the items kept in the trash for longer than the default retention",
+			purged:   1,
+		},
+		{
+			scenario:           "Purges the items kept in the trash for longer than the retention of their database",
+			trashRetentionDays: test_utils.IntPointer(1),
+			purged:             2,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := trashContext(t)
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			if tc.trashRetentionDays != nil {
+				_, err := UpdateDatabase(ctx, &UpdateDatabaseParams{
+					ID:                 1,
+					Name:               "renamed",
+					TrashRetentionDays: tc.trashRetentionDays,
+				})
+				require.NoError(t, err)
+			}
+
+			response, err := SweepTrash(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tc.purged, response.Purged)
+
+			databases, err := ListDatabaseTrash(ctx, &ListDatabaseTrashParams{})
+			require.NoError(t, err)
+			assert.Empty(t, databases.Databases)
+
+			collections, err := ListCollectionTrash(ctx, &ListCollectionTrashParams{DatabaseID: 1})
+			require.NoError(t, err)
+			assert.Len(t, collections.Collections, 1)
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package content
+
+import (
+	"context"
+	"encoding/json"
+
+	"encore.app/content/convert"
+	"encore.app/content/internal"
+	"encore.app/pagination"
+)
+
+// webhookPolicy blocks the webhooks on the addresses of the network of the service.
+var webhookPolicy = internal.NewWebhookPolicy()
+
+// ListWebhooksParams is the parameters for listing the webhooks of a database
+type ListWebhooksParams struct {
+	// The unique identifier of the database
+	DatabaseID int64
+}
+
+// ListWebhooksResponse is the list of webhooks of the given database
+type ListWebhooksResponse struct {
+	// The webhooks of the database and of its collections, sorted by ID
+	Webhooks []convert.WebhookPayload
+}
+
+// ListWebhooks lists the webhooks of a database, including the ones of its collections
+//encore:api auth
+func ListWebhooks(ctx context.Context, params *ListWebhooksParams) (*ListWebhooksResponse, error) {
+	webhooks, err := internal.ListWebhooks(ctx, params.DatabaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListWebhooksResponse{
+		Webhooks: webhooks,
+	}, nil
+}
+
+// CreateWebhookParams is the parameters for registering a webhook receiving the changes made to documents
+type CreateWebhookParams struct {
+	// The unique identifier of the database to receive the changes of, when receiving the changes of all the
+	// collections of a database
+	DatabaseID int64
+
+	// The unique identifier of the collection to receive the changes of, when receiving the changes of a
+	// single collection
+	CollectionID int64
+
+	// The absolute http or https URL to send the changes to
+	URL string
+
+	// The operations on the documents to receive the changes of, among `insert`, `update` and `delete`.
+	// Defaults to all of them
+	Events []string
+
+	// A filter the content of the documents must match for their changes to be sent, in the same format as
+	// the filter of ListDocuments
+	Filter json.RawMessage
+}
+
+// CreateWebhookResponse is the result of registering a webhook
+type CreateWebhookResponse struct {
+	// A message to inform the user of the result of the operation
+	Message string
+
+	// The registered webhook
+	Webhook convert.WebhookPayload
+
+	// The secret signing the deliveries of the webhook, it is never returned again
+	Secret string
+}
+
+// CreateWebhook registers a webhook receiving the changes made to the documents of a database or of a
+// collection, from the next change. Each change is sent in a POST request with the change as JSON body, in
+// the same format as the changes streamed by StreamChanges.
+//
+// Requests are signed with the secret of the webhook: the `Webhook-Signature` header is `sha256=` followed by
+// the hex encoded HMAC-SHA256 of the `Webhook-Timestamp` header and the body joined by a dot. The ID of the
+// delivery is given in the `Webhook-ID` header, and the operation in the `Webhook-Event` header. A change is
+// delivered once the webhook responds with a 2xx status, and attempted again with an exponential backoff
+// otherwise, up to 8 attempts. Changes can be delivered more than once and out of order, the version of the
+// document tells which change is the latest.
+//encore:api auth
+func CreateWebhook(ctx context.Context, params *CreateWebhookParams) (*CreateWebhookResponse, error) {
+	webhook, secret, err := internal.CreateWebhook(ctx, webhookPolicy, params.DatabaseID, params.CollectionID, params.URL, params.Events, params.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CreateWebhookResponse{
+		Message: "Webhook created successfully.",
+		Webhook: webhook,
+		Secret:  secret,
+	}, nil
+}
+
+// UpdateWebhookParams is the parameters for updating a webhook
+type UpdateWebhookParams struct {
+	// The unique identifier of the webhook
+	ID int64
+
+	// The absolute http or https URL to send the changes to. The current URL is kept when none is given
+	URL string
+
+	// The operations on the documents to receive the changes of. The current events are kept when none
+	// are given
+	Events []string
+
+	// A filter the content of the documents must match for their changes to be sent, replacing the current
+	// one. The current filter is kept when none is given
+	Filter json.RawMessage
+
+	// Whether to remove the filter of the webhook
+	RemoveFilter bool
+
+	// Whether the changes are sent to the webhook. The changes made while a webhook is inactive are sent once
+	// it is active again, as long as they are still kept. The current setting is kept when none is given
+	Active *bool
+}
+
+// UpdateWebhookResponse is the result of updating a webhook
+type UpdateWebhookResponse struct {
+	// A message to inform the user of the result of the operation
+	Message string
+
+	// The updated webhook
+	Webhook convert.WebhookPayload
+}
+
+// UpdateWebhook updates the URL, events, filter or activity of a webhook
+//encore:api auth
+func UpdateWebhook(ctx context.Context, params *UpdateWebhookParams) (*UpdateWebhookResponse, error) {
+	webhook, err := internal.UpdateWebhook(ctx, webhookPolicy, params.ID, params.URL, params.Events, params.Filter, params.RemoveFilter, params.Active)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UpdateWebhookResponse{
+		Message: "Webhook updated successfully.",
+		Webhook: webhook,
+	}, nil
+}
+
+// DeleteWebhookParams is the parameters for deleting a webhook
+type DeleteWebhookParams struct {
+	// The unique identifier of the webhook
+	ID int64
+}
+
+// DeleteWebhookResponse is the result of deleting a webhook
+type DeleteWebhookResponse struct {
+	// A message to inform the user of the result of the operation
+	Message string
+
+	// The deleted webhook
+	Webhook convert.WebhookPayload
+}
+
+// DeleteWebhook deletes a webhook along with its delivery log, its pending deliveries are not sent
+//encore:api auth
+func DeleteWebhook(ctx context.Context, params *DeleteWebhookParams) (*DeleteWebhookResponse, error) {
+	webhook, err := internal.DeleteWebhook(ctx, params.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeleteWebhookResponse{
+		Message: "Webhook deleted successfully.",
+		Webhook: webhook,
+	}, nil
+}
+
+// ListWebhookDeliveriesParams is the parameters for listing the delivery log of a webhook
+type ListWebhookDeliveriesParams struct {
+	// The unique identifier of the webhook
+	WebhookID int64
+
+	// Only list the deliveries with this status, one of `pending`, `delivered` or `failed`
+	Status string
+
+	// The maximum number of deliveries to return, defaults to 100 and cannot exceed 1000
+	Limit int
+
+	// The cursor returned as `NextCursor` by the previous call, to fetch the next page of deliveries
+	Cursor string
+
+	// Whether to sort the deliveries from the most recent one
+	Descending bool
+}
+
+// ListWebhookDeliveriesResponse is a page of the delivery log of a webhook
+type ListWebhookDeliveriesResponse struct {
+	// The deliveries of the webhook, sorted by the date they were queued
+	Deliveries []convert.WebhookDeliveryPayload
+
+	// The cursor to give to the next call to fetch the next page of deliveries, empty when there are
+	// no more deliveries to fetch
+	NextCursor string
+}
+
+// ListWebhookDeliveries lists the delivery log of a webhook, one page at a time, with the outcome of the
+// last attempt of each delivery.
+//encore:api auth
+func ListWebhookDeliveries(ctx context.Context, params *ListWebhookDeliveriesParams) (*ListWebhookDeliveriesResponse, error) {
+	deliveries, nextCursor, err := internal.ListWebhookDeliveries(ctx, params.WebhookID, params.Status, pagination.Params{
+		Limit:      params.Limit,
+		Cursor:     params.Cursor,
+		Descending: params.Descending,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListWebhookDeliveriesResponse{
+		Deliveries: deliveries,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// ReplayWebhookDeliveryParams is the parameters for replaying a delivery of a webhook
+type ReplayWebhookDeliveryParams struct {
+	// The unique identifier of the webhook
+	WebhookID int64
+
+	// The unique identifier of the delivery
+	ID int64
+}
+
+// ReplayWebhookDeliveryResponse is the result of replaying a delivery of a webhook
+type ReplayWebhookDeliveryResponse struct {
+	// A message to inform the user of the result of the operation
+	Message string
+
+	// The replayed delivery, pending once again
+	Delivery convert.WebhookDeliveryPayload
+}
+
+// ReplayWebhookDelivery queues a delivery of a webhook again, whatever its status, with its attempts reset.
+// The same change is sent again with the same ID.
+//encore:api auth
+func ReplayWebhookDelivery(ctx context.Context, params *ReplayWebhookDeliveryParams) (*ReplayWebhookDeliveryResponse, error) {
+	delivery, err := internal.ReplayWebhookDelivery(ctx, params.WebhookID, params.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReplayWebhookDeliveryResponse{
+		Message:  "Webhook delivery queued successfully.",
+		Delivery: delivery,
+	}, nil
+}
+
+// DeliverWebhooksResponse is the result of a run delivering the changes to the webhooks
+type DeliverWebhooksResponse struct {
+	// The number of deliveries queued for the changes committed since the last run
+	Queued int64
+
+	// The number of changes delivered
+	Delivered int64
+
+	// The number of attempts that failed, the deliveries are attempted again later unless they ran out of
+	// attempts
+	Failed int64
+}
+
+// DeliverWebhooks queues the deliveries of the changes committed since the last run to the webhooks, then
+// attempts the deliveries that are due. The service runs the deliveries every 5 seconds.
+//encore:api private
+func DeliverWebhooks(ctx context.Context) (*DeliverWebhooksResponse, error) {
+	queued, delivered, failed, err := internal.DeliverWebhooks(ctx, webhookPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeliverWebhooksResponse{
+		Queued:    queued,
+		Delivered: delivered,
+		Failed:    failed,
+	}, nil
+}
@@ -0,0 +1,385 @@
+package content
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"encore.dev/beta/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"encore.app/content/internal"
+	"encore.app/content/test_utils"
+	test_utils_permissions "encore.app/permissions/test_utils"
+	test_utils2 "encore.app/test_utils"
+)
+
+// verifyWebhookSignature checks a request received by a webhook is signed with its secret.
+func verifyWebhookSignature(t *testing.T, secret string, request test_utils.WebhookTestRequest) {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(request.Header.Get("Webhook-Timestamp") + "."))
+	mac.Write(request.Body)
+
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), request.Header.Get("Webhook-Signature"))
+}
+
+// allowLoopbackWebhooks allows the webhooks on the loopback addresses of the test receivers until the end of
+// the test.
+func allowLoopbackWebhooks(t *testing.T) {
+	_, ipv4, _ := net.ParseCIDR("127.0.0.0/8")
+	_, ipv6, _ := net.ParseCIDR("::1/128")
+
+	policy := webhookPolicy
+	webhookPolicy = internal.NewWebhookPolicy(ipv4, ipv6)
+	t.Cleanup(func() {
+		webhookPolicy = policy
+	})
+}
+
+func TestCreateWebhook(t *testing.T) {
+	tcs := []struct {
+		scenario string
+		role     string
+		params   *CreateWebhookParams
+		expected error
+	}{
+		{
+			scenario: "Creates a webhook on a collection",
+			role:     "admin",
+			params: &CreateWebhookParams{
+				CollectionID: 2,
+				URL:          "https://example.com/hooks",
+				Events:       []string{"update", "insert", "update"},
+				Filter:       json.RawMessage(`{"status": "published"}`),
+			},
+		},
+		{
+			scenario: "Creates a webhook on a database",
+			role:     "admin",
+			params: &CreateWebhookParams{
+				DatabaseID: 1,
+				URL:        "http://example.com:8080/hooks",
+			},
+		},
+		{
+			scenario: "Throws an error when both a database and a collection are given",
+			role:     "admin",
+			params: &CreateWebhookParams{
+				DatabaseID:   1,
+				CollectionID: 2,
+				URL:          "https://example.com/hooks",
+			},
+			expected: &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: "Received webhook was not valid, it receives the changes either of a database or of a collection",
+			},
+		},
+		{
+			scenario: "Throws an error when the URL is not an absolute http URL",
+			role:     "admin",
+			params: &CreateWebhookParams{
+				CollectionID: 2,
+				URL:          "ftp://example.com/hooks",
+			},
+			expected: &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: "Received URL was not valid, it must be an absolute http or https URL of at most 2048 characters",
+			},
+		},
+		{
+			scenario: "Throws an error when the host of the URL resolves to a loopback address",
+			role:     "admin",
+			params: &CreateWebhookParams{
+				CollectionID: 2,
+				URL:          "http://localhost:8080/hooks",
+			},
+			expected: &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: "Received URL was not valid, its host must not be a loopback, link-local, private or unspecified address",
+			},
+		},
+		{
+			scenario: "Throws an error when the host of the URL is a link-local address",
+			role:     "admin",
+			params: &CreateWebhookParams{
+				CollectionID: 2,
+				URL:          "http://169.254.169.254/latest/meta-data",
+			},
+			expected: &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: "Received URL was not valid, its host must not be a loopback, link-local, private or unspecified address",
+			},
+		},
+		{
+			scenario: "Throws an error when the host of the URL is a private address",
+			role:     "admin",
+			params: &CreateWebhookParams{
+				CollectionID: 2,
+				URL:          "http://10.0.0.1/hooks",
+			},
+			expected: &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: "Received URL was not valid, its host must not be a loopback, link-local, private or unspecified address",
+			},
+		},
+		{
+			scenario: "Throws an error when an event is not an operation",
+			role:     "admin",
+			params: &CreateWebhookParams{
+				CollectionID: 2,
+				URL:          "https://example.com/hooks",
+				Events:       []string{"upsert"},
+			},
+			expected: &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: "Received events were not valid, `upsert` is not one of `insert`, `update`, `delete`",
+			},
+		},
+		{
+			scenario: "Throws an error when the collection does not exist",
+			role:     "admin",
+			params: &CreateWebhookParams{
+				CollectionID: 99,
+				URL:          "https://example.com/hooks",
+			},
+			expected: &errs.Error{
+				Code:    errs.NotFound,
+				Message: "Could not find collection",
+			},
+		},
+		{
+			scenario: "Throws an error when the key cannot administrate the database",
+			role:     "write",
+			params: &CreateWebhookParams{
+				CollectionID: 2,
+				URL:          "https://example.com/hooks",
+			},
+			expected: &errs.Error{
+				Code:    errs.PermissionDenied,
+				Message: "API key doesn't have the ability to administrate the database",
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := fixtureContext(t, articlesFixture(tc.role))
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			response, err := CreateWebhook(ctx, tc.params)
+			if tc.expected != nil {
+				test_utils2.CompareErrors(t, tc.expected, err)
+				assert.Nil(t, response)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Len(t, response.Secret, 64)
+			assert.True(t, response.Webhook.Active)
+			assert.Equal(t, tc.params.URL, response.Webhook.URL)
+			assert.Equal(t, int64(1), response.Webhook.DatabaseID)
+			assert.Equal(t, tc.params.CollectionID, response.Webhook.CollectionID)
+
+			listed, err := ListWebhooks(ctx, &ListWebhooksParams{DatabaseID: 1})
+			require.NoError(t, err)
+			require.Len(t, listed.Webhooks, 1)
+			assert.Equal(t, response.Webhook.ID, listed.Webhooks[0].ID)
+
+			if len(tc.params.Events) > 0 {
+				assert.Equal(t, []string{"insert", "update"}, listed.Webhooks[0].Events)
+				assert.JSONEq(t, string(tc.params.Filter), string(listed.Webhooks[0].Filter))
+			} else {
+				assert.Equal(t, []string{"insert", "update", "delete"}, listed.Webhooks[0].Events)
+				assert.Nil(t, listed.Webhooks[0].Filter)
+			}
+		})
+	}
+}
+
+func TestDeliverWebhooks(t *testing.T) {
+	tcs := []struct {
+		scenario string
+		params   CreateWebhookParams
+		expected []string
+	}{
+		{
+			scenario: "Delivers all the changes of a collection",
+			params:   CreateWebhookParams{CollectionID: 2},
+			expected: []string{"insert", "update", "delete"},
+		},
+		{
+			scenario: "Delivers the changes of the operations of the events",
+			params:   CreateWebhookParams{DatabaseID: 1, Events: []string{"delete"}},
+			expected: []string{"delete"},
+		},
+		{
+			scenario: "Delivers the changes to documents with a content matching the filter",
+			params:   CreateWebhookParams{CollectionID: 2, Filter: json.RawMessage(`{"status": "published"}`)},
+			expected: []string{"update", "delete"},
+		},
+		{
+			scenario: "Does not deliver the changes of other collections",
+			params:   CreateWebhookParams{CollectionID: 3},
+			expected: []string{},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			ctx := fixtureContext(t, articlesFixture("admin"))
+			defer test_utils.Cleanup(ctx)
+			defer test_utils_permissions.Cleanup(ctx)
+
+			allowLoopbackWebhooks(t)
+			server, receiver := test_utils.CreateTestWebhookReceiver()
+			defer server.Close()
+
+			params := tc.params
+			params.URL = server.URL
+			created, err := CreateWebhook(ctx, &params)
+			require.NoError(t, err)
+
+			writeArticle(t)(ctx)
+
+			response, err := DeliverWebhooks(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(tc.expected)), response.Queued)
+			assert.Equal(t, int64(len(tc.expected)), response.Delivered)
+			assert.Equal(t, int64(0), response.Failed)
+
+			requests := receiver.Requests()
+			received := make([]string, 0, len(requests))
+			for _, request := range requests {
+				verifyWebhookSignature(t, created.Secret, request)
+
+				change := struct{ Operation string }{}
+				require.NoError(t, json.Unmarshal(request.Body, &change))
+				assert.Equal(t, request.Header.Get("Webhook-Event"), change.Operation)
+
+				received = append(received, change.Operation)
+			}
+			assert.ElementsMatch(t, tc.expected, received)
+
+			// Changes are only delivered once
+			response, err = DeliverWebhooks(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, DeliverWebhooksResponse{}, *response)
+		})
+	}
+}
+
+func TestDeliverWebhooksRetry(t *testing.T) {
+	ctx := fixtureContext(t, articlesFixture("admin"))
+	defer test_utils.Cleanup(ctx)
+	defer test_utils_permissions.Cleanup(ctx)
+
+	allowLoopbackWebhooks(t)
+	server, receiver := test_utils.CreateTestWebhookReceiver()
+	defer server.Close()
+	receiver.RespondWith(http.StatusInternalServerError)
+
+	created, err := CreateWebhook(ctx, &CreateWebhookParams{
+		CollectionID: 2,
+		URL:          server.URL,
+		Events:       []string{"insert"},
+	})
+	require.NoError(t, err)
+
+	writeArticle(t)(ctx)
+
+	response, err := DeliverWebhooks(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, DeliverWebhooksResponse{Queued: 1, Failed: 1}, *response)
+
+	deliveries, err := ListWebhookDeliveries(ctx, &ListWebhookDeliveriesParams{WebhookID: created.Webhook.ID})
+	require.NoError(t, err)
+	require.Len(t, deliveries.Deliveries, 1)
+
+	delivery := deliveries.Deliveries[0]
+	assert.Equal(t, "pending", delivery.Status)
+	assert.Equal(t, int32(1), delivery.Attempts)
+	assert.Equal(t, int32(http.StatusInternalServerError), delivery.ResponseStatus)
+	assert.Equal(t, "received status 500 from the webhook", delivery.Error)
+	assert.True(t, delivery.NextAttemptAt.After(time.Now().Add(20*time.Second)))
+
+	// The delivery is not attempted again before its backoff is over
+	response, err = DeliverWebhooks(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, DeliverWebhooksResponse{}, *response)
+
+	receiver.RespondWith(http.StatusNoContent)
+
+	replayed, err := ReplayWebhookDelivery(ctx, &ReplayWebhookDeliveryParams{
+		WebhookID: created.Webhook.ID,
+		ID:        delivery.ID,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "pending", replayed.Delivery.Status)
+	assert.Equal(t, int32(0), replayed.Delivery.Attempts)
+
+	response, err = DeliverWebhooks(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, DeliverWebhooksResponse{Delivered: 1}, *response)
+
+	deliveries, err = ListWebhookDeliveries(ctx, &ListWebhookDeliveriesParams{
+		WebhookID: created.Webhook.ID,
+		Status:    "delivered",
+	})
+	require.NoError(t, err)
+	require.Len(t, deliveries.Deliveries, 1)
+	assert.Equal(t, int32(1), deliveries.Deliveries[0].Attempts)
+	assert.Equal(t, int32(http.StatusNoContent), deliveries.Deliveries[0].ResponseStatus)
+	assert.NotNil(t, deliveries.Deliveries[0].DeliveredAt)
+
+	requests := receiver.Requests()
+	require.Len(t, requests, 2)
+	assert.Equal(t, requests[0].Body, requests[1].Body)
+	assert.Equal(t, requests[0].Header.Get("Webhook-ID"), requests[1].Header.Get("Webhook-ID"))
+
+	_, err = ReplayWebhookDelivery(ctx, &ReplayWebhookDeliveryParams{
+		WebhookID: created.Webhook.ID,
+		ID:        delivery.ID + 1,
+	})
+	test_utils2.CompareErrors(t, &errs.Error{
+		Code:    errs.NotFound,
+		Message: "Could not find webhook delivery",
+	}, err)
+}
+
+func TestScheduledWebhookDelivery(t *testing.T) {
+	ctx := fixtureContext(t, articlesFixture("admin"))
+	defer test_utils.Cleanup(ctx)
+	defer test_utils_permissions.Cleanup(ctx)
+
+	allowLoopbackWebhooks(t)
+	server, receiver := test_utils.CreateTestWebhookReceiver()
+	defer server.Close()
+
+	created, err := CreateWebhook(ctx, &CreateWebhookParams{
+		CollectionID: 2,
+		URL:          server.URL,
+		Events:       []string{"insert"},
+	})
+	require.NoError(t, err)
+
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	writeArticle(t)(ctx)
+
+	// The change is delivered by the scheduler of the service, without calling DeliverWebhooks
+	require.Eventually(t, func() bool {
+		return len(receiver.Requests()) == 1
+	}, 15*time.Second, 100*time.Millisecond)
+
+	request := receiver.Requests()[0]
+	verifyWebhookSignature(t, created.Secret, request)
+	assert.Equal(t, "insert", request.Header.Get("Webhook-Event"))
+}
@@ -15,6 +15,7 @@ import (
 	"encore.app/identity/keys"
 	"encore.app/identity/models"
 	"encore.app/identity/models/generated/identity/public/model"
+	"encore.app/pagination"
 	"encore.app/permissions"
 	model_permissions "encore.app/permissions/models/generated/permissions/public/model"
 )
@@ -149,6 +150,21 @@ type PublicKey struct {
 	CreatedDate time.Time
 }
 
+// ListApiKeysParams is the parameters for listing the API keys of the authenticated user.
+type ListApiKeysParams struct {
+	// The maximum number of keys to return, defaults to 100 and cannot exceed 1000
+	Limit int
+
+	// The cursor returned as `NextCursor` by the previous call, to fetch the next page of keys
+	Cursor string
+
+	// The field to sort the keys by, one of `created_at` or `updated_at`. Defaults to `created_at`
+	SortBy string
+
+	// Whether to sort the keys in descending order
+	Descending bool
+}
+
 // ListUserAPIKeysResponse is the result of fetching the all the API keys currently in
 // effect for the authenticated user.
 type ListUserAPIKeysResponse struct {
@@ -157,11 +173,15 @@ type ListUserAPIKeysResponse struct {
 
 	// The keys found for the authenticated user.
 	Keys []PublicKey
+
+	// The cursor to give to the next call to fetch the next page of keys, empty when there are
+	// no more keys to fetch
+	NextCursor string
 }
 
-// ListApiKeys will list all the API keys available for the authenticated user.
+// ListApiKeys will list the API keys available for the authenticated user, one page at a time.
 //encore:api auth
-func ListApiKeys(ctx context.Context) (*ListUserAPIKeysResponse, error) {
+func ListApiKeys(ctx context.Context, params *ListApiKeysParams) (*ListUserAPIKeysResponse, error) {
 	userData := auth.Data().(*UserData)
 
 	can, err := permissions.Can(ctx, &permissions.CanParams{
@@ -175,7 +195,32 @@ func ListApiKeys(ctx context.Context) (*ListUserAPIKeysResponse, error) {
 		}
 	}
 
-	apiKeys, err := models.ListApiKeysForUser(ctx, userData.ID)
+	pageParams := pagination.Params{
+		Limit:      params.Limit,
+		Cursor:     params.Cursor,
+		SortBy:     params.SortBy,
+		Descending: params.Descending,
+	}
+
+	sortKey, err := models.ApiKeySortKey(params.SortBy)
+	if err != nil {
+		log.WithError(err).Warning("Could not find the sort key for API keys")
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("Received pagination was not valid, %s", err.Error()),
+		}
+	}
+
+	page, err := pagination.NewPage(pageParams, sortKey)
+	if err != nil {
+		log.WithError(err).Warning("Could not validate the pagination of the list request")
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("Received pagination was not valid, %s", err.Error()),
+		}
+	}
+
+	apiKeys, nextCursor, err := models.ListApiKeysForUser(ctx, userData.ID, page)
 	if err != nil {
 		log.WithError(err).Error("Could not fetch API keys for this user")
 		return nil, &errs.Error{
@@ -194,8 +239,9 @@ func ListApiKeys(ctx context.Context) (*ListUserAPIKeysResponse, error) {
 	}
 
 	return &ListUserAPIKeysResponse{
-		Message: fmt.Sprintf("Found %d keys on this account.", len(publicKeys)),
-		Keys:    publicKeys,
+		Message:    fmt.Sprintf("Found %d keys on this account.", len(publicKeys)),
+		Keys:       publicKeys,
+		NextCursor: nextCursor,
 	}, nil
 }
 
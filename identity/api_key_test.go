@@ -328,7 +328,7 @@ func TestListApiKeys(t *testing.T) {
 				}
 			}
 
-			response, err := ListApiKeys(ctx)
+			response, err := ListApiKeys(ctx, &ListApiKeysParams{})
 			if tc.expected.err != nil {
 				test_utils2.CompareErrors(t, tc.expected.err, err)
 				assert.Nil(t, response)
@@ -2,6 +2,7 @@ package models
 
 import (
 	"context"
+	"fmt"
 
 	"encore.dev/storage/sqldb"
 	"github.com/go-jet/jet/v2/postgres"
@@ -9,6 +10,7 @@ import (
 
 	"encore.app/identity/models/generated/identity/public/model"
 	"encore.app/identity/models/generated/identity/public/table"
+	"encore.app/pagination"
 )
 
 var db = sqldb.Named("identity").Stdlib()
@@ -22,9 +24,22 @@ func NewApiKey(value string, userID int64) *model.APIKeys {
 	}
 }
 
-// ListApiKeysForUser fetches all the API keys for a specific user, returns an empty array
-// on an error.
-func ListApiKeysForUser(ctx context.Context, userID int64) ([]*model.APIKeys, error) {
+// ApiKeySortKey returns the key to sort API keys by given its name, either `created_at`
+// or `updated_at`. API keys are sorted by creation date when no name is given.
+func ApiKeySortKey(sortBy string) (pagination.SortKey, error) {
+	switch sortBy {
+	case "", "created_at":
+		return pagination.ColumnKey("created_at", table.APIKeys.CreatedAt), nil
+	case "updated_at":
+		return pagination.ColumnKey("updated_at", table.APIKeys.UpdatedAt), nil
+	}
+
+	return pagination.SortKey{}, fmt.Errorf("API keys can only be sorted by `created_at` or `updated_at`")
+}
+
+// ListApiKeysForUser fetches a page of the API keys for a specific user, returns an empty array
+// on an error. The cursor to the next page is returned if there are more keys to fetch.
+func ListApiKeysForUser(ctx context.Context, userID int64, page *pagination.Page) ([]*model.APIKeys, string, error) {
 	statement := postgres.SELECT(
 		table.APIKeys.ID,
 		table.APIKeys.Value,
@@ -33,17 +48,32 @@ func ListApiKeysForUser(ctx context.Context, userID int64) ([]*model.APIKeys, er
 		table.APIKeys.CreatedAt,
 		table.APIKeys.UpdatedAt,
 	).FROM(table.APIKeys).WHERE(
-		table.APIKeys.UserID.EQ(postgres.Int64(userID)),
-	)
+		page.Where(table.APIKeys.UserID.EQ(postgres.Int64(userID)), table.APIKeys.ID),
+	).ORDER_BY(
+		page.OrderBy(table.APIKeys.ID)...,
+	).LIMIT(page.Fetch())
 
 	var keys []*model.APIKeys
 	err := statement.QueryContext(ctx, db, &keys)
 	if err != nil {
 		log.WithError(err).Error("Could not query api keys")
-		return nil, err
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if page.HasNext(len(keys)) {
+		keys = keys[:page.Limit]
+
+		last := keys[len(keys)-1]
+		value := last.CreatedAt
+		if page.SortKey.Name == "updated_at" {
+			value = last.UpdatedAt
+		}
+
+		nextCursor = page.Next(last.ID, pagination.TimestampValue(value))
 	}
 
-	return keys, nil
+	return keys, nextCursor, nil
 }
 
 // GetApiKey gets an API key from a database ID, returning it
@@ -0,0 +1,188 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-jet/jet/v2/postgres"
+)
+
+const (
+	// DefaultLimit is the number of records returned by list endpoints when no limit is given.
+	DefaultLimit = 100
+
+	// MaxLimit is the maximum number of records list endpoints can return in a single page.
+	MaxLimit = 1000
+)
+
+// Params are the pagination parameters received by list endpoints.
+type Params struct {
+	// The maximum number of records to return, defaults to DefaultLimit.
+	Limit int
+
+	// The cursor returned by the previous page, if any.
+	Cursor string
+
+	// The name of the sort key to order the records by.
+	SortBy string
+
+	// Whether to sort the records in descending order.
+	Descending bool
+}
+
+// SortKey is an expression list endpoints can order their records by.
+type SortKey struct {
+	// The name of the key, as given by clients in SortBy.
+	Name string
+
+	// The expression to order by, it should never be NULL.
+	Expression postgres.Expression
+
+	// The SQL type of the expression, used to cast the values stored in cursors.
+	Type string
+}
+
+// ColumnKey creates a sort key on a timestamp column of a table.
+func ColumnKey(name string, column postgres.Column) SortKey {
+	return SortKey{
+		Name:       name,
+		Expression: column,
+		Type:       "timestamptz",
+	}
+}
+
+// TimestampValue converts a timestamp to the value stored in cursors for timestamp sort keys.
+func TimestampValue(value time.Time) string {
+	return value.Format(time.RFC3339Nano)
+}
+
+// Cursor points to the last record of a page. The next page starts right after this record.
+type Cursor struct {
+	SortBy     string `json:"s"`
+	Descending bool   `json:"d"`
+	Value      string `json:"v"`
+	ID         int64  `json:"i"`
+}
+
+// Encode encodes the cursor into an opaque string to return to clients.
+func (c Cursor) Encode() string {
+	encoded, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// DecodeCursor decodes a cursor previously encoded with Encode.
+func DecodeCursor(cursor string) (*Cursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("cursor is malformed")
+	}
+
+	parsed := &Cursor{}
+	err = json.Unmarshal(decoded, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("cursor is malformed")
+	}
+
+	return parsed, nil
+}
+
+// Page is a validated page request for a list endpoint, using keyset pagination on a sort key
+// and the ID of the records.
+type Page struct {
+	Limit      int
+	SortKey    SortKey
+	Descending bool
+	After      *Cursor
+}
+
+// NewPage validates the pagination parameters against the given sort key and creates a page.
+func NewPage(params Params, sortKey SortKey) (*Page, error) {
+	page := &Page{
+		Limit:      params.Limit,
+		SortKey:    sortKey,
+		Descending: params.Descending,
+	}
+
+	if page.Limit == 0 {
+		page.Limit = DefaultLimit
+	} else if page.Limit < 0 || page.Limit > MaxLimit {
+		return nil, fmt.Errorf("limit must be between 1 and %d", MaxLimit)
+	}
+
+	if params.Cursor != "" {
+		cursor, err := DecodeCursor(params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		if cursor.SortBy != sortKey.Name || cursor.Descending != params.Descending {
+			return nil, fmt.Errorf("cursor was created for a different sort order")
+		}
+
+		page.After = cursor
+	}
+
+	return page, nil
+}
+
+// Condition returns the condition selecting the records after the cursor of the page, or nil
+// when the page is the first one.
+func (p *Page) Condition(id postgres.Column) postgres.BoolExpression {
+	if p.After == nil {
+		return nil
+	}
+
+	// jet has no generic expression type, type the sort key as a string to allow comparisons.
+	key := postgres.StringExp(p.SortKey.Expression)
+	value := postgres.StringExp(postgres.CAST(postgres.String(p.After.Value)).AS(p.SortKey.Type))
+	lastID := postgres.Int64(p.After.ID)
+
+	if p.Descending {
+		return key.LT(value).OR(key.EQ(value).AND(postgres.IntExp(id).LT(lastID)))
+	}
+
+	return key.GT(value).OR(key.EQ(value).AND(postgres.IntExp(id).GT(lastID)))
+}
+
+// Where adds the condition of the page to the given condition.
+func (p *Page) Where(condition postgres.BoolExpression, id postgres.Column) postgres.BoolExpression {
+	after := p.Condition(id)
+	if after == nil {
+		return condition
+	}
+
+	return condition.AND(after)
+}
+
+// OrderBy returns the ordering of the records for the page.
+func (p *Page) OrderBy(id postgres.Column) []postgres.OrderByClause {
+	if p.Descending {
+		return []postgres.OrderByClause{p.SortKey.Expression.DESC(), id.DESC()}
+	}
+
+	return []postgres.OrderByClause{p.SortKey.Expression.ASC(), id.ASC()}
+}
+
+// Fetch returns the number of records to fetch for the page. One more record than the limit is
+// fetched to know if there is a next page.
+func (p *Page) Fetch() int64 {
+	return int64(p.Limit + 1)
+}
+
+// HasNext returns whether a next page exists given the number of fetched records.
+func (p *Page) HasNext(fetched int) bool {
+	return fetched > p.Limit
+}
+
+// Next creates the encoded cursor for the next page, given the ID and sort value of the
+// last record of the current page.
+func (p *Page) Next(lastID int64, lastValue string) string {
+	return Cursor{
+		SortBy:     p.SortKey.Name,
+		Descending: p.Descending,
+		Value:      lastValue,
+		ID:         lastID,
+	}.Encode()
+}
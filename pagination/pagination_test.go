@@ -0,0 +1,123 @@
+package pagination
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-jet/jet/v2/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"encore.app/content/models/generated/content/public/table"
+)
+
+func TestNewPage(t *testing.T) {
+	sortKey := ColumnKey("created_at", table.Documents.CreatedAt)
+	cursor := Cursor{SortBy: "created_at", Value: "2021-01-01T00:00:00Z", ID: 42}.Encode()
+
+	tcs := []struct {
+		scenario string
+		params   Params
+		expected *Page
+		err      error
+	}{
+		{
+			scenario: "Uses the default limit when none is given",
+			params:   Params{},
+			expected: &Page{Limit: DefaultLimit, SortKey: sortKey},
+		},
+		{
+			scenario: "Decodes the cursor of the previous page",
+			params:   Params{Limit: 10, Cursor: cursor},
+			expected: &Page{
+				Limit:   10,
+				SortKey: sortKey,
+				After:   &Cursor{SortBy: "created_at", Value: "2021-01-01T00:00:00Z", ID: 42},
+			},
+		},
+		{
+			scenario: "Fails when the limit is too large",
+			params:   Params{Limit: MaxLimit + 1},
+			err:      fmt.Errorf("limit must be between 1 and %d", MaxLimit),
+		},
+		{
+			scenario: "Fails when the limit is negative",
+			params:   Params{Limit: -1},
+			err:      fmt.Errorf("limit must be between 1 and %d", MaxLimit),
+		},
+		{
+			scenario: "Fails when the cursor is malformed",
+			params:   Params{Cursor: "not a cursor"},
+			err:      fmt.Errorf("cursor is malformed"),
+		},
+		{
+			scenario: "Fails when the cursor was created for another order",
+			params:   Params{Cursor: cursor, Descending: true},
+			err:      fmt.Errorf("cursor was created for a different sort order"),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			page, err := NewPage(tc.params, sortKey)
+			if tc.err != nil {
+				assert.Equal(t, tc.err, err)
+				assert.Nil(t, page)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, page)
+		})
+	}
+}
+
+func TestPageCondition(t *testing.T) {
+	sortKey := ColumnKey("created_at", table.Documents.CreatedAt)
+
+	tcs := []struct {
+		scenario   string
+		descending bool
+		condition  string
+	}{
+		{
+			scenario:  "Selects the records after the cursor",
+			condition: `(documents.created_at > $2::timestamptz) OR ((documents.created_at = $3::timestamptz) AND (documents.id > $4))`,
+		},
+		{
+			scenario:   "Selects the records before the cursor when descending",
+			descending: true,
+			condition:  `(documents.created_at < $2::timestamptz) OR ((documents.created_at = $3::timestamptz) AND (documents.id < $4))`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.scenario, func(t *testing.T) {
+			page := &Page{
+				Limit:      10,
+				SortKey:    sortKey,
+				Descending: tc.descending,
+				After:      &Cursor{SortBy: "created_at", Descending: tc.descending, Value: "2021-01-01T00:00:00Z", ID: 42},
+			}
+
+			query, args := postgres.SELECT(table.Documents.ID).
+				FROM(table.Documents).
+				WHERE(page.Where(table.Documents.CollectionID.EQ(postgres.Int64(1)), table.Documents.ID)).
+				Sql()
+
+			assert.Contains(t, query, tc.condition)
+			assert.Equal(t, []interface{}{int64(1), "2021-01-01T00:00:00Z", "2021-01-01T00:00:00Z", int64(42)}, args)
+		})
+	}
+}
+
+func TestPageNext(t *testing.T) {
+	page := &Page{Limit: 2, SortKey: ColumnKey("updated_at", table.Documents.UpdatedAt), Descending: true}
+
+	assert.False(t, page.HasNext(2))
+	assert.True(t, page.HasNext(3))
+
+	cursor, err := DecodeCursor(page.Next(7, "2021-01-01T00:00:00Z"))
+	require.NoError(t, err)
+	assert.Equal(t, &Cursor{SortBy: "updated_at", Descending: true, Value: "2021-01-01T00:00:00Z", ID: 7}, cursor)
+}